@@ -0,0 +1,193 @@
+package krs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAccumulatorMemoryLimit = 64 << 20
+	bytesPerSample                = 4
+)
+
+// PCMAccumulator collects audio samples in memory up to a limit, then spills them to a temporary
+// file so long syntheses do not hold gigabytes in RAM. It implements AudioSink.
+type PCMAccumulator struct {
+	mutex       sync.Mutex
+	memoryLimit int // in samples
+	memory      []float32
+	spill       *os.File
+	spillWriter *bufio.Writer
+	scratch     []byte
+	length      int
+}
+
+// NewPCMAccumulator returns an accumulator keeping at most memoryLimit bytes of samples in RAM
+// (64MiB if 0 or less). Close must be called to remove the temporary file.
+func NewPCMAccumulator(memoryLimit int) *PCMAccumulator {
+	if memoryLimit <= 0 {
+		memoryLimit = defaultAccumulatorMemoryLimit
+	}
+	return &PCMAccumulator{
+		memoryLimit: memoryLimit / bytesPerSample,
+	}
+}
+
+func (a *PCMAccumulator) WritePCM(pcm []float32) (err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// Stay in memory while we can
+	if a.spill == nil && len(a.memory)+len(pcm) <= a.memoryLimit {
+		a.memory = append(a.memory, pcm...)
+		a.length += len(pcm)
+		return
+	}
+	// Spill everything to disk
+	if a.spill == nil {
+		if a.spill, err = os.CreateTemp("", "krs-pcm-*.f32"); err != nil {
+			err = fmt.Errorf("failed to create the spill file: %w", err)
+			return
+		}
+		a.spillWriter = bufio.NewWriterSize(a.spill, 1<<20)
+		pending := a.memory
+		a.memory = nil
+		if err = a.writeSpill(pending); err != nil {
+			return
+		}
+	}
+	if err = a.writeSpill(pcm); err != nil {
+		return
+	}
+	a.length += len(pcm)
+	return
+}
+
+// writeSpill must be called with the mutex held.
+func (a *PCMAccumulator) writeSpill(pcm []float32) (err error) {
+	a.scratch = a.scratch[:0]
+	for _, sample := range pcm {
+		a.scratch = binary.LittleEndian.AppendUint32(a.scratch, math.Float32bits(sample))
+	}
+	if _, err = a.spillWriter.Write(a.scratch); err != nil {
+		err = fmt.Errorf("failed to write to the spill file: %w", err)
+		return
+	}
+	return
+}
+
+// Discard drops all the samples accumulated so far.
+func (a *PCMAccumulator) Discard() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.memory = a.memory[:0]
+	a.length = 0
+	if a.spill != nil {
+		_ = a.removeSpill() // best effort, the file is in the temp dir anyway
+	}
+}
+
+// Len returns the number of samples accumulated.
+func (a *PCMAccumulator) Len() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.length
+}
+
+func (a *PCMAccumulator) Duration() time.Duration {
+	return time.Duration(a.Len()) * time.Second / SampleRate
+}
+
+// Spilled reports whether the samples have been moved to disk.
+func (a *PCMAccumulator) Spilled() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.spill != nil
+}
+
+// Chunks iterates over the accumulated samples by chunks of at most chunkSize samples, reading
+// them back from disk if they were spilled. The yielded slice is reused between iterations and
+// can be modified freely. The accumulator is not locked while the loop body runs: the samples
+// written meanwhile are not part of the iteration, which stops early if they are discarded.
+func (a *PCMAccumulator) Chunks(chunkSize int) iter.Seq2[[]float32, error] {
+	return func(yield func([]float32, error) bool) {
+		if chunkSize <= 0 {
+			yield(nil, fmt.Errorf("invalid chunk size %d: must be positive", chunkSize))
+			return
+		}
+		var (
+			length = a.Len()
+			chunk  = make([]float32, chunkSize)
+			raw    = make([]byte, chunkSize*bytesPerSample)
+		)
+		for start := 0; start < length; start += chunkSize {
+			samples, err := a.readAt(chunk[:min(chunkSize, length-start)], raw, start)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if len(samples) == 0 || !yield(samples, nil) {
+				return
+			}
+		}
+	}
+}
+
+// readAt reads the samples from start into chunk, wherever they currently are, using raw to read
+// them from disk. It returns fewer samples if some were discarded.
+func (a *PCMAccumulator) readAt(chunk []float32, raw []byte, start int) (samples []float32, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if start >= a.length {
+		return
+	}
+	samples = chunk[:min(len(chunk), a.length-start)]
+	// In memory
+	if a.spill == nil {
+		copy(samples, a.memory[start:])
+		return
+	}
+	// On disk
+	if err = a.spillWriter.Flush(); err != nil {
+		err = fmt.Errorf("failed to flush the spill file: %w", err)
+		return
+	}
+	raw = raw[:len(samples)*bytesPerSample]
+	if _, err = a.spill.ReadAt(raw, int64(start)*bytesPerSample); err != nil {
+		err = fmt.Errorf("failed to read the spill file: %w", err)
+		return
+	}
+	for i := range samples {
+		samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*bytesPerSample:]))
+	}
+	return
+}
+
+// Close frees the samples and removes the spill file if any.
+func (a *PCMAccumulator) Close() (err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.memory = nil
+	a.length = 0
+	if a.spill != nil {
+		err = a.removeSpill()
+	}
+	return
+}
+
+// removeSpill must be called with the mutex held.
+func (a *PCMAccumulator) removeSpill() (err error) {
+	name := a.spill.Name()
+	_ = a.spill.Close()
+	a.spill, a.spillWriter = nil, nil
+	if err = os.Remove(name); err != nil {
+		err = fmt.Errorf("failed to remove the spill file: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package krs
+
+import (
+	"testing"
+)
+
+func TestPCMAccumulatorSpill(t *testing.T) {
+	acc := NewPCMAccumulator(FrameSize * bytesPerSample)
+	defer acc.Close()
+	var expected []float32
+	for frame := range 5 {
+		pcm := make([]float32, FrameSize*2/3)
+		for i := range pcm {
+			pcm[i] = float32(frame*len(pcm)+i) / 10_000
+		}
+		if err := acc.WritePCM(pcm); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, pcm...)
+	}
+	if !acc.Spilled() {
+		t.Fatal("accumulator should have spilled to disk")
+	}
+	if acc.Len() != len(expected) {
+		t.Fatalf("got %d samples, expected %d", acc.Len(), len(expected))
+	}
+	var got []float32
+	for chunk, err := range acc.Chunks(1000) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, chunk...)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("read back %d samples, expected %d", len(got), len(expected))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("sample %d: got %f, expected %f", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestPCMAccumulatorChunksUnlocked(t *testing.T) {
+	for _, spilled := range []bool{false, true} {
+		acc := NewPCMAccumulator(0)
+		if spilled {
+			acc = NewPCMAccumulator(FrameSize * bytesPerSample)
+		}
+		defer acc.Close()
+		if err := acc.WritePCM(make([]float32, 3*FrameSize)); err != nil {
+			t.Fatal(err)
+		}
+		// the accumulator can be used from the loop body
+		var read int
+		for chunk, err := range acc.Chunks(FrameSize) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			read += len(chunk)
+			if err = acc.WritePCM(chunk[:1]); err != nil {
+				t.Fatal(err)
+			}
+			if acc.Duration() == 0 {
+				t.Fatal("no duration")
+			}
+		}
+		if read != 3*FrameSize || acc.Len() != 3*FrameSize+3 || acc.Spilled() != spilled {
+			t.Errorf("spilled %v: read %d samples of %d", spilled, read, acc.Len())
+		}
+		// and stops if the samples are discarded
+		read = 0
+		for chunk, err := range acc.Chunks(FrameSize) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			read += len(chunk)
+			acc.Discard()
+		}
+		if read != FrameSize {
+			t.Errorf("spilled %v: read %d samples after the discard, expected a chunk", spilled, read)
+		}
+	}
+}
+
+func TestPCMAccumulatorChunkSize(t *testing.T) {
+	acc := NewPCMAccumulator(0)
+	defer acc.Close()
+	if err := acc.WritePCM(make([]float32, FrameSize)); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunkSize := range []int{0, -1} {
+		var errs int
+		for _, err := range acc.Chunks(chunkSize) {
+			if err == nil {
+				t.Fatalf("chunk size %d: got a chunk, expected an error", chunkSize)
+			}
+			errs++
+		}
+		if errs != 1 {
+			t.Errorf("chunk size %d: got %d errors", chunkSize, errs)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Transcribe is a one shot helper: it opens a connection, streams the audio (24kHz mono) as fast as
+// the server accepts it and returns the transcript once the server is done. The utterances end on
+// the server pause prediction. With STTConfig.MaxSessionDuration, the partial transcript is
+// returned along with ErrMaxSessionDuration. The levels of the audio are analysed (see
+// Transcript.Input and InputLevels.Warnings()), and normalized with STTConfig.NormalizeInput.
+func (client *STTClient) Transcribe(ctx context.Context, pcm []float32) (transcript Transcript, err error) {
+	var levels InputLevels
+	if client.normalize {
+		pcm = slices.Clone(pcm)
+		levels = NormalizeInput(pcm)
+	} else {
+		levels = AnalyzeInput(pcm)
+	}
+	// Open a connection
+	sttc, err := client.Connect(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to connect: %w", err)
+		return
+	}
+	transcript.Tags = sttc.Tags()
+	transcript.Input = &levels
+	connCtx := sttc.GetContext()
+	// Send the audio, closing the sender flushes the server buffers
+	go func() {
+		sender := sttc.GetWriteChan()
+		defer close(sender)
+		for frame := range slices.Chunk(pcm, FrameSize) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- frame:
+			}
+		}
+	}()
+	// Collect the words
+	receiver := sttc.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			switch typed := msg.(type) {
+			case MessagePackWord:
+				transcript.AddWord(Word{Text: typed.Text, Start: typed.StartTimeDuration()})
+			case MessagePackWordEnd:
+				transcript.SetWordEnd(typed.StopTimeDuration())
+			case MessagePackStep:
+				if typed.PausePrediction() > defaultPauseThreshold {
+					transcript.EndUtterance()
+				}
+			}
+		}
+	}
+	if err = sttc.Done(); err != nil && !errors.Is(err, ErrMaxSessionDuration) {
+		transcript = Transcript{}
+		return
+	}
+	return
+}
+
+// TranscribeParts transcribes the parts of a multi-part recording (dashcam or segmented meeting
+// recordings...) as one continuous stream, in order: the transcript times are on a single timeline
+// and starts holds the stream time at which each part begins.
+func (client *STTClient) TranscribeParts(ctx context.Context, parts [][]float32) (transcript Transcript, starts []time.Duration, err error) {
+	starts = make([]time.Duration, len(parts))
+	var samples int
+	for i, part := range parts {
+		starts[i] = STTStreamOffset + time.Duration(samples)*time.Second/SampleRate
+		samples += len(part)
+	}
+	transcript, err = client.Transcribe(ctx, slices.Concat(parts...))
+	return
+}
+
+// ErrInvalidRange is returned by TranscribeRange for a range outside of the recording.
+var ErrInvalidRange = errors.New("range outside of the recording")
+
+// TranscribeRange transcribes a slice of a recording, cut at the sample: the audio from start
+// lasting duration (up to the end of the recording if 0 or beyond it). Only the slice is streamed,
+// the spot checks of long recordings do not wait for the whole file. The times of the transcript
+// are the ones of the whole recording streamed, Shift(-start) makes them relative to the slice.
+func (client *STTClient) TranscribeRange(ctx context.Context, pcm []float32, start, duration time.Duration) (transcript Transcript, err error) {
+	from := durationSamples(start)
+	if start < 0 || duration < 0 || from >= len(pcm) {
+		err = fmt.Errorf("%w: %s lasting %s in %s", ErrInvalidRange, start, duration,
+			time.Duration(len(pcm))*time.Second/SampleRate)
+		return
+	}
+	to := len(pcm)
+	if duration > 0 {
+		to = min(from+durationSamples(duration), len(pcm))
+	}
+	if transcript, err = client.Transcribe(ctx, pcm[from:to]); len(transcript.Utterances) > 0 {
+		transcript = transcript.Shift(time.Duration(from) * time.Second / SampleRate)
+	}
+	return
+}
+
+// Align times the text of a transcript made by another tool (see ImportWhisperJSON() and
+// ImportText()) against its audio: the audio is transcribed and the text, one line per utterance,
+// is merged onto the result (see Transcript.Merge()). The words recognized take the timings of the
+// transcription, the others are spread between them and the lines remain the utterances.
+func (client *STTClient) Align(ctx context.Context, pcm []float32, text string) (aligned Transcript, err error) {
+	transcribed, err := client.Transcribe(ctx, pcm)
+	if err != nil {
+		err = fmt.Errorf("failed to transcribe the audio: %w", err)
+		return
+	}
+	aligned = transcribed.Merge(text)
+	return
+}
@@ -0,0 +1,59 @@
+package krs
+
+import "time"
+
+// DefaultBeepInterval is the interval between the beeps of a BeepInjector, the common requirement
+// of the jurisdictions asking for a recording warning tone.
+const DefaultBeepInterval = 15 * time.Second
+
+type BeepInjectorConfig struct {
+	// Interval between the beeps (defaults to DefaultBeepInterval)
+	Interval time.Duration
+	// Offset is the session time of the first beep (0 beeps right at the start)
+	Offset time.Duration
+	// Beep is the audio mixed in (defaults to Beep())
+	Beep []float32
+}
+
+// BeepInjector is an AudioFilter mixing a beep into the audio at a regular interval of the session
+// clock, to notify the parties of a call that it is recorded. Apply it to the Listener source
+// (FilterSource) for the beeps to be part of the recorded audio, to the Speaker sink (FilterSink)
+// for the remote party to hear them.
+type BeepInjector struct {
+	interval time.Duration
+	offset   time.Duration
+	beep     []float32
+}
+
+func NewBeepInjector(config BeepInjectorConfig) *BeepInjector {
+	if config.Interval <= 0 {
+		config.Interval = DefaultBeepInterval
+	}
+	if config.Beep == nil {
+		config.Beep = Beep()
+	}
+	return &BeepInjector{
+		interval: config.Interval,
+		offset:   max(config.Offset, 0),
+		beep:     config.Beep,
+	}
+}
+
+// Apply mixes the parts of the beeps falling within the block, clipping the result.
+func (bi *BeepInjector) Apply(pcm []float32, at time.Duration) {
+	start := durationSamples(at)
+	end := start + len(pcm)
+	offset := durationSamples(bi.offset)
+	interval := max(durationSamples(bi.interval), 1)
+	beepLength := len(bi.beep)
+	// first beep overlapping the block
+	first := 0
+	if start > offset+beepLength {
+		first = (start - offset - beepLength) / interval
+	}
+	for beepStart := offset + first*interval; beepStart < end; beepStart += interval {
+		for i := max(beepStart, start); i < min(beepStart+beepLength, end); i++ {
+			pcm[i-start] = min(max(pcm[i-start]+bi.beep[i-beepStart], -1), 1)
+		}
+	}
+}
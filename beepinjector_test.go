@@ -0,0 +1,39 @@
+package krs
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBeepInjector(t *testing.T) {
+	injector := NewBeepInjector(BeepInjectorConfig{
+		Interval: time.Second,
+		Offset:   500 * time.Millisecond,
+		Beep:     []float32{0.5, 0.5, 0.5},
+	})
+	// blocks of an odd size so the beeps straddle them
+	var (
+		source    = slices.Repeat([]float32{0.1}, 3*SampleRate)
+		filtered  []float32
+		blockSize = 997
+	)
+	for block := range slices.Chunk(source, blockSize) {
+		block = slices.Clone(block)
+		injector.Apply(block, time.Duration(len(filtered))*time.Second/SampleRate)
+		filtered = append(filtered, block...)
+	}
+	var beeped []int
+	for i, sample := range filtered {
+		if sample > 0.5 {
+			beeped = append(beeped, i)
+		}
+	}
+	var expected []int
+	for _, beep := range []int{SampleRate / 2, 3 * SampleRate / 2, 5 * SampleRate / 2} {
+		expected = append(expected, beep, beep+1, beep+2)
+	}
+	if !slices.Equal(beeped, expected) {
+		t.Errorf("beeps at samples %v, expected %v", beeped, expected)
+	}
+}
@@ -0,0 +1,177 @@
+package krs
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/hekmon/kyutai-rs/testassets"
+)
+
+func benchFrame() []float32 {
+	return testassets.MustPCM("noise")[:FrameSize]
+}
+
+func BenchmarkMarshalAudioFrame(b *testing.B) {
+	msg := MessagePackAudio{Type: MessagePackTypeAudio, PCM: benchFrame()}
+	buffer := msg.Msgsize()
+	payload := make([]byte, 0, buffer)
+	b.SetBytes(int64(buffer))
+	b.ReportAllocs()
+	for b.Loop() {
+		payload, _ = msg.MarshalMsg(payload[:0])
+	}
+}
+
+func BenchmarkUnmarshalAudioFrame(b *testing.B) {
+	msg := MessagePackAudio{Type: MessagePackTypeAudio, PCM: benchFrame()}
+	payload, err := msg.MarshalMsg(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg = MessagePackAudio{}
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err = msg.UnmarshalMsg(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSTTStream measures the writer and reader paths: each op is one audio frame sent and
+// the matching step received back.
+func BenchmarkSTTStream(b *testing.B) {
+	server := newMockServer(b)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	frame := benchFrame()
+	b.SetBytes(FrameSize * 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	go func() {
+		defer close(conn.GetWriteChan())
+		for range b.N {
+			select {
+			case conn.GetWriteChan() <- frame:
+			case <-conn.GetContext().Done():
+				return
+			}
+		}
+	}()
+	drain(conn.GetContext(), conn.GetReadChan())
+	if err = conn.Done(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkTTSStream measures the writer and reader paths: each op is one word sent and the
+// matching text and audio frame received back.
+func BenchmarkTTSStream(b *testing.B) {
+	server := newMockServer(b)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	go func() {
+		defer close(conn.GetWriteChan())
+		for range b.N {
+			select {
+			case conn.GetWriteChan() <- "word":
+			case <-conn.GetContext().Done():
+				return
+			}
+		}
+	}()
+	drain(conn.GetContext(), conn.GetReadChan())
+	if err = conn.Done(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func drain(ctx context.Context, receiver <-chan MessagePack) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, open := <-receiver:
+			if !open {
+				return
+			}
+		}
+	}
+}
+
+func BenchmarkAppendInt16(b *testing.B) {
+	frame := benchFrame()
+	samples := make([]int16, 0, len(frame))
+	b.SetBytes(int64(4 * len(frame)))
+	b.ReportAllocs()
+	for b.Loop() {
+		samples = AppendInt16(samples[:0], frame)
+	}
+}
+
+func BenchmarkAppendInt16Naive(b *testing.B) {
+	frame := benchFrame()
+	samples := make([]int16, len(frame))
+	b.SetBytes(int64(4 * len(frame)))
+	b.ReportAllocs()
+	for b.Loop() {
+		for i, sample := range frame {
+			samples[i] = int16(min(max(sample, -1), 1) * math.MaxInt16)
+		}
+	}
+}
+
+func BenchmarkAppendInt16LE(b *testing.B) {
+	frame := benchFrame()
+	payload := make([]byte, 0, 2*len(frame))
+	b.SetBytes(int64(4 * len(frame)))
+	b.ReportAllocs()
+	for b.Loop() {
+		payload = AppendInt16LE(payload[:0], frame)
+	}
+}
+
+func BenchmarkAppendFloat32(b *testing.B) {
+	samples := AppendInt16(nil, benchFrame())
+	frame := make([]float32, 0, len(samples))
+	b.SetBytes(int64(2 * len(samples)))
+	b.ReportAllocs()
+	for b.Loop() {
+		frame = AppendFloat32(frame[:0], samples)
+	}
+}
+
+func BenchmarkInterleaveStereo(b *testing.B) {
+	frame := benchFrame()
+	stereo := make([]float32, 0, 2*len(frame))
+	b.SetBytes(int64(8 * len(frame)))
+	b.ReportAllocs()
+	for b.Loop() {
+		stereo = Interleave(stereo[:0], frame, frame)
+	}
+}
+
+func BenchmarkDeinterleaveStereo(b *testing.B) {
+	frame := benchFrame()
+	stereo := Interleave(nil, frame, frame)
+	b.SetBytes(int64(4 * len(stereo)))
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = Deinterleave(stereo, 2)
+	}
+}
@@ -0,0 +1,276 @@
+package krs
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrInvalidBundle is returned when reading a file which is not a session bundle.
+var ErrInvalidBundle = errors.New("invalid session bundle")
+
+const (
+	// BundleExtension is the extension of the session bundles files
+	BundleExtension = ".krs"
+	// BundleVersion is the version of the bundle format written
+	BundleVersion = 1
+	// files of the bundle archive
+	bundleMetadataFile   = "metadata.json"
+	bundleTranscriptFile = "transcript.json"
+	bundleEventsFile     = "events.ndjson"
+	bundleAudioFile      = "audio.wav"
+)
+
+// Bundle is a voice session as a single portable artifact: its audio, its transcript and the
+// events of the session. It is stored as a zip archive (see Write() and OpenBundle()) of
+// metadata.json, transcript.json (as written by Transcript.WriteJSON()), events.ndjson (an event
+// per line) and audio.wav (16 bits PCM, the channels interleaved).
+type Bundle struct {
+	Metadata   BundleMetadata
+	Transcript Transcript
+	Events     []BundleEvent
+	// Audio holds the samples of the Metadata.Channels channels interleaved (24kHz)
+	Audio []float32
+}
+
+// BundleMetadata describes a session bundle.
+type BundleMetadata struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Duration of the audio
+	Duration time.Duration `json:"duration"`
+	// Channels of the audio: the user then the assistant for a SessionRecorder bundle
+	Channels int `json:"channels"`
+	// TranscriptOffset is the time of the start of the audio in the transcript (the STT stream
+	// time starts with STTStreamOffset of silence)
+	TranscriptOffset time.Duration `json:"transcript_offset"`
+	Tags             Tags          `json:"tags,omitempty"`
+}
+
+// BundleEvent is an event of the session, at a time of its audio.
+type BundleEvent struct {
+	At   time.Duration   `json:"at"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Channel returns the samples of a channel of the audio.
+func (b Bundle) Channel(channel int) []float32 {
+	if channel < 0 || channel >= b.Metadata.Channels {
+		return nil
+	}
+	return Deinterleave(b.Audio, b.Metadata.Channels)[channel]
+}
+
+// Write writes the bundle as a zip archive.
+func (b Bundle) Write(w io.Writer) (err error) {
+	archive := zip.NewWriter(w)
+	metadata := b.Metadata
+	metadata.Version = BundleVersion
+	metadata.Channels = max(metadata.Channels, 1)
+	metadata.Duration = time.Duration(len(b.Audio)/metadata.Channels) * time.Second / SampleRate
+	// Metadata
+	file, err := archive.Create(bundleMetadataFile)
+	if err != nil {
+		return fmt.Errorf("failed to add the metadata to the bundle: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(metadata); err != nil {
+		return fmt.Errorf("failed to write the bundle metadata: %w", err)
+	}
+	// Transcript
+	if file, err = archive.Create(bundleTranscriptFile); err != nil {
+		return fmt.Errorf("failed to add the transcript to the bundle: %w", err)
+	}
+	if err = b.Transcript.WriteJSON(file); err != nil {
+		return
+	}
+	// Events
+	if file, err = archive.Create(bundleEventsFile); err != nil {
+		return fmt.Errorf("failed to add the events to the bundle: %w", err)
+	}
+	encoder = json.NewEncoder(file)
+	for _, event := range b.Events {
+		if err = encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write the bundle events: %w", err)
+		}
+	}
+	// Audio, deflated by the archive
+	if file, err = archive.Create(bundleAudioFile); err != nil {
+		return fmt.Errorf("failed to add the audio to the bundle: %w", err)
+	}
+	if _, err = file.Write(appendWAV(nil, b.Audio, metadata.Channels)); err != nil {
+		return fmt.Errorf("failed to write the bundle audio: %w", err)
+	}
+	if err = archive.Close(); err != nil {
+		return fmt.Errorf("failed to write the bundle: %w", err)
+	}
+	return
+}
+
+// WriteFile writes the bundle to a file, replacing it once complete.
+func (b Bundle) WriteFile(filename string) (err error) {
+	temporary := filename + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return fmt.Errorf("failed to create the bundle file: %w", err)
+	}
+	defer os.Remove(temporary)
+	if err = b.Write(file); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failed to write the bundle file: %w", err)
+	}
+	if err = os.Rename(temporary, filename); err != nil {
+		return fmt.Errorf("failed to write the bundle file: %w", err)
+	}
+	return
+}
+
+// OpenBundle reads a session bundle file.
+func OpenBundle(filename string) (b Bundle, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		err = fmt.Errorf("failed to open the bundle: %w", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		err = fmt.Errorf("failed to open the bundle: %w", err)
+		return
+	}
+	return ReadBundle(file, info.Size())
+}
+
+// ReadBundle reads a session bundle from a zip archive of size bytes.
+func ReadBundle(r io.ReaderAt, size int64) (b Bundle, err error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		return
+	}
+	read := func(name string) (payload []byte, err error) {
+		file, err := archive.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+		}
+		defer file.Close()
+		if payload, err = io.ReadAll(file); err != nil {
+			err = fmt.Errorf("failed to read %s from the bundle: %w", name, err)
+		}
+		return
+	}
+	// Metadata
+	payload, err := read(bundleMetadataFile)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(payload, &b.Metadata); err != nil {
+		err = fmt.Errorf("%w: failed to decode the metadata: %w", ErrInvalidBundle, err)
+		return
+	}
+	if b.Metadata.Version > BundleVersion {
+		err = fmt.Errorf("%w: version %d is newer than the supported one (%d)", ErrInvalidBundle,
+			b.Metadata.Version, BundleVersion)
+		return
+	}
+	// Transcript
+	if payload, err = read(bundleTranscriptFile); err != nil {
+		return
+	}
+	if err = json.Unmarshal(payload, &b.Transcript); err != nil {
+		err = fmt.Errorf("%w: failed to decode the transcript: %w", ErrInvalidBundle, err)
+		return
+	}
+	// Events
+	if payload, err = read(bundleEventsFile); err != nil {
+		return
+	}
+	lines := bufio.NewScanner(bytes.NewReader(payload))
+	lines.Buffer(nil, len(payload)+1)
+	for lines.Scan() {
+		var event BundleEvent
+		if err = json.Unmarshal(lines.Bytes(), &event); err != nil {
+			err = fmt.Errorf("%w: failed to decode an event: %w", ErrInvalidBundle, err)
+			return
+		}
+		b.Events = append(b.Events, event)
+	}
+	// Audio
+	if payload, err = read(bundleAudioFile); err != nil {
+		return
+	}
+	var channels int
+	if b.Audio, channels, err = parseWAV(payload); err != nil {
+		return
+	}
+	if channels != b.Metadata.Channels {
+		err = fmt.Errorf("%w: %d audio channels, %d expected", ErrInvalidBundle, channels, b.Metadata.Channels)
+		return
+	}
+	return
+}
+
+// appendWAV appends the 16 bits PCM wave file of interleaved samples to dst.
+func appendWAV(dst []byte, pcm []float32, channels int) []byte {
+	const headerSize = 44
+	dataSize := 2 * len(pcm)
+	dst = append(dst, "RIFF"...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(headerSize-8+dataSize))
+	dst = append(dst, "WAVEfmt "...)
+	dst = binary.LittleEndian.AppendUint32(dst, 16) // fmt chunk size
+	dst = binary.LittleEndian.AppendUint16(dst, 1)  // PCM
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(channels))
+	dst = binary.LittleEndian.AppendUint32(dst, SampleRate)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(SampleRate*2*channels)) // byte rate
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(2*channels))            // block align
+	dst = binary.LittleEndian.AppendUint16(dst, 16)                            // bits per sample
+	dst = append(dst, "data"...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(dataSize))
+	return AppendInt16LE(dst, pcm)
+}
+
+// parseWAV decodes a 16 bits PCM 24kHz wave file as written by appendWAV.
+func parseWAV(data []byte) (pcm []float32, channels int, err error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("%w: the audio is not a wave file", ErrInvalidBundle)
+	}
+	var samples []byte
+	for chunks := data[12:]; len(chunks) >= 8; {
+		id, size := string(chunks[:4]), int(binary.LittleEndian.Uint32(chunks[4:8]))
+		chunks = chunks[8:]
+		if size > len(chunks) {
+			return nil, 0, fmt.Errorf("%w: truncated wave file", ErrInvalidBundle)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 || binary.LittleEndian.Uint16(chunks) != 1 || binary.LittleEndian.Uint32(chunks[4:]) != SampleRate ||
+				binary.LittleEndian.Uint16(chunks[14:]) != 16 {
+				return nil, 0, fmt.Errorf("%w: the audio is not 16 bits PCM at 24kHz", ErrInvalidBundle)
+			}
+			channels = int(binary.LittleEndian.Uint16(chunks[2:]))
+		case "data":
+			samples = chunks[:size]
+		}
+		chunks = chunks[min(size+size%2, len(chunks)):]
+	}
+	if channels == 0 {
+		return nil, 0, fmt.Errorf("%w: the wave file has no format", ErrInvalidBundle)
+	}
+	values := make([]int16, len(samples)/2)
+	for i := range values {
+		values[i] = int16(binary.LittleEndian.Uint16(samples[2*i:]))
+	}
+	return AppendFloat32(nil, values), channels, nil
+}
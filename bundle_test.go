@@ -0,0 +1,57 @@
+package krs
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSessionBundle(t *testing.T) {
+	recorder := NewSessionRecorder(Tags{"session": "42"})
+	user := recorder.UserSink()
+	assistant := recorder.AssistantSink()
+	_ = user.WritePCM(Tone(440, 200*time.Millisecond, DefaultToneAmplitude))
+	recorder.Observe(MessagePackWord{Type: MessagePackTypeWord, Text: "hello", StartTime: 1.05})
+	recorder.Observe(MessagePackWordEnd{Type: MessagePackTypeEndWord, StopTime: 1.2})
+	recorder.Observe(MessagePackStep{Type: MessagePackTypeStep, Prs: []float32{0, 0, 1}})
+	if err := recorder.Event("llm_request", map[string]string{"prompt": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = assistant.WritePCM(Beep())
+	original := recorder.Bundle()
+	if original.Metadata.Channels != 2 || len(original.Events) != 3 {
+		t.Fatalf("got %d channels and %d events, expected 2 and 3", original.Metadata.Channels, len(original.Events))
+	}
+	var archive bytes.Buffer
+	if err := original.Write(&archive); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBundle(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := read.Transcript.Text(); text != "hello" {
+		t.Errorf("got transcript %q, expected hello", text)
+	}
+	if read.Transcript.Tags["session"] != "42" || read.Metadata.TranscriptOffset != STTStreamOffset {
+		t.Errorf("metadata not read back: %+v", read.Metadata)
+	}
+	if len(read.Events) != 3 || read.Events[2].Type != "llm_request" || string(read.Events[2].Data) != `{"prompt":"hello"}` {
+		t.Errorf("events not read back: %+v", read.Events)
+	}
+	// the audio goes through 16 bits
+	for channel := range 2 {
+		expected, got := original.Channel(channel), read.Channel(channel)
+		if len(expected) == 0 || len(got) != len(expected) {
+			t.Fatalf("channel %d: got %d samples, expected %d", channel, len(got), len(expected))
+		}
+		if !slices.EqualFunc(expected, got, func(a, b float32) bool { return a-b < 1e-4 && b-a < 1e-4 }) {
+			t.Errorf("channel %d not read back", channel)
+		}
+	}
+	if _, err = ReadBundle(bytes.NewReader([]byte("not a zip")), 9); !errors.Is(err, ErrInvalidBundle) {
+		t.Errorf("expected ErrInvalidBundle, got %v", err)
+	}
+}
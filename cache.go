@@ -0,0 +1,245 @@
+package krs
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheMaxSize bounds the audio kept by the synthesis caches, about 11 minutes of audio.
+const DefaultCacheMaxSize = 64 << 20
+
+// SynthesisCache stores the audio synthesized for a key derived from the server, the voice, the
+// style and the normalized text. Synthesize and the Speaker look up the cache before connecting:
+// repeated prompts (fixed UI phrases like "Sure, one moment") are played without the latency and
+// the GPU time of a synthesis. It must be safe for concurrent use.
+type SynthesisCache interface {
+	// Get returns the audio stored for key, if any and not expired.
+	Get(key string) (pcm []float32, ok bool)
+	// Put stores the audio of key, evicting older entries if needed. It is best effort.
+	Put(key string, pcm []float32)
+}
+
+// ErrNoCache is returned by PrewarmPhrases for a client without TTSConfig.Cache.
+var ErrNoCache = errors.New("the client has no synthesis cache")
+
+// PrewarmPhrases synthesizes the phrases not cached yet into the client cache, one after the
+// other, so the voice UIs can play their canned responses instantly even when the server is busy.
+// The phrases failing are reported together once all the others are cached.
+func (client *TTSClient) PrewarmPhrases(ctx context.Context, phrases []string) (err error) {
+	if client.cache == nil {
+		return ErrNoCache
+	}
+	var failures []error
+	for _, phrase := range phrases {
+		if ctx.Err() != nil {
+			failures = append(failures, ctx.Err())
+			break
+		}
+		if _, synthErr := client.Synthesize(ctx, phrase); synthErr != nil {
+			failures = append(failures, fmt.Errorf("failed to synthesize %q: %w", phrase, synthErr))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// synthesisKey returns the cache key of a text (normalized) synthesized with a voice and options,
+// the text being sent word by word.
+func (client *TTSClient) synthesisKey(voice string, opts connectOptions, text string) string {
+	hash := sha256.New()
+	words := strings.Join(strings.Fields(text), " ")
+	for _, field := range []string{client.url.Host + client.url.Path, voice, string(opts.style), string(opts.emotion), words} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// MemoryCache is a SynthesisCache keeping the audio in memory, evicting the least recently used
+// entries beyond MaxSize. Its zero value is ready to use.
+type MemoryCache struct {
+	// TTL, if set, expires the entries this long after they were stored
+	TTL time.Duration
+	// MaxSize is the size of the audio kept in bytes (4 per sample, defaults to DefaultCacheMaxSize)
+	MaxSize int64
+	// protected by mutex
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // front is the most recently used
+	size    int64
+}
+
+type memoryEntry struct {
+	key      string
+	pcm      []float32
+	storedAt time.Time
+}
+
+func (mc *MemoryCache) Get(key string) (pcm []float32, ok bool) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	element, found := mc.entries[key]
+	if !found {
+		return
+	}
+	entry := element.Value.(*memoryEntry)
+	if mc.TTL > 0 && time.Since(entry.storedAt) > mc.TTL {
+		mc.remove(element)
+		return
+	}
+	mc.lru.MoveToFront(element)
+	return slices.Clone(entry.pcm), true
+}
+
+func (mc *MemoryCache) Put(key string, pcm []float32) {
+	size := int64(len(pcm)) * 4
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	if size > cacheMaxSize(mc.MaxSize) {
+		return
+	}
+	if mc.entries == nil {
+		mc.entries = make(map[string]*list.Element)
+	}
+	if element, found := mc.entries[key]; found {
+		mc.remove(element)
+	}
+	mc.entries[key] = mc.lru.PushFront(&memoryEntry{key: key, pcm: slices.Clone(pcm), storedAt: time.Now()})
+	mc.size += size
+	for mc.size > cacheMaxSize(mc.MaxSize) {
+		mc.remove(mc.lru.Back())
+	}
+}
+
+// remove must be called with the mutex held.
+func (mc *MemoryCache) remove(element *list.Element) {
+	entry := mc.lru.Remove(element).(*memoryEntry)
+	delete(mc.entries, entry.key)
+	mc.size -= int64(len(entry.pcm)) * 4
+}
+
+// FileCache is a SynthesisCache storing the audio as files in Dir (the storage time then the raw
+// float32 samples), shared by the processes using the same directory. The least recently used
+// files are removed beyond MaxSize.
+type FileCache struct {
+	Dir string
+	// TTL, if set, expires the files this long after they were stored
+	TTL time.Duration
+	// MaxSize is the size of the files kept in bytes (defaults to DefaultCacheMaxSize)
+	MaxSize int64
+	// serializes the evictions of this process
+	mutex sync.Mutex
+}
+
+const (
+	fileCacheExtension = ".f32"
+	// storage time, in unix nanoseconds
+	fileCacheHeader = 8
+)
+
+func (fc *FileCache) filename(key string) string {
+	return filepath.Join(fc.Dir, key+fileCacheExtension)
+}
+
+func (fc *FileCache) Get(key string) (pcm []float32, ok bool) {
+	filename := fc.filename(key)
+	payload, err := os.ReadFile(filename)
+	if err != nil || len(payload) < fileCacheHeader || (len(payload)-fileCacheHeader)%4 != 0 {
+		return
+	}
+	storedAt := time.Unix(0, int64(binary.LittleEndian.Uint64(payload)))
+	if fc.TTL > 0 && time.Since(storedAt) > fc.TTL {
+		_ = os.Remove(filename)
+		return
+	}
+	samples := payload[fileCacheHeader:]
+	pcm = make([]float32, len(samples)/4)
+	for i := range pcm {
+		pcm[i] = math.Float32frombits(binary.LittleEndian.Uint32(samples[4*i:]))
+	}
+	// the modification time is the last use
+	now := time.Now()
+	_ = os.Chtimes(filename, now, now)
+	return pcm, true
+}
+
+func (fc *FileCache) Put(key string, pcm []float32) {
+	if int64(len(pcm))*4 > cacheMaxSize(fc.MaxSize) || os.MkdirAll(fc.Dir, 0o755) != nil {
+		return
+	}
+	payload := make([]byte, 0, fileCacheHeader+4*len(pcm))
+	payload = binary.LittleEndian.AppendUint64(payload, uint64(time.Now().UnixNano()))
+	for _, sample := range pcm {
+		payload = binary.LittleEndian.AppendUint32(payload, math.Float32bits(sample))
+	}
+	// written aside then renamed: the readers never see a partial file
+	file, err := os.CreateTemp(fc.Dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = file.Write(payload)
+	if closeErr := file.Close(); err != nil || closeErr != nil || os.Rename(file.Name(), fc.filename(key)) != nil {
+		_ = os.Remove(file.Name())
+		return
+	}
+	fc.evict()
+}
+
+// evict removes the least recently used files beyond MaxSize.
+func (fc *FileCache) evict() {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	entries, err := os.ReadDir(fc.Dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		name     string
+		size     int64
+		lastUsed time.Time
+	}
+	var (
+		files []cached
+		total int64
+	)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), fileCacheExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cached{name: entry.Name(), size: info.Size(), lastUsed: info.ModTime()})
+		total += info.Size()
+	}
+	slices.SortFunc(files, func(a, b cached) int {
+		return a.lastUsed.Compare(b.lastUsed)
+	})
+	for _, file := range files {
+		if total <= cacheMaxSize(fc.MaxSize) {
+			return
+		}
+		if os.Remove(filepath.Join(fc.Dir, file.name)) == nil {
+			total -= file.size
+		}
+	}
+}
+
+func cacheMaxSize(maxSize int64) int64 {
+	if maxSize <= 0 {
+		return DefaultCacheMaxSize
+	}
+	return maxSize
+}
@@ -0,0 +1,85 @@
+package krs
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSynthesisCaches(t *testing.T) {
+	caches := map[string]SynthesisCache{
+		"memory": &MemoryCache{TTL: time.Hour, MaxSize: 2 * 4 * FrameSize},
+		"file":   &FileCache{Dir: t.TempDir(), TTL: time.Hour, MaxSize: 2 * (fileCacheHeader + 4*FrameSize)},
+	}
+	frame := Tone(440, FrameDuration, DefaultToneAmplitude)
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			cache.Put("first", frame)
+			time.Sleep(10 * time.Millisecond) // file times resolution
+			cache.Put("second", frame)
+			time.Sleep(10 * time.Millisecond)
+			if pcm, ok := cache.Get("first"); !ok || !slices.Equal(pcm, frame) {
+				t.Fatal("first entry not returned as stored")
+			}
+			time.Sleep(10 * time.Millisecond)
+			// the least recently used entry is evicted
+			cache.Put("third", frame)
+			if _, ok := cache.Get("second"); ok {
+				t.Error("second entry not evicted")
+			}
+			if _, ok := cache.Get("first"); !ok {
+				t.Error("first entry evicted")
+			}
+			if _, ok := cache.Get("unknown"); ok {
+				t.Error("unknown entry returned")
+			}
+		})
+	}
+	expiring := &MemoryCache{TTL: time.Millisecond}
+	expiring.Put("key", frame)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := expiring.Get("key"); ok {
+		t.Error("expired entry returned")
+	}
+}
+
+func TestTTSSynthesisCache(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), Cache: new(MemoryCache)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := client.Synthesize(context.Background(), "Sure, one moment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Synthesize(context.Background(), "Sure,  one moment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handshakes := server.handshakes.Load(); handshakes != 1 {
+		t.Errorf("got %d connections, expected the second synthesis from the cache", handshakes)
+	}
+	if len(first) == 0 || !slices.Equal(first, second) {
+		t.Errorf("got %d then %d samples, expected the same audio", len(first), len(second))
+	}
+}
+
+func TestPrewarmPhrases(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), Cache: new(MemoryCache)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phrases := []string{"Sure, one moment", "Done!", "Sure, one moment"}
+	if err = client.PrewarmPhrases(context.Background(), phrases); err != nil {
+		t.Fatal(err)
+	}
+	if handshakes := server.handshakes.Load(); handshakes != 2 {
+		t.Errorf("got %d connections, expected one per distinct phrase", handshakes)
+	}
+	if _, err = client.Synthesize(context.Background(), "Done!"); err != nil || server.handshakes.Load() != 2 {
+		t.Errorf("prewarmed phrase synthesized again (%v)", err)
+	}
+}
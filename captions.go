@@ -0,0 +1,290 @@
+package krs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCaptionTimeout = 5 * time.Second
+	defaultCaptionLinger  = 5 * time.Second
+	// caption lines waiting to be streamed to a browser before it misses some
+	captionSubscriberQueue = 16
+)
+
+// CaptionStyle is the look of a caption line in the overlay page, as CSS values. The zero value
+// keeps the page default: white 32px sans-serif outlined in black.
+type CaptionStyle struct {
+	Color  string `json:"color,omitempty"`
+	Font   string `json:"font,omitempty"`
+	Size   string `json:"size,omitempty"`
+	Italic bool   `json:"italic,omitempty"`
+}
+
+// CaptionLine is a line of a caption: its original text (no Language) or a translation.
+type CaptionLine struct {
+	// ID of the caption, the utterance, the line belongs to
+	ID       int64  `json:"id"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+// CaptionOverlay is an http.Handler serving live captions to a browser, typically an OBS browser
+// source layered over a stream. The utterances given to Show() are displayed as dual-line (or
+// more) captions: the original text, then its translation in each of the Languages as soon as the
+// Translator returns it. Its root serves the overlay page, events streams the lines as server-sent
+// events (the JSON of a CaptionLine per event): mount it under a prefix with http.StripPrefix.
+//
+// The zero value shows the original text only. It is safe for concurrent use, Close it once done.
+type CaptionOverlay struct {
+	// Translator, if set, translates each caption in the Languages
+	Translator Translator
+	// Languages of the translation lines, displayed in this order under the original text
+	Languages []string
+	// Styles of the lines by language, the original text being the empty language
+	Styles map[string]CaptionStyle
+	// TranslationTimeout is the time budget of the Translator per caption and language (default 5s)
+	TranslationTimeout time.Duration
+	// Linger is how long a caption stays displayed after its last line (default 5s, negative
+	// keeps it until the next one)
+	Linger time.Duration
+	// OnError, if set, is called with the translation errors: the line is not displayed
+	OnError func(error)
+
+	mutex        sync.Mutex
+	ids          int64
+	current      []CaptionLine
+	subscribers  map[chan CaptionLine]struct{}
+	closed       bool
+	translations sync.WaitGroup
+}
+
+// Show displays an utterance as the new caption and starts its translations, it does not wait
+// for them: call it from ListenerConfig.OnUtterance. The translations of a caption replaced
+// before they arrive are dropped.
+func (co *CaptionOverlay) Show(ctx context.Context, utterance Utterance) {
+	text := utterance.Text()
+	if text == "" {
+		return
+	}
+	co.mutex.Lock()
+	if co.closed {
+		co.mutex.Unlock()
+		return
+	}
+	co.ids++
+	id := co.ids
+	co.current = nil
+	co.publish(CaptionLine{ID: id, Text: text})
+	translator := co.Translator
+	languages := slices.Clone(co.Languages)
+	if translator != nil {
+		co.translations.Add(len(languages))
+	}
+	co.mutex.Unlock()
+	if translator == nil {
+		return
+	}
+	timeout := co.TranslationTimeout
+	if timeout <= 0 {
+		timeout = defaultCaptionTimeout
+	}
+	for _, language := range languages {
+		go func() {
+			defer co.translations.Done()
+			translation, err := translateText(ctx, translator, timeout, text, language)
+			if err != nil {
+				if co.OnError != nil {
+					co.OnError(err)
+				}
+				return
+			}
+			co.mutex.Lock()
+			defer co.mutex.Unlock()
+			if !co.closed {
+				co.publish(CaptionLine{ID: id, Language: language, Text: translation})
+			}
+		}()
+	}
+}
+
+// publish streams a line of the current caption to the browsers, it must be called with the
+// mutex held. A browser too slow to keep up misses the line.
+func (co *CaptionOverlay) publish(line CaptionLine) {
+	if line.ID != co.ids {
+		return
+	}
+	co.current = append(co.current, line)
+	for lines := range co.subscribers {
+		select {
+		case lines <- line:
+		default:
+		}
+	}
+}
+
+// Close waits for the pending translations and ends the streams of the browsers.
+func (co *CaptionOverlay) Close() {
+	co.mutex.Lock()
+	co.closed = true
+	for lines := range co.subscribers {
+		close(lines)
+	}
+	co.subscribers = nil
+	co.mutex.Unlock()
+	co.translations.Wait()
+}
+
+func (co *CaptionOverlay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/") {
+	case "":
+		co.servePage(w)
+	case "events":
+		co.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// captionPage renders the lines streamed by the events endpoint, its config being the
+// captionPageConfig.
+var captionPage = template.Must(template.New("captions").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Captions</title>
+<style>
+html, body { margin: 0; background: transparent; overflow: hidden; }
+#captions { position: fixed; left: 0; right: 0; bottom: 5%; text-align: center;
+  font: 32px sans-serif; color: #fff; text-shadow: 0 0 4px #000, 0 0 8px #000; }
+#captions div { margin: 0.2em 1em; }
+</style>
+</head>
+<body>
+<div id="captions"></div>
+<script>
+const config = {{.}};
+const container = document.getElementById("captions");
+const lines = new Map();
+for (const language of ["", ...config.languages]) {
+  const element = document.createElement("div");
+  const style = config.styles[language] || {};
+  if (style.color) element.style.color = style.color;
+  if (style.font) element.style.fontFamily = style.font;
+  if (style.size) element.style.fontSize = style.size;
+  if (style.italic) element.style.fontStyle = "italic";
+  container.appendChild(element);
+  lines.set(language, element);
+}
+let current = 0, timer;
+function clear() {
+  for (const element of lines.values()) element.textContent = "";
+}
+new EventSource("events").onmessage = (event) => {
+  const line = JSON.parse(event.data);
+  if (line.id < current) return;
+  if (line.id > current) {
+    current = line.id;
+    clear();
+  }
+  const element = lines.get(line.language || "");
+  if (!element) return;
+  element.textContent = line.text;
+  clearTimeout(timer);
+  if (config.linger > 0) timer = setTimeout(clear, config.linger);
+};
+</script>
+</body>
+</html>
+`))
+
+type captionPageConfig struct {
+	Languages []string                `json:"languages"`
+	Styles    map[string]CaptionStyle `json:"styles"`
+	// Linger in milliseconds
+	Linger int64 `json:"linger"`
+}
+
+func (co *CaptionOverlay) servePage(w http.ResponseWriter) {
+	co.mutex.Lock()
+	config := captionPageConfig{
+		Languages: append([]string{}, co.Languages...),
+		Styles:    make(map[string]CaptionStyle, len(co.Styles)),
+		Linger:    co.Linger.Milliseconds(),
+	}
+	maps.Copy(config.Styles, co.Styles)
+	co.mutex.Unlock()
+	if co.Linger == 0 {
+		config.Linger = defaultCaptionLinger.Milliseconds()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = captionPage.Execute(w, config)
+}
+
+func (co *CaptionOverlay) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	lines := make(chan CaptionLine, captionSubscriberQueue)
+	co.mutex.Lock()
+	if co.closed {
+		co.mutex.Unlock()
+		http.Error(w, "the captions are over", http.StatusServiceUnavailable)
+		return
+	}
+	current := slices.Clone(co.current)
+	if co.subscribers == nil {
+		co.subscribers = make(map[chan CaptionLine]struct{})
+	}
+	co.subscribers[lines] = struct{}{}
+	co.mutex.Unlock()
+	defer func() {
+		co.mutex.Lock()
+		delete(co.subscribers, lines)
+		co.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// A browser (re)connecting gets the caption being displayed first
+	for _, line := range current {
+		if writeCaptionEvent(w, line) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	for {
+		select {
+		case line, open := <-lines:
+			if !open {
+				return
+			}
+			if writeCaptionEvent(w, line) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeCaptionEvent(w http.ResponseWriter, line CaptionLine) (err error) {
+	payload, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", payload)
+	return
+}
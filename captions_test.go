@@ -0,0 +1,160 @@
+package krs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCaptionOverlay(t *testing.T) {
+	// A LibreTranslate like service
+	translations := map[string]string{
+		"fr/hello everyone": "bonjour à tous",
+		"de/hello everyone": "hallo zusammen",
+	}
+	translator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query  string `json:"q"`
+			Target string `json:"target"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		translation, found := translations[request.Target+"/"+request.Query]
+		if !found {
+			http.Error(w, "unsupported language", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"translatedText": translation})
+	}))
+	defer translator.Close()
+
+	errs := make(chan error, 1)
+	overlay := &CaptionOverlay{
+		Translator: HTTPTranslator{URL: translator.URL},
+		Languages:  []string{"fr", "de", "es"},
+		Styles:     map[string]CaptionStyle{"fr": {Color: "#ffd700", Italic: true}},
+		OnError:    func(err error) { errs <- err },
+	}
+	server := httptest.NewServer(overlay)
+	defer server.Close()
+
+	// The page holds its configuration
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `"fr":{"color":"#ffd700","italic":true}`) {
+		t.Errorf("the page misses the styles:\n%s", page)
+	}
+
+	// The lines are streamed as they come
+	resp, err = http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	var utterance Utterance
+	for i, text := range strings.Fields("hello everyone") {
+		utterance.Words = append(utterance.Words, Word{Text: text, Start: time.Duration(i) * time.Second})
+	}
+	overlay.Show(context.Background(), utterance)
+	lines := make(map[string]string)
+	events := bufio.NewScanner(resp.Body)
+	for len(lines) < 3 && events.Scan() {
+		payload, found := strings.CutPrefix(events.Text(), "data: ")
+		if !found {
+			continue
+		}
+		var line CaptionLine
+		if err = json.Unmarshal([]byte(payload), &line); err != nil {
+			t.Fatal(err)
+		}
+		if line.ID != 1 {
+			t.Errorf("unexpected caption ID %d", line.ID)
+		}
+		lines[line.Language] = line.Text
+	}
+	if lines[""] != "hello everyone" || lines["fr"] != "bonjour à tous" || lines["de"] != "hallo zusammen" {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+	if err = <-errs; !strings.Contains(err.Error(), "to es: the translator answered HTTP 400") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	overlay.Close()
+	for events.Scan() {
+		if events.Text() != "" {
+			t.Errorf("unexpected event after the close: %q", events.Text())
+		}
+	}
+}
+
+func TestCaptionOverlayTranslationOrder(t *testing.T) {
+	release := make(chan struct{})
+	var deadlines sync.Map
+	overlay := &CaptionOverlay{
+		// a translator slow on the first caption, answering after the second one is shown
+		Translator: TranslatorFunc(func(ctx context.Context, text, language string) (string, error) {
+			if deadline, ok := ctx.Deadline(); ok {
+				deadlines.Store(language+"/"+text, time.Until(deadline))
+			}
+			if text == "first caption" {
+				<-release
+			}
+			return language + ": " + text, nil
+		}),
+		Languages:          []string{"fr", "de"},
+		TranslationTimeout: time.Second,
+	}
+	lines := make(chan CaptionLine, captionSubscriberQueue)
+	overlay.subscribers = map[chan CaptionLine]struct{}{lines: {}}
+	show := func(text string) {
+		var utterance Utterance
+		for i, word := range strings.Fields(text) {
+			utterance.Words = append(utterance.Words, Word{Text: word, Start: time.Duration(i) * time.Second})
+		}
+		overlay.Show(context.Background(), utterance)
+	}
+	show("first caption")
+	show("second caption")
+	// the late translations of the replaced caption are dropped
+	close(release)
+	overlay.translations.Wait()
+	overlay.Close()
+	var received []CaptionLine
+	for line := range lines {
+		received = append(received, line)
+	}
+	if len(received) != 4 || received[0] != (CaptionLine{ID: 1, Text: "first caption"}) ||
+		received[1] != (CaptionLine{ID: 2, Text: "second caption"}) {
+		t.Fatalf("got the lines %+v, expected the captions in order then the translations of the second", received)
+	}
+	for _, line := range received[2:] {
+		if line.ID != 2 || line.Text != line.Language+": second caption" {
+			t.Errorf("got the translation %+v, expected one of the second caption", line)
+		}
+	}
+	if current := overlay.current; len(current) != 3 || current[0].ID != 2 {
+		t.Errorf("the current caption is %+v, expected the second one with its translations", current)
+	}
+	// each translation has its own time budget
+	deadlines.Range(func(key, remaining any) bool {
+		if remaining := remaining.(time.Duration); remaining <= 0 || remaining > time.Second {
+			t.Errorf("%s: translated with %s left, expected the 1s budget", key, remaining)
+		}
+		return true
+	})
+}
@@ -0,0 +1,313 @@
+package krs
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultChapterBlockWords  = 100
+	defaultChapterMinDuration = time.Minute
+	// number of words of a chapter title
+	chapterTitleWords = 3
+)
+
+// englishStopWords are ignored by the topic segmentation: they carry no topic.
+var englishStopWords = strings.Fields(`a about above after again against all also am an and any are
+as at be because been before being below between both but by can could did do does doing down
+during each few for from further get got had has have having he her here hers herself him himself
+his how i if in into is it its itself just know like me more most my myself no nor not now of off
+on once only or other our ours ourselves out over own really right same she should so some such
+than that the their theirs them themselves then there these they this those through to too um uh
+under until up us very was we well were what when where which while who whom why will with would
+yeah yes you your yours yourself yourselves`)
+
+type ChapterConfig struct {
+	// BlockWords is the number of words compared on each side of a candidate boundary (default 100)
+	BlockWords int
+	// MinDuration is the minimum duration of a chapter (default 1 minute)
+	MinDuration time.Duration
+	// StopWords are ignored when comparing the vocabulary (defaults to common English words)
+	StopWords []string
+}
+
+// Chapter is a topical section of a transcript.
+type Chapter struct {
+	// Title is made of the words characteristic of the chapter
+	Title string `json:"title"`
+	// Start and End are the stream times of the chapter (nanoseconds in JSON)
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	// From and To are the range of the utterances of the chapter in the transcript [From, To)
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Chapters are the topical sections of a transcript, as returned by Transcript.Chapters().
+type Chapters []Chapter
+
+// Chapters splits the transcript into topical sections between utterances, with TextTiling: the
+// vocabulary of the words before and after each utterance boundary is compared and the chapters
+// start where it changes the most. The chapters are titled with their most characteristic words.
+func (t Transcript) Chapters(config ChapterConfig) (chapters Chapters) {
+	if config.BlockWords <= 0 {
+		config.BlockWords = defaultChapterBlockWords
+	}
+	if config.MinDuration == 0 {
+		config.MinDuration = defaultChapterMinDuration
+	}
+	if config.StopWords == nil {
+		config.StopWords = englishStopWords
+	}
+	stopWords := make(map[string]bool, len(config.StopWords))
+	for _, word := range config.StopWords {
+		stopWords[matchKey(word)] = true
+	}
+	// the terms of each utterance and the position of the boundaries in the term stream
+	var (
+		terms      []string
+		boundaries []int // boundaries[i] is the number of terms before utterance i
+		utterances []int // index of the utterances with words
+	)
+	for i, utterance := range t.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		utterances = append(utterances, i)
+		boundaries = append(boundaries, len(terms))
+		for _, word := range utterance.Words {
+			if term := chapterTerm(word.Text); term != "" && !stopWords[term] {
+				terms = append(terms, term)
+			}
+		}
+	}
+	if len(utterances) == 0 {
+		return
+	}
+	// lexical cohesion across each boundary between utterances, then its depth: how much lower it
+	// is than the peaks around it
+	gaps := boundaries[1:]
+	similarities := make([]float64, len(gaps))
+	for g, position := range gaps {
+		before := terms[max(0, position-config.BlockWords):position]
+		after := terms[position:min(len(terms), position+config.BlockWords)]
+		similarities[g] = cosineSimilarity(before, after)
+	}
+	depths := make([]float64, len(gaps))
+	var mean float64
+	for g := range gaps {
+		left, right := similarities[g], similarities[g]
+		for l := g - 1; l >= 0 && similarities[l] >= left; l-- {
+			left = similarities[l]
+		}
+		for r := g + 1; r < len(similarities) && similarities[r] >= right; r++ {
+			right = similarities[r]
+		}
+		depths[g] = left + right - 2*similarities[g]
+		mean += depths[g]
+	}
+	// the boundaries deeper than the mean minus half the standard deviation, the deepest first,
+	// keeping the chapters long enough
+	var cuts []int // index in utterances of the first utterance of each chapter
+	if len(gaps) > 0 {
+		mean /= float64(len(gaps))
+		var variance float64
+		for _, depth := range depths {
+			variance += (depth - mean) * (depth - mean)
+		}
+		threshold := mean - math.Sqrt(variance/float64(len(gaps)))/2
+		order := make([]int, len(gaps))
+		for g := range order {
+			order[g] = g
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(depths[b], depths[a])
+		})
+		start := t.Utterances[utterances[0]].Start()
+		end := t.Utterances[utterances[len(utterances)-1]].End()
+		for _, g := range order {
+			if depths[g] <= 0 || depths[g] < threshold {
+				break
+			}
+			at := t.Utterances[utterances[g+1]].Start()
+			if at-start < config.MinDuration || end-at < config.MinDuration {
+				continue
+			}
+			tooClose := slices.ContainsFunc(cuts, func(cut int) bool {
+				other := t.Utterances[utterances[cut]].Start()
+				return max(at-other, other-at) < config.MinDuration
+			})
+			if !tooClose {
+				cuts = append(cuts, g+1)
+			}
+		}
+		slices.Sort(cuts)
+	}
+	// build the chapters
+	firsts := append([]int{0}, cuts...)
+	for c, first := range firsts {
+		last := len(utterances)
+		if c+1 < len(firsts) {
+			last = firsts[c+1]
+		}
+		from := utterances[first]
+		to := utterances[last-1] + 1
+		chapter := Chapter{
+			Start: t.Utterances[from].Start(),
+			End:   t.Utterances[to-1].End(),
+			From:  from,
+			To:    to,
+		}
+		if c+1 < len(firsts) {
+			chapter.End = t.Utterances[utterances[last]].Start()
+		}
+		chapters = append(chapters, chapter)
+	}
+	chapters.title(t, stopWords)
+	return
+}
+
+// title names each chapter after its terms the most frequent in it and the rarest in the others
+// (tf-idf).
+func (c Chapters) title(t Transcript, stopWords map[string]bool) {
+	counts := make([]map[string]int, len(c))
+	documents := make(map[string]int)
+	// the first form heard of each term, to display it
+	forms := make(map[string]string)
+	for i, chapter := range c {
+		counts[i] = make(map[string]int)
+		for _, utterance := range t.Utterances[chapter.From:chapter.To] {
+			for _, word := range utterance.Words {
+				term := chapterTerm(word.Text)
+				if term == "" || stopWords[term] || len([]rune(term)) < 3 {
+					continue
+				}
+				if counts[i][term] == 0 {
+					documents[term]++
+				}
+				counts[i][term]++
+				if _, found := forms[term]; !found {
+					forms[term] = strings.TrimFunc(word.Text, func(r rune) bool {
+						return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+					})
+				}
+			}
+		}
+	}
+	for i := range c {
+		type scored struct {
+			term  string
+			score float64
+		}
+		var candidates []scored
+		for term, count := range counts[i] {
+			idf := math.Log(1 + float64(len(c))/float64(documents[term]))
+			candidates = append(candidates, scored{term, float64(count) * idf})
+		}
+		slices.SortFunc(candidates, func(a, b scored) int {
+			if order := cmp.Compare(b.score, a.score); order != 0 {
+				return order
+			}
+			return strings.Compare(a.term, b.term)
+		})
+		words := make([]string, 0, chapterTitleWords)
+		for _, candidate := range candidates[:min(len(candidates), chapterTitleWords)] {
+			words = append(words, forms[candidate.term])
+		}
+		if len(words) == 0 {
+			c[i].Title = fmt.Sprintf("Chapter %d", i+1)
+			continue
+		}
+		title := []rune(strings.Join(words, ", "))
+		title[0] = unicode.ToUpper(title[0])
+		c[i].Title = string(title)
+	}
+}
+
+// chapterTerm is the form of a word compared by the segmentation, empty for punctuation.
+func chapterTerm(word string) string {
+	term := matchKey(word)
+	if !strings.ContainsFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+		return ""
+	}
+	return term
+}
+
+func cosineSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	countA := make(map[string]float64, len(a))
+	for _, term := range a {
+		countA[term]++
+	}
+	countB := make(map[string]float64, len(b))
+	for _, term := range b {
+		countB[term]++
+	}
+	var dot, normA, normB float64
+	for term, count := range countA {
+		dot += count * countB[term]
+		normA += count * count
+	}
+	for _, count := range countB {
+		normB += count * count
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// WriteSRT renders the chapters as SubRip subtitles, one per chapter spanning its duration: the
+// chapter markers of the players loading them as a separate track.
+func (c Chapters) WriteSRT(w io.Writer) (err error) {
+	var b strings.Builder
+	for i, chapter := range c {
+		end := max(chapter.End, chapter.Start+srtMinimumCue)
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTimestamp(chapter.Start), srtTimestamp(end), isolate(chapter.Title))
+	}
+	if _, err = io.WriteString(w, b.String()); err != nil {
+		err = fmt.Errorf("failed to write the chapters: %w", err)
+		return
+	}
+	return
+}
+
+// WriteJSON exports the chapters as JSON (the times are in nanoseconds).
+func (c Chapters) WriteJSON(w io.Writer) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(c); err != nil {
+		err = fmt.Errorf("failed to write the chapters: %w", err)
+		return
+	}
+	return
+}
+
+// WriteFFMetadata exports the chapters in the ffmpeg metadata format, the index of audiobooks
+// (m4b) and podcasts:
+//
+//	ffmpeg -i book.wav -i chapters.txt -map_metadata 1 -c:a aac book.m4b
+//
+// offset is subtracted from the chapter times: the stream time of the start of the audio file.
+func (c Chapters) WriteFFMetadata(w io.Writer, offset time.Duration) (err error) {
+	escape := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n")
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, chapter := range c {
+		fmt.Fprintf(&b, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			max(chapter.Start-offset, 0).Milliseconds(), max(chapter.End-offset, 0).Milliseconds(),
+			escape.Replace(chapter.Title),
+		)
+	}
+	if _, err = io.WriteString(w, b.String()); err != nil {
+		err = fmt.Errorf("failed to write the chapters: %w", err)
+		return
+	}
+	return
+}
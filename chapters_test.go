@@ -0,0 +1,52 @@
+package krs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChapters(t *testing.T) {
+	topics := []string{
+		"the budget for next year grows and the budget review covers costs spending and revenue",
+		"hiring two engineers needs interviews so the hiring plan lists candidates and interviews",
+		"the roadmap puts the mobile release first then the roadmap adds offline sync to mobile",
+	}
+	var transcript Transcript
+	var at time.Duration
+	for _, topic := range topics {
+		words := strings.Fields(topic)
+		for range 12 {
+			// a few words per utterance, rotating over the topic vocabulary
+			for i := range 6 {
+				transcript.AddWord(Word{Text: words[(int(at/time.Second)+i)%len(words)], Start: at, End: at + 500*time.Millisecond})
+				at += 800 * time.Millisecond
+			}
+			transcript.EndUtterance()
+		}
+	}
+	chapters := transcript.Chapters(ChapterConfig{BlockWords: 40, MinDuration: 30 * time.Second})
+	if len(chapters) != len(topics) {
+		t.Fatalf("unexpected chapters: %+v", chapters)
+	}
+	expected := []string{"budget", "hiring", "roadmap"}
+	for i, chapter := range chapters {
+		if chapter.From != i*12 || chapter.To != (i+1)*12 {
+			t.Errorf("unexpected utterances of chapter %d: [%d, %d)", i, chapter.From, chapter.To)
+		}
+		if chapter.Start != transcript.Utterances[chapter.From].Start() {
+			t.Errorf("unexpected start of chapter %d: %s", i, chapter.Start)
+		}
+		if !strings.Contains(strings.ToLower(chapter.Title), expected[i]) {
+			t.Errorf("unexpected title of chapter %d: %q", i, chapter.Title)
+		}
+	}
+	var metadata bytes.Buffer
+	if err := chapters.WriteFFMetadata(&metadata, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(metadata.String(), ";FFMETADATA1\n\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\n") {
+		t.Errorf("unexpected metadata:\n%s", metadata.String())
+	}
+}
@@ -0,0 +1,95 @@
+package krs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Labels are the results of the classification of an utterance (intent, sentiment...).
+type Labels map[string]string
+
+// Classifier labels finished utterances, with a local model or a remote service: plug it in a
+// Listener (ListenerConfig.Classifier) or label a whole transcript with Transcript.Classify().
+type Classifier interface {
+	Classify(ctx context.Context, utterance Utterance) (Labels, error)
+}
+
+// ClassifierFunc turns a function into a Classifier.
+type ClassifierFunc func(ctx context.Context, utterance Utterance) (Labels, error)
+
+func (cf ClassifierFunc) Classify(ctx context.Context, utterance Utterance) (Labels, error) {
+	return cf(ctx, utterance)
+}
+
+// HTTPClassifier posts each utterance as JSON to a classification service:
+//
+//	{"text": "I want a refund", "start": 1.2, "end": 2.5, "words": [...]}
+//
+// The service answers the labels as a JSON object, its values not being strings are formatted.
+type HTTPClassifier struct {
+	URL string
+	// Header is added to the requests (authentication)
+	Header http.Header
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Retry is the policy retrying the requests failing on the network or on a server error
+	// (defaults to DefaultRetryPolicy, within the time budget)
+	Retry *RetryPolicy
+}
+
+func (hc HTTPClassifier) Classify(ctx context.Context, utterance Utterance) (labels Labels, err error) {
+	body, err := json.Marshal(struct {
+		Text  string  `json:"text"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Words []Word  `json:"words"`
+	}{
+		Text:  utterance.Text(),
+		Start: utterance.Start().Seconds(),
+		End:   utterance.End().Seconds(),
+		Words: utterance.Words,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to encode the utterance: %w", err)
+		return
+	}
+	policy := DefaultRetryPolicy
+	if hc.Retry != nil {
+		policy = *hc.Retry
+	}
+	var resp *http.Response
+	if err = policy.Do(ctx, func(ctx context.Context) (err error) {
+		resp, err = postJSON(ctx, hc.Client, hc.URL, hc.Header, "classifier", body)
+		return
+	}); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var values map[string]any
+	if err = json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		err = fmt.Errorf("failed to decode the classifier answer: %w", err)
+		return
+	}
+	labels = make(Labels, len(values))
+	for key, value := range values {
+		if text, ok := value.(string); ok {
+			labels[key] = text
+		} else {
+			labels[key] = fmt.Sprint(value)
+		}
+	}
+	return
+}
+
+// classifyUtterance labels an utterance within a time budget.
+func classifyUtterance(ctx context.Context, classifier Classifier, timeout time.Duration, utterance *Utterance) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if utterance.Labels, err = classifier.Classify(ctx, *utterance); err != nil {
+		err = fmt.Errorf("failed to classify the utterance: %w", err)
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package krs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPClassifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var utterance struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&utterance); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		answer := map[string]any{"intent": "other", "confidence": 0.5}
+		if strings.Contains(utterance.Text, "refund") {
+			answer["intent"] = "refund"
+		}
+		json.NewEncoder(w).Encode(answer)
+	}))
+	defer server.Close()
+
+	var transcript Transcript
+	for i, text := range strings.Fields("I want a refund") {
+		transcript.AddWord(Word{Text: text, Start: time.Duration(i) * time.Second})
+	}
+	transcript.EndUtterance()
+	transcript.AddWord(Word{Text: "thanks", Start: 5 * time.Second})
+	classifier := HTTPClassifier{URL: server.URL}
+	if err := transcript.Classify(context.Background(), classifier, time.Second); err == nil ||
+		!strings.Contains(err.Error(), "HTTP 401: unauthorized") {
+		t.Fatalf("unexpected error without authentication: %v", err)
+	}
+	classifier.Header = http.Header{"Authorization": {"Bearer secret"}}
+	if err := transcript.Classify(context.Background(), classifier, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Labels{
+		{"intent": "refund", "confidence": "0.5"},
+		{"intent": "other", "confidence": "0.5"},
+	}
+	for i, utterance := range transcript.Utterances {
+		if !maps.Equal(utterance.Labels, expected[i]) {
+			t.Errorf("unexpected labels of utterance %d: %v", i, utterance.Labels)
+		}
+	}
+	// The labels are exported with the transcript
+	var exported bytes.Buffer
+	if err := transcript.WriteJSON(&exported); err != nil {
+		t.Fatal(err)
+	}
+	var loaded Transcript
+	if err := json.Unmarshal(exported.Bytes(), &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if labels := loaded.Utterances[0].Labels; !maps.Equal(labels, expected[0]) {
+		t.Errorf("unexpected labels loaded back: %v", labels)
+	}
+}
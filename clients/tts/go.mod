@@ -1,21 +0,0 @@
-module github.com/hekmon/kyutai-rs/clients/tts
-
-go 1.25.4
-
-replace github.com/hekmon/kyutai-rs => ../..
-
-require (
-	github.com/go-audio/audio v1.0.0
-	github.com/go-audio/transforms v0.0.0-20180121090939-51830ccc35a5
-	github.com/go-audio/wav v1.1.0
-	github.com/hekmon/kyutai-rs v1.0.0
-	golang.org/x/time v0.14.0
-)
-
-require (
-	github.com/coder/websocket v1.8.14 // indirect
-	github.com/go-audio/riff v1.0.0 // indirect
-	github.com/philhofer/fwd v1.2.0 // indirect
-	github.com/tinylib/msgp v1.5.0 // indirect
-	golang.org/x/sync v0.18.0 // indirect
-)
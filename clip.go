@@ -0,0 +1,48 @@
+package krs
+
+import "time"
+
+// AudioClip is a quote cut out of the transcribed audio.
+type AudioClip struct {
+	// Text is the transcript of the clip
+	Text string
+	// Start and End are the stream times of the clip, margins included
+	Start time.Duration
+	End   time.Duration
+	// PCM is the audio of the clip (24kHz mono)
+	PCM []float32
+}
+
+// ExtractAudio cuts the audio between two stream times of the transcript out of pcm, the audio
+// transcribed (24kHz mono, as written to the STT connection). The word timings count the silence
+// sent before it: STTStreamOffset is subtracted. The range is clamped to the audio and the
+// samples are copied.
+func (t Transcript) ExtractAudio(pcm []float32, start, end time.Duration) []float32 {
+	from := streamSample(start, len(pcm))
+	to := streamSample(end, len(pcm))
+	if to <= from {
+		return nil
+	}
+	return append([]float32(nil), pcm[from:to]...)
+}
+
+// ExtractWords cuts the audio of consecutive words of the transcript (an utterance, a keyword
+// match...) out of pcm, see ExtractAudio(). margin is added around them: the timings are those of
+// the text, not of the sound, and the last word of an utterance can have no end.
+func (t Transcript) ExtractWords(pcm []float32, words []Word, margin time.Duration) (clip AudioClip) {
+	if len(words) == 0 {
+		return
+	}
+	utterance := Utterance{Words: words}
+	clip.Text = utterance.Text()
+	clip.Start = max(utterance.Start()-margin, STTStreamOffset)
+	clip.End = utterance.End() + margin
+	clip.PCM = t.ExtractAudio(pcm, clip.Start, clip.End)
+	return
+}
+
+// streamSample returns the index of the sample of pcm at a stream time, clamped to its length.
+func streamSample(at time.Duration, length int) int {
+	sample := int((at - STTStreamOffset) * SampleRate / time.Second)
+	return min(max(sample, 0), length)
+}
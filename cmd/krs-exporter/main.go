@@ -0,0 +1,118 @@
+// Command krs-exporter periodically probes Kyutai servers (connection, Ready frame and a short
+// synthesis or transcription round trip) and exposes the results as Prometheus metrics, for the
+// black-box monitoring of a fleet of servers.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// envNameAPIKey is shared with the krs command
+	envNameAPIKey = "KYUTAI_TTS_APIKEY"
+	defaultVoice  = "expresso/ex01-ex02_default_001_channel2_198s.wav"
+)
+
+type options struct {
+	listen     string
+	interval   time.Duration
+	timeout    time.Duration
+	apiKeyFile string
+	voice      string
+	text       string
+	sttAudio   time.Duration
+	targets    []target
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.listen, "listen", ":9464", "Address to expose the metrics on (/metrics).")
+	flag.DurationVar(&opts.interval, "interval", 30*time.Second, "Time between two probes of a server.")
+	flag.DurationVar(&opts.timeout, "timeout", 15*time.Second, "Maximum duration of a probe.")
+	flag.StringVar(&opts.apiKeyFile, "api-key-file", "", "File containing the API key (the "+envNameAPIKey+" environment variable is used otherwise).")
+	flag.StringVar(&opts.voice, "voice", defaultVoice, "The voice of the TTS probes.")
+	flag.StringVar(&opts.text, "text", "Hello, this is a probe.", "The text synthesized by the TTS probes.")
+	flag.DurationVar(&opts.sttAudio, "stt-audio", 2*time.Second, "Duration of the silence transcribed by the STT probes.")
+	flag.Func("tts", "Websocket URL of a TTS server to probe (repeatable).", func(url string) error {
+		opts.targets = append(opts.targets, target{kind: kindTTS, url: url})
+		return nil
+	})
+	flag.Func("stt", "Websocket URL of a STT server to probe (repeatable).", func(url string) error {
+		opts.targets = append(opts.targets, target{kind: kindSTT, url: url})
+		return nil
+	})
+	flag.Parse()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if err := run(logger, opts); err != nil {
+		logger.Error("exporter failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(logger *slog.Logger, opts options) (err error) {
+	if len(opts.targets) == 0 {
+		return errors.New("no server to probe: use -tts and -stt")
+	}
+	if opts.interval <= 0 || opts.timeout <= 0 {
+		return errors.New("interval and timeout must be positive")
+	}
+	apiKey, err := loadAPIKey(opts.apiKeyFile)
+	if err != nil {
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start a prober per server
+	registry := newRegistry()
+	for _, t := range opts.targets {
+		var p *prober
+		if p, err = newProber(t, apiKey, opts); err != nil {
+			return
+		}
+		go p.run(ctx, logger, opts.interval, registry)
+	}
+
+	// Expose the metrics until stopped
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "krs-exporter: the metrics are on /metrics")
+	})
+	server := &http.Server{
+		Addr:              opts.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	logger.Info("exposing the metrics", "address", opts.listen, "servers", len(opts.targets))
+	if err = server.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return
+}
+
+func loadAPIKey(file string) (key string, err error) {
+	if file == "" {
+		return os.Getenv(envNameAPIKey), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		err = fmt.Errorf("failed to read the API key file: %w", err)
+		return
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registry holds the last probe of each server and renders them in the Prometheus text format.
+type registry struct {
+	mutex    sync.Mutex
+	last     map[target]probeResult
+	attempts map[target]map[bool]uint64
+}
+
+func newRegistry() *registry {
+	return &registry{
+		last:     make(map[target]probeResult),
+		attempts: make(map[target]map[bool]uint64),
+	}
+}
+
+func (r *registry) record(t target, result probeResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.last[t] = result
+	if r.attempts[t] == nil {
+		r.attempts[t] = make(map[bool]uint64, 2)
+	}
+	r.attempts[t][result.success]++
+}
+
+// gauge is a metric computed from the last probe of a server, skipped when not measured.
+type gauge struct {
+	name  string
+	help  string
+	value func(probeResult) (value float64, measured bool)
+}
+
+var gauges = []gauge{
+	{"krs_probe_success", "Whether the last probe of the server succeeded.", func(pr probeResult) (float64, bool) {
+		return boolValue(pr.success), true
+	}},
+	{"krs_probe_timestamp_seconds", "Start time of the last probe of the server.", func(pr probeResult) (float64, bool) {
+		return float64(pr.at.UnixMilli()) / 1000, true
+	}},
+	{"krs_probe_connect_seconds", "Time to establish the websocket connection.", seconds(func(pr probeResult) time.Duration {
+		return pr.connect
+	})},
+	{"krs_probe_ready_seconds", "Time to receive the Ready frame of the server, since the connection start.", seconds(func(pr probeResult) time.Duration {
+		return pr.ready
+	})},
+	{"krs_probe_first_audio_seconds", "Time to the first synthesized audio since the text was sent (TTS).", seconds(func(pr probeResult) time.Duration {
+		return pr.firstAudio
+	})},
+	{"krs_probe_round_trip_seconds", "Time from the start of the input to the end of the server stream.", seconds(func(pr probeResult) time.Duration {
+		return pr.roundTrip
+	})},
+	{"krs_probe_realtime_factor", "Audio synthesized or transcribed per second of wall clock.", func(pr probeResult) (float64, bool) {
+		return pr.realtimeFactor, pr.success
+	}},
+}
+
+func seconds(duration func(probeResult) time.Duration) func(probeResult) (float64, bool) {
+	return func(pr probeResult) (float64, bool) {
+		d := duration(pr)
+		return d.Seconds(), d > 0
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.write(w)
+}
+
+func (r *registry) write(w io.Writer) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	targets := make([]target, 0, len(r.last))
+	for t := range r.last {
+		targets = append(targets, t)
+	}
+	slices.SortFunc(targets, func(a, b target) int {
+		return strings.Compare(a.kind+a.url, b.kind+b.url)
+	})
+	var b strings.Builder
+	for _, g := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, t := range targets {
+			if value, measured := g.value(r.last[t]); measured {
+				fmt.Fprintf(&b, "%s{%s} %s\n", g.name, labels(t), formatValue(value))
+			}
+		}
+	}
+	b.WriteString("# HELP krs_probes_total Number of probes of the server by result.\n# TYPE krs_probes_total counter\n")
+	for _, t := range targets {
+		for _, success := range []bool{true, false} {
+			result := "failure"
+			if success {
+				result = "success"
+			}
+			fmt.Fprintf(&b, "krs_probes_total{%s,result=%q} %d\n", labels(t), result, r.attempts[t][success])
+		}
+	}
+	_, err = io.WriteString(w, b.String())
+	return
+}
+
+func labels(t target) string {
+	return fmt.Sprintf("kind=%q,server=%q", t.kind, t.url)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+const (
+	kindTTS = "tts"
+	kindSTT = "stt"
+)
+
+// target is a server to probe.
+type target struct {
+	kind string
+	url  string
+}
+
+// probeResult holds the measurements of a probe, the durations are zero when not reached.
+type probeResult struct {
+	at      time.Time
+	success bool
+	// websocket connection established
+	connect time.Duration
+	// Ready frame received, since the connection start
+	ready time.Duration
+	// first audio received since the text was sent (TTS only)
+	firstAudio time.Duration
+	// from the start of the input to the end of the server stream
+	roundTrip      time.Duration
+	realtimeFactor float64
+}
+
+type prober struct {
+	target
+	tts      *krs.TTSClient
+	stt      *krs.STTClient
+	text     string
+	sttAudio time.Duration
+	timeout  time.Duration
+}
+
+func newProber(t target, apiKey string, opts options) (p *prober, err error) {
+	p = &prober{
+		target:   t,
+		text:     opts.text,
+		sttAudio: opts.sttAudio,
+		timeout:  opts.timeout,
+	}
+	// A probe is a single attempt: retrying would hide the failures
+	switch t.kind {
+	case kindTTS:
+		p.tts, err = krs.NewTTSClient(&krs.TTSConfig{URL: t.url, APIKey: apiKey, Voice: opts.voice, Retry: &krs.RetryPolicy{}})
+	case kindSTT:
+		p.stt, err = krs.NewSTTClient(&krs.STTConfig{URL: t.url, APIKey: apiKey, Retry: &krs.RetryPolicy{}})
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid %s server %q: %w", t.kind, t.url, err)
+	}
+	return
+}
+
+// run probes the server at each interval until ctx is done.
+func (p *prober) run(ctx context.Context, logger *slog.Logger, interval time.Duration, registry *registry) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		result, err := p.probe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warn("probe failed", "kind", p.kind, "server", p.url, "error", err)
+		}
+		registry.record(p.target, result)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *prober) probe(ctx context.Context) (result probeResult, err error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	result.at = time.Now()
+	switch p.kind {
+	case kindTTS:
+		err = p.probeTTS(ctx, &result)
+	case kindSTT:
+		err = p.probeSTT(ctx, &result)
+	}
+	result.success = err == nil
+	return
+}
+
+// probeTTS synthesizes the probe text.
+func (p *prober) probeTTS(ctx context.Context, result *probeResult) (err error) {
+	start := time.Now()
+	conn, err := p.tts.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	result.connect = time.Since(start)
+	events := conn.Subscribe()
+	connCtx := conn.GetContext()
+	go func() {
+		sender := conn.GetWriteChan()
+		defer close(sender)
+		for word := range strings.FieldsSeq(p.text) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- word:
+			}
+		}
+	}()
+	sent := time.Now()
+	var samples int
+	receiver := conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if audio, ok := msg.(krs.MessagePackAudio); ok {
+				if samples == 0 {
+					result.firstAudio = time.Since(sent)
+				}
+				samples += len(audio.PCM)
+			}
+		}
+	}
+	if err = conn.Done(); err != nil {
+		return
+	}
+	if samples == 0 {
+		return errors.New("no audio received")
+	}
+	result.roundTrip = time.Since(sent)
+	result.ready = readyAfter(events, start)
+	result.realtimeFactor = conn.Stats().RealtimeFactor()
+	return
+}
+
+// probeSTT transcribes silence as fast as the server accepts it.
+func (p *prober) probeSTT(ctx context.Context, result *probeResult) (err error) {
+	start := time.Now()
+	conn, err := p.stt.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	result.connect = time.Since(start)
+	events := conn.Subscribe()
+	connCtx := conn.GetContext()
+	go func() {
+		sender := conn.GetWriteChan()
+		defer close(sender)
+		for range int(p.sttAudio / krs.FrameDuration) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- make([]float32, krs.FrameSize):
+			}
+		}
+	}()
+	sent := time.Now()
+	receiver := conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case _, open := <-receiver:
+			if !open {
+				break receive
+			}
+		}
+	}
+	if err = conn.Done(); err != nil {
+		return
+	}
+	result.roundTrip = time.Since(sent)
+	result.ready = readyAfter(events, start)
+	result.realtimeFactor = conn.Stats().RealtimeFactor()
+	return
+}
+
+// readyAfter returns when the connection became ready since start, from its closed state events.
+func readyAfter(events <-chan krs.StateEvent, start time.Time) (ready time.Duration) {
+	for event := range events {
+		if event.State == krs.ConnReady {
+			ready = event.At.Sub(start)
+		}
+	}
+	return
+}
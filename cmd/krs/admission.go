@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// errQueueFull is returned when the admission queue of an upstream server is full.
+	errQueueFull = errors.New("too many sessions waiting for the upstream server")
+	// errQueueTimeout is returned when a session waited the maximum time in the admission queue.
+	errQueueTimeout = errors.New("no session slot freed on the upstream server in time")
+)
+
+// admission bounds the sessions relayed to an upstream server: beyond the limit, the new ones
+// wait in a bounded queue for a slot, up to a maximum time. It is nil without limit.
+type admission struct {
+	slots   chan struct{}
+	queue   int64
+	queued  atomic.Int64
+	maxWait time.Duration
+}
+
+func newAdmission(maxSessions, queue int, maxWait time.Duration) *admission {
+	if maxSessions <= 0 {
+		return nil
+	}
+	return &admission{
+		slots:   make(chan struct{}, maxSessions),
+		queue:   int64(queue),
+		maxWait: maxWait,
+	}
+}
+
+// acquire takes a session slot, waiting in the queue if none is free. release must be called
+// once the session is over.
+func (a *admission) acquire(ctx context.Context) (release func(), waited time.Duration, err error) {
+	if a == nil {
+		return func() {}, 0, nil
+	}
+	release = func() { <-a.slots }
+	select {
+	case a.slots <- struct{}{}:
+		return
+	default:
+	}
+	if a.queued.Add(1) > a.queue {
+		a.queued.Add(-1)
+		return nil, 0, errQueueFull
+	}
+	defer a.queued.Add(-1)
+	start := time.Now()
+	timer := time.NewTimer(a.maxWait)
+	defer timer.Stop()
+	select {
+	case a.slots <- struct{}{}:
+		waited = time.Since(start)
+		return
+	case <-timer.C:
+		return nil, a.maxWait, errQueueTimeout
+	case <-ctx.Done():
+		return nil, time.Since(start), ctx.Err()
+	}
+}
+
+// retryAfter is the delay suggested to the refused clients, in seconds.
+func (a *admission) retryAfter() int {
+	return max(1, int(a.maxWait.Round(time.Second)/time.Second))
+}
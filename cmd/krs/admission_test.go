@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdmission(t *testing.T) {
+	a := newAdmission(1, 1, 200*time.Millisecond)
+	ctx := context.Background()
+	release, waited, err := a.acquire(ctx)
+	if err != nil || waited != 0 {
+		t.Fatalf("got %v after %s, expected a free slot", err, waited)
+	}
+	// the second session waits in the queue, the third one finds it full
+	acquired := make(chan time.Duration, 1)
+	go func() {
+		releaseQueued, waited, err := a.acquire(ctx)
+		if err != nil {
+			t.Error(err)
+			acquired <- 0
+			return
+		}
+		acquired <- waited
+		releaseQueued()
+	}()
+	for a.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, err = a.acquire(ctx); !errors.Is(err, errQueueFull) {
+		t.Errorf("got %v with the queue full, expected errQueueFull", err)
+	}
+	// releasing the slot lets the queued session in
+	time.Sleep(50 * time.Millisecond)
+	release()
+	if waited = <-acquired; waited < 50*time.Millisecond {
+		t.Errorf("the queued session waited %s, expected at least 50ms", waited)
+	}
+	if a.queued.Load() != 0 || len(a.slots) != 0 {
+		t.Errorf("got %d queued and %d slots taken after the releases", a.queued.Load(), len(a.slots))
+	}
+}
+
+func TestAdmissionTimeout(t *testing.T) {
+	a := newAdmission(1, 1, 100*time.Millisecond)
+	release, _, err := a.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	start := time.Now()
+	if _, waited, err := a.acquire(context.Background()); !errors.Is(err, errQueueTimeout) || waited != 100*time.Millisecond {
+		t.Errorf("got %v after %s, expected errQueueTimeout after 100ms", err, waited)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("gave up after %s, expected the maximum wait", elapsed)
+	}
+	// a client gone while waiting leaves the queue
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err = a.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected the context error", err)
+	}
+	if a.queued.Load() != 0 {
+		t.Errorf("%d sessions still queued", a.queued.Load())
+	}
+	if retryAfter := a.retryAfter(); retryAfter != 1 {
+		t.Errorf("got a retry after %ds, expected 1s at least", retryAfter)
+	}
+	// without limit, no session waits
+	var unlimited *admission
+	if release, _, err := unlimited.acquire(context.Background()); err != nil || release == nil {
+		t.Errorf("got %v without limit", err)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/testassets"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type benchOptions struct {
+	ttsServer   string
+	sttServer   string
+	voice       string
+	text        string
+	runs        int
+	concurrency int
+	stt         bool
+	phone       bool
+	phoneLoss   float64
+	phoneBurst  float64
+	network     networkOptions
+}
+
+func newBenchCommand(g *globals) *cobra.Command {
+	var opts benchOptions
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure the latency and throughput of the servers",
+		Long: `Measure the latency and throughput of the servers.
+
+The text is synthesized several times (concurrently if asked) and the time to first audio
+percentiles and the real time factor (processing time divided by audio duration, lower is
+better) are reported. With --stt, the synthesized audio is then transcribed as fast as the
+STT server accepts it to measure its own real time factor.
+
+With --phone, the audio is also transcribed as a phone call carries it: band-passed to
+300-3400Hz, quantized by the μ-law G.711 codec and, with --phone-loss, missing the VoIP packets
+lost by the network (20ms each, --phone-burst in a row on average). The word error rate of both
+transcriptions against the text tells how the transcripts degrade under telephony conditions.`,
+		Example: `  krs bench --runs 1 --stt --phone --phone-loss 5 --phone-burst 2`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBench(cmd.Context(), g, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.ttsServer, "tts-server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.sttServer, "stt-server", g.cfg.STTURL(defaultServer), "The websocket URL of the Kyutai STT server.")
+	cmd.Flags().StringVar(&opts.voice, "voice", g.cfg.VoiceOr(defaultVoice), "The voice to use for synthesis.")
+	cmd.Flags().StringVar(&opts.text, "text", testassets.LoadText("pangram"), "The text to synthesize on each run.")
+	cmd.Flags().IntVar(&opts.runs, "runs", 10, "Number of syntheses.")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 1, "Number of syntheses running at the same time.")
+	cmd.Flags().BoolVar(&opts.stt, "stt", false, "Also transcribe the synthesized audio to benchmark the STT server.")
+	cmd.Flags().BoolVar(&opts.phone, "phone", false, "Also transcribe the audio through a simulated phone call (requires --stt).")
+	cmd.Flags().Float64Var(&opts.phoneLoss, "phone-loss", 0, "Percentage of the VoIP packets lost by the simulated phone call.")
+	cmd.Flags().Float64Var(&opts.phoneBurst, "phone-burst", 1, "Mean number of VoIP packets lost in a row by the simulated phone call.")
+	opts.network.addFlags(cmd)
+	_ = cmd.RegisterFlagCompletionFunc("voice", completeVoices)
+	return cmd
+}
+
+// benchRun holds the measurements of one synthesis.
+type benchRun struct {
+	connect        time.Duration
+	firstAudio     time.Duration
+	total          time.Duration
+	audio          []float32
+	audioDuration  time.Duration
+	realTimeFactor float64
+	serverSide     time.Duration
+}
+
+func runBench(ctx context.Context, g *globals, opts benchOptions) (err error) {
+	if opts.runs < 1 || opts.concurrency < 1 {
+		return errors.New("runs and concurrency must be at least 1")
+	}
+	if opts.phone && !opts.stt {
+		return errors.New("--phone measures the transcriptions: it requires --stt")
+	}
+	if opts.phoneLoss < 0 || opts.phoneLoss >= 100 {
+		return errors.New("--phone-loss must be a percentage between 0 and 100")
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	ttsClient, err := krs.NewTTSClient(&krs.TTSConfig{
+		URL:     opts.ttsServer,
+		APIKey:  apiKey,
+		Voice:   opts.voice,
+		Network: opts.network.conditions(),
+		// the retries would be measured as connection time
+		Retry: &krs.RetryPolicy{},
+	})
+	if err != nil {
+		return
+	}
+	// TTS
+	var (
+		runs      = make([]benchRun, opts.runs)
+		workers   errgroup.Group
+		completed int
+		mutex     sync.Mutex
+	)
+	workers.SetLimit(opts.concurrency)
+	start := time.Now()
+	for i := range runs {
+		workers.Go(func() (err error) {
+			if runs[i], err = benchTTS(ctx, ttsClient, opts.text); err != nil {
+				return fmt.Errorf("run #%d failed: %w", i+1, err)
+			}
+			mutex.Lock()
+			completed++
+			g.logger.Info("synthesis done", "run", i+1, "completed", completed, "ttfa", runs[i].firstAudio.Round(time.Millisecond),
+				"rtf", fmt.Sprintf("%.3f", runs[i].realTimeFactor),
+			)
+			mutex.Unlock()
+			return
+		})
+	}
+	if err = workers.Wait(); err != nil {
+		return
+	}
+	elapsed := time.Since(start)
+	var audioTotal time.Duration
+	for _, run := range runs {
+		audioTotal += run.audioDuration
+	}
+	fmt.Printf("TTS: %d runs, concurrency %d, %s of audio synthesized in %s (aggregated real time factor %.3f)\n",
+		opts.runs, opts.concurrency, audioTotal.Round(time.Millisecond), elapsed.Round(time.Millisecond),
+		elapsed.Seconds()/audioTotal.Seconds(),
+	)
+	printPercentiles("connect", runs, func(r benchRun) time.Duration { return r.connect })
+	printPercentiles("time to first audio", runs, func(r benchRun) time.Duration { return r.firstAudio })
+	printPercentiles("  server side", runs, func(r benchRun) time.Duration { return r.serverSide })
+	printPercentiles("total", runs, func(r benchRun) time.Duration { return r.total })
+	rtfs := make([]float64, len(runs))
+	for i, run := range runs {
+		rtfs[i] = run.realTimeFactor
+	}
+	slices.Sort(rtfs)
+	fmt.Printf("  %-20s p50 %.3f  p90 %.3f  max %.3f\n", "real time factor", percentile(rtfs, 50), percentile(rtfs, 90), rtfs[len(rtfs)-1])
+	// STT
+	if !opts.stt {
+		return
+	}
+	sttClient, err := krs.NewSTTClient(&krs.STTConfig{
+		URL:     opts.sttServer,
+		APIKey:  apiKey,
+		Network: opts.network.conditions(),
+		Retry:   &krs.RetryPolicy{},
+	})
+	if err != nil {
+		return
+	}
+	words, processing, err := benchSTT(ctx, sttClient, runs[0].audio)
+	if err != nil {
+		return fmt.Errorf("transcription failed: %w", err)
+	}
+	fmt.Printf("STT: %s of audio transcribed in %s (real time factor %.3f): %s\n",
+		runs[0].audioDuration.Round(time.Millisecond), processing.Round(time.Millisecond),
+		processing.Seconds()/runs[0].audioDuration.Seconds(), strings.Join(words, " "),
+	)
+	if !opts.phone {
+		return
+	}
+	// the same audio as carried by a phone call
+	phoneAudio := slices.Clone(runs[0].audio)
+	krs.NewPhoneFilter(krs.PhoneFilterConfig{
+		PacketLoss: krs.PacketLossConfig{
+			Rate:  opts.phoneLoss / 100,
+			Burst: opts.phoneBurst,
+		},
+	}).Apply(phoneAudio, 0)
+	phoneWords, _, err := benchSTT(ctx, sttClient, phoneAudio)
+	if err != nil {
+		return fmt.Errorf("phone transcription failed: %w", err)
+	}
+	fmt.Printf("STT through a phone call (%.1f%% packet loss): %s\n", opts.phoneLoss, strings.Join(phoneWords, " "))
+	fmt.Printf("  %-20s clean %.1f%%  phone %.1f%%\n", "word error rate",
+		100*wordErrorRate(words, opts.text), 100*wordErrorRate(phoneWords, opts.text))
+	return
+}
+
+// wordErrorRate returns the word error rate of transcribed words against the text.
+func wordErrorRate(words []string, text string) float64 {
+	var transcript krs.Transcript
+	for _, word := range words {
+		transcript.AddWord(krs.Word{Text: word})
+	}
+	return krs.WordErrorRate(transcript.Diff(text))
+}
+
+func benchTTS(ctx context.Context, client *krs.TTSClient, text string) (run benchRun, err error) {
+	start := time.Now()
+	conn, err := client.Connect(ctx)
+	if err != nil {
+		return
+	}
+	run.connect = time.Since(start)
+	connCtx := conn.GetContext()
+	// Send the whole text at once
+	go func() {
+		sender := conn.GetWriteChan()
+		defer close(sender)
+		for word := range strings.FieldsSeq(text) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- word:
+			}
+		}
+	}()
+	sent := time.Now()
+	receiver := conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if audio, ok := msg.(krs.MessagePackAudio); ok {
+				if run.audio == nil {
+					run.firstAudio = time.Since(sent)
+				}
+				run.audio = append(run.audio, audio.PCM...)
+			}
+		}
+	}
+	if err = conn.Done(); err != nil {
+		return
+	}
+	if len(run.audio) == 0 {
+		err = errors.New("no audio received")
+		return
+	}
+	run.total = time.Since(sent)
+	run.audioDuration = time.Duration(len(run.audio)) * time.Second / krs.SampleRate
+	run.realTimeFactor = run.total.Seconds() / run.audioDuration.Seconds()
+	run.serverSide = conn.Stats().MeanLatency().ServerBuffer
+	return
+}
+
+// benchSTT streams the audio without pacing and returns the transcript and the time taken.
+func benchSTT(ctx context.Context, client *krs.STTClient, audio []float32) (words []string, processing time.Duration, err error) {
+	conn, err := client.Connect(ctx)
+	if err != nil {
+		return
+	}
+	connCtx := conn.GetContext()
+	start := time.Now()
+	go func() {
+		sender := conn.GetWriteChan()
+		defer close(sender)
+		for chunk := range slices.Chunk(audio, krs.FrameSize) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- chunk:
+			}
+		}
+	}()
+	receiver := conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if word, ok := msg.(krs.MessagePackWord); ok {
+				words = append(words, word.Text)
+			}
+		}
+	}
+	if err = conn.Done(); err != nil {
+		return
+	}
+	processing = time.Since(start)
+	return
+}
+
+func printPercentiles(name string, runs []benchRun, value func(benchRun) time.Duration) {
+	values := make([]float64, len(runs))
+	for i, run := range runs {
+		values[i] = float64(value(run))
+	}
+	slices.Sort(values)
+	fmt.Printf("  %-20s p50 %-8s p90 %-8s p99 %-8s max %s\n", name,
+		time.Duration(percentile(values, 50)).Round(time.Millisecond),
+		time.Duration(percentile(values, 90)).Round(time.Millisecond),
+		time.Duration(percentile(values, 99)).Round(time.Millisecond),
+		time.Duration(values[len(values)-1]).Round(time.Millisecond),
+	)
+}
+
+// percentile uses the nearest rank method on sorted values.
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+type chaptersOptions struct {
+	minDuration time.Duration
+	blockWords  int
+	offset      time.Duration
+	srt         string
+	json        string
+	ffmetadata  string
+}
+
+func newChaptersCommand(g *globals) *cobra.Command {
+	var opts chaptersOptions
+	cmd := &cobra.Command{
+		Use:   "chapters <transcript.json>",
+		Short: "Split a long transcript into titled chapters",
+		Long: `Split a long transcript into titled chapters.
+
+The transcript is loaded from its JSON export (krs stt --json) and split between utterances where
+its vocabulary changes the most (TextTiling). Each chapter is titled with its most characteristic
+words. The chapters are printed and can be exported as SubRip chapter markers, JSON or an ffmpeg
+metadata file, the chapter index of audiobooks (m4b) and podcasts.`,
+		Example: `  krs stt --input book.wav --json book.json
+  krs chapters book.json --ffmetadata chapters.txt
+  ffmpeg -i book.wav -i chapters.txt -map_metadata 1 -c:a aac book.m4b`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChapters(opts, args[0])
+		},
+	}
+	cmd.Flags().DurationVar(&opts.minDuration, "min-duration", time.Minute, "Minimum duration of a chapter.")
+	cmd.Flags().IntVar(&opts.blockWords, "block-words", 100, "Number of words compared on each side of a candidate chapter boundary.")
+	cmd.Flags().DurationVar(&opts.offset, "offset", krs.STTStreamOffset, "Stream time of the start of the audio file, subtracted in the ffmpeg metadata: the library sends a second of silence before the audio.")
+	cmd.Flags().StringVar(&opts.srt, "srt", "", "Write the chapters as SubRip subtitles to this file.")
+	cmd.Flags().StringVar(&opts.json, "json", "", "Write the chapters as JSON to this file.")
+	cmd.Flags().StringVar(&opts.ffmetadata, "ffmetadata", "", "Write the chapters as an ffmpeg metadata file.")
+	_ = cmd.MarkFlagFilename("srt", "srt")
+	_ = cmd.MarkFlagFilename("json", "json")
+	return cmd
+}
+
+func runChapters(opts chaptersOptions, filename string) (err error) {
+	transcript, err := readTranscriptJSON(filename)
+	if err != nil {
+		return
+	}
+	chapters := transcript.Chapters(krs.ChapterConfig{
+		BlockWords:  opts.blockWords,
+		MinDuration: opts.minDuration,
+	})
+	for _, chapter := range chapters {
+		fmt.Printf("%s  %s\n", formatStreamTime(chapter.Start), chapter.Title)
+	}
+	exports := []struct {
+		filename string
+		write    func(w io.Writer) error
+	}{
+		{opts.srt, chapters.WriteSRT},
+		{opts.json, chapters.WriteJSON},
+		{opts.ffmetadata, func(w io.Writer) error { return chapters.WriteFFMetadata(w, opts.offset) }},
+	}
+	for _, export := range exports {
+		if export.filename == "" {
+			continue
+		}
+		if err = writeFile(export.filename, export.write); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Chapters written to %q\n", export.filename)
+	}
+	return
+}
+
+func writeFile(filename string, write func(w io.Writer) error) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %q file: %w", filename, err)
+	}
+	defer file.Close()
+	return write(file)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+type clipOptions struct {
+	audio      string
+	utterances []int
+	phrases    []string
+	from       time.Duration
+	to         time.Duration
+	margin     time.Duration
+	output     string
+}
+
+func newClipCommand(g *globals) *cobra.Command {
+	var opts clipOptions
+	cmd := &cobra.Command{
+		Use:   "clip <transcript.json>",
+		Short: "Cut the audio of quotes out of a transcribed recording",
+		Long: `Cut the audio of quotes out of a transcribed recording.
+
+The transcript is loaded from its JSON export (krs stt --json) and the clips are cut out of the
+transcribed wave file: whole utterances (--utterance, counted from 1 as printed by krs stt),
+each occurrence of a phrase (--phrase, tolerating small transcription mistakes) or a range of
+stream times (--from and --to, as printed by krs chapters). Each clip is written to its own wave
+file, named after --output where %d is the clip number.`,
+		Example: `  krs stt --input call.wav --json call.json
+  krs clip call.json --audio call.wav --phrase "cancel my subscription"
+  krs clip call.json --audio call.wav --utterance 3 --output quote.wav`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runClip(opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.audio, "audio", "", "Audio file (wav or ogg) the transcript comes from.")
+	cmd.Flags().IntSliceVar(&opts.utterances, "utterance", nil, "Cut this utterance (repeatable).")
+	cmd.Flags().StringArrayVar(&opts.phrases, "phrase", nil, "Cut each occurrence of this phrase (repeatable).")
+	cmd.Flags().DurationVar(&opts.from, "from", 0, "Start of the stream time range to cut (with --to).")
+	cmd.Flags().DurationVar(&opts.to, "to", 0, "End of the stream time range to cut.")
+	cmd.Flags().DurationVar(&opts.margin, "margin", 300*time.Millisecond, "Audio kept around the words cut.")
+	cmd.Flags().StringVar(&opts.output, "output", "clip-%d.wav", "Wave file to write each clip to, %d is replaced by the clip number.")
+	_ = cmd.MarkFlagRequired("audio")
+	_ = cmd.MarkFlagFilename("audio", "wav", "ogg", "oga")
+	_ = cmd.MarkFlagFilename("output", "wav")
+	return cmd
+}
+
+func runClip(opts clipOptions, filename string) (err error) {
+	transcript, err := readTranscriptJSON(filename)
+	if err != nil {
+		return
+	}
+	pcm, err := audio.ReadFile(opts.audio)
+	if err != nil {
+		return fmt.Errorf("failed to read audio samples from %q: %w", opts.audio, err)
+	}
+
+	// Select the clips
+	var clips []krs.AudioClip
+	for _, number := range opts.utterances {
+		if number < 1 || number > len(transcript.Utterances) {
+			return fmt.Errorf("no utterance %d: the transcript has %d", number, len(transcript.Utterances))
+		}
+		clips = append(clips, transcript.ExtractWords(pcm, transcript.Utterances[number-1].Words, opts.margin))
+	}
+	if len(opts.phrases) > 0 {
+		matcher := krs.NewKeywordMatcher(krs.KeywordConfig{Phrases: opts.phrases})
+		for _, utterance := range transcript.Utterances {
+			for _, word := range utterance.Words {
+				for _, match := range matcher.Feed(word) {
+					clips = append(clips, transcript.ExtractWords(pcm, match.Words, opts.margin))
+				}
+			}
+		}
+	}
+	if opts.to > opts.from {
+		clips = append(clips, krs.AudioClip{
+			Text:  wordsBetween(transcript, opts.from, opts.to),
+			Start: opts.from,
+			End:   opts.to,
+			PCM:   transcript.ExtractAudio(pcm, opts.from, opts.to),
+		})
+	}
+	if len(clips) == 0 {
+		return errors.New("nothing to cut: select utterances, phrases or a time range")
+	}
+	numbered := strings.Contains(opts.output, "%d")
+	if len(clips) > 1 && !numbered {
+		return fmt.Errorf("%d clips are cut: the output must contain %%d", len(clips))
+	}
+
+	// Write them
+	for i, clip := range clips {
+		output := opts.output
+		if numbered {
+			output = strings.Replace(output, "%d", fmt.Sprint(i+1), 1)
+		}
+		if len(clip.PCM) == 0 {
+			fmt.Printf("%s-%s  %q: no audio (beyond the end of the file?)\n", formatStreamTime(clip.Start), formatStreamTime(clip.End), clip.Text)
+			continue
+		}
+		if err = writeSamples(output, clip.PCM); err != nil {
+			return
+		}
+		fmt.Printf("%s-%s  %q written to %q\n", formatStreamTime(clip.Start), formatStreamTime(clip.End), clip.Text, output)
+	}
+	return
+}
+
+// wordsBetween returns the text of the words starting within a stream time range.
+func wordsBetween(transcript krs.Transcript, from, to time.Duration) string {
+	var words []krs.Word
+	for _, utterance := range transcript.Utterances {
+		for _, word := range utterance.Words {
+			if word.Start >= from && word.Start < to {
+				words = append(words, word)
+			}
+		}
+	}
+	return krs.Utterance{Words: words}.Text()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCommand(g *globals) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show or edit the configuration file",
+		Long: `Show or edit the configuration file providing the flags defaults.
+
+Available keys: ` + strings.Join(config.Keys(), ", "),
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "path",
+			Short: "Show the configuration file location",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) (err error) {
+				path, err := config.Path()
+				if err != nil {
+					return
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), path)
+				return
+			},
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "Show the current configuration",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) (err error) {
+				if g.cfgErr != nil {
+					return g.cfgErr
+				}
+				for _, key := range config.Keys() {
+					value, _ := g.cfg.Get(key)
+					if value == "" {
+						continue
+					}
+					if key == "api_key" {
+						value = "<hidden>"
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", key, value)
+				}
+				return
+			},
+		},
+		&cobra.Command{
+			Use:               "get <key>",
+			Short:             "Show the value of a key",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeConfigKeys,
+			RunE: func(cmd *cobra.Command, args []string) (err error) {
+				if g.cfgErr != nil {
+					return g.cfgErr
+				}
+				value, err := g.cfg.Get(args[0])
+				if err != nil {
+					return
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), value)
+				return
+			},
+		},
+		&cobra.Command{
+			Use:               "set <key> [value]",
+			Short:             "Set a key (the value is read from stdin if omitted, useful for api_key)",
+			Args:              cobra.RangeArgs(1, 2),
+			ValidArgsFunction: completeConfigKeys,
+			RunE: func(cmd *cobra.Command, args []string) (err error) {
+				var value string
+				if len(args) == 2 {
+					value = args[1]
+				} else if value, err = readConfigValue(args[0]); err != nil {
+					return
+				}
+				return setConfig(g, args[0], value)
+			},
+		},
+		&cobra.Command{
+			Use:               "unset <key>",
+			Short:             "Remove a key",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeConfigKeys,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return setConfig(g, args[0], "")
+			},
+		},
+	)
+	return cmd
+}
+
+func setConfig(g *globals, key, value string) (err error) {
+	if g.cfgErr != nil {
+		return g.cfgErr
+	}
+	if err = g.cfg.Set(key, value); err != nil {
+		return
+	}
+	return g.cfg.Save()
+}
+
+// readConfigValue reads a value from stdin to keep secrets out of the shell history.
+func readConfigValue(key string) (value string, err error) {
+	fmt.Fprintf(os.Stderr, "Value for %s: ", key)
+	if value, err = bufio.NewReader(os.Stdin).ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("failed to read the value from stdin: %w", err)
+		return
+	}
+	value = strings.TrimSpace(value)
+	err = nil
+	return
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+var convertFormats = []string{"whisper", "assemblyai", "otr", "csv", "srt", "text", "audacity", "edl"}
+
+type convertOptions struct {
+	format string
+	offset time.Duration
+	media  string
+	output string
+	// audacity and edl
+	words         bool
+	fps           int
+	timelineStart time.Duration
+}
+
+func newConvertCommand(g *globals) *cobra.Command {
+	var opts convertOptions
+	cmd := &cobra.Command{
+		Use:   "convert <transcript.json>",
+		Short: "Convert a transcript to the formats of other speech to text tools",
+		Long: `Convert a transcript to the formats of other speech to text tools.
+
+The transcript is loaded from its JSON export (krs stt --json) and written as:
+  whisper     OpenAI Whisper verbose JSON, one segment per utterance with the word timestamps
+  assemblyai  AssemblyAI transcript JSON, the words with their times in milliseconds
+  otr         oTranscribe document, one timestamped paragraph per utterance
+  csv         one line per word: utterance,start,end,word (seconds)
+  srt         SubRip subtitles, one per utterance
+  text        plain text, one line per utterance
+  audacity    Audacity label track, one label per utterance (or per word with --words)
+  edl         CMX 3600 edit decision list for the video editors, one event per utterance
+              with its text as a comment (see --fps and --timeline-start)
+
+The timings are made relative to the start of the transcribed audio file (see --offset).`,
+		Example: `  krs stt --input call.wav --json call.json
+  krs convert call.json --format whisper --output call.whisper.json
+  krs convert interview.json --format edl --fps 30 --timeline-start 1h --output interview.edl`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConvert(opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.format, "format", "whisper", "Output format: "+strings.Join(convertFormats, ", ")+".")
+	cmd.Flags().DurationVar(&opts.offset, "offset", krs.STTStreamOffset, "Stream time of the start of the audio file, subtracted from the timings: the library sends a second of silence before the audio.")
+	cmd.Flags().StringVar(&opts.media, "media", "", "Audio file name referenced by the oTranscribe document and the EDL (defaults to the transcript name with a .wav extension).")
+	cmd.Flags().StringVar(&opts.output, "output", "-", "File to write, - for stdout.")
+	cmd.Flags().BoolVar(&opts.words, "words", false, "One Audacity label per word instead of per utterance.")
+	cmd.Flags().IntVar(&opts.fps, "fps", 25, "Frame rate of the EDL timecodes (non drop frame).")
+	cmd.Flags().DurationVar(&opts.timelineStart, "timeline-start", 0, "Timecode of the start of the EDL timeline, the video editors commonly start them at 1h.")
+	_ = cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(convertFormats, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func runConvert(opts convertOptions, filename string) (err error) {
+	if !slices.Contains(convertFormats, opts.format) {
+		return fmt.Errorf("unknown format %q: expected one of %s", opts.format, strings.Join(convertFormats, ", "))
+	}
+	transcript, err := readTranscriptJSON(filename)
+	if err != nil {
+		return
+	}
+	transcript = transcript.Shift(-opts.offset)
+	if opts.media == "" {
+		opts.media = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + ".wav"
+	}
+	write := func(w io.Writer) error {
+		switch opts.format {
+		case "whisper":
+			return transcript.WriteWhisperJSON(w)
+		case "assemblyai":
+			return transcript.WriteAssemblyAIJSON(w)
+		case "otr":
+			return transcript.WriteOTR(w, opts.media)
+		case "csv":
+			return transcript.WriteCSV(w)
+		case "srt":
+			return transcript.WriteSRT(w)
+		case "audacity":
+			return transcript.WriteAudacityLabels(w, opts.words)
+		case "edl":
+			return transcript.WriteEDL(w, krs.EDLConfig{
+				Title:         strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)),
+				Clip:          opts.media,
+				FrameRate:     opts.fps,
+				TimelineStart: opts.timelineStart,
+			})
+		default:
+			_, err := fmt.Fprintln(w, transcript.Text())
+			return err
+		}
+	}
+	if opts.output == "-" {
+		return write(os.Stdout)
+	}
+	if err = writeFile(opts.output, write); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Transcript written to %q\n", opts.output)
+	return
+}
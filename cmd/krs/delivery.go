@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+)
+
+const (
+	// deliveryTimeout is the time budget of each delivery of a transcript
+	deliveryTimeout = 30 * time.Second
+	// chatMaxText bounds the transcript text posted to a chat, the chats limit the message size
+	chatMaxText = 3000
+	// smtpsPort is the port of the SMTP servers expecting TLS from the start instead of STARTTLS
+	smtpsPort = "465"
+)
+
+// delivery sends the transcripts of the files transcribed by a watch rule somewhere. Exactly one
+// of the targets is set.
+type delivery struct {
+	// Webhook receives a JSON POST with the file name, its text and its transcript
+	Webhook string `yaml:"webhook,omitempty"`
+	// Chat is the incoming webhook of a chat (Slack, Mattermost, Google Chat, Matrix hookshot...):
+	// it receives a message with the text of the transcript
+	Chat string `yaml:"chat,omitempty"`
+	// Email sends the text of the transcript, with the transcript files attached
+	Email *emailDelivery `yaml:"email,omitempty"`
+}
+
+// emailDelivery sends the transcripts by email through an SMTP submission server.
+type emailDelivery struct {
+	// Server is the host:port of the SMTP server, STARTTLS is used when offered (and TLS from the
+	// start on port 465)
+	Server string   `yaml:"server"`
+	From   string   `yaml:"from"`
+	To     []string `yaml:"to"`
+	// Username enables the authentication, with the password references
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordEnv  string `yaml:"password_env,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+	// resolved on load
+	password string
+}
+
+// deliveredTranscript is what is delivered of a transcribed file.
+type deliveredTranscript struct {
+	// File is the name of the audio file
+	File string
+	// Audio is the duration of the audio file
+	Audio      time.Duration
+	Transcript krs.Transcript
+	// Sidecars are the paths of the transcript files written
+	Sidecars []string
+}
+
+// validate checks the delivery configuration and resolves its password.
+func (d *delivery) validate() (err error) {
+	var targets int
+	for _, set := range []bool{d.Webhook != "", d.Chat != "", d.Email != nil} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return errors.New("a delivery needs exactly one of webhook, chat or email")
+	}
+	for _, webhook := range []string{d.Webhook, d.Chat} {
+		if webhook == "" {
+			continue
+		}
+		if parsed, parseErr := url.Parse(webhook); parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid webhook URL %q: expected an http or https URL", webhook)
+		}
+	}
+	if d.Email == nil {
+		return
+	}
+	if _, _, err = net.SplitHostPort(d.Email.Server); err != nil {
+		return fmt.Errorf("invalid SMTP server %q: expected host:port", d.Email.Server)
+	}
+	if d.Email.From == "" || len(d.Email.To) == 0 {
+		return errors.New("an email delivery needs from and to addresses")
+	}
+	if d.Email.password, err = config.ResolveKey(d.Email.Password, d.Email.PasswordEnv, d.Email.PasswordFile); err != nil {
+		return fmt.Errorf("failed to resolve the SMTP password: %w", err)
+	}
+	return
+}
+
+// String describes the delivery for the logs, without the secrets the webhook URLs can contain.
+func (d *delivery) String() string {
+	switch {
+	case d.Webhook != "":
+		return "webhook " + webhookHost(d.Webhook)
+	case d.Chat != "":
+		return "chat " + webhookHost(d.Chat)
+	case d.Email != nil:
+		return "email to " + strings.Join(d.Email.To, ", ")
+	default:
+		return "none"
+	}
+}
+
+func webhookHost(webhook string) string {
+	if parsed, err := url.Parse(webhook); err == nil {
+		return parsed.Host
+	}
+	return "?"
+}
+
+// deliver sends a transcript to the target of the delivery.
+func (d *delivery) deliver(ctx context.Context, dt deliveredTranscript) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	switch {
+	case d.Webhook != "":
+		return postJSON(ctx, d.Webhook, struct {
+			File       string         `json:"file"`
+			Duration   float64        `json:"duration"`
+			Text       string         `json:"text"`
+			Transcript krs.Transcript `json:"transcript"`
+		}{
+			File:       dt.File,
+			Duration:   dt.Audio.Seconds(),
+			Text:       dt.Transcript.Text(),
+			Transcript: dt.Transcript,
+		})
+	case d.Chat != "":
+		text := dt.Transcript.Text()
+		if runes := []rune(text); len(runes) > chatMaxText {
+			text = string(runes[:chatMaxText]) + "…"
+		}
+		return postJSON(ctx, d.Chat, struct {
+			Text string `json:"text"`
+		}{
+			Text: fmt.Sprintf("Transcript of %s:\n%s", dt.File, text),
+		})
+	case d.Email != nil:
+		return d.Email.send(ctx, dt)
+	}
+	return
+}
+
+// postJSON posts a JSON document to a webhook.
+func postJSON(ctx context.Context, webhook string, document any) (err error) {
+	body, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("failed to encode the webhook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create the webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call the webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("the webhook answered HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return
+}
+
+// send emails the text of a transcript with the transcript files attached.
+func (ed *emailDelivery) send(ctx context.Context, dt deliveredTranscript) (err error) {
+	message, err := ed.message(dt)
+	if err != nil {
+		return
+	}
+	host, port, _ := net.SplitHostPort(ed.Server)
+	var conn net.Conn
+	if port == smtpsPort {
+		dialer := tls.Dialer{Config: &tls.Config{ServerName: host}}
+		conn, err = dialer.DialContext(ctx, "tcp", ed.Server)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", ed.Server)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to the SMTP server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, set := ctx.Deadline(); set {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("failed to greet the SMTP server: %w", err)
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start TLS with the SMTP server: %w", err)
+		}
+	}
+	if ed.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", ed.Username, ed.password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate to the SMTP server: %w", err)
+		}
+	}
+	if err = client.Mail(ed.From); err != nil {
+		return fmt.Errorf("the SMTP server refused the sender: %w", err)
+	}
+	for _, to := range ed.To {
+		if err = client.Rcpt(to); err != nil {
+			return fmt.Errorf("the SMTP server refused the recipient %q: %w", to, err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start the email: %w", err)
+	}
+	if _, err = data.Write(message); err != nil {
+		return fmt.Errorf("failed to send the email: %w", err)
+	}
+	if err = data.Close(); err != nil {
+		return fmt.Errorf("the SMTP server refused the email: %w", err)
+	}
+	return client.Quit()
+}
+
+// message builds the MIME email of a transcript.
+func (ed *emailDelivery) message(dt deliveredTranscript) (message []byte, err error) {
+	var buffer bytes.Buffer
+	body := multipart.NewWriter(&buffer)
+	fmt.Fprintf(&buffer, "From: %s\r\n", ed.From)
+	fmt.Fprintf(&buffer, "To: %s\r\n", strings.Join(ed.To, ", "))
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Transcript of "+dt.File))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buffer, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", body.Boundary())
+	part, err := body.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return
+	}
+	text := quotedprintable.NewWriter(part)
+	if _, err = io.WriteString(text, strings.ReplaceAll(dt.Transcript.Text(), "\n", "\r\n")+"\r\n"); err != nil {
+		return
+	}
+	if err = text.Close(); err != nil {
+		return
+	}
+	for _, sidecar := range dt.Sidecars {
+		var content []byte
+		if content, err = os.ReadFile(sidecar); err != nil {
+			err = fmt.Errorf("failed to read the transcript file to attach: %w", err)
+			return
+		}
+		name := filepath.Base(sidecar)
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		if part, err = body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			"Content-Transfer-Encoding": {"base64"},
+		}); err != nil {
+			return
+		}
+		encoded := base64.StdEncoding.EncodeToString(content)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+	if err = body.Close(); err != nil {
+		return
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+func testDelivered(words ...string) deliveredTranscript {
+	var transcript krs.Transcript
+	for i, word := range words {
+		transcript.AddWord(krs.Word{Text: word, Start: time.Duration(i) * time.Second})
+	}
+	transcript.EndUtterance()
+	return deliveredTranscript{File: "meeting.wav", Audio: 90 * time.Second, Transcript: transcript}
+}
+
+// webhookRecorder is a webhook receiving JSON documents.
+func webhookRecorder(t *testing.T, status int) (url string, received chan []byte) {
+	t.Helper()
+	received = make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got a %s request of %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, "rejected\n")
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/hooks/secret-token", received
+}
+
+func TestDeliveryWebhook(t *testing.T) {
+	url, received := webhookRecorder(t, http.StatusNoContent)
+	target := &delivery{Webhook: url}
+	if err := target.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if description := target.String(); strings.Contains(description, "secret-token") {
+		t.Errorf("the description %q leaks the webhook path", description)
+	}
+	if err := target.deliver(context.Background(), testDelivered("hello", "world")); err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		File       string         `json:"file"`
+		Duration   float64        `json:"duration"`
+		Text       string         `json:"text"`
+		Transcript krs.Transcript `json:"transcript"`
+	}
+	if err := json.Unmarshal(<-received, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.File != "meeting.wav" || payload.Duration != 90 || payload.Text != "hello world" ||
+		len(payload.Transcript.Utterances) != 1 || len(payload.Transcript.Utterances[0].Words) != 2 {
+		t.Errorf("got the payload %+v", payload)
+	}
+	// the errors of the webhook are reported
+	url, received = webhookRecorder(t, http.StatusForbidden)
+	err := (&delivery{Webhook: url}).deliver(context.Background(), testDelivered("hello"))
+	<-received
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403: rejected") {
+		t.Errorf("got %v, expected the HTTP error", err)
+	}
+}
+
+func TestDeliveryChat(t *testing.T) {
+	url, received := webhookRecorder(t, http.StatusOK)
+	target := &delivery{Chat: url}
+	if err := target.deliver(context.Background(), testDelivered("hello", "world")); err != nil {
+		t.Fatal(err)
+	}
+	var message struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(<-received, &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Text != "Transcript of meeting.wav:\nhello world" {
+		t.Errorf("got the message %q", message.Text)
+	}
+	// the long transcripts are truncated
+	if err := target.deliver(context.Background(), testDelivered(strings.Split(strings.Repeat("é ", chatMaxText), " ")...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(<-received, &message); err != nil {
+		t.Fatal(err)
+	}
+	text := strings.TrimPrefix(message.Text, "Transcript of meeting.wav:\n")
+	if runes := []rune(text); len(runes) != chatMaxText+1 || !strings.HasSuffix(text, "…") {
+		t.Errorf("got a text of %d characters, expected %d and an ellipsis", len(runes), chatMaxText+1)
+	}
+}
+
+func TestDeliveryValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target delivery
+		err    string
+	}{
+		{"none", delivery{}, "exactly one"},
+		{"two", delivery{Webhook: "https://example.com", Chat: "https://example.com"}, "exactly one"},
+		{"not http", delivery{Chat: "ftp://example.com"}, "invalid webhook URL"},
+		{"no port", delivery{Email: &emailDelivery{Server: "smtp.example.com", From: "a@example.com", To: []string{"b@example.com"}}}, "expected host:port"},
+		{"no recipient", delivery{Email: &emailDelivery{Server: "smtp.example.com:587", From: "a@example.com"}}, "from and to"},
+	} {
+		if err := tc.target.validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got %v, expected %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	sidecar := filepath.Join(t.TempDir(), "meeting.srt")
+	if err := os.WriteFile(sidecar, []byte("1\n00:00:00,000 --> 00:00:01,000\nhello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ed := &emailDelivery{From: "krs@example.com", To: []string{"a@example.com", "b@example.com"}}
+	dt := testDelivered("hello", "world")
+	dt.Sidecars = []string{sidecar}
+	message, err := ed.message(dt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header.Get("To") != "a@example.com, b@example.com" || parsed.Header.Get("Subject") != "Transcript of meeting.wav" {
+		t.Errorf("got the headers %v", parsed.Header)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	// multipart decodes the quoted-printable text, not the base64 attachments
+	text, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(text); string(body) != "hello world\r\n" {
+		t.Errorf("got the text %q", body)
+	}
+	attachment, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.FileName() != "meeting.srt" || attachment.Header.Get("Content-Transfer-Encoding") != "base64" {
+		t.Errorf("got the attachment %v", attachment.Header)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+type dialogueOptions struct {
+	server       string
+	voices       map[string]string
+	output       string
+	gap          time.Duration
+	level        float64
+	keepLevels   bool
+	json         string
+	noVoiceCheck bool
+}
+
+func newDialogueCommand(g *globals) *cobra.Command {
+	var opts dialogueOptions
+	cmd := &cobra.Command{
+		Use:   "dialogue <script.txt>",
+		Short: "Synthesize a dialogue between several voices",
+		Long: `Synthesize a dialogue between several voices.
+
+The script has a line per turn, starting with the name of the speaker:
+
+  Alice: Did you see the news this morning?
+  Bob: Not yet, what happened?
+
+A line without speaker goes on with the previous one. Each speaker is given a voice with --voice,
+the turns are synthesized one after the other and written to a single wave file with --gap of
+silence between them (- for stdin).
+
+The voices are recorded at different levels: the level of each voice is measured over all its
+turns and every voice is brought to the same speech level (--level, lowered for all the voices
+when one would peak above -1 dBFS), so that no speaker is noticeably louder than another.
+--keep-levels leaves the voices as synthesized.`,
+		Example: `  krs dialogue interview.txt --voice Alice=expresso/ex03-ex01_happy_001_channel1_334s.wav \
+    --voice Bob=expresso/ex04-ex02_confused_001_channel2_102s.wav --output interview.wav`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDialogue(g, opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringToStringVar(&opts.voices, "voice", nil, "Voice of a speaker of the script, as speaker=voice (repeatable).")
+	cmd.Flags().StringVar(&opts.output, "output", "dialogue.wav", "Wave file to write the dialogue to.")
+	cmd.Flags().DurationVar(&opts.gap, "gap", krs.DefaultDialogueGap, "Silence between two turns.")
+	cmd.Flags().Float64Var(&opts.level, "level", krs.InputTargetLevel, "Speech level the voices are matched at, in dBFS.")
+	cmd.Flags().BoolVar(&opts.keepLevels, "keep-levels", false, "Do not match the levels of the voices.")
+	cmd.Flags().StringVar(&opts.json, "json", "", "Also write the turns with their times and the levels of the voices to this JSON file.")
+	cmd.Flags().BoolVar(&opts.noVoiceCheck, "no-voice-check", false, "Do not check the voices exist in the voices repository (for voices local to the server).")
+	_ = cmd.MarkFlagFilename("output", "wav")
+	_ = cmd.MarkFlagFilename("json", "json")
+	return cmd
+}
+
+func runDialogue(g *globals, opts dialogueOptions, filename string) (err error) {
+	if !strings.HasSuffix(opts.output, ".wav") {
+		return errors.New("the output must have a .wav extension")
+	}
+	var input io.Reader = os.Stdin
+	if filename != "-" {
+		var file *os.File
+		if file, err = os.Open(filename); err != nil {
+			return fmt.Errorf("failed to open the script: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	script, err := readDialogueScript(input, opts.voices)
+	if err != nil {
+		return
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	config := &krs.TTSConfig{
+		URL:    opts.server,
+		APIKey: apiKey,
+		Tags:   g.tags,
+	}
+	if !opts.noVoiceCheck {
+		config.VoiceGallery = voiceGallery(krs.DefaultVoiceRepository)
+	}
+	ttsClient, err := krs.NewTTSClient(config)
+	if err != nil {
+		return
+	}
+	_, abortCtx, stop := interruptible(nil)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Synthesizing %d turns...\n", len(script))
+	dialogue, err := ttsClient.SynthesizeDialogue(abortCtx, script, krs.DialogueConfig{
+		Gap:        opts.gap,
+		Level:      opts.level,
+		KeepLevels: opts.keepLevels,
+	})
+	if err != nil {
+		return
+	}
+	speakers := make(map[string]string, len(opts.voices))
+	for speaker, voice := range opts.voices {
+		speakers[voice] = speaker
+	}
+	for _, voice := range slices.Sorted(maps.Keys(dialogue.Voices)) {
+		levels := dialogue.Voices[voice]
+		if levels.Silent {
+			fmt.Fprintf(os.Stderr, "%s: silent\n", speakers[voice])
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: speech at %.1f dBFS, gain %+.1f dB\n", speakers[voice], levels.Speech, levels.Gain)
+	}
+	if err = writeSamples(opts.output, dialogue.PCM); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Dialogue written to %q\n", opts.output)
+	if opts.json != "" {
+		if err = writeFile(opts.json, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(dialogue)
+		}); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Turns written to %q\n", opts.json)
+	}
+	return
+}
+
+// looksLikeSpeaker tells whether the text before a colon can be a speaker name: a few words without
+// digits nor punctuation (but Dr. or O'Brien), unlike the "at 10:30" of a text.
+func looksLikeSpeaker(name string) bool {
+	if name == "" || len(strings.Fields(name)) > 3 {
+		return false
+	}
+	return !strings.ContainsFunc(name, func(r rune) bool {
+		return unicode.IsDigit(r) || (unicode.IsPunct(r) && r != '-' && r != '\'' && r != '.')
+	})
+}
+
+// readDialogueScript reads a script with a turn per line, "speaker: text", the lines without
+// speaker going on with the previous one.
+func readDialogueScript(r io.Reader, voices map[string]string) (script []krs.DialogueLine, err error) {
+	lines := bufio.NewScanner(r)
+	var missing []string
+	for number := 1; lines.Scan(); number++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+		speaker, text, found := strings.Cut(line, ":")
+		speaker = strings.TrimSpace(speaker)
+		if _, known := voices[speaker]; !found || (!known && !looksLikeSpeaker(speaker)) {
+			if len(script) == 0 {
+				err = fmt.Errorf("line %d: the script must start with a speaker (speaker: text)", number)
+				return
+			}
+			script[len(script)-1].Text += " " + line
+			continue
+		}
+		voice, known := voices[speaker]
+		if !known && !slices.Contains(missing, speaker) {
+			missing = append(missing, speaker)
+		}
+		script = append(script, krs.DialogueLine{Voice: voice, Text: strings.TrimSpace(text)})
+	}
+	if err = lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the script: %w", err)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no voice for %s: give them with --voice speaker=voice", strings.Join(missing, ", "))
+	}
+	if len(script) == 0 {
+		return nil, errors.New("empty script")
+	}
+	return
+}
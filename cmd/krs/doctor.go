@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/hekmon/kyutai-rs/testassets"
+	"github.com/spf13/cobra"
+)
+
+type doctorOptions struct {
+	ttsServer string
+	sttServer string
+	voice     string
+	wav       string
+	timeout   time.Duration
+}
+
+func newDoctorCommand(g *globals) *cobra.Command {
+	var opts doctorOptions
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the servers and the client setup end to end",
+		Long: `Check the servers and the client setup end to end.
+
+For each server, the checks go from the network to the model: DNS resolution, TCP connection
+and TLS handshake (wss), API key, Ready frame latency, a short synthesis or transcription and
+the sample rate sanity. The checks of a server stop at the first failure, the following ones
+are skipped.
+
+The transcription uses --wav, or the audio of the synthesis check, or the embedded test clips:
+the transcript is validated for speech. Use an empty server URL to skip a server.`,
+		Example: `  krs doctor --tts-server wss://tts.example.com --stt-server wss://stt.example.com`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context(), g, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.ttsServer, "tts-server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.sttServer, "stt-server", g.cfg.STTURL(defaultServer), "The websocket URL of the Kyutai STT server.")
+	cmd.Flags().StringVar(&opts.voice, "voice", g.cfg.VoiceOr(defaultVoice), "The voice of the synthesis check.")
+	cmd.Flags().StringVar(&opts.wav, "wav", "", "Transcribe this audio file (wav or ogg) instead of the synthesized audio.")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 30*time.Second, "Maximum duration of the checks of each server.")
+	_ = cmd.RegisterFlagCompletionFunc("voice", completeVoices)
+	_ = cmd.MarkFlagFilename("wav", "wav", "ogg", "oga")
+	return cmd
+}
+
+func runDoctor(ctx context.Context, g *globals, opts doctorOptions) (err error) {
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	var sample []float32
+	if opts.wav != "" {
+		if sample, err = audio.ReadFile(opts.wav); err != nil {
+			return
+		}
+	}
+	report := newDoctorReport(os.Stdout)
+	if opts.ttsServer != "" {
+		tts := &ttsDoctor{server: opts.ttsServer, apiKey: apiKey, voice: opts.voice}
+		serverCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+		report.sequence(serverCtx, "TTS", tts.steps())
+		cancel()
+		if sample == nil {
+			sample = tts.audio
+		}
+	}
+	if opts.sttServer != "" {
+		speech := true
+		if sample == nil {
+			sample, speech = embeddedSample()
+		}
+		stt := &sttDoctor{server: opts.sttServer, apiKey: apiKey, sample: sample, speech: speech}
+		serverCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+		report.sequence(serverCtx, "STT", stt.steps())
+		cancel()
+	}
+	return report.summary()
+}
+
+// doctorStep is a check, its detail is printed next to its result.
+type doctorStep struct {
+	name string
+	run  func(ctx context.Context) (detail string, err error)
+}
+
+// doctorReport prints the checks results as they come.
+type doctorReport struct {
+	out     io.Writer
+	passed  int
+	failed  int
+	skipped int
+}
+
+func newDoctorReport(w io.Writer) *doctorReport {
+	return &doctorReport{out: w}
+}
+
+// sequence runs the steps in order, the ones following a failure are skipped.
+func (dr *doctorReport) sequence(ctx context.Context, server string, steps []doctorStep) {
+	failed := false
+	for _, step := range steps {
+		name := server + " " + step.name
+		if failed {
+			fmt.Fprintf(dr.out, "SKIP  %-22s  previous check failed\n", name)
+			dr.skipped++
+			continue
+		}
+		start := time.Now()
+		detail, err := step.run(ctx)
+		took := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(dr.out, "FAIL  %-22s  %s (%s)\n", name, err, took)
+			dr.failed++
+			failed = true
+		} else {
+			fmt.Fprintf(dr.out, "PASS  %-22s  %s (%s)\n", name, detail, took)
+			dr.passed++
+		}
+	}
+}
+
+func (dr *doctorReport) summary() error {
+	fmt.Fprintf(dr.out, "\n%d passed, %d failed, %d skipped\n", dr.passed, dr.failed, dr.skipped)
+	if dr.failed > 0 {
+		return fmt.Errorf("%d check(s) failed", dr.failed)
+	}
+	return nil
+}
+
+// networkSteps checks the name resolution and the transport of a server URL.
+func networkSteps(server string) []doctorStep {
+	var (
+		target *url.URL
+		host   string
+		port   string
+	)
+	return []doctorStep{
+		{"DNS", func(ctx context.Context) (detail string, err error) {
+			if target, err = url.Parse(server); err != nil {
+				return "", fmt.Errorf("invalid server URL: %w", err)
+			}
+			if target.Scheme != "ws" && target.Scheme != "wss" {
+				return "", fmt.Errorf("invalid server URL scheme %q: must be ws or wss", target.Scheme)
+			}
+			host, port = target.Hostname(), target.Port()
+			if port == "" {
+				port = map[string]string{"ws": "80", "wss": "443"}[target.Scheme]
+			}
+			if net.ParseIP(host) != nil {
+				return host + " (IP address)", nil
+			}
+			addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+			}
+			return host + " → " + strings.Join(addresses, ", "), nil
+		}},
+		{"TCP/TLS", func(ctx context.Context) (detail string, err error) {
+			address := net.JoinHostPort(host, port)
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return "", fmt.Errorf("failed to connect to %s: %w", address, err)
+			}
+			defer conn.Close()
+			if target.Scheme == "ws" {
+				return address + " (plain ws, no TLS)", nil
+			}
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				return "", fmt.Errorf("TLS handshake failed: %w", err)
+			}
+			state := tlsConn.ConnectionState()
+			expiry := state.PeerCertificates[0].NotAfter
+			detail = fmt.Sprintf("%s, certificate valid until %s", tls.VersionName(state.Version), expiry.Format(time.DateOnly))
+			if days := time.Until(expiry).Hours() / 24; days < 14 {
+				detail += fmt.Sprintf(" (expires in %.0f days!)", days)
+			}
+			return
+		}},
+	}
+}
+
+// authError explains a failed connection.
+func authError(err error) error {
+	if errors.Is(err, krs.ErrUnauthorized) {
+		return errors.New("the API key was rejected: check the configured API key or the KYUTAI_TTS_APIKEY environment variable")
+	}
+	return err
+}
+
+// waitReady returns when the connection received the Ready frame.
+func waitReady(ctx context.Context, events <-chan krs.StateEvent) (at time.Time, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return at, fmt.Errorf("no Ready frame: %w", ctx.Err())
+		case event, open := <-events:
+			switch {
+			case !open:
+				return at, errors.New("the connection ended before the Ready frame")
+			case event.State == krs.ConnFailed:
+				return at, fmt.Errorf("the connection failed before the Ready frame: %w", event.Err)
+			case event.State == krs.ConnReady:
+				return event.At, nil
+			}
+		}
+	}
+}
+
+// checkSampleRate verifies the sample rate advertised by the server, if any.
+func checkSampleRate(info krs.ReadyInfo) (detail string, err error) {
+	switch info.SampleRate {
+	case 0:
+		return fmt.Sprintf("not advertised by the server, assuming %d Hz", krs.SampleRate), nil
+	case krs.SampleRate:
+		return fmt.Sprintf("%d Hz", info.SampleRate), nil
+	default:
+		return "", fmt.Errorf("the server uses %d Hz, the library expects %d Hz", info.SampleRate, krs.SampleRate)
+	}
+}
+
+type ttsDoctor struct {
+	server string
+	apiKey string
+	voice  string
+	client *krs.TTSClient
+	conn   *krs.TTSConnection
+	events <-chan krs.StateEvent
+	start  time.Time
+	// synthesized by the synthesis step
+	audio []float32
+}
+
+func (td *ttsDoctor) steps() []doctorStep {
+	return append(networkSteps(td.server),
+		doctorStep{"authentication", td.connect},
+		doctorStep{"Ready latency", td.ready},
+		doctorStep{"synthesis", td.synthesize},
+		doctorStep{"sample rate", td.sampleRate},
+	)
+}
+
+func (td *ttsDoctor) connect(ctx context.Context) (detail string, err error) {
+	if td.client, err = krs.NewTTSClient(&krs.TTSConfig{URL: td.server, APIKey: td.apiKey, Voice: td.voice, Retry: &krs.RetryPolicy{}}); err != nil {
+		return
+	}
+	td.start = time.Now()
+	if td.conn, err = td.client.Connect(ctx); err != nil {
+		return "", authError(err)
+	}
+	td.events = td.conn.Subscribe()
+	return fmt.Sprintf("connected in %s", time.Since(td.start).Round(time.Millisecond)), nil
+}
+
+func (td *ttsDoctor) ready(ctx context.Context) (detail string, err error) {
+	at, err := waitReady(ctx, td.events)
+	if err != nil {
+		_ = td.conn.Close()
+		return
+	}
+	return fmt.Sprintf("%s after the connection start", at.Sub(td.start).Round(time.Millisecond)), nil
+}
+
+func (td *ttsDoctor) synthesize(ctx context.Context) (detail string, err error) {
+	defer td.conn.Close()
+	connCtx := td.conn.GetContext()
+	go streamText(connCtx, td.conn.GetWriteChan(), testassets.LoadText("greeting"))
+	sent := time.Now()
+	var firstAudio time.Duration
+	receiver := td.conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("synthesis not finished: %w", ctx.Err())
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if pcm, ok := msg.(krs.MessagePackAudio); ok {
+				if td.audio == nil {
+					firstAudio = time.Since(sent)
+				}
+				td.audio = append(td.audio, pcm.PCM...)
+			}
+		}
+	}
+	if err = td.conn.Done(); err != nil {
+		return
+	}
+	if len(td.audio) == 0 {
+		return "", errors.New("no audio received")
+	}
+	return fmt.Sprintf("%s of audio, first audio after %s, realtime factor %.2f",
+		(time.Duration(len(td.audio)) * time.Second / krs.SampleRate).Round(time.Millisecond),
+		firstAudio.Round(time.Millisecond), td.conn.Stats().RealtimeFactor(),
+	), nil
+}
+
+func (td *ttsDoctor) sampleRate(ctx context.Context) (detail string, err error) {
+	info, _ := td.conn.ReadyInfo()
+	if detail, err = checkSampleRate(info); err != nil {
+		return
+	}
+	// the samples must be normalized floats
+	var peak float64
+	for _, sample := range td.audio {
+		if math.IsNaN(float64(sample)) || math.IsInf(float64(sample), 0) {
+			return "", errors.New("the audio contains invalid samples (NaN or infinite)")
+		}
+		peak = max(peak, math.Abs(float64(sample)))
+	}
+	switch {
+	case peak == 0:
+		return "", errors.New("the synthesized audio is silent")
+	case peak > 1:
+		return "", fmt.Errorf("the synthesized audio is not normalized (peak %.2f)", peak)
+	}
+	return fmt.Sprintf("%s, audio peak %.2f", detail, peak), nil
+}
+
+// embeddedSample returns an embedded speech clip, or silence if there is none.
+func embeddedSample() (sample []float32, speech bool) {
+	for _, clip := range testassets.Clips() {
+		if clip.Speech() {
+			if pcm, err := clip.PCM(); err == nil {
+				return pcm, true
+			}
+		}
+	}
+	return testassets.MustPCM("silence"), false
+}
+
+// streamText sends the text word by word then ends the stream.
+func streamText(ctx context.Context, sender chan<- string, text string) {
+	defer close(sender)
+	for word := range strings.FieldsSeq(text) {
+		select {
+		case <-ctx.Done():
+			return
+		case sender <- word:
+		}
+	}
+}
+
+type sttDoctor struct {
+	server string
+	apiKey string
+	// sample is transcribed, its transcript is only checked for speech
+	sample []float32
+	speech bool
+	client *krs.STTClient
+	conn   *krs.STTConnection
+	events <-chan krs.StateEvent
+	start  time.Time
+}
+
+func (sd *sttDoctor) steps() []doctorStep {
+	return append(networkSteps(sd.server),
+		doctorStep{"authentication", sd.connect},
+		doctorStep{"Ready latency", sd.ready},
+		doctorStep{"transcription", sd.transcribe},
+		doctorStep{"sample rate", sd.sampleRate},
+	)
+}
+
+func (sd *sttDoctor) connect(ctx context.Context) (detail string, err error) {
+	if sd.client, err = krs.NewSTTClient(&krs.STTConfig{URL: sd.server, APIKey: sd.apiKey, Retry: &krs.RetryPolicy{}}); err != nil {
+		return
+	}
+	sd.start = time.Now()
+	if sd.conn, err = sd.client.Connect(ctx); err != nil {
+		return "", authError(err)
+	}
+	sd.events = sd.conn.Subscribe()
+	return fmt.Sprintf("connected in %s", time.Since(sd.start).Round(time.Millisecond)), nil
+}
+
+func (sd *sttDoctor) ready(ctx context.Context) (detail string, err error) {
+	at, err := waitReady(ctx, sd.events)
+	if err != nil {
+		_ = sd.conn.Close()
+		return
+	}
+	return fmt.Sprintf("%s after the connection start", at.Sub(sd.start).Round(time.Millisecond)), nil
+}
+
+func (sd *sttDoctor) transcribe(ctx context.Context) (detail string, err error) {
+	defer sd.conn.Close()
+	connCtx := sd.conn.GetContext()
+	go func() {
+		sender := sd.conn.GetWriteChan()
+		defer close(sender)
+		for chunk := range slices.Chunk(sd.sample, krs.FrameSize) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- chunk:
+			}
+		}
+	}()
+	start := time.Now()
+	var words []string
+	receiver := sd.conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("transcription not finished: %w", ctx.Err())
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if word, ok := msg.(krs.MessagePackWord); ok {
+				words = append(words, word.Text)
+			}
+		}
+	}
+	if err = sd.conn.Done(); err != nil {
+		return
+	}
+	took := time.Since(start).Round(time.Millisecond)
+	if !sd.speech {
+		return fmt.Sprintf("silence transcribed in %s (no speech sample: the transcript is not checked)", took), nil
+	}
+	if len(words) == 0 {
+		return "", errors.New("no word transcribed from the speech sample")
+	}
+	transcript := []rune(strings.Join(words, " "))
+	if len(transcript) > 60 {
+		transcript = append(transcript[:57], []rune("...")...)
+	}
+	return fmt.Sprintf("%q in %s", string(transcript), took), nil
+}
+
+func (sd *sttDoctor) sampleRate(ctx context.Context) (detail string, err error) {
+	info, _ := sd.conn.ReadyInfo()
+	return checkSampleRate(info)
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	// audio played around a word, to hear it in context
+	editPlayMargin = 150 * time.Millisecond
+	// duration played for a word without end time and followed by nothing
+	editDefaultWord = 500 * time.Millisecond
+)
+
+type editOptions struct {
+	audio  string
+	player string
+	offset time.Duration
+	output string
+	srt    string
+}
+
+func newEditCommand(g *globals) *cobra.Command {
+	var opts editOptions
+	cmd := &cobra.Command{
+		Use:   "edit <transcript.json|session.krs>",
+		Short: "Correct a transcript in the terminal, listening to each word",
+		Long: `Correct a transcript in the terminal, listening to each word.
+
+The transcript is loaded from its JSON export (krs stt --json) or from a session bundle (.krs,
+saved back with the corrected transcript), which also holds its audio. The audio of the word
+under the cursor is played by the --player command when the transcribed file is given with
+--audio. The corrected words keep their timings: a word replaced by several ones shares its
+time span, an emptied word is removed.
+
+Keys:
+  arrows, h j k l  move between the words and the utterances
+  space            play the word          u  play the utterance
+  enter, e         edit the word          d  delete the word
+  w                save                   q  quit`,
+		Example: `  krs stt --input call.wav --json call.json
+  krs edit call.json --audio call.wav --srt call.srt`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEdit(opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.audio, "audio", "", "Audio file (wav or ogg) the transcript comes from, to listen to the words.")
+	cmd.Flags().StringVar(&opts.player, "player", defaultPlayer, "Command playing the raw audio samples read on its standard input.")
+	cmd.Flags().DurationVar(&opts.offset, "offset", krs.STTStreamOffset, "Stream time of the start of the audio file: the library sends a second of silence before the audio.")
+	cmd.Flags().StringVar(&opts.output, "output", "", "Write the corrected transcript JSON to this file instead of the loaded one.")
+	cmd.Flags().StringVar(&opts.srt, "srt", "", "Also write the corrected transcript as SubRip subtitles to this file on save.")
+	_ = cmd.MarkFlagFilename("audio", "wav", "ogg", "oga")
+	_ = cmd.MarkFlagFilename("output", "json")
+	_ = cmd.MarkFlagFilename("srt", "srt")
+	return cmd
+}
+
+func runEdit(opts editOptions, filename string) (err error) {
+	// Load the transcript and its audio
+	editor := &transcriptEditor{
+		player: opts.player,
+		offset: opts.offset,
+		output: opts.output,
+		srt:    opts.srt,
+	}
+	if strings.HasSuffix(filename, krs.BundleExtension) {
+		var bundle krs.Bundle
+		if bundle, err = krs.OpenBundle(filename); err != nil {
+			return
+		}
+		editor.bundle = &bundle
+		editor.transcript = bundle.Transcript
+		editor.pcm = bundle.Channel(krs.SessionUserChannel)
+		editor.offset = bundle.Metadata.TranscriptOffset
+	} else if editor.transcript, err = readTranscriptJSON(filename); err != nil {
+		return
+	}
+	if editor.output == "" {
+		editor.output = filename
+	}
+	editor.dropEmpty()
+	if len(editor.transcript.Utterances) == 0 {
+		return errors.New("the transcript has no words")
+	}
+	if opts.audio != "" {
+		if editor.pcm, err = audio.ReadFile(opts.audio); err != nil {
+			return fmt.Errorf("failed to read audio samples from %q: %w", opts.audio, err)
+		}
+	}
+
+	// Take over the terminal
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("the editor needs a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set the terminal in raw mode: %w", err)
+	}
+	defer func() {
+		editor.stopPlayback()
+		// clear the screen and show the cursor back
+		fmt.Fprint(os.Stdout, "\x1b[2J\x1b[H\x1b[?25h")
+		_ = term.Restore(fd, state)
+	}()
+	editor.in = bufio.NewReader(os.Stdin)
+	editor.out = os.Stdout
+	return editor.run()
+}
+
+// transcriptEditor is the state of the editor, the terminal is in raw mode.
+type transcriptEditor struct {
+	transcript krs.Transcript
+	// loaded from a session bundle
+	bundle *krs.Bundle
+	pcm    []float32
+	player string
+	offset time.Duration
+	output string
+	srt    string
+	in     *bufio.Reader
+	out    io.Writer
+	// cursor
+	utterance int
+	word      int
+	// status line
+	status   string
+	modified bool
+	quitting bool
+	playing  *exec.Cmd
+}
+
+// the keys the editor handles besides the printable characters
+const (
+	keyEnter     = "\r"
+	keyEscape    = "\x1b"
+	keyBackspace = "\x7f"
+	keyCtrlC     = "\x03"
+	keyUp        = "\x1b[A"
+	keyDown      = "\x1b[B"
+	keyRight     = "\x1b[C"
+	keyLeft      = "\x1b[D"
+	keyDelete    = "\x1b[3~"
+)
+
+func (te *transcriptEditor) run() (err error) {
+	for {
+		te.render(false, "")
+		var key string
+		if key, err = te.readKey(); err != nil {
+			return
+		}
+		quitting := te.quitting
+		te.quitting = false
+		te.status = ""
+		switch key {
+		case keyLeft, "h":
+			te.move(-1)
+		case keyRight, "l":
+			te.move(1)
+		case keyUp, "k":
+			te.moveUtterance(-1)
+		case keyDown, "j":
+			te.moveUtterance(1)
+		case " ":
+			te.playWord()
+		case "u":
+			te.playUtterance()
+		case keyEnter, "e":
+			if err = te.edit(); err != nil {
+				return
+			}
+		case "d", keyDelete:
+			te.replace("")
+		case "w":
+			te.save()
+		case "q", keyCtrlC:
+			if !te.modified || quitting {
+				return
+			}
+			te.status = "Unsaved changes: q again to quit without saving, w to save"
+			te.quitting = true
+		}
+	}
+}
+
+// readKey returns a key press: a character or an escape sequence.
+func (te *transcriptEditor) readKey() (key string, err error) {
+	r, _, err := te.in.ReadRune()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the keyboard: %w", err)
+	}
+	if r != '\x1b' || te.in.Buffered() == 0 {
+		return string(r), nil
+	}
+	// an escape sequence comes in a single read
+	sequence := []byte{'\x1b'}
+	for te.in.Buffered() > 0 {
+		b, _ := te.in.ReadByte()
+		sequence = append(sequence, b)
+		if len(sequence) > 2 && (b >= 'A' && b <= 'Z' || b == '~') {
+			break
+		}
+	}
+	return string(sequence), nil
+}
+
+func (te *transcriptEditor) current() *krs.Word {
+	return &te.transcript.Utterances[te.utterance].Words[te.word]
+}
+
+func (te *transcriptEditor) move(step int) {
+	te.word += step
+	switch words := te.transcript.Utterances[te.utterance].Words; {
+	case te.word < 0 && te.utterance > 0:
+		te.utterance--
+		te.word = len(te.transcript.Utterances[te.utterance].Words) - 1
+	case te.word < 0:
+		te.word = 0
+	case te.word >= len(words) && te.utterance < len(te.transcript.Utterances)-1:
+		te.utterance++
+		te.word = 0
+	case te.word >= len(words):
+		te.word = len(words) - 1
+	}
+}
+
+func (te *transcriptEditor) moveUtterance(step int) {
+	te.utterance = min(max(te.utterance+step, 0), len(te.transcript.Utterances)-1)
+	te.word = min(te.word, len(te.transcript.Utterances[te.utterance].Words)-1)
+}
+
+// edit prompts for the new text of the word under the cursor.
+func (te *transcriptEditor) edit() (err error) {
+	text := te.current().Text
+	for {
+		te.render(true, text)
+		var key string
+		if key, err = te.readKey(); err != nil {
+			return
+		}
+		switch key {
+		case keyEnter:
+			te.replace(text)
+			return
+		case keyEscape, keyCtrlC:
+			return
+		case keyBackspace, "\b":
+			if _, size := utf8.DecodeLastRuneInString(text); size > 0 {
+				text = text[:len(text)-size]
+			}
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); len(key) == utf8.RuneLen(r) && r >= ' ' {
+				text += key
+			}
+		}
+	}
+}
+
+// replace sets the text of the word under the cursor: the words of the text share its time span,
+// no words removes it.
+func (te *transcriptEditor) replace(text string) {
+	current := *te.current()
+	utterance := &te.transcript.Utterances[te.utterance]
+	fields := strings.Fields(text)
+	switch {
+	case len(fields) == 1 && fields[0] == current.Text:
+		return
+	case len(fields) == 0 && len(te.transcript.Utterances) == 1 && len(utterance.Words) == 1:
+		te.status = "The last word can not be deleted"
+		return
+	}
+	start, end := current.Start, max(current.End, current.Start)
+	step := (end - start) / time.Duration(max(len(fields), 1))
+	replacement := make([]krs.Word, len(fields))
+	for i, field := range fields {
+		replacement[i] = krs.Word{
+			Text:  field,
+			Start: start + time.Duration(i)*step,
+			End:   start + time.Duration(i+1)*step,
+		}
+	}
+	if current.End == 0 && len(replacement) > 0 {
+		// keep the words without end time as they were
+		replacement[len(replacement)-1].End = 0
+	}
+	words := append(append(utterance.Words[:te.word:te.word], replacement...), utterance.Words[te.word+1:]...)
+	utterance.Words = words
+	te.modified = true
+	// keep the cursor on a word
+	te.dropEmpty()
+	te.utterance = min(te.utterance, len(te.transcript.Utterances)-1)
+	te.word = min(te.word, len(te.transcript.Utterances[te.utterance].Words)-1)
+}
+
+// dropEmpty removes the utterances without words.
+func (te *transcriptEditor) dropEmpty() {
+	utterances := te.transcript.Utterances[:0]
+	for _, utterance := range te.transcript.Utterances {
+		if len(utterance.Words) > 0 {
+			utterances = append(utterances, utterance)
+		}
+	}
+	te.transcript.Utterances = utterances
+}
+
+func (te *transcriptEditor) save() {
+	var err error
+	if te.bundle != nil && strings.HasSuffix(te.output, krs.BundleExtension) {
+		te.bundle.Transcript = te.transcript
+		err = te.bundle.WriteFile(te.output)
+	} else {
+		err = writeTranscriptJSON(te.output, te.transcript)
+	}
+	if err == nil && te.srt != "" {
+		err = writeSRT(te.srt, te.transcript)
+	}
+	if err != nil {
+		te.status = "Save failed: " + err.Error()
+		return
+	}
+	te.modified = false
+	te.status = fmt.Sprintf("Saved to %q", te.output)
+	if te.srt != "" {
+		te.status += fmt.Sprintf(" and %q", te.srt)
+	}
+}
+
+// wordEnd returns the end of a word, its start if it has no end time.
+func (te *transcriptEditor) wordEnd(utterance, word int) time.Duration {
+	words := te.transcript.Utterances[utterance].Words
+	if current := words[word]; current.End > current.Start {
+		return current.End
+	}
+	if word+1 < len(words) {
+		return words[word+1].Start
+	}
+	return words[word].Start + editDefaultWord
+}
+
+func (te *transcriptEditor) playWord() {
+	te.play(te.current().Start, te.wordEnd(te.utterance, te.word))
+}
+
+func (te *transcriptEditor) playUtterance() {
+	words := te.transcript.Utterances[te.utterance].Words
+	te.play(words[0].Start, te.wordEnd(te.utterance, len(words)-1))
+}
+
+// play plays a segment of the audio (stream times), stopping the one playing.
+func (te *transcriptEditor) play(start, end time.Duration) {
+	if te.pcm == nil {
+		te.status = "No audio loaded: use --audio"
+		return
+	}
+	te.stopPlayback()
+	toSample := func(d time.Duration) int {
+		return min(max(int((d-te.offset)*krs.SampleRate/time.Second), 0), len(te.pcm))
+	}
+	segment := te.pcm[toSample(start-editPlayMargin):toSample(end+editPlayMargin)]
+	if len(segment) == 0 {
+		te.status = "The word is out of the audio: check --offset"
+		return
+	}
+	sink, err := startPlayer(te.player)
+	if err != nil {
+		te.status = "Playback failed: " + err.Error()
+		return
+	}
+	sink.cmd.Stderr = nil
+	te.playing = sink.cmd
+	go func() {
+		_ = sink.WritePCM(segment)
+		_ = sink.Close()
+	}()
+}
+
+func (te *transcriptEditor) stopPlayback() {
+	if te.playing != nil && te.playing.Process != nil {
+		_ = te.playing.Process.Kill()
+	}
+	te.playing = nil
+}
+
+// render draws the utterances around the cursor, the status line and the edition prompt while
+// editing.
+func (te *transcriptEditor) render(editing bool, prompt string) {
+	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil || width < 20 || height < 5 {
+		width, height = 80, 24
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[?25l\x1b[2J\x1b[H")
+	current := te.current()
+	modified := ""
+	if te.modified {
+		modified = " (modified)"
+	}
+	fmt.Fprintf(&b, "\x1b[1m%s%s\x1b[0m  word %s-%s\r\n\r\n", te.output, modified,
+		formatStreamTime(current.Start), formatStreamTime(te.wordEnd(te.utterance, te.word)))
+	// wrap the utterances, starting a bit before the current one
+	var (
+		lines     []string
+		cursorRow int
+	)
+	for u := max(te.utterance-3, 0); u < len(te.transcript.Utterances) && len(lines) < 3*height; u++ {
+		line := formatStreamTime(te.transcript.Utterances[u].Start()) + " "
+		lineWidth := utf8.RuneCountInString(line)
+		for w, word := range te.transcript.Utterances[u].Words {
+			text := word.Text
+			if text == "" {
+				text = "_"
+			}
+			textWidth := utf8.RuneCountInString(text) + 1
+			if lineWidth+textWidth > width && lineWidth > 10 {
+				lines = append(lines, line)
+				line, lineWidth = strings.Repeat(" ", 10), 10
+			}
+			if u == te.utterance && w == te.word {
+				cursorRow = len(lines)
+				text = "\x1b[7m" + text + "\x1b[0m"
+			}
+			line += " " + text
+			lineWidth += textWidth
+		}
+		lines = append(lines, line)
+	}
+	rows := height - 5
+	first := max(min(cursorRow-rows/3, len(lines)-rows), 0)
+	for _, line := range lines[first:min(first+rows, len(lines))] {
+		b.WriteString(line + "\r\n")
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H", height-1)
+	switch {
+	case editing:
+		b.WriteString("\x1b[2menter confirm  esc cancel  (spaces split the word, empty deletes it)\x1b[0m")
+	case te.status == "":
+		b.WriteString("\x1b[2mspace play  u utterance  enter edit  d delete  w save  q quit\x1b[0m")
+	default:
+		b.WriteString(te.status)
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H", height)
+	if editing {
+		fmt.Fprintf(&b, "Edit: %s\x1b[?25h", prompt)
+	}
+	_, _ = io.WriteString(te.out, b.String())
+}
+
+// formatStreamTime renders a stream time as minutes:seconds.tenths.
+func formatStreamTime(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d.%d", int(d.Minutes()), int(d.Seconds())%60, d.Milliseconds()%1000/100)
+}
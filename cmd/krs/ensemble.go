@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+type ensembleOptions struct {
+	servers []string
+	weights []float64
+	window  time.Duration
+	json    string
+	srt     string
+}
+
+func newEnsembleCommand(g *globals) *cobra.Command {
+	var opts ensembleOptions
+	cmd := &cobra.Command{
+		Use:   "ensemble <audio>",
+		Short: "Transcribe an audio file with several STT servers voting on the words (experimental)",
+		Long: `Transcribe an audio file with several STT servers voting on the words (experimental).
+
+The audio is transcribed by every --server at once, for example servers running different model
+sizes, and their transcripts are merged ROVER style: the words are aligned on their times (within
+--window) and text, and each server votes for its word of each position, or for no word, with its
+--weight (1 by default, in the order of the servers). The words winning the vote make the
+transcript, with the share of the weight they got as their confidence (in the JSON transcript).
+Ties go to the heaviest server: use three servers or more, or different weights.
+
+It trades compute for accuracy on critical transcriptions. How much each server differs from the
+vote is reported.`,
+		Example: `  krs ensemble call.wav --server wss://stt-large.example.com --server wss://stt-medium.example.com \
+    --server wss://stt-small.example.com --weight 2,1,1 --json call.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEnsemble(g, opts, args[0])
+		},
+	}
+	cmd.Flags().StringArrayVar(&opts.servers, "server", nil, "The websocket URL of a Kyutai STT server of the ensemble (repeatable, at least two).")
+	cmd.Flags().Float64SliceVar(&opts.weights, "weight", nil, "Weight of the vote of each server, in the order of --server (default 1 each).")
+	cmd.Flags().DurationVar(&opts.window, "window", krs.DefaultEnsembleWindow, "Largest distance between the starts of the words of two servers voting together.")
+	cmd.Flags().StringVar(&opts.json, "json", "", "Write the transcript as JSON (with the word timings and confidences) to this file.")
+	cmd.Flags().StringVar(&opts.srt, "srt", "", "Write the transcript as SubRip subtitles to this file.")
+	_ = cmd.MarkFlagRequired("server")
+	_ = cmd.MarkFlagFilename("json", "json")
+	_ = cmd.MarkFlagFilename("srt", "srt")
+	return cmd
+}
+
+func runEnsemble(g *globals, opts ensembleOptions, filename string) (err error) {
+	if len(opts.servers) < 2 {
+		return errors.New("an ensemble takes at least two servers")
+	}
+	if len(opts.weights) > 0 && len(opts.weights) != len(opts.servers) {
+		return fmt.Errorf("got %d weights for %d servers", len(opts.weights), len(opts.servers))
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	members := make([]krs.EnsembleMember, len(opts.servers))
+	for i, server := range opts.servers {
+		if members[i].Client, err = krs.NewSTTClient(&krs.STTConfig{
+			URL:    server,
+			APIKey: apiKey,
+			Tags:   g.tags,
+		}); err != nil {
+			return
+		}
+		if len(opts.weights) > 0 {
+			if opts.weights[i] <= 0 {
+				return fmt.Errorf("the weight of %s must be positive", server)
+			}
+			members[i].Weight = opts.weights[i]
+		}
+	}
+	pcm, err := audio.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read audio samples from %q: %w", filename, err)
+	}
+	_, abortCtx, stop := interruptible(nil)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Transcribing with %d servers...\n", len(members))
+	transcript, transcripts, err := krs.TranscribeEnsemble(abortCtx, members, pcm, krs.EnsembleConfig{Window: opts.window})
+	if err != nil {
+		return
+	}
+	text := transcript.Text()
+	for i, server := range opts.servers {
+		fmt.Fprintf(os.Stderr, "%s: differs from the vote on %.1f%% of the words\n",
+			server, 100*krs.WordErrorRate(transcripts[i].Diff(text)))
+	}
+	fmt.Println(text)
+	if opts.json != "" {
+		if err = writeTranscriptJSON(opts.json, transcript); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Transcript written to %q\n", opts.json)
+	}
+	if opts.srt != "" {
+		if err = writeSRT(opts.srt, transcript); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Subtitles written to %q\n", opts.srt)
+	}
+	return
+}
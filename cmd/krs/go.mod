@@ -1,21 +1,31 @@
-module github.com/hekmon/kyutai-rs/clients/stt
+module github.com/hekmon/kyutai-rs/cmd/krs
 
 go 1.25.4
 
 replace github.com/hekmon/kyutai-rs => ../..
 
 require (
+	github.com/coder/websocket v1.8.14
+	github.com/go-audio/audio v1.0.0
+	github.com/go-audio/transforms v0.0.0-20180121090939-51830ccc35a5
 	github.com/go-audio/wav v1.1.0
 	github.com/hekmon/kyutai-rs v1.0.0
 	github.com/hekmon/liveprogress/v2 v2.1.0
+	github.com/jfreymuth/oggvorbis v1.0.5
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/spf13/cobra v1.10.2
+	golang.org/x/sync v0.18.0
+	golang.org/x/term v0.24.0
+	golang.org/x/time v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
-	github.com/coder/websocket v1.8.14 // indirect
-	github.com/go-audio/audio v1.0.0 // indirect
 	github.com/go-audio/riff v1.0.0 // indirect
 	github.com/hekmon/liveterm/v2 v2.5.0 // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/jfreymuth/vorbis v1.0.2 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
@@ -23,7 +33,7 @@ require (
 	github.com/muesli/termenv v0.15.2 // indirect
 	github.com/philhofer/fwd v1.2.0 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
+	github.com/spf13/pflag v1.0.9 // indirect
 	github.com/tinylib/msgp v1.5.0 // indirect
-	golang.org/x/sync v0.18.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 )
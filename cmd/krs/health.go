@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// healthzPath is the liveness probe of the proxy: it answers as long as the proxy serves
+	healthzPath = "/healthz"
+	// readyzPath is the readiness probe of the proxy: it fails while an upstream server is unreachable
+	readyzPath = "/readyz"
+	// time budget of the connection to each upstream server by the readiness probe
+	readinessTimeout = 2 * time.Second
+	// deadlineHeader is the time left to a request set by the Envoy based service meshes (Istio...)
+	deadlineHeader = "x-envoy-expected-rq-timeout-ms"
+)
+
+// health serves the probes of the orchestrators and the service meshes.
+func (p *proxy) health(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == healthzPath {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	// The upstream servers are only reached over TCP: a websocket handshake would start a session
+	// on the model servers
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	var (
+		wg          sync.WaitGroup
+		mutex       sync.Mutex
+		unreachable []string
+	)
+	for _, route := range p.routes.all {
+		wg.Go(func() {
+			if err := dialUpstream(ctx, route); err != nil {
+				mutex.Lock()
+				unreachable = append(unreachable, fmt.Sprintf("%s: %s", route.Name, err))
+				mutex.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if len(unreachable) > 0 {
+		http.Error(w, strings.Join(unreachable, "\n"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// dialUpstream checks that the upstream server of a route accepts TCP connections.
+func dialUpstream(ctx context.Context, route *proxyRoute) (err error) {
+	address := route.upstreamURL.Host
+	if route.upstreamURL.Port() == "" {
+		port := "80"
+		if route.upstreamURL.Scheme == "wss" || route.upstreamURL.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(route.upstreamURL.Hostname(), port)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return
+	}
+	return conn.Close()
+}
+
+// requestDeadline returns the deadline the service mesh set to a request, if any: the session is
+// ended when it is reached, instead of being cut by the mesh with the model server unaware.
+func requestDeadline(r *http.Request) (deadline time.Time, set bool) {
+	ms, err := strconv.ParseInt(r.Header.Get(deadlineHeader), 10, 64)
+	if err != nil || ms <= 0 {
+		return
+	}
+	return time.Now().Add(time.Duration(ms) * time.Millisecond), true
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+type importOptions struct {
+	server string
+	format string
+	audio  string
+	output string
+}
+
+func newImportCommand(g *globals) *cobra.Command {
+	var opts importOptions
+	cmd := &cobra.Command{
+		Use:   "import <transcript>",
+		Short: "Import a transcript made by another tool, aligned against its audio",
+		Long: `Import a transcript made by another tool, aligned against its audio.
+
+The transcript is an OpenAI Whisper JSON (--format whisper, the default for .json files) or plain
+text with one utterance per line (--format text). With --audio, the audio is transcribed by the
+STT server and the imported text is merged onto the result: the words recognized take the Kyutai
+timings, the others are spread between them. Whisper transcripts keep their own timings without
+--audio, plain text needs it.
+
+The result is written as a krs JSON transcript, for the other commands (edit, clip, chapters,
+search...).`,
+		Example: `  krs import archive/call.whisper.json --output call.json
+  krs import call.txt --audio call.wav --output call.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImport(cmd, g, opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.STTURL(defaultServer), "The websocket URL of the Kyutai STT server aligning the text.")
+	cmd.Flags().StringVar(&opts.format, "format", "", "Format of the imported transcript: whisper or text (defaults to whisper for .json files, text otherwise).")
+	cmd.Flags().StringVar(&opts.audio, "audio", "", "Audio file (wav or ogg) the transcript comes from, to align the words against it.")
+	cmd.Flags().StringVar(&opts.output, "output", "transcript.json", "JSON transcript file to write.")
+	_ = cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"whisper", "text"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.MarkFlagFilename("audio", "wav", "ogg", "oga")
+	_ = cmd.MarkFlagFilename("output", "json")
+	return cmd
+}
+
+func runImport(cmd *cobra.Command, g *globals, opts importOptions, filename string) (err error) {
+	if opts.format == "" {
+		opts.format = "text"
+		if strings.HasSuffix(filename, ".json") {
+			opts.format = "whisper"
+		}
+	}
+	// Load the transcript
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open the transcript: %w", err)
+	}
+	defer file.Close()
+	var transcript krs.Transcript
+	switch opts.format {
+	case "whisper":
+		transcript, err = krs.ImportWhisperJSON(file)
+	case "text":
+		if opts.audio == "" {
+			return errors.New("a plain text transcript has no timings: give its audio with --audio")
+		}
+		transcript, err = krs.ImportText(file)
+	default:
+		return fmt.Errorf("unknown format %q: expected whisper or text", opts.format)
+	}
+	if err != nil {
+		return
+	}
+	if len(transcript.Utterances) == 0 {
+		return errors.New("the transcript has no words")
+	}
+
+	// Align it against its audio
+	if opts.audio != "" {
+		var (
+			apiKey    string
+			sttClient *krs.STTClient
+			pcm       []float32
+		)
+		if apiKey, err = g.cfg.APIKeyValue(); err != nil {
+			return
+		}
+		if sttClient, err = krs.NewSTTClient(&krs.STTConfig{
+			URL:    opts.server,
+			APIKey: apiKey,
+			Tags:   g.tags,
+		}); err != nil {
+			return
+		}
+		if pcm, err = audio.ReadFile(opts.audio); err != nil {
+			return fmt.Errorf("failed to read audio samples from %q: %w", opts.audio, err)
+		}
+		// same as sttClient.Align(), keeping the transcription to report how far it is from the text
+		fmt.Fprintln(os.Stderr, "Transcribing the audio...")
+		var transcribed krs.Transcript
+		if transcribed, err = sttClient.Transcribe(cmd.Context(), pcm); err != nil {
+			return
+		}
+		text := transcript.Text()
+		transcript = transcribed.Merge(text)
+		fmt.Fprintf(os.Stderr, "Word error rate of the transcription against the imported text: %.1f%%\n",
+			100*krs.WordErrorRate(transcribed.Diff(text)))
+	}
+	if err = writeTranscriptJSON(opts.output, transcript); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Transcript written to %q\n", opts.output)
+	return
+}
@@ -0,0 +1,153 @@
+// Package audio provides the audio inputs and outputs shared by the krs commands.
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/transforms"
+	"github.com/go-audio/wav"
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+// ReadRaw reads little endian float32 samples (mono 24kHz) until EOF.
+func ReadRaw(r io.Reader) (samples []float32, err error) {
+	var point float32
+	reader := bufio.NewReader(r)
+	for {
+		if err = binary.Read(reader, binary.LittleEndian, &point); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+				return
+			}
+			err = fmt.Errorf("failed to read binary float32: %w", err)
+			return
+		}
+		samples = append(samples, point)
+	}
+}
+
+// WriteRaw writes samples as little endian float32.
+func WriteRaw(w io.Writer, samples []float32) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, samples); err != nil {
+		err = fmt.Errorf("failed to write binary float32: %w", err)
+		return
+	}
+	return
+}
+
+// WriteS16 writes samples as little endian signed 16 bits integers, in a single write.
+func WriteS16(w io.Writer, samples []float32) (err error) {
+	if _, err = w.Write(krs.AppendInt16LE(nil, samples)); err != nil {
+		err = fmt.Errorf("failed to write s16le samples: %w", err)
+		return
+	}
+	return
+}
+
+// WriteWAV writes the accumulated samples as a 16 bits mono 24kHz wave file.
+func WriteWAV(filename string, samples *krs.PCMAccumulator) (err error) {
+	// Create the file
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %q file: %w", filename, err)
+	}
+	defer file.Close()
+	// Create a standard wave encoder
+	format := &audio.Format{
+		NumChannels: krs.NumChannels,
+		SampleRate:  krs.SampleRate,
+	}
+	waveEncoder := wav.NewEncoder(file, format.SampleRate, 16, format.NumChannels, 1)
+	// Write the samples chunk by chunk as they might have been spilled to disk
+	for chunk, err := range samples.Chunks(krs.SampleRate) {
+		if err != nil {
+			return fmt.Errorf("failed to read samples: %w", err)
+		}
+		audioBuffer := &audio.Float32Buffer{
+			Format: format,
+			Data:   chunk,
+		}
+		// Samples from kyutai TTS are float32 (from -1 to 1)
+		// scale them to a standard bitdepth to allow int export
+		if err = transforms.PCMScaleF32(audioBuffer, 16); err != nil {
+			return fmt.Errorf("failed to scale samples: %w", err)
+		}
+		if err = waveEncoder.Write(audioBuffer.AsIntBuffer()); err != nil {
+			return fmt.Errorf("failed to encode audio sample as wav file: %w", err)
+		}
+	}
+	if err = waveEncoder.Close(); err != nil {
+		return fmt.Errorf("failed to flush wav encoder: %w", err)
+	}
+	return
+}
+
+// Read reads samples from an audio file or from stdin if filename is "-", whatever their container
+// (see Decode): raw float32 unless recognized.
+func Read(filename string) (samples []float32, err error) {
+	if filename == "-" {
+		samples, _, err = Decode(os.Stdin)
+		return
+	}
+	return ReadFile(filename)
+}
+
+// Format describes an audio format supported by the commands.
+type Format struct {
+	Name        string   `json:"name"`
+	Extensions  []string `json:"extensions,omitempty"`
+	Input       bool     `json:"input"`
+	Output      bool     `json:"output"`
+	Description string   `json:"description"`
+}
+
+// Formats returns the audio formats supported as input and output.
+func Formats() []Format {
+	return []Format{
+		{
+			Name:        "wav",
+			Extensions:  []string{".wav"},
+			Input:       true,
+			Output:      true,
+			Description: "Wave file, mono 24kHz (written as 16 bits PCM), other rates and channels are converted when read",
+		},
+		{
+			Name:        "ogg",
+			Extensions:  []string{".ogg", ".oga"},
+			Input:       true,
+			Description: "Ogg Vorbis file, converted to mono 24kHz",
+		},
+		{
+			Name:        "f32le",
+			Input:       true,
+			Output:      true,
+			Description: "Raw little endian float32 samples, mono 24kHz, on stdin or stdout (-): the inputs not recognized as another format",
+		},
+	}
+}
+
+// Device describes an audio endpoint the commands can stream from or to.
+type Device struct {
+	Name        string `json:"name"`
+	Input       bool   `json:"input"`
+	Output      bool   `json:"output"`
+	Description string `json:"description"`
+}
+
+// Devices returns the audio endpoints available besides files.
+func Devices() []Device {
+	return []Device{
+		{
+			Name:        "-",
+			Input:       true,
+			Output:      true,
+			Description: "Standard input and output streams (f32le), to pipe from or to another program",
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-audio/wav"
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// Container is an audio format recognized from the first bytes of a stream.
+type Container string
+
+const (
+	ContainerWAV       Container = "wav"
+	ContainerOggVorbis Container = "ogg/vorbis"
+	ContainerOggOpus   Container = "ogg/opus"
+	ContainerFLAC      Container = "flac"
+	ContainerMP3       Container = "mp3"
+	// ContainerRaw is anything else, read as little endian float32 samples (mono 24kHz)
+	ContainerRaw Container = "f32le"
+)
+
+// bytes needed to tell the containers apart: the first ogg page holds the codec header
+const sniffLength = 64
+
+// Sniff recognizes the container of an audio stream from its first bytes.
+func Sniff(head []byte) Container {
+	switch {
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return ContainerWAV
+	case bytes.HasPrefix(head, []byte("OggS")):
+		if bytes.Contains(head, []byte("OpusHead")) {
+			return ContainerOggOpus
+		}
+		return ContainerOggVorbis
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return ContainerFLAC
+	case bytes.HasPrefix(head, []byte("ID3")),
+		// MPEG audio frame sync, layer III
+		len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 == 0x02:
+		return ContainerMP3
+	default:
+		return ContainerRaw
+	}
+}
+
+// Decode reads a whole audio stream whatever its container (see Sniff), converted to mono 24kHz.
+// FLAC, MP3 and Opus are recognized but not decoded: the error tells how to convert them.
+func Decode(r io.Reader) (samples []float32, container Container, err error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("failed to read the audio: %w", err)
+		return
+	}
+	err = nil
+	container = Sniff(head[:n])
+	stream := io.MultiReader(bytes.NewReader(head[:n]), r)
+	switch container {
+	case ContainerWAV:
+		var data []byte
+		if data, err = io.ReadAll(stream); err != nil {
+			err = fmt.Errorf("failed to read the wav data: %w", err)
+			return
+		}
+		samples, err = decodeWAV(bytes.NewReader(data))
+	case ContainerOggVorbis:
+		var format *oggvorbis.Format
+		if samples, format, err = oggvorbis.ReadAll(stream); err != nil {
+			err = fmt.Errorf("failed to decode the ogg/vorbis audio: %w", err)
+			return
+		}
+		samples = toMono24k(samples, format.Channels, format.SampleRate)
+	case ContainerRaw:
+		samples, err = ReadRaw(stream)
+	default:
+		err = fmt.Errorf("%s audio is not supported, convert it first: ffmpeg -i input -ar %d -ac %d output.wav",
+			container, krs.SampleRate, krs.NumChannels)
+	}
+	return
+}
+
+// ReadFile reads an audio file whatever its container (see Decode).
+func ReadFile(filename string) (samples []float32, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer file.Close()
+	samples, _, err = Decode(file)
+	return
+}
+
+func decodeWAV(r io.ReadSeeker) (samples []float32, err error) {
+	waveDecoder := wav.NewDecoder(r)
+	if !waveDecoder.IsValidFile() {
+		err = errors.New("invalid wav file")
+		return
+	}
+	buffer, err := waveDecoder.FullPCMBuffer()
+	if err != nil {
+		err = fmt.Errorf("failed to extract PCM from wav file: %w", err)
+		return
+	}
+	samples = toMono24k(buffer.AsFloat32Buffer().Data, buffer.Format.NumChannels, buffer.Format.SampleRate)
+	return
+}
+
+// toMono24k averages the channels of interleaved samples and resamples them (linear
+// interpolation) to the rate of the Kyutai servers.
+func toMono24k(samples []float32, channels, rate int) (mono []float32) {
+	if channels > 1 {
+		mono = make([]float32, len(samples)/channels)
+		for i := range mono {
+			var sum float32
+			for _, sample := range samples[i*channels : (i+1)*channels] {
+				sum += sample
+			}
+			mono[i] = sum / float32(channels)
+		}
+	} else {
+		mono = samples
+	}
+	if rate == krs.SampleRate || rate <= 0 || len(mono) == 0 {
+		return
+	}
+	resampled := make([]float32, int(int64(len(mono))*krs.SampleRate/int64(rate)))
+	step := float64(rate) / krs.SampleRate
+	for i := range resampled {
+		position := float64(i) * step
+		index := int(position)
+		if index+1 >= len(mono) {
+			resampled[i] = mono[len(mono)-1]
+			continue
+		}
+		fraction := float32(position - float64(index))
+		resampled[i] = mono[index]*(1-fraction) + mono[index+1]*fraction
+	}
+	return resampled
+}
@@ -0,0 +1,65 @@
+// Package chart renders simple time series charts for the terminal (ASCII) or as PNG images.
+package chart
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+	"time"
+)
+
+// Series is a sequence of values sampled at a regular interval.
+type Series struct {
+	Name  string
+	Unit  string
+	Color color.RGBA
+	// Reference, if not zero, is drawn as an horizontal line (for example the nominal rate)
+	Reference float64
+	Values    []float64
+}
+
+func (s Series) max() (top float64) {
+	top = s.Reference
+	for _, value := range s.Values {
+		top = max(top, value)
+	}
+	if top == 0 {
+		top = 1
+	}
+	return
+}
+
+// WriteASCII draws each series as a bar chart of height rows, one column per value.
+func WriteASCII(w io.Writer, interval time.Duration, height int, series ...Series) (err error) {
+	var b strings.Builder
+	for _, s := range series {
+		top := s.max()
+		fmt.Fprintf(&b, "%s (%s, one column per %s)\n", s.Name, s.Unit, interval)
+		referenceRow := -1
+		if s.Reference > 0 {
+			referenceRow = int(s.Reference / top * float64(height))
+		}
+		for row := height; row > 0; row-- {
+			threshold := top * float64(row) / float64(height)
+			fmt.Fprintf(&b, "%8.2f |", threshold)
+			for _, value := range s.Values {
+				switch {
+				case value >= threshold-top/float64(2*height):
+					b.WriteRune('█')
+				case row == referenceRow:
+					b.WriteRune('-')
+				default:
+					b.WriteRune(' ')
+				}
+			}
+			b.WriteRune('\n')
+		}
+		fmt.Fprintf(&b, "%8s +%s\n", "", strings.Repeat("-", len(s.Values)))
+	}
+	if _, err = io.WriteString(w, b.String()); err != nil {
+		err = fmt.Errorf("failed to write the chart: %w", err)
+		return
+	}
+	return
+}
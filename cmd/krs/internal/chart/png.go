@@ -0,0 +1,67 @@
+//go:build !minimal
+
+package chart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// WritePNG draws the series as lines in stacked panels, the reference lines are drawn in gray.
+func WritePNG(w io.Writer, width, panelHeight int, series ...Series) (err error) {
+	const margin = 10
+	var (
+		img        = image.NewRGBA(image.Rect(0, 0, width, panelHeight*len(series)))
+		background = color.RGBA{255, 255, 255, 255}
+		axis       = color.RGBA{0, 0, 0, 255}
+		reference  = color.RGBA{160, 160, 160, 255}
+	)
+	for x := range width {
+		for y := range img.Bounds().Dy() {
+			img.SetRGBA(x, y, background)
+		}
+	}
+	plotWidth, plotHeight := width-2*margin, panelHeight-2*margin
+	for i, s := range series {
+		top := s.max()
+		originY := panelHeight*i + margin + plotHeight
+		toY := func(value float64) int {
+			return originY - int(value/top*float64(plotHeight))
+		}
+		// Axes
+		for x := margin; x < margin+plotWidth; x++ {
+			img.SetRGBA(x, originY, axis)
+		}
+		for y := originY - plotHeight; y <= originY; y++ {
+			img.SetRGBA(margin, y, axis)
+		}
+		// Reference
+		if s.Reference > 0 {
+			y := toY(s.Reference)
+			for x := margin; x < margin+plotWidth; x += 4 {
+				img.SetRGBA(x, y, reference)
+				img.SetRGBA(x+1, y, reference)
+			}
+		}
+		// Values
+		if len(s.Values) == 0 {
+			continue
+		}
+		previousY := toY(s.Values[0])
+		for x := range plotWidth {
+			y := toY(s.Values[x*len(s.Values)/plotWidth])
+			for from, to := min(y, previousY), max(y, previousY); from <= to; from++ {
+				img.SetRGBA(margin+x, from, s.Color)
+			}
+			previousY = y
+		}
+	}
+	if err = png.Encode(w, img); err != nil {
+		err = fmt.Errorf("failed to encode the PNG chart: %w", err)
+		return
+	}
+	return
+}
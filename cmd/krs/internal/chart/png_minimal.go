@@ -0,0 +1,13 @@
+//go:build minimal
+
+package chart
+
+import (
+	"errors"
+	"io"
+)
+
+// WritePNG is not available in minimal builds: the image encoders are left out.
+func WritePNG(w io.Writer, width, panelHeight int, series ...Series) error {
+	return errors.New("PNG charts are not available in minimal builds")
+}
@@ -0,0 +1,245 @@
+// Package config handles the user configuration file of the krs commands
+// (~/.config/krs/config.yaml by default) providing the defaults of their flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvNamePath overrides the configuration file location
+	EnvNamePath = "KRS_CONFIG"
+	// EnvNameAPIKey has precedence over any API key set in the configuration file
+	EnvNameAPIKey = "KYUTAI_TTS_APIKEY"
+	// EnvNameLLMAPIKey is the API key of the LLM endpoint (krs summarize)
+	EnvNameLLMAPIKey = "KRS_LLM_APIKEY"
+)
+
+type Config struct {
+	// Server is the default websocket URL for both STT and TTS
+	Server    string `yaml:"server,omitempty"`
+	STTServer string `yaml:"stt_server,omitempty"`
+	TTSServer string `yaml:"tts_server,omitempty"`
+	// API key references, prefer api_key_file or api_key_env over a plain api_key
+	APIKey     string `yaml:"api_key,omitempty"`
+	APIKeyEnv  string `yaml:"api_key_env,omitempty"`
+	APIKeyFile string `yaml:"api_key_file,omitempty"`
+	// TTS defaults
+	Voice          string `yaml:"voice,omitempty"`
+	Output         string `yaml:"output,omitempty"`
+	WordsPerSecond int    `yaml:"words_per_second,omitempty"`
+	// LLM endpoint of krs summarize (OpenAI compatible API)
+	LLMServer string `yaml:"llm_server,omitempty"`
+	LLMModel  string `yaml:"llm_model,omitempty"`
+}
+
+// Path returns the location of the configuration file.
+func Path() (path string, err error) {
+	if path = os.Getenv(EnvNamePath); path != "" {
+		return
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		err = fmt.Errorf("failed to find the user config directory: %w", err)
+		return
+	}
+	path = filepath.Join(configDir, "krs", "config.yaml")
+	return
+}
+
+// Load reads the configuration file. A missing file is not an error and returns an empty configuration.
+func Load() (config Config, err error) {
+	path, err := Path()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		} else {
+			err = fmt.Errorf("failed to read %q: %w", path, err)
+		}
+		return
+	}
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		err = fmt.Errorf("failed to parse %q: %w", path, err)
+		return
+	}
+	return
+}
+
+// Save writes the configuration file, only readable by the user as it can contain an API key.
+func (c Config) Save() (err error) {
+	path, err := Path()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		err = fmt.Errorf("failed to create the config directory: %w", err)
+		return
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal the configuration: %w", err)
+		return
+	}
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		err = fmt.Errorf("failed to write %q: %w", path, err)
+		return
+	}
+	return
+}
+
+// STTURL returns the STT server URL from the configuration, or fallback if none is set.
+func (c Config) STTURL(fallback string) string {
+	return firstNonEmpty(c.STTServer, c.Server, fallback)
+}
+
+// TTSURL returns the TTS server URL from the configuration, or fallback if none is set.
+func (c Config) TTSURL(fallback string) string {
+	return firstNonEmpty(c.TTSServer, c.Server, fallback)
+}
+
+func (c Config) VoiceOr(fallback string) string {
+	return firstNonEmpty(c.Voice, fallback)
+}
+
+func (c Config) OutputOr(fallback string) string {
+	return firstNonEmpty(c.Output, fallback)
+}
+
+func (c Config) LLMServerOr(fallback string) string {
+	return firstNonEmpty(c.LLMServer, fallback)
+}
+
+func (c Config) LLMModelOr(fallback string) string {
+	return firstNonEmpty(c.LLMModel, fallback)
+}
+
+func (c Config) WordsPerSecondOr(fallback int) int {
+	if c.WordsPerSecond > 0 {
+		return c.WordsPerSecond
+	}
+	return fallback
+}
+
+// APIKeyValue resolves the API key: the KYUTAI_TTS_APIKEY environment variable first, then
+// the configured file, environment variable and plain value.
+func (c Config) APIKeyValue() (key string, err error) {
+	if key = os.Getenv(EnvNameAPIKey); key != "" {
+		return
+	}
+	return ResolveKey(c.APIKey, c.APIKeyEnv, c.APIKeyFile)
+}
+
+// ResolveKey resolves an API key reference: the file first, then the environment variable and
+// the plain value.
+func ResolveKey(plain, env, file string) (key string, err error) {
+	if file != "" {
+		var data []byte
+		if data, err = os.ReadFile(ExpandHome(file)); err != nil {
+			err = fmt.Errorf("failed to read the API key file: %w", err)
+			return
+		}
+		key = strings.TrimSpace(string(data))
+		return
+	}
+	if env != "" {
+		key = os.Getenv(env)
+		return
+	}
+	key = plain
+	return
+}
+
+// Keys returns the names of the configuration keys.
+func Keys() (keys []string) {
+	configType := reflect.TypeFor[Config]()
+	for i := range configType.NumField() {
+		keys = append(keys, yamlName(configType.Field(i)))
+	}
+	return
+}
+
+// Get returns the value of a configuration key.
+func (c Config) Get(key string) (value string, err error) {
+	field, err := c.field(key)
+	if err != nil {
+		return
+	}
+	if field.Kind() == reflect.Int {
+		if field.Int() != 0 {
+			value = strconv.FormatInt(field.Int(), 10)
+		}
+		return
+	}
+	value = field.String()
+	return
+}
+
+// Set changes the value of a configuration key, an empty value unsets it.
+func (c *Config) Set(key, value string) (err error) {
+	field, err := c.field(key)
+	if err != nil {
+		return
+	}
+	if field.Kind() == reflect.Int {
+		var number int64
+		if value != "" {
+			if number, err = strconv.ParseInt(value, 10, 64); err != nil {
+				err = fmt.Errorf("invalid value for %s: %w", key, err)
+				return
+			}
+		}
+		field.SetInt(number)
+		return
+	}
+	field.SetString(value)
+	return
+}
+
+func (c *Config) field(key string) (field reflect.Value, err error) {
+	value := reflect.ValueOf(c).Elem()
+	for i := range value.NumField() {
+		if yamlName(value.Type().Field(i)) == key {
+			field = value.Field(i)
+			return
+		}
+	}
+	err = fmt.Errorf("unknown configuration key %q (valid keys: %s)", key, strings.Join(Keys(), ", "))
+	return
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ExpandHome expands a leading ~/ of a path to the home directory of the user.
+func ExpandHome(path string) string {
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
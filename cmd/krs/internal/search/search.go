@@ -0,0 +1,204 @@
+//go:build sqlite_fts5
+
+// Package search indexes the transcripts exported by krs stt --json in a SQLite FTS5 database
+// for full-text and phrase queries.
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY,
+	path TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL,
+	tags TEXT NOT NULL,
+	indexed INTEGER NOT NULL
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS segments USING fts5(
+	text,
+	session UNINDEXED,
+	utterance UNINDEXED,
+	start UNINDEXED,
+	end UNINDEXED,
+	tokenize = 'unicode61 remove_diacritics 2'
+);`
+
+// Index is a full-text index of transcripts, one segment per utterance.
+type Index struct {
+	db *sql.DB
+}
+
+// Result is an utterance matching a query.
+type Result struct {
+	// Session is the name of the indexed transcript (its file name without extension)
+	Session string   `json:"session"`
+	Path    string   `json:"path"`
+	Tags    krs.Tags `json:"tags,omitempty"`
+	// Utterance is the index of the utterance in the transcript
+	Utterance int `json:"utterance"`
+	// Start and End are the stream times of the utterance (nanoseconds in JSON)
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	// Text is the utterance, Snippet its part around the matches, highlighted with brackets
+	Text    string `json:"text"`
+	Snippet string `json:"snippet"`
+}
+
+// DefaultPath returns the default location of the index, in the user cache directory: it can be
+// rebuilt from the transcripts.
+func DefaultPath() (path string, err error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		err = fmt.Errorf("failed to find the user cache directory: %w", err)
+		return
+	}
+	path = filepath.Join(cacheDir, "krs", "transcripts.db")
+	return
+}
+
+// Open opens the index, creating it if needed.
+func Open(path string) (index *Index, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		err = fmt.Errorf("failed to create the index directory: %w", err)
+		return
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		err = fmt.Errorf("failed to open the index: %w", err)
+		return
+	}
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		err = fmt.Errorf("failed to create the index tables: %w", err)
+		return
+	}
+	index = &Index{db: db}
+	return
+}
+
+func (i *Index) Close() error {
+	return i.db.Close()
+}
+
+// Add indexes a transcript file, replacing its previous version if it was already indexed.
+func (i *Index) Add(path string, transcript krs.Transcript) (err error) {
+	if path, err = filepath.Abs(path); err != nil {
+		err = fmt.Errorf("failed to resolve the transcript path: %w", err)
+		return
+	}
+	tags, err := json.Marshal(transcript.Tags)
+	if err != nil {
+		err = fmt.Errorf("failed to encode the tags: %w", err)
+		return
+	}
+	tx, err := i.db.Begin()
+	if err != nil {
+		err = fmt.Errorf("failed to start the index transaction: %w", err)
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	var session int64
+	err = tx.QueryRow("SELECT id FROM sessions WHERE path = ?", path).Scan(&session)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		var inserted sql.Result
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if inserted, err = tx.Exec("INSERT INTO sessions (path, name, tags, indexed) VALUES (?, ?, ?, ?)",
+			path, name, string(tags), time.Now().Unix()); err != nil {
+			err = fmt.Errorf("failed to add the session: %w", err)
+			return
+		}
+		if session, err = inserted.LastInsertId(); err != nil {
+			err = fmt.Errorf("failed to get the session ID: %w", err)
+			return
+		}
+	case err != nil:
+		err = fmt.Errorf("failed to look up the session: %w", err)
+		return
+	default:
+		if _, err = tx.Exec("UPDATE sessions SET tags = ?, indexed = ? WHERE id = ?", string(tags), time.Now().Unix(), session); err != nil {
+			err = fmt.Errorf("failed to update the session: %w", err)
+			return
+		}
+		if _, err = tx.Exec("DELETE FROM segments WHERE session = ?", session); err != nil {
+			err = fmt.Errorf("failed to remove the previous segments: %w", err)
+			return
+		}
+	}
+	insert, err := tx.Prepare("INSERT INTO segments (text, session, utterance, start, end) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		err = fmt.Errorf("failed to prepare the segments insertion: %w", err)
+		return
+	}
+	defer insert.Close()
+	for u, utterance := range transcript.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		if _, err = insert.Exec(utterance.Text(), session, u, int64(utterance.Start()), int64(utterance.End())); err != nil {
+			err = fmt.Errorf("failed to index utterance %d: %w", u, err)
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		err = fmt.Errorf("failed to commit the index transaction: %w", err)
+		return
+	}
+	return
+}
+
+// Search returns the utterances matching a FTS5 query, the best matches first: words (all of
+// them must match), "quoted phrases", prefix* and OR/NOT operators.
+func (i *Index) Search(query string, limit int) (results []Result, err error) {
+	rows, err := i.db.Query(`
+SELECT sessions.name, sessions.path, sessions.tags, segments.utterance, segments.start, segments.end,
+	segments.text, snippet(segments, 0, '[', ']', '…', 16)
+FROM segments JOIN sessions ON sessions.id = segments.session
+WHERE segments MATCH ?
+ORDER BY bm25(segments)
+LIMIT ?`, query, limit)
+	if err != nil {
+		err = fmt.Errorf("failed to search the index: %w", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			result     Result
+			tags       string
+			start, end int64
+		)
+		if err = rows.Scan(&result.Session, &result.Path, &tags, &result.Utterance, &start, &end,
+			&result.Text, &result.Snippet); err != nil {
+			err = fmt.Errorf("failed to read a search result: %w", err)
+			return
+		}
+		if err = json.Unmarshal([]byte(tags), &result.Tags); err != nil {
+			err = fmt.Errorf("failed to decode the session tags: %w", err)
+			return
+		}
+		result.Start, result.End = time.Duration(start), time.Duration(end)
+		results = append(results, result)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("failed to search the index: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// listOptions are the machine readable outputs of the root command, for scripts and GUIs.
+type listOptions struct {
+	voices  bool
+	devices bool
+	formats bool
+}
+
+func (opts listOptions) any() bool {
+	return opts.voices || opts.devices || opts.formats
+}
+
+func addListFlags(cmd *cobra.Command, opts *listOptions) {
+	cmd.Flags().BoolVar(&opts.voices, "list-voices", false, "List the available voices as JSON.")
+	cmd.Flags().BoolVar(&opts.devices, "list-devices", false, "List the available audio devices as JSON.")
+	cmd.Flags().BoolVar(&opts.formats, "list-formats", false, "List the supported audio formats as JSON.")
+	cmd.MarkFlagsMutuallyExclusive("list-voices", "list-devices", "list-formats")
+}
+
+func runList(cmd *cobra.Command, opts listOptions) (err error) {
+	var list any
+	switch {
+	case opts.voices:
+		if list, err = voiceGallery(krs.DefaultVoiceRepository).Voices(cmd.Context()); err != nil {
+			return
+		}
+	case opts.devices:
+		list = audio.Devices()
+	case opts.formats:
+		list = audio.Formats()
+	}
+	return writeJSON(cmd.OutOrStdout(), list)
+}
+
+func writeJSON(w io.Writer, value any) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(value); err != nil {
+		err = fmt.Errorf("failed to encode JSON: %w", err)
+		return
+	}
+	return
+}
+
+// Shell completion helpers
+
+func completeVoices(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	voices, err := voiceGallery(krs.DefaultVoiceRepository).Voices(cmd.Context())
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	completions := make([]cobra.Completion, len(voices))
+	for i, voice := range voices {
+		completions[i] = cobra.CompletionWithDesc(voice.Name, voice.Description)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeLogLevels(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return []cobra.Completion{"debug", "info", "warn", "error"}, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return config.Keys(), cobra.ShellCompDirectiveNoFileComp
+}
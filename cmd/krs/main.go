@@ -0,0 +1,149 @@
+// Command krs is the command line tool of the library: speech to text, text to speech,
+// benchmarking, API key injecting proxy and voices listing.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultServer = "ws://127.0.0.1:8080"
+	defaultVoice  = "expresso/ex01-ex02_default_001_channel2_198s.wav"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// globals holds what is shared by all the commands.
+type globals struct {
+	cfg      config.Config
+	cfgErr   error
+	logLevel string
+	pprof    string
+	tags     map[string]string
+	logger   *slog.Logger
+}
+
+func newRootCommand() *cobra.Command {
+	g := &globals{
+		logger: slog.Default(),
+	}
+	var list listOptions
+	// The user configuration provides the flags defaults: load it before declaring them
+	g.cfg, g.cfgErr = config.Load()
+	root := &cobra.Command{
+		Use:          "krs",
+		Short:        "Kyutai Rust server command line tool",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Logging
+			var level slog.Level
+			if err = level.UnmarshalText([]byte(g.logLevel)); err != nil {
+				err = fmt.Errorf("invalid log level: %w", err)
+				return
+			}
+			g.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+			if len(g.tags) > 0 {
+				g.logger = g.logger.With("tags", krs.Tags(g.tags))
+			}
+			// Profiling
+			if g.pprof != "" {
+				go servePprof(g.logger, g.pprof)
+			}
+			// The config command reports a broken configuration file itself (but can still locate it)
+			if g.cfgErr != nil && !isConfigCommand(cmd) {
+				err = g.cfgErr
+				return
+			}
+			return
+		},
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !list.any() {
+				return cmd.Help()
+			}
+			return runList(cmd, list)
+		},
+	}
+	root.PersistentFlags().StringVar(&g.logLevel, "log-level", "info", "Log level (debug, info, warn, error).")
+	addPprofFlag(root, g)
+	root.PersistentFlags().StringToStringVar(&g.tags, "tag", nil, "Metadata attached to the connections (for example user=42,call=c-7): logged and included in the traces and the transcripts.")
+	_ = root.RegisterFlagCompletionFunc("log-level", completeLogLevels)
+	addListFlags(root, &list)
+	root.AddCommand(
+		newSTTCommand(g),
+		newTTSCommand(g),
+		newDialogueCommand(g),
+		newSpeakCommand(g),
+		newPrewarmCommand(g),
+		newNotifyCommand(g),
+		newBenchCommand(g),
+		newDoctorCommand(g),
+		newProxyCommand(g),
+		newVoicesCommand(g),
+		newEditCommand(g),
+		newSummarizeCommand(g),
+		newChaptersCommand(g),
+		newClipCommand(g),
+		newRedactCommand(g),
+		newConvertCommand(g),
+		newImportCommand(g),
+		newEnsembleCommand(g),
+		newWatchCommand(g),
+		newIndexCommand(g),
+		newSearchCommand(g),
+		newConfigCommand(g),
+	)
+	return root
+}
+
+func isConfigCommand(cmd *cobra.Command) bool {
+	for ; cmd != nil; cmd = cmd.Parent() {
+		if cmd.Name() == "config" {
+			return true
+		}
+	}
+	return false
+}
+
+// logFlowControl reports the flow control requests of the server until ctx is done.
+func logFlowControl(ctx context.Context, logger *slog.Logger, states <-chan krs.FlowState) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case state := <-states:
+			logger.Warn("server flow control", "state", state)
+		}
+	}
+}
+
+// logStates reports the state transitions of a connection until it ends.
+func logStates(logger *slog.Logger, events <-chan krs.StateEvent) {
+	for event := range events {
+		if event.Err != nil {
+			logger.Debug("connection state", "state", event.State, "error", event.Err)
+		} else {
+			logger.Debug("connection state", "state", event.State)
+		}
+	}
+}
+
+// realtimeWarning reports the server falling behind real time.
+func realtimeWarning(logger *slog.Logger) *krs.RealtimeGuard {
+	return &krs.RealtimeGuard{
+		OnSlow: func(factor float64) {
+			logger.Warn("the server is slower than real time", "factor", fmt.Sprintf("%.2f", factor))
+		},
+	}
+}
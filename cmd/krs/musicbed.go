@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+// musicBedOptions are the flags mixing the narration over a music bed.
+type musicBedOptions struct {
+	music string
+	duck  decibels
+	level decibels
+	intro time.Duration
+	outro time.Duration
+}
+
+func (mbo *musicBedOptions) addFlags(cmd *cobra.Command) {
+	mbo.duck = krs.DefaultDucking
+	mbo.level = krs.DefaultMusicLevel
+	cmd.Flags().StringVar(&mbo.music, "music", "", "Mix the narration over this music bed (wav or ogg/vorbis, looped if shorter), ducked under the speech.")
+	cmd.Flags().Var(&mbo.duck, "duck", "Attenuation of the music bed while the narration speaks (0dB for none).")
+	cmd.Flags().Var(&mbo.level, "music-level", "Level of the music bed outside the speech, relative to the speech of the narration.")
+	cmd.Flags().DurationVar(&mbo.intro, "music-intro", 0, "Music played alone before the narration.")
+	cmd.Flags().DurationVar(&mbo.outro, "music-outro", krs.DefaultMusicOutro, "Music played after the narration, fading out.")
+	_ = cmd.MarkFlagFilename("music", "wav", "ogg")
+}
+
+// mix mixes the narration over the music bed, read beforehand.
+func (mbo *musicBedOptions) mix(narration *krs.PCMAccumulator, music []float32) (mix []float32, err error) {
+	var pcm []float32
+	for chunk, err := range narration.Chunks(krs.SampleRate) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to read samples: %w", err)
+		}
+		pcm = append(pcm, chunk...)
+	}
+	outro := mbo.outro
+	if outro == 0 {
+		outro = -1 // no outro rather than the default
+	}
+	// the flags default to the library defaults: 0dB is a level like the others
+	level, ducking := float64(mbo.level), float64(mbo.duck)
+	return krs.MixMusicBed(pcm, music, krs.MusicBedConfig{
+		Level:   &level,
+		Ducking: &ducking,
+		Intro:   mbo.intro,
+		Outro:   outro,
+	})
+}
+
+// load checks the flags and reads the music bed, before the synthesis so that a mistake fails early.
+func (mbo *musicBedOptions) load() (music []float32, err error) {
+	if mbo.duck > 0 {
+		return nil, fmt.Errorf("invalid --duck %s: the ducking is an attenuation, for example -12dB (0dB for none)", mbo.duck.String())
+	}
+	if music, err = audio.ReadFile(mbo.music); err != nil {
+		return nil, fmt.Errorf("failed to read the music bed: %w", err)
+	}
+	return
+}
+
+// decibels is a flag value in dB, with or without its unit: -12dB.
+type decibels float64
+
+func (d *decibels) String() string {
+	return strconv.FormatFloat(float64(*d), 'f', -1, 64) + "dB"
+}
+
+func (d *decibels) Set(value string) (err error) {
+	value = strings.TrimSpace(value)
+	if unit := len(value) - 2; unit >= 0 && strings.EqualFold(value[unit:], "dB") {
+		value = value[:unit]
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("invalid level %q: expected decibels, for example -12dB", value)
+	}
+	*d = decibels(parsed)
+	return
+}
+
+func (d *decibels) Type() string {
+	return "dB"
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+// networkOptions are the network simulation flags shared by the commands opening connections.
+type networkOptions struct {
+	mobile3G   bool
+	uploadKBps int
+	latency    time.Duration
+	jitter     time.Duration
+}
+
+func (opts *networkOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&opts.mobile3G, "sim-3g", false, "Simulate a typical 3G connection (the other --sim-* flags override its values).")
+	cmd.Flags().IntVar(&opts.uploadKBps, "sim-upload", 0, "Cap the upload bandwidth to this many KB/s to simulate a slow network.")
+	cmd.Flags().DurationVar(&opts.latency, "sim-latency", 0, "Add this much round trip latency to simulate a slow network.")
+	cmd.Flags().DurationVar(&opts.jitter, "sim-jitter", 0, "Randomly add up to this much latency to each chunk of data sent or received.")
+}
+
+// conditions returns the network conditions to simulate, nil if none of the flags are set.
+func (opts networkOptions) conditions() (nc *krs.NetworkConditions) {
+	if !opts.mobile3G && opts.uploadKBps <= 0 && opts.latency <= 0 && opts.jitter <= 0 {
+		return
+	}
+	nc = new(krs.NetworkConditions)
+	if opts.mobile3G {
+		*nc = krs.Mobile3G
+	}
+	if opts.uploadKBps > 0 {
+		nc.UploadBandwidth = opts.uploadKBps * 1000
+	}
+	if opts.latency > 0 {
+		nc.Latency = opts.latency
+	}
+	if opts.jitter > 0 {
+		nc.Jitter = opts.jitter
+	}
+	return
+}
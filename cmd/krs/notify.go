@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+// the Notify method call of the freedesktop notifications specification
+const notifyMatchRule = "type='method_call',interface='org.freedesktop.Notifications',member='Notify'"
+
+// muted is the priority name of the applications not spoken
+const muted = "mute"
+
+var notificationMarkup = regexp.MustCompile(`<[^>]*>`)
+
+type notifyOptions struct {
+	server          string
+	voice           string
+	player          string
+	apps            map[string]string
+	defaultPriority string
+	noAppName       bool
+	noVoiceCheck    bool
+	network         networkOptions
+}
+
+func newNotifyCommand(g *globals) *cobra.Command {
+	var opts notifyOptions
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Speak the desktop notifications",
+		Long: `Speak the desktop notifications.
+
+The notifications sent on the DBus session bus (Linux desktops) are spoken on the audio device
+as they come: a notification with a higher priority interrupts the one being spoken, the others
+are queued. The priority is chosen per application with --app (case insensitive name, use
+"mute" to ignore an application), critical notifications are always urgent.
+
+The bus is monitored with dbus-monitor, the audio is played by the --player command reading the
+raw samples (mono float32 at 24kHz) on its standard input.`,
+		Example: `  krs notify --app thunderbird=high,spotify=mute --default low`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNotify(g, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.voice, "voice", g.cfg.VoiceOr(defaultVoice), "The voice to use for synthesis (see the voices command).")
+	cmd.Flags().StringVar(&opts.player, "player", defaultPlayer, "Command playing the raw audio samples read on its standard input.")
+	cmd.Flags().StringToStringVar(&opts.apps, "app", nil, "Priority of the notifications of an application: low, normal, high, urgent or mute.")
+	cmd.Flags().StringVar(&opts.defaultPriority, "default", "normal", "Priority of the applications not listed with --app (mute to only speak the listed ones).")
+	cmd.Flags().BoolVar(&opts.noAppName, "no-app-name", false, "Do not announce the name of the application before the notification.")
+	cmd.Flags().BoolVar(&opts.noVoiceCheck, "no-voice-check", false, "Do not check the voice exists in the voices repository (for voices local to the server).")
+	opts.network.addFlags(cmd)
+	_ = cmd.RegisterFlagCompletionFunc("voice", completeVoices)
+	_ = cmd.RegisterFlagCompletionFunc("default", cobra.FixedCompletions(
+		[]string{"low", "normal", "high", "urgent", muted}, cobra.ShellCompDirectiveNoFileComp),
+	)
+	return cmd
+}
+
+func runNotify(g *globals, opts notifyOptions) (err error) {
+	// Check the priorities first
+	filter := notificationFilter{apps: make(map[string]priorityChoice, len(opts.apps))}
+	if filter.fallback, err = parsePriorityChoice(opts.defaultPriority); err != nil {
+		return
+	}
+	for app, priority := range opts.apps {
+		if filter.apps[strings.ToLower(app)], err = parsePriorityChoice(priority); err != nil {
+			return
+		}
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	_, abortCtx, stop := interruptible(nil)
+	defer stop()
+
+	// Create the Kyutai TTS client
+	config := &krs.TTSConfig{
+		URL:           opts.server,
+		APIKey:        apiKey,
+		Voice:         opts.voice,
+		Network:       opts.network.conditions(),
+		RealtimeGuard: realtimeWarning(g.logger),
+		Tags:          g.tags,
+	}
+	if !opts.noVoiceCheck {
+		config.VoiceGallery = voiceGallery(krs.DefaultVoiceRepository)
+	}
+	ttsClient, err := krs.NewTTSClient(config)
+	if err != nil {
+		return
+	}
+
+	// Start the player and the speaker
+	sink, err := startPlayer(opts.player)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	speaker := krs.NewSpeaker(abortCtx, ttsClient, sink)
+	defer speaker.Close()
+
+	// Monitor the session bus until interrupted
+	monitor := exec.CommandContext(abortCtx, "dbus-monitor", "--session", "--monitor", notifyMatchRule)
+	monitor.Stderr = os.Stderr
+	output, err := monitor.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get the dbus-monitor output: %w", err)
+	}
+	if err = monitor.Start(); err != nil {
+		return fmt.Errorf("failed to start dbus-monitor: %w", err)
+	}
+	g.logger.Info("speaking the desktop notifications")
+	if err = scanNotifications(output, func(n notification) {
+		priority, spoken := filter.priority(n)
+		if !spoken {
+			g.logger.Debug("notification muted", "app", n.app, "summary", n.summary)
+			return
+		}
+		text := n.speech(!opts.noAppName)
+		if text == "" {
+			return
+		}
+		result := speaker.Say(text, priority)
+		go func() {
+			if err := <-result; err != nil && !errors.Is(err, krs.ErrInterrupted) {
+				g.logger.Error("failed to speak a notification", "app", n.app, "error", err)
+			}
+		}()
+	}); err != nil {
+		return
+	}
+	if err = monitor.Wait(); err != nil && abortCtx.Err() == nil {
+		return fmt.Errorf("dbus-monitor failed: %w", err)
+	}
+	return nil
+}
+
+// priorityChoice is a priority, or muted.
+type priorityChoice struct {
+	priority krs.Priority
+	muted    bool
+}
+
+func parsePriorityChoice(name string) (choice priorityChoice, err error) {
+	switch strings.ToLower(name) {
+	case "low":
+		choice.priority = krs.PriorityLow
+	case "normal":
+		choice.priority = krs.PriorityNormal
+	case "high":
+		choice.priority = krs.PriorityHigh
+	case "urgent":
+		choice.priority = krs.PriorityUrgent
+	case muted:
+		choice.muted = true
+	default:
+		err = fmt.Errorf("invalid priority %q: must be low, normal, high, urgent or %s", name, muted)
+	}
+	return
+}
+
+type notificationFilter struct {
+	apps     map[string]priorityChoice
+	fallback priorityChoice
+}
+
+// priority returns the priority of a notification and if it must be spoken at all.
+func (nf notificationFilter) priority(n notification) (priority krs.Priority, spoken bool) {
+	choice, listed := nf.apps[strings.ToLower(n.app)]
+	if !listed {
+		choice = nf.fallback
+	}
+	if choice.muted {
+		return
+	}
+	if n.urgency == urgencyCritical {
+		return krs.PriorityUrgent, true
+	}
+	return choice.priority, true
+}
+
+const urgencyCritical = 2
+
+// notification holds the arguments of a Notify call.
+type notification struct {
+	app     string
+	summary string
+	body    string
+	// 0 low, 1 normal, 2 critical
+	urgency int
+}
+
+// speech returns the text to speak, without the markup the body can contain.
+func (n notification) speech(withApp bool) string {
+	var parts []string
+	for _, text := range []string{n.summary, n.body} {
+		text = strings.Join(strings.Fields(html.UnescapeString(notificationMarkup.ReplaceAllString(text, " "))), " ")
+		if text == "" {
+			continue
+		}
+		if !strings.ContainsAny(text[len(text)-1:], ".!?:") {
+			text += "."
+		}
+		parts = append(parts, text)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	if withApp && n.app != "" {
+		parts = slices.Insert(parts, 0, n.app+":")
+	}
+	return strings.Join(parts, " ")
+}
+
+// the top level arguments of Notify: app_name, replaces_id, app_icon, summary, body, actions,
+// hints and expire_timeout
+const (
+	notifyArgApp = iota
+	_
+	_
+	notifyArgSummary
+	notifyArgBody
+	_
+	notifyArgHints
+)
+
+// scanNotifications parses the dbus-monitor output, calling handle for each Notify call.
+func scanNotifications(r io.Reader, handle func(n notification)) (err error) {
+	var (
+		current *notification
+		arg     int
+		hintKey string
+		// a string argument spanning several lines
+		multiline bool
+		text      string
+		topLevel  = "   "
+	)
+	flush := func() {
+		if current != nil {
+			handle(*current)
+			current = nil
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case multiline:
+			text += "\n" + line
+			if strings.HasSuffix(line, `"`) {
+				current.set(arg, strings.TrimSuffix(text, `"`))
+				multiline = false
+				arg++
+			}
+		case !strings.HasPrefix(line, " "):
+			// a new message
+			flush()
+			if strings.HasSuffix(line, "member=Notify") {
+				current = &notification{urgency: 1}
+				arg = 0
+			}
+		case current == nil:
+		case strings.HasPrefix(line, topLevel) && !strings.HasPrefix(line, topLevel+" "):
+			// a top level argument
+			value := strings.TrimPrefix(line, topLevel)
+			switch {
+			case value == "]":
+				// end of an array
+				arg++
+			case strings.HasPrefix(value, "array ["):
+			case strings.HasPrefix(value, `string "`):
+				text = strings.TrimPrefix(value, `string "`)
+				if !strings.HasSuffix(text, `"`) {
+					multiline = true
+					continue
+				}
+				current.set(arg, strings.TrimSuffix(text, `"`))
+				arg++
+			default:
+				arg++
+			}
+		case arg == notifyArgHints:
+			// nested values of the hints dictionary
+			value := strings.TrimSpace(line)
+			if key, found := strings.CutPrefix(value, `string "`); found {
+				hintKey = strings.TrimSuffix(key, `"`)
+			} else if variant, found := strings.CutPrefix(value, "variant"); found && hintKey == "urgency" {
+				if fields := strings.Fields(variant); len(fields) == 2 {
+					if urgency, err := strconv.Atoi(fields[1]); err == nil {
+						current.urgency = urgency
+					}
+				}
+			}
+		}
+	}
+	flush()
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("failed to read the dbus-monitor output: %w", err)
+	}
+	return
+}
+
+func (n *notification) set(arg int, value string) {
+	switch arg {
+	case notifyArgApp:
+		n.app = value
+	case notifyArgSummary:
+		n.summary = value
+	case notifyArgBody:
+		n.body = value
+	}
+}
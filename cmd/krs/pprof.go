@@ -0,0 +1,21 @@
+//go:build !minimal
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof"
+
+	"github.com/spf13/cobra"
+)
+
+func addPprofFlag(root *cobra.Command, g *globals) {
+	root.PersistentFlags().StringVar(&g.pprof, "pprof", "", "Serve live profiling data (net/http/pprof) on this address, for example localhost:6060.")
+}
+
+func servePprof(logger *slog.Logger, address string) {
+	if err := http.ListenAndServe(address, nil); err != nil {
+		logger.Error("pprof server failed", "error", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build minimal
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+)
+
+// minimal builds leave the profiling server (and its templates) out: no --pprof flag
+func addPprofFlag(root *cobra.Command, g *globals) {}
+
+func servePprof(logger *slog.Logger, address string) {}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultPreviewText = "Hello! This is how I sound. Do you like my voice?"
+	// silence between the voices of the combined preview
+	previewGap = 700 * time.Millisecond
+)
+
+type previewOptions struct {
+	server    string
+	text      string
+	filter    string
+	outputDir string
+	combined  string
+}
+
+func newVoicesPreviewCommand(g *globals) *cobra.Command {
+	var opts previewOptions
+	cmd := &cobra.Command{
+		Use:   "preview [voice...]",
+		Short: "Synthesize a sample sentence with several voices to compare them",
+		Long: `Synthesize a sample sentence with several voices to compare them.
+
+The voices are given as arguments or selected with --filter. Each sample is written as a
+wave file in the output directory, --combined also writes all of them one after the other
+in a single file (in the order of the listing) to compare them in one go.`,
+		Example: `  krs voices preview --filter expresso/ex03 --combined expresso.wav`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPreview(cmd, g, opts, args)
+		},
+		ValidArgsFunction: completeVoices,
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.text, "text", defaultPreviewText, "The sentence to synthesize with each voice.")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Preview the voices containing this string, for example expresso/ex03.")
+	cmd.Flags().StringVar(&opts.outputDir, "output-dir", "voices-preview", "Directory to write the samples to.")
+	cmd.Flags().StringVar(&opts.combined, "combined", "", "Also write all the samples one after the other to this wave file.")
+	_ = cmd.MarkFlagDirname("output-dir")
+	_ = cmd.MarkFlagFilename("combined", "wav")
+	return cmd
+}
+
+func runPreview(cmd *cobra.Command, g *globals, opts previewOptions, voices []string) (err error) {
+	if opts.filter != "" {
+		var gallery []krs.Voice
+		if gallery, err = voiceGallery(krs.DefaultVoiceRepository).Voices(cmd.Context()); err != nil {
+			return
+		}
+		for _, voice := range gallery {
+			if strings.Contains(voice.Name, opts.filter) {
+				voices = append(voices, voice.Name)
+			}
+		}
+	}
+	if len(voices) == 0 {
+		return errors.New("no voices to preview: give them as arguments or use --filter")
+	}
+	if opts.combined != "" && !strings.HasSuffix(opts.combined, ".wav") {
+		return errors.New("the combined file must have a .wav extension")
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(opts.outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create the output directory: %w", err)
+	}
+	combined := krs.NewPCMAccumulator(256 << 20)
+	defer combined.Close()
+	gap := make([]float32, int(previewGap.Seconds()*krs.SampleRate))
+	for i, voice := range voices {
+		var client *krs.TTSClient
+		if client, err = krs.NewTTSClient(&krs.TTSConfig{
+			URL:    opts.server,
+			APIKey: apiKey,
+			Voice:  voice,
+		}); err != nil {
+			return
+		}
+		var pcm []float32
+		if pcm, err = client.Synthesize(cmd.Context(), opts.text); err != nil {
+			return fmt.Errorf("failed to synthesize with %q: %w", voice, err)
+		}
+		filename := filepath.Join(opts.outputDir, strings.NewReplacer("/", "_", ".wav", "").Replace(voice)+".wav")
+		if err = writeSamples(filename, pcm); err != nil {
+			return
+		}
+		fmt.Printf("%d. %s: %s\n", i+1, voice, filename)
+		if i > 0 {
+			if err = combined.WritePCM(gap); err != nil {
+				return
+			}
+		}
+		if err = combined.WritePCM(pcm); err != nil {
+			return
+		}
+	}
+	if opts.combined != "" {
+		if err = audio.WriteWAV(opts.combined, combined); err != nil {
+			return
+		}
+		fmt.Printf("All samples written to %q\n", opts.combined)
+	}
+	return
+}
+
+func writeSamples(filename string, pcm []float32) (err error) {
+	samples := krs.NewPCMAccumulator(len(pcm) * 4)
+	defer samples.Close()
+	if err = samples.WritePCM(pcm); err != nil {
+		return
+	}
+	return audio.WriteWAV(filename, samples)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+type prewarmOptions struct {
+	server       string
+	voice        string
+	cacheDir     string
+	ttl          time.Duration
+	maxSize      int
+	noVoiceCheck bool
+	network      networkOptions
+}
+
+func newPrewarmCommand(g *globals) *cobra.Command {
+	var opts prewarmOptions
+	cmd := &cobra.Command{
+		Use:   "prewarm [phrases file]",
+		Short: "Synthesize known phrases ahead of time into a synthesis cache",
+		Long: `Synthesize known phrases ahead of time into a synthesis cache.
+
+Each line of the file (or of stdin without file) is synthesized with the voice, unless it is
+already cached. The commands given the same --cache-dir (speak) then play these phrases
+instantly, without connecting to the server: canned responses stay responsive even when the
+server is busy.`,
+		Example: `  printf "Sure, one moment.\nDone!\n" | krs prewarm --cache-dir ~/.cache/krs/synthesis
+  krs speak --cache-dir ~/.cache/krs/synthesis /tmp/announce`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			input := io.Reader(os.Stdin)
+			if len(args) == 1 {
+				var file *os.File
+				if file, err = os.Open(args[0]); err != nil {
+					return
+				}
+				defer file.Close()
+				input = file
+			}
+			return runPrewarm(g, opts, input)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.voice, "voice", g.cfg.VoiceOr(defaultVoice), "The voice to use for synthesis (see the voices command).")
+	cmd.Flags().StringVar(&opts.cacheDir, "cache-dir", defaultSynthesisCacheDir(), "The synthesis cache directory.")
+	cmd.Flags().DurationVar(&opts.ttl, "ttl", 0, "How long the phrases stay cached (forever by default).")
+	cmd.Flags().IntVar(&opts.maxSize, "max-size", krs.DefaultCacheMaxSize>>20, "Size of the cache (in MiB) beyond which the least recently used phrases are removed.")
+	cmd.Flags().BoolVar(&opts.noVoiceCheck, "no-voice-check", false, "Do not check the voice exists in the voices repository (for voices local to the server).")
+	opts.network.addFlags(cmd)
+	_ = cmd.RegisterFlagCompletionFunc("voice", completeVoices)
+	_ = cmd.MarkFlagDirname("cache-dir")
+	return cmd
+}
+
+func runPrewarm(g *globals, opts prewarmOptions, input io.Reader) (err error) {
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	var phrases []string
+	lines := bufio.NewScanner(input)
+	for lines.Scan() {
+		if phrase := strings.TrimSpace(lines.Text()); phrase != "" {
+			phrases = append(phrases, phrase)
+		}
+	}
+	if err = lines.Err(); err != nil {
+		return fmt.Errorf("failed to read the phrases: %w", err)
+	}
+	_, abortCtx, stop := interruptible(nil)
+	defer stop()
+
+	// Create the Kyutai TTS client
+	config := &krs.TTSConfig{
+		URL:     opts.server,
+		APIKey:  apiKey,
+		Voice:   opts.voice,
+		Network: opts.network.conditions(),
+		Cache:   synthesisCache(opts.cacheDir, opts.ttl, opts.maxSize),
+		Tags:    g.tags,
+	}
+	if !opts.noVoiceCheck {
+		config.VoiceGallery = voiceGallery(krs.DefaultVoiceRepository)
+	}
+	ttsClient, err := krs.NewTTSClient(config)
+	if err != nil {
+		return
+	}
+	start := time.Now()
+	if err = ttsClient.PrewarmPhrases(abortCtx, phrases); err != nil {
+		return
+	}
+	g.logger.Info("phrases cached", "phrases", len(phrases), "cache", opts.cacheDir,
+		"duration", time.Since(start).Round(time.Millisecond))
+	return
+}
+
+// defaultSynthesisCacheDir is in the user cache directory, empty if there is none.
+func defaultSynthesisCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "krs", "synthesis")
+}
+
+// synthesisCache returns the file cache of a directory, nil without directory. maxSize is in MiB.
+func synthesisCache(dir string, ttl time.Duration, maxSize int) krs.SynthesisCache {
+	if dir == "" {
+		return nil
+	}
+	return &krs.FileCache{Dir: dir, TTL: ttl, MaxSize: int64(maxSize) << 20}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+type proxyOptions struct {
+	listen      string
+	upstream    string
+	routes      string
+	maxSessions int
+	queue       int
+	maxWait     time.Duration
+	capture     string
+}
+
+func newProxyCommand(g *globals) *cobra.Command {
+	var opts proxyOptions
+	cmd := &cobra.Command{
+		Use:   "proxy",
+		Short: "Forward websocket connections to a Kyutai server, injecting the API key",
+		Long: `Forward websocket connections to a Kyutai server, injecting the API key.
+
+Local applications can connect to the proxy without knowing the API key: every STT and TTS
+connection is relayed as is to the upstream server with the configured key. Each session is
+logged with its duration and traffic.
+
+With a routes file, one proxy fronts several servers: the API key presented by each client
+(kyutai-api-key header) selects the upstream server and its API key.
+
+The proxy also serves an OpenAI compatible transcription endpoint for the web clients without
+websockets: POST /v1/audio/transcriptions with the audio file, and stream=true to receive the
+words as Server-Sent Events while they are transcribed.
+
+With --max-sessions, the sessions beyond the capacity of an upstream server wait in a bounded
+queue for a slot, up to --max-wait: the clients which can not be admitted are refused with
+HTTP 429 instead of overloading the server.
+
+/healthz and /readyz are the liveness and readiness probes of the orchestrators, a deadline set
+by a service mesh (x-envoy-expected-rq-timeout-ms header) ends the session.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProxy(g, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.listen, "listen", "127.0.0.1:8090", "The address to listen on.")
+	cmd.Flags().StringVar(&opts.upstream, "upstream", g.cfg.TTSURL(defaultServer), "The websocket URL of the upstream Kyutai server.")
+	cmd.Flags().StringVar(&opts.routes, "routes", "", "YAML file routing the client API keys to upstream servers and their API keys (replaces --upstream and the configured API key).")
+	_ = cmd.MarkFlagFilename("routes", "yaml", "yml")
+	cmd.Flags().IntVar(&opts.maxSessions, "max-sessions", 0, "Maximum concurrent sessions per upstream server, 0 for no limit (max_sessions of a route overrides it).")
+	cmd.Flags().IntVar(&opts.queue, "queue", 16, "Maximum sessions waiting for a slot per upstream server with --max-sessions, beyond it the clients are refused.")
+	cmd.Flags().DurationVar(&opts.maxWait, "max-wait", 10*time.Second, "Maximum time a session waits for a slot with --max-sessions before being refused.")
+	cmd.Flags().StringVar(&opts.capture, "capture", "", "Save the first frame of each direction and type relayed to this directory (client-Audio.msgpack, server-Step.msgpack...).")
+	_ = cmd.MarkFlagDirname("capture")
+	return cmd
+}
+
+func runProxy(g *globals, opts proxyOptions) (err error) {
+	var routes *proxyRoutes
+	if opts.routes != "" {
+		if routes, err = loadProxyRoutes(opts.routes); err != nil {
+			return
+		}
+	} else {
+		var apiKey string
+		if apiKey, err = g.cfg.APIKeyValue(); err != nil {
+			return
+		}
+		if routes, err = singleRoute(opts.upstream, apiKey); err != nil {
+			return
+		}
+	}
+	routes.limit(opts.maxSessions, opts.queue, opts.maxWait)
+	p := &proxy{
+		routes: routes,
+		logger: g.logger,
+	}
+	if opts.capture != "" {
+		if err = os.MkdirAll(opts.capture, 0o755); err != nil {
+			return fmt.Errorf("failed to create the capture directory: %w", err)
+		}
+		p.capture = &frameCapture{dir: opts.capture, logger: g.logger, seen: make(map[string]bool)}
+	}
+	server := &http.Server{
+		Addr:    opts.listen,
+		Handler: p,
+	}
+	// Stop accepting connections on the first interrupt, abort the sessions on the second one
+	interruptCtx, abortCtx, stop := interruptible(func() {
+		g.logger.Info("interrupted: waiting for the sessions to end (interrupt again to abort)")
+	})
+	defer stop()
+	p.ctx = abortCtx
+	go func() {
+		<-interruptCtx.Done()
+		_ = server.Shutdown(abortCtx)
+	}()
+	if opts.routes != "" {
+		g.logger.Info("proxy listening", "address", opts.listen, "routes", len(routes.all))
+	} else {
+		g.logger.Info("proxy listening", "address", opts.listen, "upstream", routes.fallback.upstreamURL.String())
+	}
+	if err = server.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	// Shutdown does not wait for hijacked connections
+	p.sessions.Wait()
+	return
+}
+
+type proxy struct {
+	ctx      context.Context
+	routes   *proxyRoutes
+	logger   *slog.Logger
+	sessions sync.WaitGroup
+	counter  atomic.Int64
+	capture  *frameCapture
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == healthzPath || r.URL.Path == readyzPath {
+		p.health(w, r)
+		return
+	}
+	logger := p.logger.With("session", p.counter.Add(1), "remote", r.RemoteAddr, "path", r.URL.Path)
+	// The session ends at the deadline of the service mesh, if any
+	deadline, hasDeadline := requestDeadline(r)
+	if hasDeadline {
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		r = r.WithContext(ctx)
+		logger = logger.With("deadline", time.Until(deadline).Round(time.Millisecond))
+	}
+	// The OpenAI clients of the transcription endpoint send their key as a bearer token
+	clientKey := r.Header.Get("kyutai-api-key")
+	if clientKey == "" {
+		clientKey, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	route, err := p.routes.route(clientKey)
+	if err != nil {
+		logger.Warn("client refused", "error", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	logger = logger.With("route", route.Name)
+	release, waited, err := route.admission.acquire(r.Context())
+	if err != nil {
+		logger.Warn("client refused", "error", err, "waited", waited.Round(time.Millisecond))
+		w.Header().Set("Retry-After", strconv.Itoa(route.admission.retryAfter()))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	if waited > 0 {
+		logger = logger.With("queued", waited.Round(time.Millisecond))
+	}
+	if r.URL.Path == transcriptionsPath {
+		defer release()
+		p.transcriptions(w, r, logger, route)
+		return
+	}
+	// Connect upstream first to forward its refusal (bad path, server busy) to the client
+	target := *route.upstreamURL
+	target.Path = r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+	upstream, resp, err := websocket.Dial(r.Context(), target.String(), &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"kyutai-api-key": []string{route.apiKey},
+		},
+	})
+	if err != nil {
+		release()
+		logger.Warn("failed to connect upstream", "error", err)
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	upstream.SetReadLimit(-1)
+	client, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		logger.Warn("failed to accept the client connection", "error", err)
+		upstream.Close(websocket.StatusInternalError, "")
+		release()
+		return
+	}
+	client.SetReadLimit(-1)
+	p.sessions.Go(func() {
+		defer release()
+		if hasDeadline {
+			// Both sides are closed with a handshake: the model server ends the session right away
+			timer := time.AfterFunc(time.Until(deadline), func() {
+				logger.Info("session deadline reached")
+				client.Close(websocket.StatusGoingAway, "deadline exceeded")
+				upstream.Close(websocket.StatusGoingAway, "deadline exceeded")
+			})
+			defer timer.Stop()
+		}
+		p.relay(logger, client, upstream)
+	})
+}
+
+// relay pumps the messages both ways until one side closes, then propagates the close.
+func (p *proxy) relay(logger *slog.Logger, client, upstream *websocket.Conn) {
+	start := time.Now()
+	logger.Info("session started")
+	// Canceling a read closes the connection without handshake: the pumps only stop on abort
+	var sent, received atomic.Int64
+	errs := make(chan error, 2)
+	go func() { errs <- pump(p.ctx, client, upstream, &sent, p.capture.saver("client")) }()
+	go func() { errs <- pump(p.ctx, upstream, client, &received, p.capture.saver("server")) }()
+	err := <-errs
+	// Propagate the close status to the other side, which stops the other pump
+	status := websocket.CloseStatus(err)
+	if status == -1 {
+		client.Close(websocket.StatusGoingAway, "")
+		upstream.Close(websocket.StatusGoingAway, "")
+	} else {
+		// StatusNoStatusRcvd is sent as an empty close frame, like the server does at the end of a TTS stream
+		client.Close(status, "")
+		upstream.Close(status, "")
+	}
+	<-errs
+	if status == -1 {
+		logger.Warn("session aborted", "error", err, "duration", time.Since(start).Round(time.Millisecond),
+			"sent_bytes", sent.Load(), "received_bytes", received.Load(),
+		)
+		return
+	}
+	logger.Info("session ended", "status", status.String(), "duration", time.Since(start).Round(time.Millisecond),
+		"sent_bytes", sent.Load(), "received_bytes", received.Load(),
+	)
+}
+
+// pump copies the messages read on src to dst.
+func pump(ctx context.Context, src, dst *websocket.Conn, bytes *atomic.Int64, capture func([]byte)) error {
+	for {
+		msgType, data, err := src.Read(ctx)
+		if err != nil {
+			return err
+		}
+		if capture != nil && msgType == websocket.MessageBinary {
+			capture(data)
+		}
+		if err = dst.Write(ctx, msgType, data); err != nil {
+			return err
+		}
+		bytes.Add(int64(len(data)))
+	}
+}
+
+// frameCapture saves the first frame of each direction and type, as reference frames for the
+// conformance tests.
+type frameCapture struct {
+	dir    string
+	logger *slog.Logger
+	mutex  sync.Mutex
+	seen   map[string]bool
+}
+
+// capturedTypes are the frame types saved by the capture. The type of a frame names its file and
+// comes from the peers: anything else is ignored rather than written outside the directory.
+var capturedTypes = map[krs.MessagePackType]bool{
+	krs.MessagePackTypeStep:    true,
+	krs.MessagePackTypeWord:    true,
+	krs.MessagePackTypeEndWord: true,
+	krs.MessagePackTypeReady:   true,
+	krs.MessagePackTypeText:    true,
+	krs.MessagePackTypeAudio:   true,
+	krs.MessagePackTypeEoS:     true,
+	krs.MessagePackTypeMarker:  true,
+	krs.MessagePackTypePause:   true,
+	krs.MessagePackTypeResume:  true,
+}
+
+// saver returns the capture function of a direction, nil if the capture is disabled.
+func (fc *frameCapture) saver(direction string) func([]byte) {
+	if fc == nil {
+		return nil
+	}
+	return func(data []byte) {
+		var header krs.MessagePackHeader
+		if _, err := header.UnmarshalMsg(data); err != nil || !capturedTypes[header.Type] {
+			return
+		}
+		name := direction + "-" + string(header.Type)
+		fc.mutex.Lock()
+		defer fc.mutex.Unlock()
+		if fc.seen[name] {
+			return
+		}
+		fc.seen[name] = true
+		filename := filepath.Join(fc.dir, name+".msgpack")
+		if err := os.WriteFile(filename, data, 0o644); err != nil {
+			fc.logger.Warn("failed to save the captured frame", "file", filename, "error", err)
+			return
+		}
+		fc.logger.Info("frame captured", "file", filename)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+type redactOptions struct {
+	audio       string
+	output      string
+	audioOutput string
+	words       []string
+	bleep       bool
+}
+
+func newRedactCommand(g *globals) *cobra.Command {
+	var opts redactOptions
+	cmd := &cobra.Command{
+		Use:   "redact <transcript.json|session.krs>",
+		Short: "Remove the personal information from a transcript and its audio",
+		Long: `Remove the personal information from a transcript and its audio.
+
+The email addresses and the long numbers (phone, card, account...) are matched in the
+transcript, written or spelled out, along with the words given with --words. They are replaced
+by [email], [number] or the rule name in the transcript, and silenced (or bleeped with --bleep)
+in the audio. The redactions are listed on stdout.
+
+A transcript JSON (krs stt --json) is written to --output and its audio, given with --audio, to
+--audio-output. A session bundle (.krs) is redacted as a whole: its transcript and the user
+channel of its audio.`,
+		Example: `  krs redact call.json --audio call.wav --words name=alice,bob --output call.redacted.json --audio-output call.redacted.wav
+  krs redact session.krs --bleep --output session.redacted.krs`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRedact(opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.audio, "audio", "", "Audio file (wav or ogg) the transcript comes from.")
+	cmd.Flags().StringVar(&opts.output, "output", "", "File to write the redacted transcript (or bundle) to.")
+	cmd.Flags().StringVar(&opts.audioOutput, "audio-output", "", "Wave file to write the redacted audio to.")
+	cmd.Flags().StringArrayVar(&opts.words, "words", nil, "Also redact these words, as name=word,word (repeatable).")
+	cmd.Flags().BoolVar(&opts.bleep, "bleep", false, "Replace the redacted audio by a bleep instead of silence.")
+	_ = cmd.MarkFlagRequired("output")
+	_ = cmd.MarkFlagFilename("audio", "wav", "ogg", "oga")
+	_ = cmd.MarkFlagFilename("output", "json", "krs")
+	_ = cmd.MarkFlagFilename("audio-output", "wav")
+	return cmd
+}
+
+func runRedact(opts redactOptions, filename string) (err error) {
+	rules := slices.Clone(krs.DefaultRedactionRules)
+	for _, words := range opts.words {
+		name, list, found := strings.Cut(words, "=")
+		if !found || name == "" || list == "" {
+			return fmt.Errorf("invalid --words %q: expected name=word,word", words)
+		}
+		rules = append(rules, krs.WordsRedactionRule(name, strings.Split(list, ",")...))
+	}
+
+	// Session bundle
+	if strings.HasSuffix(filename, krs.BundleExtension) {
+		var bundle krs.Bundle
+		if bundle, err = krs.OpenBundle(filename); err != nil {
+			return
+		}
+		var redactions []krs.Redaction
+		bundle.Transcript, redactions = bundle.Transcript.Redact(rules)
+		channels := krs.Deinterleave(bundle.Audio, bundle.Metadata.Channels)
+		channels[krs.SessionUserChannel] = krs.RedactAudio(channels[krs.SessionUserChannel], redactions,
+			bundle.Metadata.TranscriptOffset, opts.bleep)
+		bundle.Audio = krs.Interleave(nil, channels...)
+		printRedactions(redactions)
+		return bundle.WriteFile(opts.output)
+	}
+
+	// Transcript and its audio
+	transcript, err := readTranscriptJSON(filename)
+	if err != nil {
+		return
+	}
+	redacted, redactions := transcript.Redact(rules)
+	printRedactions(redactions)
+	if err = writeTranscriptJSON(opts.output, redacted); err != nil {
+		return
+	}
+	if opts.audio == "" {
+		if opts.audioOutput != "" {
+			return fmt.Errorf("--audio-output needs the --audio to redact")
+		}
+		return
+	}
+	if opts.audioOutput == "" {
+		fmt.Fprintln(os.Stderr, "The audio is not redacted: no --audio-output")
+		return
+	}
+	pcm, err := audio.ReadFile(opts.audio)
+	if err != nil {
+		return fmt.Errorf("failed to read audio samples from %q: %w", opts.audio, err)
+	}
+	return writeSamples(opts.audioOutput, krs.RedactAudio(pcm, redactions, krs.STTStreamOffset, opts.bleep))
+}
+
+func printRedactions(redactions []krs.Redaction) {
+	for _, redaction := range redactions {
+		fmt.Printf("%s-%s  [%s] %q\n", formatStreamTime(redaction.Start), formatStreamTime(redaction.End),
+			redaction.Rule, redaction.Text)
+	}
+	if len(redactions) == 0 {
+		fmt.Println("Nothing to redact")
+	}
+}
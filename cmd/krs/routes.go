@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// proxyRoute sends the connections of some clients to an upstream server with its API key.
+type proxyRoute struct {
+	Name string `yaml:"name"`
+	// API keys presented by the clients (kyutai-api-key header), none for the fallback route
+	ClientKeys []string `yaml:"client_keys,omitempty"`
+	Upstream   string   `yaml:"upstream"`
+	// API key references of the upstream server, like the configuration file ones
+	APIKey     string `yaml:"api_key,omitempty"`
+	APIKeyEnv  string `yaml:"api_key_env,omitempty"`
+	APIKeyFile string `yaml:"api_key_file,omitempty"`
+	// MaxSessions overrides --max-sessions for this server
+	MaxSessions int `yaml:"max_sessions,omitempty"`
+	// resolved on load
+	upstreamURL *url.URL
+	apiKey      string
+	admission   *admission
+	// client of the transcription endpoint
+	stt *krs.STTClient
+}
+
+// proxyRoutes is the routing table of the proxy.
+type proxyRoutes struct {
+	// indexed by the SHA-256 of the client keys: the lookup time does not depend on how much of a
+	// wrong key matches
+	byKey    map[[sha256.Size]byte]*proxyRoute
+	fallback *proxyRoute
+	all      []*proxyRoute
+}
+
+// singleRoute is the routing table without routes file: every client goes to the upstream server.
+func singleRoute(upstream, apiKey string) (routes *proxyRoutes, err error) {
+	route := &proxyRoute{Name: "default", Upstream: upstream, apiKey: apiKey}
+	if err = route.resolve(); err != nil {
+		return
+	}
+	routes = &proxyRoutes{fallback: route, all: []*proxyRoute{route}}
+	return
+}
+
+// loadProxyRoutes reads a routes file:
+//
+//	routes:
+//	  - name: research
+//	    client_keys: [key-of-the-research-apps]
+//	    upstream: wss://research.example.com
+//	    api_key_env: RESEARCH_KYUTAI_KEY
+//	    max_sessions: 4
+//	  - name: public
+//	    upstream: wss://kyutai.example.com
+//	    api_key_file: ~/.config/krs/public.key
+//
+// The route without client keys, if any, takes the clients presenting no key or an unknown one.
+func loadProxyRoutes(path string) (routes *proxyRoutes, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read the routes file: %w", err)
+		return
+	}
+	var file struct {
+		Routes []*proxyRoute `yaml:"routes"`
+	}
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		err = fmt.Errorf("failed to parse the routes file %q: %w", path, err)
+		return
+	}
+	if len(file.Routes) == 0 {
+		err = fmt.Errorf("no route in %q", path)
+		return
+	}
+	routes = &proxyRoutes{byKey: make(map[[sha256.Size]byte]*proxyRoute), all: file.Routes}
+	for i, route := range file.Routes {
+		if route.Name == "" {
+			route.Name = fmt.Sprintf("route %d", i+1)
+		}
+		if route.Upstream == "" {
+			err = fmt.Errorf("%s: no upstream server", route.Name)
+			return
+		}
+		if route.apiKey, err = config.ResolveKey(route.APIKey, route.APIKeyEnv, route.APIKeyFile); err != nil {
+			err = fmt.Errorf("%s: %w", route.Name, err)
+			return
+		}
+		if err = route.resolve(); err != nil {
+			err = fmt.Errorf("%s: %w", route.Name, err)
+			return
+		}
+		if len(route.ClientKeys) == 0 {
+			if routes.fallback != nil {
+				err = fmt.Errorf("%s: only one route can have no client keys, %s has none either", route.Name, routes.fallback.Name)
+				return
+			}
+			routes.fallback = route
+			continue
+		}
+		for _, key := range route.ClientKeys {
+			if key == "" {
+				err = fmt.Errorf("%s: empty client key", route.Name)
+				return
+			}
+			hash := sha256.Sum256([]byte(key))
+			if other, found := routes.byKey[hash]; found {
+				err = fmt.Errorf("%s: a client key is already routed to %s", route.Name, other.Name)
+				return
+			}
+			routes.byKey[hash] = route
+		}
+	}
+	return
+}
+
+// resolve prepares the connections to the upstream server.
+func (route *proxyRoute) resolve() (err error) {
+	if route.upstreamURL, err = url.Parse(route.Upstream); err != nil {
+		err = fmt.Errorf("failed to parse the upstream URL: %w", err)
+		return
+	}
+	route.stt, err = krs.NewSTTClient(&krs.STTConfig{URL: route.Upstream, APIKey: route.apiKey})
+	return
+}
+
+// errNoRoute is returned for a client whose key is not routed, without fallback route.
+var errNoRoute = errors.New("no route for the client API key")
+
+// route returns the route of a client API key.
+func (pr *proxyRoutes) route(clientKey string) (route *proxyRoute, err error) {
+	if clientKey != "" {
+		if route = pr.byKey[sha256.Sum256([]byte(clientKey))]; route != nil {
+			return
+		}
+	}
+	if pr.fallback == nil {
+		err = errNoRoute
+		return
+	}
+	return pr.fallback, nil
+}
+
+// limit sets the admission control of the routes, max sessions applies to the routes without
+// their own limit.
+func (pr *proxyRoutes) limit(maxSessions, queue int, maxWait time.Duration) {
+	for _, route := range pr.all {
+		if route.MaxSessions <= 0 {
+			route.MaxSessions = maxSessions
+		}
+		route.admission = newAdmission(route.MaxSessions, queue, maxWait)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRoutes(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProxyRoutes(t *testing.T) {
+	t.Setenv("KRS_TEST_RESEARCH_KEY", "upstream-research")
+	for _, tc := range []struct {
+		name   string
+		routes string
+		// err is a part of the error expected, empty for none
+		err string
+	}{
+		{name: "keys and fallback", routes: `
+routes:
+  - name: research
+    client_keys: [research-1, research-2]
+    upstream: ws://research.example.com
+    api_key_env: KRS_TEST_RESEARCH_KEY
+  - upstream: ws://public.example.com
+`},
+		{name: "no route", routes: "routes: []", err: "no route"},
+		{name: "no upstream", routes: `
+routes:
+  - name: research
+    client_keys: [research-1]
+`, err: "research: no upstream server"},
+		{name: "empty key", routes: `
+routes:
+  - client_keys: [""]
+    upstream: ws://research.example.com
+`, err: "route 1: empty client key"},
+		{name: "duplicate key", routes: `
+routes:
+  - name: research
+    client_keys: [shared]
+    upstream: ws://research.example.com
+  - name: public
+    client_keys: [public, shared]
+    upstream: ws://public.example.com
+`, err: "public: a client key is already routed to research"},
+		{name: "two fallbacks", routes: `
+routes:
+  - name: research
+    upstream: ws://research.example.com
+  - name: public
+    upstream: ws://public.example.com
+`, err: "public: only one route can have no client keys, research has none either"},
+		{name: "missing key file", routes: `
+routes:
+  - name: research
+    upstream: ws://research.example.com
+    api_key_file: /nonexistent/research.key
+`, err: "research: failed to read the API key file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			routes, err := loadProxyRoutes(writeRoutes(t, tc.routes))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got error %v, expected %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(routes.all) != 2 || routes.all[0].apiKey != "upstream-research" || routes.fallback.Name != "route 2" {
+				t.Errorf("got routes %+v, expected research with its key and a fallback", routes.all)
+			}
+		})
+	}
+}
+
+func TestProxyRoute(t *testing.T) {
+	routes, err := loadProxyRoutes(writeRoutes(t, `
+routes:
+  - name: research
+    client_keys: [research-1, research-2]
+    upstream: ws://research.example.com
+  - name: public
+    upstream: ws://public.example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		clientKey, route string
+	}{
+		{"research-1", "research"},
+		{"research-2", "research"},
+		{"research", "public"},
+		{"unknown", "public"},
+		{"", "public"},
+	} {
+		route, err := routes.route(tc.clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if route.Name != tc.route {
+			t.Errorf("key %q routed to %s, expected %s", tc.clientKey, route.Name, tc.route)
+		}
+	}
+	// without fallback, only the known keys are routed
+	routes.fallback = nil
+	if _, err = routes.route("research-1"); err != nil {
+		t.Error(err)
+	}
+	for _, clientKey := range []string{"unknown", ""} {
+		if _, err = routes.route(clientKey); !errors.Is(err, errNoRoute) {
+			t.Errorf("got %v for key %q, expected errNoRoute", err, clientKey)
+		}
+	}
+	// a single upstream takes every client
+	single, err := singleRoute("ws://kyutai.example.com", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route, err := single.route("anything"); err != nil || route.apiKey != "key" {
+		t.Errorf("got route %+v (%v), expected the single one", route, err)
+	}
+}
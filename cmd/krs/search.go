@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type searchOptions struct {
+	index string
+	limit int
+	json  bool
+}
+
+const searchBuildNote = `The index is a SQLite FTS5 database: krs must be built with cgo and the sqlite_fts5 build tag
+(go install -tags sqlite_fts5 github.com/hekmon/kyutai-rs/cmd/krs@latest).`
+
+func newIndexCommand(g *globals) *cobra.Command {
+	var opts searchOptions
+	cmd := &cobra.Command{
+		Use:   "index <transcript.json>...",
+		Short: "Add transcripts to the full-text search index",
+		Long: `Add transcripts to the full-text search index queried by krs search.
+
+The transcripts are the JSON exports of krs stt --json, indexed one segment per utterance with
+its timestamps, the file name (without extension) being the session name. Indexing a file again
+replaces its previous version.
+
+` + searchBuildNote,
+		Example: `  krs index calls/*.json`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIndex(opts, args)
+		},
+	}
+	cmd.Flags().StringVar(&opts.index, "index", "", "Index database file (default in the user cache directory).")
+	return cmd
+}
+
+func newSearchCommand(g *globals) *cobra.Command {
+	var opts searchOptions
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search the indexed transcripts",
+		Long: `Search the transcripts indexed by krs index.
+
+Each matching utterance is printed with its session, timestamp and the matches highlighted, the
+best matches first. The query is a SQLite FTS5 query: words (all of them must match), "quoted
+phrases", prefix* searches and the OR and NOT operators.
+
+` + searchBuildNote,
+		Example: `  krs search '"cancel my subscription"'
+  krs search 'refund OR chargeback' --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSearch(opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.index, "index", "", "Index database file (default in the user cache directory).")
+	cmd.Flags().IntVar(&opts.limit, "limit", 20, "Maximum number of results.")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print the results as JSON.")
+	return cmd
+}
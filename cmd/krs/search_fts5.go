@@ -0,0 +1,60 @@
+//go:build sqlite_fts5
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/search"
+)
+
+func openIndex(path string) (index *search.Index, err error) {
+	if path == "" {
+		if path, err = search.DefaultPath(); err != nil {
+			return
+		}
+	}
+	return search.Open(path)
+}
+
+func runIndex(opts searchOptions, filenames []string) (err error) {
+	index, err := openIndex(opts.index)
+	if err != nil {
+		return
+	}
+	defer index.Close()
+	for _, filename := range filenames {
+		transcript, err := readTranscriptJSON(filename)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if err = index.Add(filename, transcript); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		fmt.Fprintf(os.Stderr, "Indexed %q (%d utterances)\n", filename, len(transcript.Utterances))
+	}
+	return
+}
+
+func runSearch(opts searchOptions, query string) (err error) {
+	index, err := openIndex(opts.index)
+	if err != nil {
+		return
+	}
+	defer index.Close()
+	results, err := index.Search(query, opts.limit)
+	if err != nil {
+		return
+	}
+	if opts.json {
+		return writeJSON(os.Stdout, results)
+	}
+	for _, result := range results {
+		fmt.Printf("%s #%d %s  %s\n", result.Session, result.Utterance+1, formatStreamTime(result.Start), result.Snippet)
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "No match")
+	}
+	return
+}
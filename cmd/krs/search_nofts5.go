@@ -0,0 +1,15 @@
+//go:build !sqlite_fts5
+
+package main
+
+import "errors"
+
+var errNoSearchIndex = errors.New("the search index is not available in this build: rebuild krs with cgo and -tags sqlite_fts5")
+
+func runIndex(opts searchOptions, filenames []string) error {
+	return errNoSearchIndex
+}
+
+func runSearch(opts searchOptions, query string) error {
+	return errNoSearchIndex
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptible handles SIGINT/SIGTERM in two stages: the first signal cancels interruptCtx (used
+// to stop the input and let the connection drain cleanly) and the second one cancels abortCtx (used
+// to abort the connection). onInterrupt, if set, is called on the first signal. stop must be
+// called to release the signal handler.
+func interruptible(onInterrupt func()) (interruptCtx, abortCtx context.Context, stop func()) {
+	interruptCtx, interrupt := context.WithCancel(context.Background())
+	abortCtx, abort := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-signals:
+			if onInterrupt != nil {
+				onInterrupt()
+			}
+			interrupt()
+		}
+		select {
+		case <-done:
+		case <-signals:
+			abort()
+		}
+	}()
+	stop = func() {
+		signal.Stop(signals)
+		close(done)
+		interrupt()
+		abort()
+	}
+	return
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+)
+
+const defaultPlayer = "ffplay -hide_banner -loglevel error -nodisp -f f32le -ar 24000 -ch_layout mono -i pipe:"
+
+type speakOptions struct {
+	server       string
+	voice        string
+	player       string
+	poll         time.Duration
+	fromStart    bool
+	cacheDir     string
+	noVoiceCheck bool
+	network      networkOptions
+}
+
+func newSpeakCommand(g *globals) *cobra.Command {
+	var opts speakOptions
+	cmd := &cobra.Command{
+		Use:   "speak <file>",
+		Short: "Speak each line appended to a file or written to a FIFO",
+		Long: `Speak each line appended to a file or written to a FIFO.
+
+Each new line is synthesized as an utterance and played on the audio device, one after the
+other: useful to announce alerts, speak logs or get screen-reader-like notifications from
+scripts. A regular file is followed like tail -F (rotations and truncations included), a FIFO
+is reopened each time its writer closes it.
+
+The raw samples (mono float32 at 24kHz) are played by the --player command, reading them on
+its standard input.
+
+Hitting Ctrl-C stops watching but lets the lines already queued be spoken. Interrupt a second
+time to stop right away.`,
+		Example: `  mkfifo /tmp/announce && krs speak /tmp/announce &
+  echo "Backup done." > /tmp/announce`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSpeak(g, opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.voice, "voice", g.cfg.VoiceOr(defaultVoice), "The voice to use for synthesis (see the voices command).")
+	cmd.Flags().StringVar(&opts.player, "player", defaultPlayer, "Command playing the raw audio samples read on its standard input.")
+	cmd.Flags().DurationVar(&opts.poll, "poll", 250*time.Millisecond, "How often a regular file is checked for new lines.")
+	cmd.Flags().BoolVar(&opts.fromStart, "from-start", false, "Also speak the lines already in the file, instead of only the new ones.")
+	cmd.Flags().StringVar(&opts.cacheDir, "cache-dir", "", "Play the lines cached in this synthesis cache directory (see prewarm) without synthesizing them, and cache the new ones.")
+	cmd.Flags().BoolVar(&opts.noVoiceCheck, "no-voice-check", false, "Do not check the voice exists in the voices repository (for voices local to the server).")
+	opts.network.addFlags(cmd)
+	_ = cmd.RegisterFlagCompletionFunc("voice", completeVoices)
+	_ = cmd.MarkFlagDirname("cache-dir")
+	return cmd
+}
+
+func runSpeak(g *globals, opts speakOptions, filename string) (err error) {
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	interruptCtx, abortCtx, stop := interruptible(func() {
+		fmt.Fprintln(os.Stderr, "\nInterrupted: speaking the lines already queued (interrupt again to stop)")
+	})
+	defer stop()
+
+	// Create the Kyutai TTS client
+	config := &krs.TTSConfig{
+		URL:           opts.server,
+		APIKey:        apiKey,
+		Voice:         opts.voice,
+		Network:       opts.network.conditions(),
+		RealtimeGuard: realtimeWarning(g.logger),
+		Cache:         synthesisCache(opts.cacheDir, 0, 0),
+		Tags:          g.tags,
+	}
+	if !opts.noVoiceCheck {
+		config.VoiceGallery = voiceGallery(krs.DefaultVoiceRepository)
+	}
+	ttsClient, err := krs.NewTTSClient(config)
+	if err != nil {
+		return
+	}
+
+	// Start the player and the speaker
+	sink, err := startPlayer(opts.player)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := sink.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	speaker := krs.NewSpeaker(abortCtx, ttsClient, sink)
+	defer speaker.Close()
+
+	// Speak the new lines until interrupted
+	lines, err := followLines(interruptCtx, g.logger, filename, opts.poll, opts.fromStart)
+	if err != nil {
+		return
+	}
+	g.logger.Info("speaking new lines", "file", filename)
+	var last <-chan error
+	for line := range lines {
+		result := speaker.Say(line, krs.PriorityNormal)
+		go func() {
+			if err := <-result; err != nil {
+				g.logger.Error("failed to speak a line", "line", line, "error", err)
+			}
+		}()
+		last = result
+	}
+	// Let the queued lines be spoken (the utterances are played in order)
+	if last != nil {
+		select {
+		case <-last:
+		case <-abortCtx.Done():
+		}
+	}
+	return
+}
+
+// playerSink plays the audio by writing it on the standard input of a player command.
+type playerSink struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func startPlayer(commandLine string) (sink *playerSink, err error) {
+	args := strings.Fields(commandLine)
+	if len(args) == 0 {
+		return nil, errors.New("no player command")
+	}
+	sink = &playerSink{
+		cmd: exec.Command(args[0], args[1:]...),
+	}
+	sink.cmd.Stderr = os.Stderr
+	if sink.stdin, err = sink.cmd.StdinPipe(); err != nil {
+		err = fmt.Errorf("failed to get the player standard input: %w", err)
+		return
+	}
+	if err = sink.cmd.Start(); err != nil {
+		err = fmt.Errorf("failed to start the player %q: %w", args[0], err)
+		return
+	}
+	return
+}
+
+// WritePCM blocks while the player buffers are full: the speaker is paced by the playback.
+func (ps *playerSink) WritePCM(pcm []float32) (err error) {
+	if err = audio.WriteRaw(ps.stdin, pcm); err != nil {
+		err = fmt.Errorf("failed to write the audio to the player: %w", err)
+	}
+	return
+}
+
+// Discard can not drop the samples already buffered by the player: the end of an interrupted
+// utterance is still heard (a fraction of a second).
+func (ps *playerSink) Discard() {}
+
+// Close lets the player finish the samples it has buffered.
+func (ps *playerSink) Close() (err error) {
+	_ = ps.stdin.Close()
+	if err = ps.cmd.Wait(); err != nil {
+		err = fmt.Errorf("player failed: %w", err)
+	}
+	return
+}
+
+// followLines sends the lines added to a regular file (following rotations and truncations) or
+// written to a FIFO, until ctx is done.
+func followLines(ctx context.Context, logger *slog.Logger, filename string, poll time.Duration, fromStart bool) (<-chan string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat the file to watch: %w", err)
+	}
+	lines := make(chan string)
+	follower := &lineFollower{
+		ctx:      ctx,
+		logger:   logger,
+		filename: filename,
+		poll:     poll,
+		lines:    lines,
+	}
+	fifo := info.Mode()&os.ModeNamedPipe != 0
+	// a regular file is opened right away to not miss the lines added meanwhile
+	if !fifo {
+		if err = follower.open(fromStart); err != nil {
+			return nil, err
+		}
+	}
+	go func() {
+		defer close(lines)
+		if fifo {
+			follower.fifo()
+		} else {
+			follower.follow()
+		}
+	}()
+	return lines, nil
+}
+
+type lineFollower struct {
+	ctx      context.Context
+	logger   *slog.Logger
+	filename string
+	poll     time.Duration
+	lines    chan<- string
+	// regular file
+	file   *os.File
+	reader *bufio.Reader
+	offset int64
+	// an incomplete line waiting for its end
+	partial string
+}
+
+// fifo reads the lines of each writer, opening a FIFO blocks until a writer comes.
+func (lf *lineFollower) fifo() {
+	for {
+		opened := make(chan *os.File, 1)
+		go func() {
+			file, err := os.Open(lf.filename)
+			if err != nil {
+				lf.logger.Error("failed to open the FIFO", "error", err)
+			}
+			opened <- file
+		}()
+		var file *os.File
+		select {
+		case <-lf.ctx.Done():
+			return
+		case file = <-opened:
+			if file == nil {
+				return
+			}
+		}
+		// reads are interrupted by closing the file
+		stop := context.AfterFunc(lf.ctx, func() { file.Close() })
+		lf.read(bufio.NewReader(file))
+		stop()
+		file.Close()
+		lf.flush()
+		if lf.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// open (re)opens the regular file, at its end unless start is set.
+func (lf *lineFollower) open(start bool) (err error) {
+	if lf.file != nil {
+		lf.file.Close()
+		lf.file = nil
+	}
+	file, err := os.Open(lf.filename)
+	if err != nil {
+		err = fmt.Errorf("failed to open the file to watch: %w", err)
+		return
+	}
+	lf.offset = 0
+	if !start {
+		if lf.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			err = fmt.Errorf("failed to seek the end of the file to watch: %w", err)
+			return
+		}
+	}
+	lf.file = file
+	lf.reader = bufio.NewReader(file)
+	lf.partial = ""
+	return
+}
+
+// follow polls the regular file for new lines, reopening it when it is replaced (log rotation)
+// and starting over when it is truncated.
+func (lf *lineFollower) follow() {
+	defer func() {
+		if lf.file != nil {
+			lf.file.Close()
+		}
+	}()
+	ticker := time.NewTicker(lf.poll)
+	defer ticker.Stop()
+	for {
+		if lf.file != nil {
+			lf.offset += lf.read(lf.reader)
+		}
+		select {
+		case <-lf.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// check for a rotation or a truncation
+		current, err := os.Stat(lf.filename)
+		switch {
+		case err != nil:
+			// removed, wait for the new file
+		case lf.file == nil:
+			if err = lf.open(true); err != nil {
+				lf.logger.Error("failed to reopen the watched file", "error", err)
+			}
+		default:
+			if opened, err := lf.file.Stat(); err != nil || !os.SameFile(opened, current) {
+				lf.logger.Debug("watched file replaced, reopening it")
+				// the last lines written to the previous file
+				lf.read(lf.reader)
+				lf.flush()
+				if err = lf.open(true); err != nil {
+					lf.logger.Error("failed to reopen the watched file", "error", err)
+				}
+			} else if current.Size() < lf.offset {
+				lf.logger.Debug("watched file truncated, starting over")
+				if _, err = lf.file.Seek(0, io.SeekStart); err == nil {
+					lf.offset = 0
+					lf.reader.Reset(lf.file)
+					lf.partial = ""
+				}
+			}
+		}
+	}
+}
+
+// read sends the complete lines available and returns the number of bytes consumed.
+func (lf *lineFollower) read(reader *bufio.Reader) (read int64) {
+	for {
+		chunk, err := reader.ReadString('\n')
+		read += int64(len(chunk))
+		if err != nil {
+			lf.partial += chunk
+			if !errors.Is(err, io.EOF) && lf.ctx.Err() == nil {
+				lf.logger.Error("failed to read the watched file", "error", err)
+			}
+			return
+		}
+		lf.send(lf.partial + chunk)
+		lf.partial = ""
+	}
+}
+
+// flush sends the last line of a writer which did not end it.
+func (lf *lineFollower) flush() {
+	lf.send(lf.partial)
+	lf.partial = ""
+}
+
+func (lf *lineFollower) send(line string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	select {
+	case <-lf.ctx.Done():
+	case lf.lines <- line:
+	}
+}
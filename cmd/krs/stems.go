@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+// stem is a sentence synthesized to its own wave file, in the manifest of a stems export.
+type stem struct {
+	Index int    `json:"index"`
+	File  string `json:"file"`
+	Text  string `json:"text"`
+	// Offset is where the stem starts in the narration, with --stem-gap between the stems
+	Offset   float64 `json:"offset"`
+	Duration float64 `json:"duration"`
+}
+
+// stemsTTS synthesizes each sentence of the input to its own wave file in directory, along with a
+// manifest of their offsets in the narration (manifest.json and manifest.csv) to arrange them in
+// a DAW. An interrupt stops after the sentence being synthesized, the manifest lists the stems
+// written.
+func stemsTTS(ttsClient *krs.TTSClient, opts ttsOptions, interruptCtx, abortCtx context.Context) (err error) {
+	if err = os.MkdirAll(opts.stems, 0o755); err != nil {
+		return fmt.Errorf("failed to create the stems directory: %w", err)
+	}
+	sentences := bufio.NewScanner(textInput(interruptCtx, opts.input))
+	sentences.Split(bufio.SplitFunc(krs.ChunkSentences))
+	var (
+		stems  []stem
+		offset time.Duration
+	)
+	for sentences.Scan() && interruptCtx.Err() == nil {
+		// the sentences of hard wrapped text span several lines
+		text := strings.Join(strings.Fields(sentences.Text()), " ")
+		if text == "" {
+			continue
+		}
+		var pcm []float32
+		if pcm, err = ttsClient.Synthesize(abortCtx, text); err != nil {
+			return fmt.Errorf("failed to synthesize sentence %d: %w", len(stems)+1, err)
+		}
+		duration := time.Duration(len(pcm)) * time.Second / krs.SampleRate
+		s := stem{
+			Index:    len(stems) + 1,
+			File:     fmt.Sprintf("%03d.wav", len(stems)+1),
+			Text:     text,
+			Offset:   offset.Seconds(),
+			Duration: duration.Seconds(),
+		}
+		if err = writeSamples(filepath.Join(opts.stems, s.File), pcm); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s  %s  %s\n", s.File, formatStreamTime(offset), text)
+		stems = append(stems, s)
+		offset += duration + opts.stemGap
+	}
+	if err = sentences.Err(); err != nil {
+		return fmt.Errorf("failed to read the input: %w", err)
+	}
+	if err = writeFile(filepath.Join(opts.stems, "manifest.json"), func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Voice      string  `json:"voice"`
+			SampleRate int     `json:"sample_rate"`
+			Gap        float64 `json:"gap"`
+			Stems      []stem  `json:"stems"`
+		}{
+			Voice:      opts.voice,
+			SampleRate: krs.SampleRate,
+			Gap:        opts.stemGap.Seconds(),
+			Stems:      stems,
+		})
+	}); err != nil {
+		return
+	}
+	if err = writeFile(filepath.Join(opts.stems, "manifest.csv"), func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		seconds := func(s float64) string {
+			return strconv.FormatFloat(s, 'f', 3, 64)
+		}
+		_ = writer.Write([]string{"index", "file", "offset", "duration", "text"})
+		for _, s := range stems {
+			_ = writer.Write([]string{strconv.Itoa(s.Index), s.File, seconds(s.Offset), seconds(s.Duration), s.Text})
+		}
+		writer.Flush()
+		return writer.Error()
+	}); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d stems and their manifest written to %q\n", len(stems), opts.stems)
+	return
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/chart"
+	"github.com/hekmon/liveprogress/v2"
+	"github.com/spf13/cobra"
+)
+
+// server pause prediction above which an utterance is over (a new line of the transcript)
+const pauseThreshold = 0.5
+
+// classifyTimeout is the time budget of the classification service per utterance
+const classifyTimeout = 10 * time.Second
+
+type sttOptions struct {
+	server      string
+	inputs      []string
+	trace       string
+	timeline    bool
+	timelinePNG string
+	srt         string
+	json        string
+	delay       time.Duration
+	coalesce    time.Duration
+	powerSaver  bool
+	normalize   bool
+	start       time.Duration
+	duration    time.Duration
+	relative    bool
+	keywords    []string
+	classify    string
+	network     networkOptions
+}
+
+func newSTTCommand(g *globals) *cobra.Command {
+	var opts sttOptions
+	cmd := &cobra.Command{
+		Use:   "stt",
+		Short: "Transcribe an audio file with a Kyutai STT server",
+		Long: `Transcribe an audio file with a Kyutai STT server.
+
+The input format is detected from its content, whatever its extension: wave and Ogg Vorbis files
+are converted to mono 24kHz, anything else is read as raw little endian float32 samples (mono
+24kHz), for example on stdin (use - as input). FLAC, MP3 and Opus are recognized but must be
+converted first, for example by ffmpeg:
+
+  ffmpeg -i speech.opus -f f32le -ar 24000 -ac 1 pipe: | krs stt --input -
+
+The parts of a multi-part recording (dashcam, segmented meeting recordings...) are transcribed as
+one continuous timeline by repeating --input in order: the part start times are printed.
+
+Hitting Ctrl-C stops streaming audio but lets the server flush its buffers so the transcript
+of the audio already sent is complete. Interrupt a second time to abort right away.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSTT(g, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.STTURL(defaultServer), "The websocket URL of the Kyutai STT server.")
+	cmd.Flags().StringArrayVar(&opts.inputs, "input", []string{"audio.wav"}, "Audio file to open (wav, ogg or raw float32). Use - for stdin. Repeat it to transcribe the parts of a recording as one timeline.")
+	cmd.Flags().StringVar(&opts.trace, "trace", "", "Write the connection timings to this file as a Chrome tracing JSON (chrome://tracing or Perfetto).")
+	cmd.Flags().DurationVar(&opts.delay, "delay", 0, "Ask the server for this transcription delay if it supports it: longer is more accurate (for example 500ms or 2.5s).")
+	cmd.Flags().DurationVar(&opts.coalesce, "coalesce", 0, "Batch the audio frames queued for up to this duration in a single message when the network is slower than the input (for example 200ms).")
+	cmd.Flags().BoolVar(&opts.powerSaver, "power-saver", false, "Trade latency for fewer messages and wake ups (coalesced frames, fewer steps, rare keepalives).")
+	cmd.Flags().DurationVar(&opts.start, "start", 0, "Transcribe the recording from this time (for example 1h02m30s), cut at the sample: only the slice is streamed.")
+	cmd.Flags().DurationVar(&opts.duration, "duration", 0, "Transcribe only this much of the recording from --start, 0 for up to the end.")
+	cmd.Flags().BoolVar(&opts.relative, "relative", false, "Report the times relative to the slice transcribed with --start instead of the recording.")
+	cmd.Flags().BoolVar(&opts.normalize, "normalize", false, "Bring the speech of a badly leveled recording (too quiet or too loud) to a common level before transcribing it.")
+	cmd.Flags().StringArrayVar(&opts.keywords, "keyword", nil, "Report each time this phrase is said, tolerating small transcription mistakes (repeatable).")
+	cmd.Flags().StringVar(&opts.classify, "classify-url", "", "Label each utterance (intent, sentiment...) with this HTTP classification service, the labels are printed and exported in the JSON transcript.")
+	cmd.Flags().StringVar(&opts.srt, "srt", "", "Write the transcript as SubRip subtitles to this file.")
+	cmd.Flags().StringVar(&opts.json, "json", "", "Write the transcript as JSON (with the word timings and the tags) to this file.")
+	cmd.Flags().BoolVar(&opts.timeline, "timeline", false, "Chart the server step rate and buffered audio over time once done.")
+	cmd.Flags().StringVar(&opts.timelinePNG, "timeline-png", "", "Write the server step rate and buffered audio chart to this PNG file.")
+	opts.network.addFlags(cmd)
+	_ = cmd.MarkFlagFilename("input", "wav", "ogg", "oga", "f32")
+	_ = cmd.MarkFlagFilename("srt", "srt")
+	_ = cmd.MarkFlagFilename("json", "json")
+	_ = cmd.MarkFlagFilename("timeline-png", "png")
+	_ = cmd.MarkFlagFilename("trace", "json")
+	return cmd
+}
+
+func runSTT(g *globals, opts sttOptions) (err error) {
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	interruptCtx, abortCtx, stop := interruptible(func() {
+		fmt.Fprintln(liveprogress.Bypass(), "\nInterrupted: flushing the transcription (interrupt again to abort)")
+	})
+	defer stop()
+
+	// Create the Kyutai STT client
+	sttClient, err := krs.NewSTTClient(&krs.STTConfig{
+		URL:           opts.server,
+		APIKey:        apiKey,
+		Delay:         opts.delay,
+		Coalesce:      opts.coalesce,
+		PowerSaver:    opts.powerSaver,
+		Network:       opts.network.conditions(),
+		RealtimeGuard: realtimeWarning(g.logger),
+		Tags:          g.tags,
+	})
+	if err != nil {
+		return
+	}
+
+	// Gather the audio samples, the parts of a recording are chained on a single timeline
+	var audioSamples []float32
+	for i, input := range opts.inputs {
+		var part []float32
+		if part, err = audio.Read(input); err != nil {
+			return fmt.Errorf("failed to read audio samples from %q: %w", input, err)
+		}
+		if len(opts.inputs) > 1 {
+			fmt.Printf("Part %d (%s) starts at %s\n", i+1, input,
+				formatStreamTime(krs.STTStreamOffset+time.Duration(len(audioSamples))*time.Second/krs.SampleRate))
+		}
+		audioSamples = append(audioSamples, part...)
+	}
+	fmt.Printf("Audio duration: %s (%d samples @%dHz)\n",
+		time.Duration(len(audioSamples))*time.Second/krs.SampleRate, len(audioSamples), krs.SampleRate,
+	)
+	// Only stream the slice asked for, the times are shifted back to the recording ones at the end
+	var offset time.Duration
+	if opts.start != 0 || opts.duration != 0 {
+		if audioSamples, offset, err = sliceAudio(audioSamples, opts.start, opts.duration); err != nil {
+			return
+		}
+		fmt.Printf("Transcribing %s from %s\n",
+			time.Duration(len(audioSamples))*time.Second/krs.SampleRate, offset)
+		if opts.relative {
+			offset = 0
+		}
+	}
+	// Badly leveled recordings are a common cause of poor transcripts
+	var levels krs.InputLevels
+	if opts.normalize {
+		levels = krs.NormalizeInput(audioSamples)
+	} else {
+		levels = krs.AnalyzeInput(audioSamples)
+	}
+	fmt.Printf("Audio levels: peak %.1f dBFS, speech %.1f dBFS\n", levels.Peak, levels.Speech)
+	for _, warning := range levels.Warnings() {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	if levels.Gain != 0 {
+		fmt.Printf("Normalized with a gain of %+.1f dB\n", levels.Gain)
+	}
+
+	// Open a connection
+	fmt.Printf("Opening a connection...")
+	sttConn, err := sttClient.Connect(abortCtx)
+	if err != nil {
+		fmt.Println()
+		return
+	}
+	fmt.Println(" connected")
+	defer sttConn.Close()
+	inputCtx, stopInput := context.WithCancel(sttConn.GetContext())
+	defer stopInput()
+	context.AfterFunc(interruptCtx, stopInput)
+
+	// Prepare the dynamic output
+	if err = liveprogress.Start(); err != nil {
+		return
+	}
+	defer func() {
+		if stopErr := liveprogress.Stop(true); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}()
+
+	// Start processing input and output independently
+	go logFlowControl(sttConn.GetContext(), g.logger, sttConn.FlowControl())
+	go logStates(g.logger, sttConn.Subscribe())
+	coms := make(chan latencyMarker)
+	received := make(chan struct{})
+	transcript := krs.Transcript{Tags: sttConn.Tags(), Input: &levels}
+	var keywords *krs.KeywordMatcher
+	if len(opts.keywords) > 0 {
+		keywords = krs.NewKeywordMatcher(krs.KeywordConfig{
+			Phrases: opts.keywords,
+			OnMatch: func(match krs.KeywordMatch) {
+				fmt.Fprintf(liveprogress.Bypass(), "Keyword %q at %s (heard %q)\n",
+					match.Phrase, (match.Start() + offset).Round(100*time.Millisecond), match.Text(),
+				)
+			},
+		})
+	}
+	go func() {
+		receiveTranscript(sttConn, coms, &transcript, keywords)
+		close(received)
+	}()
+	if err = sendAudio(inputCtx, sttConn, coms, audioSamples); err != nil {
+		return // the deferred stop aborts the connection
+	}
+
+	// Wait until the connection is done and collect error if any
+	if err = sttConn.Done(); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			return
+		}
+		err = nil
+		fmt.Fprintln(liveprogress.Bypass(), "Connection aborted, the transcript is incomplete")
+	}
+	<-received
+	if offset != 0 {
+		transcript = transcript.Shift(offset)
+	}
+
+	// Label the utterances
+	if opts.classify != "" {
+		if err = transcript.Classify(abortCtx, krs.HTTPClassifier{URL: opts.classify}, classifyTimeout); err != nil {
+			return
+		}
+		for i, utterance := range transcript.Utterances {
+			fmt.Fprintf(liveprogress.Bypass(), "Utterance %d: %s\n", i+1, krs.Tags(utterance.Labels))
+		}
+	}
+
+	// Export the subtitles
+	if opts.srt != "" {
+		if err = writeSRT(opts.srt, transcript); err != nil {
+			return
+		}
+		fmt.Fprintf(liveprogress.Bypass(), "Subtitles written to %q\n", opts.srt)
+	}
+	if opts.json != "" {
+		if err = writeTranscriptJSON(opts.json, transcript); err != nil {
+			return
+		}
+		fmt.Fprintf(liveprogress.Bypass(), "Transcript written to %q\n", opts.json)
+	}
+
+	// Export the timings
+	if opts.trace != "" {
+		if err = writeSTTTrace(opts.trace, sttConn); err != nil {
+			return
+		}
+		fmt.Fprintf(liveprogress.Bypass(), "Trace written to %q\n", opts.trace)
+	}
+	if opts.timeline || opts.timelinePNG != "" {
+		if err = writeTimeline(liveprogress.Bypass(), opts.timeline, opts.timelinePNG, sttConn.Timeline()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// writeTimeline charts the server progress to tell apart model throughput and network issues.
+func writeTimeline(w io.Writer, ascii bool, pngFilename string, timeline krs.Timeline) (err error) {
+	if len(timeline.Steps) == 0 {
+		fmt.Fprintln(w, "No step received, no timeline to chart")
+		return
+	}
+	// about 100 columns
+	interval := max(time.Second, (timeline.Duration() / 100).Round(100*time.Millisecond))
+	buckets := timeline.Buckets(interval)
+	rate := chart.Series{
+		Name:      "Server steps",
+		Unit:      "steps/s",
+		Color:     color.RGBA{30, 100, 200, 255},
+		Reference: krs.StepsPerSecond,
+		Values:    make([]float64, len(buckets)),
+	}
+	buffered := chart.Series{
+		Name:   "Buffered audio",
+		Unit:   "seconds",
+		Color:  color.RGBA{200, 50, 30, 255},
+		Values: make([]float64, len(buckets)),
+	}
+	for i, bucket := range buckets {
+		rate.Values[i] = bucket.StepsPerSecond
+		buffered.Values[i] = bucket.MaxBuffered.Seconds()
+	}
+	fmt.Fprintf(w, "Mean step rate: %.2f steps/s (real time is %.2f)\n", timeline.StepRate(), krs.StepsPerSecond)
+	if ascii {
+		if err = chart.WriteASCII(w, interval, 8, rate, buffered); err != nil {
+			return
+		}
+	}
+	if pngFilename != "" {
+		var file *os.File
+		if file, err = os.Create(pngFilename); err != nil {
+			return fmt.Errorf("failed to create %q file: %w", pngFilename, err)
+		}
+		defer file.Close()
+		if err = chart.WritePNG(file, 1000, 250, rate, buffered); err != nil {
+			return
+		}
+		fmt.Fprintf(w, "Timeline chart written to %q (steps/s in blue, buffered seconds in red)\n", pngFilename)
+	}
+	return
+}
+
+func writeSRT(filename string, transcript krs.Transcript) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %q file: %w", filename, err)
+	}
+	defer file.Close()
+	return transcript.WriteSRT(file)
+}
+
+func readTranscriptJSON(filename string) (transcript krs.Transcript, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		err = fmt.Errorf("failed to read the transcript: %w", err)
+		return
+	}
+	if err = json.Unmarshal(data, &transcript); err != nil {
+		err = fmt.Errorf("failed to decode the transcript JSON: %w", err)
+		return
+	}
+	return
+}
+
+func writeTranscriptJSON(filename string, transcript krs.Transcript) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %q file: %w", filename, err)
+	}
+	defer file.Close()
+	return transcript.WriteJSON(file)
+}
+
+func writeSTTTrace(filename string, conn *krs.STTConnection) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %q file: %w", filename, err)
+	}
+	defer file.Close()
+	if err = conn.WriteTrace(file); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	stats := conn.Stats()
+	latency := stats.MeanLatency()
+	fmt.Fprintf(liveprogress.Bypass(), "Mean word latency: %s (client queue %s, network %s, server %s, decode %s)\n",
+		latency.Total().Round(time.Millisecond), latency.ClientQueue.Round(time.Microsecond),
+		latency.Network.Round(time.Microsecond), latency.ServerBuffer.Round(time.Millisecond),
+		latency.Decode.Round(time.Microsecond),
+	)
+	fmt.Fprintf(liveprogress.Bypass(), "End of stream flush: %s\n", stats.Drain.Round(time.Millisecond))
+	fmt.Fprintf(liveprogress.Bypass(), "Realtime factor: %.2f (%s of audio sent, %s processed in %s)\n", stats.RealtimeFactor(),
+		stats.AudioSent.Round(time.Millisecond), stats.AudioReceived.Round(time.Millisecond),
+		stats.AudioWallClock.Round(time.Millisecond),
+	)
+	return
+}
+
+func receiveTranscript(conn *krs.STTConnection, coms chan latencyMarker, transcript *krs.Transcript, keywords *krs.KeywordMatcher) {
+	ctx := conn.GetContext()
+	receiver := conn.GetReadChan()
+	var latencies []time.Duration
+	defer func() {
+		var avg int64
+		for _, latency := range latencies {
+			avg += int64(latency)
+		}
+		if len(latencies) > 0 {
+			avg /= int64(len(latencies))
+		}
+		// Final print before removing live line
+		fmt.Fprintf(liveprogress.Bypass(), "\nAverage latency: %s\nTranscripted text:\n%s\n",
+			time.Duration(avg).Round(time.Millisecond), transcript.Text(),
+		)
+	}()
+	// Prepare the dynamic lines
+	//// Stats
+	var (
+		currentTimestamp time.Duration
+		latency          time.Duration
+		bufferDelay      time.Duration
+		steps            int
+	)
+	statsLine := liveprogress.AddCustomLine(func() string {
+		return fmt.Sprintf("Current timestamp: %s | Latency: %s | Upstream buffer delay: %s | Server steps: %d",
+			currentTimestamp, latency, bufferDelay, steps,
+		)
+	})
+	defer liveprogress.RemoveCustomLine(statsLine)
+	//// Text
+	textLine := liveprogress.AddCustomLine(func() string {
+		return transcript.Live()
+	})
+	defer liveprogress.RemoveCustomLine(textLine)
+	// Process output
+	var (
+		receivedMsgPack krs.MessagePack
+		open            bool
+		latmark         latencyMarker
+	)
+	latmarks := make(map[int64]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			// connection context canceled, stop using the receiver channel
+			return
+		case receivedMsgPack, open = <-receiver:
+			if !open {
+				// End of server stream
+				// Actually there is high chance we will exit because of ctx.Done():
+				// Once the connection sender and receiver are both done, the connection context is canceled
+				// So this is a race within the go runtime:
+				// is the channel will be closed and read here first
+				// or the connection context canceled and read here?
+				return
+			}
+			switch msgPackTyped := receivedMsgPack.(type) {
+			case krs.MessagePackHeader:
+				if msgPackTyped.Type == krs.MessagePackTypeReady {
+					coms <- latencyMarker{} // send an ID 0 marker as a start signal
+				}
+			case krs.MessagePackStep:
+				bufferDelay = msgPackTyped.BufferDelay()
+				steps = msgPackTyped.StepIndex
+				if msgPackTyped.PausePrediction() > pauseThreshold {
+					transcript.EndUtterance()
+				}
+			case krs.MessagePackWord:
+				word := krs.Word{
+					Text:  msgPackTyped.Text,
+					Start: msgPackTyped.StartTimeDuration(),
+				}
+				transcript.AddWord(word)
+				if keywords != nil {
+					keywords.Feed(word)
+				}
+				currentTimestamp = msgPackTyped.StartTimeDuration()
+			case krs.MessagePackWordEnd:
+				transcript.SetWordEnd(msgPackTyped.StopTimeDuration())
+				currentTimestamp = msgPackTyped.StopTimeDuration()
+			case krs.MessagePackMarker:
+				// Compute duration between the marker time and the received time
+				sentAt, found := latmarks[msgPackTyped.ID]
+				if !found {
+					// sender was interrupted before registering it
+					continue
+				}
+				latency = time.Since(sentAt).Round(time.Millisecond)
+				latencies = append(latencies, latency)
+				delete(latmarks, msgPackTyped.ID)
+			default:
+				fmt.Fprintf(liveprogress.Bypass(), "Received msg pack type %q\n", receivedMsgPack.MessageType())
+			}
+		case latmark = <-coms:
+			// Register the marker sender gave us
+			latmarks[latmark.ID] = latmark.Time
+		}
+	}
+}
+
+func sendAudio(ctx context.Context, conn *krs.STTConnection, coms chan latencyMarker, audioSamples []float32) (err error) {
+	sender := conn.GetWriteChan()
+	defer close(sender) // Signal the connection we have finished submitting audio by closing the sender channel
+	// Wait for the server to be ready to process audio
+	select {
+	case <-ctx.Done():
+		return
+	case rep := <-coms:
+		if rep.ID != 0 {
+			err = fmt.Errorf("unexpected latency marker as start signal: %d", rep.ID)
+			return
+		}
+	}
+	// Show progress
+	sendingBar := liveprogress.AddBar(
+		liveprogress.WithTotal(uint64(len(audioSamples))),
+		liveprogress.WithAppendPercent(liveprogress.BaseStyle()),
+		liveprogress.WithPrependDecorator(func(bar *liveprogress.Bar) string {
+			return "Streaming audio samples "
+		}),
+		liveprogress.WithAppendDecorator(func(bar *liveprogress.Bar) string {
+			return fmt.Sprintf(" | %d/%d samples sent", bar.Current(), bar.Total())
+		}),
+	)
+	defer liveprogress.RemoveBar(sendingBar)
+	// Send 0.1 second worth of audio samples every 0.1 seconds
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	var (
+		bufferSize int
+		buffer     []float32
+		latmark    latencyMarker
+	)
+	for {
+		// Extract 0.1 second of audio samples maximum
+		if bufferSize = min(krs.SampleRate/10, len(audioSamples)); bufferSize == 0 {
+			break
+		}
+		buffer = audioSamples[:bufferSize]
+		audioSamples = audioSamples[bufferSize:]
+		// Wait for the ticker
+		select {
+		case <-ctx.Done():
+			// connection context canceled or interrupted, no need to wait for the tick
+			return
+		case <-ticker.C:
+			// it's time, send the audio samples
+			select {
+			case <-ctx.Done():
+				// connection context canceled or interrupted, stop using the sender channel
+				return
+			case sender <- buffer:
+				sendingBar.CurrentAdd(uint64(bufferSize))
+			}
+		}
+		// Send a latency marker
+		if latmark.ID, err = conn.SendMarker(); err != nil {
+			err = fmt.Errorf("failed to send latency marker: %w", err)
+			return
+		}
+		latmark.Time = time.Now()
+		select {
+		case <-ctx.Done():
+			// connection context canceled or interrupted
+			return
+		case coms <- latmark:
+			// send marker with time creation to receiver for latency computation
+		}
+	}
+	fmt.Fprintln(liveprogress.Bypass(), "Audio fully sent")
+	return
+}
+
+type latencyMarker struct {
+	ID   int64
+	Time time.Time
+}
+
+// sliceAudio cuts the audio from start lasting duration (up to the end if 0), at the sample.
+func sliceAudio(samples []float32, start, duration time.Duration) (slice []float32, offset time.Duration, err error) {
+	from := int(start * krs.SampleRate / time.Second)
+	if start < 0 || duration < 0 || from >= len(samples) {
+		err = fmt.Errorf("%w: %s lasting %s in %s", krs.ErrInvalidRange, start, duration,
+			time.Duration(len(samples))*time.Second/krs.SampleRate)
+		return
+	}
+	to := len(samples)
+	if duration > 0 {
+		to = min(from+int(duration*krs.SampleRate/time.Second), len(samples))
+	}
+	return samples[from:to], time.Duration(from) * time.Second / krs.SampleRate, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultLLMServer = "http://127.0.0.1:11434/v1"
+	defaultLLMModel  = "llama3.1"
+)
+
+const summarizeChunkPrompt = `You summarize the transcript of a meeting. Each line is an utterance: its index, its start time and its text, for example "[#12 03:45.2] We ship on Friday.". The transcription can contain mistakes.
+
+Answer with a JSON object only, without any other text:
+{"summary": "a few sentences summarizing the discussion", "action_items": [{"text": "the task to do", "owner": "who does it if said, else empty", "utterance": 12}]}
+where utterance is the index of the utterance the action item was said in. Use an empty list if there is no action item.`
+
+const summarizeMergePrompt = `You are given the summaries of the consecutive parts of a meeting transcript. Merge them into a single summary of a few paragraphs at most, without repeating yourself. Answer with the summary only.`
+
+type summarizeOptions struct {
+	server     string
+	model      string
+	chunkWords int
+	timeout    time.Duration
+	output     string
+}
+
+func newSummarizeCommand(g *globals) *cobra.Command {
+	var opts summarizeOptions
+	cmd := &cobra.Command{
+		Use:   "summarize <transcript.json>",
+		Short: "Summarize a transcript and list its action items with an LLM",
+		Long: `Summarize a transcript and list its action items with an LLM.
+
+The transcript is loaded from its JSON export (krs stt --json) and sent in chunks of about
+--chunk-words words to an OpenAI compatible chat completions endpoint (Ollama, vLLM, llama.cpp
+server...): the summaries of the chunks are then merged into one. Each action item refers to
+the utterance it was said in and its timestamp.
+
+The API key of the endpoint, if any, is read from the ` + config.EnvNameLLMAPIKey + ` environment variable.`,
+		Example: `  krs stt --input meeting.wav --json meeting.json
+  krs summarize meeting.json --model qwen2.5:14b --output meeting-summary.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSummarize(cmd.Context(), opts, args[0])
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "llm-server", g.cfg.LLMServerOr(defaultLLMServer), "Base URL of the OpenAI compatible API of the LLM.")
+	cmd.Flags().StringVar(&opts.model, "model", g.cfg.LLMModelOr(defaultLLMModel), "The LLM model to use.")
+	cmd.Flags().IntVar(&opts.chunkWords, "chunk-words", 2000, "Maximum number of words of the transcript sent per request (whole utterances are kept).")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "Maximum duration of each LLM request.")
+	cmd.Flags().StringVar(&opts.output, "output", "", "Write the summary and the action items as JSON to this file.")
+	_ = cmd.MarkFlagFilename("output", "json")
+	return cmd
+}
+
+// meetingSummary is the result of krs summarize.
+type meetingSummary struct {
+	Summary     string       `json:"summary"`
+	ActionItems []actionItem `json:"action_items"`
+}
+
+// actionItem is a task mentioned in the transcript.
+type actionItem struct {
+	Text  string `json:"text"`
+	Owner string `json:"owner,omitempty"`
+	// Utterance is the index of the utterance of the transcript it was said in, -1 if unknown
+	Utterance int `json:"utterance"`
+	// Start is the stream time of that utterance (nanoseconds in JSON, as the transcript words)
+	Start time.Duration `json:"start"`
+}
+
+func runSummarize(ctx context.Context, opts summarizeOptions, filename string) (err error) {
+	transcript, err := readTranscriptJSON(filename)
+	if err != nil {
+		return
+	}
+	if len(transcript.Utterances) == 0 {
+		return errors.New("the transcript has no words")
+	}
+	llm := llmClient{
+		server:  strings.TrimSuffix(opts.server, "/"),
+		model:   opts.model,
+		apiKey:  os.Getenv(config.EnvNameLLMAPIKey),
+		timeout: opts.timeout,
+	}
+
+	// Summarize each chunk
+	chunks := chunkTranscript(transcript, opts.chunkWords)
+	var (
+		result    meetingSummary
+		summaries []string
+	)
+	for i, chunk := range chunks {
+		fmt.Fprintf(os.Stderr, "Summarizing part %d/%d...\n", i+1, len(chunks))
+		var answer string
+		if answer, err = llm.complete(ctx, summarizeChunkPrompt, chunk); err != nil {
+			return
+		}
+		var partial struct {
+			Summary     string `json:"summary"`
+			ActionItems []struct {
+				Text      string `json:"text"`
+				Owner     string `json:"owner"`
+				Utterance *int   `json:"utterance"`
+			} `json:"action_items"`
+		}
+		if err = json.Unmarshal([]byte(jsonObject(answer)), &partial); err != nil {
+			return fmt.Errorf("failed to decode the summary of part %d: %w (answer: %q)", i+1, err, answer)
+		}
+		summaries = append(summaries, strings.TrimSpace(partial.Summary))
+		for _, item := range partial.ActionItems {
+			action := actionItem{Text: item.Text, Owner: item.Owner, Utterance: -1}
+			if item.Utterance != nil && *item.Utterance >= 0 && *item.Utterance < len(transcript.Utterances) {
+				action.Utterance = *item.Utterance
+				action.Start = transcript.Utterances[action.Utterance].Start()
+			}
+			result.ActionItems = append(result.ActionItems, action)
+		}
+	}
+
+	// Merge the summaries of the chunks
+	if len(summaries) == 1 {
+		result.Summary = summaries[0]
+	} else {
+		fmt.Fprintln(os.Stderr, "Merging the summaries...")
+		var parts strings.Builder
+		for i, summary := range summaries {
+			fmt.Fprintf(&parts, "Part %d:\n%s\n\n", i+1, summary)
+		}
+		if result.Summary, err = llm.complete(ctx, summarizeMergePrompt, parts.String()); err != nil {
+			return
+		}
+		result.Summary = strings.TrimSpace(result.Summary)
+	}
+
+	// Output
+	fmt.Printf("Summary:\n%s\n", result.Summary)
+	if len(result.ActionItems) > 0 {
+		fmt.Println("\nAction items:")
+		for _, item := range result.ActionItems {
+			var at, owner string
+			if item.Utterance >= 0 {
+				at = "[" + formatStreamTime(item.Start) + "] "
+			}
+			if item.Owner != "" {
+				owner = " (" + item.Owner + ")"
+			}
+			fmt.Printf("- %s%s%s\n", at, item.Text, owner)
+		}
+	}
+	if opts.output != "" {
+		var file *os.File
+		if file, err = os.Create(opts.output); err != nil {
+			return fmt.Errorf("failed to create %q file: %w", opts.output, err)
+		}
+		defer file.Close()
+		if err = writeJSON(file, result); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Summary written to %q\n", opts.output)
+	}
+	return
+}
+
+// chunkTranscript renders the utterances as indexed and timestamped lines, in chunks of about
+// maxWords words. An utterance is never split.
+func chunkTranscript(transcript krs.Transcript, maxWords int) (chunks []string) {
+	var (
+		chunk strings.Builder
+		words int
+	)
+	for i, utterance := range transcript.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		if words > 0 && words+len(utterance.Words) > maxWords {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+			words = 0
+		}
+		fmt.Fprintf(&chunk, "[#%d %s] %s\n", i, formatStreamTime(utterance.Start()), utterance.Text())
+		words += len(utterance.Words)
+	}
+	if words > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return
+}
+
+// jsonObject extracts the JSON object of an LLM answer, which can be wrapped in a markdown code
+// block or some text.
+func jsonObject(answer string) string {
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return answer
+	}
+	return answer[start : end+1]
+}
+
+// llmClient queries an OpenAI compatible chat completions API.
+type llmClient struct {
+	server  string
+	model   string
+	apiKey  string
+	timeout time.Duration
+}
+
+func (lc llmClient) complete(ctx context.Context, instructions, content string) (answer string, err error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	body, err := json.Marshal(struct {
+		Model       string    `json:"model"`
+		Messages    []message `json:"messages"`
+		Temperature float64   `json:"temperature"`
+	}{
+		Model: lc.model,
+		Messages: []message{
+			{Role: "system", Content: instructions},
+			{Role: "user", Content: content},
+		},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to encode the LLM request: %w", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, lc.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lc.server+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		err = fmt.Errorf("failed to create the LLM request: %w", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if lc.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+lc.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to query the LLM: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("the LLM answered HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+		return
+	}
+	var completion struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		err = fmt.Errorf("failed to decode the LLM answer: %w", err)
+		return
+	}
+	if len(completion.Choices) == 0 {
+		err = errors.New("the LLM answered no choices")
+		return
+	}
+	answer = completion.Choices[0].Message.Content
+	return
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+)
+
+const (
+	// transcriptionsPath is the OpenAI compatible transcription endpoint of the proxy
+	transcriptionsPath = "/v1/audio/transcriptions"
+	// maxTranscriptionUpload bounds the audio file uploaded to the transcription endpoint
+	maxTranscriptionUpload = 256 << 20
+)
+
+// openAIError is the error body of the OpenAI API.
+type openAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, errorType string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error openAIError `json:"error"`
+	}{
+		Error: openAIError{Message: err.Error(), Type: errorType},
+	})
+}
+
+// transcriptionUsage is the audio duration billed by the OpenAI API.
+type transcriptionUsage struct {
+	Type    string  `json:"type"`
+	Seconds float64 `json:"seconds"`
+}
+
+// The events of a streamed transcription, in the shape of the OpenAI streaming transcription
+// events. The deltas concatenated are the text of the done event, an utterance ended by a pause of
+// the speaker is a segment.
+type (
+	transcriptionDelta struct {
+		Type  string  `json:"type"`
+		Delta string  `json:"delta"`
+		Start float64 `json:"start"`
+	}
+	transcriptionSegment struct {
+		Type  string  `json:"type"`
+		ID    string  `json:"id"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	}
+	transcriptionDone struct {
+		Type  string             `json:"type"`
+		Text  string             `json:"text"`
+		Usage transcriptionUsage `json:"usage"`
+	}
+	transcriptionFailure struct {
+		Type  string      `json:"type"`
+		Error openAIError `json:"error"`
+	}
+)
+
+// transcriptions serves the OpenAI compatible transcription endpoint: the uploaded file (file
+// field of the multipart form) is transcribed by the upstream server of the route. With stream=true
+// (query parameter or form field), the words are sent as Server-Sent Events while transcribed.
+func (p *proxy) transcriptions(w http.ResponseWriter, r *http.Request, logger *slog.Logger, route *proxyRoute) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", errors.New("use POST"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxTranscriptionUpload)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("failed to read the file field: %w", err))
+		return
+	}
+	defer file.Close()
+	samples, _, err := audio.Decode(file)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+	ctx := r.Context()
+	start := time.Now()
+	logger.Info("transcription started", "audio", time.Duration(len(samples))*time.Second/krs.SampleRate)
+	usage := transcriptionUsage{
+		Type:    "duration",
+		Seconds: float64(len(samples)) / krs.SampleRate,
+	}
+	if r.URL.Query().Get("stream") == "true" || r.FormValue("stream") == "true" {
+		err = streamTranscriptionEvents(ctx, w, route.stt, samples, usage)
+	} else {
+		err = writeTranscription(ctx, w, route.stt, samples, usage, r.FormValue("response_format"))
+	}
+	if err != nil {
+		logger.Warn("transcription failed", "error", err, "duration", time.Since(start).Round(time.Millisecond))
+		return
+	}
+	logger.Info("transcription ended", "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// writeTranscription transcribes the whole audio then answers in the OpenAI response formats:
+// json (default), text or verbose_json (with the segments and the words).
+func writeTranscription(ctx context.Context, w http.ResponseWriter, client *krs.STTClient, samples []float32,
+	usage transcriptionUsage, format string) (err error) {
+	if format != "" && format != "json" && format != "text" && format != "verbose_json" {
+		err = fmt.Errorf("unsupported response format %q (json, text or verbose_json)", format)
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+	var (
+		transcript krs.Transcript
+		text       strings.Builder
+	)
+	if err = streamTranscription(ctx, client, samples, &transcript, func(delta string, _ krs.Word) {
+		text.WriteString(delta)
+	}, nil); err != nil {
+		writeOpenAIError(w, http.StatusBadGateway, "server_error", err)
+		return
+	}
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err = fmt.Fprintln(w, text.String())
+		return
+	case "verbose_json":
+		type segment struct {
+			ID    int     `json:"id"`
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+			Text  string  `json:"text"`
+		}
+		type word struct {
+			Word  string  `json:"word"`
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+		}
+		verbose := struct {
+			Task     string             `json:"task"`
+			Duration float64            `json:"duration"`
+			Text     string             `json:"text"`
+			Segments []segment          `json:"segments"`
+			Words    []word             `json:"words"`
+			Usage    transcriptionUsage `json:"usage"`
+		}{
+			Task:     "transcribe",
+			Duration: usage.Seconds,
+			Text:     text.String(),
+			Segments: []segment{},
+			Words:    []word{},
+			Usage:    usage,
+		}
+		for i, utterance := range transcript.Utterances {
+			verbose.Segments = append(verbose.Segments, segment{
+				ID:    i,
+				Start: fileSeconds(utterance.Start()),
+				End:   fileSeconds(utterance.End()),
+				Text:  utterance.Text(),
+			})
+			for _, uw := range utterance.Words {
+				verbose.Words = append(verbose.Words, word{
+					Word:  uw.Text,
+					Start: fileSeconds(uw.Start),
+					End:   fileSeconds(max(uw.End, uw.Start)),
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(verbose)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(struct {
+			Text  string             `json:"text"`
+			Usage transcriptionUsage `json:"usage"`
+		}{
+			Text:  text.String(),
+			Usage: usage,
+		})
+	}
+}
+
+// streamTranscriptionEvents transcribes the audio, sending the words and the segments as
+// Server-Sent Events while the server transcribes them.
+func streamTranscriptionEvents(ctx context.Context, w http.ResponseWriter, client *krs.STTClient,
+	samples []float32, usage transcriptionUsage) (err error) {
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	var writeErr error
+	send := func(event any) {
+		if writeErr != nil {
+			return
+		}
+		data, _ := json.Marshal(event)
+		if _, writeErr = fmt.Fprintf(w, "data: %s\n\n", data); writeErr == nil {
+			writeErr = controller.Flush()
+		}
+	}
+	var (
+		transcript krs.Transcript
+		text       strings.Builder
+	)
+	err = streamTranscription(ctx, client, samples, &transcript, func(delta string, word krs.Word) {
+		text.WriteString(delta)
+		send(transcriptionDelta{
+			Type:  "transcript.text.delta",
+			Delta: delta,
+			Start: fileSeconds(word.Start),
+		})
+	}, func(index int, utterance krs.Utterance) {
+		send(transcriptionSegment{
+			Type:  "transcript.text.segment",
+			ID:    fmt.Sprintf("seg_%d", index),
+			Start: fileSeconds(utterance.Start()),
+			End:   fileSeconds(utterance.End()),
+			Text:  utterance.Text(),
+		})
+	})
+	if err != nil {
+		send(transcriptionFailure{
+			Type:  "error",
+			Error: openAIError{Message: err.Error(), Type: "server_error"},
+		})
+		return
+	}
+	send(transcriptionDone{
+		Type:  "transcript.text.done",
+		Text:  text.String(),
+		Usage: usage,
+	})
+	return writeErr
+}
+
+// streamTranscription streams the audio to the STT server as fast as it accepts it. onWord is
+// called with each word and the text it adds (with its separator), onSegment with each utterance
+// once ended by a pause of the speaker or the end of the audio.
+func streamTranscription(ctx context.Context, client *krs.STTClient, samples []float32, transcript *krs.Transcript,
+	onWord func(delta string, word krs.Word), onSegment func(index int, utterance krs.Utterance)) (err error) {
+	sttc, err := client.Connect(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to connect upstream: %w", err)
+		return
+	}
+	defer sttc.Close()
+	connCtx := sttc.GetContext()
+	go func() {
+		sender := sttc.GetWriteChan()
+		defer close(sender)
+		for frame := range slices.Chunk(samples, krs.FrameSize) {
+			select {
+			case <-connCtx.Done():
+				return
+			case sender <- frame:
+			}
+		}
+	}()
+	var segments int
+	endSegment := func() {
+		transcript.EndUtterance()
+		if segments < len(transcript.Utterances) {
+			if onSegment != nil {
+				onSegment(segments, transcript.Utterances[segments])
+			}
+			segments = len(transcript.Utterances)
+		}
+	}
+	receiver := sttc.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			switch typed := msg.(type) {
+			case krs.MessagePackWord:
+				word := krs.Word{Text: typed.Text, Start: typed.StartTimeDuration()}
+				utterances := len(transcript.Utterances)
+				var before string
+				if utterances > 0 && segments < utterances {
+					before = transcript.Utterances[utterances-1].Text()
+				}
+				transcript.AddWord(word)
+				current := transcript.Utterances[len(transcript.Utterances)-1].Text()
+				delta := strings.TrimPrefix(current, before)
+				if before == "" && len(transcript.Utterances) > 1 {
+					delta = "\n" + delta
+				}
+				onWord(delta, word)
+			case krs.MessagePackWordEnd:
+				transcript.SetWordEnd(typed.StopTimeDuration())
+			case krs.MessagePackStep:
+				if typed.PausePrediction() > pauseThreshold {
+					endSegment()
+				}
+			}
+		}
+	}
+	if err = sttc.Done(); err != nil && !errors.Is(err, krs.ErrMaxSessionDuration) {
+		return
+	}
+	err = nil
+	endSegment()
+	return
+}
+
+// fileSeconds converts a time of the STT stream to seconds of the uploaded file.
+func fileSeconds(at time.Duration) float64 {
+	return max(at-krs.STTStreamOffset, 0).Seconds()
+}
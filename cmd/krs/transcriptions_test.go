@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coder/websocket"
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+// newSTTMock mimics the STT endpoint of the Kyutai Rust server: a step per audio frame, a word
+// (w1, w2...) every 10 steps and a pause predicted every 30 steps.
+func newSTTMock(t *testing.T) *krs.STTClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		conn.SetReadLimit(-1)
+		ctx := r.Context()
+		send := func(msg interface{ MarshalMsg([]byte) ([]byte, error) }) error {
+			payload, err := msg.MarshalMsg(nil)
+			if err != nil {
+				return err
+			}
+			return conn.Write(ctx, websocket.MessageBinary, payload)
+		}
+		var (
+			header krs.MessagePackHeader
+			audio  krs.MessagePackAudio
+			marker krs.MessagePackMarker
+			step   int
+		)
+		for {
+			_, payload, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			if _, err = header.UnmarshalMsg(payload); err != nil {
+				return
+			}
+			switch header.Type {
+			case krs.MessagePackTypeAudio:
+				if _, err = audio.UnmarshalMsg(payload); err != nil {
+					return
+				}
+				for range len(audio.PCM) / krs.FrameSize {
+					step++
+					if step%10 == 0 {
+						if send(krs.MessagePackWord{
+							Type:      krs.MessagePackTypeWord,
+							Text:      fmt.Sprintf("w%d", step/10),
+							StartTime: float64(step) * krs.FrameDuration.Seconds(),
+						}) != nil {
+							return
+						}
+					}
+					prs := []float32{0, 0, 0, 0}
+					if step%30 == 0 {
+						prs[2] = 1
+					}
+					if send(&krs.MessagePackStep{Type: krs.MessagePackTypeStep, Prs: prs, StepIndex: step, BufferedPCM: krs.FrameSize}) != nil {
+						return
+					}
+				}
+			case krs.MessagePackTypeMarker:
+				if _, err = marker.UnmarshalMsg(payload); err != nil {
+					return
+				}
+				if send(marker) != nil {
+					return
+				}
+				if marker.ID == 0 {
+					// end of stream: the buffer is empty
+					if send(&krs.MessagePackStep{Type: krs.MessagePackTypeStep, Prs: []float32{0, 0, 0, 0}, StepIndex: step}) != nil {
+						return
+					}
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := krs.NewSTTClient(&krs.STTConfig{URL: "ws" + strings.TrimPrefix(server.URL, "http")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestStreamTranscriptionEvents(t *testing.T) {
+	client := newSTTMock(t)
+	recorder := httptest.NewRecorder()
+	samples := make([]float32, 8*krs.SampleRate)
+	usage := transcriptionUsage{Type: "duration", Seconds: 8}
+	if err := streamTranscriptionEvents(context.Background(), recorder, client, samples, usage); err != nil {
+		t.Fatal(err)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("got content type %q", contentType)
+	}
+	var (
+		deltas   strings.Builder
+		segments []transcriptionSegment
+		done     transcriptionDone
+	)
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		switch event.Type {
+		case "transcript.text.delta":
+			var delta transcriptionDelta
+			_ = json.Unmarshal([]byte(data), &delta)
+			deltas.WriteString(delta.Delta)
+		case "transcript.text.segment":
+			var segment transcriptionSegment
+			_ = json.Unmarshal([]byte(data), &segment)
+			segments = append(segments, segment)
+		case "transcript.text.done":
+			_ = json.Unmarshal([]byte(data), &done)
+		default:
+			t.Fatalf("unexpected event %s", data)
+		}
+	}
+	// the deltas rebuild the text, a line per segment of three words
+	if done.Text == "" || deltas.String() != done.Text || done.Usage != usage {
+		t.Fatalf("got the deltas %q for the text %q (usage %+v)", deltas.String(), done.Text, done.Usage)
+	}
+	lines := strings.Split(done.Text, "\n")
+	if len(lines) < 3 || len(lines) != len(segments) {
+		t.Fatalf("got %d segments for the text %q", len(segments), done.Text)
+	}
+	for i, segment := range segments {
+		if segment.ID != fmt.Sprintf("seg_%d", i) || segment.Text != lines[i] || segment.End < segment.Start {
+			t.Errorf("got segment %+v for the line %q", segment, lines[i])
+		}
+		if words := strings.Fields(segment.Text); i < len(segments)-1 && len(words) != 3 {
+			t.Errorf("segment %d has the words %v, expected 3 between the pauses", i, words)
+		}
+	}
+	if !strings.HasPrefix(done.Text, "w") {
+		t.Errorf("got the text %q, expected no separator before the first word", done.Text)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+type ttsOptions struct {
+	server         string
+	input          string
+	voice          string
+	wordsPerSecond int
+	sendAhead      time.Duration
+	output         string
+	memoryLimit    int
+	trace          string
+	noVoiceCheck   bool
+	pipe           bool
+	stems          string
+	stemGap        time.Duration
+	musicBed       musicBedOptions
+	network        networkOptions
+}
+
+func newTTSCommand(g *globals) *cobra.Command {
+	var opts ttsOptions
+	cmd := &cobra.Command{
+		Use:   "tts",
+		Short: "Synthesize text with a Kyutai TTS server",
+		Long: `Synthesize text with a Kyutai TTS server.
+
+The audio is written as a mono 24kHz wave file, or as raw little endian float32 samples on
+stdout (use - as output), for example to convert it with ffmpeg:
+
+  echo "Hello!" | krs tts --output - | ffmpeg -f f32le -ar 24000 -ac 1 -i pipe: output.opus
+
+Hitting Ctrl-C stops sending text but lets the server synthesize what it already received:
+the output file is still valid. Interrupt a second time to abort right away.
+
+With --pipe, each line read on stdin is synthesized as its own utterance, a connection being
+kept ready in advance, and its audio is written to stdout as raw s16le samples as soon as it is
+received (no buffering, no wave file), to compose with other audio tools in real time:
+
+  my-chatbot | krs tts --pipe | aplay -f S16_LE -r 24000 -c 1
+
+With --stems, each sentence is synthesized to its own wave file (001.wav, 002.wav...) in the
+given directory, along with a manifest of their offsets in the narration (manifest.json and
+manifest.csv): audio producers arrange and tweak the narration in a DAW, re-synthesizing only the
+sentences to fix. The offsets leave --stem-gap between the sentences.
+
+  krs tts --input "$(cat chapter1.txt)" --stems chapter1/
+
+With --music, the narration is mixed over a music bed, looped if it is shorter, for a final
+track: the music plays --music-level under the speech level of the narration and is side-chain
+ducked by --duck while the narration speaks, smoothly so that it does not pump between the words.
+
+  krs tts --input "$(cat intro.txt)" --music bed.wav --duck -12dB --music-intro 3s --output intro.wav`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTTS(g, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.TTSURL(defaultServer), "The websocket URL of the Kyutai TTS server.")
+	cmd.Flags().StringVar(&opts.input, "input", "-", "Input text to synthesize. Use - for stdin.")
+	cmd.Flags().StringVar(&opts.voice, "voice", g.cfg.VoiceOr(defaultVoice), "The voice to use for synthesis (see the voices command).")
+	cmd.Flags().IntVar(&opts.wordsPerSecond, "wordspersecond", g.cfg.WordsPerSecondOr(5), "Input text word sending rate (words per second). Use it to simulate a LLM input, 0 sends the text as fast as --send-ahead allows.")
+	cmd.Flags().DurationVar(&opts.sendAhead, "send-ahead", 10*time.Second, "Hold the text beyond this much speech ahead of the audio received, for long inputs (0 to send it all at once).")
+	cmd.Flags().StringVar(&opts.output, "output", g.cfg.OutputOr("output.wav"), "Output audio samples. Use - for stdout.")
+	cmd.Flags().IntVar(&opts.memoryLimit, "memlimit", 256, "Maximum amount of audio (in MiB) kept in memory before spilling to a temporary file.")
+	cmd.Flags().StringVar(&opts.trace, "trace", "", "Write the connection timings to this file as a Chrome tracing JSON (chrome://tracing or Perfetto).")
+	cmd.Flags().BoolVar(&opts.pipe, "pipe", false, "Synthesize each stdin line as soon as it is read and stream the audio to stdout as s16le samples.")
+	cmd.Flags().StringVar(&opts.stems, "stems", "", "Synthesize each sentence to its own wave file in this directory, with a manifest of their offsets.")
+	cmd.Flags().DurationVar(&opts.stemGap, "stem-gap", 400*time.Millisecond, "Silence between the sentences in the offsets of the stems manifest.")
+	cmd.Flags().BoolVar(&opts.noVoiceCheck, "no-voice-check", false, "Do not check the voice exists in the voices repository (for voices local to the server).")
+	opts.musicBed.addFlags(cmd)
+	opts.network.addFlags(cmd)
+	_ = cmd.RegisterFlagCompletionFunc("voice", completeVoices)
+	_ = cmd.MarkFlagFilename("output", "wav")
+	_ = cmd.MarkFlagFilename("trace", "json")
+	_ = cmd.MarkFlagDirname("stems")
+	cmd.MarkFlagsMutuallyExclusive("pipe", "stems", "music")
+	return cmd
+}
+
+func runTTS(g *globals, opts ttsOptions) (err error) {
+	if !opts.pipe && opts.stems == "" && opts.output != "-" && !strings.HasSuffix(opts.output, ".wav") {
+		return errors.New("when outputing to a file, you must use a .wav extension")
+	}
+	var music []float32
+	if opts.musicBed.music != "" {
+		if opts.output == "-" {
+			return errors.New("the narration is mixed over the music bed once synthesized: --music needs a .wav output")
+		}
+		if music, err = opts.musicBed.load(); err != nil {
+			return
+		}
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	interruptCtx, abortCtx, stop := interruptible(func() {
+		fmt.Fprintln(os.Stderr, "\nInterrupted: finishing the synthesis of the text already sent (interrupt again to abort)")
+	})
+	defer stop()
+
+	// Create the Kyutai TTS client
+	config := &krs.TTSConfig{
+		URL:           opts.server,
+		APIKey:        apiKey,
+		Voice:         opts.voice,
+		Network:       opts.network.conditions(),
+		RealtimeGuard: realtimeWarning(g.logger),
+		SendAhead:     opts.sendAhead,
+		Tags:          g.tags,
+	}
+	if !opts.noVoiceCheck {
+		config.VoiceGallery = voiceGallery(krs.DefaultVoiceRepository)
+	}
+	ttsClient, err := krs.NewTTSClient(config)
+	if err != nil {
+		return
+	}
+	if opts.pipe {
+		return pipeTTS(g, ttsClient, interruptCtx, abortCtx)
+	}
+	if opts.stems != "" {
+		return stemsTTS(ttsClient, opts, interruptCtx, abortCtx)
+	}
+
+	// Open a connection
+	fmt.Fprintf(os.Stderr, "Opening a connection...")
+	ttsConn, err := ttsClient.Connect(abortCtx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	fmt.Fprintln(os.Stderr, " connected.")
+	defer ttsConn.Close()
+	inputCtx, stopInput := context.WithCancel(ttsConn.GetContext())
+	defer stopInput()
+	context.AfterFunc(interruptCtx, stopInput)
+
+	go logFlowControl(ttsConn.GetContext(), g.logger, ttsConn.FlowControl())
+	go logStates(g.logger, ttsConn.Subscribe())
+
+	// Send the input text to the TTS server...
+	go func() {
+		if err := ttsConn.StreamFrom(textInput(inputCtx, opts.input), pacedWords(inputCtx, opts.wordsPerSecond)); err != nil &&
+			!errors.Is(err, context.Canceled) {
+			g.logger.Error("failed to read the input, the text is truncated", "error", err)
+		}
+	}()
+
+	// ...while reading the audio samples and processed text in return
+	audioSamples := krs.NewPCMAccumulator(opts.memoryLimit << 20)
+	defer audioSamples.Close()
+	received := make(chan error, 1)
+	go func() {
+		received <- receiveAudio(ttsConn.GetContext(), ttsConn.GetReadChan(), audioSamples, opts.output == "-")
+	}()
+
+	// Wait until the connection is done and collect error if any
+	if err = ttsConn.Done(); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			return
+		}
+		err = nil
+		fmt.Fprintln(os.Stderr, "\nConnection aborted, the audio output is incomplete")
+	}
+	if err = <-received; err != nil {
+		return
+	}
+
+	// Write the audio samples to a WAV file, over the music bed if any
+	if music != nil {
+		var mix []float32
+		if mix, err = opts.musicBed.mix(audioSamples, music); err != nil {
+			return
+		}
+		if err = writeSamples(opts.output, mix); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\nAudio mixed over %q written to %q\n", opts.musicBed.music, opts.output)
+	} else if opts.output != "-" {
+		if err = audio.WriteWAV(opts.output, audioSamples); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\nAudio samples written to %q\n", opts.output)
+	}
+
+	// Export the timings
+	if opts.trace != "" {
+		if err = writeTTSTrace(opts.trace, ttsConn); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Trace written to %q\n", opts.trace)
+	}
+	return
+}
+
+// pipeTTS speaks each stdin line as an utterance, streaming the audio to stdout until the input
+// ends or is interrupted.
+func pipeTTS(g *globals, ttsClient *krs.TTSClient, interruptCtx, abortCtx context.Context) (err error) {
+	speaker := krs.NewSpeaker(abortCtx, ttsClient, s16Sink{os.Stdout})
+	defer speaker.Close()
+	lines := bufio.NewScanner(textInput(interruptCtx, "-"))
+	var last <-chan error
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" {
+			continue
+		}
+		result := speaker.Say(line, krs.PriorityNormal)
+		go func() {
+			if err := <-result; err != nil {
+				g.logger.Error("failed to synthesize a line", "line", line, "error", err)
+			}
+		}()
+		last = result
+	}
+	if err = lines.Err(); err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+	// Let the queued lines be synthesized (the utterances are played in order)
+	if last != nil {
+		select {
+		case <-last:
+		case <-abortCtx.Done():
+		}
+	}
+	return
+}
+
+// s16Sink writes the audio as s16le samples as soon as it is received.
+type s16Sink struct {
+	w io.Writer
+}
+
+func (ss s16Sink) WritePCM(pcm []float32) error {
+	return audio.WriteS16(ss.w, pcm)
+}
+
+func (ss s16Sink) Discard() {}
+
+func writeTTSTrace(filename string, conn *krs.TTSConnection) (err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %q file: %w", filename, err)
+	}
+	defer file.Close()
+	if err = conn.WriteTrace(file); err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	stats := conn.Stats()
+	latency := stats.MeanLatency()
+	fmt.Fprintf(os.Stderr, "Time to first audio: %s (client queue %s, network %s, server %s, decode %s)\n",
+		latency.Total().Round(time.Millisecond), latency.ClientQueue.Round(time.Microsecond),
+		latency.Network.Round(time.Microsecond), latency.ServerBuffer.Round(time.Millisecond),
+		latency.Decode.Round(time.Microsecond),
+	)
+	fmt.Fprintf(os.Stderr, "Realtime factor: %.2f (%s of audio synthesized in %s)\n", stats.RealtimeFactor(),
+		stats.AudioReceived.Round(time.Millisecond), stats.AudioWallClock.Round(time.Millisecond),
+	)
+	return
+}
+
+// textInput returns the input text, or stdin which is read until ctx is done.
+func textInput(ctx context.Context, input string) io.Reader {
+	if input != "-" {
+		return strings.NewReader(input)
+	}
+	return &interruptibleReader{ctx: ctx, reader: os.Stdin}
+}
+
+// interruptibleReader ends the input once ctx is done, even while blocked in a read (reading
+// stdin can not be interrupted, the pending read is left behind).
+type interruptibleReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (ir *interruptibleReader) Read(p []byte) (n int, err error) {
+	type result struct {
+		n   int
+		err error
+	}
+	buffer := make([]byte, len(p))
+	read := make(chan result, 1)
+	go func() {
+		n, err := ir.reader.Read(buffer)
+		read <- result{n, err}
+	}()
+	select {
+	case <-ir.ctx.Done():
+		return 0, io.EOF
+	case res := <-read:
+		return copy(p, buffer[:res.n]), res.err
+	}
+}
+
+// pacedWords sends the words at a fixed rate to simulate a LLM input, as fast as possible without
+// rate.
+func pacedWords(ctx context.Context, wordsPerSecond int) krs.Chunker {
+	if wordsPerSecond <= 0 {
+		return krs.ChunkWords
+	}
+	limiter := rate.NewLimiter(rate.Limit(wordsPerSecond), 1)
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if advance, token, err = krs.ChunkWords(data, atEOF); token != nil && err == nil {
+			err = limiter.Wait(ctx)
+		}
+		return
+	}
+}
+
+func receiveAudio(ctx context.Context, receiver <-chan krs.MessagePack, audioSamples *krs.PCMAccumulator, stdoutOutput bool) (err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			// connection context canceled, stop using the receiver channel
+			return
+		case receivedMsgPack, open := <-receiver:
+			if !open {
+				// End of server stream
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+			switch msgPackTyped := receivedMsgPack.(type) {
+			case krs.MessagePackText:
+				fmt.Fprintf(os.Stderr, "%s ", msgPackTyped.Text)
+			case krs.MessagePackAudio:
+				if err != nil {
+					// keep draining the connection after a write failure
+					continue
+				}
+				if stdoutOutput {
+					err = audio.WriteRaw(os.Stdout, msgPackTyped.PCM)
+				} else {
+					err = audioSamples.WritePCM(msgPackTyped.PCM)
+				}
+			}
+		}
+	}
+}
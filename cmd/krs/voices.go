@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hekmon/kyutai-rs"
+	"github.com/spf13/cobra"
+)
+
+type voicesOptions struct {
+	repository string
+	filter     string
+	refresh    bool
+}
+
+func newVoicesCommand(g *globals) *cobra.Command {
+	var opts voicesOptions
+	cmd := &cobra.Command{
+		Use:   "voices",
+		Short: "List the voices available for synthesis",
+		Long: `List the voices available for synthesis.
+
+The voices are listed from the Hugging Face repository the TTS server downloads them from.
+Any of them can be used as the voice of the tts command. The list is cached for a day in
+the user cache directory.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			gallery := voiceGallery(opts.repository)
+			if opts.refresh {
+				if err = gallery.Refresh(cmd.Context()); err != nil {
+					return
+				}
+			}
+			voices, err := gallery.Voices(cmd.Context())
+			if err != nil {
+				return
+			}
+			output := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, voice := range voices {
+				if strings.Contains(voice.Name, opts.filter) {
+					fmt.Fprintf(output, "%s\t%s\n", voice.Name, voice.Description)
+				}
+			}
+			return output.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&opts.repository, "repository", krs.DefaultVoiceRepository, "The Hugging Face repository of the voices.")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Only list the voices containing this string, for example expresso/.")
+	cmd.Flags().BoolVar(&opts.refresh, "refresh", false, "Download the list again instead of using the cached one.")
+	cmd.AddCommand(newVoicesPreviewCommand(g))
+	return cmd
+}
+
+// voiceGallery returns the gallery of a repository, cached in the user cache directory.
+func voiceGallery(repository string) *krs.VoiceGallery {
+	gallery := &krs.VoiceGallery{Repository: repository}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		gallery.CacheDir = filepath.Join(cacheDir, "krs")
+	}
+	return gallery
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/audio"
+	"github.com/hekmon/kyutai-rs/cmd/krs/internal/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// watchSidecars are the transcript formats written next to the transcribed files.
+var watchSidecars = []string{"txt", "srt", "json"}
+
+type watchOptions struct {
+	rules     string
+	server    string
+	poll      time.Duration
+	parallel  int
+	done      string
+	failed    string
+	attempts  int
+	sidecars  []string
+	normalize bool
+	webhooks  []string
+	chats     []string
+}
+
+// watchRule is a watched directory, with where its files and their transcripts go.
+type watchRule struct {
+	Directory string `yaml:"directory"`
+	// Done and Failed default to the done and failed subdirectories
+	Done     string   `yaml:"done,omitempty"`
+	Failed   string   `yaml:"failed,omitempty"`
+	Sidecars []string `yaml:"sidecars,omitempty"`
+	// Deliver sends the transcripts once the files are transcribed
+	Deliver []*delivery `yaml:"deliver,omitempty"`
+}
+
+func newWatchCommand(g *globals) *cobra.Command {
+	var opts watchOptions
+	cmd := &cobra.Command{
+		Use:   "watch [directory]",
+		Short: "Transcribe the audio files dropped in a directory",
+		Long: `Transcribe the audio files dropped in a directory.
+
+The directory is scanned for new audio files (wave, ogg or raw float32), a file being picked once
+its size and modification time did not change between two scans: recorders and copies still
+writing it are left alone. Each file is transcribed, then moved to the done directory along with
+its transcripts (sidecar files of the same name: .txt, .srt and .json by default).
+
+A file failing to transcribe is retried on the next scans (the server may be down), up to
+--attempts times: then it is quarantined in the failed directory, along with a .error.txt file
+telling why. Files which are not audio are quarantined right away.
+
+The transcripts can also be delivered once written: POSTed as JSON to --webhook, or posted as a
+message to the incoming webhook of a chat (Slack, Mattermost, Google Chat, Matrix hookshot...)
+with --chat-webhook. A delivery failing is logged, the transcripts stay in the done directory.
+
+Several directories are watched at once with a rules file (--rules), each with its own done and
+failed directories, sidecar files and deliveries, which can also be emails:
+
+  rules:
+    - directory: ~/Dictations
+      sidecars: [txt, srt]
+      deliver:
+        - email:
+            server: smtp.example.com:587
+            from: krs@example.com
+            to: [me@example.com]
+            username: krs@example.com
+            password_env: SMTP_PASSWORD
+    - directory: /srv/voicemail
+      done: /srv/voicemail/transcribed
+      deliver:
+        - chat: https://hooks.slack.com/services/T0000/B0000/XXXX
+        - webhook: https://crm.example.com/hooks/voicemail
+
+The emails hold the text of the transcript, with the transcript files attached.
+
+Polling works the same on every platform and on network shares, where the file system
+notifications are not delivered.`,
+		Example: `  krs watch ~/Dictations
+  krs watch /srv/recordings --parallel 4 --done /srv/transcribed --sidecar json
+  krs watch /srv/voicemail --chat-webhook https://hooks.slack.com/services/T0000/B0000/XXXX
+  krs watch --rules ~/.config/krs/watch.yaml`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if (len(args) == 0) == (opts.rules == "") {
+				return errors.New("expected either a directory or a rules file (--rules)")
+			}
+			var rules []*watchRule
+			if opts.rules != "" {
+				if rules, err = loadWatchRules(opts.rules); err != nil {
+					return
+				}
+			} else {
+				rule := &watchRule{Directory: args[0], Done: opts.done, Failed: opts.failed}
+				for _, webhook := range opts.webhooks {
+					rule.Deliver = append(rule.Deliver, &delivery{Webhook: webhook})
+				}
+				for _, chat := range opts.chats {
+					rule.Deliver = append(rule.Deliver, &delivery{Chat: chat})
+				}
+				rules = []*watchRule{rule}
+			}
+			return runWatch(g, opts, rules)
+		},
+	}
+	cmd.Flags().StringVar(&opts.rules, "rules", "", "Watch the directories of a rules file instead, each with its own settings and deliveries.")
+	cmd.Flags().StringVar(&opts.server, "server", g.cfg.STTURL(defaultServer), "The websocket URL of the Kyutai STT server.")
+	cmd.Flags().DurationVar(&opts.poll, "poll", 2*time.Second, "How often the directory is scanned for new files.")
+	cmd.Flags().IntVar(&opts.parallel, "parallel", 2, "Number of files transcribed at the same time.")
+	cmd.Flags().StringVar(&opts.done, "done", "", "Directory the transcribed files and their transcripts are moved to (defaults to the done subdirectory).")
+	cmd.Flags().StringVar(&opts.failed, "failed", "", "Directory the files failing to transcribe are quarantined in (defaults to the failed subdirectory).")
+	cmd.Flags().IntVar(&opts.attempts, "attempts", 3, "Transcription attempts of a file before quarantining it.")
+	cmd.Flags().StringSliceVar(&opts.sidecars, "sidecar", watchSidecars, "Transcript files written next to each transcribed file: txt, srt and/or json.")
+	cmd.Flags().BoolVar(&opts.normalize, "normalize", false, "Bring the speech of the badly leveled recordings to a common level before transcribing them.")
+	cmd.Flags().StringArrayVar(&opts.webhooks, "webhook", nil, "POST each transcript as JSON to this URL (repeatable).")
+	cmd.Flags().StringArrayVar(&opts.chats, "chat-webhook", nil, "Post the text of each transcript to this chat incoming webhook (repeatable).")
+	cmd.MarkFlagsMutuallyExclusive("rules", "done")
+	cmd.MarkFlagsMutuallyExclusive("rules", "failed")
+	cmd.MarkFlagsMutuallyExclusive("rules", "webhook")
+	cmd.MarkFlagsMutuallyExclusive("rules", "chat-webhook")
+	_ = cmd.MarkFlagDirname("done")
+	_ = cmd.MarkFlagDirname("failed")
+	_ = cmd.MarkFlagFilename("rules", "yaml", "yml")
+	_ = cmd.RegisterFlagCompletionFunc("sidecar", cobra.FixedCompletions(watchSidecars, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// loadWatchRules reads a rules file (see the krs watch help).
+func loadWatchRules(path string) (rules []*watchRule, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read the rules file: %w", err)
+		return
+	}
+	var file struct {
+		Rules []*watchRule `yaml:"rules"`
+	}
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		err = fmt.Errorf("failed to parse the rules file %q: %w", path, err)
+		return
+	}
+	if len(file.Rules) == 0 {
+		err = fmt.Errorf("no rule in %q", path)
+		return
+	}
+	for i, rule := range file.Rules {
+		if rule.Directory == "" {
+			err = fmt.Errorf("rule %d: no directory", i+1)
+			return
+		}
+		rule.Directory = config.ExpandHome(rule.Directory)
+		rule.Done = config.ExpandHome(rule.Done)
+		rule.Failed = config.ExpandHome(rule.Failed)
+		for _, other := range file.Rules[:i] {
+			if other.Directory == rule.Directory {
+				err = fmt.Errorf("%s: watched by several rules", rule.Directory)
+				return
+			}
+		}
+	}
+	return file.Rules, nil
+}
+
+// prepare applies the defaults of a rule, creates its directories and checks its deliveries.
+func (rule *watchRule) prepare(defaultSidecars []string) (err error) {
+	if len(rule.Sidecars) == 0 {
+		rule.Sidecars = defaultSidecars
+	}
+	for _, sidecar := range rule.Sidecars {
+		if !slices.Contains(watchSidecars, sidecar) {
+			return fmt.Errorf("unknown sidecar format %q: expected %s", sidecar, strings.Join(watchSidecars, ", "))
+		}
+	}
+	if rule.Done == "" {
+		rule.Done = filepath.Join(rule.Directory, "done")
+	}
+	if rule.Failed == "" {
+		rule.Failed = filepath.Join(rule.Directory, "failed")
+	}
+	for _, dir := range []string{rule.Done, rule.Failed} {
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create the %q directory: %w", dir, err)
+		}
+	}
+	for i, target := range rule.Deliver {
+		if err = target.validate(); err != nil {
+			return fmt.Errorf("delivery %d: %w", i+1, err)
+		}
+	}
+	return
+}
+
+func runWatch(g *globals, opts watchOptions, rules []*watchRule) (err error) {
+	for _, rule := range rules {
+		if err = rule.prepare(opts.sidecars); err != nil {
+			return fmt.Errorf("%s: %w", rule.Directory, err)
+		}
+	}
+	apiKey, err := g.cfg.APIKeyValue()
+	if err != nil {
+		return
+	}
+	client, err := krs.NewSTTClient(&krs.STTConfig{
+		URL:            opts.server,
+		APIKey:         apiKey,
+		Tags:           g.tags,
+		NormalizeInput: opts.normalize,
+	})
+	if err != nil {
+		return
+	}
+	// Stop picking files on the first interrupt, abort the transcriptions on the second one
+	interruptCtx, abortCtx, stop := interruptible(func() {
+		g.logger.Info("interrupted: waiting for the transcriptions in progress (interrupt again to abort)")
+	})
+	defer stop()
+	var (
+		slots    = make(chan struct{}, max(opts.parallel, 1))
+		workers  sync.WaitGroup
+		watchers = make([]*watcher, len(rules))
+	)
+	for i, rule := range rules {
+		watchers[i] = &watcher{
+			ctx:      abortCtx,
+			logger:   g.logger.With("directory", rule.Directory),
+			client:   client,
+			rule:     rule,
+			attempts: opts.attempts,
+			slots:    slots,
+			workers:  &workers,
+			seen:     make(map[string]watchedFile),
+			busy:     make(map[string]bool),
+			failures: make(map[string]int),
+		}
+		g.logger.Info("watching", "directory", rule.Directory, "done", rule.Done, "failed", rule.Failed,
+			"deliveries", len(rule.Deliver))
+	}
+	ticker := time.NewTicker(opts.poll)
+	defer ticker.Stop()
+scan:
+	for interruptCtx.Err() == nil {
+		for _, w := range watchers {
+			if err = w.scan(interruptCtx); err != nil {
+				break scan
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-interruptCtx.Done():
+		}
+	}
+	workers.Wait()
+	return
+}
+
+// watchedFile is the state of a file at the previous scan.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher transcribes the files of a watch rule, the transcription slots are shared by the rules.
+type watcher struct {
+	ctx      context.Context
+	logger   *slog.Logger
+	client   *krs.STTClient
+	rule     *watchRule
+	attempts int
+	slots    chan struct{}
+	workers  *sync.WaitGroup
+	// scan only
+	seen map[string]watchedFile
+	// protected by mutex
+	mutex    sync.Mutex
+	busy     map[string]bool
+	failures map[string]int
+}
+
+// scan starts the transcription of the files which did not change since the previous scan.
+func (w *watcher) scan(ctx context.Context) (err error) {
+	entries, err := os.ReadDir(w.rule.Directory)
+	if err != nil {
+		return fmt.Errorf("failed to scan the directory: %w", err)
+	}
+	current := make(map[string]watchedFile, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			continue // removed meanwhile
+		}
+		state := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		current[name] = state
+		// Still being written, or empty
+		if previous, found := w.seen[name]; !found || previous != state || state.size == 0 {
+			continue
+		}
+		w.mutex.Lock()
+		busy := w.busy[name]
+		w.busy[name] = true
+		w.mutex.Unlock()
+		if busy {
+			continue
+		}
+		select {
+		case w.slots <- struct{}{}:
+		case <-ctx.Done():
+			w.release(name)
+			return
+		}
+		w.workers.Go(func() {
+			defer func() { <-w.slots }()
+			defer w.release(name)
+			w.process(name)
+		})
+	}
+	w.seen = current
+	return
+}
+
+func (w *watcher) release(name string) {
+	w.mutex.Lock()
+	delete(w.busy, name)
+	w.mutex.Unlock()
+}
+
+// errNotAudio is returned for the files which can not be decoded: retrying does not help.
+var errNotAudio = errors.New("not an audio file")
+
+// process transcribes a file, quarantining it when it is not audio or failed too many times.
+func (w *watcher) process(name string) {
+	logger := w.logger.With("file", name)
+	err := w.transcribe(logger, name)
+	switch {
+	case err == nil:
+		w.forget(name)
+		return
+	case w.ctx.Err() != nil:
+		return // aborted, picked again on the next run
+	case errors.Is(err, errNotAudio):
+		w.quarantine(logger, name, err)
+		return
+	}
+	w.mutex.Lock()
+	w.failures[name]++
+	failures := w.failures[name]
+	w.mutex.Unlock()
+	if failures < w.attempts {
+		logger.Warn("transcription failed, retrying on the next scan", "error", err, "attempt", failures)
+		return
+	}
+	w.quarantine(logger, name, fmt.Errorf("%d attempts failed, last one: %w", failures, err))
+}
+
+// transcribe transcribes a file and moves it to the done directory with its transcripts.
+func (w *watcher) transcribe(logger *slog.Logger, name string) (err error) {
+	filename := filepath.Join(w.rule.Directory, name)
+	start := time.Now()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read the file: %w", err)
+	}
+	// decoded from memory: only the content of the file can fail, not the disk
+	pcm, _, err := audio.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotAudio, err)
+	}
+	logger.Info("transcribing", "audio", time.Duration(len(pcm))*time.Second/krs.SampleRate)
+	transcript, err := w.client.Transcribe(w.ctx, pcm)
+	if err != nil {
+		return
+	}
+	for _, warning := range transcript.Input.Warnings() {
+		logger.Warn("badly leveled recording", "issue", warning)
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	sidecars, err := w.writeSidecars(filepath.Join(w.rule.Done, base), transcript)
+	if err != nil {
+		return
+	}
+	if err = moveFile(filename, filepath.Join(w.rule.Done, name)); err != nil {
+		return fmt.Errorf("failed to move the transcribed file: %w", err)
+	}
+	logger.Info("transcribed", "duration", time.Since(start).Round(time.Millisecond), "utterances", len(transcript.Utterances))
+	w.deliver(logger, deliveredTranscript{
+		File:       name,
+		Audio:      time.Duration(len(pcm)) * time.Second / krs.SampleRate,
+		Transcript: transcript,
+		Sidecars:   sidecars,
+	})
+	return
+}
+
+// deliver sends a transcript to the deliveries of the rule: the file is transcribed already, a
+// failure is only logged.
+func (w *watcher) deliver(logger *slog.Logger, dt deliveredTranscript) {
+	for _, target := range w.rule.Deliver {
+		if err := target.deliver(w.ctx, dt); err != nil {
+			logger.Error("failed to deliver the transcript", "to", target, "error", err)
+			continue
+		}
+		logger.Info("transcript delivered", "to", target)
+	}
+}
+
+// writeSidecars writes the transcripts of a file, base being the file path without extension.
+func (w *watcher) writeSidecars(base string, transcript krs.Transcript) (filenames []string, err error) {
+	for _, sidecar := range w.rule.Sidecars {
+		filename := base + "." + sidecar
+		switch sidecar {
+		case "txt":
+			if err = os.WriteFile(filename, []byte(transcript.Text()+"\n"), 0o644); err != nil {
+				err = fmt.Errorf("failed to write %q: %w", filename, err)
+			}
+		case "srt":
+			err = writeSRT(filename, transcript)
+		case "json":
+			err = writeTranscriptJSON(filename, transcript)
+		}
+		if err != nil {
+			return
+		}
+		filenames = append(filenames, filename)
+	}
+	return
+}
+
+// quarantine moves a file failing to transcribe to the failed directory, with the reason.
+func (w *watcher) quarantine(logger *slog.Logger, name string, reason error) {
+	logger.Error("quarantined", "error", reason)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if err := os.WriteFile(filepath.Join(w.rule.Failed, base+".error.txt"), []byte(reason.Error()+"\n"), 0o644); err != nil {
+		logger.Error("failed to write the quarantine reason", "error", err)
+	}
+	if err := moveFile(filepath.Join(w.rule.Directory, name), filepath.Join(w.rule.Failed, name)); err != nil {
+		logger.Error("failed to quarantine the file", "error", err)
+		return
+	}
+	w.forget(name)
+}
+
+func (w *watcher) forget(name string) {
+	w.mutex.Lock()
+	delete(w.failures, name)
+	w.mutex.Unlock()
+}
+
+// moveFile renames a file, copying it when the destination is on another file system.
+func moveFile(source, destination string) (err error) {
+	if err = os.Rename(source, destination); !errors.Is(err, syscall.EXDEV) {
+		return
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return
+	}
+	if err = out.Close(); err != nil {
+		return
+	}
+	return os.Remove(source)
+}
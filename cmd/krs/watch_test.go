@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+func newTestWatcher(t *testing.T, client *krs.STTClient, attempts int) *watcher {
+	t.Helper()
+	rule := &watchRule{Directory: t.TempDir()}
+	if err := rule.prepare(watchSidecars); err != nil {
+		t.Fatal(err)
+	}
+	return &watcher{
+		ctx:      context.Background(),
+		logger:   slog.New(slog.DiscardHandler),
+		client:   client,
+		rule:     rule,
+		attempts: attempts,
+		slots:    make(chan struct{}, 1),
+		workers:  new(sync.WaitGroup),
+		seen:     make(map[string]watchedFile),
+		busy:     make(map[string]bool),
+		failures: make(map[string]int),
+	}
+}
+
+// writeSilence writes seconds of raw float32 silence in the watched directory.
+func writeSilence(t *testing.T, w *watcher, name string, seconds int) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(w.rule.Directory, name), make([]byte, 4*seconds*krs.SampleRate), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func TestWatchSettle(t *testing.T) {
+	w := newTestWatcher(t, newSTTMock(t), 3)
+	scan := func() {
+		t.Helper()
+		if err := w.scan(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		w.workers.Wait()
+	}
+	writeSilence(t, w, "meeting.f32", 4)
+	writeSilence(t, w, "growing.f32", 1)
+	if err := os.WriteFile(filepath.Join(w.rule.Directory, "empty.f32"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the files seen for the first time may still be written
+	scan()
+	if exists(filepath.Join(w.rule.Done, "meeting.f32")) {
+		t.Fatal("transcribed on the first scan")
+	}
+	writeSilence(t, w, "growing.f32", 2)
+	scan()
+	if !exists(filepath.Join(w.rule.Done, "meeting.f32")) || !exists(filepath.Join(w.rule.Done, "meeting.txt")) {
+		t.Error("the settled file was not transcribed with its transcripts")
+	}
+	if exists(filepath.Join(w.rule.Done, "growing.f32")) {
+		t.Error("the file growing between the scans was transcribed")
+	}
+	scan()
+	if !exists(filepath.Join(w.rule.Done, "growing.f32")) {
+		t.Error("the file was not transcribed once settled")
+	}
+	if !exists(filepath.Join(w.rule.Directory, "empty.f32")) {
+		t.Error("the empty file was picked")
+	}
+}
+
+func TestWatchQuarantine(t *testing.T) {
+	// the files which are not audio are quarantined right away
+	w := newTestWatcher(t, newSTTMock(t), 3)
+	if err := os.WriteFile(filepath.Join(w.rule.Directory, "song.flac"), []byte("fLaC and more bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.process("song.flac")
+	reason, err := os.ReadFile(filepath.Join(w.rule.Failed, "song.error.txt"))
+	if err != nil || !exists(filepath.Join(w.rule.Failed, "song.flac")) {
+		t.Fatalf("the file which is not audio was not quarantined: %v", err)
+	}
+	if !strings.Contains(string(reason), "not an audio file") {
+		t.Errorf("got the reason %q", reason)
+	}
+	// a file failing to be read is retried
+	w.process("missing.f32")
+	if w.failures["missing.f32"] != 1 || exists(filepath.Join(w.rule.Failed, "missing.error.txt")) {
+		t.Errorf("got %d failures for the unreadable file, expected a retry", w.failures["missing.f32"])
+	}
+	// the transcription failures are retried, up to the attempts
+	server := newSTTMock(t)
+	unreachable, err := krs.NewSTTClient(&krs.STTConfig{URL: "ws://127.0.0.1:1", Retry: &krs.RetryPolicy{MaxAttempts: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = newTestWatcher(t, unreachable, 2)
+	writeSilence(t, w, "call.f32", 1)
+	w.process("call.f32")
+	if w.failures["call.f32"] != 1 || !exists(filepath.Join(w.rule.Directory, "call.f32")) {
+		t.Fatalf("got %d failures, expected the file kept for a retry", w.failures["call.f32"])
+	}
+	w.process("call.f32")
+	if !exists(filepath.Join(w.rule.Failed, "call.f32")) || !exists(filepath.Join(w.rule.Failed, "call.error.txt")) {
+		t.Error("the file was not quarantined after the last attempt")
+	}
+	if _, found := w.failures["call.f32"]; found {
+		t.Error("the failures of the quarantined file are still counted")
+	}
+	// transcribed once the server is back
+	w = newTestWatcher(t, server, 2)
+	writeSilence(t, w, "call.f32", 1)
+	w.process("call.f32")
+	if !exists(filepath.Join(w.rule.Done, "call.f32")) {
+		t.Error("the file was not transcribed")
+	}
+}
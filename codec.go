@@ -0,0 +1,159 @@
+package krs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/coder/websocket"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// WireFormat is the serialization of the frames exchanged with the server, sent as the format
+// query parameter.
+type WireFormat string
+
+const (
+	// WireFormatMessagePack exchanges MessagePack binary frames (default)
+	WireFormatMessagePack WireFormat = "PcmMessagePack"
+	// WireFormatJSON exchanges JSON text frames, only some server builds support it
+	WireFormatJSON WireFormat = "Json"
+)
+
+// codec serializes the frames of a wire format. The message structs are tagged for both msgp
+// and encoding/json.
+type codec interface {
+	format() WireFormat
+	// frameType is the websocket message type carrying the frames
+	frameType() websocket.MessageType
+	marshal(msg msgp.Marshaler) (payload []byte, err error)
+	unmarshal(payload []byte, msg msgp.Unmarshaler) (err error)
+	// decode decodes a frame without a target type (maps for objects)
+	decode(payload []byte) (value any, err error)
+}
+
+func newCodec(format WireFormat, base64Frames bool) (c codec, err error) {
+	switch format {
+	case "", WireFormatMessagePack:
+		c = msgpackCodec{}
+	case WireFormatJSON:
+		c = jsonCodec{}
+	default:
+		return nil, fmt.Errorf("unsupported wire format: %q", format)
+	}
+	if base64Frames {
+		if c.frameType() != websocket.MessageBinary {
+			return nil, fmt.Errorf("the %s wire format already uses text frames", format)
+		}
+		c = base64Codec{c}
+	}
+	return
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) format() WireFormat {
+	return WireFormatMessagePack
+}
+
+func (msgpackCodec) frameType() websocket.MessageType {
+	return websocket.MessageBinary
+}
+
+func (msgpackCodec) marshal(msg msgp.Marshaler) (payload []byte, err error) {
+	if payload, err = msg.MarshalMsg(nil); err != nil {
+		err = fmt.Errorf("failed to marshal message pack: %w", err)
+	}
+	return
+}
+
+func (msgpackCodec) unmarshal(payload []byte, msg msgp.Unmarshaler) (err error) {
+	if _, err = msg.UnmarshalMsg(payload); err != nil {
+		err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+	}
+	return
+}
+
+func (msgpackCodec) decode(payload []byte) (value any, err error) {
+	if value, _, err = msgp.ReadIntfBytes(payload); err != nil {
+		err = fmt.Errorf("failed to decode the message pack: %w", err)
+	}
+	return
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) format() WireFormat {
+	return WireFormatJSON
+}
+
+func (jsonCodec) frameType() websocket.MessageType {
+	return websocket.MessageText
+}
+
+func (jsonCodec) marshal(msg msgp.Marshaler) (payload []byte, err error) {
+	if payload, err = json.Marshal(msg); err != nil {
+		err = fmt.Errorf("failed to marshal JSON message: %w", err)
+	}
+	return
+}
+
+func (jsonCodec) unmarshal(payload []byte, msg msgp.Unmarshaler) (err error) {
+	if err = json.Unmarshal(payload, msg); err != nil {
+		err = fmt.Errorf("failed to unmarshal the JSON message: %w", err)
+	}
+	return
+}
+
+func (jsonCodec) decode(payload []byte) (value any, err error) {
+	if err = json.Unmarshal(payload, &value); err != nil {
+		err = fmt.Errorf("failed to decode the JSON message: %w", err)
+	}
+	return
+}
+
+// base64Codec wraps the binary frames of a codec in base64 text frames, for intermediaries
+// mangling the binary websocket traffic.
+type base64Codec struct {
+	codec
+}
+
+func (base64Codec) frameType() websocket.MessageType {
+	return websocket.MessageText
+}
+
+func (bc base64Codec) marshal(msg msgp.Marshaler) (payload []byte, err error) {
+	raw, err := bc.codec.marshal(msg)
+	if err != nil {
+		return
+	}
+	payload = make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+	base64.StdEncoding.Encode(payload, raw)
+	return
+}
+
+func (bc base64Codec) unmarshal(payload []byte, msg msgp.Unmarshaler) (err error) {
+	raw, err := decodeBase64(payload)
+	if err != nil {
+		return
+	}
+	return bc.codec.unmarshal(raw, msg)
+}
+
+func (bc base64Codec) decode(payload []byte) (value any, err error) {
+	raw, err := decodeBase64(payload)
+	if err != nil {
+		return
+	}
+	return bc.codec.decode(raw)
+}
+
+func decodeBase64(payload []byte) (raw []byte, err error) {
+	raw = make([]byte, base64.StdEncoding.DecodedLen(len(payload)))
+	n, err := base64.StdEncoding.Decode(raw, payload)
+	if err != nil {
+		err = fmt.Errorf("failed to decode the base64 frame: %w", err)
+		return
+	}
+	return raw[:n], nil
+}
@@ -0,0 +1,79 @@
+package krs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hekmon/kyutai-rs/testassets"
+)
+
+func TestJSONWireFormat(t *testing.T) {
+	testWireFormat(t, WireFormatJSON, false)
+	// unknown format
+	if _, err := NewSTTClient(&STTConfig{URL: "ws://localhost", Format: "Xml"}); err == nil {
+		t.Error("an unknown wire format has been accepted")
+	}
+}
+
+func TestBase64Frames(t *testing.T) {
+	testWireFormat(t, WireFormatMessagePack, true)
+	// JSON already uses text frames
+	if _, err := NewTTSClient(&TTSConfig{URL: "ws://localhost", Format: WireFormatJSON, Base64Frames: true}); err == nil {
+		t.Error("base64 frames have been accepted for the JSON wire format")
+	}
+}
+
+func testWireFormat(t *testing.T, format WireFormat, base64Frames bool) {
+	t.Helper()
+	server := newMockServer(t)
+	// STT
+	sttClient, err := NewSTTClient(&STTConfig{URL: server.URL(), Format: format, Base64Frames: base64Frames})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sttConn, err := sttClient.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer close(sttConn.GetWriteChan())
+		sttConn.GetWriteChan() <- testassets.MustPCM("tone")
+	}()
+	var words int
+	for msg := range sttConn.GetReadChan() {
+		if word, ok := msg.(MessagePackWord); ok && word.Text == "word" {
+			words++
+		}
+	}
+	if err = sttConn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if words == 0 {
+		t.Error("no word received")
+	}
+	// TTS
+	ttsClient, err := NewTTSClient(&TTSConfig{URL: server.URL(), Voice: "vctk/p225_023.wav", Format: format, Base64Frames: base64Frames})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttsConn, err := ttsClient.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go streamWords(ttsConn.GetContext(), ttsConn.GetWriteChan(), "one two")
+	var samples int
+	for msg := range ttsConn.GetReadChan() {
+		if audio, ok := msg.(MessagePackAudio); ok {
+			samples += len(audio.PCM)
+		}
+	}
+	if err = ttsConn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if samples != 2*FrameSize {
+		t.Errorf("got %d samples, expected %d", samples, 2*FrameSize)
+	}
+	if info, _ := ttsConn.ReadyInfo(); info.Voice != "vctk/p225_023.wav" || info.SampleRate != SampleRate {
+		t.Errorf("unexpected ready info: %+v", info)
+	}
+}
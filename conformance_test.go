@@ -0,0 +1,71 @@
+package krs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+type conformanceFrame interface {
+	msgp.Marshaler
+	msgp.Unmarshaler
+}
+
+// TestConformance checks the frames of testdata/frames. They are synthetic, encoded by hand after
+// the moshi-server sources rather than captured from a server (see the README there).
+func TestConformance(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		// decoded is an empty value of the type expected
+		decoded, expected conformanceFrame
+	}{
+		// sent by the library: must be encoded byte for byte
+		{"client-Audio", &MessagePackAudio{}, &MessagePackAudio{Type: MessagePackTypeAudio, PCM: []float32{0, 0.5, -0.25}}},
+		{"client-Marker", &MessagePackMarker{}, &MessagePackMarker{Type: MessagePackTypeMarker, ID: 42}},
+		{"client-Text", &MessagePackText{}, &MessagePackText{Type: MessagePackTypeText, Text: "Hello world"}},
+		{"client-Eos", &MessagePackHeader{}, &MessagePackHeader{Type: MessagePackTypeEoS}},
+		// sent by the server: must decode, whatever the field order and integer encodings
+		{"server-Ready", &MessagePackReady{}, &MessagePackReady{Type: MessagePackTypeReady}},
+		{"server-Step", &MessagePackStep{}, &MessagePackStep{
+			Type:        MessagePackTypeStep,
+			Prs:         []float32{0.125, 0.25, 0.5, 0},
+			StepIndex:   200,
+			BufferedPCM: 1920,
+		}},
+		{"server-Word", &MessagePackWord{}, &MessagePackWord{Type: MessagePackTypeWord, Text: "Bonjour", StartTime: 1.52}},
+		{"server-EndWord", &MessagePackWordEnd{}, &MessagePackWordEnd{Type: MessagePackTypeEndWord, StopTime: 1.92}},
+		{"server-Marker", &MessagePackMarker{}, &MessagePackMarker{Type: MessagePackTypeMarker, ID: 42}},
+		// the timestamps of the TTS text echo are not decoded
+		{"server-Text", &MessagePackText{}, &MessagePackText{Type: MessagePackTypeText, Text: "Hello"}},
+		{"server-Audio", &MessagePackAudio{}, &MessagePackAudio{Type: MessagePackTypeAudio, PCM: []float32{0, -0.5, 0.75}}},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			reference, err := os.ReadFile(filepath.Join("testdata", "frames", tc.file+".msgpack"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			left, err := tc.decoded.UnmarshalMsg(reference)
+			if err != nil {
+				t.Fatalf("failed to decode the reference frame: %v", err)
+			}
+			if len(left) > 0 {
+				t.Errorf("%d bytes left after decoding", len(left))
+			}
+			if !reflect.DeepEqual(tc.decoded, tc.expected) {
+				t.Errorf("decoded %+v, expected %+v", tc.decoded, tc.expected)
+			}
+			encoded, err := tc.expected.MarshalMsg(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(tc.file, "client-") && !bytes.Equal(encoded, reference) {
+				t.Errorf("encoded\n%x\nexpected\n%x", encoded, reference)
+			}
+		})
+	}
+}
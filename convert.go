@@ -0,0 +1,142 @@
+package krs
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+)
+
+// The conversions below run on every frame of the real time pipelines: they process the samples
+// by blocks of 8 through array pointers, so the compiler checks the bounds once per block instead
+// of once per sample and can keep the block in registers. The remaining samples are converted one
+// by one. They are pure Go for the embedded builds.
+
+const conversionBlock = 8
+
+// AppendInt16 appends the samples converted to signed 16 bits integers to dst, clipping them to
+// [-1, 1].
+func AppendInt16(dst []int16, pcm []float32) []int16 {
+	start := len(dst)
+	dst = slices.Grow(dst, len(pcm))[:start+len(pcm)]
+	out := dst[start:]
+	i := 0
+	for ; i+conversionBlock <= len(pcm); i += conversionBlock {
+		in := (*[conversionBlock]float32)(pcm[i:])
+		o := (*[conversionBlock]int16)(out[i:])
+		for j := range conversionBlock {
+			o[j] = toInt16(in[j])
+		}
+	}
+	for ; i < len(pcm); i++ {
+		out[i] = toInt16(pcm[i])
+	}
+	return dst
+}
+
+// AppendFloat32 appends signed 16 bits integer samples converted to float32 to dst.
+func AppendFloat32(dst []float32, samples []int16) []float32 {
+	start := len(dst)
+	dst = slices.Grow(dst, len(samples))[:start+len(samples)]
+	out := dst[start:]
+	i := 0
+	for ; i+conversionBlock <= len(samples); i += conversionBlock {
+		in := (*[conversionBlock]int16)(samples[i:])
+		o := (*[conversionBlock]float32)(out[i:])
+		for j := range conversionBlock {
+			o[j] = float32(in[j]) / math.MaxInt16
+		}
+	}
+	for ; i < len(samples); i++ {
+		out[i] = float32(samples[i]) / math.MaxInt16
+	}
+	return dst
+}
+
+// AppendInt16LE appends the samples converted to little endian signed 16 bits integers (s16le, the
+// wav and audio devices encoding) to dst, clipping them to [-1, 1].
+func AppendInt16LE(dst []byte, pcm []float32) []byte {
+	start := len(dst)
+	dst = slices.Grow(dst, 2*len(pcm))[:start+2*len(pcm)]
+	out := dst[start:]
+	i := 0
+	for ; i+conversionBlock <= len(pcm); i += conversionBlock {
+		in := (*[conversionBlock]float32)(pcm[i:])
+		o := (*[2 * conversionBlock]byte)(out[2*i:])
+		for j := range conversionBlock {
+			binary.LittleEndian.PutUint16(o[2*j:], uint16(toInt16(in[j])))
+		}
+	}
+	for ; i < len(pcm); i++ {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(toInt16(pcm[i])))
+	}
+	return dst
+}
+
+// Interleave appends the samples of each channel interleaved (first sample of each channel, then
+// the second...) to dst. The channels are truncated to the shortest one.
+func Interleave(dst []float32, channels ...[]float32) []float32 {
+	if len(channels) == 0 {
+		return dst
+	}
+	length := len(channels[0])
+	for _, channel := range channels[1:] {
+		length = min(length, len(channel))
+	}
+	start := len(dst)
+	dst = slices.Grow(dst, length*len(channels))[:start+length*len(channels)]
+	out := dst[start:]
+	if len(channels) == StereoChannels {
+		// the common case, without the inner loop
+		left, right := channels[0][:length], channels[1][:length]
+		for i := range left {
+			frame := (*[StereoChannels]float32)(out[2*i:])
+			frame[0], frame[1] = left[i], right[i]
+		}
+		return dst
+	}
+	for c, channel := range channels {
+		for i, sample := range channel[:length] {
+			out[i*len(channels)+c] = sample
+		}
+	}
+	return dst
+}
+
+// Deinterleave splits interleaved samples into their channels, the incomplete last frame is
+// dropped.
+func Deinterleave(interleaved []float32, channels int) (split [][]float32) {
+	if channels <= 0 {
+		return
+	}
+	length := len(interleaved) / channels
+	split = make([][]float32, channels)
+	for c := range split {
+		split[c] = make([]float32, length)
+	}
+	if channels == StereoChannels {
+		left, right := split[0], split[1]
+		for i := range left {
+			frame := (*[StereoChannels]float32)(interleaved[2*i:])
+			left[i], right[i] = frame[0], frame[1]
+		}
+		return
+	}
+	for i := range length {
+		frame := interleaved[i*channels : (i+1)*channels]
+		for c, sample := range frame {
+			split[c][i] = sample
+		}
+	}
+	return
+}
+
+// toInt16 clips with comparisons: the min and max builtins also order the NaNs and signed zeros,
+// which is noticeably slower.
+func toInt16(sample float32) int16 {
+	if sample > 1 {
+		sample = 1
+	} else if sample < -1 {
+		sample = -1
+	}
+	return int16(sample * math.MaxInt16)
+}
@@ -0,0 +1,52 @@
+package krs
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestConversions(t *testing.T) {
+	// not a multiple of the block size
+	pcm := make([]float32, 3*conversionBlock+5)
+	for i := range pcm {
+		pcm[i] = float32(math.Sin(float64(i))) * 1.2
+	}
+	samples := AppendInt16([]int16{42}, pcm)
+	if len(samples) != len(pcm)+1 || samples[0] != 42 {
+		t.Fatalf("AppendInt16 returned %d samples, expected %d after the existing one", len(samples), len(pcm)+1)
+	}
+	bytes := AppendInt16LE(nil, pcm)
+	for i, sample := range pcm {
+		expected := int16(min(max(sample, -1), 1) * math.MaxInt16)
+		if samples[i+1] != expected {
+			t.Errorf("AppendInt16: sample %d is %d, expected %d", i, samples[i+1], expected)
+		}
+		if got := int16(uint16(bytes[2*i]) | uint16(bytes[2*i+1])<<8); got != expected {
+			t.Errorf("AppendInt16LE: sample %d is %d, expected %d", i, got, expected)
+		}
+	}
+	back := AppendFloat32(nil, samples[1:])
+	for i, sample := range back {
+		if math.Abs(float64(sample-min(max(pcm[i], -1), 1))) > 1e-4 {
+			t.Errorf("AppendFloat32: sample %d is %g, expected %g", i, sample, pcm[i])
+		}
+	}
+	for _, channels := range []int{2, 3} {
+		split := make([][]float32, channels)
+		for c := range split {
+			split[c] = slices.Repeat([]float32{float32(c)}, 7)
+		}
+		split[0] = append(split[0], 9) // truncated
+		interleaved := Interleave(nil, split...)
+		if len(interleaved) != 7*channels || interleaved[channels+1] != 1 {
+			t.Errorf("Interleave(%d channels) = %v", channels, interleaved)
+		}
+		back := Deinterleave(append(interleaved, 9), channels)
+		for c := range back {
+			if !slices.Equal(back[c], split[c][:7]) {
+				t.Errorf("Deinterleave(%d channels): channel %d is %v", channels, c, back[c])
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package krs
+
+import (
+	"context"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// pooledFrame is a frame read ahead of the reader goroutine, its audio being decoded by a worker
+// of the pool.
+type pooledFrame struct {
+	msgType websocket.MessageType
+	payload []byte
+	wire    time.Time
+	// read error, last frame of the stream
+	err error
+	// header of the frame, audio frames only
+	header MessagePackHeader
+	// decoded audio, valid once decoded is closed
+	audio    MessagePackAudio
+	audioErr error
+	decoded  chan struct{}
+}
+
+// decodePool reads the frames of a connection ahead and unmarshals the Audio frames on several
+// goroutines, delivering the frames in order: the decoding of large audio frames on a slow CPU
+// does not hold up the reading of the next frames.
+type decodePool struct {
+	frames chan *pooledFrame
+}
+
+// newDecodePool starts reading frames with read until it fails, the goroutines stop once it
+// does or ctx is done.
+func newDecodePool(ctx context.Context, workers int, c codec,
+	read func() (websocket.MessageType, []byte, error)) (pool *decodePool) {
+	pool = &decodePool{
+		// the reading goes on while the workers decode, within limits
+		frames: make(chan *pooledFrame, 2*workers),
+	}
+	jobs := make(chan *pooledFrame, 2*workers)
+	for range workers {
+		go func() {
+			for frame := range jobs {
+				frame.audioErr = c.unmarshal(frame.payload, &frame.audio)
+				close(frame.decoded)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for {
+			frame := new(pooledFrame)
+			frame.msgType, frame.payload, frame.err = read()
+			frame.wire = time.Now()
+			if frame.err == nil && frame.msgType == c.frameType() &&
+				c.unmarshal(frame.payload, &frame.header) == nil && frame.header.Type == MessagePackTypeAudio {
+				frame.decoded = make(chan struct{})
+				select {
+				case jobs <- frame:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case pool.frames <- frame:
+			case <-ctx.Done():
+				return
+			}
+			if frame.err != nil {
+				return
+			}
+		}
+	}()
+	return
+}
+
+// next returns the next frame read, in order.
+func (dp *decodePool) next(ctx context.Context) (frame *pooledFrame, err error) {
+	select {
+	case frame = <-dp.frames:
+		return frame, frame.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// decodedAudio waits for the audio of a frame to be decoded, ok is false if the frame is not an
+// Audio frame decoded by the pool.
+func (pf *pooledFrame) decodedAudio(ctx context.Context) (audio MessagePackAudio, ok bool, err error) {
+	if pf == nil || pf.decoded == nil {
+		return
+	}
+	select {
+	case <-pf.decoded:
+		return pf.audio, true, pf.audioErr
+	case <-ctx.Done():
+		return audio, true, ctx.Err()
+	}
+}
@@ -1,7 +1,14 @@
 package krs
 
+import "time"
+
 const (
 	SampleRate  = 24_000
 	NumChannels = 1
 	FrameSize   = 1920
+	// FrameDuration is the audio duration of a frame, which is also the duration of a server step
+	FrameDuration = FrameSize * time.Second / SampleRate
+	// STTStreamOffset is the stream time of the first audio sample of a STT connection: a second of
+	// silence is sent before it, the word timings include it
+	STTStreamOffset = time.Second
 )
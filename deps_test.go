@@ -0,0 +1,59 @@
+package krs
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestLibraryDependencies keeps the library importable by server applications without dragging
+// the audio and UI dependencies of the commands: they live in their own modules under cmd.
+func TestLibraryDependencies(t *testing.T) {
+	allowed := []string{
+		"github.com/hekmon/kyutai-rs",
+		"github.com/coder/websocket",
+		"github.com/tinylib/msgp",
+		"C", // the speex echo canceller, opt-in build tag
+	}
+	err := filepath.WalkDir(".", func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// other modules and the internal generators have their own dependencies
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); (err == nil && path != ".") ||
+				entry.Name() == "internal" || entry.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+	imports:
+		for _, spec := range file.Imports {
+			imported, _ := strconv.Unquote(spec.Path.Value)
+			if !strings.Contains(strings.Split(imported, "/")[0], ".") && imported != "C" {
+				continue // standard library
+			}
+			for _, prefix := range allowed {
+				if imported == prefix || strings.HasPrefix(imported, prefix+"/") {
+					continue imports
+				}
+			}
+			t.Errorf("%s imports %s: the library only depends on the websocket and MessagePack modules", path, imported)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
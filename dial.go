@@ -0,0 +1,74 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/coder/websocket"
+)
+
+// ErrUnauthorized is returned by Connect() when the server rejected the API key during the
+// websocket handshake (HTTP 401 or 403).
+var ErrUnauthorized = errors.New("the server rejected the API key")
+
+// newHTTPClient returns the client dialing the websocket connections (nil for the default one):
+// the connections are degraded according to the network conditions and keep their TCP keepalives
+// far apart in power saver mode. The websocket connection keeps using the net.Conn dialed for the
+// HTTP upgrade.
+func newHTTPClient(conditions *NetworkConditions, powerSaver bool) *http.Client {
+	if conditions == nil && !powerSaver {
+		return nil
+	}
+	dialer := &net.Dialer{}
+	if powerSaver {
+		dialer.KeepAliveConfig = powerSaverKeepAlive
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (conn net.Conn, err error) {
+		if conn, err = dialer.DialContext(ctx, network, address); err != nil {
+			return
+		}
+		if conditions != nil {
+			conn = newSimulatedConn(conn, *conditions)
+		}
+		return
+	}
+	return &http.Client{Transport: transport}
+}
+
+// dialError explains a failed websocket handshake.
+func dialError(resp *http.Response, err error) error {
+	if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("failed to dial websocket: %w (HTTP %d)", ErrUnauthorized, resp.StatusCode)
+	}
+	if resp != nil && formatRejected(resp.StatusCode) {
+		return fmt.Errorf("failed to dial websocket: %w (HTTP %d)", ErrFormatRejected, resp.StatusCode)
+	}
+	return fmt.Errorf("failed to dial websocket: %w", err)
+}
+
+// dial opens the websocket connection to address, retrying the handshake according to the retry
+// policy of the options. A rejected API key or wire format is not retried by default.
+func dial(ctx context.Context, address, apiKey string, httpClient *http.Client, opts connectOptions) (
+	conn *websocket.Conn, err error) {
+	policy := DefaultRetryPolicy
+	if opts.retry != nil {
+		policy = *opts.retry
+	}
+	err = policy.Do(ctx, func(ctx context.Context) (err error) {
+		var resp *http.Response
+		if conn, resp, err = websocket.Dial(ctx, address, &websocket.DialOptions{
+			HTTPHeader: http.Header{
+				"kyutai-api-key": []string{apiKey},
+			},
+			HTTPClient: httpClient,
+		}); err != nil {
+			err = dialError(resp, err)
+		}
+		return
+	})
+	return
+}
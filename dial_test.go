@@ -0,0 +1,146 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUnauthorized(t *testing.T) {
+	server := newMockServer(t)
+	server.apiKey = "secret"
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), APIKey: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Connect(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	sttClient, err := NewSTTClient(&STTConfig{URL: server.URL(), APIKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := sttClient.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestConnectOptions(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Connect(context.Background(), WithVoice("first.wav")); !errors.Is(err, ErrTTSOption) {
+		t.Errorf("expected ErrTTSOption, got %v", err)
+	}
+	// the handshake fails twice before succeeding
+	server.unavailable.Store(2)
+	if _, err = client.Connect(context.Background(), WithRetry(RetryPolicy{MaxAttempts: 2})); err == nil {
+		t.Fatal("connected with a single retry")
+	}
+	server.unavailable.Store(2)
+	conn, err := client.Connect(context.Background(), WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}), WithFormat(WireFormatJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go streamAudio(conn, 20)
+	var steps int
+	for msg := range conn.GetReadChan() {
+		if msg.MessageType() == MessagePackTypeStep {
+			steps++
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if steps == 0 {
+		t.Error("no step received in the JSON wire format")
+	}
+}
+
+func TestFormatNegotiation(t *testing.T) {
+	server := newMockServer(t)
+	server.formats = []WireFormat{WireFormatMessagePack}
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), Formats: []WireFormat{WireFormatJSON, WireFormatMessagePack}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first connection negotiates, the next ones reuse the accepted format
+	for i, expected := range []int32{2, 1} {
+		server.handshakes.Store(0)
+		conn, err := client.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+		if format := conn.Format(); format != WireFormatMessagePack {
+			t.Errorf("negotiated %s, expected %s", format, WireFormatMessagePack)
+		}
+		if handshakes := server.handshakes.Load(); handshakes != expected {
+			t.Errorf("connection %d: got %d handshakes, expected %d", i+1, handshakes, expected)
+		}
+	}
+	// no format accepted: each one is tried once, without retries
+	server.formats = []WireFormat{"Opus"}
+	server.handshakes.Store(0)
+	if _, err = client.Connect(context.Background(), WithRetry(RetryPolicy{MaxAttempts: 4})); !errors.Is(err, ErrFormatRejected) {
+		t.Errorf("expected ErrFormatRejected, got %v", err)
+	}
+	if handshakes := server.handshakes.Load(); handshakes != 2 {
+		t.Errorf("got %d handshakes, expected 2", handshakes)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	for retry, expected := range []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second} {
+		if delay := policy.Delay(retry + 1); delay != expected {
+			t.Errorf("retry %d: expected a %s delay, got %s", retry+1, expected, delay)
+		}
+	}
+	policy.Jitter = 0.5
+	for range 100 {
+		if delay := policy.Delay(1); delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Fatalf("delay %s out of the jitter range", delay)
+		}
+	}
+
+	// The client policy retries the unavailable server but not a rejected API key
+	server := newMockServer(t)
+	server.apiKey = "secret"
+	client, err := NewSTTClient(&STTConfig{
+		URL:    server.URL(),
+		APIKey: "secret",
+		Retry:  &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Multiplier: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.unavailable.Store(2)
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	server.unavailable.Store(3)
+	if _, err = client.Connect(context.Background()); err == nil {
+		t.Fatal("connected beyond the maximum attempts")
+	}
+	server.unavailable.Store(0)
+	client.apiKey = "wrong"
+	var retried bool
+	retryable := func(err error) bool {
+		retried = Retryable(err)
+		return retried
+	}
+	if _, err = client.Connect(context.Background(), WithRetry(RetryPolicy{MaxAttempts: 2, Retryable: retryable})); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	if retried {
+		t.Error("the rejected API key was retried")
+	}
+}
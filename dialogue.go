@@ -0,0 +1,140 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// DefaultDialogueGap is the silence between the turns of a dialogue.
+const DefaultDialogueGap = 300 * time.Millisecond
+
+// DialogueLine is a turn of a dialogue script.
+type DialogueLine struct {
+	// Voice speaking the line, empty for the client voice
+	Voice string
+	Text  string
+}
+
+// DialogueConfig is the configuration of TTSClient.SynthesizeDialogue.
+type DialogueConfig struct {
+	// Gap is the silence between two turns (default DefaultDialogueGap)
+	Gap time.Duration
+	// Level is the speech level the voices are matched at, in dBFS (default InputTargetLevel). It
+	// is lowered when a voice would peak above -1 dBFS, all the voices keeping the same level.
+	Level float64
+	// KeepLevels disables the loudness matching: the voices keep the levels they are
+	// synthesized at
+	KeepLevels bool
+}
+
+// DialogueTurn is a line of a synthesized dialogue.
+type DialogueTurn struct {
+	Voice string `json:"voice"`
+	Text  string `json:"text"`
+	// Start and End are the times of the turn in the dialogue audio (nanoseconds in JSON)
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+}
+
+// Dialogue is a synthesized dialogue.
+type Dialogue struct {
+	// PCM is the audio of the dialogue, 24kHz mono
+	PCM   []float32      `json:"-"`
+	Turns []DialogueTurn `json:"turns"`
+	// Voices are the levels of each voice measured over all its turns, with the gain applied to
+	// match them
+	Voices map[string]InputLevels `json:"voices"`
+}
+
+// SynthesizeDialogue synthesizes a script with several voices, one connection per line (see
+// Synthesize), and assembles the turns with a gap of silence between them. The voices of a gallery
+// are recorded at different levels: unless config.KeepLevels, the level of each voice is measured
+// over all its turns and the voices are brought to the same speech level, so that no speaker is
+// noticeably louder than another in the mix.
+func (client *TTSClient) SynthesizeDialogue(ctx context.Context, script []DialogueLine, config DialogueConfig) (dialogue Dialogue, err error) {
+	if len(script) == 0 {
+		err = errors.New("empty dialogue script")
+		return
+	}
+	if config.Gap <= 0 {
+		config.Gap = DefaultDialogueGap
+	}
+	if config.Level == 0 {
+		config.Level = InputTargetLevel
+	}
+	turns := make([][]float32, len(script))
+	voices := make([]string, len(script))
+	for i, line := range script {
+		var voice *string
+		if line.Voice != "" {
+			voice = &line.Voice
+		}
+		if turns[i], err = client.synthesizeStyled(ctx, line.Text, voice); err != nil {
+			err = fmt.Errorf("failed to synthesize line %d: %w", i+1, err)
+			return
+		}
+		voices[i] = line.Voice
+		if voices[i] == "" {
+			voices[i] = client.voice
+		}
+	}
+	dialogue.Voices = measureVoices(turns, voices)
+	if !config.KeepLevels {
+		matchVoices(dialogue.Voices, config.Level)
+	}
+	gap := Silence(config.Gap)
+	for i, pcm := range turns {
+		if i > 0 {
+			dialogue.PCM = append(dialogue.PCM, gap...)
+		}
+		start := time.Duration(len(dialogue.PCM)) * time.Second / SampleRate
+		// the synthesized audio can be shared with the synthesis cache, the gain is applied to the copy
+		factor := float32(math.Pow(10, dialogue.Voices[voices[i]].Gain/20))
+		for _, sample := range pcm {
+			dialogue.PCM = append(dialogue.PCM, sample*factor)
+		}
+		dialogue.Turns = append(dialogue.Turns, DialogueTurn{
+			Voice: voices[i],
+			Text:  script[i].Text,
+			Start: start,
+			End:   time.Duration(len(dialogue.PCM)) * time.Second / SampleRate,
+		})
+	}
+	return
+}
+
+// measureVoices analyses the levels of each voice over all its turns.
+func measureVoices(turns [][]float32, voices []string) (levels map[string]InputLevels) {
+	levels = make(map[string]InputLevels)
+	for _, voice := range slices.Compact(slices.Sorted(slices.Values(voices))) {
+		var speech []float32
+		for i, pcm := range turns {
+			if voices[i] == voice {
+				speech = append(speech, pcm...)
+			}
+		}
+		levels[voice] = AnalyzeInput(speech)
+	}
+	return
+}
+
+// matchVoices sets the gains bringing the speech of every voice to level: the level is lowered for
+// all the voices if one of them would peak above -1 dBFS.
+func matchVoices(levels map[string]InputLevels, level float64) {
+	for _, voice := range levels {
+		if !voice.Silent {
+			level = min(level, voice.Speech+inputMaxPeak-voice.Peak)
+		}
+	}
+	for name, voice := range levels {
+		if voice.Silent {
+			continue
+		}
+		voice.Gain = max(min(level-voice.Speech, inputMaxGain), -inputMaxGain)
+		levels[name] = voice
+	}
+}
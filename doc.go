@@ -0,0 +1,8 @@
+// Package krs is a client for the Kyutai Rust server streaming TTS and STT websocket APIs: the
+// connections exchange text and audio with the server through Go channels, the MessagePack
+// framing being handled by background workers.
+//
+// The module follows semantic versioning from v1: within v1, the exported API keeps compiling and
+// behaving as documented, deprecated identifiers are kept until v2. The connections are returned as
+// pointers and must not be copied.
+package krs
@@ -0,0 +1,137 @@
+package krs
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// processing block of the echo filters: 20ms
+	echoBlockSize = SampleRate / 50
+	// maximum amount of reference audio kept while waiting for the matching captured audio
+	echoMaxReference = 2 * SampleRate
+)
+
+type EchoCancellerConfig struct {
+	// Tail is the echo length the filter can cancel (room reverberation + device latency jitter, default 100ms)
+	Tail time.Duration
+	// Delay is the fixed latency between the audio written to the sink and the moment it is
+	// captured back by the microphone (output + input device buffers)
+	Delay time.Duration
+}
+
+// EchoCanceller removes the Speaker output from the Listener input when both run simultaneously,
+// preventing a full-duplex assistant from transcribing its own voice. Wrap the Speaker sink
+// with Reference() and the Listener source with Filter().
+// By default an adaptive (NLMS) reference subtraction filter is used, build with the "speex"
+// tag (and cgo) to use the speexdsp echo canceller instead.
+type EchoCanceller struct {
+	mutex     sync.Mutex
+	filter    echoFilter
+	reference []float32
+	captured  []float32
+	delay     int
+}
+
+type echoFilter interface {
+	// process removes the reference echo from a block of echoBlockSize captured samples, in place
+	process(captured, reference []float32)
+	close()
+}
+
+func NewEchoCanceller(config EchoCancellerConfig) (ec *EchoCanceller) {
+	if config.Tail <= 0 {
+		config.Tail = 100 * time.Millisecond
+	}
+	ec = &EchoCanceller{
+		filter: newEchoFilter(int(config.Tail * SampleRate / time.Second)),
+		delay:  int(config.Delay * SampleRate / time.Second),
+	}
+	ec.reset()
+	return
+}
+
+// Reference returns a sink feeding the canceller with everything written to the wrapped sink.
+func (ec *EchoCanceller) Reference(sink AudioSink) AudioSink {
+	return echoReferenceSink{canceller: ec, sink: sink}
+}
+
+// Filter returns a source removing the echo from the audio read from the wrapped source.
+// Samples are returned by blocks of 20ms.
+func (ec *EchoCanceller) Filter(source AudioSource) AudioSource {
+	return echoFilteredSource{canceller: ec, source: source}
+}
+
+// Close releases the filter resources.
+func (ec *EchoCanceller) Close() {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	ec.filter.close()
+}
+
+func (ec *EchoCanceller) playback(pcm []float32) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	ec.reference = append(ec.reference, pcm...)
+	if overflow := len(ec.reference) - echoMaxReference; overflow > 0 {
+		// the source is not read, drop the oldest reference samples
+		ec.reference = ec.reference[overflow:]
+	}
+}
+
+// reset drops the pending reference samples and restores the device latency.
+func (ec *EchoCanceller) reset() {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	ec.reference = make([]float32, ec.delay, ec.delay+echoMaxReference)
+}
+
+func (ec *EchoCanceller) cancel(pcm []float32) (filtered []float32) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	ec.captured = append(ec.captured, pcm...)
+	reference := make([]float32, echoBlockSize)
+	for len(ec.captured) >= echoBlockSize {
+		block := ec.captured[:echoBlockSize:echoBlockSize]
+		// consume the matching reference, silence if the speaker is idle
+		clear(reference)
+		consumed := copy(reference, ec.reference)
+		ec.reference = ec.reference[consumed:]
+		ec.filter.process(block, reference)
+		filtered = append(filtered, block...)
+		ec.captured = ec.captured[echoBlockSize:]
+	}
+	return
+}
+
+type echoReferenceSink struct {
+	canceller *EchoCanceller
+	sink      AudioSink
+}
+
+func (s echoReferenceSink) WritePCM(pcm []float32) (err error) {
+	if err = s.sink.WritePCM(pcm); err != nil {
+		return
+	}
+	s.canceller.playback(pcm)
+	return
+}
+
+func (s echoReferenceSink) Discard() {
+	s.sink.Discard()
+	s.canceller.reset()
+}
+
+type echoFilteredSource struct {
+	canceller *EchoCanceller
+	source    AudioSource
+}
+
+func (s echoFilteredSource) ReadPCM() (pcm []float32, err error) {
+	for len(pcm) == 0 && err == nil {
+		var captured []float32
+		captured, err = s.source.ReadPCM()
+		pcm = s.canceller.cancel(captured)
+	}
+	return
+}
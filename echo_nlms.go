@@ -0,0 +1,64 @@
+//go:build !(cgo && speex)
+
+package krs
+
+const (
+	// NLMS adaptation step
+	nlmsStep = 0.3
+	// regularization to avoid adapting on near silent reference
+	nlmsEpsilon = 1e-3
+)
+
+func newEchoFilter(taps int) echoFilter {
+	return &nlmsFilter{
+		weights: make([]float32, taps),
+		history: make([]float32, 2*taps),
+		taps:    taps,
+	}
+}
+
+// nlmsFilter is a normalized least mean squares adaptive filter estimating the echo path from
+// the reference signal and subtracting the estimated echo from the captured signal.
+type nlmsFilter struct {
+	weights []float32
+	// reference history stored twice to always have a contiguous window
+	history  []float32
+	position int
+	energy   float64
+	taps     int
+}
+
+func (f *nlmsFilter) process(captured, reference []float32) {
+	for i, sample := range reference {
+		// Update the reference history
+		oldest := f.history[f.position]
+		f.energy += float64(sample)*float64(sample) - float64(oldest)*float64(oldest)
+		if f.energy < 0 {
+			f.energy = 0
+		}
+		f.history[f.position] = sample
+		f.history[f.position+f.taps] = sample
+		f.position++
+		if f.position == f.taps {
+			f.position = 0
+		}
+		window := f.history[f.position : f.position+f.taps]
+		// Estimate and remove the echo (window is ordered oldest first)
+		var estimate float32
+		for t, w := range f.weights {
+			estimate += w * window[t]
+		}
+		residual := captured[i] - estimate
+		captured[i] = residual
+		// Adapt the echo path estimation
+		if f.energy < nlmsEpsilon {
+			continue
+		}
+		gain := float32(nlmsStep * float64(residual) / (f.energy + nlmsEpsilon))
+		for t := range f.weights {
+			f.weights[t] += gain * window[t]
+		}
+	}
+}
+
+func (f *nlmsFilter) close() {}
@@ -0,0 +1,64 @@
+//go:build cgo && speex
+
+package krs
+
+/*
+#cgo pkg-config: speexdsp
+#include <speex/speex_echo.h>
+#include <speex/speex_preprocess.h>
+*/
+import "C"
+
+import (
+	"math"
+	"unsafe"
+)
+
+func newEchoFilter(taps int) echoFilter {
+	f := &speexFilter{
+		echo:       C.speex_echo_state_init(C.int(echoBlockSize), C.int(taps)),
+		preprocess: C.speex_preprocess_state_init(C.int(echoBlockSize), C.int(SampleRate)),
+		captured:   make([]C.spx_int16_t, echoBlockSize),
+		reference:  make([]C.spx_int16_t, echoBlockSize),
+		output:     make([]C.spx_int16_t, echoBlockSize),
+	}
+	rate := C.int(SampleRate)
+	C.speex_echo_ctl(f.echo, C.SPEEX_ECHO_SET_SAMPLING_RATE, unsafe.Pointer(&rate))
+	// the preprocessor suppresses the residual echo left by the linear canceller
+	C.speex_preprocess_ctl(f.preprocess, C.SPEEX_PREPROCESS_SET_ECHO_STATE, unsafe.Pointer(f.echo))
+	return f
+}
+
+// speexFilter uses the speexdsp multidelay block frequency domain echo canceller.
+type speexFilter struct {
+	echo       *C.SpeexEchoState
+	preprocess *C.SpeexPreprocessState
+	captured   []C.spx_int16_t
+	reference  []C.spx_int16_t
+	output     []C.spx_int16_t
+}
+
+func (f *speexFilter) process(captured, reference []float32) {
+	for i := range captured {
+		f.captured[i] = toSpeexSample(captured[i])
+		f.reference[i] = toSpeexSample(reference[i])
+	}
+	C.speex_echo_cancellation(f.echo, &f.captured[0], &f.reference[0], &f.output[0])
+	C.speex_preprocess_run(f.preprocess, &f.output[0])
+	for i, sample := range f.output {
+		captured[i] = float32(sample) / math.MaxInt16
+	}
+}
+
+func (f *speexFilter) close() {
+	if f.echo == nil {
+		return
+	}
+	C.speex_preprocess_state_destroy(f.preprocess)
+	C.speex_echo_state_destroy(f.echo)
+	f.echo, f.preprocess = nil, nil
+}
+
+func toSpeexSample(sample float32) C.spx_int16_t {
+	return C.spx_int16_t(max(-1, min(1, sample)) * math.MaxInt16)
+}
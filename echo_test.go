@@ -0,0 +1,67 @@
+package krs
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+type testSink struct{}
+
+func (testSink) WritePCM([]float32) error { return nil }
+func (testSink) Discard()                 {}
+
+type testSource struct {
+	blocks [][]float32
+}
+
+func (s *testSource) ReadPCM() (pcm []float32, err error) {
+	pcm, s.blocks = s.blocks[0], s.blocks[1:]
+	return
+}
+
+func TestEchoCanceller(t *testing.T) {
+	const delay = 240
+	ec := NewEchoCanceller(EchoCancellerConfig{Tail: 20 * time.Millisecond})
+	defer ec.Close()
+	sink := ec.Reference(testSink{})
+	source := &testSource{}
+	filtered := ec.Filter(source)
+	// The microphone captures the played noise delayed and attenuated
+	random := rand.New(rand.NewPCG(1, 2))
+	played := make([]float32, 75*FrameSize)
+	for i := range played {
+		played[i] = float32(random.NormFloat64() * 0.1)
+	}
+	var echoEnergy, residualEnergy float64
+	for start := 0; start < len(played); start += FrameSize {
+		frame := played[start : start+FrameSize]
+		captured := make([]float32, FrameSize)
+		for i := range captured {
+			if at := start + i - delay; at >= 0 {
+				captured[i] = 0.6 * played[at]
+			}
+		}
+		if err := sink.WritePCM(frame); err != nil {
+			t.Fatal(err)
+		}
+		source.blocks = append(source.blocks, captured)
+		residual, err := filtered.ReadPCM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// measure once the filter had time to converge
+		if start >= 4*SampleRate {
+			for i := range captured {
+				echoEnergy += float64(captured[i]) * float64(captured[i])
+			}
+			for _, sample := range residual {
+				residualEnergy += float64(sample) * float64(sample)
+			}
+		}
+	}
+	if attenuation := 10 * math.Log10(echoEnergy/residualEnergy); attenuation < 20 {
+		t.Errorf("echo attenuated by %.1f dB, expected at least 20 dB", attenuation)
+	}
+}
@@ -0,0 +1,245 @@
+package krs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// DefaultEnsembleWindow is the largest distance between the starts of two words of different
+// transcripts voting for the same word of an ensemble transcript.
+const DefaultEnsembleWindow = 500 * time.Millisecond
+
+// EnsembleMember is an STT server of an ensemble transcription.
+type EnsembleMember struct {
+	Client *STTClient
+	// Weight is the confidence in the transcripts of the server, relative to the other members
+	// (default 1): give more to a larger model
+	Weight float64
+}
+
+// EnsembleConfig is the configuration of TranscribeEnsemble and VoteTranscripts.
+type EnsembleConfig struct {
+	// Window is the largest distance between the starts of the words aligned together (default
+	// DefaultEnsembleWindow)
+	Window time.Duration
+}
+
+// TranscribeEnsemble is experimental: it transcribes the same audio with several STT servers at
+// once (see STTClient.Transcribe), for example different model sizes, and merges their transcripts
+// with VoteTranscripts. It trades compute for accuracy on critical transcriptions. The transcripts
+// of the members are returned along with the merged one, in the order of the members.
+func TranscribeEnsemble(ctx context.Context, members []EnsembleMember, pcm []float32, config EnsembleConfig) (transcript Transcript, transcripts []Transcript, err error) {
+	if len(members) == 0 {
+		err = errors.New("no STT server in the ensemble")
+		return
+	}
+	transcripts = make([]Transcript, len(members))
+	weights := make([]float64, len(members))
+	workers, workersCtx := newWorkerGroup(ctx)
+	for i, member := range members {
+		weights[i] = member.Weight
+		workers.Go(recovered(func() (err error) {
+			if transcripts[i], err = member.Client.Transcribe(workersCtx, pcm); err != nil {
+				return fmt.Errorf("server %d failed to transcribe: %w", i+1, err)
+			}
+			return
+		}))
+	}
+	if err = workers.Wait(); err != nil {
+		return Transcript{}, nil, err
+	}
+	transcript = VoteTranscripts(transcripts, weights, config)
+	return
+}
+
+// VoteTranscripts merges several transcripts of the same audio (ROVER): their words are aligned on
+// their times and text into slots, each transcript voting with its weight (default 1) for its word
+// of a slot or for no word. The winning words keep the text and times of the heaviest transcript
+// voting for them and their Confidence is the share of the total weight they got. Ties go to the
+// word, then to the heaviest transcript: with two transcripts, the heaviest always wins, the voting
+// takes three of them or more. The utterances end where the transcript of the words ended them.
+func VoteTranscripts(transcripts []Transcript, weights []float64, config EnsembleConfig) (voted Transcript) {
+	if config.Window <= 0 {
+		config.Window = DefaultEnsembleWindow
+	}
+	// the members from the heaviest, the first one being the backbone of the alignment
+	members := make([]ensembleMember, len(transcripts))
+	var total float64
+	for i, transcript := range transcripts {
+		members[i] = ensembleMember{index: i, weight: 1}
+		if i < len(weights) && weights[i] > 0 {
+			members[i].weight = weights[i]
+		}
+		total += members[i].weight
+		for _, utterance := range transcript.Utterances {
+			for j, word := range utterance.Words {
+				members[i].words = append(members[i].words, ensembleWord{
+					Word: word,
+					key:  matchKey(word.Text),
+					last: j == len(utterance.Words)-1,
+				})
+			}
+		}
+	}
+	slices.SortStableFunc(members, func(a, b ensembleMember) int {
+		return cmp.Compare(b.weight, a.weight)
+	})
+	if len(members) > 0 {
+		voted.Tags = transcripts[members[0].index].Tags
+		voted.Input = transcripts[members[0].index].Input
+	}
+	for _, segment := range ensembleSegments(members, config.Window) {
+		for _, slot := range alignSegment(segment, config.Window) {
+			word, confidence := slot.vote(members, total)
+			if word == nil {
+				continue
+			}
+			voted.AddWord(Word{Text: word.Text, Start: word.Start, End: word.End, Confidence: confidence})
+			if word.last {
+				voted.EndUtterance()
+			}
+		}
+	}
+	return
+}
+
+type ensembleMember struct {
+	index  int
+	weight float64
+	words  []ensembleWord
+}
+
+type ensembleWord struct {
+	Word
+	// key is the compared form of the word, last tells whether it ended its utterance
+	key  string
+	last bool
+}
+
+// ensembleSlot is a word position of the alignment, with the word of each member (nil for none).
+type ensembleSlot struct {
+	start time.Duration
+	words []*ensembleWord
+}
+
+// vote returns the word winning the slot, nil if no word wins.
+func (slot ensembleSlot) vote(members []ensembleMember, total float64) (winner *ensembleWord, confidence float64) {
+	var (
+		scores = make(map[string]float64)
+		none   float64
+		best   float64
+	)
+	for m, word := range slot.words {
+		if word == nil {
+			none += members[m].weight
+			continue
+		}
+		scores[word.key] += members[m].weight
+	}
+	// the members are sorted from the heaviest: on a tie, the first word wins
+	for _, word := range slot.words {
+		if word != nil && scores[word.key] > best {
+			winner, best = word, scores[word.key]
+		}
+	}
+	if best < none {
+		return nil, 0
+	}
+	return winner, best / total
+}
+
+// ensembleSegments cuts the words of the members at the pauses of all of them longer than the
+// window: the segments are aligned separately.
+func ensembleSegments(members []ensembleMember, window time.Duration) (segments [][][]ensembleWord) {
+	type located struct {
+		member int
+		word   ensembleWord
+	}
+	var all []located
+	for m, member := range members {
+		for _, word := range member.words {
+			all = append(all, located{m, word})
+		}
+	}
+	slices.SortStableFunc(all, func(a, b located) int {
+		return cmp.Compare(a.word.Start, b.word.Start)
+	})
+	var (
+		segment [][]ensembleWord
+		end     time.Duration
+	)
+	for _, word := range all {
+		if segment != nil && word.word.Start > end+window {
+			segments = append(segments, segment)
+			segment = nil
+		}
+		if segment == nil {
+			segment = make([][]ensembleWord, len(members))
+		}
+		segment[word.member] = append(segment[word.member], word.word)
+		end = max(end, word.word.Start, word.word.End)
+	}
+	if segment != nil {
+		segments = append(segments, segment)
+	}
+	return
+}
+
+// alignSegment aligns the words of each member with the slots of the previous ones, by edit
+// distance: a word fills a slot starting within the window, at no cost if the slot already has the
+// same word, and a word left out has a slot of its own.
+func alignSegment(segment [][]ensembleWord, window time.Duration) (slots []ensembleSlot) {
+	const impossible = math.MaxInt / 2
+	for m, words := range segment {
+		substitution := func(slot ensembleSlot, word ensembleWord) int {
+			if diff := slot.start - word.Start; diff > window || diff < -window {
+				return impossible
+			}
+			for _, other := range slot.words {
+				if other != nil && other.key == word.key {
+					return 0
+				}
+			}
+			return 1
+		}
+		costs := make([][]int, len(slots)+1)
+		for i := range costs {
+			costs[i] = make([]int, len(words)+1)
+			costs[i][0] = i
+		}
+		for j := range costs[0] {
+			costs[0][j] = j
+		}
+		for i := 1; i <= len(slots); i++ {
+			for j := 1; j <= len(words); j++ {
+				costs[i][j] = min(costs[i-1][j-1]+substitution(slots[i-1], words[j-1]), costs[i-1][j]+1, costs[i][j-1]+1)
+			}
+		}
+		// backtrack
+		var aligned []ensembleSlot
+		for i, j := len(slots), len(words); i > 0 || j > 0; {
+			switch {
+			case i > 0 && j > 0 && costs[i][j] == costs[i-1][j-1]+substitution(slots[i-1], words[j-1]):
+				i, j = i-1, j-1
+				slots[i].words[m] = &words[j]
+				aligned = append(aligned, slots[i])
+			case i > 0 && costs[i][j] == costs[i-1][j]+1:
+				i--
+				aligned = append(aligned, slots[i])
+			default:
+				j--
+				slot := ensembleSlot{start: words[j].Start, words: make([]*ensembleWord, len(segment))}
+				slot.words[m] = &words[j]
+				aligned = append(aligned, slot)
+			}
+		}
+		slices.Reverse(aligned)
+		slots = aligned
+	}
+	return
+}
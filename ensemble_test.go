@@ -0,0 +1,50 @@
+package krs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVoteTranscripts(t *testing.T) {
+	// a transcript of the words at 300ms intervals, "-" skipping a word, "|" ending the utterance
+	transcript := func(text string, shift time.Duration) (transcript Transcript) {
+		for i, word := range strings.Fields(text) {
+			if word == "|" {
+				transcript.EndUtterance()
+				continue
+			}
+			if word != "-" {
+				start := time.Duration(i)*300*time.Millisecond + shift
+				transcript.AddWord(Word{Text: word, Start: start, End: start + 200*time.Millisecond})
+			}
+		}
+		return
+	}
+	transcripts := []Transcript{
+		transcript("the cat sat on - mat | today", 0),
+		transcript("a cat sat on the mat | today", 40*time.Millisecond),
+		transcript("the cat sad on the mat the | today", -30*time.Millisecond),
+	}
+	voted := VoteTranscripts(transcripts, nil, EnsembleConfig{})
+	if text := voted.Text(); text != "the cat sat on the mat\ntoday" {
+		t.Errorf("got %q", text)
+	}
+	// the agreement of all the servers, or of two of them
+	var confidences []float64
+	for _, utterance := range voted.Utterances {
+		for _, word := range utterance.Words {
+			confidences = append(confidences, word.Confidence)
+		}
+	}
+	for i, expected := range []float64{2, 3, 2, 3, 2, 3, 3} {
+		if i >= len(confidences) || confidences[i] != expected/3 {
+			t.Fatalf("got confidences %v", confidences)
+		}
+	}
+	// the heaviest transcript wins the ties
+	voted = VoteTranscripts(transcripts[:2], []float64{1, 2}, EnsembleConfig{})
+	if text := voted.Text(); text != "a cat sat on the mat\ntoday" {
+		t.Errorf("got %q with weights", text)
+	}
+}
@@ -0,0 +1,121 @@
+package krs_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+// The examples without output need a server, they are only compiled. The examples directory has
+// complete programs.
+
+func ExampleSTTClient_Transcribe() {
+	client, err := krs.NewSTTClient(&krs.STTConfig{URL: "ws://127.0.0.1:8080"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	pcm := make([]float32, 5*krs.SampleRate) // 24kHz mono audio
+	transcript, err := client.Transcribe(context.Background(), pcm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(transcript.Text())
+}
+
+func ExampleTTSClient_Connect() {
+	client, err := krs.NewTTSClient(&krs.TTSConfig{URL: "ws://127.0.0.1:8080"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	// Stream the words, closing the write channel ends the stream
+	go func() {
+		for _, word := range []string{"Hello", "world!"} {
+			select {
+			case conn.GetWriteChan() <- word:
+			case <-conn.GetContext().Done():
+				return
+			}
+		}
+		close(conn.GetWriteChan())
+	}()
+	// The read channel is only closed at the end of a clean stream: a failure or a cancellation
+	// ends the context of the connection instead
+	var pcm []float32
+receive:
+	for {
+		select {
+		case msg, open := <-conn.GetReadChan():
+			if !open {
+				break receive
+			}
+			if audio, ok := msg.(krs.MessagePackAudio); ok {
+				pcm = append(pcm, audio.PCM...)
+			}
+		case <-conn.GetContext().Done():
+			break receive
+		}
+	}
+	if err = conn.Done(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s of audio\n", time.Duration(len(pcm))*time.Second/krs.SampleRate)
+}
+
+func ExampleNewListener() {
+	client, err := krs.NewSTTClient(&krs.STTConfig{URL: "ws://127.0.0.1:8080"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	var microphone krs.AudioSource // an audio capture device
+	listener := krs.NewListener(context.Background(), client, microphone, krs.ListenerConfig{
+		OnUtterance: func(utterance krs.Utterance) {
+			fmt.Println(utterance.Text())
+		},
+	})
+	if err = listener.Wait(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleSpeaker_Say() {
+	client, err := krs.NewTTSClient(&krs.TTSConfig{URL: "ws://127.0.0.1:8080"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	var output krs.AudioSink // an audio playback device
+	speaker := krs.NewSpeaker(context.Background(), client, output)
+	defer speaker.Close()
+	speaker.Say("Your meeting starts in five minutes.", krs.PriorityNormal)
+	// an urgent utterance interrupts the current one
+	if err = <-speaker.Say("Battery low!", krs.PriorityUrgent); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleDTMF() {
+	tones, err := krs.DTMF("42#", 70*time.Millisecond, 70*time.Millisecond)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s of tones\n", time.Duration(len(tones))*time.Second/krs.SampleRate)
+	// Output: 420ms of tones
+}
+
+func ExampleInterleave() {
+	left := []float32{1, 2, 3}
+	right := []float32{-1, -2, -3}
+	stereo := krs.Interleave(nil, left, right)
+	fmt.Println(stereo)
+	fmt.Println(krs.Deinterleave(stereo, krs.StereoChannels))
+	// Output:
+	// [1 -1 2 -2 3 -3]
+	// [[1 2 3] [-1 -2 -3]]
+}
@@ -0,0 +1,189 @@
+// Command assistant is a minimal voice assistant: it transcribes the microphone, asks an OpenAI
+// compatible LLM server for an answer and speaks it. The microphone is read from the standard
+// input and the speech written to the standard output, both as raw mono 24kHz signed 16 bits
+// samples:
+//
+//	arecord -q -f S16_LE -r 24000 -c 1 -t raw |
+//		go run ./examples/assistant -llm http://127.0.0.1:11434/v1 -model llama3.2 |
+//		aplay -q -f S16_LE -r 24000 -c 1 -t raw
+//
+// The listener is paused while the assistant speaks so it does not transcribe itself, see
+// krs.EchoCanceller to keep listening (and let the user interrupt it).
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/textnorm"
+)
+
+func main() {
+	stt := flag.String("stt", "ws://127.0.0.1:8080", "URL of the STT server")
+	tts := flag.String("tts", "ws://127.0.0.1:8080", "URL of the TTS server")
+	llm := flag.String("llm", "http://127.0.0.1:11434/v1", "base URL of the OpenAI compatible LLM server")
+	model := flag.String("model", "llama3.2", "LLM model")
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, *stt, *tts, llmClient{url: *llm, model: *model, apiKey: os.Getenv("KRS_LLM_APIKEY")}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, sttURL, ttsURL string, llm llmClient) (err error) {
+	apiKey := os.Getenv("KYUTAI_TTS_APIKEY")
+	sttClient, err := krs.NewSTTClient(&krs.STTConfig{URL: sttURL, APIKey: apiKey})
+	if err != nil {
+		return
+	}
+	// The LLM answers in Markdown: the sanitizer makes it speakable
+	ttsClient, err := krs.NewTTSClient(&krs.TTSConfig{
+		URL:       ttsURL,
+		APIKey:    apiKey,
+		Sanitizer: &textnorm.Sanitizer{Emoji: textnorm.EmojiDrop},
+	})
+	if err != nil {
+		return
+	}
+	// The speaker keeps a TTS connection warm to answer as fast as possible
+	speaker := krs.NewSpeaker(ctx, ttsClient, stdoutSink{writer: bufio.NewWriter(os.Stdout)})
+	defer speaker.Close()
+	// The questions are handled on this goroutine, not the listener one
+	questions := make(chan string, 1)
+	listener := krs.NewListener(ctx, sttClient, stdinSource{reader: bufio.NewReader(os.Stdin)}, krs.ListenerConfig{
+		OnUtterance: func(utterance krs.Utterance) {
+			// never block the listener, the assistant is busy answering anyway
+			select {
+			case questions <- utterance.Text():
+			default:
+			}
+		},
+		OnError: func(err error) {
+			log.Printf("STT connection lost, reconnecting: %s", err)
+		},
+	})
+	defer listener.Close()
+	history := []message{{Role: "system", Content: "You are a helpful voice assistant, answer in one or two short sentences."}}
+	for {
+		var question string
+		select {
+		case question = <-questions:
+		case <-ctx.Done():
+			return nil
+		}
+		log.Printf("> %s", question)
+		listener.Pause()
+		history = append(history, message{Role: "user", Content: question})
+		var answer string
+		if answer, err = llm.complete(ctx, history); err != nil {
+			log.Print(err)
+			answer = "Sorry, I could not get an answer."
+		} else {
+			history = append(history, message{Role: "assistant", Content: answer})
+		}
+		log.Printf("< %s", answer)
+		if err = <-speaker.Say(answer, krs.PriorityNormal); err != nil {
+			log.Print(err)
+		}
+		listener.Resume()
+	}
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type llmClient struct {
+	url    string
+	model  string
+	apiKey string
+}
+
+// complete asks the chat completions endpoint for the next message of the conversation.
+func (lc llmClient) complete(ctx context.Context, history []message) (answer string, err error) {
+	body, err := json.Marshal(struct {
+		Model    string    `json:"model"`
+		Messages []message `json:"messages"`
+	}{
+		Model:    lc.model,
+		Messages: history,
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lc.url+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if lc.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+lc.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the LLM answered HTTP %d", resp.StatusCode)
+	}
+	var completion struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("the LLM answered no choices")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// stdinSource is a krs.AudioSource reading s16le samples from the standard input by blocks of
+// 20ms.
+type stdinSource struct {
+	reader *bufio.Reader
+}
+
+func (s stdinSource) ReadPCM() (pcm []float32, err error) {
+	samples := make([]int16, krs.SampleRate/50)
+	if err = binary.Read(s.reader, binary.LittleEndian, samples); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+	return krs.AppendFloat32(nil, samples), nil
+}
+
+// stdoutSink is a krs.AudioSink writing s16le samples to the standard output, the player
+// reading it applies the backpressure.
+type stdoutSink struct {
+	writer *bufio.Writer
+}
+
+func (s stdoutSink) WritePCM(pcm []float32) (err error) {
+	if _, err = s.writer.Write(krs.AppendInt16LE(nil, pcm)); err != nil {
+		return
+	}
+	return s.writer.Flush()
+}
+
+// Discard can not take back the samples already written to the player.
+func (stdoutSink) Discard() {}
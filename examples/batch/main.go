@@ -0,0 +1,117 @@
+// Command batch transcribes all the wave files (mono 24kHz 16 bits) of a directory, a few at a
+// time, and writes the transcripts next to them as text and SRT subtitles. The recordings badly
+// leveled (clipped, too quiet) are reported, -normalize brings their speech to a common level.
+//
+//	go run ./examples/batch -server ws://127.0.0.1:8080 -parallel 4 -normalize recordings/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/testassets"
+)
+
+func main() {
+	server := flag.String("server", "ws://127.0.0.1:8080", "URL of the STT server")
+	parallel := flag.Int("parallel", 4, "number of files transcribed at the same time")
+	normalize := flag.Bool("normalize", false, "normalize the level of the recordings before transcribing them")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: batch [-server url] [-parallel n] [-normalize] directory")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, *server, *parallel, *normalize, flag.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, server string, parallel int, normalize bool, directory string) (err error) {
+	files, err := filepath.Glob(filepath.Join(directory, "*.wav"))
+	if err != nil {
+		return
+	}
+	// A single client opens a connection per file
+	client, err := krs.NewSTTClient(&krs.STTConfig{
+		URL:            server,
+		APIKey:         os.Getenv("KYUTAI_TTS_APIKEY"),
+		NormalizeInput: normalize,
+	})
+	if err != nil {
+		return
+	}
+	var (
+		workers sync.WaitGroup
+		slots   = make(chan struct{}, max(parallel, 1))
+		mutex   sync.Mutex
+		failed  int
+	)
+	for _, file := range files {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		workers.Go(func() {
+			defer func() { <-slots }()
+			if err := transcribe(ctx, client, file); err != nil {
+				log.Printf("%s: %s", file, err)
+				mutex.Lock()
+				failed++
+				mutex.Unlock()
+				return
+			}
+			log.Printf("%s: done", file)
+		})
+	}
+	workers.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return ctx.Err()
+}
+
+// transcribe transcribes a file and writes its .txt and .srt transcripts.
+func transcribe(ctx context.Context, client *krs.STTClient, file string) (err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	pcm, err := testassets.DecodeWAV(data)
+	if err != nil {
+		return
+	}
+	// Transcribe streams the whole file on one connection and waits for the server
+	transcript, err := client.Transcribe(ctx, pcm)
+	if err != nil {
+		return
+	}
+	// Badly leveled recordings are a common cause of poor transcripts
+	for _, warning := range transcript.Input.Warnings() {
+		log.Printf("%s: %s", file, warning)
+	}
+	if transcript.Input.Gain != 0 {
+		log.Printf("%s: normalized with a gain of %+.1f dB", file, transcript.Input.Gain)
+	}
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	if err = os.WriteFile(base+".txt", []byte(transcript.Text()+"\n"), 0o644); err != nil {
+		return
+	}
+	srt, err := os.Create(base + ".srt")
+	if err != nil {
+		return
+	}
+	defer srt.Close()
+	return transcript.WriteSRT(srt)
+}
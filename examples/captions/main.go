@@ -0,0 +1,131 @@
+// Command captions prints live captions of a microphone. The audio is read from the standard
+// input as raw mono 24kHz signed 16 bits samples, as captured by:
+//
+//	arecord -q -f S16_LE -r 24000 -c 1 -t raw | go run ./examples/captions
+//	ffmpeg -loglevel error -f pulse -i default -f s16le -ar 24000 -ac 1 - | go run ./examples/captions
+//
+// With -overlay, the captions are also served to a browser (an OBS browser source) and, with
+// -translate, shown along with their live translations by a LibreTranslate service:
+//
+//	... | go run ./examples/captions -overlay 127.0.0.1:8090 -translate http://127.0.0.1:5000/translate -languages fr,de
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+func main() {
+	server := flag.String("server", "ws://127.0.0.1:8080", "URL of the STT server")
+	overlay := flag.String("overlay", "", "Serve the captions overlay page on this address")
+	translate := flag.String("translate", "", "URL of a LibreTranslate service to translate the overlay captions")
+	languages := flag.String("languages", "", "Comma separated languages of the overlay translations")
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	captions, err := serveOverlay(*overlay, *translate, *languages)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if captions != nil {
+		defer captions.Close()
+	}
+	if err = run(ctx, *server, captions); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serveOverlay serves the captions overlay in the background, nil without address.
+func serveOverlay(address, translate, languages string) (overlay *krs.CaptionOverlay, err error) {
+	if address == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return
+	}
+	overlay = &krs.CaptionOverlay{
+		OnError: func(err error) {
+			log.Print(err)
+		},
+		// The original text is larger, the translations stand out in yellow italics
+		Styles: map[string]krs.CaptionStyle{"": {Size: "36px"}},
+	}
+	if translate != "" && languages != "" {
+		overlay.Translator = krs.HTTPTranslator{URL: translate}
+		overlay.Languages = strings.Split(languages, ",")
+		for _, language := range overlay.Languages {
+			overlay.Styles[language] = krs.CaptionStyle{Color: "#ffd700", Size: "28px", Italic: true}
+		}
+	}
+	go http.Serve(listener, overlay)
+	log.Printf("captions overlay on http://%s/", listener.Addr())
+	return
+}
+
+func run(ctx context.Context, server string, overlay *krs.CaptionOverlay) (err error) {
+	client, err := krs.NewSTTClient(&krs.STTConfig{
+		URL:    server,
+		APIKey: os.Getenv("KYUTAI_TTS_APIKEY"),
+	})
+	if err != nil {
+		return
+	}
+	// The listener streams the source, reconnects if the connection is lost and delivers each
+	// utterance once the speaker paused
+	listener := krs.NewListener(ctx, client, newStdinSource(), krs.ListenerConfig{
+		OnUtterance: func(utterance krs.Utterance) {
+			fmt.Printf("[%s] %s\n", utterance.Start().Truncate(time.Second), utterance.Text())
+			if overlay != nil {
+				overlay.Show(ctx, utterance)
+			}
+		},
+		OnError: func(err error) {
+			log.Printf("connection lost, reconnecting: %s", err)
+		},
+	})
+	defer listener.Close()
+	// Wait for the end of the input or an interruption
+	err = listener.Wait()
+	if ctx.Err() != nil {
+		err = nil
+	}
+	return
+}
+
+// stdinSource is a krs.AudioSource reading s16le samples from the standard input by blocks of
+// 20ms.
+type stdinSource struct {
+	reader  *bufio.Reader
+	samples []int16
+}
+
+func newStdinSource() *stdinSource {
+	return &stdinSource{
+		reader:  bufio.NewReader(os.Stdin),
+		samples: make([]int16, krs.SampleRate/50),
+	}
+}
+
+func (s *stdinSource) ReadPCM() (pcm []float32, err error) {
+	if err = binary.Read(s.reader, binary.LittleEndian, s.samples); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+	return krs.AppendFloat32(nil, s.samples), nil
+}
@@ -0,0 +1,13 @@
+module github.com/hekmon/kyutai-rs/examples/indicator
+
+go 1.25.4
+
+replace github.com/hekmon/kyutai-rs => ../..
+
+require github.com/hekmon/kyutai-rs v1.0.0
+
+require (
+	github.com/coder/websocket v1.8.14 // indirect
+	github.com/philhofer/fwd v1.2.0 // indirect
+	github.com/tinylib/msgp v1.5.0 // indirect
+)
@@ -0,0 +1,21 @@
+//go:build !periph
+
+package main
+
+import "log"
+
+// logIndicator logs its state changes, for the devices without GPIO.
+type logIndicator string
+
+func (li logIndicator) Set(on bool) error {
+	state := "off"
+	if on {
+		state = "on"
+	}
+	log.Printf("%s %s", li, state)
+	return nil
+}
+
+func newIndicators() (listening, speaking indicator, err error) {
+	return logIndicator("listening"), logIndicator("speaking"), nil
+}
@@ -0,0 +1,128 @@
+// Command indicator drives "listening" and "speaking" indicators of a robot or an embedded device
+// with the Listener and Speaker hooks: it repeats what it hears, muting the microphone while it
+// speaks. The microphone is read from the standard input and the speech written to the standard
+// output, both as raw mono 24kHz signed 16 bits samples:
+//
+//	arecord -q -f S16_LE -r 24000 -c 1 -t raw |
+//		go run . -stt ws://127.0.0.1:8080 -tts ws://127.0.0.1:8080 |
+//		aplay -q -f S16_LE -r 24000 -c 1 -t raw
+//
+// By default the indicators are logged. Built with the periph tag, they are GPIO pins driven with
+// periph.io (LEDs, a relay muting the microphone...) on a Raspberry Pi or any board it supports:
+//
+//	go get periph.io/x/conn/v3 periph.io/x/host/v3
+//	go run -tags periph . -listening-pin GPIO17 -speaking-pin GPIO27
+//
+// It is a module of its own so that the library does not depend on periph.io.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	krs "github.com/hekmon/kyutai-rs"
+)
+
+// indicator is a two state output: a LED, a relay...
+type indicator interface {
+	Set(on bool) error
+}
+
+func main() {
+	stt := flag.String("stt", "ws://127.0.0.1:8080", "URL of the STT server")
+	tts := flag.String("tts", "ws://127.0.0.1:8080", "URL of the TTS server")
+	flag.Parse()
+	listening, speaking, err := newIndicators()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err = run(ctx, *stt, *tts, listening, speaking); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, sttURL, ttsURL string, listening, speaking indicator) (err error) {
+	apiKey := os.Getenv("KYUTAI_TTS_APIKEY")
+	sttClient, err := krs.NewSTTClient(&krs.STTConfig{URL: sttURL, APIKey: apiKey})
+	if err != nil {
+		return
+	}
+	ttsClient, err := krs.NewTTSClient(&krs.TTSConfig{URL: ttsURL, APIKey: apiKey})
+	if err != nil {
+		return
+	}
+	speaker := krs.NewSpeaker(ctx, ttsClient, stdoutSink{writer: bufio.NewWriter(os.Stdout)})
+	defer speaker.Close()
+	listener := krs.NewListener(ctx, sttClient, stdinSource{reader: bufio.NewReader(os.Stdin)}, krs.ListenerConfig{
+		OnUtterance: func(utterance krs.Utterance) {
+			log.Printf("> %s", utterance.Text())
+			speaker.Say(utterance.Text(), krs.PriorityNormal)
+		},
+		OnListening: func(on bool) {
+			if err := listening.Set(on); err != nil {
+				log.Print(err)
+			}
+		},
+		OnError: func(err error) {
+			log.Printf("STT connection lost, reconnecting: %s", err)
+		},
+	})
+	defer listener.Close()
+	// The microphone is muted while speaking so that the device does not repeat itself
+	speaker.OnSpeaking(func(on bool) {
+		if on {
+			listener.Mute()
+		} else {
+			listener.Unmute()
+		}
+		if err := speaking.Set(on); err != nil {
+			log.Print(err)
+		}
+	})
+	// Wait for the end of the input or an interruption
+	if err = listener.Wait(); ctx.Err() != nil {
+		err = nil
+	}
+	return
+}
+
+// stdinSource is a krs.AudioSource reading s16le samples from the standard input by blocks of
+// 20ms.
+type stdinSource struct {
+	reader *bufio.Reader
+}
+
+func (s stdinSource) ReadPCM() (pcm []float32, err error) {
+	samples := make([]int16, krs.SampleRate/50)
+	if err = binary.Read(s.reader, binary.LittleEndian, samples); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return
+	}
+	return krs.AppendFloat32(nil, samples), nil
+}
+
+// stdoutSink is a krs.AudioSink writing s16le samples to the standard output, the player
+// reading it applies the backpressure.
+type stdoutSink struct {
+	writer *bufio.Writer
+}
+
+func (s stdoutSink) WritePCM(pcm []float32) (err error) {
+	if _, err = s.writer.Write(krs.AppendInt16LE(nil, pcm)); err != nil {
+		return
+	}
+	return s.writer.Flush()
+}
+
+// Discard can not take back the samples already written to the player.
+func (stdoutSink) Discard() {}
@@ -0,0 +1,50 @@
+//go:build periph
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/host/v3"
+)
+
+var (
+	listeningPin = flag.String("listening-pin", "GPIO17", "GPIO pin of the listening indicator")
+	speakingPin  = flag.String("speaking-pin", "GPIO27", "GPIO pin of the speaking indicator (or the relay muting the microphone)")
+)
+
+// pinIndicator is a GPIO output, high while on.
+type pinIndicator struct {
+	pin gpio.PinOut
+}
+
+func (pi pinIndicator) Set(on bool) (err error) {
+	if err = pi.pin.Out(gpio.Level(on)); err != nil {
+		err = fmt.Errorf("failed to set %s: %w", pi.pin, err)
+	}
+	return
+}
+
+func newIndicators() (listening, speaking indicator, err error) {
+	if _, err = host.Init(); err != nil {
+		err = fmt.Errorf("failed to initialize the GPIO: %w", err)
+		return
+	}
+	pins := make([]indicator, 2)
+	for i, name := range []string{*listeningPin, *speakingPin} {
+		pin := gpioreg.ByName(name)
+		if pin == nil {
+			err = fmt.Errorf("unknown GPIO pin %q", name)
+			return
+		}
+		if err = pin.Out(gpio.Low); err != nil {
+			err = fmt.Errorf("failed to set %s as an output: %w", name, err)
+			return
+		}
+		pins[i] = pinIndicator{pin: pin}
+	}
+	return pins[0], pins[1], nil
+}
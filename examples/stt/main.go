@@ -0,0 +1,181 @@
+// Command stt streams a wave file (mono 24kHz 16 bits) to the STT server and prints the words as
+// they are recognized. Convert other files with ffmpeg -i input -ar 24000 -ac 1 recording.wav
+//
+//	go run ./examples/stt -server ws://127.0.0.1:8080 recording.wav
+//
+// With -mic, the default microphone is transcribed live instead, until interrupted. It is captured
+// with the recorder of the platform (arecord on Linux, sox elsewhere) writing s16le samples, which
+// -mic-command replaces:
+//
+//	go run ./examples/stt -server ws://127.0.0.1:8080 -mic
+//	go run ./examples/stt -mic -mic-command "parec --format=s16le --rate=24000 --channels=1"
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/testassets"
+)
+
+func main() {
+	server := flag.String("server", "ws://127.0.0.1:8080", "URL of the STT server")
+	mic := flag.Bool("mic", false, "Transcribe the default microphone live instead of a file")
+	micCommand := flag.String("mic-command", defaultMicCommand(), "Command capturing the microphone as mono 24kHz s16le samples on its standard output")
+	flag.Parse()
+	if *mic == (flag.NArg() == 1) {
+		log.Fatal("usage: stt [-server url] recording.wav | stt [-server url] -mic [-mic-command command]")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var err error
+	if *mic {
+		err = runMic(ctx, *server, *micCommand)
+	} else {
+		err = run(ctx, *server, flag.Arg(0))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, server, filename string) (err error) {
+	// Load the audio
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	pcm, err := testassets.DecodeWAV(data)
+	if err != nil {
+		return
+	}
+	return transcribe(ctx, server, func(send func([]float32) bool) error {
+		// Send the audio by chunks, as a live source would
+		for chunk := range slices.Chunk(pcm, krs.FrameSize) {
+			if !send(chunk) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// runMic transcribes the microphone until ctx is done: the recorder is stopped and the server
+// transcribes the audio it already received.
+func runMic(ctx context.Context, server, command string) (err error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("no microphone capture command")
+	}
+	recorder := exec.Command(args[0], args[1:]...)
+	recorder.Stderr = os.Stderr
+	stdout, err := recorder.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = recorder.Start(); err != nil {
+		return fmt.Errorf("failed to start the microphone capture (see -mic-command): %w", err)
+	}
+	defer func() {
+		_ = recorder.Process.Kill()
+		_ = recorder.Wait()
+	}()
+	// The recorder blocks in its read of the device: it is killed to stop, the samples it
+	// already wrote are still read until the pipe ends
+	stop := context.AfterFunc(ctx, func() { _ = recorder.Process.Kill() })
+	defer stop()
+	fmt.Fprintln(os.Stderr, "Listening, interrupt to stop...")
+	return transcribe(context.WithoutCancel(ctx), server, func(send func([]float32) bool) error {
+		reader := bufio.NewReader(stdout)
+		samples := make([]int16, krs.FrameSize)
+		for {
+			if err := binary.Read(reader, binary.LittleEndian, samples); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF || ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("failed to read the microphone: %w", err)
+			}
+			if !send(krs.AppendFloat32(nil, samples)) {
+				// the session failed or was reset: nothing transcribes the microphone anymore
+				_ = recorder.Process.Kill()
+				return nil
+			}
+		}
+	})
+}
+
+// defaultMicCommand returns the command capturing the default microphone of the platform.
+func defaultMicCommand() string {
+	if runtime.GOOS == "linux" {
+		return "arecord -q -f S16_LE -r 24000 -c 1 -t raw"
+	}
+	return "sox -q -d -t raw -r 24000 -c 1 -b 16 -e signed-integer -L -"
+}
+
+// transcribe opens a connection, streams the audio produced by source and prints the words until
+// the server is done. send returns false once the connection stopped.
+func transcribe(ctx context.Context, server string, source func(send func([]float32) bool) error) (err error) {
+	client, err := krs.NewSTTClient(&krs.STTConfig{
+		URL:    server,
+		APIKey: os.Getenv("KYUTAI_TTS_APIKEY"),
+	})
+	if err != nil {
+		return
+	}
+	conn, err := client.Connect(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// Send the audio, then close the write channel to end the stream: the server still
+	// transcribes what it received
+	sourceErr := make(chan error, 1)
+	go func() {
+		sourceErr <- source(func(chunk []float32) bool {
+			select {
+			case conn.GetWriteChan() <- chunk:
+				return true
+			case <-conn.GetContext().Done():
+				return false
+			}
+		})
+		close(conn.GetWriteChan())
+	}()
+	// Print the words until the server is done. The read channel is only closed at the end of a
+	// clean stream: a failure or a cancellation ends the context instead
+receive:
+	for {
+		select {
+		case msg, open := <-conn.GetReadChan():
+			if !open {
+				break receive
+			}
+			if word, ok := msg.(krs.MessagePackWord); ok {
+				fmt.Printf("%s ", word.Text)
+			}
+		case <-conn.GetContext().Done():
+			break receive
+		}
+	}
+	fmt.Println()
+	// Done returns the error that stopped the connection, if any. The source stops as well, its
+	// sends failing once the connection stopped
+	err = conn.Done()
+	if sourceErr := <-sourceErr; err == nil {
+		err = sourceErr
+	}
+	return
+}
@@ -0,0 +1,208 @@
+// Command tts streams text to the TTS server word by word and writes the audio received to a
+// wave file (mono 24kHz 16 bits).
+//
+//	go run ./examples/tts -server ws://127.0.0.1:8080 -output hello.wav "Hello, how are you?"
+//
+// With -play, the audio is also played on the default output device as it streams, after a small
+// jitter buffer absorbing the irregular arrival of the frames. It is played by the player of the
+// platform (aplay on Linux, sox elsewhere) reading s16le samples, which -play-command replaces:
+//
+//	go run ./examples/tts -play "Hello, how are you?"
+//	go run ./examples/tts -play -play-command "pacat --format=s16le --rate=24000 --channels=1" "Hello"
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/testassets"
+	"github.com/hekmon/kyutai-rs/textnorm"
+)
+
+func main() {
+	server := flag.String("server", "ws://127.0.0.1:8080", "URL of the TTS server")
+	voice := flag.String("voice", "", "voice of the kyutai/tts-voices repository (server default if empty)")
+	output := flag.String("output", "output.wav", "wave file to write")
+	play := flag.Bool("play", false, "Play the audio on the default output device as it streams")
+	playCommand := flag.String("play-command", defaultPlayCommand(), "Command playing mono 24kHz s16le samples read on its standard input")
+	jitter := flag.Duration("jitter", 200*time.Millisecond, "Audio buffered before the playback starts")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: tts [-server url] [-voice name] [-output file.wav] [-play [-play-command command] [-jitter duration]] text...")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var player *player
+	if *play {
+		var err error
+		if player, err = startPlayer(*playCommand, *jitter); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := run(ctx, *server, *voice, *output, strings.Join(flag.Args(), " "), player); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, server, voice, output, text string, player *player) (err error) {
+	// Open a connection
+	client, err := krs.NewTTSClient(&krs.TTSConfig{
+		URL:    server,
+		APIKey: os.Getenv("KYUTAI_TTS_APIKEY"),
+		Voice:  voice,
+	})
+	if err != nil {
+		return
+	}
+	conn, err := client.Connect(ctx)
+	if err != nil {
+		if player != nil {
+			player.abort()
+		}
+		return
+	}
+	defer conn.Close()
+	// Send the text word by word, as an LLM would generate it, then close the write channel to
+	// end the stream. Numbers and units are spelled out first: the model garbles raw numerals.
+	go func() {
+		for word := range strings.FieldsSeq(textnorm.Verbalize(text, textnorm.English)) {
+			select {
+			case conn.GetWriteChan() <- word:
+			case <-conn.GetContext().Done():
+				return
+			}
+		}
+		close(conn.GetWriteChan())
+	}()
+	// Collect the audio until the server is done, playing it as it comes. The read channel is only
+	// closed at the end of a clean stream: a failure or an interruption ends the context instead
+	var pcm []float32
+receive:
+	for {
+		select {
+		case msg, open := <-conn.GetReadChan():
+			if !open {
+				break receive
+			}
+			if audio, ok := msg.(krs.MessagePackAudio); ok {
+				pcm = append(pcm, audio.PCM...)
+				if player != nil {
+					player.frames <- audio.PCM
+				}
+			}
+		case <-conn.GetContext().Done():
+			break receive
+		}
+	}
+	if err = conn.Done(); err != nil {
+		// the stream failed or was interrupted: stop the playback right away
+		if player != nil {
+			player.abort()
+		}
+		return
+	}
+	if player != nil {
+		// let the player drain what it has buffered
+		if err = player.close(); err != nil {
+			return
+		}
+	}
+	return os.WriteFile(output, testassets.EncodeWAV(pcm), 0o644)
+}
+
+// player plays the frames sent to it with an external command, once jitter of audio is buffered.
+type player struct {
+	cmd    *exec.Cmd
+	frames chan []float32
+	done   chan error
+}
+
+// defaultPlayCommand returns the command playing on the default output device of the platform.
+func defaultPlayCommand() string {
+	if runtime.GOOS == "linux" {
+		return "aplay -q -f S16_LE -r 24000 -c 1 -t raw"
+	}
+	return "sox -q -t raw -r 24000 -c 1 -b 16 -e signed-integer -L - -d"
+}
+
+func startPlayer(command string, jitter time.Duration) (p *player, err error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("no playback command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the playback (see -play-command): %w", err)
+	}
+	p = &player{
+		cmd: cmd,
+		// the channel holds the frames while the player blocks on the device, the server being
+		// faster than real time
+		frames: make(chan []float32, 1024),
+		done:   make(chan error, 1),
+	}
+	go func() {
+		var (
+			buffered []float32
+			writeErr error
+		)
+		write := func(pcm []float32) {
+			if writeErr == nil {
+				_, writeErr = stdin.Write(krs.AppendInt16LE(nil, pcm))
+			}
+		}
+		// The jitter buffer: nothing is played until enough audio arrived (or the stream ended),
+		// so that a late frame does not starve the device in the middle of a word
+		threshold := int(jitter * krs.SampleRate / time.Second)
+		for frame := range p.frames {
+			if buffered != nil || threshold > 0 {
+				buffered = append(buffered, frame...)
+				if len(buffered) < threshold {
+					continue
+				}
+				frame, buffered, threshold = buffered, nil, 0
+			}
+			write(frame)
+		}
+		if len(buffered) > 0 {
+			write(buffered)
+		}
+		_ = stdin.Close()
+		if err := cmd.Wait(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		if writeErr != nil {
+			writeErr = fmt.Errorf("failed to play the audio: %w", writeErr)
+		}
+		p.done <- writeErr
+	}()
+	return
+}
+
+// close ends the stream and waits for the player to play what is left.
+func (p *player) close() error {
+	close(p.frames)
+	return <-p.done
+}
+
+// abort stops the playback without playing what is left, and waits for the player to exit.
+func (p *player) abort() {
+	_ = p.cmd.Process.Kill()
+	_ = p.close()
+}
@@ -0,0 +1,70 @@
+package krs
+
+import (
+	"sync"
+	"time"
+)
+
+// AudioFilter transforms a stream of audio (24kHz mono) block by block. at is the session time of
+// the first sample of the block: the filters can act at precise moments of the session whatever
+// the size of the blocks.
+type AudioFilter interface {
+	// Apply processes a block of samples in place
+	Apply(pcm []float32, at time.Duration)
+}
+
+// FilterSource returns a source applying a filter to the audio read from the wrapped source, the
+// session clock being the audio read so far: a capture device provides it in real time.
+func FilterSource(source AudioSource, filter AudioFilter) AudioSource {
+	return &filteredSource{source: source, filter: filter}
+}
+
+// FilterSink returns a sink applying a filter to the audio written to the wrapped sink, the
+// session clock being the audio written so far: it only advances while something is played.
+func FilterSink(sink AudioSink, filter AudioFilter) AudioSink {
+	return &filteredSink{sink: sink, filter: filter}
+}
+
+// filterClock counts the samples going through a filter.
+type filterClock struct {
+	mutex   sync.Mutex
+	samples int64
+}
+
+func (fc *filterClock) advance(pcm []float32) (at time.Duration) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	at = time.Duration(fc.samples) * time.Second / SampleRate
+	fc.samples += int64(len(pcm))
+	return
+}
+
+type filteredSource struct {
+	source AudioSource
+	filter AudioFilter
+	clock  filterClock
+}
+
+func (s *filteredSource) ReadPCM() (pcm []float32, err error) {
+	if pcm, err = s.source.ReadPCM(); len(pcm) > 0 {
+		s.filter.Apply(pcm, s.clock.advance(pcm))
+	}
+	return
+}
+
+type filteredSink struct {
+	sink   AudioSink
+	filter AudioFilter
+	clock  filterClock
+}
+
+func (s *filteredSink) WritePCM(pcm []float32) error {
+	// the samples belong to the caller
+	filtered := append([]float32(nil), pcm...)
+	s.filter.Apply(filtered, s.clock.advance(filtered))
+	return s.sink.WritePCM(filtered)
+}
+
+func (s *filteredSink) Discard() {
+	s.sink.Discard()
+}
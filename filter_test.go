@@ -0,0 +1,80 @@
+package krs
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// gainFilter doubles the samples and records the session times of the blocks.
+type gainFilter struct {
+	at []time.Duration
+}
+
+func (gf *gainFilter) Apply(pcm []float32, at time.Duration) {
+	for i := range pcm {
+		pcm[i] *= 2
+	}
+	gf.at = append(gf.at, at)
+}
+
+// blocksSource returns its blocks, the last one with io.EOF.
+type blocksSource [][]float32
+
+func (bs *blocksSource) ReadPCM() (pcm []float32, err error) {
+	pcm, *bs = (*bs)[0], (*bs)[1:]
+	if len(*bs) == 0 {
+		err = io.EOF
+	}
+	return
+}
+
+func TestFilterSource(t *testing.T) {
+	filter := &gainFilter{}
+	source := FilterSource(&blocksSource{make([]float32, SampleRate), {1, 2}, {3}}, filter)
+	var read []float32
+	for {
+		pcm, err := source.ReadPCM()
+		read = append(read, pcm...)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the block coming with the end of the stream is filtered too
+	if !slices.Equal(read[SampleRate:], []float32{2, 4, 6}) {
+		t.Errorf("read %v, expected the filtered samples", read[SampleRate:])
+	}
+	if expected := []time.Duration{0, time.Second, (SampleRate + 2) * time.Second / SampleRate}; !slices.Equal(filter.at, expected) {
+		t.Errorf("filtered the blocks at %v, expected %v", filter.at, expected)
+	}
+}
+
+func TestFilterSink(t *testing.T) {
+	filter := &gainFilter{}
+	recorded := &recordSink{}
+	sink := FilterSink(recorded, filter)
+	written := []float32{1, 2}
+	for range 2 {
+		if err := sink.WritePCM(written); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(recorded.pcm, []float32{2, 4, 2, 4}) || !slices.Equal(written, []float32{1, 2}) {
+		t.Errorf("wrote %v from %v, expected the filtered copy of the samples", recorded.pcm, written)
+	}
+	if expected := []time.Duration{0, 2 * time.Second / SampleRate}; !slices.Equal(filter.at, expected) {
+		t.Errorf("filtered the blocks at %v, expected %v", filter.at, expected)
+	}
+	// the discards and the errors of the wrapped sink go through
+	if sink.Discard(); recorded.discarded != 1 {
+		t.Error("the discard did not reach the wrapped sink")
+	}
+	recorded.err = io.ErrClosedPipe
+	if err := sink.WritePCM(written); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("got %v, expected the error of the wrapped sink", err)
+	}
+}
@@ -0,0 +1,115 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// ErrServerOverloaded is returned by Done() when the server closed the connection because it is
+// overloaded (close code 1013, try again later).
+var ErrServerOverloaded = errors.New("the server is overloaded")
+
+// FlowState is a flow control state requested by the server.
+type FlowState int
+
+const (
+	// FlowResumed means the server accepts data again after a pause
+	FlowResumed FlowState = iota
+	// FlowPaused means the server asked to stop sending data: the writer holds the data it has and
+	// stops reading the write channel until the server resumes the flow
+	FlowPaused
+	// FlowOverloaded means the server closed the connection because it is overloaded
+	FlowOverloaded
+)
+
+func (fs FlowState) String() string {
+	switch fs {
+	case FlowResumed:
+		return "resumed"
+	case FlowPaused:
+		return "paused"
+	case FlowOverloaded:
+		return "overloaded"
+	default:
+		return fmt.Sprintf("FlowState(%d)", int(fs))
+	}
+}
+
+// flowControl pauses the writer of a connection when the server asks for it.
+type flowControl struct {
+	mutex   sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed while the flow is not paused
+	events  chan FlowState
+}
+
+func newFlowControl() *flowControl {
+	fc := &flowControl{
+		resumed: make(chan struct{}),
+		// only the latest state is kept for the user
+		events: make(chan FlowState, 1),
+	}
+	close(fc.resumed)
+	return fc
+}
+
+// set is called by the reader only.
+func (fc *flowControl) set(state FlowState) {
+	fc.mutex.Lock()
+	switch {
+	case state == FlowPaused && !fc.paused:
+		fc.paused = true
+		fc.resumed = make(chan struct{})
+	case state == FlowResumed && fc.paused:
+		fc.paused = false
+		close(fc.resumed)
+	}
+	fc.mutex.Unlock()
+	// replace the state the user did not read yet
+	select {
+	case <-fc.events:
+	default:
+	}
+	fc.events <- state
+}
+
+// resume ends the pause of a lost session (see STTConfig.Reconnect): the new one starts streaming.
+func (fc *flowControl) resume() {
+	fc.mutex.Lock()
+	paused := fc.paused
+	fc.mutex.Unlock()
+	if paused {
+		fc.set(FlowResumed)
+	}
+}
+
+// wait blocks the writer while the flow is paused.
+func (fc *flowControl) wait(ctx context.Context) (err error) {
+	fc.mutex.Lock()
+	resumed := fc.resumed
+	fc.mutex.Unlock()
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// readError checks whether a read error is the server closing the connection because it is
+// overloaded, in which case the user is notified and ErrServerOverloaded is returned instead.
+func (fc *flowControl) readError(err error) error {
+	var ce websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.StatusTryAgainLater {
+		return err
+	}
+	fc.set(FlowOverloaded)
+	if ce.Reason == "" {
+		return ErrServerOverloaded
+	}
+	return fmt.Errorf("%w: %s", ErrServerOverloaded, ce.Reason)
+}
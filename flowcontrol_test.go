@@ -0,0 +1,40 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestFlowControl(t *testing.T) {
+	fc := newFlowControl()
+	fc.set(FlowPaused)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := fc.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("the writer was not paused: %v", err)
+	}
+	resumed := make(chan error)
+	go func() {
+		resumed <- fc.wait(context.Background())
+	}()
+	fc.set(FlowResumed)
+	if err := <-resumed; err != nil {
+		t.Fatal(err)
+	}
+	// only the latest state is kept
+	if state := <-fc.events; state != FlowResumed {
+		t.Errorf("got state %s, expected %s", state, FlowResumed)
+	}
+	// overload close code
+	err := fc.readError(websocket.CloseError{Code: websocket.StatusTryAgainLater, Reason: "too many sessions"})
+	if !errors.Is(err, ErrServerOverloaded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if state := <-fc.events; state != FlowOverloaded {
+		t.Errorf("got state %s, expected %s", state, FlowOverloaded)
+	}
+}
@@ -0,0 +1,44 @@
+package krs
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestGeneratedCode regenerates the msgp code of msgpack.go and compares it with the checked-in
+// files: a struct changed without running go generate fails here.
+func TestGeneratedCode(t *testing.T) {
+	msgp, err := exec.LookPath("msgp")
+	if err != nil {
+		t.Skip("msgp not found in PATH: go install github.com/tinylib/msgp@v1.5.0")
+	}
+	dir := t.TempDir()
+	source, err := os.ReadFile("msgpack.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "msgpack.go"), source, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(msgp, "-file", "msgpack.go")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to run msgp: %v\n%s", err, output)
+	}
+	for _, file := range []string{"msgpack_gen.go", "msgpack_gen_test.go"} {
+		generated, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkedIn, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(generated, checkedIn) {
+			t.Errorf("%s is stale: run go generate", file)
+		}
+	}
+}
@@ -5,7 +5,7 @@ go 1.25.4
 require (
 	github.com/coder/websocket v1.8.14
 	github.com/tinylib/msgp v1.5.0
-	golang.org/x/sync v0.18.0
+	go.uber.org/goleak v1.3.0
 )
 
 require github.com/philhofer/fwd v1.2.0 // indirect
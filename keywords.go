@@ -0,0 +1,184 @@
+package krs
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultKeywordFuzziness tolerates about a letter wrong every five
+const defaultKeywordFuzziness = 0.2
+
+type KeywordConfig struct {
+	// Phrases to spot in the word stream, matched case and punctuation insensitively
+	Phrases []string
+	// Fuzziness is the fraction of the letters of each phrase word that can be wrong (edit
+	// distance), to match the transcription mistakes (defaults to 0.2, negative for exact matches)
+	Fuzziness float64
+	// OnMatch is called with each match, from the goroutine feeding the words
+	OnMatch func(KeywordMatch)
+}
+
+// KeywordMatch is a phrase spotted in the word stream.
+type KeywordMatch struct {
+	// Phrase is the configured phrase matched
+	Phrase string
+	// Words are the transcribed words matching it
+	Words []Word
+	// Score is the similarity of the words with the phrase, 1 for an exact match
+	Score float64
+}
+
+// Start returns the stream time the phrase started at.
+func (km KeywordMatch) Start() time.Duration {
+	return km.Words[0].Start
+}
+
+// End returns the stream time the phrase ended at (the start of its last word if its end is
+// unknown).
+func (km KeywordMatch) End() time.Duration {
+	last := km.Words[len(km.Words)-1]
+	return max(last.End, last.Start)
+}
+
+// Text returns the words matching the phrase, as transcribed.
+func (km KeywordMatch) Text() string {
+	return Utterance{Words: km.Words}.Text()
+}
+
+// KeywordMatcher watches a word stream for trigger phrases, for "alert me when someone says X"
+// features. Feed it the words of a STT connection, or plug it as the STTConfig.WordInterceptor.
+// It is safe for concurrent use.
+type KeywordMatcher struct {
+	phrases   []keywordPhrase
+	fuzziness float64
+	onMatch   func(KeywordMatch)
+	// protected by mutex
+	mutex  sync.Mutex
+	window []Word
+	// number of words fed so far and per phrase the count when it last matched, a phrase does not
+	// match twice on the same words
+	fed       int
+	lastMatch []int
+}
+
+type keywordPhrase struct {
+	text string
+	keys [][]rune
+}
+
+func NewKeywordMatcher(config KeywordConfig) (matcher *KeywordMatcher) {
+	matcher = &KeywordMatcher{
+		fuzziness: config.Fuzziness,
+		onMatch:   config.OnMatch,
+	}
+	if matcher.fuzziness == 0 {
+		matcher.fuzziness = defaultKeywordFuzziness
+	}
+	for _, phrase := range config.Phrases {
+		words := strings.Fields(phrase)
+		if len(words) == 0 {
+			continue
+		}
+		keys := make([][]rune, len(words))
+		for i, word := range words {
+			keys[i] = []rune(matchKey(word))
+		}
+		matcher.phrases = append(matcher.phrases, keywordPhrase{text: phrase, keys: keys})
+	}
+	matcher.lastMatch = make([]int, len(matcher.phrases))
+	return
+}
+
+// Feed adds a word to the stream, it returns the phrases ending with it (OnMatch has been called
+// for each of them).
+func (km *KeywordMatcher) Feed(word Word) (matches []KeywordMatch) {
+	km.mutex.Lock()
+	km.fed++
+	km.window = append(km.window, word)
+	var longest int
+	for _, phrase := range km.phrases {
+		longest = max(longest, len(phrase.keys))
+	}
+	if len(km.window) > longest {
+		km.window = km.window[len(km.window)-longest:]
+	}
+	for p, phrase := range km.phrases {
+		length := len(phrase.keys)
+		if length > len(km.window) || km.fed-length < km.lastMatch[p] {
+			continue
+		}
+		words := km.window[len(km.window)-length:]
+		if score, matched := km.similarity(phrase, words); matched {
+			km.lastMatch[p] = km.fed
+			matches = append(matches, KeywordMatch{
+				Phrase: phrase.text,
+				Words:  append([]Word(nil), words...),
+				Score:  score,
+			})
+		}
+	}
+	km.mutex.Unlock()
+	if km.onMatch != nil {
+		for _, match := range matches {
+			km.onMatch(match)
+		}
+	}
+	return
+}
+
+// Interceptor returns a STTConfig.WordInterceptor feeding the matcher, the words are delivered
+// unchanged. OnMatch then runs within the interceptor time budget and must be quick.
+func (km *KeywordMatcher) Interceptor() func(Word) (Word, bool) {
+	return func(word Word) (Word, bool) {
+		km.Feed(word)
+		return word, true
+	}
+}
+
+// Reset forgets the words fed so far, for example at the start of a new session.
+func (km *KeywordMatcher) Reset() {
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+	km.window = nil
+	km.fed = 0
+	clear(km.lastMatch)
+}
+
+// similarity compares the words with a phrase, word by word.
+func (km *KeywordMatcher) similarity(phrase keywordPhrase, words []Word) (score float64, matched bool) {
+	for i, key := range phrase.keys {
+		heard := []rune(matchKey(words[i].Text))
+		distance := editDistance(key, heard)
+		allowed := 0
+		if km.fuzziness > 0 {
+			allowed = int(km.fuzziness * float64(len(key)))
+		}
+		if distance > allowed {
+			return 0, false
+		}
+		score += 1 - float64(distance)/float64(max(len(key), len(heard)))
+	}
+	return score / float64(len(phrase.keys)), true
+}
+
+// editDistance is the Levenshtein distance between two words.
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = min(substitution, previous[j]+1, current[j-1]+1)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
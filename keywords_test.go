@@ -0,0 +1,42 @@
+package krs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeywordMatcher(t *testing.T) {
+	var triggered []KeywordMatch
+	matcher := NewKeywordMatcher(KeywordConfig{
+		Phrases: []string{"cancel my subscription", "refund", "ok"},
+		OnMatch: func(match KeywordMatch) {
+			triggered = append(triggered, match)
+		},
+	})
+	for i, text := range strings.Fields("I want to cancel my subscriptions, and a refnd. Okay? refund refund") {
+		matcher.Feed(Word{Text: text, Start: time.Duration(i) * time.Second})
+	}
+	type expectation struct {
+		phrase string
+		text   string
+		start  time.Duration
+	}
+	expected := []expectation{
+		{"cancel my subscription", "cancel my subscriptions,", 3 * time.Second},
+		{"refund", "refnd.", 8 * time.Second},
+		{"refund", "refund", 10 * time.Second},
+		{"refund", "refund", 11 * time.Second},
+	}
+	if len(triggered) != len(expected) {
+		t.Fatalf("got %d matches, expected %d: %+v", len(triggered), len(expected), triggered)
+	}
+	for i, match := range triggered {
+		if match.Phrase != expected[i].phrase || match.Text() != expected[i].text || match.Start() != expected[i].start {
+			t.Errorf("unexpected match %d: %q (%q at %s)", i, match.Phrase, match.Text(), match.Start())
+		}
+		if exact := match.Text() == match.Phrase; (match.Score == 1) != exact {
+			t.Errorf("unexpected score %.2f for %q", match.Score, match.Text())
+		}
+	}
+}
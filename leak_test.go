@@ -0,0 +1,155 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestWorkersLeaks(t *testing.T) {
+	// each exit path must stop all the goroutines of the connection
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, server *mockServer)
+	}{
+		{"stt done", func(t *testing.T, server *mockServer) {
+			conn := leakSTTConnection(t, server)
+			go streamAudio(conn, 20)
+			for range conn.GetReadChan() {
+			}
+			if err := conn.Done(); err != nil {
+				t.Error(err)
+			}
+		}},
+		{"stt abandoned", func(t *testing.T, server *mockServer) {
+			conn := leakSTTConnection(t, server)
+			go streamAudio(conn, 20)
+			// the read channel is never read
+			_ = conn.Close()
+		}},
+		{"stt server close while streaming", func(t *testing.T, server *mockServer) {
+			server.closeAfter = 15
+			conn := leakSTTConnection(t, server)
+			// the write channel is never closed
+			go streamAudio(conn, 1000)
+			// the read channel is not closed on error
+			for {
+				select {
+				case <-conn.GetReadChan():
+					continue
+				case <-conn.GetContext().Done():
+				}
+				break
+			}
+			_ = conn.Done()
+		}},
+		{"stt tee abandoned", func(t *testing.T, server *mockServer) {
+			conn := leakBufferedSTTConnection(t, server)
+			// the output is never read
+			_ = conn.Tee(TeeOutput{})
+			go streamAudio(conn, 20)
+			if err := conn.Done(); err != nil {
+				t.Error(err)
+			}
+			_ = conn.Close()
+		}},
+		{"stt tee connection lost", func(t *testing.T, server *mockServer) {
+			server.dropAfter = 15
+			conn := leakBufferedSTTConnection(t, server)
+			_ = conn.Tee(TeeOutput{})
+			go streamAudio(conn, 1000)
+			_ = conn.Done()
+		}},
+		{"tts abandoned", func(t *testing.T, server *mockServer) {
+			client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := client.Connect(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.GetWriteChan() <- "hello"
+			_ = conn.Close()
+			// Close is a no-op once closed
+			if err = conn.Close(); err != nil {
+				t.Error(err)
+			}
+		}},
+		{"tts decode workers abandoned", func(t *testing.T, server *mockServer) {
+			client, err := NewTTSClient(&TTSConfig{URL: server.URL(), DecodeWorkers: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := client.Connect(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the audio frames are read ahead but never delivered
+			for range 10 {
+				conn.GetWriteChan() <- "hello"
+			}
+			_ = conn.Close()
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ignore := goleak.IgnoreCurrent()
+			server := newMockServer(t)
+			tc.run(t, server)
+			server.Close()
+			goleak.VerifyNone(t, ignore)
+		})
+	}
+}
+
+func TestWorkersPanic(t *testing.T) {
+	workers, _ := newWorkerGroup(context.Background())
+	workers.Go(recovered(func() error {
+		panic("worker failure")
+	}))
+	if err := workers.Wait(); !errors.Is(err, ErrWorkerPanic) {
+		t.Errorf("expected ErrWorkerPanic, got %v", err)
+	}
+}
+
+func leakSTTConnection(t *testing.T, server *mockServer) *STTConnection {
+	t.Helper()
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// leakBufferedSTTConnection buffers the read channel, for the connection to end while its
+// messages are not read.
+func leakBufferedSTTConnection(t *testing.T, server *mockServer) *STTConnection {
+	t.Helper()
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), ReadPolicy: ReadBuffered, ReadBuffer: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// streamAudio sends frames of silence, closing the write channel if all of them were sent.
+func streamAudio(conn *STTConnection, frames int) {
+	for range frames {
+		select {
+		case conn.GetWriteChan() <- make([]float32, FrameSize):
+		case <-conn.GetContext().Done():
+			return
+		}
+	}
+	close(conn.GetWriteChan())
+}
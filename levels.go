@@ -0,0 +1,126 @@
+package krs
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// InputTargetLevel is the speech level (RMS, dBFS) NormalizeInput brings the recordings to
+	InputTargetLevel = -20.0
+	// inputQuietLevel is the speech level below which a recording is reported as too quiet
+	inputQuietLevel = -35.0
+	// inputClippedRatio is the share of clipped samples from which a recording is reported
+	inputClippedRatio = 0.001
+	// inputClipThreshold is the magnitude of a sample at full scale
+	inputClipThreshold = 0.999
+	// inputMaxPeak is the peak NormalizeInput leaves the recordings under, in dBFS
+	inputMaxPeak = -1.0
+	// inputMaxGain bounds the gain of NormalizeInput, in dB: beyond it the noise floor is raised
+	// as much as the speech
+	inputMaxGain = 30.0
+	// the speech level is measured on the blocks above the silence gate, in dBFS
+	levelBlock       = 50 * time.Millisecond
+	levelSilenceGate = -60.0
+	// lowest level reported, the level of digital silence
+	levelFloor = -120.0
+)
+
+// InputLevels is the level analysis of a recording (see AnalyzeInput). Badly leveled recordings,
+// clipped or too quiet, are a common cause of poor transcripts.
+type InputLevels struct {
+	// Peak is the level of the loudest sample, in dBFS
+	Peak float64 `json:"peak_dbfs"`
+	// Speech is the RMS level of the parts louder than the silence, in dBFS
+	Speech float64 `json:"speech_dbfs"`
+	// Silent is set when nothing is louder than the noise floor
+	Silent bool `json:"silent,omitempty"`
+	// Clipped is the number of samples at full scale
+	Clipped int `json:"clipped"`
+	// Samples is the length of the recording
+	Samples int `json:"samples"`
+	// Gain is the gain applied by NormalizeInput, in dB
+	Gain float64 `json:"gain_db,omitempty"`
+}
+
+// AnalyzeInput measures the levels of a recording (24kHz mono).
+func AnalyzeInput(pcm []float32) (levels InputLevels) {
+	levels.Samples = len(pcm)
+	var (
+		peak         float64
+		speechEnergy float64
+		speechCount  int
+	)
+	gate := math.Pow(10, levelSilenceGate/10) // on the mean square
+	for block := range slices.Chunk(pcm, durationSamples(levelBlock)) {
+		var energy float64
+		for _, sample := range block {
+			magnitude := math.Abs(float64(sample))
+			peak = max(peak, magnitude)
+			if magnitude >= inputClipThreshold {
+				levels.Clipped++
+			}
+			energy += float64(sample) * float64(sample)
+		}
+		if energy/float64(len(block)) >= gate {
+			speechEnergy += energy
+			speechCount += len(block)
+		}
+	}
+	levels.Peak = decibels(peak)
+	if speechCount == 0 {
+		levels.Speech = levelFloor
+		levels.Silent = true
+		return
+	}
+	levels.Speech = decibels(math.Sqrt(speechEnergy / float64(speechCount)))
+	return
+}
+
+// Warnings reports the level issues of the recording, if any: clipping, speech too quiet or no
+// speech at all.
+func (il InputLevels) Warnings() (warnings []string) {
+	if il.Samples > 0 && float64(il.Clipped)/float64(il.Samples) >= inputClippedRatio {
+		warnings = append(warnings, fmt.Sprintf("clipped: %.2f%% of the samples at full scale, record at a lower gain",
+			100*float64(il.Clipped)/float64(il.Samples)))
+	}
+	switch {
+	case il.Silent:
+		warnings = append(warnings, "silent: nothing above the noise floor")
+	case il.Speech < inputQuietLevel:
+		warnings = append(warnings, fmt.Sprintf("quiet: speech at %.1f dBFS", il.Speech))
+	}
+	return
+}
+
+// NormalizeInput analyses a recording and brings its speech to InputTargetLevel, in place: the
+// amplification is limited to keep the peaks under -1 dBFS and to 30 dB. Clipping can not be
+// undone: a clipped recording stays clipped. The levels returned are the ones before the
+// normalization, with the gain applied.
+func NormalizeInput(pcm []float32) (levels InputLevels) {
+	levels = AnalyzeInput(pcm)
+	if levels.Silent {
+		return
+	}
+	// A loud recording is always attenuated, a quiet one is amplified within the headroom
+	gain := InputTargetLevel - levels.Speech
+	if gain > 0 {
+		gain = min(gain, max(inputMaxPeak-levels.Peak, 0), inputMaxGain)
+	}
+	if math.Abs(gain) < 0.1 {
+		return
+	}
+	levels.Gain = gain
+	factor := float32(math.Pow(10, gain/20))
+	for i := range pcm {
+		pcm[i] *= factor
+	}
+	return
+}
+
+// decibels converts an amplitude to dBFS.
+func decibels(amplitude float64) float64 {
+	return max(20*math.Log10(amplitude), levelFloor)
+}
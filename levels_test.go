@@ -0,0 +1,112 @@
+package krs
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestInputLevels(t *testing.T) {
+	// A quiet tone (-40 dBFS RMS) after a second of silence
+	amplitude := float32(math.Pow(10, -40.0/20) * math.Sqrt2)
+	quiet := slices.Concat(Silence(time.Second), Tone(440, 2*time.Second, amplitude))
+	levels := AnalyzeInput(quiet)
+	if math.Abs(levels.Speech+40) > 0.5 {
+		t.Errorf("speech at %.1f dBFS, expected -40", levels.Speech)
+	}
+	if warnings := levels.Warnings(); len(warnings) != 1 {
+		t.Errorf("expected a quiet warning, got %q", warnings)
+	}
+	normalized := slices.Clone(quiet)
+	levels = NormalizeInput(normalized)
+	if math.Abs(levels.Gain-20) > 0.5 {
+		t.Errorf("gain of %.1f dB, expected 20", levels.Gain)
+	}
+	if after := AnalyzeInput(normalized); math.Abs(after.Speech-InputTargetLevel) > 0.5 || len(after.Warnings()) != 0 {
+		t.Errorf("normalized speech at %.1f dBFS with warnings %q", after.Speech, after.Warnings())
+	}
+	// A clipped tone is reported and not amplified
+	clipped := Tone(440, time.Second, 2)
+	for i, sample := range clipped {
+		clipped[i] = max(min(sample, 1), -1)
+	}
+	if levels = NormalizeInput(clipped); levels.Clipped == 0 || levels.Gain > 0 {
+		t.Errorf("clipped tone: %d clipped samples, gain of %.1f dB", levels.Clipped, levels.Gain)
+	}
+	if levels = AnalyzeInput(Silence(time.Second)); !levels.Silent || len(levels.Warnings()) != 1 {
+		t.Errorf("silence not reported: %+v", levels)
+	}
+}
+
+func TestMatchVoices(t *testing.T) {
+	tone := func(level float64) []float32 {
+		return Tone(440, time.Second, float32(math.Pow(10, level/20)*math.Sqrt2))
+	}
+	turns := [][]float32{tone(-30), tone(-10), tone(-30)}
+	voices := []string{"quiet", "loud", "quiet"}
+	levels := measureVoices(turns, voices)
+	matchVoices(levels, InputTargetLevel)
+	if math.Abs(levels["quiet"].Gain-10) > 0.5 || math.Abs(levels["loud"].Gain+10) > 0.5 {
+		t.Errorf("unexpected gains: %+v", levels)
+	}
+	// At 0 dBFS the loud voice would clip: both are matched 1 dB under its peak (a sine peaks 3 dB
+	// above its RMS level)
+	levels = measureVoices(turns, voices)
+	matchVoices(levels, 0)
+	if math.Abs(levels["quiet"].Gain-26) > 0.5 || math.Abs(levels["loud"].Gain-6) > 0.5 {
+		t.Errorf("unexpected gains under the peak limit: %+v", levels)
+	}
+}
+
+func TestMixMusicBed(t *testing.T) {
+	tone := func(frequency, level float64, duration time.Duration) []float32 {
+		return Tone(frequency, duration, float32(math.Pow(10, level/20)*math.Sqrt2))
+	}
+	// a second of silence, 2 seconds of speech at -20 dBFS and 2 seconds of silence, over a
+	// shorter music looped
+	narration := slices.Concat(Silence(time.Second), tone(440, -20, 2*time.Second), Silence(2*time.Second))
+	music := tone(1000, -30, 1500*time.Millisecond)
+	mix, err := MixMusicBed(narration, music, MusicBedConfig{Intro: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := durationSamples(8 * time.Second); len(mix) != expected {
+		t.Fatalf("got %d samples, expected %d (intro, narration and outro)", len(mix), expected)
+	}
+	// the level of the music alone between two times
+	level := func(from, to time.Duration) float64 {
+		var energy float64
+		for i := durationSamples(from); i < durationSamples(to); i++ {
+			sample := float64(mix[i])
+			if narrated := i - durationSamples(time.Second); narrated >= 0 && narrated < len(narration) {
+				sample -= float64(narration[narrated])
+			}
+			energy += sample * sample
+		}
+		return decibels(math.Sqrt(energy / float64(durationSamples(to-from))))
+	}
+	for _, expected := range []struct {
+		from, to time.Duration
+		level    float64
+	}{
+		{0, 1800 * time.Millisecond, -26},                       // 6 dB under the speech
+		{2500 * time.Millisecond, 3500 * time.Millisecond, -38}, // ducked by 12 dB
+		{5 * time.Second, 5900 * time.Millisecond, -26},         // released
+	} {
+		if got := level(expected.from, expected.to); math.Abs(got-expected.level) > 0.5 {
+			t.Errorf("music at %.1f dBFS from %s to %s, expected %.1f", got, expected.from, expected.to, expected.level)
+		}
+	}
+	// the music at the speech level, without ducking
+	var zero float64
+	if mix, err = MixMusicBed(narration, music, MusicBedConfig{Level: &zero, Ducking: &zero, Intro: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if got := level(2500*time.Millisecond, 3500*time.Millisecond); math.Abs(got+20) > 0.5 {
+		t.Errorf("music at %.1f dBFS under the speech, expected -20.0 without ducking", got)
+	}
+	if _, err = MixMusicBed(narration, Silence(time.Second), MusicBedConfig{}); err == nil {
+		t.Error("expected a silent music bed to be rejected")
+	}
+}
@@ -0,0 +1,41 @@
+package krs
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrMaxSessionDuration is returned by Done() when the input of a connection was closed
+	// automatically after its MaxSessionDuration: the results of the input sent until then have
+	// been delivered.
+	ErrMaxSessionDuration = errors.New("the session reached its maximum duration")
+	// ErrMaxUtteranceDuration is returned by the writes of a TTS utterance ended automatically
+	// after its MaxUtteranceDuration: the text sent until then is still synthesized.
+	ErrMaxUtteranceDuration = errors.New("the utterance reached its maximum duration")
+)
+
+// sessionLimit closes the input of a connection after a maximum duration.
+type sessionLimit struct {
+	max     time.Duration
+	reached atomic.Bool
+}
+
+// timer returns the channel notified when the session must end, nil without limit.
+func (sl *sessionLimit) timer() (limit <-chan time.Time, stop func() bool) {
+	if sl.max <= 0 {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(sl.max)
+	return timer.C, timer.Stop
+}
+
+// err returns the reason of a clean end of the session.
+func (sl *sessionLimit) err() error {
+	if !sl.reached.Load() {
+		return nil
+	}
+	return fmt.Errorf("%w (%s)", ErrMaxSessionDuration, sl.max)
+}
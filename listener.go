@@ -0,0 +1,533 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// prs index of the server pause prediction used for endpointing
+	pausePredictionHead   = 2
+	defaultPauseThreshold = 0.5
+
+	// utterances waiting for their classification before the session blocks
+	listenerClassifyQueue = 16
+)
+
+// AudioSource provides the audio a Listener transcribes, typically a microphone (24kHz mono).
+type AudioSource interface {
+	// ReadPCM blocks until some samples are available. Returning io.EOF ends the listener.
+	ReadPCM() ([]float32, error)
+}
+
+type ListenerConfig struct {
+	// OnUtterance is called (from the listener goroutine) with each finalized utterance
+	OnUtterance func(Utterance)
+	// OnError, if set, is called with connection errors before the listener reconnects
+	OnError func(error)
+	// Retry is the policy reconnecting the listener when a connection fails or is lost (defaults to
+	// retrying forever, from 500ms to 30s apart). When it gives up, the listener stops and Wait()
+	// returns the error: by default on a rejected API key, wire format...
+	Retry *RetryPolicy
+	// OnGap, if set, is called when some audio is missing from the session timeline: discarded
+	// while paused or reconnecting, or lost with a connection. The utterance times are session
+	// stream times (see Sequencer), they go on across the reconnections.
+	OnGap func(Gap)
+	// PauseThreshold is the server pause prediction above which an utterance is over (default 0.5)
+	PauseThreshold float32
+	// SilenceTimeout ends an utterance if no new word came for this long, whatever the server
+	// pause prediction (default 2s)
+	SilenceTimeout time.Duration
+	// Classifier, if set, labels each utterance before it is delivered to OnUtterance. It runs on
+	// its own goroutine, the utterances are still delivered in order. On failure, OnError is
+	// called and the utterance is delivered without labels.
+	Classifier Classifier
+	// ClassifierTimeout is the time budget of the Classifier per utterance (default 5s)
+	ClassifierTimeout time.Duration
+	// OnListening, if set, is called when the listener starts listening (the server is ready for
+	// the audio and the listener is not muted) and when it stops (muted, paused, reconnecting or
+	// closed): drive a "listening" LED or a mute relay with it. It is called from the goroutine
+	// changing the state and must be quick.
+	OnListening func(listening bool)
+	// PreRoll, if set, keeps this much of the audio captured while paused or connecting (see
+	// PreRollBuffer) and sends it first once the server is ready: resuming on a wake word or a
+	// voice activity detector does not clip the first word.
+	PreRoll time.Duration
+}
+
+// Listener streams an AudioSource to the STT server and delivers finalized utterances.
+// It reconnects automatically if the connection is lost.
+type Listener struct {
+	client   *STTClient
+	source   AudioSource
+	config   ListenerConfig
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	captured chan []float32
+	control  chan struct{}
+	resume   chan struct{}
+	// finalized utterances waiting for their classification
+	classified     chan Utterance
+	classifierDone chan struct{}
+	// session timeline, only used by the run goroutine
+	sequencer *Sequencer
+	connected bool
+	discarded time.Duration // captured audio not sent since the previous connection
+	lastEnd   time.Duration // stream time at which the previous connection stopped
+	lastLost  time.Duration // audio sent to the previous connection but never processed
+	preRoll   *PreRollBuffer
+	// protected by mutex
+	mutex       sync.Mutex
+	paused      bool
+	muted       bool
+	streaming   bool // a session is ready
+	sourceEnded bool
+	err         error
+	// last state given to OnListening, protected by listeningMutex
+	listeningMutex sync.Mutex
+	listening      bool
+}
+
+func NewListener(ctx context.Context, client *STTClient, source AudioSource, config ListenerConfig) (listener *Listener) {
+	if config.PauseThreshold == 0 {
+		config.PauseThreshold = defaultPauseThreshold
+	}
+	if config.SilenceTimeout == 0 {
+		config.SilenceTimeout = 2 * time.Second
+	}
+	if config.ClassifierTimeout == 0 {
+		config.ClassifierTimeout = 5 * time.Second
+	}
+	if config.Retry == nil {
+		retry := DefaultRetryPolicy
+		retry.MaxAttempts = -1
+		config.Retry = &retry
+	}
+	listener = &Listener{
+		client:    client,
+		source:    source,
+		config:    config,
+		done:      make(chan struct{}),
+		captured:  make(chan []float32, 16),
+		control:   make(chan struct{}, 1),
+		resume:    make(chan struct{}, 1),
+		sequencer: NewSequencer(STTStreamOffset),
+	}
+	listener.ctx, listener.cancel = context.WithCancel(ctx)
+	if config.PreRoll > 0 {
+		listener.preRoll = NewPreRollBuffer(config.PreRoll)
+	}
+	if config.Classifier != nil {
+		listener.classified = make(chan Utterance, listenerClassifyQueue)
+		listener.classifierDone = make(chan struct{})
+		go listener.classify()
+	}
+	go listener.capture()
+	go listener.run()
+	return
+}
+
+// Pause finalizes the current utterance and closes the STT connection. Captured audio is
+// discarded until Resume is called.
+func (l *Listener) Pause() {
+	l.mutex.Lock()
+	l.paused = true
+	l.mutex.Unlock()
+	notify(l.control)
+}
+
+// Resume reconnects to the STT server after a Pause.
+func (l *Listener) Resume() {
+	l.mutex.Lock()
+	l.paused = false
+	l.mutex.Unlock()
+	notify(l.resume)
+}
+
+// Mute keeps the STT session open but streams silence instead of the captured audio.
+func (l *Listener) Mute() {
+	l.mutex.Lock()
+	l.muted = true
+	l.mutex.Unlock()
+	l.updateListening()
+}
+
+func (l *Listener) Unmute() {
+	l.mutex.Lock()
+	l.muted = false
+	l.mutex.Unlock()
+	l.updateListening()
+}
+
+// setStreaming records whether a session is ready for the audio.
+func (l *Listener) setStreaming(streaming bool) {
+	l.mutex.Lock()
+	l.streaming = streaming
+	l.mutex.Unlock()
+	l.updateListening()
+}
+
+// updateListening calls OnListening if the listening state changed.
+func (l *Listener) updateListening() {
+	if l.config.OnListening == nil {
+		return
+	}
+	l.listeningMutex.Lock()
+	defer l.listeningMutex.Unlock()
+	l.mutex.Lock()
+	listening := l.streaming && !l.muted
+	l.mutex.Unlock()
+	if listening != l.listening {
+		l.listening = listening
+		l.config.OnListening(listening)
+	}
+}
+
+// Wait blocks until the listener stops (source exhausted, Close called or the retry policy giving
+// up) and returns the audio source or connection error if any.
+func (l *Listener) Wait() error {
+	<-l.done
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.err
+}
+
+// Close stops the listener, the pending utterance is discarded.
+func (l *Listener) Close() error {
+	l.cancel()
+	return l.Wait()
+}
+
+func (l *Listener) capture() {
+	defer close(l.captured)
+	for {
+		pcm, err := l.source.ReadPCM()
+		if len(pcm) > 0 {
+			select {
+			case l.captured <- pcm:
+			case <-l.ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				l.mutex.Lock()
+				l.err = fmt.Errorf("failed to read audio source: %w", err)
+				l.mutex.Unlock()
+			}
+			return
+		}
+	}
+}
+
+func (l *Listener) run() {
+	defer close(l.done)
+	if l.classified != nil {
+		// deliver the utterances being classified before stopping
+		defer func() {
+			close(l.classified)
+			<-l.classifierDone
+		}()
+	}
+	// consecutive failed connections
+	failures := 0
+	for {
+		// Wait until we are allowed to listen
+		if !l.waitActive() {
+			return
+		}
+		// Connect and stream until paused, source ended or connection lost
+		conn, err := l.client.Connect(l.ctx, WithRetry(RetryPolicy{}))
+		if err == nil {
+			var (
+				ready bool
+				sent  time.Duration
+			)
+			if ready, sent, err = l.session(conn); ready {
+				failures = 0
+				l.endConnection(sent, err != nil)
+			}
+		} else {
+			err = fmt.Errorf("failed to connect: %w", err)
+		}
+		if l.ctx.Err() != nil || l.ended() {
+			return
+		}
+		if err != nil {
+			failures++
+			if !l.config.Retry.Retry(failures, err) {
+				l.mutex.Lock()
+				l.err = err
+				l.mutex.Unlock()
+				l.cancel()
+				return
+			}
+			if l.config.OnError != nil {
+				l.config.OnError(err)
+			}
+			if !l.discardFor(l.config.Retry.Delay(failures)) {
+				return
+			}
+		}
+	}
+}
+
+// waitActive discards captured audio while paused. It returns false if the listener must stop.
+func (l *Listener) waitActive() bool {
+	for {
+		l.mutex.Lock()
+		paused := l.paused
+		l.mutex.Unlock()
+		if !paused {
+			return true
+		}
+		select {
+		case <-l.resume:
+		case pcm, open := <-l.captured:
+			if !open {
+				l.setEnded()
+				return false
+			}
+			l.discard(pcm)
+		case <-l.ctx.Done():
+			return false
+		}
+	}
+}
+
+// discardFor discards captured audio for a while (reconnection backoff).
+func (l *Listener) discardFor(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case pcm, open := <-l.captured:
+			if !open {
+				l.setEnded()
+				return false
+			}
+			l.discard(pcm)
+		case <-l.ctx.Done():
+			return false
+		}
+	}
+}
+
+// discard accounts for captured audio not sent to the server, the pre-roll keeps the latest.
+func (l *Listener) discard(pcm []float32) {
+	l.discarded += time.Duration(len(pcm)) * time.Second / SampleRate
+	if l.preRoll != nil {
+		l.preRoll.Write(pcm)
+	}
+}
+
+// startConnection places a connection the server is ready for on the session timeline.
+func (l *Listener) startConnection() {
+	if !l.connected {
+		// the first connection starts the timeline
+		l.connected = true
+		l.discarded = 0
+		return
+	}
+	gap, lost := l.sequencer.Reconnect(l.lastEnd, l.lastLost+l.discarded)
+	l.discarded = 0
+	if lost && l.config.OnGap != nil {
+		l.config.OnGap(gap)
+	}
+}
+
+// endConnection records where a connection stopped, given the audio sent to it.
+func (l *Listener) endConnection(sent time.Duration, failed bool) {
+	l.lastEnd, l.lastLost = STTStreamOffset+sent, 0
+	if processed := l.sequencer.Position(); failed && processed < l.lastEnd {
+		l.lastEnd, l.lastLost = processed, l.lastEnd-processed
+	}
+}
+
+func (l *Listener) session(conn *STTConnection) (ready bool, sent time.Duration, err error) {
+	var (
+		connCtx  = conn.GetContext()
+		sender   = conn.GetWriteChan()
+		receiver = conn.GetReadChan()
+		captured = l.captured
+		pending  []float32
+		closing  bool
+		words    []Word
+		lastWord time.Duration
+	)
+	closeSender := func() {
+		if !closing {
+			closing = true
+			pending = nil
+			close(sender)
+		}
+	}
+	finalize := func() {
+		if len(words) > 0 {
+			l.deliver(Utterance{Words: words})
+		}
+		words = nil
+	}
+	defer l.setStreaming(false)
+	// Discard any pause request sent before this session
+	select {
+	case <-l.control:
+	default:
+	}
+	for {
+		var (
+			input  <-chan []float32
+			output chan<- []float32
+		)
+		if pending == nil {
+			input = captured
+		} else {
+			output = sender
+		}
+		select {
+		case pcm, open := <-input:
+			if !open {
+				// source exhausted, flush the server and stop
+				captured = nil
+				l.setEnded()
+				closeSender()
+				l.setStreaming(false)
+				continue
+			}
+			if !ready || closing {
+				// server not ready or session ending, discard
+				l.discard(pcm)
+				continue
+			}
+			l.mutex.Lock()
+			if l.muted {
+				pcm = make([]float32, len(pcm))
+			}
+			l.mutex.Unlock()
+			pending = pcm
+		case output <- pending:
+			sent += time.Duration(len(pending)) * time.Second / SampleRate
+			pending = nil
+		case <-l.control:
+			l.mutex.Lock()
+			paused := l.paused
+			l.mutex.Unlock()
+			if paused {
+				closeSender()
+				l.setStreaming(false)
+			}
+		case msg, open := <-receiver:
+			if !open {
+				// server stream is over
+				finalize()
+				err = conn.Done()
+				return
+			}
+			if header, ok := msg.(MessagePackHeader); ok && header.Type == MessagePackTypeReady && !ready {
+				ready = true
+				if l.preRoll != nil && !closing {
+					// the audio kept is sent first, it is not missing anymore
+					pending = l.preRoll.Drain()
+					l.discarded -= time.Duration(len(pending)) * time.Second / SampleRate
+					if len(pending) == 0 {
+						pending = nil
+					}
+				}
+				l.startConnection()
+				if !closing {
+					l.setStreaming(true)
+				}
+			}
+			sequenced, seqErr := l.sequencer.Next(msg)
+			if seqErr != nil && l.config.OnError != nil {
+				l.config.OnError(seqErr)
+			}
+			switch typed := msg.(type) {
+			case MessagePackWord:
+				words = append(words, Word{
+					Text:  typed.Text,
+					Start: sequenced.Offset,
+				})
+				lastWord = sequenced.Offset
+			case MessagePackWordEnd:
+				if len(words) > 0 {
+					words[len(words)-1].End = sequenced.Offset
+				}
+			case MessagePackStep:
+				// Endpointing: rely on the server pause prediction or on a lack of new words
+				if len(words) == 0 {
+					continue
+				}
+				if typed.PausePrediction() > l.config.PauseThreshold ||
+					sequenced.Offset-lastWord > l.config.SilenceTimeout {
+					finalize()
+				}
+			}
+		case <-connCtx.Done():
+			if l.ctx.Err() == nil {
+				// do not deliver a partial utterance if we are closing
+				finalize()
+			}
+			if err = conn.Done(); l.ctx.Err() != nil {
+				err = nil
+			}
+			return
+		}
+	}
+}
+
+func (l *Listener) ended() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.sourceEnded
+}
+
+func (l *Listener) setEnded() {
+	l.mutex.Lock()
+	l.sourceEnded = true
+	l.mutex.Unlock()
+}
+
+// deliver hands over a finalized utterance, through the classifier if any.
+func (l *Listener) deliver(utterance Utterance) {
+	if l.classified != nil {
+		select {
+		case l.classified <- utterance:
+		case <-l.ctx.Done():
+		}
+		return
+	}
+	if l.config.OnUtterance != nil {
+		l.config.OnUtterance(utterance)
+	}
+}
+
+// classify labels the finalized utterances and delivers them, in order.
+func (l *Listener) classify() {
+	defer close(l.classifierDone)
+	for utterance := range l.classified {
+		if err := classifyUtterance(l.ctx, l.config.Classifier, l.config.ClassifierTimeout, &utterance); err != nil && l.ctx.Err() == nil {
+			if l.config.OnError != nil {
+				l.config.OnError(err)
+			}
+		}
+		if l.config.OnUtterance != nil {
+			l.config.OnUtterance(utterance)
+		}
+	}
+}
+
+// notify signals a channel of capacity 1 without blocking.
+func notify(signal chan struct{}) {
+	select {
+	case signal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,181 @@
+package krs
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// frameSource is an AudioSource of silent frames, paced and starting once the listener listens.
+type frameSource struct {
+	frames int
+	pace   time.Duration
+	start  chan struct{}
+	once   sync.Once
+}
+
+func newFrameSource(frames int, pace time.Duration) *frameSource {
+	return &frameSource{frames: frames, pace: pace, start: make(chan struct{})}
+}
+
+// listening is the OnListening hook of the listener reading the source.
+func (fs *frameSource) listening(listening bool) {
+	if listening {
+		fs.once.Do(func() { close(fs.start) })
+	}
+}
+
+func (fs *frameSource) ReadPCM() ([]float32, error) {
+	<-fs.start
+	if fs.frames == 0 {
+		return nil, io.EOF
+	}
+	fs.frames--
+	time.Sleep(fs.pace)
+	return make([]float32, FrameSize), nil
+}
+
+// listen runs a listener over the source until it ends, returning the utterances delivered.
+func listen(t *testing.T, server *mockServer, source *frameSource, config ListenerConfig) (utterances []Utterance, err error) {
+	t.Helper()
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	config.OnUtterance = func(utterance Utterance) {
+		mutex.Lock()
+		utterances = append(utterances, utterance)
+		mutex.Unlock()
+	}
+	config.OnListening = source.listening
+	listener := NewListener(context.Background(), client, source, config)
+	done := make(chan error, 1)
+	go func() { done <- listener.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		_ = listener.Close()
+		t.Fatal("the listener did not stop at the end of the source")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return utterances, err
+}
+
+func TestListenerEndpointing(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		pauseEvery     int
+		silenceTimeout time.Duration
+		// the words of each utterance but the last one, 0 for a single utterance
+		words int
+	}{
+		// a word every 10 steps and a pause predicted every 30 steps
+		{name: "pause prediction", pauseEvery: 30, silenceTimeout: time.Minute, words: 3},
+		// the words come 800ms apart
+		{name: "silence timeout", silenceTimeout: 500 * time.Millisecond, words: 1},
+		{name: "no pause", silenceTimeout: time.Minute},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newMockServer(t)
+			server.pauseEvery = test.pauseEvery
+			utterances, err := listen(t, server, newFrameSource(120, 0), ListenerConfig{SilenceTimeout: test.silenceTimeout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.words == 0 {
+				if len(utterances) != 1 {
+					t.Fatalf("got %d utterances, expected one", len(utterances))
+				}
+				return
+			}
+			if len(utterances) < 3 {
+				t.Fatalf("got %d utterances, expected more", len(utterances))
+			}
+			for i, utterance := range utterances[:len(utterances)-1] {
+				if len(utterance.Words) != test.words {
+					t.Errorf("utterance %d has %d words, expected %d", i, len(utterance.Words), test.words)
+				}
+			}
+		})
+	}
+}
+
+func TestListenerReconnect(t *testing.T) {
+	server := newMockServer(t)
+	server.dropAfter = 40
+	var (
+		mutex  sync.Mutex
+		errs   []error
+		gaps   []Gap
+		source = newFrameSource(150, 5*time.Millisecond)
+	)
+	utterances, err := listen(t, server, source, ListenerConfig{
+		Retry: &RetryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond},
+		OnError: func(err error) {
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		},
+		OnGap: func(gap Gap) {
+			mutex.Lock()
+			gaps = append(gaps, gap)
+			mutex.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if handshakes := server.handshakes.Load(); handshakes != 2 {
+		t.Errorf("got %d connections, expected a reconnection", handshakes)
+	}
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, expected the lost connection", errs)
+	}
+	// the audio captured during the backoff is missing from the timeline
+	if len(gaps) != 1 || gaps[0].Duration() < 100*time.Millisecond {
+		t.Errorf("got gaps %+v, expected the backoff", gaps)
+	}
+	// the session times go on across the connections
+	var last time.Duration
+	for _, utterance := range utterances {
+		for _, word := range utterance.Words {
+			if word.Start <= last {
+				t.Fatalf("word at %s after a word at %s", word.Start, last)
+			}
+			last = word.Start
+		}
+	}
+	if last < 2*time.Second {
+		t.Errorf("last word at %s, expected words of the second connection", last)
+	}
+}
+
+func TestListenerRetryGivesUp(t *testing.T) {
+	server := newMockServer(t)
+	server.unavailable.Store(100)
+	var failures int
+	// never ready, the source is read from the start
+	source := newFrameSource(-1, 10*time.Millisecond)
+	source.listening(true)
+	start := time.Now()
+	_, err := listen(t, server, source, ListenerConfig{
+		Retry:   &RetryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond},
+		OnError: func(error) { failures++ },
+	})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("got %v, expected the server unavailable", err)
+	}
+	if attempts := 100 - server.unavailable.Load(); attempts != 3 || failures != 2 {
+		t.Errorf("got %d attempts and %d errors reported, expected 3 and 2", attempts, failures)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("gave up after %s, expected two backoffs of 100ms", elapsed)
+	}
+}
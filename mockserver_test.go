@@ -0,0 +1,221 @@
+package krs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// mockCodec returns the codec of the wire format asked by the client.
+func mockCodec(r *http.Request) codec {
+	query := r.URL.Query()
+	c, err := newCodec(WireFormat(query.Get("format")), query.Get("encoding") == "base64")
+	if err != nil {
+		return msgpackCodec{}
+	}
+	return c
+}
+
+// mockServer mimics the Kyutai Rust server protocol: the STT endpoint answers each audio frame
+// with a step (and a word every wordEvery frames), the TTS endpoint answers each text with a
+// text echo and an audio frame.
+type mockServer struct {
+	*httptest.Server
+	wordEvery int
+	// pauseEvery, if set, makes the STT endpoint predict a pause every this many steps
+	pauseEvery int
+	// closeAfter, if set, makes the STT endpoint close the connection after this many steps
+	closeAfter int
+	// stallAfter, if set, makes the first STT connection stop answering after this many steps
+	stallAfter int
+	stalled    atomic.Bool
+	// dropAfter, if set, makes the first STT connection drop without closing handshake after this
+	// many steps, like a network failure
+	dropAfter int
+	dropped   atomic.Bool
+	// apiKey, if set, is required by both endpoints
+	apiKey string
+	// unavailable, if set, makes this many handshakes fail with HTTP 503
+	unavailable atomic.Int32
+	// formats, if set, are the only wire formats accepted, the others fail with HTTP 400
+	formats []WireFormat
+	// handshakes counts the handshakes reaching the endpoints
+	handshakes atomic.Int32
+}
+
+func newMockServer(tb testing.TB) (server *mockServer) {
+	server = &mockServer{wordEvery: 10}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/asr-streaming", server.stt)
+	mux.HandleFunc("/api/tts_streaming", server.tts)
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.apiKey != "" && r.Header.Get("kyutai-api-key") != server.apiKey {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if server.unavailable.Add(-1) >= 0 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		server.handshakes.Add(1)
+		if server.formats != nil && !slices.Contains(server.formats, WireFormat(r.URL.Query().Get("format"))) {
+			http.Error(w, "unsupported format", http.StatusBadRequest)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	tb.Cleanup(server.Close)
+	return
+}
+
+func (server *mockServer) URL() string {
+	return "ws" + server.Server.URL[len("http"):]
+}
+
+func (server *mockServer) stt(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(-1) // the client starts with 1s of silence in a single message
+	ctx := r.Context()
+	c := mockCodec(r)
+	if mockSend(ctx, conn, c, MessagePackHeader{Type: MessagePackTypeReady}) != nil {
+		return
+	}
+	var (
+		header MessagePackHeader
+		audio  MessagePackAudio
+		marker MessagePackMarker
+		step   int
+	)
+	for {
+		_, payload, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if err = c.unmarshal(payload, &header); err != nil {
+			return
+		}
+		switch header.Type {
+		case MessagePackTypeAudio:
+			if err = c.unmarshal(payload, &audio); err != nil {
+				return
+			}
+			for range len(audio.PCM) / FrameSize {
+				step++
+				if step%server.wordEvery == 0 {
+					if mockSend(ctx, conn, c, MessagePackWord{
+						Type:      MessagePackTypeWord,
+						Text:      "word",
+						StartTime: float64(step) * FrameDuration.Seconds(),
+					}) != nil {
+						return
+					}
+				}
+				prs := []float32{0, 0, 0, 0}
+				if server.pauseEvery > 0 && step%server.pauseEvery == 0 {
+					prs[pausePredictionHead] = 1
+				}
+				if mockSend(ctx, conn, c, &MessagePackStep{
+					Type:        MessagePackTypeStep,
+					Prs:         prs,
+					StepIndex:   step,
+					BufferedPCM: FrameSize,
+				}) != nil {
+					return
+				}
+				if step == server.dropAfter && server.dropped.CompareAndSwap(false, true) {
+					_ = conn.CloseNow()
+					return
+				}
+				if step == server.closeAfter {
+					_ = conn.Close(websocket.StatusNoStatusRcvd, "")
+					return
+				}
+				if step == server.stallAfter && server.stalled.CompareAndSwap(false, true) {
+					for {
+						if _, _, err = conn.Read(ctx); err != nil {
+							return
+						}
+					}
+				}
+			}
+		case MessagePackTypeMarker:
+			if err = c.unmarshal(payload, &marker); err != nil {
+				return
+			}
+			if mockSend(ctx, conn, c, marker) != nil {
+				return
+			}
+			if marker.ID == 0 {
+				// end of stream: report an empty buffer and wait for the client to close
+				if mockSend(ctx, conn, c, &MessagePackStep{
+					Type:      MessagePackTypeStep,
+					Prs:       []float32{0, 0, 1, 0},
+					StepIndex: step,
+				}) != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (server *mockServer) tts(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	ctx := r.Context()
+	c := mockCodec(r)
+	if mockSend(ctx, conn, c, &MessagePackReady{Type: MessagePackTypeReady, Voice: r.URL.Query().Get("voice"), SampleRate: SampleRate}) != nil {
+		return
+	}
+	var (
+		header MessagePackHeader
+		text   MessagePackText
+		frame  = make([]float32, FrameSize)
+	)
+	for {
+		_, payload, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if err = c.unmarshal(payload, &header); err != nil {
+			return
+		}
+		switch header.Type {
+		case MessagePackTypeText:
+			if err = c.unmarshal(payload, &text); err != nil {
+				return
+			}
+			if mockSend(ctx, conn, c, text) != nil {
+				return
+			}
+			if mockSend(ctx, conn, c, &MessagePackAudio{Type: MessagePackTypeAudio, PCM: frame}) != nil {
+				return
+			}
+		case MessagePackTypeEoS:
+			// the real server closes without status once the audio is fully sent
+			_ = conn.Close(websocket.StatusNoStatusRcvd, "")
+			return
+		}
+	}
+}
+
+func mockSend(ctx context.Context, conn *websocket.Conn, c codec, msg msgp.Marshaler) (err error) {
+	payload, err := c.marshal(msg)
+	if err != nil {
+		return
+	}
+	return conn.Write(ctx, c.frameType(), payload)
+}
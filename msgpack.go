@@ -25,6 +25,9 @@ const (
 	// Below are types handled automatically by the lib
 	MessagePackTypeEoS    MessagePackType = "Eos"
 	MessagePackTypeMarker MessagePackType = "Marker"
+	// Flow control, see FlowControl() on the connections
+	MessagePackTypePause  MessagePackType = "Pause"
+	MessagePackTypeResume MessagePackType = "Resume"
 )
 
 type MessagePack interface {
@@ -32,16 +35,31 @@ type MessagePack interface {
 }
 
 type MessagePackHeader struct {
-	Type MessagePackType `msg:"type"`
+	Type MessagePackType `msg:"type" json:"type"`
 }
 
 func (pmh MessagePackHeader) MessageType() MessagePackType {
 	return pmh.Type
 }
 
+// MessagePackReady is the full Ready frame: the metadata fields are only set if the server
+// includes them. The read channels deliver the Ready frame as a MessagePackHeader, use ReadyInfo()
+// on the connections to get these fields.
+type MessagePackReady struct {
+	Type       MessagePackType `msg:"type" json:"type"`
+	Model      string          `msg:"model" json:"model"`
+	Voice      string          `msg:"voice" json:"voice"`
+	SampleRate int             `msg:"sample_rate" json:"sample_rate"`
+	MaxBatch   int             `msg:"max_batch" json:"max_batch"`
+}
+
+func (mpr MessagePackReady) MessageType() MessagePackType {
+	return mpr.Type
+}
+
 type MessagePackText struct {
-	Type MessagePackType `msg:"type"`
-	Text string          `msg:"text"`
+	Type MessagePackType `msg:"type" json:"type"`
+	Text string          `msg:"text" json:"text"`
 }
 
 func (pmt MessagePackText) MessageType() MessagePackType {
@@ -49,8 +67,8 @@ func (pmt MessagePackText) MessageType() MessagePackType {
 }
 
 type MessagePackAudio struct {
-	Type MessagePackType `msg:"type"`
-	PCM  []float32       `msg:"pcm"`
+	Type MessagePackType `msg:"type" json:"type"`
+	PCM  []float32       `msg:"pcm" json:"pcm"`
 }
 
 func (mpa MessagePackAudio) MessageType() MessagePackType {
@@ -58,8 +76,8 @@ func (mpa MessagePackAudio) MessageType() MessagePackType {
 }
 
 type MessagePackMarker struct {
-	Type MessagePackType `msg:"type"`
-	ID   int64           `msg:"id"`
+	Type MessagePackType `msg:"type" json:"type"`
+	ID   int64           `msg:"id" json:"id"`
 }
 
 func (mpm MessagePackMarker) MessageType() MessagePackType {
@@ -67,10 +85,10 @@ func (mpm MessagePackMarker) MessageType() MessagePackType {
 }
 
 type MessagePackStep struct {
-	Type        MessagePackType `msg:"type"`
-	Prs         []float32       `msg:"prs"`
-	StepIndex   int             `msg:"step_idx"`
-	BufferedPCM int             `msg:"buffered_pcm"`
+	Type        MessagePackType `msg:"type" json:"type"`
+	Prs         []float32       `msg:"prs" json:"prs"`
+	StepIndex   int             `msg:"step_idx" json:"step_idx"`
+	BufferedPCM int             `msg:"buffered_pcm" json:"buffered_pcm"`
 }
 
 func (mps MessagePackStep) MessageType() MessagePackType {
@@ -81,10 +99,19 @@ func (mps MessagePackStep) BufferDelay() time.Duration {
 	return time.Duration(mps.BufferedPCM) * time.Second / SampleRate
 }
 
+// PausePrediction returns the server prediction (0 to 1) that the speaker paused, which ends an
+// utterance.
+func (mps MessagePackStep) PausePrediction() float32 {
+	if len(mps.Prs) <= pausePredictionHead {
+		return 0
+	}
+	return mps.Prs[pausePredictionHead]
+}
+
 type MessagePackWord struct {
-	Type      MessagePackType `msg:"type"`
-	Text      string          `msg:"text"`
-	StartTime float64         `msg:"start_time"`
+	Type      MessagePackType `msg:"type" json:"type"`
+	Text      string          `msg:"text" json:"text"`
+	StartTime float64         `msg:"start_time" json:"start_time"`
 }
 
 func (mpw MessagePackWord) MessageType() MessagePackType {
@@ -96,8 +123,8 @@ func (mpw MessagePackWord) StartTimeDuration() time.Duration {
 }
 
 type MessagePackWordEnd struct {
-	Type     MessagePackType `msg:"type"`
-	StopTime float64         `msg:"stop_time"`
+	Type     MessagePackType `msg:"type" json:"type"`
+	StopTime float64         `msg:"stop_time" json:"stop_time"`
 }
 
 func (mpwe MessagePackWordEnd) MessageType() MessagePackType {
@@ -425,6 +425,217 @@ func (z MessagePackMarker) Msgsize() (s int) {
 	return
 }
 
+// DecodeMsg implements msgp.Decodable
+func (z *MessagePackReady) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "type":
+			{
+				var zb0002 string
+				zb0002, err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Type")
+					return
+				}
+				z.Type = MessagePackType(zb0002)
+			}
+		case "model":
+			z.Model, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Model")
+				return
+			}
+		case "voice":
+			z.Voice, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Voice")
+				return
+			}
+		case "sample_rate":
+			z.SampleRate, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "SampleRate")
+				return
+			}
+		case "max_batch":
+			z.MaxBatch, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "MaxBatch")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *MessagePackReady) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 5
+	// write "type"
+	err = en.Append(0x85, 0xa4, 0x74, 0x79, 0x70, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(string(z.Type))
+	if err != nil {
+		err = msgp.WrapError(err, "Type")
+		return
+	}
+	// write "model"
+	err = en.Append(0xa5, 0x6d, 0x6f, 0x64, 0x65, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Model)
+	if err != nil {
+		err = msgp.WrapError(err, "Model")
+		return
+	}
+	// write "voice"
+	err = en.Append(0xa5, 0x76, 0x6f, 0x69, 0x63, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Voice)
+	if err != nil {
+		err = msgp.WrapError(err, "Voice")
+		return
+	}
+	// write "sample_rate"
+	err = en.Append(0xab, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x5f, 0x72, 0x61, 0x74, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.SampleRate)
+	if err != nil {
+		err = msgp.WrapError(err, "SampleRate")
+		return
+	}
+	// write "max_batch"
+	err = en.Append(0xa9, 0x6d, 0x61, 0x78, 0x5f, 0x62, 0x61, 0x74, 0x63, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.MaxBatch)
+	if err != nil {
+		err = msgp.WrapError(err, "MaxBatch")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *MessagePackReady) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 5
+	// string "type"
+	o = append(o, 0x85, 0xa4, 0x74, 0x79, 0x70, 0x65)
+	o = msgp.AppendString(o, string(z.Type))
+	// string "model"
+	o = append(o, 0xa5, 0x6d, 0x6f, 0x64, 0x65, 0x6c)
+	o = msgp.AppendString(o, z.Model)
+	// string "voice"
+	o = append(o, 0xa5, 0x76, 0x6f, 0x69, 0x63, 0x65)
+	o = msgp.AppendString(o, z.Voice)
+	// string "sample_rate"
+	o = append(o, 0xab, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x5f, 0x72, 0x61, 0x74, 0x65)
+	o = msgp.AppendInt(o, z.SampleRate)
+	// string "max_batch"
+	o = append(o, 0xa9, 0x6d, 0x61, 0x78, 0x5f, 0x62, 0x61, 0x74, 0x63, 0x68)
+	o = msgp.AppendInt(o, z.MaxBatch)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *MessagePackReady) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "type":
+			{
+				var zb0002 string
+				zb0002, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Type")
+					return
+				}
+				z.Type = MessagePackType(zb0002)
+			}
+		case "model":
+			z.Model, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Model")
+				return
+			}
+		case "voice":
+			z.Voice, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Voice")
+				return
+			}
+		case "sample_rate":
+			z.SampleRate, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "SampleRate")
+				return
+			}
+		case "max_batch":
+			z.MaxBatch, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "MaxBatch")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *MessagePackReady) Msgsize() (s int) {
+	s = 1 + 5 + msgp.StringPrefixSize + len(string(z.Type)) + 6 + msgp.StringPrefixSize + len(z.Model) + 6 + msgp.StringPrefixSize + len(z.Voice) + 12 + msgp.IntSize + 10 + msgp.IntSize
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *MessagePackStep) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
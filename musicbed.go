@@ -0,0 +1,166 @@
+package krs
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultMusicLevel is the level of a music bed outside the speech, relative to the speech level
+	// of the narration, in dB
+	DefaultMusicLevel = -6.0
+	// DefaultDucking is the attenuation of a music bed under the speech, in dB
+	DefaultDucking = -12.0
+	// DefaultMusicOutro is the music played after the narration of a mix, fading out
+	DefaultMusicOutro = 2 * time.Second
+	// the speech activity driving the ducking is detected on short blocks, above the speech level
+	// of the narration minus duckingGate
+	duckingBlock = 10 * time.Millisecond
+	duckingGate  = 30.0
+	// defaults of MusicBedConfig
+	defaultDuckingAttack  = 100 * time.Millisecond
+	defaultDuckingRelease = 500 * time.Millisecond
+	defaultDuckingHold    = 300 * time.Millisecond
+)
+
+// MusicBedConfig is the configuration of MixMusicBed.
+type MusicBedConfig struct {
+	// Level is the level of the music outside the speech, relative to the speech level of the
+	// narration, in dB (nil for DefaultMusicLevel)
+	Level *float64
+	// Ducking is the attenuation of the music while the narration speaks, in dB (nil for
+	// DefaultDucking, 0 for none)
+	Ducking *float64
+	// Attack is the time the music takes to duck: it starts that early before the speech, to be
+	// fully ducked when it begins (default 100ms)
+	Attack time.Duration
+	// Release is the time the music takes to come back once the speech stopped (default 500ms)
+	Release time.Duration
+	// Hold keeps the music ducked this long after the speech, so that it does not pump between
+	// the words and the sentences (default 300ms)
+	Hold time.Duration
+	// Intro is the music played alone before the narration
+	Intro time.Duration
+	// Outro is the music played after the narration, fading out (default DefaultMusicOutro,
+	// negative for none)
+	Outro time.Duration
+}
+
+// MixMusicBed mixes a narration (24kHz mono) over a music bed, looped if it is shorter than the mix.
+// The music is brought to config.Level under the speech level of the narration and side-chain
+// ducked: it is attenuated by config.Ducking while the narration speaks, with the attack, hold and
+// release smoothing the gain. The whole mix is lowered if it would peak above -1 dBFS.
+func MixMusicBed(narration, music []float32, config MusicBedConfig) (mix []float32, err error) {
+	musicLevel, ducking := DefaultMusicLevel, DefaultDucking
+	if config.Level != nil {
+		musicLevel = *config.Level
+	}
+	if config.Ducking != nil {
+		ducking = *config.Ducking
+	}
+	if config.Attack <= 0 {
+		config.Attack = defaultDuckingAttack
+	}
+	if config.Release <= 0 {
+		config.Release = defaultDuckingRelease
+	}
+	if config.Hold <= 0 {
+		config.Hold = defaultDuckingHold
+	}
+	if config.Outro == 0 {
+		config.Outro = DefaultMusicOutro
+	}
+	musicLevels := AnalyzeInput(music)
+	if musicLevels.Silent {
+		err = errors.New("the music bed is silent")
+		return
+	}
+	speech := InputTargetLevel
+	if levels := AnalyzeInput(narration); !levels.Silent {
+		speech = levels.Speech
+	}
+	intro := durationSamples(max(config.Intro, 0))
+	outro := durationSamples(max(config.Outro, 0))
+	mix = make([]float32, intro+len(narration)+outro)
+	copy(mix[intro:], narration)
+	// The gain of the music, in dB per block, follows the speech activity
+	block := durationSamples(duckingBlock)
+	gains := duckingGains(mix, block, speech-duckingGate, ducking, config)
+	level := speech + musicLevel - musicLevels.Speech
+	fade := len(mix) - outro
+	var peak float64
+	for i := range mix {
+		// interpolated between the centers of the blocks, so that the gain changes do not click
+		position := max(float64(i)/float64(block)-0.5, 0)
+		index := min(int(position), len(gains)-1)
+		next := min(index+1, len(gains)-1)
+		fraction := min(position-float64(index), 1)
+		factor := math.Pow(10, (level+gains[index]*(1-fraction)+gains[next]*fraction)/20)
+		if i >= fade {
+			factor *= float64(len(mix)-i) / float64(outro)
+		}
+		mix[i] += float32(float64(music[i%len(music)]) * factor)
+		peak = max(peak, math.Abs(float64(mix[i])))
+	}
+	if maxPeak := math.Pow(10, inputMaxPeak/20); peak > maxPeak {
+		factor := float32(maxPeak / peak)
+		for i := range mix {
+			mix[i] *= factor
+		}
+	}
+	return
+}
+
+// duckingGains returns the ducking of the music for each block of the speech, in dB: the speech
+// activity is held, anticipated by the attack and smoothed by the attack and release.
+func duckingGains(speech []float32, block int, gate, ducking float64, config MusicBedConfig) (gains []float64) {
+	blocks := (len(speech) + block - 1) / block
+	active := make([]bool, blocks)
+	threshold := math.Pow(10, gate/10) // on the mean square
+	for b := range active {
+		samples := speech[b*block : min((b+1)*block, len(speech))]
+		var energy float64
+		for _, sample := range samples {
+			energy += float64(sample) * float64(sample)
+		}
+		active[b] = energy/float64(len(samples)) >= threshold
+	}
+	holdBlocks := int(config.Hold / duckingBlock)
+	attackBlocks := max(int(config.Attack/duckingBlock), 1)
+	releaseBlocks := max(int(config.Release/duckingBlock), 1)
+	// ducked blocks: speech in the hold before them or in the attack after them
+	ducked := make([]bool, blocks)
+	last := -1 - holdBlocks
+	for b := range active {
+		if active[b] {
+			last = b
+		}
+		ducked[b] = b-last <= holdBlocks
+	}
+	next := blocks + attackBlocks
+	for b := blocks - 1; b >= 0; b-- {
+		if active[b] {
+			next = b
+		}
+		ducked[b] = ducked[b] || next-b <= attackBlocks
+	}
+	gains = make([]float64, blocks)
+	var gain float64
+	for b := range gains {
+		target := 0.0
+		if ducked[b] {
+			target = ducking
+		}
+		if b == 0 {
+			gain = target
+		}
+		if target < gain {
+			gain = max(target, gain+ducking/float64(attackBlocks))
+		} else {
+			gain = min(target, gain-ducking/float64(releaseBlocks))
+		}
+		gains[b] = gain
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// ErrFormatRejected is returned by Connect() when the server rejected the wire format during the
+// websocket handshake.
+var ErrFormatRejected = errors.New("the server rejected the wire format")
+
+// formatRejected tells if a handshake status means the server does not support the query
+// parameters, the format being the only one changing between the negotiation attempts.
+func formatRejected(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity,
+		http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// formatNegotiator picks the first wire format of a list the server accepts and remembers it for
+// the next connections of the client (a client talks to a single server).
+type formatNegotiator struct {
+	// in order of preference
+	codecs []codec
+	mutex  sync.Mutex
+	// nil until a format was accepted
+	accepted codec
+}
+
+// newFormatNegotiator returns nil without formats to negotiate.
+func newFormatNegotiator(formats []WireFormat, base64Frames bool) (fn *formatNegotiator, err error) {
+	if len(formats) == 0 {
+		return
+	}
+	fn = new(formatNegotiator)
+	for _, format := range formats {
+		var c codec
+		if c, err = newCodec(format, base64Frames); err != nil {
+			return nil, err
+		}
+		fn.codecs = append(fn.codecs, c)
+	}
+	return
+}
+
+// candidates returns the codecs to try in order: the one accepted last time first.
+func (fn *formatNegotiator) candidates() (codecs []codec) {
+	fn.mutex.Lock()
+	defer fn.mutex.Unlock()
+	if fn.accepted == nil {
+		return fn.codecs
+	}
+	codecs = append(codecs, fn.accepted)
+	for _, c := range fn.codecs {
+		if c != fn.accepted {
+			codecs = append(codecs, c)
+		}
+	}
+	return
+}
+
+func (fn *formatNegotiator) accept(c codec) {
+	fn.mutex.Lock()
+	defer fn.mutex.Unlock()
+	fn.accepted = c
+}
+
+// dialFormat opens the websocket connection with the codec of the options or, when the client
+// has formats to negotiate and the options do not set one, with the first of them the server
+// accepts. address returns the URL of the server for a codec.
+func dialFormat(ctx context.Context, negotiator *formatNegotiator, client codec, address func(codec) string,
+	apiKey string, httpClient *http.Client, opts connectOptions) (conn *websocket.Conn, c codec, err error) {
+	if negotiator == nil || opts.format != "" {
+		if c, err = opts.codec(client); err != nil {
+			return
+		}
+		conn, err = dial(ctx, address(c), apiKey, httpClient, opts)
+		return
+	}
+	var rejected []WireFormat
+	for _, c = range negotiator.candidates() {
+		if conn, err = dial(ctx, address(c), apiKey, httpClient, opts); err == nil {
+			negotiator.accept(c)
+			return
+		}
+		if !errors.Is(err, ErrFormatRejected) {
+			return
+		}
+		rejected = append(rejected, c.format())
+	}
+	err = fmt.Errorf("failed to negotiate the wire format: %w (tried %v)", ErrFormatRejected, rejected)
+	return
+}
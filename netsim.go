@@ -0,0 +1,206 @@
+package krs
+
+import (
+	"math/rand/v2"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// chunks in flight per direction before writes block (the simulated network buffers)
+	simulatedQueueLength = 64
+	simulatedReadSize    = 32 << 10
+	// how far ahead of the capped link writes can go before blocking
+	simulatedSendBuffer = 250 * time.Millisecond
+)
+
+// NetworkConditions degrades the network of a connection to test an application under poor
+// conditions (mobile networks for example). It is meant for testing only.
+type NetworkConditions struct {
+	// UploadBandwidth caps the outbound throughput in bytes per second (0 for no limit)
+	UploadBandwidth int
+	// Latency is added to the round trip time, half of it on each direction
+	Latency time.Duration
+	// Jitter randomly adds up to this duration to the latency of each chunk of data, the data order is kept
+	Jitter time.Duration
+}
+
+// Mobile3G approximates a typical 3G connection.
+var Mobile3G = NetworkConditions{
+	UploadBandwidth: 48_000,
+	Latency:         300 * time.Millisecond,
+	Jitter:          100 * time.Millisecond,
+}
+
+type delayedChunk struct {
+	data []byte
+	at   time.Time
+}
+
+// simulatedConn delays the data going through a net.Conn: each direction is a delay line fed and
+// emptied by a dedicated goroutine.
+type simulatedConn struct {
+	net.Conn
+	conditions NetworkConditions
+	// outbound
+	writeMutex sync.Mutex
+	outbound   chan delayedChunk
+	nextFree   time.Time // when the capped link is available again
+	lastOut    time.Time
+	writeErr   atomic.Pointer[error]
+	// inbound
+	inbound chan delayedChunk
+	pending []byte
+	readErr error
+	// shutdown
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSimulatedConn(conn net.Conn, conditions NetworkConditions) *simulatedConn {
+	sc := &simulatedConn{
+		Conn:       conn,
+		conditions: conditions,
+		outbound:   make(chan delayedChunk, simulatedQueueLength),
+		inbound:    make(chan delayedChunk, simulatedQueueLength),
+		closed:     make(chan struct{}),
+	}
+	go sc.sender()
+	go sc.receiver()
+	return sc
+}
+
+// delay returns the one way latency of a chunk.
+func (sc *simulatedConn) delay() (delay time.Duration) {
+	delay = sc.conditions.Latency / 2
+	if sc.conditions.Jitter > 0 {
+		delay += rand.N(sc.conditions.Jitter)
+	}
+	return
+}
+
+func (sc *simulatedConn) Write(p []byte) (n int, err error) {
+	if errPtr := sc.writeErr.Load(); errPtr != nil {
+		return 0, *errPtr
+	}
+	sc.writeMutex.Lock()
+	defer sc.writeMutex.Unlock()
+	// Bandwidth: the chunk leaves once the previous ones are on the wire
+	leave := time.Now()
+	if sc.conditions.UploadBandwidth > 0 {
+		leave = later(leave, sc.nextFree).Add(time.Duration(len(p)) * time.Second / time.Duration(sc.conditions.UploadBandwidth))
+		sc.nextFree = leave
+		// block like a full socket buffer would instead of queuing an unbounded backlog
+		if !sc.wait(leave.Add(-simulatedSendBuffer)) {
+			return 0, net.ErrClosed
+		}
+	}
+	// Latency: keep the order whatever the jitter
+	chunk := delayedChunk{
+		data: append([]byte(nil), p...),
+		at:   later(leave.Add(sc.delay()), sc.lastOut),
+	}
+	sc.lastOut = chunk.at
+	select {
+	case sc.outbound <- chunk:
+		return len(p), nil
+	case <-sc.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (sc *simulatedConn) sender() {
+	for {
+		select {
+		case <-sc.closed:
+			return
+		case chunk := <-sc.outbound:
+			if !sc.wait(chunk.at) {
+				return
+			}
+			if _, err := sc.Conn.Write(chunk.data); err != nil {
+				sc.writeErr.Store(&err)
+				sc.Close()
+				return
+			}
+		}
+	}
+}
+
+func (sc *simulatedConn) receiver() {
+	defer close(sc.inbound)
+	var last time.Time
+	for {
+		buffer := make([]byte, simulatedReadSize)
+		n, err := sc.Conn.Read(buffer)
+		if n > 0 {
+			chunk := delayedChunk{
+				data: buffer[:n],
+				at:   later(time.Now().Add(sc.delay()), last),
+			}
+			last = chunk.at
+			select {
+			case sc.inbound <- chunk:
+			case <-sc.closed:
+				return
+			}
+		}
+		if err != nil {
+			sc.readErr = err // published by closing the inbound channel
+			return
+		}
+	}
+}
+
+func (sc *simulatedConn) Read(p []byte) (n int, err error) {
+	if len(sc.pending) == 0 {
+		chunk, open := <-sc.inbound
+		if !open {
+			if sc.readErr == nil {
+				return 0, net.ErrClosed
+			}
+			return 0, sc.readErr
+		}
+		if !sc.wait(chunk.at) {
+			return 0, net.ErrClosed
+		}
+		sc.pending = chunk.data
+	}
+	n = copy(p, sc.pending)
+	sc.pending = sc.pending[n:]
+	return
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// wait sleeps until at, it returns false if the connection has been closed meanwhile.
+func (sc *simulatedConn) wait(at time.Time) bool {
+	delay := time.Until(at)
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-sc.closed:
+		return false
+	}
+}
+
+func (sc *simulatedConn) Close() (err error) {
+	err = net.ErrClosed
+	sc.closeOnce.Do(func() {
+		close(sc.closed)
+		err = sc.Conn.Close()
+	})
+	return
+}
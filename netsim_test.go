@@ -0,0 +1,34 @@
+package krs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNetworkConditions(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{
+		URL: server.URL(),
+		Network: &NetworkConditions{
+			UploadBandwidth: 10_000,
+			Latency:         200 * time.Millisecond,
+			Jitter:          20 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	pcm, err := client.Synthesize(context.Background(), "one two three")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 3*FrameSize {
+		t.Fatalf("got %d samples, expected %d", len(pcm), 3*FrameSize)
+	}
+	// handshake and end of stream round trips
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("synthesis took %s, the latency has not been applied", elapsed)
+	}
+}
@@ -0,0 +1,95 @@
+package krs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTTSOption is returned by STTClient.Connect() given an option only applying to the TTS
+// connections (WithVoice(), WithStyle(), WithEmotion(), WithStereo()).
+var ErrTTSOption = errors.New("option only applies to the TTS connections")
+
+// ConnectOption customizes a single connection, overriding the client configuration:
+//
+//	conn, err := client.Connect(ctx, krs.WithVoice("expresso/ex03-ex01_happy_001_channel1_334s.wav"), krs.WithRetry(krs.RetryPolicy{MaxAttempts: 4, Backoff: time.Second}))
+//
+// WithRetry only covers the handshake opening the connection: a websocket lost in the middle of
+// an STT stream is reconnected by STTConfig.Reconnect.
+type ConnectOption func(*connectOptions)
+
+type connectOptions struct {
+	// nil for the client voice
+	voice *string
+	// empty for the client wire format
+	format WireFormat
+	// nil for the client retry policy
+	retry   *RetryPolicy
+	style   Style
+	emotion Emotion
+	// nil for mono
+	stereo *stereoPan
+}
+
+// WithVoice synthesizes the connection with another voice than the client one, empty for the
+// server default voice (TTS only). The voice of a connection is set when it is opened, the
+// protocol has no way to change it afterwards: a Speaker switches voices between utterances with
+// SetVoice.
+func WithVoice(voice string) ConnectOption {
+	return func(o *connectOptions) {
+		o.voice = &voice
+	}
+}
+
+// WithFormat exchanges the frames of the connection in another wire format than the client one.
+func WithFormat(format WireFormat) ConnectOption {
+	return func(o *connectOptions) {
+		o.format = format
+	}
+}
+
+// WithReconnect retries the websocket handshake up to attempts more times, waiting backoff
+// between them, when the server can not be reached or fails (restarting, overloaded...). A
+// rejected API key or wire format is not retried. It is a constant backoff WithRetry().
+//
+// Deprecated: use WithRetry, WithReconnect does not reconnect a connection lost once opened
+// (see STTConfig.Reconnect for that).
+func WithReconnect(attempts int, backoff time.Duration) ConnectOption {
+	return WithRetry(RetryPolicy{
+		MaxAttempts: max(attempts, 0) + 1,
+		Backoff:     max(backoff, 0),
+	})
+}
+
+// WithRetry retries the websocket handshake of the connection according to policy instead of the
+// client one, RetryPolicy{} to fail on the first error.
+func WithRetry(policy RetryPolicy) ConnectOption {
+	return func(o *connectOptions) {
+		o.retry = &policy
+	}
+}
+
+func newConnectOptions(opts []ConnectOption) (o connectOptions) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+// validateSTT checks the options apply to a STT connection.
+func (o connectOptions) validateSTT() (err error) {
+	if o.voice != nil || o.style != "" || o.emotion != "" || o.stereo != nil {
+		return fmt.Errorf("failed to connect: %w", ErrTTSOption)
+	}
+	return
+}
+
+// codec returns the codec of the connection: the client one unless WithFormat() asks for another
+// format, keeping the base64 wrapping of the client.
+func (o connectOptions) codec(client codec) (c codec, err error) {
+	if o.format == "" || o.format == client.format() {
+		return client, nil
+	}
+	_, base64Frames := client.(base64Codec)
+	return newCodec(o.format, base64Frames)
+}
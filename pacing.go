@@ -0,0 +1,92 @@
+package krs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// speech duration of a word until the server synthesized some (150 words per minute)
+	pacingDefaultWordDuration = 400 * time.Millisecond
+	// words always sent ahead whatever the limit: the server needs a few words of context before
+	// synthesizing the first ones, waiting for their audio would stall the connection
+	pacingMinWords = 8
+)
+
+// textPacer holds the text of a TTS connection sent too far ahead of the synthesized audio
+// (TTSConfig.SendAhead). The speech duration of the words sent but not synthesized yet is
+// estimated with the speaking rate of the audio received so far. It is nil without limit.
+type textPacer struct {
+	limit   time.Duration
+	mutex   sync.Mutex
+	sent    int           // words written
+	echoed  int           // words the server started synthesizing (Text frames)
+	audio   time.Duration // audio received
+	changed chan struct{}
+}
+
+func newTextPacer(limit time.Duration) *textPacer {
+	if limit <= 0 {
+		return nil
+	}
+	return &textPacer{
+		limit:   limit,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// wait blocks until the text can be sent without going beyond the limit, it is called by the
+// writer only.
+func (tp *textPacer) wait(ctx context.Context, text string) (err error) {
+	if tp == nil {
+		return
+	}
+	words := len(strings.Fields(text))
+	for {
+		tp.mutex.Lock()
+		if pending := tp.sent - tp.echoed; pending < pacingMinWords || tp.ahead(pending) <= tp.limit {
+			tp.sent += words
+			tp.mutex.Unlock()
+			return
+		}
+		tp.mutex.Unlock()
+		select {
+		case <-tp.changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ahead estimates the speech duration of the pending words, the mutex must be held.
+func (tp *textPacer) ahead(pending int) time.Duration {
+	wordDuration := pacingDefaultWordDuration
+	if tp.echoed > pacingMinWords && tp.audio > 0 {
+		wordDuration = tp.audio / time.Duration(tp.echoed)
+	}
+	return time.Duration(pending) * wordDuration
+}
+
+// textEchoed is called by the reader for each Text frame: the server synthesizes the word.
+func (tp *textPacer) textEchoed() {
+	if tp == nil {
+		return
+	}
+	tp.mutex.Lock()
+	tp.echoed++
+	tp.mutex.Unlock()
+	notify(tp.changed)
+}
+
+// audioReceived is called by the reader with the duration of the audio received so far.
+func (tp *textPacer) audioReceived(received time.Duration) {
+	if tp == nil {
+		return
+	}
+	tp.mutex.Lock()
+	tp.audio = received
+	tp.mutex.Unlock()
+	notify(tp.changed)
+}
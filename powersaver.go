@@ -0,0 +1,23 @@
+package krs
+
+import (
+	"net"
+	"time"
+)
+
+// The power saver mode trades latency for fewer radio wake ups on battery devices (see
+// STTConfig.PowerSaver and TTSConfig.PowerSaver).
+const (
+	// STT audio frames batching when STTConfig.Coalesce is not set
+	powerSaverCoalesce = time.Second
+	// minimum time between two STT Step frames delivered, besides the ones ending an utterance
+	powerSaverStepInterval = time.Second
+)
+
+// TCP keepalives every few minutes instead of every 15s
+var powerSaverKeepAlive = net.KeepAliveConfig{
+	Enable:   true,
+	Idle:     3 * time.Minute,
+	Interval: time.Minute,
+	Count:    3,
+}
@@ -0,0 +1,63 @@
+package krs
+
+import (
+	"sync"
+	"time"
+)
+
+// PreRollBuffer is a ring buffer keeping the last samples of an audio stream (24kHz mono), for
+// example the microphone audio while waiting for a wake word or a voice activity detector: once
+// it triggers, the audio drained from the buffer is sent first so the beginning of the utterance is
+// not clipped. It is safe for concurrent use.
+type PreRollBuffer struct {
+	mutex   sync.Mutex
+	samples []float32
+	start   int // oldest sample
+	length  int
+}
+
+// NewPreRollBuffer returns a buffer keeping the last duration of audio.
+func NewPreRollBuffer(duration time.Duration) *PreRollBuffer {
+	return &PreRollBuffer{
+		samples: make([]float32, max(int((duration*SampleRate+time.Second/2)/time.Second), 1)),
+	}
+}
+
+// Write appends samples to the buffer, overwriting the oldest ones once it is full.
+func (prb *PreRollBuffer) Write(pcm []float32) {
+	prb.mutex.Lock()
+	defer prb.mutex.Unlock()
+	if len(pcm) >= len(prb.samples) {
+		copy(prb.samples, pcm[len(pcm)-len(prb.samples):])
+		prb.start, prb.length = 0, len(prb.samples)
+		return
+	}
+	for len(pcm) > 0 {
+		end := (prb.start + prb.length) % len(prb.samples)
+		n := copy(prb.samples[end:], pcm)
+		pcm = pcm[n:]
+		if overflow := prb.length + n - len(prb.samples); overflow > 0 {
+			prb.start = (prb.start + overflow) % len(prb.samples)
+			prb.length -= overflow
+		}
+		prb.length += n
+	}
+}
+
+// Duration returns the duration of the audio buffered.
+func (prb *PreRollBuffer) Duration() time.Duration {
+	prb.mutex.Lock()
+	defer prb.mutex.Unlock()
+	return time.Duration(prb.length) * time.Second / SampleRate
+}
+
+// Drain returns the buffered audio, oldest first, and empties the buffer.
+func (prb *PreRollBuffer) Drain() (pcm []float32) {
+	prb.mutex.Lock()
+	defer prb.mutex.Unlock()
+	pcm = make([]float32, prb.length)
+	n := copy(pcm, prb.samples[prb.start:min(prb.start+prb.length, len(prb.samples))])
+	copy(pcm[n:], prb.samples)
+	prb.start, prb.length = 0, 0
+	return
+}
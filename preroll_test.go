@@ -0,0 +1,29 @@
+package krs
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPreRollBuffer(t *testing.T) {
+	// 4 samples
+	buffer := NewPreRollBuffer(4 * time.Second / SampleRate)
+	buffer.Write([]float32{1, 2, 3})
+	buffer.Write([]float32{4, 5})
+	buffer.Write([]float32{6})
+	if duration := buffer.Duration(); duration != 4*time.Second/SampleRate {
+		t.Errorf("got %s buffered, expected 4 samples", duration)
+	}
+	if pcm := buffer.Drain(); !slices.Equal(pcm, []float32{3, 4, 5, 6}) {
+		t.Errorf("got %v, expected the last 4 samples", pcm)
+	}
+	if pcm := buffer.Drain(); len(pcm) != 0 {
+		t.Errorf("got %v after a drain, expected nothing", pcm)
+	}
+	buffer.Write([]float32{1, 2, 3, 4, 5, 6, 7})
+	buffer.Write([]float32{8})
+	if pcm := buffer.Drain(); !slices.Equal(pcm, []float32{5, 6, 7, 8}) {
+		t.Errorf("got %v, expected the last 4 samples", pcm)
+	}
+}
@@ -0,0 +1,44 @@
+package krs
+
+// ReadPolicy is what the STT reader does when the consumer of the read channel does not keep up.
+type ReadPolicy int
+
+const (
+	// ReadBlock waits for the consumer: a stalled consumer stops the reading of the websocket, the
+	// server then stops processing the audio and the writes eventually time out
+	ReadBlock ReadPolicy = iota
+	// ReadBuffered buffers up to STTConfig.ReadBuffer messages, then waits for the consumer
+	ReadBuffered
+	// ReadDropSteps buffers up to STTConfig.ReadBuffer messages, then drops the Step frames until the
+	// consumer catches up. The words, markers and the end of the stream are never dropped: they wait
+	// for the consumer.
+	ReadDropSteps
+)
+
+// defaultReadBuffer is about 5 seconds of Step frames
+const defaultReadBuffer = 64
+
+// readBuffer returns the capacity of the read channel for a policy.
+func readBuffer(policy ReadPolicy, size int) int {
+	if policy == ReadBlock {
+		return 0
+	}
+	if size <= 0 {
+		return defaultReadBuffer
+	}
+	return size
+}
+
+// deliverStep hands over a Step frame to the user, dropping it if the policy allows it and the
+// read channel is full.
+func (sttc *STTConnection) deliverStep(msg MessagePackStep) (err error) {
+	if sttc.readPolicy != ReadDropSteps {
+		return sttc.deliver(msg)
+	}
+	select {
+	case sttc.readerChan <- msg:
+	default:
+		sttc.stats.stepDropped()
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package krs
+
+import "sync"
+
+// ReadyInfo is the metadata the server sent in its Ready frame. The known fields are zero when the
+// server does not include them: keep the library constants (SampleRate for example) as fallback.
+type ReadyInfo struct {
+	Model      string
+	Voice      string
+	SampleRate int
+	MaxBatch   int
+	// Fields contains all the fields of the frame as decoded, including the ones not listed above
+	Fields map[string]any
+}
+
+func parseReady(c codec, payload []byte) (info ReadyInfo, err error) {
+	var ready MessagePackReady
+	if err = c.unmarshal(payload, &ready); err != nil {
+		return
+	}
+	info = ReadyInfo{
+		Model:      ready.Model,
+		Voice:      ready.Voice,
+		SampleRate: ready.SampleRate,
+		MaxBatch:   ready.MaxBatch,
+	}
+	raw, err := c.decode(payload)
+	if err != nil {
+		return
+	}
+	info.Fields, _ = raw.(map[string]any)
+	return
+}
+
+// readyState holds the Ready frame of a connection.
+type readyState struct {
+	mutex    sync.Mutex
+	info     ReadyInfo
+	received bool
+}
+
+func (rs *readyState) set(info ReadyInfo) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.info = info
+	rs.received = true
+}
+
+func (rs *readyState) get() (info ReadyInfo, received bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.info, rs.received
+}
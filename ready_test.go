@@ -0,0 +1,34 @@
+package krs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReadyInfo(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), Voice: "expresso/test.wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(conn.GetWriteChan())
+	if msg := <-conn.GetReadChan(); msg.MessageType() != MessagePackTypeReady {
+		t.Fatalf("unexpected first message: %s", msg.MessageType())
+	}
+	info, received := conn.ReadyInfo()
+	if !received {
+		t.Fatal("the ready info is not available after the Ready frame")
+	}
+	if info.Voice != "expresso/test.wav" || info.SampleRate != SampleRate || info.Fields["voice"] != info.Voice {
+		t.Errorf("unexpected ready info: %+v", info)
+	}
+	for range conn.GetReadChan() {
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package krs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultRealtimeTolerance = 2 * time.Second
+
+// ErrBehindRealtime is returned by Done() when a RealtimeGuard with Fail set stopped the connection.
+var ErrBehindRealtime = errors.New("the server is behind real time")
+
+// RealtimeGuard reports a connection whose server falls behind real time, before the users notice
+// stutter: the STT server processing the audio slower than it is streamed or the TTS server
+// producing audio slower than it is played. For TTS, a text input slower than speech (a LLM
+// output for example) is reported as well.
+type RealtimeGuard struct {
+	// Tolerance is how long the realtime factor can stay below 1 before being reported (default 2s)
+	Tolerance time.Duration
+	// OnSlow, if set, is called from the reader goroutine with the realtime factor measured over
+	// the tolerance window. It is called again only after the connection caught up.
+	OnSlow func(factor float64)
+	// Fail stops the connection with ErrBehindRealtime once OnSlow has been called
+	Fail bool
+}
+
+type realtimePoint struct {
+	at    time.Time
+	audio time.Duration
+}
+
+// realtimeMonitor measures the realtime factor of a connection over a sliding window. It is only
+// used by the reader goroutine.
+type realtimeMonitor struct {
+	guard    *RealtimeGuard
+	window   time.Duration
+	points   []realtimePoint
+	reported bool
+}
+
+func newRealtimeMonitor(guard *RealtimeGuard) *realtimeMonitor {
+	if guard == nil {
+		return nil
+	}
+	monitor := &realtimeMonitor{
+		guard:  guard,
+		window: guard.Tolerance,
+	}
+	if monitor.window <= 0 {
+		monitor.window = defaultRealtimeTolerance
+	}
+	return monitor
+}
+
+// update records the total audio received (or processed) at a given time. starved tells that the
+// server had no input to work on, which does not count as being slow.
+func (rm *realtimeMonitor) update(at time.Time, audio time.Duration, starved bool) (err error) {
+	if rm == nil {
+		return
+	}
+	rm.points = append(rm.points, realtimePoint{at: at, audio: audio})
+	// keep a single point older than the window as its start
+	for len(rm.points) > 1 && at.Sub(rm.points[1].at) >= rm.window {
+		rm.points = rm.points[1:]
+	}
+	start := rm.points[0]
+	if elapsed := at.Sub(start.at); elapsed >= rm.window && !starved {
+		factor := float64(audio-start.audio) / float64(elapsed)
+		switch {
+		case factor >= 1:
+			rm.reported = false
+		case !rm.reported:
+			rm.reported = true
+			if rm.guard.OnSlow != nil {
+				rm.guard.OnSlow(factor)
+			}
+			if rm.guard.Fail {
+				return fmt.Errorf("%w: realtime factor %.2f over the last %s", ErrBehindRealtime, factor, elapsed.Round(time.Millisecond))
+			}
+		}
+	}
+	return
+}
+
+// audioReceived records the total audio received (TTS) or processed (STT) so far.
+func (cs *connStats) audioReceived(audio time.Duration, at time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if cs.firstAudio.IsZero() {
+		cs.firstAudio = at
+	}
+	cs.stats.AudioReceived = audio
+	cs.stats.AudioWallClock = at.Sub(cs.firstAudio)
+}
+
+// RealtimeFactor returns the audio received (TTS) or processed (STT) per second of wall clock, a
+// server keeping up with real time has a factor of at least 1.
+func (s Stats) RealtimeFactor() float64 {
+	if s.AudioWallClock <= 0 {
+		return 0
+	}
+	return float64(s.AudioReceived) / float64(s.AudioWallClock)
+}
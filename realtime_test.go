@@ -0,0 +1,73 @@
+package krs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRealtimeMonitor(t *testing.T) {
+	var reports []float64
+	monitor := newRealtimeMonitor(&RealtimeGuard{
+		Tolerance: time.Second,
+		OnSlow:    func(factor float64) { reports = append(reports, factor) },
+	})
+	start := time.Now()
+	step := 100 * time.Millisecond
+	var audio time.Duration
+	// real time: nothing to report
+	for i := range 20 {
+		audio += step
+		if err := monitor.update(start.Add(time.Duration(i)*step), audio, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// half real time, but starved: nothing to report
+	at := start.Add(20 * step)
+	for range 20 {
+		at = at.Add(step)
+		audio += step / 2
+		if err := monitor.update(at, audio, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reports) != 0 {
+		t.Fatalf("unexpected reports: %v", reports)
+	}
+	// half real time: reported once
+	for range 20 {
+		at = at.Add(step)
+		audio += step / 2
+		if err := monitor.update(at, audio, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reports) != 1 || reports[0] != 0.5 {
+		t.Fatalf("expected a single report with factor 0.5, got %v", reports)
+	}
+	// caught up then slow again: reported again, failing this time
+	monitor.guard.Fail = true
+	for range 20 {
+		at = at.Add(step)
+		audio += step
+		if err := monitor.update(at, audio, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var err error
+	for i := 0; i < 20 && err == nil; i++ {
+		at = at.Add(step)
+		audio += step / 4
+		err = monitor.update(at, audio, false)
+	}
+	if !errors.Is(err, ErrBehindRealtime) {
+		t.Errorf("expected ErrBehindRealtime, got %v", err)
+	}
+	if len(reports) != 2 {
+		t.Errorf("expected 2 reports, got %v", reports)
+	}
+	// no guard, no monitor
+	if err = newRealtimeMonitor(nil).update(at, audio, false); err != nil {
+		t.Error(err)
+	}
+}
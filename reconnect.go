@@ -0,0 +1,225 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// DefaultReconnectReplay is the audio sent again after a reconnection without
+// STTConfig.ReconnectReplay: longer than the delay of the models, so that the words of the audio
+// the lost server did not transcribe yet are not lost.
+const DefaultReconnectReplay = 5 * time.Second
+
+// sttSession is a websocket connection of an STTConnection: a connection streams on a single
+// session, unless it reconnects after losing one (see STTConfig.Reconnect).
+type sttSession struct {
+	conn *websocket.Conn
+	// the writer and the reader of the session, ctx is done once one of them fails
+	workers *workerGroup
+	ctx     context.Context
+	// the writer side stops once the server is done
+	inputCtx  context.Context
+	stopInput context.CancelFunc
+	flushChan chan any
+	// offset is the stream position of the first audio sent on the session, in samples: the times
+	// of the server are shifted by it
+	offset int
+	// sent again before anything else after a reconnection
+	replay  []float32
+	markers []int64
+	// reconnected sessions drop the words and steps already delivered by the previous ones
+	reconnected bool
+	// progressed is set by the reader once the server went further than the previous sessions
+	progressed bool
+}
+
+func (sttc *STTConnection) newSession(conn *websocket.Conn) (session *sttSession) {
+	session = &sttSession{
+		conn:      conn,
+		flushChan: make(chan any),
+	}
+	session.workers, session.ctx = newWorkerGroup(sttc.workersCtx)
+	session.inputCtx, session.stopInput = context.WithCancel(session.ctx)
+	return
+}
+
+// abort fails the session, the frame timeouts stopping a stuck websocket.
+func (session *sttSession) abort(cause error) {
+	session.workers.cancel(cause)
+}
+
+// shift returns the offset of the session in seconds, the unit of the server times.
+func (session *sttSession) shift() float64 {
+	return float64(session.offset) / SampleRate
+}
+
+// sessionLostError is a websocket failing in the middle of a session: the network, a frame
+// timeout or the server going away. It is what a reconnection can recover from, unlike the
+// protocol errors.
+type sessionLostError struct {
+	err error
+}
+
+func (sle *sessionLostError) Error() string {
+	return sle.err.Error()
+}
+
+func (sle *sessionLostError) Unwrap() error {
+	return sle.err
+}
+
+// stream runs the writer and the reader of the connection on its session. With a reconnect policy,
+// a lost session is replaced by a new one on which the audio kept for replay is sent again.
+func (sttc *STTConnection) stream() (err error) {
+	// once the server is done, the framer has nothing left to do
+	defer sttc.stopInput()
+	var failures int
+	for {
+		session := sttc.session
+		session.workers.Go(recovered(sttc.writer))
+		session.workers.Go(recovered(sttc.reader))
+		go sttc.stats.measureRTT(session.ctx, session.conn)
+		if err = timeoutCause(session.ctx, session.workers.Wait()); err == nil {
+			return
+		}
+		// a frame timeout aborting the session replaces the error of the reader, it is a loss too
+		var (
+			lost    *sessionLostError
+			timeout *TimeoutError
+		)
+		if sttc.reconnect == nil || sttc.workersCtx.Err() != nil || !(errors.As(err, &lost) || errors.As(err, &timeout)) {
+			return
+		}
+		_ = session.conn.CloseNow()
+		if session.progressed {
+			failures = 0
+		}
+		if err = sttc.reconnectSession(&failures, err); err != nil {
+			return
+		}
+	}
+}
+
+// reconnectSession dials the server again, waiting between the attempts according to the
+// reconnect policy, and prepares the new session with the audio and markers to send again.
+func (sttc *STTConnection) reconnectSession(failures *int, lost error) (err error) {
+	cause := lost
+	for {
+		*failures++
+		if !sttc.reconnect.Retry(*failures, cause) || !sleep(sttc.workersCtx, sttc.reconnect.Delay(*failures)) {
+			if cause == lost {
+				return lost
+			}
+			return fmt.Errorf("failed to reconnect: %w", cause)
+		}
+		var conn *websocket.Conn
+		if conn, cause = sttc.redial(sttc.workersCtx); cause == nil {
+			session := sttc.newSession(conn)
+			session.replay, session.offset, session.markers = sttc.replay.take()
+			session.reconnected = true
+			// the new server starts streaming, whatever the lost one asked for
+			sttc.flow.resume()
+			sttc.stats.reconnected()
+			sttc.session = session
+			return
+		}
+	}
+}
+
+// replayLog keeps what the writer handed to the sessions of a connection, to send it again after
+// a reconnection: the last audio and the markers the server did not send back yet.
+type replayLog struct {
+	audio *PreRollBuffer
+	// position is the user audio sent, in samples
+	position int
+	mutex    sync.Mutex
+	markers  []int64
+}
+
+// newReplayLog returns a log keeping the last duration of audio, in complete frames.
+func newReplayLog(duration time.Duration) *replayLog {
+	frames := max((duration+FrameDuration-1)/FrameDuration, 1)
+	return &replayLog{audio: NewPreRollBuffer(frames * FrameDuration)}
+}
+
+// sent records a message handed to a session, before it is written: a message failing with the
+// websocket is sent again. It does nothing without reconnect policy.
+func (rl *replayLog) sent(msg outgoingMessage) {
+	if rl == nil {
+		return
+	}
+	switch typed := msg.(type) {
+	case *MessagePackAudio:
+		rl.sentAudio(typed.PCM)
+	case *MessagePackMarker:
+		rl.mutex.Lock()
+		rl.markers = append(rl.markers, typed.ID)
+		rl.mutex.Unlock()
+	}
+}
+
+// sentAudio records user audio handed to a session.
+func (rl *replayLog) sentAudio(pcm []float32) {
+	if rl == nil {
+		return
+	}
+	rl.audio.Write(pcm)
+	rl.position += len(pcm)
+}
+
+// echoed forgets a marker the server sent back, and the ones before it.
+func (rl *replayLog) echoed(id int64) {
+	if rl == nil {
+		return
+	}
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if index := slices.Index(rl.markers, id); index >= 0 {
+		rl.markers = slices.Delete(rl.markers, 0, index+1)
+	}
+}
+
+// take returns what to send again on a new session, with the stream position of the audio. The
+// audio is kept for a later reconnection.
+func (rl *replayLog) take() (pcm []float32, offset int, markers []int64) {
+	pcm = rl.audio.Drain()
+	rl.audio.Write(pcm)
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return pcm, rl.position - len(pcm), slices.Clone(rl.markers)
+}
+
+// resend sends again, first thing on a reconnected session, the audio and the markers the lost
+// session may not have processed. The audio starts with the second of silence of every stream.
+func (sttc *STTConnection) resend(session *sttSession) (started bool, err error) {
+	if len(session.replay) > 0 {
+		if err = sttc.send(&MessagePackAudio{
+			Type: MessagePackTypeAudio,
+			PCM:  oneSecondOfSilence,
+		}, time.Now()); err != nil {
+			err = fmt.Errorf("failed to send message: %w", err)
+			return
+		}
+		started = true
+		// in messages of a reasonable size, the audio stats already accounted for it
+		for pcm := range slices.Chunk(session.replay, MaxCoalescedFrames*FrameSize) {
+			if _, err = sttc.write(&MessagePackAudio{Type: MessagePackTypeAudio, PCM: pcm}, time.Now()); err != nil {
+				err = fmt.Errorf("failed to send message: %w", err)
+				return
+			}
+		}
+	}
+	for _, id := range session.markers {
+		if _, err = sttc.write(&MessagePackMarker{Type: MessagePackTypeMarker, ID: id}, time.Now()); err != nil {
+			err = fmt.Errorf("failed to send message: %w", err)
+			return
+		}
+	}
+	return
+}
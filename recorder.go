@@ -0,0 +1,172 @@
+package krs
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionUserChannel is the channel of the user audio in the bundles of a SessionRecorder
+	SessionUserChannel = 0
+	// SessionAssistantChannel is the channel of the assistant audio
+	SessionAssistantChannel = 1
+	// a channel behind the session clock by more than this is padded with silence
+	recorderSlack = FrameDuration
+)
+
+// SessionRecorder records a duplex voice session (a user talking with a voice assistant) into a
+// Bundle: the audio of both sides on their own channel, the transcript of the user and the events
+// of the session. The audio of each side is placed on the session clock: a side not written for a
+// while (the assistant waiting for its turn) is padded with silence. It is safe for concurrent use.
+type SessionRecorder struct {
+	mutex      sync.Mutex
+	start      time.Time
+	tags       Tags
+	audio      [2][]float32
+	transcript Transcript
+	events     []BundleEvent
+}
+
+// NewSessionRecorder starts recording a session, its clock starts now.
+func NewSessionRecorder(tags Tags) *SessionRecorder {
+	return &SessionRecorder{
+		start: time.Now(),
+		tags:  maps.Clone(tags),
+	}
+}
+
+// UserSink returns the sink recording the audio of the user, typically the audio sent to the STT
+// connection.
+func (sr *SessionRecorder) UserSink() AudioSink {
+	return recorderSink{recorder: sr, channel: SessionUserChannel}
+}
+
+// AssistantSink returns the sink recording the audio of the assistant, typically written along
+// the playback (see MultiSink).
+func (sr *SessionRecorder) AssistantSink() AudioSink {
+	return recorderSink{recorder: sr, channel: SessionAssistantChannel}
+}
+
+// Observe records a message of the STT read channel: the words build the transcript and are
+// recorded as events along with the markers, the Step frames only end the utterances.
+func (sr *SessionRecorder) Observe(msg MessagePack) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	switch typed := msg.(type) {
+	case MessagePackWord:
+		sr.transcript.AddWord(Word{Text: typed.Text, Start: typed.StartTimeDuration()})
+	case MessagePackWordEnd:
+		sr.transcript.SetWordEnd(typed.StopTimeDuration())
+	case MessagePackStep:
+		if typed.PausePrediction() > defaultPauseThreshold {
+			sr.transcript.EndUtterance()
+		}
+		return
+	case MessagePackMarker:
+	default:
+		return
+	}
+	_ = sr.event(string(msg.MessageType()), msg)
+}
+
+// Event records an application event (an LLM request, a barge-in...), data being encoded as JSON.
+func (sr *SessionRecorder) Event(kind string, data any) (err error) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return sr.event(kind, data)
+}
+
+// event must be called with the mutex held.
+func (sr *SessionRecorder) event(kind string, data any) (err error) {
+	event := BundleEvent{
+		At:   time.Since(sr.start),
+		Type: kind,
+	}
+	if data != nil {
+		if event.Data, err = json.Marshal(data); err != nil {
+			return fmt.Errorf("failed to encode the event data: %w", err)
+		}
+	}
+	sr.events = append(sr.events, event)
+	return
+}
+
+// Bundle returns the session recorded so far, both channels having the same length. The transcript
+// times are the ones of the STT stream, which starts with STTStreamOffset of silence.
+func (sr *SessionRecorder) Bundle() (b Bundle) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	length := max(len(sr.audio[SessionUserChannel]), len(sr.audio[SessionAssistantChannel]))
+	channels := make([][]float32, len(sr.audio))
+	for i, pcm := range sr.audio {
+		channels[i] = make([]float32, length)
+		copy(channels[i], pcm)
+	}
+	transcript := sr.transcript
+	transcript.Tags = maps.Clone(sr.tags)
+	transcript.Utterances = make([]Utterance, len(sr.transcript.Utterances))
+	for i, utterance := range sr.transcript.Utterances {
+		transcript.Utterances[i] = Utterance{Words: append([]Word{}, utterance.Words...), Labels: utterance.Labels}
+	}
+	return Bundle{
+		Metadata: BundleMetadata{
+			Created:          sr.start,
+			Channels:         len(channels),
+			TranscriptOffset: STTStreamOffset,
+			Tags:             maps.Clone(sr.tags),
+		},
+		Transcript: transcript,
+		Events:     append([]BundleEvent{}, sr.events...),
+		Audio:      Interleave(nil, channels...),
+	}
+}
+
+// write records the audio of a side, placed on the session clock.
+func (sr *SessionRecorder) write(channel int, pcm []float32) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	// a channel behind the clock was not written meanwhile: the side was silent
+	if behind := durationSamples(time.Since(sr.start)) - durationSamples(recorderSlack) - len(sr.audio[channel]); behind > 0 {
+		sr.audio[channel] = append(sr.audio[channel], make([]float32, behind)...)
+	}
+	sr.audio[channel] = append(sr.audio[channel], pcm...)
+}
+
+type recorderSink struct {
+	recorder *SessionRecorder
+	channel  int
+}
+
+func (rs recorderSink) WritePCM(pcm []float32) error {
+	rs.recorder.write(rs.channel, pcm)
+	return nil
+}
+
+// Discard can not take back the audio recorded: it was played (or sent) already.
+func (rs recorderSink) Discard() {}
+
+// MultiSink returns a sink writing the audio to all the sinks in order, for example to play the
+// audio and record it. It stops at the first error.
+func MultiSink(sinks ...AudioSink) AudioSink {
+	return multiSink(append([]AudioSink{}, sinks...))
+}
+
+type multiSink []AudioSink
+
+func (ms multiSink) WritePCM(pcm []float32) (err error) {
+	for _, sink := range ms {
+		if err = sink.WritePCM(pcm); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (ms multiSink) Discard() {
+	for _, sink := range ms {
+		sink.Discard()
+	}
+}
@@ -0,0 +1,31 @@
+package krs
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestMultiSink(t *testing.T) {
+	first, failing, last := &recordSink{}, &recordSink{}, &recordSink{}
+	sink := MultiSink(first, failing, last)
+	if err := sink.WritePCM([]float32{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	// the writes stop at the first error, which is returned
+	failing.err = io.ErrClosedPipe
+	if err := sink.WritePCM([]float32{3}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("got %v, expected the error of the failing sink", err)
+	}
+	if !slices.Equal(first.pcm, []float32{1, 2, 3}) || !slices.Equal(last.pcm, []float32{1, 2}) {
+		t.Errorf("the sinks received %v and %v, expected the samples up to the failing sink", first.pcm, last.pcm)
+	}
+	// the discards reach every sink
+	sink.Discard()
+	for i, recorded := range []*recordSink{first, failing, last} {
+		if recorded.discarded != 1 {
+			t.Errorf("sink %d discarded %d times", i, recorded.discarded)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package krs
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// audio redacted before and after the words, the boundaries of the words are approximate
+	redactionMargin = 50 * time.Millisecond
+	// duration redacted for a word without end time followed by nothing
+	redactionDefaultWord = 500 * time.Millisecond
+	// frequency of the bleep replacing the redacted audio
+	redactionBleep = 1000
+)
+
+// RedactionRule matches the personal information to redact in the text of the utterances (the
+// words joined by spaces). The words overlapping a match are redacted.
+type RedactionRule struct {
+	// Name replaces the redacted words in the transcript, as [Name]
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultRedactionRules match the email addresses and the numbers of 7 digits or more (phone,
+// card, account...), written or spelled out in English as the speech to text transcribes them.
+var DefaultRedactionRules = []RedactionRule{
+	{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`(?i)\S+@\S+\.\w+|\b\w+ at \w+(?: dot \w+)+\b`),
+	},
+	{
+		Name:    "number",
+		Pattern: regexp.MustCompile(`(?i)(?:\b(?:\d|zero|oh|one|two|three|four|five|six|seven|eight|nine)\b[\s.-]*){7,}`),
+	},
+}
+
+// WordsRedactionRule returns a rule matching words (names, addresses...), case insensitive.
+func WordsRedactionRule(name string, words ...string) RedactionRule {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return RedactionRule{
+		Name:    name,
+		Pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`),
+	}
+}
+
+// Redaction is a range of the transcript matched by a rule.
+type Redaction struct {
+	Rule string
+	// Text is the redacted text
+	Text       string
+	Start, End time.Duration
+}
+
+// Redact returns the transcript with the words matched by the rules replaced by the name of the
+// rule (a single [Name] word spanning their time), and the redacted ranges to silence in the audio
+// with RedactAudio.
+func (t Transcript) Redact(rules []RedactionRule) (redacted Transcript, redactions []Redaction) {
+	redacted.Tags = t.Tags
+	redacted.Utterances = make([]Utterance, len(t.Utterances))
+	for i, utterance := range t.Utterances {
+		redacted.Utterances[i].Labels = utterance.Labels
+		// rule matching each word, the first rule wins
+		matched := make([]string, len(utterance.Words))
+		text, offsets := joinWords(utterance.Words)
+		for _, rule := range rules {
+			for _, match := range rule.Pattern.FindAllStringIndex(text, -1) {
+				for w, offset := range offsets {
+					end := offset + len(utterance.Words[w].Text)
+					if matched[w] == "" && offset < match[1] && end > match[0] {
+						matched[w] = rule.Name
+					}
+				}
+			}
+		}
+		// replace the runs of words matched by the same rule
+		for w := 0; w < len(utterance.Words); {
+			if matched[w] == "" {
+				redacted.Utterances[i].Words = append(redacted.Utterances[i].Words, utterance.Words[w])
+				w++
+				continue
+			}
+			last := w
+			for last+1 < len(utterance.Words) && matched[last+1] == matched[w] {
+				last++
+			}
+			run := utterance.Words[w : last+1]
+			redaction := Redaction{
+				Rule:  matched[w],
+				Text:  Utterance{Words: run}.Text(),
+				Start: run[0].Start,
+				End:   redactedWordEnd(utterance.Words, last),
+			}
+			redactions = append(redactions, redaction)
+			redacted.Utterances[i].Words = append(redacted.Utterances[i].Words, Word{
+				Text:  "[" + redaction.Rule + "]",
+				Start: redaction.Start,
+				End:   run[len(run)-1].End,
+			})
+			w = last + 1
+		}
+	}
+	return
+}
+
+// joinWords joins the words with spaces, returning the offset of each word in the text.
+func joinWords(words []Word) (text string, offsets []int) {
+	var b strings.Builder
+	offsets = make([]int, len(words))
+	for i, word := range words {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		offsets[i] = b.Len()
+		b.WriteString(word.Text)
+	}
+	return b.String(), offsets
+}
+
+// redactedWordEnd returns the end of a word, bounded by the start of the next one when the server
+// did not report it.
+func redactedWordEnd(words []Word, index int) time.Duration {
+	if end := words[index].End; end > words[index].Start {
+		return end
+	}
+	if index+1 < len(words) {
+		return words[index+1].Start
+	}
+	return words[index].Start + redactionDefaultWord
+}
+
+// RedactAudio returns a copy of the audio (24kHz mono) with the redacted ranges silenced, or
+// replaced by a bleep. offset is the time of the start of the audio in the transcript: the speech
+// to text stream starts with STTStreamOffset of silence.
+func RedactAudio(pcm []float32, redactions []Redaction, offset time.Duration, bleep bool) (redacted []float32) {
+	redacted = slices.Clone(pcm)
+	for _, redaction := range redactions {
+		start := min(durationSamples(redaction.Start-offset-redactionMargin), len(redacted))
+		end := min(durationSamples(redaction.End-offset+redactionMargin), len(redacted))
+		if start >= end {
+			continue
+		}
+		if !bleep {
+			clear(redacted[start:end])
+			continue
+		}
+		tone := Tone(redactionBleep, time.Duration(end-start)*time.Second/SampleRate, DefaultToneAmplitude)
+		copy(redacted[start:end], tone)
+		clear(redacted[start+len(tone) : end])
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package krs
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedact(t *testing.T) {
+	var transcript Transcript
+	words := "call me at five five five one two three four or mail bob at example dot com thanks Alice"
+	for i, text := range strings.Fields(words) {
+		start := STTStreamOffset + time.Duration(i)*200*time.Millisecond
+		transcript.AddWord(Word{Text: text, Start: start, End: start + 150*time.Millisecond})
+	}
+	rules := append(slices.Clone(DefaultRedactionRules), WordsRedactionRule("name", "alice"))
+	redacted, redactions := transcript.Redact(rules)
+	if text := redacted.Text(); text != "call me at [number] or mail [email] thanks [name]" {
+		t.Errorf("got %q", text)
+	}
+	if len(redactions) != 3 || redactions[0].Text != "five five five one two three four" {
+		t.Fatalf("got redactions %+v", redactions)
+	}
+	// the words of the redacted number: from the 4th to the 10th
+	number := redactions[0]
+	if number.Start != STTStreamOffset+600*time.Millisecond || number.End != STTStreamOffset+1950*time.Millisecond {
+		t.Errorf("number redacted from %s to %s", number.Start, number.End)
+	}
+	pcm := make([]float32, durationSamples(4*time.Second))
+	for i := range pcm {
+		pcm[i] = 0.5
+	}
+	silenced := RedactAudio(pcm, redactions, STTStreamOffset, false)
+	inside := durationSamples(time.Second)
+	outside := durationSamples(400 * time.Millisecond)
+	if silenced[inside] != 0 || silenced[outside] != 0.5 || pcm[inside] != 0.5 {
+		t.Errorf("got %f inside and %f outside the redaction, expected 0 and 0.5", silenced[inside], silenced[outside])
+	}
+	bleeped := RedactAudio(pcm, redactions, STTStreamOffset, true)
+	if bleeped[inside] == 0.5 || bleeped[outside] != 0.5 {
+		t.Error("redacted audio not replaced by the bleep")
+	}
+}
@@ -0,0 +1,158 @@
+package krs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryPolicy is the policy of the clients without STTConfig.Retry or TTSConfig.Retry: 4
+// attempts, 500ms then 1s then 2s apart (give or take 20%).
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	Backoff:     500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+}
+
+// RetryPolicy decides how a failed network operation is retried: connecting to the server
+// (STTConfig.Retry, TTSConfig.Retry or WithRetry()), reconnecting a Listener
+// (ListenerConfig.Retry) or querying a service (HTTPClassifier, HTTPTranslator). The zero value
+// does not retry.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, the first one included: 0 or 1 does not retry,
+	// negative retries until the context is done
+	MaxAttempts int
+	// Backoff is the delay before the first retry
+	Backoff time.Duration
+	// MaxBackoff, if set, caps the delays
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry (exponential backoff), 1 or less keeps it constant
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction of it (0.2 for ±20%), so that the clients
+	// disconnected together by a server restart do not come back all at once
+	Jitter float64
+	// Retryable tells the errors worth retrying (defaults to Retryable)
+	Retryable func(error) bool
+}
+
+// Retryable is the default classifier of RetryPolicy: the errors are worth retrying (server
+// unreachable, restarting or overloaded...) unless the request itself is rejected (API key, wire
+// format, voice, style) or the context is done.
+func Retryable(err error) bool {
+	var status httpStatusError
+	switch {
+	case err == nil,
+		errors.Is(err, ErrUnauthorized),
+		errors.Is(err, ErrFormatRejected),
+		errors.Is(err, ErrUnknownVoice),
+		errors.Is(err, ErrUnsupportedStyle),
+		errors.Is(err, ErrTTSOption),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &status):
+		return status.code >= 500 || status.code == 429
+	default:
+		return true
+	}
+}
+
+// Delay returns the delay before a retry, the first one being 1.
+func (rp RetryPolicy) Delay(retry int) (delay time.Duration) {
+	delay = rp.Backoff
+	for i := 1; i < retry && rp.Multiplier > 1; i++ {
+		delay = time.Duration(float64(delay) * rp.Multiplier)
+		if rp.MaxBackoff > 0 && delay >= rp.MaxBackoff {
+			break
+		}
+	}
+	if rp.MaxBackoff > 0 {
+		delay = min(delay, rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		delay += time.Duration((2*rand.Float64() - 1) * rp.Jitter * float64(delay))
+	}
+	return max(delay, 0)
+}
+
+// Retry tells whether a failed attempt (the first one being 1) is worth retrying.
+func (rp RetryPolicy) Retry(attempt int, err error) bool {
+	if rp.MaxAttempts >= 0 && attempt >= rp.MaxAttempts {
+		return false
+	}
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return Retryable(err)
+}
+
+// Do calls operation until it succeeds, the policy gives up or the context is done, returning the
+// last error.
+func (rp RetryPolicy) Do(ctx context.Context, operation func(ctx context.Context) error) (err error) {
+	for attempt := 1; ; attempt++ {
+		if err = operation(ctx); err == nil || !rp.Retry(attempt, err) || ctx.Err() != nil {
+			return
+		}
+		if !sleep(ctx, rp.Delay(attempt)) {
+			return
+		}
+	}
+}
+
+// sleep waits for a while, returning false if the context is done first.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// httpStatusError is a service answering an HTTP error, only the server errors (5xx) and the
+// rate limiting (429) are retried.
+type httpStatusError struct {
+	service string
+	code    int
+	message []byte
+}
+
+func (hse httpStatusError) Error() string {
+	return fmt.Sprintf("the %s answered HTTP %d: %s", hse.service, hse.code, hse.message)
+}
+
+// postJSON sends a JSON request to an HTTP service (with http.DefaultClient if client is nil), the
+// errors worth retrying being the network and server ones. The body of the response must be closed.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, service string, body []byte) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		err = fmt.Errorf("failed to create the %s request: %w", service, err)
+		return
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if resp, err = client.Do(req); err != nil {
+		err = fmt.Errorf("failed to query the %s: %w", service, err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, httpStatusError{service: service, code: resp.StatusCode, message: bytes.TrimSpace(message)}
+	}
+	return
+}
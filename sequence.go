@@ -0,0 +1,137 @@
+package krs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrReordered is returned by Sequencer.Next when a message goes back in time compared to the
+// previous message of the same type.
+var ErrReordered = errors.New("message received out of order")
+
+// Sequenced is a message of a read channel numbered by a Sequencer.
+type Sequenced struct {
+	// Seq increases by one with each message of the session, across connections
+	Seq uint64
+	// Connection is the number of the connection the message was received on, starting at 1
+	Connection int
+	// Offset is the session stream time of the message (see Sequencer)
+	Offset time.Duration
+	Msg    MessagePack
+}
+
+// Gap is a part of the session stream missing between two connections.
+type Gap struct {
+	// Seq is the sequence number of the first message after the gap
+	Seq        uint64
+	Connection int
+	From, To   time.Duration
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.To - g.From
+}
+
+// Sequencer numbers the messages read from the connections of a session and places them on a
+// single stream timeline, for consumers building precise timelines across reconnections. The
+// session stream times match the stream times of the first connection, the next connections go on
+// from where the previous one stopped.
+//
+// The offset of a message is its own time for the STT steps and words and the start of the frame
+// for the TTS audio, the other messages take the current position of the stream. A Sequencer is
+// not safe for concurrent use.
+type Sequencer struct {
+	streamOffset time.Duration
+	seq          uint64
+	connection   int
+	// session stream time of the start of the current connection
+	base time.Duration
+	// stream time reached on the current connection
+	position time.Duration
+	// latest offset per message type on the current connection
+	latest map[MessagePackType]time.Duration
+	gaps   []Gap
+}
+
+// NewSequencer returns a sequencer for connections whose stream starts at streamOffset:
+// STTStreamOffset for the STT connections (the silence sent before the audio is only counted
+// once), 0 for the TTS ones.
+func NewSequencer(streamOffset time.Duration) *Sequencer {
+	return &Sequencer{
+		streamOffset: streamOffset,
+		connection:   1,
+		latest:       make(map[MessagePackType]time.Duration),
+	}
+}
+
+// Next numbers a message of the current connection. ErrReordered is returned, along with the
+// numbered message, if the message goes back in time.
+func (s *Sequencer) Next(msg MessagePack) (sequenced Sequenced, err error) {
+	at := s.position
+	switch typed := msg.(type) {
+	case MessagePackStep:
+		at = time.Duration(typed.StepIndex) * FrameDuration
+		s.position = max(s.position, at+FrameDuration)
+	case MessagePackWord:
+		at = typed.StartTimeDuration()
+	case MessagePackWordEnd:
+		at = typed.StopTimeDuration()
+	case MessagePackAudio:
+		s.position += time.Duration(len(typed.PCM)) * time.Second / SampleRate
+	}
+	s.seq++
+	sequenced = Sequenced{
+		Seq:        s.seq,
+		Connection: s.connection,
+		Offset:     s.base + at,
+		Msg:        msg,
+	}
+	if latest, seen := s.latest[msg.MessageType()]; seen && at < latest {
+		err = fmt.Errorf("%w: %s #%d at %s, after %s", ErrReordered, msg.MessageType(), s.seq, at, latest)
+		return
+	}
+	s.latest[msg.MessageType()] = at
+	return
+}
+
+// Offset returns the session stream time of a stream time of the current connection, for example
+// to place the words of an utterance on the session timeline.
+func (s *Sequencer) Offset(at time.Duration) time.Duration {
+	return s.base + at
+}
+
+// Position returns the stream time reached on the current connection: the end of the last step
+// for the STT connections, the end of the audio received for the TTS ones.
+func (s *Sequencer) Position() time.Duration {
+	return s.position
+}
+
+// Reconnect starts the next connection of the session. end is the stream time at which the
+// previous connection stopped (Position() if unknown, the STT drain silence is not part of the
+// stream) and lost the audio missing between the two connections: not sent to the server or sent
+// but never processed. A gap is recorded, and returned, if lost is not zero.
+func (s *Sequencer) Reconnect(end, lost time.Duration) (gap Gap, lostAudio bool) {
+	from := s.base + end
+	s.base = from + max(lost, 0) - s.streamOffset
+	s.position = s.streamOffset
+	s.connection++
+	clear(s.latest)
+	if lost > 0 {
+		gap = Gap{
+			Seq:        s.seq + 1,
+			Connection: s.connection,
+			From:       from,
+			To:         from + lost,
+		}
+		s.gaps = append(s.gaps, gap)
+		lostAudio = true
+	}
+	return
+}
+
+// Gaps returns the gaps of the session so far.
+func (s *Sequencer) Gaps() []Gap {
+	return slices.Clone(s.gaps)
+}
@@ -0,0 +1,49 @@
+package krs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSequencer(t *testing.T) {
+	seq := NewSequencer(STTStreamOffset)
+	step := func(index int) MessagePackStep {
+		return MessagePackStep{Type: MessagePackTypeStep, StepIndex: index}
+	}
+	word := func(start float64) MessagePackWord {
+		return MessagePackWord{Type: MessagePackTypeWord, Text: "word", StartTime: start}
+	}
+	// first connection: 2s of stream (1s of silence and 1s of audio)
+	for index := range 25 {
+		if _, err := seq.Next(step(index)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := seq.Next(word(1.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Seq != 26 || first.Connection != 1 || first.Offset != 1500*time.Millisecond {
+		t.Errorf("got %+v for the first word, expected #26 of connection 1 at 1.5s", first)
+	}
+	if _, err = seq.Next(word(1.2)); !errors.Is(err, ErrReordered) {
+		t.Errorf("expected ErrReordered for a word going back in time, got %v", err)
+	}
+	// the connection failed after 3s of stream, 1s of it was not processed, 500ms were discarded
+	// while reconnecting
+	gap, lost := seq.Reconnect(seq.Position(), time.Second+500*time.Millisecond)
+	if !lost || gap.Seq != 28 || gap.Connection != 2 || gap.From != 2*time.Second || gap.To != 3500*time.Millisecond {
+		t.Errorf("got gap %+v, expected 2s to 3.5s before #28 on connection 2", gap)
+	}
+	second, err := seq.Next(word(1.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Seq != 28 || second.Connection != 2 || second.Offset != 4*time.Second {
+		t.Errorf("got %+v for the second word, expected #28 of connection 2 at 4s", second)
+	}
+	if gaps := seq.Gaps(); len(gaps) != 1 || gaps[0] != gap {
+		t.Errorf("got gaps %+v, expected the reconnection one", gaps)
+	}
+}
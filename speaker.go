@@ -0,0 +1,447 @@
+package krs
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var (
+	// ErrInterrupted is returned for an utterance cut off by a higher priority one
+	ErrInterrupted = errors.New("utterance interrupted by a higher priority one")
+	// ErrSpeakerClosed is returned for utterances still queued when the speaker is closed
+	ErrSpeakerClosed = errors.New("speaker is closed")
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityUrgent
+)
+
+// AudioSink is where a Speaker plays the synthesized audio, typically an audio output device.
+type AudioSink interface {
+	// WritePCM queues samples for playback, it can block to apply backpressure.
+	WritePCM(pcm []float32) error
+	// Discard drops any queued samples not played yet (and unblocks WritePCM if needed).
+	Discard()
+}
+
+// Speaker queues utterances and plays them one after the other on an AudioSink.
+// A TTS connection is always kept warm in advance to start each utterance as fast as possible.
+// An utterance with a higher priority than the one currently playing interrupts it.
+type Speaker struct {
+	client *TTSClient
+	sink   AudioSink
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	wakeup chan struct{}
+	warm   chan warmConnection
+	// protected by mutex
+	mutex   sync.Mutex
+	queue   utteranceQueue
+	current *utterance
+	seq     uint64
+	closed  bool
+	voice   string
+	// the voice changed while idle, the warm connection must be replaced
+	voiceChanged bool
+	speakingHook func(speaking bool)
+	// last state given to the speaking hook, only used by the run goroutine
+	speaking bool
+}
+
+func NewSpeaker(ctx context.Context, client *TTSClient, sink AudioSink) (speaker *Speaker) {
+	speaker = &Speaker{
+		client: client,
+		sink:   sink,
+		done:   make(chan struct{}),
+		wakeup: make(chan struct{}, 1),
+		voice:  client.voice,
+	}
+	speaker.ctx, speaker.cancel = context.WithCancel(ctx)
+	go speaker.run()
+	return
+}
+
+// Say queues text for playback. The returned channel yields the utterance outcome once it has
+// been fully played (nil), interrupted (ErrInterrupted) or has failed.
+func (s *Speaker) Say(text string, priority Priority) <-chan error {
+	return s.queueUtterance(&utterance{
+		text:     text,
+		priority: priority,
+		result:   make(chan error, 1),
+	})
+}
+
+// Play queues audio (24kHz mono, tones or DTMF for example) for playback between the utterances,
+// with the same priority rules as Say.
+func (s *Speaker) Play(pcm []float32, priority Priority) <-chan error {
+	return s.queueUtterance(&utterance{
+		pcm:      append([]float32{}, pcm...),
+		priority: priority,
+		result:   make(chan error, 1),
+	})
+}
+
+func (s *Speaker) queueUtterance(u *utterance) <-chan error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	u.voice = s.voice
+	if s.closed {
+		u.finish(ErrSpeakerClosed)
+		return u.result
+	}
+	s.seq++
+	u.seq = s.seq
+	heap.Push(&s.queue, u)
+	// Interrupt the current utterance if the new one is more important
+	if s.current != nil && u.priority > s.current.priority {
+		s.interrupt()
+	}
+	// Wake up the worker if it is idle
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+	return u.result
+}
+
+// SetVoice changes the voice of the utterances queued from now on, the ones already queued keep
+// theirs. The voice of a TTS connection can not change once opened: the warm connection is
+// replaced by one with the new voice. The voice is checked against the client VoiceGallery if
+// any.
+func (s *Speaker) SetVoice(ctx context.Context, voice string) (err error) {
+	if s.client.gallery != nil && voice != "" {
+		if err = s.client.gallery.Validate(ctx, voice); errors.Is(err, ErrUnknownVoice) {
+			return
+		}
+		err = nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if voice == s.voice {
+		return
+	}
+	s.voice = voice
+	s.voiceChanged = true
+	// let an idle worker warm up a connection with the new voice
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// OnSpeaking sets the hook called when the speaker starts playing (the first audio of an utterance
+// written to the sink) and when it stops (nothing left to play): drive a "speaking" LED or the
+// relay muting the microphone with it. The sink may still play the audio it buffered when the hook
+// reports the end. It is called from the speaker goroutine and must be quick.
+func (s *Speaker) OnSpeaking(hook func(speaking bool)) {
+	s.mutex.Lock()
+	s.speakingHook = hook
+	s.mutex.Unlock()
+}
+
+// setSpeaking calls the speaking hook if the state changed, from the run goroutine only.
+func (s *Speaker) setSpeaking(speaking bool) {
+	if speaking == s.speaking {
+		return
+	}
+	s.speaking = speaking
+	s.mutex.Lock()
+	hook := s.speakingHook
+	s.mutex.Unlock()
+	if hook != nil {
+		hook(speaking)
+	}
+}
+
+// write plays audio on the sink.
+func (s *Speaker) write(pcm []float32) error {
+	s.setSpeaking(true)
+	return s.sink.WritePCM(pcm)
+}
+
+// Interrupt stops the utterance currently playing (if any), the next one in queue starts right away.
+func (s *Speaker) Interrupt() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.current != nil {
+		s.interrupt()
+	}
+}
+
+// interrupt must be called with the mutex held and a current utterance.
+func (s *Speaker) interrupt() {
+	s.current.interrupted = true
+	if s.current.cancel != nil {
+		s.current.cancel()
+	}
+	s.sink.Discard()
+}
+
+// Close interrupts the current utterance, fails the queued ones and releases the warm connection.
+func (s *Speaker) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	if s.current != nil {
+		// unblocks a sink applying backpressure
+		s.interrupt()
+	}
+	s.mutex.Unlock()
+	s.cancel()
+	<-s.done
+	// Fail any leftovers
+	s.mutex.Lock()
+	for s.queue.Len() > 0 {
+		heap.Pop(&s.queue).(*utterance).finish(ErrSpeakerClosed)
+	}
+	s.mutex.Unlock()
+}
+
+func (s *Speaker) run() {
+	defer close(s.done)
+	s.prepare(s.voice)
+	for {
+		u := s.next()
+		if u == nil {
+			// speaker closed, release the warm connection
+			s.setSpeaking(false)
+			s.release(<-s.warm)
+			return
+		}
+		u.finish(s.speak(u))
+	}
+}
+
+// next blocks until an utterance is available and marks it as the current one.
+func (s *Speaker) next() *utterance {
+	for {
+		s.mutex.Lock()
+		if s.queue.Len() > 0 && s.ctx.Err() == nil {
+			s.current = heap.Pop(&s.queue).(*utterance)
+			s.mutex.Unlock()
+			return s.current
+		}
+		voice, rewarm := s.voice, s.voiceChanged
+		s.voiceChanged = false
+		s.mutex.Unlock()
+		// nothing left to play
+		s.setSpeaking(false)
+		if rewarm {
+			if w := <-s.warm; w.voice != voice {
+				s.release(w)
+				s.prepare(voice)
+			} else {
+				s.warm <- w
+			}
+		}
+		select {
+		case <-s.wakeup:
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *Speaker) speak(u *utterance) (err error) {
+	defer func() {
+		s.mutex.Lock()
+		if u.interrupted {
+			err = ErrInterrupted
+		}
+		s.current = nil
+		s.mutex.Unlock()
+	}()
+	if u.pcm != nil {
+		return s.play(u)
+	}
+	text := s.client.normalize(u.text)
+	var key string
+	if s.client.cache != nil {
+		key = s.client.synthesisKey(u.voice, connectOptions{}, text)
+		if u.pcm, _ = s.client.cache.Get(key); u.pcm != nil {
+			return s.play(u)
+		}
+	}
+	// Get the warm connection
+	w := s.takeConnection(u.voice)
+	if w.err != nil {
+		err = fmt.Errorf("failed to connect: %w", w.err)
+		return
+	}
+	defer w.cancel()
+	s.mutex.Lock()
+	u.cancel = w.cancel
+	if u.interrupted {
+		w.cancel()
+	}
+	s.mutex.Unlock()
+	// Send the text and play the audio as it comes
+	connCtx := w.conn.GetContext()
+	go streamWords(connCtx, w.conn.GetWriteChan(), text)
+	var (
+		sinkErr error
+		played  []float32
+	)
+	receiver := w.conn.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if audio, ok := msg.(MessagePackAudio); ok {
+				if sinkErr = s.write(audio.PCM); sinkErr != nil {
+					w.cancel()
+					break receive
+				}
+				if s.client.cache != nil {
+					played = append(played, audio.PCM...)
+				}
+			}
+		}
+	}
+	if err = w.conn.Done(); sinkErr != nil {
+		err = fmt.Errorf("failed to play audio: %w", sinkErr)
+	} else if err != nil {
+		err = fmt.Errorf("synthesis failed: %w", err)
+	} else if s.client.cache != nil {
+		// only the complete utterances are cached
+		s.mutex.Lock()
+		complete := !u.interrupted
+		s.mutex.Unlock()
+		if complete {
+			s.client.cache.Put(key, played)
+		}
+	}
+	return
+}
+
+// play writes the audio of an utterance frame by frame, stopping once interrupted.
+func (s *Speaker) play(u *utterance) (err error) {
+	for frame := range slices.Chunk(u.pcm, FrameSize) {
+		s.mutex.Lock()
+		interrupted := u.interrupted
+		s.mutex.Unlock()
+		if interrupted {
+			return
+		}
+		if s.ctx.Err() != nil {
+			return ErrSpeakerClosed
+		}
+		if err = s.write(frame); err != nil {
+			err = fmt.Errorf("failed to play audio: %w", err)
+			return
+		}
+	}
+	return
+}
+
+type warmConnection struct {
+	conn   *TTSConnection
+	voice  string
+	cancel context.CancelFunc
+	err    error
+}
+
+// prepare dials the next connection in the background.
+func (s *Speaker) prepare(voice string) {
+	s.warm = make(chan warmConnection, 1)
+	go func(warm chan<- warmConnection) {
+		warm <- s.dial(voice)
+	}(s.warm)
+}
+
+func (s *Speaker) dial(voice string) (w warmConnection) {
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(s.ctx)
+	w.voice = voice
+	if w.conn, w.err = s.client.connect(ctx, TextEchoSuppress, connectOptions{voice: &voice}); w.err != nil {
+		w.cancel()
+	}
+	return
+}
+
+// release closes a warm connection not used.
+func (s *Speaker) release(w warmConnection) {
+	if w.err == nil {
+		w.cancel()
+		_ = w.conn.Done()
+	}
+}
+
+// takeConnection returns the warm connection (dialing a new one if it did not survive or has
+// another voice) and starts warming up the next one with the current voice.
+func (s *Speaker) takeConnection(voice string) (w warmConnection) {
+	w = <-s.warm
+	if w.err == nil && w.conn.GetContext().Err() != nil {
+		// the warm connection died while idling
+		s.release(w)
+		w.err = errors.New("warm connection lost")
+	} else if w.err == nil && w.voice != voice {
+		s.release(w)
+		w.err = errors.New("warm connection with another voice")
+	}
+	if w.err != nil {
+		// retry right away, the server might be available again
+		w = s.dial(voice)
+	}
+	s.mutex.Lock()
+	next := s.voice
+	s.mutex.Unlock()
+	s.prepare(next)
+	return
+}
+
+type utterance struct {
+	text string
+	// audio played as is instead of text
+	pcm         []float32
+	voice       string
+	priority    Priority
+	seq         uint64
+	result      chan error
+	cancel      context.CancelFunc
+	interrupted bool
+}
+
+func (u *utterance) finish(err error) {
+	u.result <- err
+	close(u.result)
+}
+
+// utteranceQueue is a heap of utterances ordered by priority then submission order.
+type utteranceQueue []*utterance
+
+func (q utteranceQueue) Len() int { return len(q) }
+
+func (q utteranceQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q utteranceQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *utteranceQueue) Push(x any) { *q = append(*q, x.(*utterance)) }
+
+func (q *utteranceQueue) Pop() any {
+	old := *q
+	u := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return u
+}
@@ -0,0 +1,158 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedSink records the first sample of each write and holds the writes until released (or
+// discarded), so that utterances can be queued while one is playing.
+type gatedSink struct {
+	started  chan struct{}
+	gate     chan struct{}
+	once     sync.Once
+	mutex    sync.Mutex
+	written  []float32
+	discards int
+}
+
+func newGatedSink() *gatedSink {
+	return &gatedSink{started: make(chan struct{}, 1), gate: make(chan struct{})}
+}
+
+func (gs *gatedSink) WritePCM(pcm []float32) error {
+	select {
+	case gs.started <- struct{}{}:
+	default:
+	}
+	<-gs.gate
+	gs.mutex.Lock()
+	gs.written = append(gs.written, pcm[0])
+	gs.mutex.Unlock()
+	return nil
+}
+
+func (gs *gatedSink) Discard() {
+	gs.mutex.Lock()
+	gs.discards++
+	gs.mutex.Unlock()
+	gs.release()
+}
+
+func (gs *gatedSink) release() {
+	gs.once.Do(func() { close(gs.gate) })
+}
+
+// played returns the utterances played, in order, from the first sample of their frames.
+func (gs *gatedSink) played() []float32 {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	return slices.Compact(slices.Clone(gs.written))
+}
+
+func newTestSpeaker(t *testing.T, sink AudioSink) *Speaker {
+	t.Helper()
+	client, err := NewTTSClient(&TTSConfig{URL: newMockServer(t).URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSpeaker(context.Background(), client, sink)
+}
+
+// utteranceAudio is audio of a few frames recognizable by its value.
+func utteranceAudio(value float32) []float32 {
+	return slices.Repeat([]float32{value}, 3*FrameSize)
+}
+
+func waitResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("utterance not finished")
+		return nil
+	}
+}
+
+func TestSpeakerPriority(t *testing.T) {
+	sink := newGatedSink()
+	speaker := newTestSpeaker(t, sink)
+	defer speaker.Close()
+	first := speaker.Play(utteranceAudio(1), PriorityNormal)
+	<-sink.started
+	// queued while the first one plays, none of them interrupts it
+	results := []<-chan error{
+		first,
+		speaker.Play(utteranceAudio(2), PriorityLow),
+		speaker.Play(utteranceAudio(3), PriorityNormal),
+		speaker.Play(utteranceAudio(4), PriorityNormal),
+		speaker.Play(utteranceAudio(5), PriorityLow),
+	}
+	sink.release()
+	for i, result := range results {
+		if err := waitResult(t, result); err != nil {
+			t.Fatalf("utterance %d: %v", i+1, err)
+		}
+	}
+	if played := sink.played(); !slices.Equal(played, []float32{1, 3, 4, 2, 5}) {
+		t.Errorf("played %v, expected by priority then order", played)
+	}
+}
+
+func TestSpeakerInterrupt(t *testing.T) {
+	sink := newGatedSink()
+	speaker := newTestSpeaker(t, sink)
+	defer speaker.Close()
+	// a synthesis interrupted by a more important utterance
+	said := speaker.Say("a long announcement", PriorityNormal)
+	<-sink.started
+	urgent := speaker.Play(utteranceAudio(2), PriorityUrgent)
+	if err := waitResult(t, said); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("got %v for the interrupted utterance, expected ErrInterrupted", err)
+	}
+	if err := waitResult(t, urgent); err != nil {
+		t.Fatal(err)
+	}
+	// Interrupt stops the current one, the next starts right away
+	sink.mutex.Lock()
+	discards := sink.discards
+	sink.mutex.Unlock()
+	if discards == 0 {
+		t.Error("the sink was not discarded on interruption")
+	}
+	if played := sink.played(); len(played) == 0 || played[len(played)-1] != 2 {
+		t.Errorf("played %v, expected the urgent utterance last", played)
+	}
+}
+
+func TestSpeakerClose(t *testing.T) {
+	sink := newGatedSink()
+	speaker := newTestSpeaker(t, sink)
+	playing := speaker.Play(utteranceAudio(1), PriorityNormal)
+	<-sink.started
+	queued := speaker.Play(utteranceAudio(2), PriorityLow)
+	closed := make(chan struct{})
+	go func() {
+		speaker.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on the sink")
+	}
+	if err := waitResult(t, playing); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("got %v for the utterance playing, expected ErrInterrupted", err)
+	}
+	if err := waitResult(t, queued); !errors.Is(err, ErrSpeakerClosed) {
+		t.Errorf("got %v for the queued utterance, expected ErrSpeakerClosed", err)
+	}
+	if err := waitResult(t, speaker.Say("too late", PriorityUrgent)); !errors.Is(err, ErrSpeakerClosed) {
+		t.Errorf("got %v after the close, expected ErrSpeakerClosed", err)
+	}
+}
@@ -0,0 +1,159 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const stateEventsLength = 8
+
+// ConnState is the lifecycle state of a connection.
+type ConnState int
+
+const (
+	// ConnDialing is the state of the connection while the websocket is established
+	ConnDialing ConnState = iota
+	// ConnReady means the server is ready: its Ready frame (or any frame) has been received
+	ConnReady
+	// ConnStreaming means data is being sent: audio for STT, text for TTS. Sending before the
+	// server is ready is reported once it is.
+	ConnStreaming
+	// ConnDraining means the input ended and the server is flushing its last results
+	ConnDraining
+	// ConnClosed means the connection ended normally
+	ConnClosed
+	// ConnFailed means the connection stopped on an error (see StateEvent.Err)
+	ConnFailed
+)
+
+func (cs ConnState) String() string {
+	switch cs {
+	case ConnDialing:
+		return "dialing"
+	case ConnReady:
+		return "ready"
+	case ConnStreaming:
+		return "streaming"
+	case ConnDraining:
+		return "draining"
+	case ConnClosed:
+		return "closed"
+	case ConnFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(cs))
+	}
+}
+
+// Terminal returns true for the states ending a connection.
+func (cs ConnState) Terminal() bool {
+	return cs == ConnClosed || cs == ConnFailed
+}
+
+// StateEvent is a state transition of a connection.
+type StateEvent struct {
+	State ConnState
+	At    time.Time
+	// Err is the error that stopped the connection for ConnFailed
+	Err error
+}
+
+// stateMachine holds the state of a connection and notifies its subscribers.
+type stateMachine struct {
+	mutex       sync.Mutex
+	history     []StateEvent
+	subscribers []chan StateEvent
+	// the writer can start before the Ready frame is read: its states wait for it
+	pending []ConnState
+}
+
+func newStateMachine() *stateMachine {
+	return &stateMachine{
+		history: []StateEvent{{State: ConnDialing, At: time.Now()}},
+	}
+}
+
+// set moves the connection to a later state, going back and leaving a terminal state are ignored.
+func (sm *stateMachine) set(state ConnState, err error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	current := sm.history[len(sm.history)-1].State
+	switch {
+	case state <= current || current.Terminal():
+		return
+	case current < ConnReady && !state.Terminal() && state != ConnReady:
+		if len(sm.pending) == 0 || sm.pending[len(sm.pending)-1] < state {
+			sm.pending = append(sm.pending, state)
+		}
+		return
+	}
+	sm.append(StateEvent{State: state, At: time.Now(), Err: err})
+	if state == ConnReady {
+		for _, pending := range sm.pending {
+			sm.append(StateEvent{State: pending, At: time.Now()})
+		}
+		sm.pending = nil
+	}
+}
+
+// append must be called with the mutex held.
+func (sm *stateMachine) append(event StateEvent) {
+	sm.history = append(sm.history, event)
+	for _, subscriber := range sm.subscribers {
+		notifyState(subscriber, event)
+		if event.State.Terminal() {
+			close(subscriber)
+		}
+	}
+	if event.State.Terminal() {
+		sm.subscribers = nil
+	}
+}
+
+func (sm *stateMachine) get() ConnState {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return sm.history[len(sm.history)-1].State
+}
+
+func (sm *stateMachine) subscribe() <-chan StateEvent {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	subscriber := make(chan StateEvent, stateEventsLength)
+	for _, event := range sm.history {
+		notifyState(subscriber, event)
+	}
+	if sm.history[len(sm.history)-1].State.Terminal() {
+		close(subscriber)
+	} else {
+		sm.subscribers = append(sm.subscribers, subscriber)
+	}
+	return subscriber
+}
+
+// end sets the terminal state once the workers stopped, a connection stopped by Close() is closed.
+func (sm *stateMachine) end(ctx context.Context, wait func() error) {
+	if err := wait(); err != nil && !errors.Is(context.Cause(ctx), ErrConnectionClosed) {
+		sm.set(ConnFailed, timeoutCause(ctx, err))
+	} else {
+		sm.set(ConnClosed, nil)
+	}
+}
+
+// notifyState never blocks: a subscriber not reading in time loses its oldest events.
+func notifyState(subscriber chan StateEvent, event StateEvent) {
+	for {
+		select {
+		case subscriber <- event:
+			return
+		default:
+		}
+		select {
+		case <-subscriber:
+		default:
+		}
+	}
+}
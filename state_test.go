@@ -0,0 +1,53 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestConnectionStates(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := conn.Subscribe()
+	go func() {
+		defer close(conn.GetWriteChan())
+		conn.GetWriteChan() <- make([]float32, 5*FrameSize)
+	}()
+	for range conn.GetReadChan() {
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	var states []ConnState
+	for event := range events {
+		states = append(states, event.State)
+	}
+	expected := []ConnState{ConnDialing, ConnReady, ConnStreaming, ConnDraining, ConnClosed}
+	if !slices.Equal(states, expected) {
+		t.Errorf("got states %v, expected %v", states, expected)
+	}
+	if conn.State() != ConnClosed {
+		t.Errorf("got state %s after Done(), expected %s", conn.State(), ConnClosed)
+	}
+	// failure, later transitions are ignored
+	sm := newStateMachine()
+	failure := errors.New("failure")
+	sm.end(context.Background(), func() error { return failure })
+	sm.set(ConnClosed, nil)
+	var last StateEvent
+	for event := range sm.subscribe() {
+		last = event
+	}
+	if last.State != ConnFailed || !errors.Is(last.Err, failure) {
+		t.Errorf("unexpected terminal event: %+v", last)
+	}
+}
@@ -0,0 +1,366 @@
+package krs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	// maximum number of trace events kept per connection (stats are still computed beyond)
+	maxTraceEvents = 200_000
+	rttTimeout     = 5 * time.Second
+)
+
+// Stats is a snapshot of the timing measurements of a connection.
+type Stats struct {
+	// RTT is the websocket ping round trip time measured when the connection was established
+	RTT              time.Duration
+	MessagesSent     int
+	MessagesReceived int
+	BytesSent        int
+	BytesReceived    int
+	// Drain is the time the STT server took to flush its buffers once the audio ended
+	Drain time.Duration
+	// AudioSent is the audio streamed to the STT server
+	AudioSent time.Duration
+	// AudioReceived is the audio synthesized by the TTS server or processed by the STT server
+	AudioReceived time.Duration
+	// AudioWallClock is the time between the first and the last audio received (or processed)
+	AudioWallClock time.Duration
+	// StepsDropped is the number of STT Step frames dropped by the ReadDropSteps policy
+	StepsDropped int
+	// Reconnections is the number of times the STT connection replaced a lost websocket (see
+	// STTConfig.Reconnect)
+	Reconnections int
+	// Tags are the tags of the connection
+	Tags Tags
+	// Utterances contains the latency breakdown per utterance: each TTS connection is one utterance
+	// while STT utterances are delimited by the server pause prediction
+	Utterances []UtteranceStats
+}
+
+// MeanLatency returns the latency breakdown averaged over all utterances.
+func (s Stats) MeanLatency() LatencyBreakdown {
+	latencies := make([]LatencyBreakdown, len(s.Utterances))
+	for i, u := range s.Utterances {
+		latencies[i] = u.Latency
+	}
+	return meanLatency(latencies)
+}
+
+type UtteranceStats struct {
+	Text  string
+	Start time.Time
+	// Latency is averaged over the words for STT and measured on the first audio frame for TTS
+	Latency LatencyBreakdown
+}
+
+// LatencyBreakdown splits the delay between the input given to the library and the matching
+// output received from it.
+type LatencyBreakdown struct {
+	// ClientQueue is the time spent in the writer before reaching the wire (frame assembly, backpressure)
+	ClientQueue time.Duration
+	// Network is the estimated round trip time on the wire
+	Network time.Duration
+	// ServerBuffer is the time spent server side (model delay, buffering, inference)
+	ServerBuffer time.Duration
+	// Decode is the time spent unmarshaling the response and handing it over on the read channel
+	Decode time.Duration
+}
+
+func (lb LatencyBreakdown) Total() time.Duration {
+	return lb.ClientQueue + lb.Network + lb.ServerBuffer + lb.Decode
+}
+
+// connStats records the wire level timestamps of a connection.
+type connStats struct {
+	mutex  sync.Mutex
+	origin time.Time
+	stats  Stats
+	events []traceEvent
+	// STT: wire timings of the audio frames sent, ordered by stream position
+	frames      []frameTiming
+	samplesSent int
+	// current utterance being measured
+	words     []string
+	latencies []LatencyBreakdown
+	start     time.Time
+	// STT: server progress reported by the Step frames
+	timeline Timeline
+	// STT: end of the audio, when the end marker was sent
+	drainStart time.Time
+	// first audio received (TTS) or processed (STT)
+	firstAudio time.Time
+}
+
+type frameTiming struct {
+	offset int // first sample position in the stream
+	queue  time.Duration
+	wire   time.Time
+}
+
+func newConnStats(tags Tags) *connStats {
+	return &connStats{
+		origin: time.Now(),
+		stats:  Stats{Tags: tags},
+	}
+}
+
+// tags returns a copy of the connection tags, they do not change once connected.
+func (cs *connStats) tags() Tags {
+	return maps.Clone(cs.stats.Tags)
+}
+
+// measureRTT pings the server once, it does not fail the connection if the server does not answer.
+func (cs *connStats) measureRTT(ctx context.Context, conn *websocket.Conn) {
+	ctx, cancel := context.WithTimeout(ctx, rttTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := conn.Ping(ctx); err != nil {
+		return
+	}
+	cs.mutex.Lock()
+	cs.stats.RTT = time.Since(start)
+	cs.mutex.Unlock()
+}
+
+// sent records a message written on the wire.
+func (cs *connStats) sent(kind MessagePackType, size int, queuedAt, wireStart, wireEnd time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.stats.MessagesSent++
+	cs.stats.BytesSent += size
+	cs.span("queue "+string(kind), "writer", 1, queuedAt, wireStart, nil)
+	cs.span("write "+string(kind), "writer", 1, wireStart, wireEnd, map[string]any{"bytes": size})
+}
+
+// sentAudio records an audio frame written on the wire to match it later with the transcription.
+func (cs *connStats) sentAudio(samples int, queuedAt, wireStart time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.frames = append(cs.frames, frameTiming{
+		offset: cs.samplesSent,
+		queue:  wireStart.Sub(queuedAt),
+		wire:   wireStart,
+	})
+	cs.samplesSent += samples
+}
+
+// received records a message read from the wire and handed over to the user.
+func (cs *connStats) received(kind MessagePackType, size int, wire, delivered time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.stats.MessagesReceived++
+	cs.stats.BytesReceived += size
+	cs.span("decode "+string(kind), "reader", 2, wire, delivered, map[string]any{"bytes": size})
+}
+
+// stepDropped records a Step frame dropped by the read policy.
+func (cs *connStats) stepDropped() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.stats.StepsDropped++
+}
+
+// reconnected records a lost STT websocket replaced by a new one.
+func (cs *connStats) reconnected() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.stats.Reconnections++
+}
+
+// word attributes a transcribed word to the audio frame that contained its start.
+func (cs *connStats) word(text string, streamTime time.Duration, wire, delivered time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	offset := int(streamTime * SampleRate / time.Second)
+	index, found := slices.BinarySearchFunc(cs.frames, offset, func(frame frameTiming, offset int) int {
+		return frame.offset - offset
+	})
+	if !found {
+		index--
+	}
+	if index < 0 {
+		return
+	}
+	frame := cs.frames[index]
+	if len(cs.words) == 0 {
+		cs.start = frame.wire
+	}
+	cs.words = append(cs.words, text)
+	cs.latencies = append(cs.latencies, cs.breakdown(frame.queue, frame.wire, wire, delivered))
+}
+
+// ttsAudio measures the first audio frame latency against the first text sent.
+func (cs *connStats) ttsAudio(wire, delivered time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if len(cs.latencies) > 0 || len(cs.frames) == 0 {
+		return
+	}
+	first := cs.frames[0]
+	cs.start = first.wire
+	cs.latencies = append(cs.latencies, cs.breakdown(first.queue, first.wire, wire, delivered))
+}
+
+// ttsText records a text message sent to the server.
+func (cs *connStats) ttsText(text string, queuedAt, wireStart time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.words = append(cs.words, text)
+	cs.frames = append(cs.frames, frameTiming{
+		queue: wireStart.Sub(queuedAt),
+		wire:  wireStart,
+	})
+}
+
+// endUtterance closes the STT utterance being measured.
+func (cs *connStats) endUtterance() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if len(cs.words) == 0 {
+		return
+	}
+	utterance := cs.utterance()
+	cs.stats.Utterances = append(cs.stats.Utterances, utterance)
+	cs.span("utterance", "latency", 3, utterance.Start, utterance.Start.Add(utterance.Latency.Total()),
+		map[string]any{"text": utterance.Text})
+	cs.words, cs.latencies = nil, nil
+}
+
+// drainStarted records the start of the STT end of stream flush.
+func (cs *connStats) drainStarted(at time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.drainStart = at
+}
+
+// drainEnded records the server buffers being empty after the end of the stream.
+func (cs *connStats) drainEnded(at time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if cs.drainStart.IsZero() {
+		return
+	}
+	cs.stats.Drain = at.Sub(cs.drainStart)
+	cs.span("drain", "writer", 1, cs.drainStart, at, nil)
+}
+
+func (cs *connStats) breakdown(queue time.Duration, sent, wire, delivered time.Time) (lb LatencyBreakdown) {
+	lb.ClientQueue = queue
+	lb.Network = min(cs.stats.RTT, wire.Sub(sent))
+	lb.ServerBuffer = wire.Sub(sent) - lb.Network
+	lb.Decode = delivered.Sub(wire)
+	return
+}
+
+// utterance must be called with the mutex held.
+func (cs *connStats) utterance() UtteranceStats {
+	return UtteranceStats{
+		Text:    strings.Join(cs.words, " "),
+		Start:   cs.start,
+		Latency: meanLatency(cs.latencies),
+	}
+}
+
+func meanLatency(latencies []LatencyBreakdown) (mean LatencyBreakdown) {
+	if len(latencies) == 0 {
+		return
+	}
+	for _, latency := range latencies {
+		mean.ClientQueue += latency.ClientQueue
+		mean.Network += latency.Network
+		mean.ServerBuffer += latency.ServerBuffer
+		mean.Decode += latency.Decode
+	}
+	count := time.Duration(len(latencies))
+	mean.ClientQueue /= count
+	mean.Network /= count
+	mean.ServerBuffer /= count
+	mean.Decode /= count
+	return
+}
+
+// snapshot returns the stats, including the utterance still in progress.
+func (cs *connStats) snapshot() (stats Stats) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	stats = cs.stats
+	stats.Tags = maps.Clone(cs.stats.Tags)
+	stats.AudioSent = time.Duration(cs.samplesSent) * time.Second / SampleRate
+	stats.Utterances = slices.Clone(cs.stats.Utterances)
+	if len(cs.latencies) > 0 {
+		stats.Utterances = append(stats.Utterances, cs.utterance())
+	}
+	return
+}
+
+// span must be called with the mutex held.
+func (cs *connStats) span(name, category string, tid int, start, end time.Time, args map[string]any) {
+	if len(cs.events) >= maxTraceEvents {
+		return
+	}
+	cs.events = append(cs.events, traceEvent{
+		Name:      name,
+		Category:  category,
+		Phase:     "X",
+		Timestamp: start.Sub(cs.origin).Microseconds(),
+		Duration:  end.Sub(start).Microseconds(),
+		PID:       1,
+		TID:       tid,
+		Args:      args,
+	})
+}
+
+// traceEvent follows the Chrome tracing (chrome://tracing, Perfetto) JSON event format.
+type traceEvent struct {
+	Name      string         `json:"name"`
+	Category  string         `json:"cat"`
+	Phase     string         `json:"ph"`
+	Timestamp int64          `json:"ts"`
+	Duration  int64          `json:"dur"`
+	PID       int            `json:"pid"`
+	TID       int            `json:"tid"`
+	Args      map[string]any `json:"args,omitempty"`
+}
+
+func (cs *connStats) writeTrace(w io.Writer) (err error) {
+	cs.mutex.Lock()
+	trace := struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+		Unit        string       `json:"displayTimeUnit"`
+		Metadata    Tags         `json:"metadata,omitempty"`
+	}{
+		TraceEvents: slices.Clone(cs.events),
+		Unit:        "ms",
+		Metadata:    cs.stats.Tags,
+	}
+	cs.mutex.Unlock()
+	// Name the threads
+	for tid, name := range []string{1: "writer", 2: "reader", 3: "utterances"} {
+		if name == "" {
+			continue
+		}
+		trace.TraceEvents = append(trace.TraceEvents, traceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			PID:   1,
+			TID:   tid,
+			Args:  map[string]any{"name": name},
+		})
+	}
+	if err = json.NewEncoder(w).Encode(trace); err != nil {
+		err = fmt.Errorf("failed to encode the trace: %w", err)
+		return
+	}
+	return
+}
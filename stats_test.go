@@ -0,0 +1,128 @@
+package krs
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLatencyBreakdown(t *testing.T) {
+	cs := newConnStats(nil)
+	cs.stats.RTT = 20 * time.Millisecond
+	t0 := cs.origin
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	// two frames queued 5ms and 15ms before reaching the wire
+	cs.sentAudio(FrameSize, at(0), at(5))
+	cs.sentAudio(FrameSize, at(80), at(95))
+	// a word of each frame, received 105ms and 65ms after its frame was sent
+	cs.word("hello", 0, at(110), at(112))
+	cs.word("world", FrameDuration+time.Millisecond, at(160), at(164))
+	cs.endUtterance()
+	// a word sent back faster than the round trip is all network
+	cs.word("again", FrameDuration, at(105), at(106))
+	stats := cs.snapshot()
+	if len(stats.Utterances) != 2 {
+		t.Fatalf("got %d utterances, expected the ended one and the one in progress", len(stats.Utterances))
+	}
+	utterance := stats.Utterances[0]
+	if utterance.Text != "hello world" || !utterance.Start.Equal(at(5)) {
+		t.Errorf("got utterance %q at %s, expected \"hello world\" at the first frame", utterance.Text, utterance.Start.Sub(t0))
+	}
+	expected := LatencyBreakdown{
+		ClientQueue:  10 * time.Millisecond,                           // (5 + 15) / 2
+		Network:      20 * time.Millisecond,                           // the RTT
+		ServerBuffer: (85*time.Millisecond + 45*time.Millisecond) / 2, // (105 - 20 + 65 - 20) / 2
+		Decode:       3 * time.Millisecond,                            // (2 + 4) / 2
+	}
+	if utterance.Latency != expected {
+		t.Errorf("got latency %+v, expected %+v", utterance.Latency, expected)
+	}
+	if latency := stats.Utterances[1].Latency; latency.Network != 10*time.Millisecond || latency.ServerBuffer != 0 {
+		t.Errorf("got latency %+v, expected 10ms of network and no server buffer", latency)
+	}
+	if mean := stats.MeanLatency(); mean.Total() != (expected.Total()+stats.Utterances[1].Latency.Total())/2 {
+		t.Errorf("got mean latency %+v", mean)
+	}
+	if stats.AudioSent != 2*FrameDuration {
+		t.Errorf("got %s of audio sent, expected 2 frames", stats.AudioSent)
+	}
+	// TTS: the first audio frame is measured against the first text sent
+	cs = newConnStats(nil)
+	t0 = cs.origin
+	cs.ttsText("hello", at(0), at(2))
+	cs.ttsText("world", at(10), at(12))
+	cs.ttsAudio(at(302), at(303))
+	cs.ttsAudio(at(400), at(401))
+	stats = cs.snapshot()
+	if len(stats.Utterances) != 1 || stats.Utterances[0].Text != "hello world" {
+		t.Fatalf("got TTS utterances %+v", stats.Utterances)
+	}
+	expected = LatencyBreakdown{ClientQueue: 2 * time.Millisecond, ServerBuffer: 300 * time.Millisecond, Decode: time.Millisecond}
+	if latency := stats.Utterances[0].Latency; latency != expected {
+		t.Errorf("got TTS latency %+v, expected %+v", latency, expected)
+	}
+}
+
+func TestWriteTrace(t *testing.T) {
+	cs := newConnStats(Tags{"call": "c-1"})
+	at := func(ms int) time.Time { return cs.origin.Add(time.Duration(ms) * time.Millisecond) }
+	cs.sent(MessagePackTypeAudio, 100, at(1), at(3), at(4))
+	cs.sentAudio(FrameSize, at(1), at(3))
+	cs.received(MessagePackTypeWord, 20, at(50), at(51))
+	cs.word("hello", 0, at(50), at(51))
+	cs.endUtterance()
+	cs.drainStarted(at(60))
+	cs.drainEnded(at(90))
+	var trace bytes.Buffer
+	if err := cs.writeTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+		Unit        string       `json:"displayTimeUnit"`
+		Metadata    Tags         `json:"metadata"`
+	}
+	if err := json.Unmarshal(trace.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Unit != "ms" || decoded.Metadata["call"] != "c-1" {
+		t.Errorf("got unit %q and metadata %v", decoded.Unit, decoded.Metadata)
+	}
+	type span struct {
+		name    string
+		tid     int
+		ts, dur int64
+	}
+	var spans []span
+	threads := make(map[int]any)
+	for _, event := range decoded.TraceEvents {
+		switch event.Phase {
+		case "X":
+			if event.PID != 1 {
+				t.Errorf("event %q of process %d", event.Name, event.PID)
+			}
+			spans = append(spans, span{event.Name, event.TID, event.Timestamp, event.Duration})
+		case "M":
+			threads[event.TID] = event.Args["name"]
+		}
+	}
+	expected := []span{
+		{"queue Audio", 1, 1000, 2000},
+		{"write Audio", 1, 3000, 1000},
+		{"decode Word", 2, 50000, 1000},
+		{"utterance", 3, 3000, 50000},
+		{"drain", 1, 60000, 30000},
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("got spans %+v, expected %+v", spans, expected)
+	}
+	for i := range expected {
+		if spans[i] != expected[i] {
+			t.Errorf("got span %+v, expected %+v", spans[i], expected[i])
+		}
+	}
+	if threads[1] != "writer" || threads[2] != "reader" || threads[3] != "utterances" {
+		t.Errorf("got thread names %v", threads)
+	}
+}
@@ -0,0 +1,70 @@
+package krs
+
+import "math"
+
+// StereoChannels is the channel count of the audio rendered with WithStereo() or PanSink().
+const StereoChannels = 2
+
+// stereoPan holds the gains of each channel for a pan position.
+type stereoPan struct {
+	left, right float32
+}
+
+// newStereoPan returns constant power gains for pan, from -1 (left) to 1 (right), 0 being the
+// center.
+func newStereoPan(pan float32) stereoPan {
+	angle := (float64(min(max(pan, -1), 1)) + 1) * math.Pi / 4
+	return stereoPan{
+		left:  float32(math.Cos(angle)),
+		right: float32(math.Sin(angle)),
+	}
+}
+
+func (sp stereoPan) render(pcm []float32) (stereo []float32) {
+	stereo = make([]float32, len(pcm)*StereoChannels)
+	for i, sample := range pcm {
+		stereo[2*i] = sample * sp.left
+		stereo[2*i+1] = sample * sp.right
+	}
+	return
+}
+
+// Pan renders mono samples as interleaved stereo samples (left first). pan goes from -1 (left) to
+// 1 (right), 0 being the center: the gains keep the loudness constant (about -3dB on each channel
+// at the center).
+func Pan(pcm []float32, pan float32) (stereo []float32) {
+	return newStereoPan(pan).render(pcm)
+}
+
+// WithStereo renders the audio of the connection as interleaved stereo samples, panned (see
+// Pan()): the Audio frames of the read channel carry StereoChannels samples per instant. The
+// server only synthesizes mono, the channels are expanded client side (TTS only).
+func WithStereo(pan float32) ConnectOption {
+	gains := newStereoPan(pan)
+	return func(o *connectOptions) {
+		o.stereo = &gains
+	}
+}
+
+// PanSink returns an AudioSink taking mono samples (a Speaker for example) and writing them
+// panned to a stereo sink, for example to play the assistant on the left and the notifications on
+// the right of the same output.
+func PanSink(stereoSink AudioSink, pan float32) AudioSink {
+	return panSink{
+		sink: stereoSink,
+		pan:  newStereoPan(pan),
+	}
+}
+
+type panSink struct {
+	sink AudioSink
+	pan  stereoPan
+}
+
+func (ps panSink) WritePCM(pcm []float32) error {
+	return ps.sink.WritePCM(ps.pan.render(pcm))
+}
+
+func (ps panSink) Discard() {
+	ps.sink.Discard()
+}
@@ -5,27 +5,138 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/tinylib/msgp/msgp"
-	"golang.org/x/sync/errgroup"
+)
+
+// Delays of the Kyutai STT models, usable as STTConfig.Delay to pick a latency/accuracy trade-off.
+const (
+	// LowLatencyDelay is the delay of the kyutai/stt-1b-en_fr model
+	LowLatencyDelay = 500 * time.Millisecond
+	// AccurateDelay is the delay of the kyutai/stt-2.6b-en model
+	AccurateDelay = 2500 * time.Millisecond
 )
 
 type STTConfig struct {
 	URL    string
 	APIKey string
+	// Delay, if set, asks the server for this lookahead (the delayed streams delay): a longer delay
+	// gives the model more context and a more accurate transcription at the cost of latency. It is
+	// sent as the delay query parameter, servers without support for it keep their model delay.
+	Delay time.Duration
+	// WordInterceptor, if set, is called on each word before it is delivered on the read channel:
+	// it can change the word (casing, replacements) or drop it by returning false. It runs on the
+	// reader goroutine and must be quick: if it panics or exceeds WordInterceptorTimeout, the
+	// original word is delivered.
+	WordInterceptor func(Word) (Word, bool)
+	// WordInterceptorTimeout is the time budget of the WordInterceptor (defaults to 100ms)
+	WordInterceptorTimeout time.Duration
+	// RealtimeGuard, if set, reports the server processing the audio slower than real time
+	RealtimeGuard *RealtimeGuard
+	// Format is the wire format of the frames (defaults to WireFormatMessagePack)
+	Format WireFormat
+	// Formats, if set, are negotiated with the server instead of using Format: the connections use
+	// the first of them the server accepts (rejecting the others during the handshake), remembered
+	// by the client for its next connections. WithFormat() skips the negotiation.
+	Formats []WireFormat
+	// Base64Frames wraps the binary frames in base64 text frames, for proxies mangling the binary
+	// websocket traffic. The server is told with the encoding=base64 query parameter.
+	Base64Frames bool
+	// Coalesce, if set, batches the audio frames queued while the network is slower than the
+	// producer into a single message (up to MaxCoalescedFrames complete frames), waiting at most
+	// this long after a frame was queued for the next ones: fewer messages and syscalls for batch
+	// transcription, at the cost of latency. Markers are never delayed by a batch.
+	Coalesce time.Duration
+	// NormalizeInput makes Transcribe() bring the speech of the audio to InputTargetLevel first
+	// (see NormalizeInput()), for the badly leveled recordings. The audio given is not modified.
+	NormalizeInput bool
+	// WriteTimeout bounds the write of each frame (defaults to 10s, negative for none)
+	WriteTimeout time.Duration
+	// ReadTimeout is the longest the server can stay silent (defaults to 30s, negative for none)
+	ReadTimeout time.Duration
+	// MaxSessionDuration, if set, closes the input of the connections this long after they were
+	// opened, as if the write channel was closed, to protect the server from a stuck producer. The
+	// server still transcribes the audio sent until then, Done() returns ErrMaxSessionDuration.
+	MaxSessionDuration time.Duration
+	// PowerSaver trades latency for radio and battery efficiency on mobile and IoT devices: the audio
+	// frames are coalesced (for a second unless Coalesce is set), only the Step frames ending an
+	// utterance and one per second at most are delivered (enough for the Listener endpointing) and
+	// the TCP keepalives are sent every few minutes.
+	PowerSaver bool
+	// Network, if set, simulates a degraded network (testing only)
+	Network *NetworkConditions
+	// Tags are attached to all the connections of the client, see WithTags() to tag a connection
+	Tags Tags
+	// Retry is the policy retrying the websocket handshake of the connections when the server can
+	// not be reached or fails (defaults to DefaultRetryPolicy), WithRetry() overrides it
+	Retry *RetryPolicy
+	// Reconnect, if set, reconnects the connections whose websocket is lost in the middle of the
+	// stream (network drop, frame timeout, server going away) instead of failing them: the server
+	// is dialed again and the connection goes on, on the same channels. The attempts of the policy
+	// count the losses in a row (MaxAttempts 4 tries 3 reconnections), the errors of the protocol
+	// are never retried. Stats().Reconnections counts the reconnections.
+	Reconnect *RetryPolicy
+	// ReconnectReplay is the last audio sent kept to be sent again after a reconnection (defaults
+	// to DefaultReconnectReplay), with the markers not sent back yet: the words of the audio the
+	// lost server did not transcribe yet would be lost otherwise. The times go on from the audio
+	// sent before, the words and steps already delivered are not delivered twice.
+	ReconnectReplay time.Duration
+	// ReadPolicy is what happens when the consumer of the read channel is slow (defaults to
+	// ReadBlock): ReadDropSteps protects real time pipelines from a stalled UI consumer backing up
+	// the websocket reader.
+	ReadPolicy ReadPolicy
+	// ReadBuffer is the number of messages buffered on the read channel by the ReadBuffered and
+	// ReadDropSteps policies (defaults to 64)
+	ReadBuffer int
 }
 
 func NewSTTClient(config *STTConfig) (client *STTClient, err error) {
 	// Create the client
 	client = &STTClient{
-		apiKey: config.APIKey,
+		apiKey:             config.APIKey,
+		httpClient:         newHTTPClient(config.Network, config.PowerSaver),
+		interceptor:        config.WordInterceptor,
+		interceptorTimeout: config.WordInterceptorTimeout,
+		realtimeGuard:      config.RealtimeGuard,
+		tags:               maps.Clone(config.Tags),
+		coalesce:           config.Coalesce,
+		powerSaver:         config.PowerSaver,
+		maxSession:         config.MaxSessionDuration,
+		readPolicy:         config.ReadPolicy,
+		readBuffer:         readBuffer(config.ReadPolicy, config.ReadBuffer),
+		retry:              config.Retry,
+		reconnect:          config.Reconnect,
+		reconnectReplay:    config.ReconnectReplay,
+		normalize:          config.NormalizeInput,
+	}
+	if client.reconnectReplay <= 0 {
+		client.reconnectReplay = DefaultReconnectReplay
+	}
+	if client.powerSaver && client.coalesce == 0 {
+		client.coalesce = powerSaverCoalesce
+	}
+	if client.interceptorTimeout <= 0 {
+		client.interceptorTimeout = defaultWordInterceptorTimeout
+	}
+	if client.codec, err = newCodec(config.Format, config.Base64Frames); err != nil {
+		return
 	}
+	if client.formats, err = newFormatNegotiator(config.Formats, config.Base64Frames); err != nil {
+		return
+	}
+	if client.formats != nil {
+		client.codec = client.formats.codecs[0]
+	}
+	client.timeouts = newFrameTimeouts(config.WriteTimeout, config.ReadTimeout, defaultSTTReadTimeout)
 	// Prepare the URL
 	if client.url, err = url.Parse(config.URL); err != nil {
 		err = fmt.Errorf("failed to parse the URL: %w", err)
@@ -33,65 +144,175 @@ func NewSTTClient(config *STTConfig) (client *STTClient, err error) {
 	}
 	client.url.Path = path.Join(client.url.Path, "/api/asr-streaming")
 	parameters := client.url.Query()
-	parameters.Set("format", "PcmMessagePack")
+	parameters.Set("format", string(client.codec.format()))
+	if config.Base64Frames {
+		parameters.Set("encoding", "base64")
+	}
+	if config.Delay > 0 {
+		parameters.Set("delay", strconv.FormatFloat(config.Delay.Seconds(), 'f', -1, 64))
+	}
 	client.url.RawQuery = parameters.Encode()
 	// Preparations done
 	return
 }
 
 type STTClient struct {
-	url    *url.URL
-	apiKey string
+	url                *url.URL
+	apiKey             string
+	httpClient         *http.Client
+	interceptor        func(Word) (Word, bool)
+	interceptorTimeout time.Duration
+	realtimeGuard      *RealtimeGuard
+	codec              codec
+	formats            *formatNegotiator
+	timeouts           frameTimeouts
+	tags               Tags
+	coalesce           time.Duration
+	powerSaver         bool
+	maxSession         time.Duration
+	readPolicy         ReadPolicy
+	readBuffer         int
+	retry              *RetryPolicy
+	reconnect          *RetryPolicy
+	reconnectReplay    time.Duration
+	normalize          bool
 }
 
-func (client *STTClient) Connect(ctx context.Context) (sttc STTConnection, err error) {
-	// Prepare the websocket client
-	if sttc.conn, _, err = websocket.Dial(ctx, client.url.String(), &websocket.DialOptions{
-		HTTPHeader: http.Header{
-			"kyutai-api-key": []string{client.apiKey},
-		},
-		// TODO
-	}); err != nil {
-		err = fmt.Errorf("failed to dial websocket: %w", err)
+// Connect opens a connection, tagged with the client tags and the ones carried by ctx (see
+// WithTags()). The options (WithFormat(), WithRetry()) only apply to this connection.
+func (client *STTClient) Connect(ctx context.Context, opts ...ConnectOption) (sttc *STTConnection, err error) {
+	options := newConnectOptions(opts)
+	if err = options.validateSTT(); err != nil {
 		return
 	}
+	if options.retry == nil {
+		options.retry = client.retry
+	}
+	sttc = &STTConnection{state: newStateMachine()}
+	// Prepare the websocket client
+	conn, c, err := dialFormat(ctx, client.formats, client.codec, client.connectionURL,
+		client.apiKey, client.httpClient, options)
+	if err != nil {
+		return nil, err
+	}
+	sttc.codec = c
 	// Prepare the channels
 	sttc.writerChan = make(chan []float32)
-	sttc.readerChan = make(chan MessagePack)
-	sttc.flushChan = make(chan any)
+	sttc.markerChan = make(chan *MessagePackMarker)
+	sttc.outgoingChan = make(chan queuedMessage, sttOutgoingQueueLength)
+	sttc.framerDone = make(chan struct{})
+	sttc.stepAcks = make(chan struct{}, drainWindow)
+	sttc.readerChan = make(chan MessagePack, client.readBuffer)
+	sttc.stats = newConnStats(client.tags.merge(TagsFromContext(ctx)))
+	sttc.flow = newFlowControl()
+	sttc.ready = new(readyState)
+	sttc.timeouts = client.timeouts
+	sttc.coalesce = client.coalesce
+	sttc.interceptor = client.interceptor
+	sttc.interceptorTimeout = client.interceptorTimeout
+	sttc.powerSaver = client.powerSaver
+	sttc.readPolicy = client.readPolicy
+	sttc.realtime = newRealtimeMonitor(client.realtimeGuard)
+	sttc.limit = &sessionLimit{max: client.maxSession}
 	// Start workers
-	sttc.workers, sttc.workersCtx = errgroup.WithContext(ctx)
-	sttc.workers.Go(sttc.writer)
-	sttc.workers.Go(sttc.reader)
+	sttc.closeCtx, sttc.cancel = context.WithCancelCause(ctx)
+	sttc.workers, sttc.workersCtx = newWorkerGroup(sttc.closeCtx)
+	sttc.inputCtx, sttc.stopInput = context.WithCancel(sttc.workersCtx)
+	sttc.session = sttc.newSession(conn)
+	if client.reconnect != nil {
+		// each reconnection attempt is a single handshake, paced by the reconnect policy
+		redial := options
+		redial.retry = &RetryPolicy{}
+		sttc.reconnect = client.reconnect
+		sttc.redial = func(ctx context.Context) (*websocket.Conn, error) {
+			return dial(ctx, client.connectionURL(sttc.codec), client.apiKey, client.httpClient, redial)
+		}
+		sttc.replay = newReplayLog(client.reconnectReplay)
+	}
+	sttc.workers.Go(recovered(sttc.framer))
+	sttc.workers.Go(recovered(sttc.stream))
+	go sttc.state.end(sttc.workersCtx, sttc.workers.Wait)
 	return
 }
 
+// connectionURL returns the URL of the server for the codec of a connection.
+func (client *STTClient) connectionURL(c codec) string {
+	if c == client.codec {
+		return client.url.String()
+	}
+	custom := *client.url
+	parameters := custom.Query()
+	parameters.Set("format", string(c.format()))
+	custom.RawQuery = parameters.Encode()
+	return custom.String()
+}
+
 type STTConnection struct {
-	conn         *websocket.Conn
-	workers      *errgroup.Group
-	workersCtx   context.Context
+	// session is replaced by the stream worker after a reconnection, once its workers stopped
+	session    *sttSession
+	workers    *workerGroup
+	workersCtx context.Context
+	// closeCtx outlives a clean end, until Close or the end of the parent context
+	closeCtx context.Context
+	cancel   context.CancelCauseFunc
+	// the framer stops once the server is done
+	inputCtx     context.Context
+	stopInput    context.CancelFunc
 	markerIDsGen atomic.Int64
 	writerChan   chan []float32
+	markerChan   chan *MessagePackMarker
+	outgoingChan chan queuedMessage
+	framerDone   chan struct{}
+	stepAcks     chan struct{}
 	readerChan   chan MessagePack
-	flushChan    chan any
+	stats        *connStats
+	flow         *flowControl
+	ready        *readyState
+	state        *stateMachine
+	limit        *sessionLimit
+	// reconnection (see STTConfig.Reconnect), nil without reconnect policy
+	reconnect *RetryPolicy
+	redial    func(ctx context.Context) (*websocket.Conn, error)
+	replay    *replayLog
+	// reader only
+	interceptor        func(Word) (Word, bool)
+	interceptorTimeout time.Duration
+	powerSaver         bool
+	readPolicy         ReadPolicy
+	realtime           *realtimeMonitor
+	codec              codec
+	timeouts           frameTimeouts
+	// the last word and step delivered, across the sessions
+	lastWordStart float64
+	lastStep      int
+	// writer only
+	coalesce time.Duration
 }
 
 func (sttc *STTConnection) GetContext() context.Context {
 	return sttc.workersCtx
 }
 
+// GetWriteChan returns the channel to stream the audio samples to. Slices of any size can be sent,
+// they are split in frames of FrameSize samples. The slices are copied: they can be reused once sent.
 func (sttc *STTConnection) GetWriteChan() chan<- []float32 {
 	return sttc.writerChan
 }
 
+// SendMarker queues a marker after the audio already sent on the write channel (only its complete
+// frames, the samples left are sent with the next audio), the server sends it back once it
+// processed that audio.
 func (sttc *STTConnection) SendMarker() (markerID int64, err error) {
 	markerID = sttc.markerIDsGen.Add(1)
-	if err = sttc.send(&MessagePackMarker{
+	select {
+	case sttc.markerChan <- &MessagePackMarker{
 		Type: MessagePackTypeMarker,
 		ID:   markerID,
-	}); err != nil {
-		err = fmt.Errorf("failed to send marker ID %d: %w", markerID, err)
-		return
+	}:
+	case <-sttc.framerDone:
+		err = fmt.Errorf("failed to send marker ID %d: the write channel has been closed", markerID)
+	case <-sttc.workersCtx.Done():
+		err = fmt.Errorf("failed to send marker ID %d: %w", markerID, sttc.workersCtx.Err())
 	}
 	return
 }
@@ -100,105 +321,181 @@ func (sttc *STTConnection) GetReadChan() <-chan MessagePack {
 	return sttc.readerChan
 }
 
+// ReadyInfo returns the metadata of the server Ready frame, received is false until the Ready
+// frame has been read (it is delivered on the read channel right after).
+func (sttc *STTConnection) ReadyInfo() (info ReadyInfo, received bool) {
+	return sttc.ready.get()
+}
+
+// Format returns the wire format of the connection, the negotiated one with the Formats of the
+// client configuration.
+func (sttc *STTConnection) Format() WireFormat {
+	return sttc.codec.format()
+}
+
+// FlowControl notifies the flow control states requested by the server (only the latest state
+// is kept if it is not read in time). While paused, the write channel is not read anymore: the
+// producer can use it to stop generating data instead of blocking on the channel.
+func (sttc *STTConnection) FlowControl() <-chan FlowState {
+	return sttc.flow.events
+}
+
+// State returns the current state of the connection.
+func (sttc *STTConnection) State() ConnState {
+	return sttc.state.get()
+}
+
+// Subscribe returns a channel receiving the state transitions of the connection, starting with
+// the ones already done. It is closed after the terminal state (ConnClosed or ConnFailed). The
+// channel is buffered but a subscriber not reading in time loses its oldest events.
+func (sttc *STTConnection) Subscribe() <-chan StateEvent {
+	return sttc.state.subscribe()
+}
+
+// Tags returns a copy of the tags of the connection.
+func (sttc *STTConnection) Tags() Tags {
+	return sttc.stats.tags()
+}
+
+// Stats returns the timing measurements of the connection so far.
+func (sttc *STTConnection) Stats() Stats {
+	return sttc.stats.snapshot()
+}
+
+// Timeline returns the server progress over time as reported by the Step frames.
+func (sttc *STTConnection) Timeline() Timeline {
+	return sttc.stats.timelineSnapshot()
+}
+
+// WriteTrace exports the per frame timestamps of the connection as a Chrome tracing JSON file.
+func (sttc *STTConnection) WriteTrace(w io.Writer) error {
+	return sttc.stats.writeTrace(w)
+}
+
 func (sttc *STTConnection) Done() (err error) {
 	if err = sttc.workers.Wait(); err != nil {
+		err = timeoutCause(sttc.workersCtx, err)
 		var code websocket.StatusCode
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			code = websocket.StatusGoingAway
 		} else {
 			code = websocket.StatusInternalError
 		}
-		_ = sttc.conn.Close(code, "") // discard any closing error as we want to keep the initial stop error
+		_ = sttc.session.conn.Close(code, "") // discard any closing error as we want to keep the initial stop error
 		return
 	}
-	if err = sttc.conn.Close(websocket.StatusNormalClosure, ""); errors.Is(err, io.EOF) {
+	if err = sttc.session.conn.Close(websocket.StatusNormalClosure, ""); errors.Is(err, io.EOF) {
 		// dunno why we can receive EOF here
 		err = nil
 	}
+	if err == nil {
+		err = sttc.limit.err()
+	}
+	return
+}
+
+// Close stops the workers and closes the websocket without waiting for the server. A connection
+// must end with either Done() or Close(): Close can be deferred right after Connect as it is a no-op
+// once the connection ended, the error of the workers is only reported by Done().
+func (sttc *STTConnection) Close() (err error) {
+	sttc.cancel(ErrConnectionClosed)
+	_ = sttc.workers.Wait()
+	if err = sttc.session.conn.CloseNow(); errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
 	return
 }
 
 var (
-	oneSecondOfSilence = make([]float32, SampleRate)
+	oneSecondOfSilence = make([]float32, STTStreamOffset*SampleRate/time.Second)
 )
 
-func (sttc *STTConnection) writer() (err error) {
+const (
+	defaultWordInterceptorTimeout = 100 * time.Millisecond
+	// number of messages the framer can queue ahead of the writer (about 5 seconds of audio)
+	sttOutgoingQueueLength = 64
+	// silence frames sent ahead of the server steps while draining
+	drainWindow = 4
+	// silence is still sent at this pace if the server stops reporting steps while draining
+	drainFallback = time.Second
+	// MaxCoalescedFrames is the maximum number of audio frames batched in a message (see
+	// STTConfig.Coalesce), the server expects reasonably sized messages of complete frames
+	MaxCoalescedFrames = 10
+)
+
+type queuedMessage struct {
+	msg      outgoingMessage
+	queuedAt time.Time
+}
+
+// framer splits the audio pushed by the user into messages of FrameSize samples whatever the size
+// of the slices received, the last frame being padded with silence. Markers are queued in order
+// with the audio: they follow the complete frames received before them.
+func (sttc *STTConnection) framer() (err error) {
+	defer close(sttc.framerDone)
 	var (
-		input  []float32
-		buffer []float32
-		open   bool
+		frame    = make([]float32, 0, FrameSize)
+		queuedAt time.Time
 	)
+	limit, stopLimit := sttc.limit.timer()
+	defer stopLimit()
+	// end flushes the pending samples and ends the stream
+	end := func() {
+		if len(frame) > 0 {
+			frame = append(frame, make([]float32, FrameSize-len(frame))...)
+			if !sttc.queue(&MessagePackAudio{Type: MessagePackTypeAudio, PCM: frame}, queuedAt) {
+				return
+			}
+		}
+		// only close on a clean end: the writer must not send the end marker otherwise
+		close(sttc.outgoingChan)
+	}
 	for {
 		select {
-		case input, open = <-sttc.writerChan:
-			if open {
-				// If this is the first data we send, start with 1 second if silence
-				// https://github.com/kyutai-labs/delayed-streams-modeling/blob/433dca3751a2a21a95a6d7ca1fd2a44c516a729c/scripts/stt_from_file_rust_server.py#L67-L69
-				if buffer == nil {
-					if err = sttc.send(&MessagePackAudio{
-						Type: MessagePackTypeAudio,
-						PCM:  oneSecondOfSilence,
-					}); err != nil {
-						err = fmt.Errorf("failed to send message: %w", err)
-						return
-					}
-				}
-				// Add input data to the buffer
-				buffer = append(buffer, input...)
-				// Send our buffer by respecting the frame size (there will be leftovers)
-				for len(buffer) >= FrameSize {
-					// respect the frame size
-					if err = sttc.send(&MessagePackAudio{
-						Type: MessagePackTypeAudio,
-						PCM:  buffer[:FrameSize],
-					}); err != nil {
-						err = fmt.Errorf("failed to send message: %w", err)
-						return
-					}
-					buffer = buffer[FrameSize:]
+		case input, open := <-sttc.writerChan:
+			if !open {
+				end()
+				return
+			}
+			for len(input) > 0 {
+				if len(frame) == 0 {
+					queuedAt = time.Now()
 				}
-			} else {
-				// Flush out our buffer if some samples remains
-				if len(buffer) > 0 {
-					// fill buffer with silence if needed
-					if len(buffer) < FrameSize {
-						buffer = append(buffer, make([]float32, FrameSize-len(buffer))...)
-					}
-					// send it (we should normally only have one frame to send here)
-					if err = sttc.send(&MessagePackAudio{
-						Type: MessagePackTypeAudio,
-						PCM:  buffer,
-					}); err != nil {
-						err = fmt.Errorf("failed to send message: %w", err)
-						return
-					}
+				n := min(FrameSize-len(frame), len(input))
+				frame = append(frame, input[:n]...)
+				input = input[n:]
+				if len(frame) < FrameSize {
+					continue
 				}
-				// Send the end marker
-				if err = sttc.send(MessagePackMarker{
-					Type: MessagePackTypeMarker,
-					ID:   0, // special ID the SendMarker() will never use
-				}); err != nil {
-					err = fmt.Errorf("failed to send message: %w", err)
+				if !sttc.queue(&MessagePackAudio{Type: MessagePackTypeAudio, PCM: frame}, queuedAt) {
 					return
 				}
-				// Send some silence to flush upstream buffer until we received back the stop marker
-				ticker := time.NewTicker(time.Second)
-				defer ticker.Stop()
-				for {
-					select {
-					case <-ticker.C:
-						if err = sttc.send(&MessagePackAudio{
-							Type: MessagePackTypeAudio,
-							PCM:  oneSecondOfSilence,
-						}); err != nil {
-							err = fmt.Errorf("failed to send message: %w", err)
-							return
-						}
-					case <-sttc.flushChan:
-						// reader has received the end marker
-						return
-					}
-				}
+				// the queued frame now belongs to the writer
+				frame = make([]float32, 0, FrameSize)
+			}
+		case marker := <-sttc.markerChan:
+			if !sttc.queue(marker, time.Now()) {
+				return
+			}
+		case <-limit:
+			sttc.limit.reached.Store(true)
+			end()
+			// the producer is not blocked on the write channel while the server finishes
+			go sttc.discardInput()
+			return
+		case <-sttc.inputCtx.Done():
+			return
+		}
+	}
+}
+
+// discardInput reads the write channel until it is closed or the connection stops.
+func (sttc *STTConnection) discardInput() {
+	for {
+		select {
+		case _, open := <-sttc.writerChan:
+			if !open {
+				return
 			}
 		case <-sttc.workersCtx.Done():
 			return
@@ -206,103 +503,441 @@ func (sttc *STTConnection) writer() (err error) {
 	}
 }
 
-func (sttc *STTConnection) send(msg msgp.Marshaler) (err error) {
+// queue hands over a message to the writer, it returns false if the connection is stopping.
+func (sttc *STTConnection) queue(msg outgoingMessage, queuedAt time.Time) bool {
+	select {
+	case sttc.outgoingChan <- queuedMessage{msg: msg, queuedAt: queuedAt}:
+		return true
+	case <-sttc.inputCtx.Done():
+		return false
+	}
+}
+
+func (sttc *STTConnection) writer() (err error) {
+	session := sttc.session
+	var (
+		started bool
+		// a message received while coalescing audio frames
+		next  *queuedMessage
+		ended bool
+	)
+	if started, err = sttc.resend(session); err != nil {
+		return
+	}
+	for {
+		var queued queuedMessage
+		if next != nil {
+			queued, next = *next, nil
+		} else {
+			if ended {
+				return sttc.flush()
+			}
+			var open bool
+			select {
+			case queued, open = <-sttc.outgoingChan:
+				if !open {
+					return sttc.flush()
+				}
+				sttc.replay.sent(queued.msg)
+			case <-session.inputCtx.Done():
+				return
+			}
+		}
+		if err = sttc.flow.wait(session.inputCtx); err != nil {
+			return nil // stopped while paused, the error is reported by the failing worker
+		}
+		audio, isAudio := queued.msg.(*MessagePackAudio)
+		// If this is the first audio we send, start with 1 second if silence
+		// https://github.com/kyutai-labs/delayed-streams-modeling/blob/433dca3751a2a21a95a6d7ca1fd2a44c516a729c/scripts/stt_from_file_rust_server.py#L67-L69
+		if isAudio && !started {
+			if err = sttc.send(&MessagePackAudio{
+				Type: MessagePackTypeAudio,
+				PCM:  oneSecondOfSilence,
+			}, time.Now()); err != nil {
+				err = fmt.Errorf("failed to send message: %w", err)
+				return
+			}
+			started = true
+			sttc.state.set(ConnStreaming, nil)
+		}
+		if isAudio && sttc.coalesce > 0 {
+			var batch coalescedAudio
+			if batch, next, ended = sttc.coalesceFrames(audio, queued.queuedAt); session.inputCtx.Err() != nil {
+				return
+			}
+			err = sttc.sendCoalesced(batch)
+		} else {
+			err = sttc.send(queued.msg, queued.queuedAt)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to send message: %w", err)
+			return
+		}
+	}
+}
+
+// coalescedAudio is a batch of audio frames sent as a single message.
+type coalescedAudio struct {
+	pcm      []float32
+	queuedAt []time.Time
+}
+
+// coalesceFrames batches the audio frames queued after the first one, waiting for them at most
+// the coalesce latency after the first frame was queued. It stops on any other message, returned
+// as next, or at the end of the audio.
+func (sttc *STTConnection) coalesceFrames(first *MessagePackAudio, queuedAt time.Time) (batch coalescedAudio, next *queuedMessage, ended bool) {
+	batch.pcm = append(make([]float32, 0, MaxCoalescedFrames*FrameSize), first.PCM...)
+	batch.queuedAt = append(make([]time.Time, 0, MaxCoalescedFrames), queuedAt)
+	deadline := time.NewTimer(time.Until(queuedAt.Add(sttc.coalesce)))
+	defer deadline.Stop()
+	// take adds a queued message to the batch, it returns false once the batch is complete
+	take := func(queued queuedMessage, open bool) bool {
+		if !open {
+			ended = true
+			return false
+		}
+		sttc.replay.sent(queued.msg)
+		frame, isAudio := queued.msg.(*MessagePackAudio)
+		if !isAudio {
+			next = &queued
+			return false
+		}
+		batch.pcm = append(batch.pcm, frame.PCM...)
+		batch.queuedAt = append(batch.queuedAt, queued.queuedAt)
+		return true
+	}
+	for len(batch.queuedAt) < MaxCoalescedFrames {
+		// the frames already queued are taken even if the deadline passed
+		select {
+		case queued, open := <-sttc.outgoingChan:
+			if !take(queued, open) {
+				return
+			}
+			continue
+		default:
+		}
+		select {
+		case queued, open := <-sttc.outgoingChan:
+			if !take(queued, open) {
+				return
+			}
+		case <-deadline.C:
+			return
+		case <-sttc.session.inputCtx.Done():
+			return
+		}
+	}
+	return
+}
+
+// flush sends the end marker and then silence to push the remaining audio through the upstream
+// model until the reader received the end marker back. The silence is paced by the server steps:
+// a new frame is sent each time the server consumed one, keeping drainWindow frames in flight.
+func (sttc *STTConnection) flush() (err error) {
+	// discard the steps received before the end of the audio
+	for len(sttc.stepAcks) > 0 {
+		<-sttc.stepAcks
+	}
+	if err = sttc.send(MessagePackMarker{
+		Type: MessagePackTypeMarker,
+		ID:   0, // special ID the SendMarker() will never use
+	}, time.Now()); err != nil {
+		err = fmt.Errorf("failed to send message: %w", err)
+		return
+	}
+	sttc.stats.drainStarted(time.Now())
+	sttc.state.set(ConnDraining, nil)
+	for range drainWindow {
+		if err = sttc.sendSilenceFrame(); err != nil {
+			return
+		}
+	}
+	fallback := time.NewTimer(drainFallback)
+	defer fallback.Stop()
+	for {
+		select {
+		case <-sttc.stepAcks:
+		case <-fallback.C:
+			// no progress reported, the server might wait for more audio
+		case <-sttc.session.flushChan:
+			// reader has received the end marker
+			return
+		case <-sttc.session.inputCtx.Done():
+			return
+		}
+		if err = sttc.sendSilenceFrame(); err != nil {
+			return
+		}
+		fallback.Reset(drainFallback)
+	}
+}
+
+func (sttc *STTConnection) sendSilenceFrame() (err error) {
+	if err = sttc.flow.wait(sttc.session.inputCtx); err != nil {
+		return nil
+	}
+	if err = sttc.send(&MessagePackAudio{
+		Type: MessagePackTypeAudio,
+		PCM:  oneSecondOfSilence[:FrameSize],
+	}, time.Now()); err != nil {
+		err = fmt.Errorf("failed to send message: %w", err)
+	}
+	return
+}
+
+type outgoingMessage interface {
+	MessagePack
+	msgp.Marshaler
+}
+
+func (sttc *STTConnection) send(msg outgoingMessage, queuedAt time.Time) (err error) {
+	wireStart, err := sttc.write(msg, queuedAt)
+	if err != nil {
+		return
+	}
+	if audio, ok := msg.(*MessagePackAudio); ok {
+		sttc.stats.sentAudio(len(audio.PCM), queuedAt, wireStart)
+	}
+	return
+}
+
+// sendCoalesced sends a batch of audio frames, their timings are still recorded per frame.
+func (sttc *STTConnection) sendCoalesced(batch coalescedAudio) (err error) {
+	wireStart, err := sttc.write(&MessagePackAudio{
+		Type: MessagePackTypeAudio,
+		PCM:  batch.pcm,
+	}, batch.queuedAt[0])
+	if err != nil {
+		return
+	}
+	for i, queuedAt := range batch.queuedAt {
+		sttc.stats.sentAudio(min(FrameSize, len(batch.pcm)-i*FrameSize), queuedAt, wireStart)
+	}
+	return
+}
+
+func (sttc *STTConnection) write(msg outgoingMessage, queuedAt time.Time) (wireStart time.Time, err error) {
 	var payload []byte
-	if payload, err = msg.MarshalMsg(nil); err != nil {
-		err = fmt.Errorf("failed to marshal message pack: %w", err)
+	if payload, err = sttc.codec.marshal(msg); err != nil {
 		return
 	}
-	if err = sttc.conn.Write(sttc.workersCtx, websocket.MessageBinary, payload); err != nil {
-		err = fmt.Errorf("failed to write message pack into the websocket connection: %w", err)
+	wireStart = time.Now()
+	session := sttc.session
+	if err = sttc.timeouts.writeFrame(session.ctx, session.abort, session.conn, sttc.codec.frameType(), payload); err != nil {
+		err = &sessionLostError{err: fmt.Errorf("failed to write message pack into the websocket connection: %w", err)}
 		return
 	}
+	sttc.stats.sent(msg.MessageType(), len(payload), queuedAt, wireStart, time.Now())
 	return
 }
 
 func (sttc *STTConnection) reader() (err error) {
+	session := sttc.session
 	var (
-		msgType  websocket.MessageType
-		payload  []byte
-		msgPack  MessagePackHeader
-		draining bool
+		msgType     websocket.MessageType
+		payload     []byte
+		msgPack     MessagePackHeader
+		draining    bool
+		wordDropped bool
+		wire        time.Time
+		// power saver mode
+		lastStepDelivered time.Time
 	)
+	defer sttc.stats.endUtterance()
+	// once the server is done, the writer side has nothing left to do
+	defer session.stopInput()
 	for {
 		// Read a message on the websocket connection
-		if msgType, payload, err = sttc.conn.Read(sttc.workersCtx); err != nil {
+		if msgType, payload, err = sttc.timeouts.readFrame(session.ctx, session.abort, session.conn); err != nil {
 			var ce websocket.CloseError
 			if errors.As(err, &ce) && ce.Code == websocket.StatusNoStatusRcvd {
 				// regular close from the server
 				err = nil
 				// close chan when exiting to inform user we are done
 				close(sttc.readerChan)
+			} else {
+				err = &sessionLostError{err: sttc.flow.readError(err)}
 			}
 			return
 		}
+		wire = time.Now()
+		// any frame means the server is ready, even without a Ready frame
+		sttc.state.set(ConnReady, nil)
 		// Act based on websocket message type
 		switch msgType {
-		case websocket.MessageText:
-			return fmt.Errorf("received an unexpected websocket text message: %s", string(payload))
-		case websocket.MessageBinary:
+		case sttc.codec.frameType():
 			// Unmarsal binary as MessagePack on a identifier type structure
-			if _, err = msgPack.UnmarshalMsg(payload); err != nil {
-				err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+			if err = sttc.codec.unmarshal(payload, &msgPack); err != nil {
 				return
 			}
 			// Unmarshal the full payload into the correct type
 			switch msgPack.Type {
 			case MessagePackTypeReady:
-				sttc.readerChan <- msgPack // ready does not have extra fields to parse
+				var info ReadyInfo
+				if info, err = parseReady(sttc.codec, payload); err != nil {
+					return
+				}
+				_, received := sttc.ready.get()
+				sttc.ready.set(info)
+				if received {
+					// a reconnected session, the first one delivered its Ready frame
+					break
+				}
+				// delivered as a header, the metadata is available with ReadyInfo()
+				if err = sttc.deliver(msgPack); err != nil {
+					return
+				}
 			case MessagePackTypeStep:
 				var msgPackStep MessagePackStep
-				if _, err = msgPackStep.UnmarshalMsg(payload); err != nil {
-					err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+				if err = sttc.codec.unmarshal(payload, &msgPackStep); err != nil {
 					return
 				}
+				msgPackStep.StepIndex += session.offset / FrameSize
+				// the steps of the audio sent again after a reconnection were delivered already
+				replayed := session.reconnected && msgPackStep.StepIndex <= sttc.lastStep
+				if !replayed {
+					sttc.stats.step(msgPackStep, wire)
+					processed := time.Duration(msgPackStep.StepIndex) * FrameDuration
+					sttc.stats.audioReceived(processed, wire)
+					// the server is only slow if it has audio waiting to be processed
+					if err = sttc.realtime.update(wire, processed, msgPackStep.BufferedPCM < FrameSize || draining); err != nil {
+						return
+					}
+					sttc.lastStep = msgPackStep.StepIndex
+					session.progressed = true
+				}
+				// pace the silence sent by the writer while draining
+				select {
+				case sttc.stepAcks <- struct{}{}:
+				default:
+				}
 				if draining {
 					// draining silence sent by writer to flush upstream model buffer
 					if msgPackStep.BufferedPCM == 0 {
 						// finaly received all the upstream buffered silence, we can exit to allow conn to close
+						sttc.stats.drainEnded(wire)
 						close(sttc.readerChan) // close chan when exiting to inform user we are done
 						return
 					}
 					// else there is still buffered upstream we need to drain, simply discard and wait for next step
-				} else {
-					// regular step before end marker, send it to user
-					sttc.readerChan <- msgPackStep
+				} else if !replayed {
+					// regular step before end marker, send it to user (unless saving power)
+					pause := msgPackStep.PausePrediction() > defaultPauseThreshold
+					if !sttc.powerSaver || pause || wire.Sub(lastStepDelivered) >= powerSaverStepInterval {
+						if err = sttc.deliverStep(msgPackStep); err != nil {
+							return
+						}
+						lastStepDelivered = wire
+					}
+					if pause {
+						sttc.stats.endUtterance()
+					}
 				}
 			case MessagePackTypeWord:
 				var msgPackWord MessagePackWord
-				if _, err = msgPackWord.UnmarshalMsg(payload); err != nil {
-					err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+				if err = sttc.codec.unmarshal(payload, &msgPackWord); err != nil {
+					return
+				}
+				msgPackWord.StartTime += session.shift()
+				// the words of the audio sent again after a reconnection were delivered already
+				if wordDropped = session.reconnected && msgPackWord.StartTime <= sttc.lastWordStart; wordDropped {
+					break
+				}
+				sttc.lastWordStart = msgPackWord.StartTime
+				if sttc.interceptor != nil {
+					if msgPackWord, wordDropped = sttc.intercept(msgPackWord); wordDropped {
+						break
+					}
+				}
+				if err = sttc.deliver(msgPackWord); err != nil {
 					return
 				}
-				sttc.readerChan <- msgPackWord
+				sttc.stats.word(msgPackWord.Text, msgPackWord.StartTimeDuration(), wire, time.Now())
 			case MessagePackTypeEndWord:
 				var msgPackWordEnd MessagePackWordEnd
-				if _, err = msgPackWordEnd.UnmarshalMsg(payload); err != nil {
-					err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+				if err = sttc.codec.unmarshal(payload, &msgPackWordEnd); err != nil {
+					return
+				}
+				msgPackWordEnd.StopTime += session.shift()
+				if wordDropped {
+					// end of a word dropped by the interceptor or already delivered
+					break
+				}
+				if err = sttc.deliver(msgPackWordEnd); err != nil {
 					return
 				}
-				sttc.readerChan <- msgPackWordEnd
 			case MessagePackTypeMarker:
 				var msgPackMarker MessagePackMarker
-				if _, err = msgPackMarker.UnmarshalMsg(payload); err != nil {
-					err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+				if err = sttc.codec.unmarshal(payload, &msgPackMarker); err != nil {
 					return
 				}
 				if msgPackMarker.ID == 0 {
 					// stop signal received (back from writer)
-					close(sttc.flushChan) // signal writer it can stop sending silence
-					draining = true       // switch ourself to draining mode
+					close(session.flushChan) // signal writer it can stop sending silence
+					draining = true          // switch ourself to draining mode
 				} else {
 					// custom user marker, send it back
-					sttc.readerChan <- msgPackMarker
+					sttc.replay.echoed(msgPackMarker.ID)
+					if err = sttc.deliver(msgPackMarker); err != nil {
+						return
+					}
 				}
+			case MessagePackTypePause:
+				sttc.flow.set(FlowPaused)
+			case MessagePackTypeResume:
+				sttc.flow.set(FlowResumed)
 			default:
 				return fmt.Errorf("unexpected message pack type identifier: %s", msgPack.Type)
 			}
+			sttc.stats.received(msgPack.Type, len(payload), wire, time.Now())
+		case websocket.MessageText:
+			// not the wire format: most likely an error message
+			return fmt.Errorf("received an unexpected websocket text message: %s", string(payload))
 		default:
 			return fmt.Errorf("unexpected websocket message type: %d", msgType)
 		}
 	}
 }
+
+// intercept runs the user word interceptor within its time budget. A late interceptor keeps
+// running in the background but its result is discarded.
+func (sttc *STTConnection) intercept(msg MessagePackWord) (intercepted MessagePackWord, dropped bool) {
+	type result struct {
+		word Word
+		keep bool
+	}
+	word := Word{Text: msg.Text, Start: msg.StartTimeDuration()}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if recover() != nil {
+				done <- result{word: word, keep: true}
+			}
+		}()
+		intercepted, keep := sttc.interceptor(word)
+		done <- result{word: intercepted, keep: keep}
+	}()
+	timer := time.NewTimer(sttc.interceptorTimeout)
+	defer timer.Stop()
+	intercepted = msg
+	select {
+	case r := <-done:
+		if !r.keep {
+			return intercepted, true
+		}
+		intercepted.Text = r.word.Text
+		intercepted.StartTime = r.word.Start.Seconds()
+	case <-timer.C:
+	}
+	return
+}
+
+// deliver hands over a message to the user without blocking forever if the user stopped reading.
+func (sttc *STTConnection) deliver(msg MessagePack) (err error) {
+	select {
+	case sttc.readerChan <- msg:
+	case <-sttc.workersCtx.Done():
+		err = sttc.workersCtx.Err()
+	}
+	return
+}
@@ -0,0 +1,397 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSTTFraming(t *testing.T) {
+	for _, coalesce := range []time.Duration{0, 50 * time.Millisecond} {
+		t.Run(fmt.Sprintf("coalesce %s", coalesce), func(t *testing.T) {
+			testSTTFraming(t, coalesce)
+		})
+	}
+}
+
+func testSTTFraming(t *testing.T, coalesce time.Duration) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), Coalesce: coalesce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a single oversized slice: 10 complete frames and a partial one
+	go func() {
+		defer close(conn.GetWriteChan())
+		conn.GetWriteChan() <- make([]float32, 10*FrameSize+100)
+		if _, err := conn.SendMarker(); err != nil {
+			t.Error(err)
+		}
+	}()
+	var (
+		lastStep     int
+		markerAtStep int
+	)
+	for msg := range conn.GetReadChan() {
+		switch typed := msg.(type) {
+		case MessagePackStep:
+			lastStep = typed.StepIndex
+		case MessagePackMarker:
+			markerAtStep = lastStep
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	// the initial second of silence counts for 12 frames
+	silence := SampleRate / FrameSize
+	if markerAtStep != silence+10 {
+		t.Errorf("marker received after step %d, expected %d", markerAtStep, silence+10)
+	}
+	if lastStep != silence+11 {
+		t.Errorf("last step is %d, expected %d (padded last frame)", lastStep, silence+11)
+	}
+	if drain := conn.Stats().Drain; drain <= 0 || drain > drainFallback {
+		t.Errorf("unexpected drain duration: %s", drain)
+	}
+	// the initial silence and the 10 frames sent before the marker, batched in a message or two
+	var audioMessages int
+	for _, event := range conn.stats.events {
+		if event.Name == "write "+string(MessagePackTypeMarker) {
+			break
+		}
+		if event.Name == "write "+string(MessagePackTypeAudio) {
+			audioMessages++
+		}
+	}
+	if expected := 1 + 10; (coalesce == 0 && audioMessages != expected) || (coalesce > 0 && audioMessages > 3) {
+		t.Errorf("%d audio messages sent before the marker, expected %d frames", audioMessages, expected)
+	}
+}
+
+func TestSTTWordInterceptor(t *testing.T) {
+	server := newMockServer(t)
+	var calls int
+	client, err := NewSTTClient(&STTConfig{
+		URL: server.URL(),
+		WordInterceptor: func(word Word) (Word, bool) {
+			calls++
+			switch calls {
+			case 1:
+				panic("interceptor failure")
+			case 2:
+				return word, false
+			}
+			word.Text = strings.ToUpper(word.Text)
+			return word, true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer close(conn.GetWriteChan())
+		conn.GetWriteChan() <- make([]float32, 40*FrameSize)
+	}()
+	var words []string
+	for msg := range conn.GetReadChan() {
+		if word, ok := msg.(MessagePackWord); ok {
+			words = append(words, word.Text)
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	// the mock server sends a word every 10 frames, including the initial second of silence
+	if expected := []string{"word", "WORD", "WORD", "WORD"}; !slices.Equal(words, expected) {
+		t.Errorf("got words %q, expected %q", words, expected)
+	}
+}
+
+func TestSTTMaxSessionDuration(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), MaxSessionDuration: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a stuck producer never closing the write channel
+	conn.GetWriteChan() <- make([]float32, 20*FrameSize)
+	var words int
+	for msg := range conn.GetReadChan() {
+		if _, ok := msg.(MessagePackWord); ok {
+			words++
+		}
+	}
+	if err = conn.Done(); !errors.Is(err, ErrMaxSessionDuration) {
+		t.Fatalf("expected ErrMaxSessionDuration, got %v", err)
+	}
+	// the audio sent before the limit is still transcribed
+	if words < 3 {
+		t.Errorf("got %d words, expected the 3 of the audio sent", words)
+	}
+}
+
+func TestSTTPowerSaver(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), PowerSaver: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer close(conn.GetWriteChan())
+		conn.GetWriteChan() <- make([]float32, 40*FrameSize)
+	}()
+	var steps, words int
+	for msg := range conn.GetReadChan() {
+		switch msg.(type) {
+		case MessagePackStep:
+			steps++
+		case MessagePackWord:
+			words++
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	// the 52 steps are answered in well under a second: the first one only is delivered
+	if steps != 1 || words != 5 {
+		t.Errorf("got %d steps and %d words, expected 1 and 5", steps, words)
+	}
+}
+
+func TestSTTAlign(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportText(strings.NewReader("the word\n\nis a word\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aligned, err := client.Align(context.Background(), make([]float32, 2*SampleRate), imported.Text())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := aligned.Text(); text != "the word\nis a word" {
+		t.Fatalf("unexpected aligned text: %q", text)
+	}
+	// the mock server transcribes a "word" every 10 steps
+	if word := aligned.Utterances[0].Words[1]; word.Start != 10*FrameDuration {
+		t.Errorf("unexpected timing of the first word recognized: %+v", word)
+	}
+	var previous time.Duration
+	for _, utterance := range aligned.Utterances {
+		for _, word := range utterance.Words {
+			if word.Start < previous {
+				t.Errorf("words out of order: %+v", aligned.Utterances)
+			}
+			previous = word.Start
+		}
+	}
+}
+
+func TestSTTTranscribeParts(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := [][]float32{make([]float32, SampleRate), make([]float32, SampleRate/2), make([]float32, SampleRate)}
+	transcript, starts, err := client.TranscribeParts(context.Background(), parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []time.Duration{time.Second, 2 * time.Second, 2500 * time.Millisecond}; !slices.Equal(starts, expected) {
+		t.Errorf("got part starts %v, expected %v", starts, expected)
+	}
+	// the mock server transcribes a "word" every 10 steps, the last ones come from the last part
+	var words []Word
+	for _, utterance := range transcript.Utterances {
+		words = append(words, utterance.Words...)
+	}
+	if len(words) < 4 || words[len(words)-1].Start < starts[2] {
+		t.Errorf("unexpected words for 3.5s of stream: %+v", words)
+	}
+}
+
+func TestSTTTranscribeRange(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]float32, 3*SampleRate)
+	if _, err = client.TranscribeRange(context.Background(), pcm, 3*time.Second, 0); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("got %v for a range after the end, expected ErrInvalidRange", err)
+	}
+	transcript, err := client.TranscribeRange(context.Background(), pcm, 2*time.Second, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mock server transcribes a "word" every 10 steps, times are the ones of the whole recording
+	var words []Word
+	for _, utterance := range transcript.Utterances {
+		words = append(words, utterance.Words...)
+	}
+	if len(words) == 0 || words[0].Start < 2*time.Second {
+		t.Errorf("unexpected words for the third second: %+v", words)
+	}
+}
+
+func TestSTTReadDropSteps(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), ReadPolicy: ReadDropSteps, ReadBuffer: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer close(conn.GetWriteChan())
+		conn.GetWriteChan() <- make([]float32, 40*FrameSize)
+	}()
+	// stalled consumer: the Step frames overflow the buffer
+	time.Sleep(300 * time.Millisecond)
+	var steps, words int
+	for msg := range conn.GetReadChan() {
+		switch msg.(type) {
+		case MessagePackStep:
+			steps++
+		case MessagePackWord:
+			words++
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	dropped := conn.Stats().StepsDropped
+	if words != 5 {
+		t.Errorf("got %d words, expected 5: words must never be dropped", words)
+	}
+	if dropped == 0 || steps == 0 {
+		t.Errorf("got %d steps delivered and %d dropped, expected both", steps, dropped)
+	}
+}
+
+func TestSTTTee(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), ReadPolicy: ReadBuffered, ReadBuffer: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := conn.Tee(TeeOutput{}, TeeOutput{Buffer: 1000, Policy: TeeDropOldest})
+	go streamAudio(conn, 40)
+	// the connection ends cleanly while the messages are still buffered for the blocking output
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	count := func(output <-chan MessagePack) (messages, words int) {
+		for msg := range output {
+			messages++
+			if _, ok := msg.(MessagePackWord); ok {
+				words++
+			}
+		}
+		return
+	}
+	messages, words := count(outputs[0])
+	expected, expectedWords := count(outputs[1])
+	if messages != expected || words != expectedWords || words == 0 {
+		t.Errorf("got %d messages and %d words on the blocking output, expected %d and %d", messages, words, expected, expectedWords)
+	}
+}
+
+func TestSTTReconnect(t *testing.T) {
+	transcribe := func(reconnect *RetryPolicy, stall bool) (words []MessagePackWord, markers int, conn *STTConnection, err error) {
+		server := newMockServer(t)
+		config := &STTConfig{URL: server.URL(), Reconnect: reconnect}
+		if stall {
+			// the frame timeout aborts the session
+			server.stallAfter = 20
+			config.ReadTimeout = 300 * time.Millisecond
+		} else {
+			server.dropAfter = 50
+		}
+		client, err := NewSTTClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn, err = client.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		go func() {
+			defer close(conn.GetWriteChan())
+			conn.GetWriteChan() <- make([]float32, 100*FrameSize)
+			_, _ = conn.SendMarker()
+		}()
+		// the read channel is only closed on a clean end
+		for {
+			select {
+			case msg, open := <-conn.GetReadChan():
+				if !open {
+					return words, markers, conn, conn.Done()
+				}
+				switch typed := msg.(type) {
+				case MessagePackWord:
+					words = append(words, typed)
+				case MessagePackMarker:
+					markers++
+				}
+			case <-conn.GetContext().Done():
+				return words, markers, conn, conn.Done()
+			}
+		}
+	}
+	for _, stall := range []bool{false, true} {
+		if _, _, _, err := transcribe(nil, stall); err == nil {
+			t.Fatalf("stall %v: expected the connection lost without reconnect policy", stall)
+		}
+		words, markers, conn, err := transcribe(&RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond}, stall)
+		if err != nil {
+			t.Fatalf("stall %v: %v", stall, err)
+		}
+		if reconnections := conn.Stats().Reconnections; reconnections != 1 {
+			t.Errorf("stall %v: got %d reconnections, expected 1", stall, reconnections)
+		}
+		if markers != 1 {
+			t.Errorf("stall %v: got the marker %d times, expected once", stall, markers)
+		}
+		// the words of the replayed audio are not delivered twice and the times go on
+		for i := 1; i < len(words); i++ {
+			if words[i].StartTime <= words[i-1].StartTime {
+				t.Fatalf("stall %v: word %d at %.2fs after a word at %.2fs", stall, i, words[i].StartTime, words[i-1].StartTime)
+			}
+		}
+		if len(words) == 0 || words[len(words)-1].StartTimeDuration() < 100*FrameDuration {
+			t.Errorf("stall %v: got %d words, expected words up to the end of the audio", stall, len(words))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package krs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrUnsupportedStyle is returned when a style or an emotion is not part of the capabilities of
+// the server (see TTSConfig.StyleCapabilities).
+var ErrUnsupportedStyle = errors.New("unsupported style")
+
+// Style conditions the delivery of the synthesized speech.
+type Style string
+
+// Styles of the Expresso dataset, some of the Kyutai voices are recorded in.
+const (
+	StyleDefault    Style = "default"
+	StyleConfused   Style = "confused"
+	StyleEnunciated Style = "enunciated"
+	StyleHappy      Style = "happy"
+	StyleLaughing   Style = "laughing"
+	StyleSad        Style = "sad"
+	StyleWhisper    Style = "whisper"
+)
+
+// Emotion conditions the expressed emotion of the synthesized speech.
+type Emotion string
+
+// StyleCapabilities lists the styles and emotions a TTS server accepts as query parameters.
+type StyleCapabilities struct {
+	Styles   []Style
+	Emotions []Emotion
+}
+
+// WithStyle asks the server to synthesize the connection in a style, sent as the style query
+// parameter (TTS only).
+func WithStyle(style Style) ConnectOption {
+	return func(o *connectOptions) {
+		o.style = style
+	}
+}
+
+// WithEmotion asks the server to synthesize the connection with an emotion, sent as the emotion
+// query parameter (TTS only).
+func WithEmotion(emotion Emotion) ConnectOption {
+	return func(o *connectOptions) {
+		o.emotion = emotion
+	}
+}
+
+// validate checks the options against the capabilities of the server, none are supported without
+// capabilities.
+func (o connectOptions) validateStyle(capabilities *StyleCapabilities) (err error) {
+	var (
+		styles   []Style
+		emotions []Emotion
+	)
+	if capabilities != nil {
+		styles, emotions = capabilities.Styles, capabilities.Emotions
+	}
+	if o.style != "" && !slices.Contains(styles, o.style) {
+		return fmt.Errorf("%w: style %q (supported: %v)", ErrUnsupportedStyle, o.style, styles)
+	}
+	if o.emotion != "" && !slices.Contains(emotions, o.emotion) {
+		return fmt.Errorf("%w: emotion %q (supported: %v)", ErrUnsupportedStyle, o.emotion, emotions)
+	}
+	return
+}
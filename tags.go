@@ -0,0 +1,57 @@
+package krs
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Tags are key/value metadata attached to a connection (user ID, call ID...) so the results of
+// a multi-session service can be traced back to their origin: they are reported in the
+// connection Stats, its trace and the transcripts, and log as a group (slog.LogValuer).
+type Tags map[string]string
+
+type tagsKey struct{}
+
+// WithTags returns a context carrying tags for the connections opened with it, they are merged
+// with the tags of the parent context and override the client ones sharing their keys.
+func WithTags(ctx context.Context, tags Tags) context.Context {
+	return context.WithValue(ctx, tagsKey{}, TagsFromContext(ctx).merge(tags))
+}
+
+// TagsFromContext returns the tags carried by a context (nil if none).
+func TagsFromContext(ctx context.Context) Tags {
+	tags, _ := ctx.Value(tagsKey{}).(Tags)
+	return tags
+}
+
+// merge returns a new set of tags, other overriding the keys of t.
+func (t Tags) merge(other Tags) Tags {
+	if len(t) == 0 && len(other) == 0 {
+		return nil
+	}
+	merged := make(Tags, len(t)+len(other))
+	maps.Copy(merged, t)
+	maps.Copy(merged, other)
+	return merged
+}
+
+// String returns the tags as comma separated key=value pairs, sorted by key.
+func (t Tags) String() string {
+	pairs := make([]string, 0, len(t))
+	for _, key := range slices.Sorted(maps.Keys(t)) {
+		pairs = append(pairs, key+"="+t[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// LogValue logs the tags as a group, sorted by key.
+func (t Tags) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(t))
+	for _, key := range slices.Sorted(maps.Keys(t)) {
+		attrs = append(attrs, slog.String(key, t[key]))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,68 @@
+package krs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{
+		URL:  server.URL(),
+		Tags: Tags{"service": "ivr", "user": "default"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithTags(context.Background(), Tags{"user": "42"})
+	conn, err := client.Connect(WithTags(ctx, Tags{"call": "c-7"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go streamWords(conn.GetContext(), conn.GetWriteChan(), "hello")
+	for range conn.GetReadChan() {
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	expected := Tags{"service": "ivr", "user": "42", "call": "c-7"}
+	if tags := conn.Tags(); !maps.Equal(tags, expected) {
+		t.Errorf("unexpected connection tags: %v", tags)
+	}
+	if tags := conn.Stats().Tags; !maps.Equal(tags, expected) {
+		t.Errorf("unexpected stats tags: %v", tags)
+	}
+	if tags := expected.String(); tags != "call=c-7,service=ivr,user=42" {
+		t.Errorf("unexpected tags string: %q", tags)
+	}
+	// The trace and the transcripts carry them
+	var trace bytes.Buffer
+	if err = conn.WriteTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Metadata Tags `json:"metadata"`
+	}
+	if err = json.Unmarshal(trace.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(decoded.Metadata, expected) {
+		t.Errorf("unexpected trace metadata: %v", decoded.Metadata)
+	}
+	transcript := Transcript{Tags: conn.Tags()}
+	transcript.AddWord(Word{Text: "hello"})
+	var exported bytes.Buffer
+	if err = transcript.WriteJSON(&exported); err != nil {
+		t.Fatal(err)
+	}
+	var loaded Transcript
+	if err = json.Unmarshal(exported.Bytes(), &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(loaded.Tags, expected) || loaded.Text() != "hello" {
+		t.Errorf("unexpected transcript loaded back: %+v", loaded)
+	}
+}
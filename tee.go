@@ -0,0 +1,129 @@
+package krs
+
+import "context"
+
+// TeePolicy is what a Tee output does when its consumer does not keep up.
+type TeePolicy int
+
+const (
+	// TeeBlock waits for the consumer: the slowest output paces all the others (and the connection)
+	TeeBlock TeePolicy = iota
+	// TeeDropOldest discards the oldest buffered message to make room for the new one
+	TeeDropOldest
+	// TeeDropNewest discards the new message while the buffer is full
+	TeeDropNewest
+)
+
+// TeeOutput configures an output of a Tee.
+type TeeOutput struct {
+	// Buffer is the number of messages buffered for the consumer, at least 1 with the drop policies
+	Buffer int
+	Policy TeePolicy
+}
+
+// Tee fans out the read channel of the connection: each output receives the full message stream
+// (within the limits of its policy) without stealing messages from the others, for example a UI,
+// a recorder and a metrics collector. It must be called before reading the read channel, which must
+// not be read anymore. The outputs are closed once the read channel is, or when the connection
+// fails or is closed: after a clean end, the blocking outputs must be read until closed or the
+// connection closed.
+func (ttsc *TTSConnection) Tee(outputs ...TeeOutput) []<-chan MessagePack {
+	return tee(ttsc.workersCtx, ttsc.closeCtx, ttsc.readerChan, outputs)
+}
+
+// Tee fans out the read channel of the connection: each output receives the full message stream
+// (within the limits of its policy) without stealing messages from the others, for example a UI,
+// a recorder and a metrics collector. It must be called before reading the read channel, which must
+// not be read anymore. The outputs are closed once the read channel is, or when the connection
+// fails or is closed: after a clean end, the blocking outputs must be read until closed or the
+// connection closed.
+func (sttc *STTConnection) Tee(outputs ...TeeOutput) []<-chan MessagePack {
+	return tee(sttc.workersCtx, sttc.closeCtx, sttc.readerChan, outputs)
+}
+
+func tee(ctx, closeCtx context.Context, source <-chan MessagePack, outputs []TeeOutput) (receivers []<-chan MessagePack) {
+	channels := make([]chan MessagePack, len(outputs))
+	receivers = make([]<-chan MessagePack, len(outputs))
+	for i, output := range outputs {
+		if output.Policy != TeeBlock {
+			output.Buffer = max(output.Buffer, 1)
+		}
+		channels[i] = make(chan MessagePack, max(output.Buffer, 0))
+		receivers[i] = channels[i]
+	}
+	go func() {
+		defer func() {
+			for _, channel := range channels {
+				close(channel)
+			}
+		}()
+		for {
+			msg, open := teeReceive(ctx, source)
+			if !open {
+				return
+			}
+			for i, channel := range channels {
+				if !teeSend(ctx, closeCtx, channel, outputs[i].Policy, msg) {
+					return
+				}
+			}
+		}
+	}()
+	return
+}
+
+// teeReceive returns the next message of the source, false once it is closed or the connection
+// stopped with nothing left to deliver.
+func teeReceive(ctx context.Context, source <-chan MessagePack) (msg MessagePack, open bool) {
+	select {
+	case msg, open = <-source:
+		return
+	case <-ctx.Done():
+	}
+	// a clean end closes the read channel before the context is done: its last messages are due
+	select {
+	case msg, open = <-source:
+	default:
+	}
+	return
+}
+
+// teeSend hands over a message to an output according to its policy, it returns false if the
+// connection failed or was closed.
+func teeSend(ctx, closeCtx context.Context, channel chan MessagePack, policy TeePolicy, msg MessagePack) bool {
+	switch policy {
+	case TeeDropNewest:
+		select {
+		case channel <- msg:
+		default:
+		}
+	case TeeDropOldest:
+		for {
+			select {
+			case channel <- msg:
+				return true
+			default:
+			}
+			select {
+			case <-channel:
+			default:
+			}
+		}
+	default:
+		select {
+		case channel <- msg:
+		case <-ctx.Done():
+			// after a clean end (cancelled without cause), the consumer gets the last messages
+			// until the connection is closed
+			if context.Cause(ctx) != context.Canceled {
+				return false
+			}
+			select {
+			case channel <- msg:
+			case <-closeCtx.Done():
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package krs
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// PhoneLowCutoff and PhoneHighCutoff bound the voice band of the telephone networks, in Hz
+	PhoneLowCutoff  = 300.0
+	PhoneHighCutoff = 3400.0
+	// DefaultPacketDuration is the audio carried by a packet of a VoIP call (RTP with G.711)
+	DefaultPacketDuration = 20 * time.Millisecond
+	// μ-law (G.711) encoding of the 14 bits linear samples
+	muLawBias = 0x84
+	muLawClip = 32635
+)
+
+// ChainFilters returns a filter applying the filters one after the other.
+func ChainFilters(filters ...AudioFilter) AudioFilter {
+	return filterChain(filters)
+}
+
+type filterChain []AudioFilter
+
+func (fc filterChain) Apply(pcm []float32, at time.Duration) {
+	for _, filter := range fc {
+		filter.Apply(pcm, at)
+	}
+}
+
+// PhoneFilterConfig is the configuration of NewPhoneFilter.
+type PhoneFilterConfig struct {
+	// Low and High are the cutoffs of the band-pass, in Hz (default PhoneLowCutoff and
+	// PhoneHighCutoff)
+	Low  float64
+	High float64
+	// PacketLoss simulates the VoIP packets lost by the network, none without Rate
+	PacketLoss PacketLossConfig
+}
+
+// NewPhoneFilter returns the chain simulating a phone call: the band-pass of the telephone
+// networks, the μ-law quantization of their G.711 codec and the loss of VoIP packets. Transcribe
+// recordings through it to measure how the transcripts degrade under telephony conditions before
+// deploying to call center audio (krs bench --stt --phone). Like its filters, it keeps the state of
+// a stream: use a filter per stream.
+func NewPhoneFilter(config PhoneFilterConfig) AudioFilter {
+	if config.Low <= 0 {
+		config.Low = PhoneLowCutoff
+	}
+	if config.High <= 0 {
+		config.High = PhoneHighCutoff
+	}
+	chain := filterChain{NewBandPassFilter(config.Low, config.High), MuLawFilter{}}
+	if config.PacketLoss.Rate > 0 {
+		chain = append(chain, NewPacketLossFilter(config.PacketLoss))
+	}
+	return chain
+}
+
+// BandPassFilter is an AudioFilter keeping the frequencies between two cutoffs: a 4th order
+// Butterworth high-pass and low-pass, made of biquads. It keeps the state of a stream.
+type BandPassFilter struct {
+	stages []biquad
+}
+
+// NewBandPassFilter returns a band-pass filter between low and high, in Hz.
+func NewBandPassFilter(low, high float64) *BandPassFilter {
+	// the quality factors of the two biquads of a 4th order Butterworth filter
+	qs := []float64{0.5412, 1.3066}
+	bpf := new(BandPassFilter)
+	for _, q := range qs {
+		bpf.stages = append(bpf.stages, newBiquad(low, q, true))
+	}
+	for _, q := range qs {
+		bpf.stages = append(bpf.stages, newBiquad(high, q, false))
+	}
+	return bpf
+}
+
+// Apply filters the block in place.
+func (bpf *BandPassFilter) Apply(pcm []float32, _ time.Duration) {
+	for i := range bpf.stages {
+		bpf.stages[i].apply(pcm)
+	}
+}
+
+// biquad is a second order filter (transposed direct form II) of the Audio EQ Cookbook.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func newBiquad(cutoff, q float64, highPass bool) (bq biquad) {
+	w0 := 2 * math.Pi * cutoff / SampleRate
+	cos, alpha := math.Cos(w0), math.Sin(w0)/(2*q)
+	a0 := 1 + alpha
+	if highPass {
+		bq.b0, bq.b1, bq.b2 = (1+cos)/2/a0, -(1+cos)/a0, (1+cos)/2/a0
+	} else {
+		bq.b0, bq.b1, bq.b2 = (1-cos)/2/a0, (1-cos)/a0, (1-cos)/2/a0
+	}
+	bq.a1, bq.a2 = -2*cos/a0, (1-alpha)/a0
+	return
+}
+
+func (bq *biquad) apply(pcm []float32) {
+	for i, sample := range pcm {
+		x := float64(sample)
+		y := bq.b0*x + bq.z1
+		bq.z1 = bq.b1*x - bq.a1*y + bq.z2
+		bq.z2 = bq.b2*x - bq.a2*y
+		pcm[i] = float32(y)
+	}
+}
+
+// MuLawFilter is an AudioFilter quantizing the audio as the μ-law G.711 codec of the telephone
+// networks does: each sample goes through an 8 bits encoding and back.
+type MuLawFilter struct{}
+
+// Apply quantizes the block in place.
+func (MuLawFilter) Apply(pcm []float32, _ time.Duration) {
+	for i, sample := range pcm {
+		linear := int16(max(min(sample, 1), -1) * math.MaxInt16)
+		pcm[i] = float32(muLawToLinear(linearToMuLaw(linear))) / math.MaxInt16
+	}
+}
+
+// linearToMuLaw encodes a sample in μ-law.
+func linearToMuLaw(sample int16) byte {
+	magnitude := int(sample)
+	var sign int
+	if magnitude < 0 {
+		magnitude, sign = -magnitude, 0x80
+	}
+	magnitude = min(magnitude, muLawClip) + muLawBias
+	exponent := 7
+	for mask := 0x4000; magnitude&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (magnitude >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// muLawToLinear decodes a μ-law sample.
+func muLawToLinear(encoded byte) int16 {
+	encoded = ^encoded
+	exponent := int(encoded>>4) & 0x07
+	magnitude := ((int(encoded&0x0F) << 3) + muLawBias) << exponent
+	magnitude -= muLawBias
+	if encoded&0x80 != 0 {
+		return int16(-magnitude)
+	}
+	return int16(magnitude)
+}
+
+// PacketLossConfig is the configuration of NewPacketLossFilter.
+type PacketLossConfig struct {
+	// Rate is the share of the packets lost (0.02 for 2%)
+	Rate float64
+	// Burst is the mean number of packets lost in a row (default 1, isolated losses): the
+	// congested networks lose packets in bursts (Gilbert model)
+	Burst float64
+	// Packet is the audio carried by a packet (default DefaultPacketDuration)
+	Packet time.Duration
+	// Seed makes the losses reproducible, the same seed losing the same packets
+	Seed uint64
+}
+
+// PacketLossFilter is an AudioFilter dropping the packets of a VoIP call: the packets lost are
+// replaced by silence, as a receiver without concealment plays them. The packets are cut on the
+// session clock whatever the size of the blocks. It keeps the state of a stream.
+type PacketLossFilter struct {
+	packet int
+	// probabilities of losing a packet after a received one, and of receiving one after a loss
+	loss, recovery float64
+	random         *rand.Rand
+	// the next packet to decide and whether the previous one was lost
+	next int
+	lost bool
+}
+
+// NewPacketLossFilter returns a filter losing config.Rate of the packets.
+func NewPacketLossFilter(config PacketLossConfig) *PacketLossFilter {
+	if config.Burst < 1 {
+		config.Burst = 1
+	}
+	if config.Packet <= 0 {
+		config.Packet = DefaultPacketDuration
+	}
+	rate := min(max(config.Rate, 0), 0.99)
+	recovery := 1 / config.Burst
+	return &PacketLossFilter{
+		packet: max(durationSamples(config.Packet), 1),
+		// the stationary loss rate of the two states chain is loss / (loss + recovery)
+		loss:     min(rate*recovery/(1-rate), 1),
+		recovery: recovery,
+		random:   rand.New(rand.NewPCG(config.Seed, config.Seed^0x9e3779b97f4a7c15)),
+	}
+}
+
+// Apply silences the parts of the block carried by lost packets.
+func (plf *PacketLossFilter) Apply(pcm []float32, at time.Duration) {
+	// rounded, the clock of the blocks being truncated to the nanosecond
+	start := durationSamples(at + time.Second/SampleRate/2)
+	for i := 0; i < len(pcm); {
+		packet := (start + i) / plf.packet
+		end := min((packet+1)*plf.packet-start, len(pcm))
+		if plf.lostPacket(packet) {
+			clear(pcm[i:end])
+		}
+		i = end
+	}
+}
+
+// lostPacket decides the losses up to a packet, in order.
+func (plf *PacketLossFilter) lostPacket(packet int) bool {
+	for ; plf.next <= packet; plf.next++ {
+		if plf.lost {
+			plf.lost = plf.random.Float64() >= plf.recovery
+		} else {
+			plf.lost = plf.random.Float64() < plf.loss
+		}
+	}
+	return plf.lost
+}
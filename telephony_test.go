@@ -0,0 +1,72 @@
+package krs
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPhoneFilter(t *testing.T) {
+	rms := func(pcm []float32) float64 {
+		var energy float64
+		for _, sample := range pcm {
+			energy += float64(sample) * float64(sample)
+		}
+		return math.Sqrt(energy / float64(len(pcm)))
+	}
+	// the voice band goes through, the frequencies out of it are attenuated
+	for _, test := range []struct {
+		frequency float64
+		passed    bool
+	}{{100, false}, {1000, true}, {8000, false}} {
+		tone := make([]float32, SampleRate)
+		for i := range tone {
+			tone[i] = float32(0.5 * math.Sin(2*math.Pi*test.frequency*float64(i)/SampleRate))
+		}
+		filtered := slices.Clone(tone)
+		NewPhoneFilter(PhoneFilterConfig{}).Apply(filtered, 0)
+		// past the settling of the filters
+		gain := 20 * math.Log10(rms(filtered[SampleRate/10:])/rms(tone[SampleRate/10:]))
+		if test.passed && gain < -1 {
+			t.Errorf("%.0fHz attenuated by %.1f dB", test.frequency, -gain)
+		} else if !test.passed && gain > -15 {
+			t.Errorf("%.0fHz only attenuated by %.1f dB", test.frequency, -gain)
+		}
+	}
+	// the μ-law quantization keeps the samples within a few percents
+	for _, sample := range []int16{0, 1, -1, 100, -100, 1000, -5000, 20000, math.MaxInt16, math.MinInt16 + 1} {
+		decoded := muLawToLinear(linearToMuLaw(sample))
+		if diff := math.Abs(float64(decoded - sample)); diff > max(math.Abs(float64(sample))*0.07, 8) {
+			t.Errorf("μ-law round trip of %d gave %d", sample, decoded)
+		}
+	}
+	// the packets are lost whole, at about the requested rate, whatever the blocks size
+	loss := func(blockSize int) (lost []float32) {
+		filter := NewPacketLossFilter(PacketLossConfig{Rate: 0.1, Burst: 3, Seed: 42})
+		for block := range slices.Chunk(slices.Repeat([]float32{1}, 60*SampleRate), blockSize) {
+			block = slices.Clone(block)
+			filter.Apply(block, time.Duration(len(lost))*time.Second/SampleRate)
+			lost = append(lost, block...)
+		}
+		return
+	}
+	lost := loss(997)
+	if !slices.Equal(lost, loss(FrameSize)) {
+		t.Error("the losses depend on the blocks size")
+	}
+	packet := durationSamples(DefaultPacketDuration)
+	var packets, dropped int
+	for samples := range slices.Chunk(lost, packet) {
+		packets++
+		if samples[0] == 0 {
+			dropped++
+		}
+		if slices.Contains(samples, 0) != (samples[0] == 0) || slices.Contains(samples, 1) != (samples[0] == 1) {
+			t.Fatalf("packet %d partially lost", packets-1)
+		}
+	}
+	if rate := float64(dropped) / float64(packets); rate < 0.07 || rate > 0.13 {
+		t.Errorf("lost %.1f%% of the packets, expected about 10%%", rate*100)
+	}
+}
@@ -0,0 +1,82 @@
+// Command gen writes the synthetic clips of the testassets package (go generate). With a TTS
+// server, it also synthesizes the texts as speech clips, their transcript being the text.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	krs "github.com/hekmon/kyutai-rs"
+	"github.com/hekmon/kyutai-rs/testassets"
+)
+
+func main() {
+	var (
+		server string
+		voice  string
+	)
+	flag.StringVar(&server, "tts-server", "", "Synthesize the texts as speech clips with this TTS server.")
+	flag.StringVar(&voice, "voice", "expresso/ex01-ex02_default_001_channel2_198s.wav", "The voice of the speech clips.")
+	flag.Parse()
+	if err := run(server, voice); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(server, voice string) (err error) {
+	clips := map[string][]float32{
+		"silence": make([]float32, 2*krs.SampleRate),
+		"tone":    tone(440, time.Second, 0.5),
+		"noise":   noise(time.Second, 0.1),
+	}
+	if server != "" {
+		var client *krs.TTSClient
+		if client, err = krs.NewTTSClient(&krs.TTSConfig{URL: server, Voice: voice, APIKey: os.Getenv("KYUTAI_TTS_APIKEY")}); err != nil {
+			return
+		}
+		for _, text := range testassets.Texts() {
+			var pcm []float32
+			if pcm, err = client.Synthesize(context.Background(), text.Content); err != nil {
+				return fmt.Errorf("failed to synthesize the %s text: %w", text.Name, err)
+			}
+			clips[text.Name] = pcm
+			if err = os.WriteFile(filepath.Join("clips", text.Name+".txt"), []byte(text.Content+"\n"), 0o644); err != nil {
+				return
+			}
+		}
+	}
+	for name, pcm := range clips {
+		if err = os.WriteFile(filepath.Join("clips", name+".wav"), testassets.EncodeWAV(pcm), 0o644); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// tone is a sine wave with short fades to avoid clicks.
+func tone(frequency float64, duration time.Duration, amplitude float64) (pcm []float32) {
+	pcm = make([]float32, int(duration.Seconds()*krs.SampleRate))
+	fade := krs.SampleRate / 100
+	for i := range pcm {
+		gain := amplitude * min(1, float64(min(i, len(pcm)-1-i))/float64(fade))
+		pcm[i] = float32(gain * math.Sin(2*math.Pi*frequency*float64(i)/krs.SampleRate))
+	}
+	return
+}
+
+// noise is a white noise, seeded to generate the same clip each time.
+func noise(duration time.Duration, amplitude float64) (pcm []float32) {
+	random := rand.New(rand.NewPCG(1, 2))
+	pcm = make([]float32, int(duration.Seconds()*krs.SampleRate))
+	for i := range pcm {
+		pcm[i] = float32(amplitude * (random.Float64()*2 - 1))
+	}
+	return
+}
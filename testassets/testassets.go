@@ -0,0 +1,108 @@
+// Package testassets provides small embedded audio clips (mono 24kHz wave files) and texts for the
+// tests, benchmarks, examples and diagnostic tools, so none of them needs audio from the user.
+package testassets
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+//go:generate go run ./internal/gen
+
+//go:embed clips texts
+var assets embed.FS
+
+// Clip is an embedded audio clip.
+type Clip struct {
+	Name string
+	// Transcript is the expected transcription, empty for the clips without speech
+	Transcript string
+	wav        string
+}
+
+// Speech returns true if the clip contains speech.
+func (c Clip) Speech() bool {
+	return c.Transcript != ""
+}
+
+// PCM decodes the samples of the clip.
+func (c Clip) PCM() (pcm []float32, err error) {
+	data, err := assets.ReadFile(c.wav)
+	if err != nil {
+		return
+	}
+	if pcm, err = DecodeWAV(data); err != nil {
+		err = fmt.Errorf("failed to decode the %s clip: %w", c.Name, err)
+	}
+	return
+}
+
+// Clips returns all the embedded clips, sorted by name.
+func Clips() (clips []Clip) {
+	files, _ := fs.Glob(assets, "clips/*.wav")
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".wav")
+		clip := Clip{Name: name, wav: file}
+		// the transcript of a speech clip is next to it
+		if transcript, err := assets.ReadFile("clips/" + name + ".txt"); err == nil {
+			clip.Transcript = strings.TrimSpace(string(transcript))
+		}
+		clips = append(clips, clip)
+	}
+	return
+}
+
+// LoadClip returns the clip of this name.
+func LoadClip(name string) (clip Clip, err error) {
+	clips := Clips()
+	index := slices.IndexFunc(clips, func(c Clip) bool { return c.Name == name })
+	if index < 0 {
+		return clip, fmt.Errorf("unknown clip %q", name)
+	}
+	return clips[index], nil
+}
+
+// MustPCM returns the samples of a clip and panics if it does not exist, for tests and examples.
+func MustPCM(name string) []float32 {
+	clip, err := LoadClip(name)
+	if err != nil {
+		panic(err)
+	}
+	pcm, err := clip.PCM()
+	if err != nil {
+		panic(err)
+	}
+	return pcm
+}
+
+// Text is an embedded text to synthesize.
+type Text struct {
+	Name    string
+	Content string
+}
+
+// Texts returns all the embedded texts, sorted by name.
+func Texts() (texts []Text) {
+	files, _ := fs.Glob(assets, "texts/*.txt")
+	for _, file := range files {
+		content, _ := assets.ReadFile(file)
+		texts = append(texts, Text{
+			Name:    strings.TrimSuffix(path.Base(file), ".txt"),
+			Content: strings.TrimSpace(string(content)),
+		})
+	}
+	return
+}
+
+// LoadText returns the content of the text of this name, and panics if it does not exist.
+func LoadText(name string) string {
+	content, err := assets.ReadFile("texts/" + name + ".txt")
+	if err != nil {
+		panic(fmt.Sprintf("unknown text %q", name))
+	}
+	return strings.TrimSpace(string(content))
+}
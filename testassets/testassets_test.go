@@ -0,0 +1,38 @@
+package testassets
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClips(t *testing.T) {
+	clips := Clips()
+	if len(clips) == 0 {
+		t.Fatal("no clip embedded")
+	}
+	for _, clip := range clips {
+		pcm, err := clip.PCM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pcm) == 0 {
+			t.Errorf("the %s clip is empty", clip.Name)
+		}
+		// 16 bits round trip
+		decoded, err := DecodeWAV(EncodeWAV(pcm))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range pcm {
+			if math.Abs(float64(pcm[i]-decoded[i])) > 1.0/math.MaxInt16 {
+				t.Fatalf("the %s clip changed after a round trip at sample %d: %f != %f", clip.Name, i, pcm[i], decoded[i])
+			}
+		}
+	}
+	if _, err := LoadClip("missing"); err == nil {
+		t.Error("an unknown clip has been loaded")
+	}
+	if len(Texts()) == 0 || LoadText("pangram") == "" {
+		t.Error("texts not embedded")
+	}
+}
@@ -0,0 +1,82 @@
+package testassets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	sampleRate  = 24_000
+	numChannels = 1
+	bitDepth    = 16
+)
+
+// DecodeWAV decodes a mono 24kHz 16 bits PCM wave file.
+func DecodeWAV(data []byte) (pcm []float32, err error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a wave file")
+	}
+	var formatChecked bool
+	for chunks := data[12:]; len(chunks) >= 8; {
+		id, size := string(chunks[:4]), int(binary.LittleEndian.Uint32(chunks[4:8]))
+		chunks = chunks[8:]
+		if size > len(chunks) {
+			return nil, fmt.Errorf("truncated %q chunk", id)
+		}
+		body := chunks[:size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("invalid format chunk")
+			}
+			format := binary.LittleEndian.Uint16(body[0:2])
+			channels := binary.LittleEndian.Uint16(body[2:4])
+			rate := binary.LittleEndian.Uint32(body[4:8])
+			depth := binary.LittleEndian.Uint16(body[14:16])
+			if format != 1 || channels != numChannels || rate != sampleRate || depth != bitDepth {
+				return nil, fmt.Errorf("unsupported format (PCM %v, %d channels, %d Hz, %d bits): must be mono 24kHz 16 bits PCM",
+					format == 1, channels, rate, depth)
+			}
+			formatChecked = true
+		case "data":
+			if !formatChecked {
+				return nil, errors.New("data chunk before the format chunk")
+			}
+			pcm = make([]float32, size/2)
+			for i := range pcm {
+				pcm[i] = float32(int16(binary.LittleEndian.Uint16(body[2*i:]))) / math.MaxInt16
+			}
+			return
+		}
+		// chunks are word aligned
+		chunks = chunks[size+size%2:]
+	}
+	return nil, errors.New("no data chunk")
+}
+
+// EncodeWAV encodes samples as a mono 24kHz 16 bits PCM wave file.
+func EncodeWAV(pcm []float32) []byte {
+	var buffer bytes.Buffer
+	dataSize := uint32(len(pcm) * bitDepth / 8)
+	buffer.WriteString("RIFF")
+	_ = binary.Write(&buffer, binary.LittleEndian, 36+dataSize)
+	buffer.WriteString("WAVEfmt ")
+	_ = binary.Write(&buffer, binary.LittleEndian, struct {
+		Size          uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}{16, 1, numChannels, sampleRate, sampleRate * numChannels * bitDepth / 8, numChannels * bitDepth / 8, bitDepth})
+	buffer.WriteString("data")
+	_ = binary.Write(&buffer, binary.LittleEndian, dataSize)
+	for _, sample := range pcm {
+		_ = binary.Write(&buffer, binary.LittleEndian, int16(math.Round(float64(max(-1, min(1, sample)))*math.MaxInt16)))
+	}
+	return buffer.Bytes()
+}
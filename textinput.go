@@ -0,0 +1,159 @@
+package krs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunker splits the text read by StreamFrom into the chunks sent to the server. It follows the
+// bufio.SplitFunc contract: ChunkWords, ChunkLines and ChunkSentences cover the common cases, a custom chunker can
+// also pace the input (by waiting before returning a token).
+type Chunker func(data []byte, atEOF bool) (advance int, token []byte, err error)
+
+// ChunkWords sends the text word by word, like a LLM output.
+func ChunkWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return bufio.ScanWords(data, atEOF)
+}
+
+// ChunkLines sends the text line by line, empty lines are skipped.
+func ChunkLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return bufio.ScanLines(data, atEOF)
+}
+
+// sentenceAbbreviations are the common abbreviations whose period does not end a sentence.
+var sentenceAbbreviations = []string{"mr", "mrs", "ms", "dr", "prof", "st", "jr", "sr", "vs", "e.g", "i.e", "etc", "no"}
+
+// ChunkSentences sends the text sentence by sentence: a sentence ends with a terminal punctuation
+// mark followed by a space, or with an empty line. The periods of initials and of the common
+// abbreviations (Mr., e.g.) do not end a sentence, the CJK full stops end it without a space.
+func ChunkSentences(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) {
+		r, width := utf8.DecodeRune(data[start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += width
+	}
+	for i := start; i < len(data); {
+		r, width := utf8.DecodeRune(data[i:])
+		next := i + width
+		switch {
+		case r == '\n':
+			rest := bytes.TrimLeft(data[next:], " \t\r")
+			if len(rest) == 0 && !atEOF {
+				return 0, nil, nil // the next line may be empty
+			}
+			if len(rest) > 0 && rest[0] == '\n' {
+				return next, bytes.TrimSpace(data[start:i]), nil
+			}
+		case strings.ContainsRune("。！？", r):
+			return next, bytes.TrimSpace(data[start:next]), nil
+		case strings.ContainsRune(".!?…", r):
+			// the closing quotes and brackets belong to the sentence
+			for next < len(data) {
+				closing, closingWidth := utf8.DecodeRune(data[next:])
+				if !strings.ContainsRune(".!?…\"')]»”’", closing) {
+					break
+				}
+				next += closingWidth
+			}
+			if next == len(data) && !atEOF {
+				return 0, nil, nil
+			}
+			if after, _ := utf8.DecodeRune(data[next:]); next < len(data) && !unicode.IsSpace(after) {
+				break
+			}
+			if r == '.' && isAbbreviation(data[start:i]) {
+				break
+			}
+			return next, bytes.TrimSpace(data[start:next]), nil
+		}
+		i = next
+	}
+	if !atEOF {
+		return 0, nil, nil
+	}
+	if start < len(data) {
+		return len(data), bytes.TrimSpace(data[start:]), nil
+	}
+	return len(data), nil, nil
+}
+
+// isAbbreviation tells whether the last word of text, followed by a period, is an initial or a
+// common abbreviation.
+func isAbbreviation(text []byte) bool {
+	word := text[bytes.LastIndexFunc(text, unicode.IsSpace)+1:]
+	if utf8.RuneCount(word) == 1 {
+		r, _ := utf8.DecodeRune(word)
+		return unicode.IsLetter(r)
+	}
+	return slices.Contains(sentenceAbbreviations, strings.ToLower(string(word)))
+}
+
+// StreamFrom sends the text read from r as it comes (a file, a pipe, a network connection...) then
+// ends the stream (see CloseInput). It holds the input of the connection meanwhile, like an
+// utterance (see BeginUtterance). The chunks are read as fast as the server accepts them (see
+// FlowControl), a nil chunker sends words.
+//
+// It returns once r is consumed, or early if the connection stopped (its error is returned by
+// Done()): a read blocked in r can not be interrupted, close r to release it. A read error ends
+// the stream too, the text already sent is still synthesized.
+func (ttsc *TTSConnection) StreamFrom(r io.Reader, chunker Chunker) (err error) {
+	if chunker == nil {
+		chunker = ChunkWords
+	}
+	if err = ttsc.acquireInput(context.Background()); err != nil {
+		if ttsc.inputCtx.Err() != nil {
+			err = nil // the connection stopped, see Done()
+		}
+		return
+	}
+	defer ttsc.releaseInput()
+	// read from a dedicated goroutine to stop as soon as the connection does
+	chunks := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		scanner := bufio.NewScanner(r)
+		scanner.Split(bufio.SplitFunc(chunker))
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			select {
+			case chunks <- scanner.Text():
+			case <-ttsc.inputCtx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+	for {
+		select {
+		case chunk, open := <-chunks:
+			if !open {
+				ttsc.closeInput()
+				if err = <-readErr; err != nil {
+					err = fmt.Errorf("failed to read the input text: %w", err)
+				}
+				return
+			}
+			ttsc.utterances.sent("", chunk)
+			select {
+			case ttsc.writerChan <- chunk:
+			case <-ttsc.inputCtx.Done():
+				return
+			}
+		case <-ttsc.inputCtx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package textnorm
+
+// emojiNames holds the spoken names of the emoji LLMs commonly sprinkle in their answers.
+var emojiNames = map[rune]struct {
+	en, fr string
+}{
+	'😀': {"grinning face", "visage souriant"},
+	'😃': {"grinning face", "visage souriant"},
+	'😄': {"grinning face", "visage souriant"},
+	'😁': {"beaming face", "visage rayonnant"},
+	'😅': {"sweaty smile", "sourire gêné"},
+	'😂': {"tears of joy", "larmes de joie"},
+	'🤣': {"rolling on the floor laughing", "mort de rire"},
+	'😊': {"smiling face", "visage souriant"},
+	'🙂': {"slight smile", "léger sourire"},
+	'😉': {"wink", "clin d'œil"},
+	'😍': {"heart eyes", "yeux en cœur"},
+	'🥰': {"smiling face with hearts", "visage souriant avec des cœurs"},
+	'😎': {"cool", "cool"},
+	'🤔': {"thinking face", "visage pensif"},
+	'😐': {"neutral face", "visage neutre"},
+	'😮': {"surprised face", "visage surpris"},
+	'😢': {"crying face", "visage qui pleure"},
+	'😭': {"loudly crying face", "visage en pleurs"},
+	'😡': {"angry face", "visage en colère"},
+	'😱': {"screaming face", "visage qui hurle"},
+	'🥳': {"party face", "visage festif"},
+	'😴': {"sleeping face", "visage endormi"},
+	'🤯': {"mind blown", "tête qui explose"},
+	'🙄': {"eye roll", "yeux au ciel"},
+	'👍': {"thumbs up", "pouce levé"},
+	'👎': {"thumbs down", "pouce baissé"},
+	'👏': {"clapping hands", "applaudissements"},
+	'🙌': {"raised hands", "mains levées"},
+	'🙏': {"folded hands", "mains jointes"},
+	'👋': {"waving hand", "salut de la main"},
+	'👉': {"pointing right", "doigt pointant à droite"},
+	'👈': {"pointing left", "doigt pointant à gauche"},
+	'👀': {"eyes", "yeux"},
+	'💪': {"flexed biceps", "biceps"},
+	'❤': {"red heart", "cœur rouge"},
+	'💔': {"broken heart", "cœur brisé"},
+	'🔥': {"fire", "feu"},
+	'✨': {"sparkles", "étincelles"},
+	'⭐': {"star", "étoile"},
+	'🌟': {"glowing star", "étoile brillante"},
+	'🎉': {"party popper", "cotillons"},
+	'🎊': {"confetti", "confettis"},
+	'🚀': {"rocket", "fusée"},
+	'💡': {"light bulb", "ampoule"},
+	'📌': {"pushpin", "punaise"},
+	'📝': {"memo", "mémo"},
+	'📚': {"books", "livres"},
+	'📅': {"calendar", "calendrier"},
+	'📈': {"chart increasing", "graphique en hausse"},
+	'📉': {"chart decreasing", "graphique en baisse"},
+	'🔍': {"magnifying glass", "loupe"},
+	'🔒': {"lock", "cadenas"},
+	'🔑': {"key", "clé"},
+	'⚙': {"gear", "engrenage"},
+	'🛠': {"tools", "outils"},
+	'💻': {"laptop", "ordinateur portable"},
+	'📱': {"mobile phone", "téléphone portable"},
+	'⏰': {"alarm clock", "réveil"},
+	'⏳': {"hourglass", "sablier"},
+	'✅': {"check mark", "coche"},
+	'✔': {"check mark", "coche"},
+	'❌': {"cross mark", "croix"},
+	'❗': {"exclamation mark", "point d'exclamation"},
+	'❓': {"question mark", "point d'interrogation"},
+	'⚠': {"warning", "attention"},
+	'🚫': {"prohibited", "interdit"},
+	'💯': {"hundred points", "cent points"},
+	'🎯': {"bullseye", "dans le mille"},
+	'🏆': {"trophy", "trophée"},
+	'🤖': {"robot", "robot"},
+	'☀': {"sun", "soleil"},
+	'🌧': {"rain", "pluie"},
+	'☕': {"coffee", "café"},
+	'🍕': {"pizza", "pizza"},
+}
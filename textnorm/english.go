@@ -0,0 +1,180 @@
+package textnorm
+
+import (
+	"strings"
+)
+
+var (
+	enOnes = [...]string{
+		"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen",
+	}
+	enTens = [...]string{
+		"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety",
+	}
+	enScales = [...]string{
+		"", "thousand", "million", "billion", "trillion", "quadrillion", "quintillion",
+	}
+	enMonths = [...]string{
+		"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December",
+	}
+	enOrdinalIrregulars = map[string]string{
+		"one":    "first",
+		"two":    "second",
+		"three":  "third",
+		"five":   "fifth",
+		"eight":  "eighth",
+		"nine":   "ninth",
+		"twelve": "twelfth",
+	}
+)
+
+type english struct{}
+
+func (english) cardinal(n uint64) string {
+	if n < 1000 {
+		return enUnderThousand(n)
+	}
+	var groups []string
+	for scale := 0; n > 0; scale++ {
+		if group := n % 1000; group > 0 {
+			words := enUnderThousand(group)
+			if enScales[scale] != "" {
+				words += " " + enScales[scale]
+			}
+			groups = append(groups, words)
+		}
+		n /= 1000
+	}
+	// groups were collected from the lowest scale, reverse them
+	for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+		groups[i], groups[j] = groups[j], groups[i]
+	}
+	return strings.Join(groups, " ")
+}
+
+func enUnderThousand(n uint64) string {
+	switch {
+	case n < 20:
+		return enOnes[n]
+	case n < 100:
+		if n%10 == 0 {
+			return enTens[n/10]
+		}
+		return enTens[n/10] + "-" + enOnes[n%10]
+	default:
+		if n%100 == 0 {
+			return enOnes[n/100] + " hundred"
+		}
+		return enOnes[n/100] + " hundred " + enUnderThousand(n%100)
+	}
+}
+
+func (en english) ordinal(n uint64) string {
+	words := en.cardinal(n)
+	// only the last word changes: "twenty-one" -> "twenty-first"
+	cut := strings.LastIndexAny(words, " -") + 1
+	last := words[cut:]
+	if irregular, found := enOrdinalIrregulars[last]; found {
+		return words[:cut] + irregular
+	}
+	if strings.HasSuffix(last, "y") {
+		return words[:cut] + strings.TrimSuffix(last, "y") + "ieth"
+	}
+	return words + "th"
+}
+
+func (en english) decimal(integer uint64, fraction string) string {
+	var b strings.Builder
+	b.WriteString(en.cardinal(integer))
+	b.WriteString(" point")
+	for _, digit := range fraction {
+		b.WriteRune(' ')
+		b.WriteString(enOnes[digit-'0'])
+	}
+	return b.String()
+}
+
+func (english) digits(number string) string {
+	words := make([]string, 0, len(number))
+	for _, digit := range number {
+		words = append(words, enOnes[digit-'0'])
+	}
+	return strings.Join(words, " ")
+}
+
+func (english) negative(words string) string {
+	return "minus " + words
+}
+
+func (en english) year(year int) string {
+	switch {
+	case year < 1000 || year >= 10000 || (year >= 2000 && year < 2010) || year%1000 == 0:
+		return en.cardinal(uint64(year))
+	case year%100 == 0:
+		return en.cardinal(uint64(year/100)) + " hundred"
+	case year%100 < 10:
+		return en.cardinal(uint64(year/100)) + " oh " + enOnes[year%100]
+	default:
+		return en.cardinal(uint64(year/100)) + " " + en.cardinal(uint64(year%100))
+	}
+}
+
+func (en english) date(year, month, day int) string {
+	return enMonths[month-1] + " " + en.ordinal(uint64(day)) + ", " + en.year(year)
+}
+
+func (en english) clock(hours, minutes int) string {
+	switch {
+	case minutes == 0:
+		return en.cardinal(uint64(hours)) + " o'clock"
+	case minutes < 10:
+		return en.cardinal(uint64(hours)) + " oh " + enOnes[minutes]
+	default:
+		return en.cardinal(uint64(hours)) + " " + en.cardinal(uint64(minutes))
+	}
+}
+
+func (en english) decade(decade uint64) string {
+	var prefix string
+	if decade >= 100 {
+		// "1990s" -> "nineteen nineties", "1900s" -> "nineteen hundreds", "2000s" -> "two thousands"
+		switch {
+		case decade%1000 == 0:
+			return en.cardinal(decade) + "s"
+		case decade%100 == 0:
+			return en.cardinal(decade/100) + " hundreds"
+		}
+		prefix = en.cardinal(decade/100) + " "
+		decade %= 100
+	}
+	if decade < 20 {
+		// "10s" reads as "tens"
+		return prefix + enOnes[decade] + "s"
+	}
+	return prefix + strings.TrimSuffix(enTens[decade/10], "y") + "ies"
+}
+
+func (en english) currency(symbol rune, amount uint64, cents int, hasCents bool) string {
+	var major, majorPlural, minor, minorPlural string
+	switch symbol {
+	case '€':
+		major, majorPlural, minor, minorPlural = "euro", "euros", "cent", "cents"
+	case '£':
+		major, majorPlural, minor, minorPlural = "pound", "pounds", "penny", "pence"
+	case '¥':
+		major, majorPlural, minor, minorPlural = "yen", "yen", "sen", "sen"
+	default:
+		major, majorPlural, minor, minorPlural = "dollar", "dollars", "cent", "cents"
+	}
+	words := en.cardinal(amount) + " " + plural(amount == 1, major, majorPlural)
+	if hasCents && cents > 0 {
+		words += " and " + en.cardinal(uint64(cents)) + " " + plural(cents == 1, minor, minorPlural)
+	}
+	return words
+}
+
+func (english) unit(u unit, words string, one bool) string {
+	return words + " " + plural(one, u.en, u.enPlural)
+}
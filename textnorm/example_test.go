@@ -0,0 +1,30 @@
+package textnorm_test
+
+import (
+	"fmt"
+
+	"github.com/hekmon/kyutai-rs/textnorm"
+)
+
+func ExampleVerbalize() {
+	fmt.Println(textnorm.Verbalize("It weighs 3.5GB and costs $1,200.", textnorm.English))
+	// Output: It weighs three point five gigabytes and costs one thousand two hundred dollars.
+}
+
+func ExampleSanitizer_Sanitize() {
+	sanitizer := textnorm.Sanitizer{AnnounceCode: true, Emoji: textnorm.EmojiVerbalize}
+	fmt.Println(sanitizer.Sanitize("**Done** 👍\n```sh\nrm -rf build\n```"))
+	// Output:
+	// Done thumbs up
+	// Code omitted.
+}
+
+func ExampleSplitStyles() {
+	for _, run := range textnorm.SplitStyles(`Hello <style name="whisper">this is a secret</style>!`) {
+		fmt.Printf("%q %q\n", run.Style, run.Text)
+	}
+	// Output:
+	// "" "Hello "
+	// "whisper" "this is a secret"
+	// "" "!"
+}
@@ -0,0 +1,235 @@
+package textnorm
+
+import (
+	"strings"
+)
+
+var (
+	frUnits = [...]string{
+		"zéro", "un", "deux", "trois", "quatre", "cinq", "six", "sept", "huit", "neuf",
+		"dix", "onze", "douze", "treize", "quatorze", "quinze", "seize",
+	}
+	frTens = [...]string{
+		"", "dix", "vingt", "trente", "quarante", "cinquante", "soixante",
+	}
+	frScales = [...]struct {
+		singular, plural string
+	}{
+		{"", ""},
+		{"mille", "mille"},
+		{"million", "millions"},
+		{"milliard", "milliards"},
+		{"billion", "billions"},
+		{"billiard", "billiards"},
+		{"trillion", "trillions"},
+	}
+	frMonths = [...]string{
+		"janvier", "février", "mars", "avril", "mai", "juin",
+		"juillet", "août", "septembre", "octobre", "novembre", "décembre",
+	}
+)
+
+type french struct{}
+
+func (french) cardinal(n uint64) string {
+	if n < 1000 {
+		return frUnderThousand(n, true)
+	}
+	var groups []string
+	for scale := 0; n > 0; scale++ {
+		if group := n % 1000; group > 0 {
+			var words string
+			switch {
+			case scale == 0:
+				words = frUnderThousand(group, true)
+			case scale == 1 && group == 1:
+				// "mille", never "un mille"
+				words = frScales[scale].singular
+			case scale == 1:
+				// "mille" is an adjective: "deux cent mille", "quatre-vingt mille"
+				words = frUnderThousand(group, false) + " " + frScales[scale].plural
+			default:
+				// the others are nouns: "deux cents millions"
+				words = frUnderThousand(group, true) + " " + plural(group == 1, frScales[scale].singular, frScales[scale].plural)
+			}
+			groups = append(groups, words)
+		}
+		n /= 1000
+	}
+	for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+		groups[i], groups[j] = groups[j], groups[i]
+	}
+	return strings.Join(groups, " ")
+}
+
+// frUnderThousand spells n < 1000. final indicates if nothing multiplies the group
+// afterwards, which decides the plural "s" of "cents" and "quatre-vingts".
+func frUnderThousand(n uint64, final bool) string {
+	hundreds, rest := n/100, n%100
+	var words string
+	switch {
+	case hundreds == 0:
+		return frUnderHundred(rest, final)
+	case hundreds == 1:
+		words = "cent"
+	case rest == 0 && final:
+		words = frUnits[hundreds] + " cents"
+	default:
+		words = frUnits[hundreds] + " cent"
+	}
+	if rest > 0 {
+		words += " " + frUnderHundred(rest, final)
+	}
+	return words
+}
+
+func frUnderHundred(n uint64, final bool) string {
+	switch {
+	case n <= 16:
+		return frUnits[n]
+	case n < 20:
+		return "dix-" + frUnits[n-10]
+	case n < 70:
+		switch n % 10 {
+		case 0:
+			return frTens[n/10]
+		case 1:
+			return frTens[n/10] + " et un"
+		default:
+			return frTens[n/10] + "-" + frUnits[n%10]
+		}
+	case n < 80:
+		if n == 71 {
+			return "soixante et onze"
+		}
+		return "soixante-" + frUnderHundred(n-60, final)
+	case n == 80:
+		if final {
+			return "quatre-vingts"
+		}
+		return "quatre-vingt"
+	default:
+		return "quatre-vingt-" + frUnderHundred(n-80, final)
+	}
+}
+
+func (fr french) ordinal(n uint64) string {
+	if n == 1 {
+		return "premier"
+	}
+	words := fr.cardinal(n)
+	cut := strings.LastIndexAny(words, " -") + 1
+	last := words[cut:]
+	switch {
+	case last == "cinq":
+		last = "cinquième"
+	case last == "neuf":
+		last = "neuvième"
+	case strings.HasSuffix(last, "e"):
+		last = strings.TrimSuffix(last, "e") + "ième"
+	case strings.HasSuffix(last, "s") && last != "trois":
+		// "deux cents" -> "deux centième", "quatre-vingts" -> "quatre-vingtième"
+		last = strings.TrimSuffix(last, "s") + "ième"
+	default:
+		last += "ième"
+	}
+	return words[:cut] + last
+}
+
+func (fr french) decimal(integer uint64, fraction string) string {
+	words := fr.cardinal(integer) + " virgule"
+	if len(fraction) > 3 {
+		return words + " " + fr.digits(fraction)
+	}
+	// leading zeros are spelled out: "3,05" -> "trois virgule zéro cinq"
+	for strings.HasPrefix(fraction, "0") && len(fraction) > 1 {
+		words += " zéro"
+		fraction = fraction[1:]
+	}
+	var value uint64
+	for _, digit := range fraction {
+		value = value*10 + uint64(digit-'0')
+	}
+	return words + " " + fr.cardinal(value)
+}
+
+func (french) digits(number string) string {
+	words := make([]string, 0, len(number))
+	for _, digit := range number {
+		words = append(words, frUnits[digit-'0'])
+	}
+	return strings.Join(words, " ")
+}
+
+func (french) negative(words string) string {
+	return "moins " + words
+}
+
+func (fr french) year(year int) string {
+	return fr.cardinal(uint64(year))
+}
+
+func (fr french) date(year, month, day int) string {
+	var dayWords string
+	if day == 1 {
+		dayWords = "premier"
+	} else {
+		dayWords = fr.cardinal(uint64(day))
+	}
+	return dayWords + " " + frMonths[month-1] + " " + fr.year(year)
+}
+
+func (fr french) clock(hours, minutes int) string {
+	words := frFeminine(fr.cardinal(uint64(hours))) + " " + plural(hours <= 1, "heure", "heures")
+	if minutes > 0 {
+		words += " " + frFeminine(fr.cardinal(uint64(minutes)))
+	}
+	return words
+}
+
+// frFeminine turns a trailing "un" into "une": "vingt et une heures".
+func frFeminine(words string) string {
+	if words == "un" || strings.HasSuffix(words, " un") {
+		return words + "e"
+	}
+	return words
+}
+
+func (fr french) decade(decade uint64) string {
+	return "années " + fr.cardinal(decade)
+}
+
+func (fr french) currency(symbol rune, amount uint64, cents int, hasCents bool) string {
+	var major, majorPlural string
+	switch symbol {
+	case '€':
+		major, majorPlural = "euro", "euros"
+	case '£':
+		major, majorPlural = "livre", "livres"
+	case '¥':
+		major, majorPlural = "yen", "yens"
+	default:
+		major, majorPlural = "dollar", "dollars"
+	}
+	words := fr.cardinal(amount)
+	if strings.HasSuffix(words, "ions") || strings.HasSuffix(words, "ion") ||
+		strings.HasSuffix(words, "iards") || strings.HasSuffix(words, "iard") {
+		// "un million de dollars"
+		words += " de"
+	}
+	if major == "livre" {
+		words = frFeminine(words)
+	}
+	words += " " + plural(amount <= 1, major, majorPlural)
+	if hasCents && cents > 0 {
+		words += " et " + fr.cardinal(uint64(cents)) + " " + plural(cents == 1, "centime", "centimes")
+	}
+	return words
+}
+
+func (french) unit(u unit, words string, one bool) string {
+	if u.frFeminine {
+		words = frFeminine(words)
+	}
+	return words + " " + plural(one, u.fr, u.frPlural)
+}
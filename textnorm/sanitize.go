@@ -0,0 +1,173 @@
+package textnorm
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type EmojiMode int
+
+const (
+	// EmojiDrop removes emoji from the text
+	EmojiDrop EmojiMode = iota
+	// EmojiVerbalize replaces known emoji by their name, unknown ones are dropped
+	EmojiVerbalize
+	// EmojiKeep leaves emoji untouched
+	EmojiKeep
+)
+
+// Sanitizer cleans up LLM generated text (Markdown, code, emoji) before it is sent to TTS.
+// The zero value drops code blocks and emoji silently and speaks English.
+type Sanitizer struct {
+	// AnnounceCode replaces code blocks by a short "code omitted" notice instead of dropping them
+	AnnounceCode bool
+	Emoji        EmojiMode
+	Locale       Locale
+}
+
+var (
+	mdFence         = regexp.MustCompile("^[ \t]*(```|~~~)")
+	mdInlineCode    = regexp.MustCompile("`([^`\n]*)`")
+	mdImage         = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink          = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdAutoLink      = regexp.MustCompile(`<(?:https?|mailto):[^>]*>`)
+	mdURL           = regexp.MustCompile(`https?://[^\s)\]]+`)
+	mdHTMLTag       = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdHeading       = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	mdListItem      = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+(?:\[[ xX]\]\s+)?`)
+	mdBlockquote    = regexp.MustCompile(`^(?:>\s?)+`)
+	mdRule          = regexp.MustCompile(`^(?:[-*_]\s*){3,}$`)
+	mdTableDivider  = regexp.MustCompile(`^\|?(?:\s*:?-+:?\s*\|)+\s*:?-*:?\s*$`)
+	mdStrong        = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdEmphasis      = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:[^*_]*?\S)?)[*_]`)
+	mdStrikethrough = regexp.MustCompile(`~~(.*?)~~`)
+	spaces          = regexp.MustCompile(`[ \t]{2,}`)
+	spacedPeriods   = regexp.MustCompile(`[ \t]+([.,])`)
+)
+
+// Sanitize strips Markdown syntax, code blocks and emoji (according to the sanitizer settings)
+// and returns plain speakable text.
+func (s Sanitizer) Sanitize(text string) string {
+	var (
+		b      strings.Builder
+		inCode bool
+	)
+	for _, line := range strings.Split(text, "\n") {
+		// Code blocks
+		if mdFence.MatchString(line) {
+			if !inCode && s.AnnounceCode {
+				b.WriteString(s.codeNotice())
+				b.WriteByte('\n')
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		// Block level syntax
+		line = strings.TrimSpace(line)
+		if mdRule.MatchString(line) || mdTableDivider.MatchString(line) {
+			continue
+		}
+		line = mdBlockquote.ReplaceAllString(line, "")
+		if heading := mdHeading.FindStringSubmatch(line); heading != nil {
+			// headings are read as sentences to get a pause afterwards
+			line = terminate(heading[1])
+		}
+		line = mdListItem.ReplaceAllString(line, "")
+		if strings.HasPrefix(line, "|") && strings.HasSuffix(line, "|") {
+			// table rows are read as comma separated values
+			cells := strings.Split(strings.Trim(line, "|"), "|")
+			for i := range cells {
+				cells[i] = strings.TrimSpace(cells[i])
+			}
+			line = terminate(strings.Join(cells, ", "))
+		}
+		// Inline syntax
+		line = mdInlineCode.ReplaceAllString(line, "$1")
+		line = mdImage.ReplaceAllString(line, "$1")
+		line = mdLink.ReplaceAllString(line, "$1")
+		line = mdAutoLink.ReplaceAllString(line, "")
+		line = mdURL.ReplaceAllString(line, "")
+		line = mdHTMLTag.ReplaceAllString(line, "")
+		line = mdStrong.ReplaceAllString(line, "$2")
+		line = mdEmphasis.ReplaceAllString(line, "$1$2")
+		line = mdStrikethrough.ReplaceAllString(line, "$1")
+		// Emoji
+		line = s.emoji(line)
+		line = spaces.ReplaceAllString(line, " ")
+		line = strings.TrimSpace(spacedPeriods.ReplaceAllString(line, "$1"))
+		if line != "" {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (s Sanitizer) codeNotice() string {
+	if s.Locale == French {
+		return "Code omis."
+	}
+	return "Code omitted."
+}
+
+func (s Sanitizer) emoji(line string) string {
+	if s.Emoji == EmojiKeep {
+		return line
+	}
+	var (
+		b     strings.Builder
+		runes = []rune(line)
+	)
+	for i := 0; i < len(runes); i++ {
+		if !isEmoji(runes[i]) {
+			b.WriteRune(runes[i])
+			continue
+		}
+		// consume the whole emoji sequence (modifiers, joiners, variation selectors)
+		end := i + 1
+		for end < len(runes) && (isEmojiModifier(runes[end]) || (runes[end-1] == '\u200d' && isEmoji(runes[end]))) {
+			end++
+		}
+		if s.Emoji == EmojiVerbalize {
+			if name, found := emojiNames[runes[i]]; found {
+				spoken := name.en
+				if s.Locale == French {
+					spoken = name.fr
+				}
+				b.WriteString(" " + spoken + " ")
+			}
+		}
+		i = end - 1
+	}
+	return b.String()
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) ||
+		(r >= 0x2600 && r <= 0x27BF) ||
+		(r >= 0x2300 && r <= 0x23FF) ||
+		(r >= 0x2B00 && r <= 0x2BFF) ||
+		r == 0x203C || r == 0x2049
+}
+
+func isEmojiModifier(r rune) bool {
+	return r == '\u200d' || r == '\ufe0f' || r == '\ufe0e' || r == '\u20e3' ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // skin tones
+		(r >= 0xE0020 && r <= 0xE007F) // tags
+}
+
+// terminate ends a sentence with a period if it has no final punctuation yet.
+func terminate(sentence string) string {
+	if sentence == "" {
+		return sentence
+	}
+	if last, _ := utf8.DecodeLastRuneInString(sentence); unicode.IsPunct(last) {
+		return sentence
+	}
+	return sentence + "."
+}
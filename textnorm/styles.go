@@ -0,0 +1,68 @@
+package textnorm
+
+import (
+	"regexp"
+	"strings"
+)
+
+// StyledText is a run of text sharing the same style and emotion (empty for the default ones).
+type StyledText struct {
+	Style   string
+	Emotion string
+	Text    string
+}
+
+var styleTag = regexp.MustCompile(`<(/?)(style|emotion)(?:\s+name\s*=\s*"([^"]*)")?\s*(/?)>`)
+
+// SplitStyles splits text marked up with inline style and emotion switches into runs:
+//
+//	Hello <style name="whisper">this is a secret</style>, <emotion name="excited"/>and this is not!
+//
+// An opening tag applies until the matching closing tag, which restores the previous value, a
+// self-closing tag applies until the next switch. Empty runs are dropped, text without markup is
+// returned as a single run.
+func SplitStyles(text string) (runs []StyledText) {
+	var (
+		current  StyledText
+		styles   []string
+		emotions []string
+		last     int
+	)
+	flush := func(end int) {
+		if chunk := text[last:end]; strings.TrimSpace(chunk) != "" {
+			run := current
+			run.Text = chunk
+			runs = append(runs, run)
+		}
+	}
+	for _, match := range styleTag.FindAllStringSubmatchIndex(text, -1) {
+		flush(match[0])
+		last = match[1]
+		closing := match[3] > match[2]
+		selfClosing := match[9] > match[8]
+		var name string
+		if match[6] >= 0 {
+			name = strings.TrimSpace(text[match[6]:match[7]])
+		}
+		value, stack := &current.Style, &styles
+		if text[match[4]:match[5]] == "emotion" {
+			value, stack = &current.Emotion, &emotions
+		}
+		switch {
+		case closing:
+			if len(*stack) > 0 {
+				*value = (*stack)[len(*stack)-1]
+				*stack = (*stack)[:len(*stack)-1]
+			} else {
+				*value = ""
+			}
+		case selfClosing:
+			*value = name
+		default:
+			*stack = append(*stack, *value)
+			*value = name
+		}
+	}
+	flush(len(text))
+	return
+}
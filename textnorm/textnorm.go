@@ -0,0 +1,347 @@
+// Package textnorm prepares written text for speech synthesis.
+//
+// Raw numerals, dates, currencies and units are frequently garbled by TTS
+// models: Verbalize expands them into the words a human reader would say.
+package textnorm
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Locale string
+
+const (
+	English Locale = "en"
+	French  Locale = "fr"
+)
+
+type speller interface {
+	cardinal(n uint64) string
+	ordinal(n uint64) string
+	decimal(integer uint64, fraction string) string
+	digits(number string) string
+	negative(words string) string
+	year(year int) string
+	date(year, month, day int) string
+	clock(hours, minutes int) string
+	decade(decade uint64) string
+	currency(symbol rune, amount uint64, cents int, hasCents bool) string
+	unit(u unit, words string, one bool) string
+}
+
+type unit struct {
+	en, enPlural string
+	fr, frPlural string
+	frFeminine   bool
+}
+
+var units = map[string]unit{
+	"%":    {"percent", "percent", "pour cent", "pour cent", false},
+	"°C":   {"degree Celsius", "degrees Celsius", "degré Celsius", "degrés Celsius", false},
+	"°F":   {"degree Fahrenheit", "degrees Fahrenheit", "degré Fahrenheit", "degrés Fahrenheit", false},
+	"KB":   {"kilobyte", "kilobytes", "kilooctet", "kilooctets", false},
+	"kB":   {"kilobyte", "kilobytes", "kilooctet", "kilooctets", false},
+	"MB":   {"megabyte", "megabytes", "mégaoctet", "mégaoctets", false},
+	"GB":   {"gigabyte", "gigabytes", "gigaoctet", "gigaoctets", false},
+	"TB":   {"terabyte", "terabytes", "téraoctet", "téraoctets", false},
+	"Ko":   {"kilobyte", "kilobytes", "kilooctet", "kilooctets", false},
+	"Mo":   {"megabyte", "megabytes", "mégaoctet", "mégaoctets", false},
+	"Go":   {"gigabyte", "gigabytes", "gigaoctet", "gigaoctets", false},
+	"To":   {"terabyte", "terabytes", "téraoctet", "téraoctets", false},
+	"kbps": {"kilobit per second", "kilobits per second", "kilobit par seconde", "kilobits par seconde", false},
+	"Mbps": {"megabit per second", "megabits per second", "mégabit par seconde", "mégabits par seconde", false},
+	"Gbps": {"gigabit per second", "gigabits per second", "gigabit par seconde", "gigabits par seconde", false},
+	"km/h": {"kilometer per hour", "kilometers per hour", "kilomètre par heure", "kilomètres par heure", false},
+	"mph":  {"mile per hour", "miles per hour", "mile par heure", "miles par heure", false},
+	"km":   {"kilometer", "kilometers", "kilomètre", "kilomètres", false},
+	"m":    {"meter", "meters", "mètre", "mètres", false},
+	"cm":   {"centimeter", "centimeters", "centimètre", "centimètres", false},
+	"mm":   {"millimeter", "millimeters", "millimètre", "millimètres", false},
+	"kg":   {"kilogram", "kilograms", "kilogramme", "kilogrammes", false},
+	"g":    {"gram", "grams", "gramme", "grammes", false},
+	"mg":   {"milligram", "milligrams", "milligramme", "milligrammes", false},
+	"L":    {"liter", "liters", "litre", "litres", false},
+	"ml":   {"milliliter", "milliliters", "millilitre", "millilitres", false},
+	"mL":   {"milliliter", "milliliters", "millilitre", "millilitres", false},
+	"ms":   {"millisecond", "milliseconds", "milliseconde", "millisecondes", true},
+	"min":  {"minute", "minutes", "minute", "minutes", true},
+	"h":    {"hour", "hours", "heure", "heures", true},
+	"Hz":   {"hertz", "hertz", "hertz", "hertz", false},
+	"kHz":  {"kilohertz", "kilohertz", "kilohertz", "kilohertz", false},
+	"MHz":  {"megahertz", "megahertz", "mégahertz", "mégahertz", false},
+	"GHz":  {"gigahertz", "gigahertz", "gigahertz", "gigahertz", false},
+}
+
+type rules struct {
+	speller
+	decimalMarks string
+	singular     func(value float64) bool
+	// expressions
+	dates      *regexp.Regexp
+	clocks     *regexp.Regexp
+	currencies *regexp.Regexp
+	ordinals   *regexp.Regexp
+	decades    *regexp.Regexp
+	measures   *regexp.Regexp
+	numbers    *regexp.Regexp
+}
+
+var locales = map[Locale]*rules{
+	English: newRules(english{},
+		`\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?`, ".",
+		`(\d{1,2}):(\d{2})`,
+		`(st|nd|rd|th)`,
+		func(value float64) bool { return value == 1 },
+	),
+	French: newRules(french{},
+		`\d{1,3}(?:[ \x{a0}\x{202f}]\d{3})+(?:,\d+)?|\d+(?:[.,]\d+)?`, ",.",
+		`(\d{1,2})[:h](\d{2})`,
+		`(er|re|ère|ème|e|ᵉ)`,
+		func(value float64) bool { return value < 2 },
+	),
+}
+
+func newRules(s speller, number, decimalMarks, clock, ordinalSuffixes string, singular func(float64) bool) *rules {
+	// longest units first as the regexp alternation is leftmost-first
+	unitNames := make([]string, 0, len(units))
+	for name := range units {
+		unitNames = append(unitNames, regexp.QuoteMeta(name))
+	}
+	sort.Slice(unitNames, func(i, j int) bool {
+		if len(unitNames[i]) != len(unitNames[j]) {
+			return len(unitNames[i]) > len(unitNames[j])
+		}
+		return unitNames[i] < unitNames[j]
+	})
+	return &rules{
+		speller:      s,
+		decimalMarks: decimalMarks,
+		singular:     singular,
+		dates:        regexp.MustCompile(`(\d{4})-(\d{2})-(\d{2})`),
+		clocks:       regexp.MustCompile(clock),
+		currencies:   regexp.MustCompile(`([$€£¥])\s?(` + number + `)|(` + number + `)\s?([$€£¥])`),
+		ordinals:     regexp.MustCompile(`(\d+)` + ordinalSuffixes),
+		decades:      regexp.MustCompile(`([12]\d{2}0)s|'(\d0)s|(\d0)'s`),
+		measures:     regexp.MustCompile(`(-?)(` + number + `)\s?(` + strings.Join(unitNames, "|") + `)`),
+		numbers:      regexp.MustCompile(`(-?)(` + number + `)`),
+	}
+}
+
+// Verbalize expands numbers, ISO dates, clock times, currencies, ordinals and
+// measures into words for the given locale. Unknown locales fall back to English.
+func Verbalize(text string, locale Locale) string {
+	r, found := locales[locale]
+	if !found {
+		r = locales[English]
+	}
+	// order matters: the most specific expressions must be consumed first
+	text = r.replace(text, r.dates, r.verbalizeDate)
+	text = r.replace(text, r.clocks, r.verbalizeClock)
+	text = r.replace(text, r.currencies, r.verbalizeCurrency)
+	text = r.replace(text, r.ordinals, r.verbalizeOrdinal)
+	if locale != French {
+		text = r.replace(text, r.decades, r.verbalizeDecade)
+	}
+	text = r.replace(text, r.measures, r.verbalizeMeasure)
+	text = r.replace(text, r.numbers, r.verbalizeNumber)
+	return text
+}
+
+// replace calls fn for each match of re which is not glued to a surrounding word.
+// fn can refuse a match by returning false, leaving the original text untouched.
+func (r *rules) replace(text string, re *regexp.Regexp, fn func(text string, match []int) (string, bool)) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, match := range matches {
+		start := match[0]
+		if text[start] == '-' {
+			// the sign is checked by fn
+			start++
+		}
+		if !isBoundary(text, start, match[1]) {
+			continue
+		}
+		words, ok := fn(text, match)
+		if !ok {
+			continue
+		}
+		b.WriteString(text[last:match[0]])
+		b.WriteString(words)
+		last = match[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func isBoundary(text string, start, end int) bool {
+	if start > 0 {
+		previous, _ := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsLetter(previous) || unicode.IsDigit(previous) || previous == '.' || previous == ',' {
+			return false
+		}
+	}
+	if end < len(text) {
+		next, size := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsLetter(next) || unicode.IsDigit(next) {
+			return false
+		}
+		// "1.2.3" or "1,2,3" are not numbers we know how to read
+		if (next == '.' || next == ',') && end+size < len(text) {
+			if following, _ := utf8.DecodeRuneInString(text[end+size:]); unicode.IsDigit(following) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *rules) verbalizeDate(text string, match []int) (string, bool) {
+	year, _ := strconv.Atoi(text[match[2]:match[3]])
+	month, _ := strconv.Atoi(text[match[4]:match[5]])
+	day, _ := strconv.Atoi(text[match[6]:match[7]])
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return "", false
+	}
+	return r.date(year, month, day), true
+}
+
+func (r *rules) verbalizeClock(text string, match []int) (string, bool) {
+	hours, _ := strconv.Atoi(text[match[2]:match[3]])
+	minutes, _ := strconv.Atoi(text[match[4]:match[5]])
+	if hours > 23 || minutes > 59 {
+		return "", false
+	}
+	return r.clock(hours, minutes), true
+}
+
+func (r *rules) verbalizeCurrency(text string, match []int) (string, bool) {
+	var symbol, amount string
+	if match[2] >= 0 {
+		symbol, amount = text[match[2]:match[3]], text[match[4]:match[5]]
+	} else {
+		amount, symbol = text[match[6]:match[7]], text[match[8]:match[9]]
+	}
+	integer, fraction, ok := r.parse(amount)
+	if !ok || len(fraction) > 2 {
+		return "", false
+	}
+	var cents int
+	if fraction != "" {
+		cents, _ = strconv.Atoi((fraction + "0")[:2])
+	}
+	symbolRune, _ := utf8.DecodeRuneInString(symbol)
+	return r.currency(symbolRune, integer, cents, fraction != ""), true
+}
+
+func (r *rules) verbalizeOrdinal(text string, match []int) (string, bool) {
+	n, err := strconv.ParseUint(text[match[2]:match[3]], 10, 64)
+	if err != nil {
+		return "", false
+	}
+	words := r.ordinal(n)
+	if words == "premier" && strings.HasSuffix(text[match[4]:match[5]], "re") {
+		words = "première"
+	}
+	return words, true
+}
+
+func (r *rules) verbalizeDecade(text string, match []int) (string, bool) {
+	var decade string
+	for group := 1; group < len(match)/2; group++ {
+		if match[group*2] >= 0 {
+			decade = text[match[group*2]:match[group*2+1]]
+		}
+	}
+	n, err := strconv.ParseUint(decade, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return r.decade(n), true
+}
+
+func (r *rules) verbalizeMeasure(text string, match []int) (string, bool) {
+	u := units[text[match[6]:match[7]]]
+	integer, fraction, ok := r.parse(text[match[4]:match[5]])
+	if !ok {
+		return "", false
+	}
+	value, _ := strconv.ParseFloat(strconv.FormatUint(integer, 10)+"."+fraction+"0", 64)
+	words := r.spell(integer, fraction)
+	if match[3] > match[2] && r.signAllowed(text, match[2]) {
+		words = r.negative(words)
+	}
+	return r.unit(u, words, r.singular(value)), true
+}
+
+func (r *rules) verbalizeNumber(text string, match []int) (string, bool) {
+	raw := text[match[4]:match[5]]
+	integer, fraction, ok := r.parse(raw)
+	if !ok {
+		// too big for us, read it digit by digit
+		return r.digits(strings.Map(keepDigits, raw)), true
+	}
+	words := r.spell(integer, fraction)
+	if match[3] > match[2] {
+		if !r.signAllowed(text, match[2]) {
+			// not a sign but a dash ("5-10"), keep it
+			return "-" + words, true
+		}
+		words = r.negative(words)
+	}
+	return words, true
+}
+
+// signAllowed checks that the dash at position is not glued to a previous word or number.
+func (r *rules) signAllowed(text string, position int) bool {
+	if position == 0 {
+		return true
+	}
+	previous, _ := utf8.DecodeLastRuneInString(text[:position])
+	return unicode.IsSpace(previous) || previous == '(' || previous == '[' || previous == ':'
+}
+
+func (r *rules) spell(integer uint64, fraction string) string {
+	if fraction == "" {
+		return r.cardinal(integer)
+	}
+	return r.decimal(integer, fraction)
+}
+
+// parse splits a locale formatted number into its integer value and fraction digits.
+func (r *rules) parse(number string) (integer uint64, fraction string, ok bool) {
+	if index := strings.IndexAny(number, r.decimalMarks); index >= 0 {
+		number, fraction = number[:index], number[index+1:]
+	}
+	number = strings.Map(keepDigits, number)
+	var err error
+	if integer, err = strconv.ParseUint(number, 10, 64); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func keepDigits(r rune) rune {
+	if unicode.IsDigit(r) {
+		return r
+	}
+	return -1
+}
+
+func plural(singular bool, one, many string) string {
+	if singular {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,76 @@
+package textnorm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVerbalizeEnglish(t *testing.T) {
+	for input, expected := range map[string]string{
+		"It weighs 3.5GB.":            "It weighs three point five gigabytes.",
+		"Due on 2024-06-01 please":    "Due on June first, twenty twenty-four please",
+		"That will be $1,200.":        "That will be one thousand two hundred dollars.",
+		"Only $3.50 left":             "Only three dollars and fifty cents left",
+		"Meet me at 9:05":             "Meet me at nine oh five",
+		"The 21st century":            "The twenty-first century",
+		"Music from the 1980s":        "Music from the nineteen eighties",
+		"It is -5 °C outside":         "It is minus five degrees Celsius outside",
+		"Pages 5-10":                  "Pages five-ten",
+		"Grew by 12% in 1 h":          "Grew by twelve percent in one hour",
+		"Version 1.2.3 and mp3 files": "Version 1.2.3 and mp3 files",
+		"Population: 1000001":         "Population: one million one",
+	} {
+		if got := Verbalize(input, English); got != expected {
+			t.Errorf("Verbalize(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestVerbalizeFrench(t *testing.T) {
+	for input, expected := range map[string]string{
+		"Il pèse 3,5 Go.":        "Il pèse trois virgule cinq gigaoctets.",
+		"Le 2024-06-01":          "Le premier juin deux mille vingt-quatre",
+		"Ça coûte 1 200 €":       "Ça coûte mille deux cents euros",
+		"Rendez-vous à 21h30":    "Rendez-vous à vingt et une heures trente",
+		"Le 1er et la 2e":        "Le premier et la deuxième",
+		"Il y a 80 ans":          "Il y a quatre-vingts ans",
+		"Environ 280000 pommes":  "Environ deux cent quatre-vingt mille pommes",
+		"Soit 71 ou 91 ou 3,05":  "Soit soixante et onze ou quatre-vingt-onze ou trois virgule zéro cinq",
+		"Un budget de 2000000 $": "Un budget de deux millions de dollars",
+	} {
+		if got := Verbalize(input, French); got != expected {
+			t.Errorf("Verbalize(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	input := "# Summary\n\nHere is **bold** and *italic* with a [link](https://example.com) 👍.\n\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n\n- first item\n- second `item`\n\n| a | b |\n|---|---|\n| 1 | 2 |\n"
+	for sanitizer, expected := range map[Sanitizer]string{
+		{}: "Summary.\nHere is bold and italic with a link.\nfirst item\nsecond item\na, b.\n1, 2.",
+		{AnnounceCode: true, Emoji: EmojiVerbalize}: "Summary.\nHere is bold and italic with a link thumbs up.\nCode omitted.\nfirst item\nsecond item\na, b.\n1, 2.",
+	} {
+		if got := sanitizer.Sanitize(input); got != expected {
+			t.Errorf("%+v.Sanitize() = %q, expected %q", sanitizer, got, expected)
+		}
+	}
+}
+
+func TestSplitStyles(t *testing.T) {
+	runs := SplitStyles(`Hello <style name="whisper">this is <emotion name="sad"/>a secret</style>, <emotion name="excited">and this</emotion> is not!`)
+	expected := []StyledText{
+		{Text: "Hello "},
+		{Style: "whisper", Text: "this is "},
+		{Style: "whisper", Emotion: "sad", Text: "a secret"},
+		{Emotion: "sad", Text: ", "},
+		{Emotion: "excited", Text: "and this"},
+		{Emotion: "sad", Text: " is not!"},
+	}
+	if !slices.Equal(runs, expected) {
+		t.Errorf("SplitStyles() = %+v, expected %+v", runs, expected)
+	}
+	if runs = SplitStyles("Plain text"); len(runs) != 1 || runs[0] != (StyledText{Text: "Plain text"}) {
+		t.Errorf("SplitStyles(plain) = %+v", runs)
+	}
+}
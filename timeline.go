@@ -0,0 +1,103 @@
+package krs
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	// maximum number of steps kept per connection (about 11 hours of audio)
+	maxTimelineSteps = 500_000
+	// StepsPerSecond is the rate at which the server processes frames when it keeps up with real time
+	StepsPerSecond = float64(time.Second) / float64(FrameDuration)
+)
+
+// TimelineStep is the server state reported by one Step frame.
+type TimelineStep struct {
+	// At is the reception time, relative to the connection start
+	At    time.Duration
+	Index int
+	// Buffered is the amount of audio received by the server but not processed yet
+	Buffered time.Duration
+}
+
+// Timeline aggregates the Step frames of a STT connection to show how the server kept up with the
+// audio over time: a step rate below StepsPerSecond with a growing buffer points to a model
+// throughput issue while a nominal rate with latency spikes points to the network.
+type Timeline struct {
+	Steps []TimelineStep
+}
+
+// TimelineBucket summarizes the steps received during an interval.
+type TimelineBucket struct {
+	Start          time.Duration
+	StepsPerSecond float64
+	// MaxBuffered is the highest buffered audio reported during the interval
+	MaxBuffered time.Duration
+}
+
+// Duration returns the time between the connection start and the last step.
+func (t Timeline) Duration() time.Duration {
+	if len(t.Steps) == 0 {
+		return 0
+	}
+	return t.Steps[len(t.Steps)-1].At
+}
+
+// StepRate returns the mean number of steps processed per second between the first and the last step.
+func (t Timeline) StepRate() float64 {
+	if len(t.Steps) < 2 {
+		return 0
+	}
+	first, last := t.Steps[0], t.Steps[len(t.Steps)-1]
+	if last.At <= first.At {
+		return 0
+	}
+	return float64(last.Index-first.Index) / (last.At - first.At).Seconds()
+}
+
+// Buckets splits the timeline in intervals of the given duration, starting at the connection start.
+// Intervals without steps are kept (with a zero rate) to show the stalls.
+func (t Timeline) Buckets(interval time.Duration) (buckets []TimelineBucket) {
+	if len(t.Steps) == 0 || interval <= 0 {
+		return
+	}
+	buckets = make([]TimelineBucket, int(t.Duration()/interval)+1)
+	for i := range buckets {
+		buckets[i].Start = time.Duration(i) * interval
+	}
+	previous := -1
+	for _, step := range t.Steps {
+		bucket := &buckets[int(step.At/interval)]
+		// count the steps the server went through, it can skip indexes when catching up
+		if previous >= 0 && step.Index > previous {
+			bucket.StepsPerSecond += float64(step.Index - previous)
+		}
+		previous = step.Index
+		bucket.MaxBuffered = max(bucket.MaxBuffered, step.Buffered)
+	}
+	for i := range buckets {
+		buckets[i].StepsPerSecond /= interval.Seconds()
+	}
+	return
+}
+
+// step records a Step frame read from the wire.
+func (cs *connStats) step(msg MessagePackStep, wire time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if len(cs.timeline.Steps) >= maxTimelineSteps {
+		return
+	}
+	cs.timeline.Steps = append(cs.timeline.Steps, TimelineStep{
+		At:       wire.Sub(cs.origin),
+		Index:    msg.StepIndex,
+		Buffered: msg.BufferDelay(),
+	})
+}
+
+func (cs *connStats) timelineSnapshot() Timeline {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return Timeline{Steps: slices.Clone(cs.timeline.Steps)}
+}
@@ -0,0 +1,34 @@
+package krs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimelineBuckets(t *testing.T) {
+	var timeline Timeline
+	// real time during the first second, then a stall with the buffer growing, then catching up
+	for i := range 12 {
+		timeline.Steps = append(timeline.Steps, TimelineStep{At: time.Duration(i) * FrameDuration, Index: i})
+	}
+	timeline.Steps = append(timeline.Steps,
+		TimelineStep{At: 2500 * time.Millisecond, Index: 12, Buffered: 1500 * time.Millisecond},
+		TimelineStep{At: 2600 * time.Millisecond, Index: 30, Buffered: 80 * time.Millisecond},
+	)
+	buckets := timeline.Buckets(time.Second)
+	if len(buckets) != 3 {
+		t.Fatalf("got %d buckets, expected 3", len(buckets))
+	}
+	if buckets[0].StepsPerSecond != 11 {
+		t.Errorf("first second: got %.1f steps/s, expected 11", buckets[0].StepsPerSecond)
+	}
+	if buckets[1].StepsPerSecond != 0 {
+		t.Errorf("stall: got %.1f steps/s, expected 0", buckets[1].StepsPerSecond)
+	}
+	if buckets[2].StepsPerSecond != 19 || buckets[2].MaxBuffered != 1500*time.Millisecond {
+		t.Errorf("catch up: got %.1f steps/s and %s buffered, expected 19 and 1.5s", buckets[2].StepsPerSecond, buckets[2].MaxBuffered)
+	}
+	if rate := timeline.StepRate(); rate < 11.5 || rate > 11.6 {
+		t.Errorf("got a %.2f steps/s mean rate, expected 30/2.6", rate)
+	}
+}
@@ -0,0 +1,95 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	defaultWriteTimeout = 10 * time.Second
+	// the STT server sends a step for each audio frame, the TTS server is silent while it has no
+	// text to synthesize: it has no default read timeout
+	defaultSTTReadTimeout = 30 * time.Second
+)
+
+// TimeoutError is returned by Done() when a frame could not be written, or no frame has been
+// read, within the configured timeout.
+type TimeoutError struct {
+	// Op is either "read" or "write"
+	Op       string
+	Duration time.Duration
+}
+
+func (te *TimeoutError) Error() string {
+	return fmt.Sprintf("websocket %s timeout after %s", te.Op, te.Duration)
+}
+
+// Timeout allows to check the error like a net.Error.
+func (te *TimeoutError) Timeout() bool {
+	return true
+}
+
+// frameTimeouts bounds each frame operation on the websocket connection, a zero value disables
+// the timeout.
+type frameTimeouts struct {
+	write time.Duration
+	read  time.Duration
+}
+
+// newFrameTimeouts applies the defaults: zero for the default timeout, negative for none.
+func newFrameTimeouts(write, read, defaultRead time.Duration) (ft frameTimeouts) {
+	switch {
+	case write == 0:
+		ft.write = defaultWriteTimeout
+	case write > 0:
+		ft.write = write
+	}
+	switch {
+	case read == 0:
+		ft.read = defaultRead
+	case read > 0:
+		ft.read = read
+	}
+	return
+}
+
+// writeFrame writes a frame, aborting the connection if it takes longer than the write timeout.
+func (ft frameTimeouts) writeFrame(ctx context.Context, abort context.CancelCauseFunc, conn *websocket.Conn,
+	msgType websocket.MessageType, payload []byte) (err error) {
+	if ft.write > 0 {
+		timer := time.AfterFunc(ft.write, func() {
+			abort(&TimeoutError{Op: "write", Duration: ft.write})
+		})
+		defer timer.Stop()
+	}
+	return timeoutCause(ctx, conn.Write(ctx, msgType, payload))
+}
+
+// readFrame reads a frame, aborting the connection if none comes within the read timeout.
+func (ft frameTimeouts) readFrame(ctx context.Context, abort context.CancelCauseFunc, conn *websocket.Conn) (
+	msgType websocket.MessageType, payload []byte, err error) {
+	if ft.read > 0 {
+		timer := time.AfterFunc(ft.read, func() {
+			abort(&TimeoutError{Op: "read", Duration: ft.read})
+		})
+		defer timer.Stop()
+	}
+	msgType, payload, err = conn.Read(ctx)
+	err = timeoutCause(ctx, err)
+	return
+}
+
+// timeoutCause replaces an error by the TimeoutError which aborted the connection, if any: the
+// other workers fail on the closed connection and the first error returned is not always the
+// timeout.
+func timeoutCause(ctx context.Context, err error) error {
+	var te *TimeoutError
+	if err != nil && errors.As(context.Cause(ctx), &te) {
+		return te
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadTimeout(t *testing.T) {
+	server := newMockServer(t)
+	server.stallAfter = 20
+	client, err := NewSTTClient(&STTConfig{URL: server.URL(), ReadTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		for {
+			select {
+			case conn.GetWriteChan() <- make([]float32, FrameSize):
+			case <-conn.GetContext().Done():
+				return
+			}
+		}
+	}()
+	// the read channel is only closed on a clean end
+	func() {
+		for {
+			select {
+			case <-conn.GetReadChan():
+			case <-conn.GetContext().Done():
+				return
+			}
+		}
+	}()
+	var te *TimeoutError
+	if err = conn.Done(); !errors.As(err, &te) || te.Op != "read" {
+		t.Fatalf("expected a read timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package krs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDTMF is returned by DTMF for a character outside of 0-9, A-D, * and #.
+var ErrInvalidDTMF = errors.New("invalid DTMF digit")
+
+const (
+	// DefaultToneAmplitude keeps the tones well below the loudness of the synthesized speech
+	DefaultToneAmplitude = 0.3
+	// fade in and out of the tones, avoiding clicks
+	toneRamp = 5 * time.Millisecond
+)
+
+// DTMF frequencies (Hz) of each digit: row and column of the keypad.
+var dtmfFrequencies = map[rune][2]float64{
+	'1': {697, 1209}, '2': {697, 1336}, '3': {697, 1477}, 'A': {697, 1633},
+	'4': {770, 1209}, '5': {770, 1336}, '6': {770, 1477}, 'B': {770, 1633},
+	'7': {852, 1209}, '8': {852, 1336}, '9': {852, 1477}, 'C': {852, 1633},
+	'*': {941, 1209}, '0': {941, 1336}, '#': {941, 1477}, 'D': {941, 1633},
+}
+
+// Tone returns a sine tone (24kHz mono) faded in and out, amplitude going up to 1.
+func Tone(frequency float64, duration time.Duration, amplitude float32) []float32 {
+	return mixTones([]float64{frequency}, duration, amplitude)
+}
+
+// DualTone returns the sum of two sine tones (24kHz mono), each at half the amplitude: the
+// telephony signals (DTMF, ringback, busy) are pairs of frequencies.
+func DualTone(low, high float64, duration time.Duration, amplitude float32) []float32 {
+	return mixTones([]float64{low, high}, duration, amplitude)
+}
+
+// Silence returns duration of silence (24kHz mono).
+func Silence(duration time.Duration) []float32 {
+	return make([]float32, durationSamples(duration))
+}
+
+// Beep returns a short 1kHz beep, for example to signal the start of a recording.
+func Beep() []float32 {
+	return Tone(1000, 200*time.Millisecond, DefaultToneAmplitude)
+}
+
+// HoldTone returns count repetitions of a tone followed by a pause, a simple hold or waiting
+// signal: HoldTone(440, time.Second, 4*time.Second, 3).
+func HoldTone(frequency float64, tone, pause time.Duration, count int) (pcm []float32) {
+	for range count {
+		pcm = append(pcm, Tone(frequency, tone, DefaultToneAmplitude)...)
+		pcm = append(pcm, Silence(pause)...)
+	}
+	return
+}
+
+// DTMF returns the dual tones of digits (0-9, A-D, * and #, case insensitive, spaces ignored),
+// each lasting tone and followed by gap of silence. 70ms tones and gaps are reliably detected by
+// the telephony equipment.
+func DTMF(digits string, tone, gap time.Duration) (pcm []float32, err error) {
+	for _, digit := range strings.ToUpper(digits) {
+		if digit == ' ' {
+			continue
+		}
+		frequencies, known := dtmfFrequencies[digit]
+		if !known {
+			err = fmt.Errorf("%w: %q", ErrInvalidDTMF, digit)
+			pcm = nil
+			return
+		}
+		pcm = append(pcm, DualTone(frequencies[0], frequencies[1], tone, DefaultToneAmplitude)...)
+		pcm = append(pcm, Silence(gap)...)
+	}
+	return
+}
+
+func mixTones(frequencies []float64, duration time.Duration, amplitude float32) (pcm []float32) {
+	pcm = make([]float32, durationSamples(duration))
+	ramp := min(durationSamples(toneRamp), len(pcm)/2)
+	gain := float64(amplitude) / float64(len(frequencies))
+	for i := range pcm {
+		var sample float64
+		for _, frequency := range frequencies {
+			sample += math.Sin(2 * math.Pi * frequency * float64(i) / SampleRate)
+		}
+		envelope := 1.0
+		if fromEnd := len(pcm) - 1 - i; ramp > 0 && min(i, fromEnd) < ramp {
+			envelope = float64(min(i, fromEnd)) / float64(ramp)
+		}
+		pcm[i] = float32(sample * gain * envelope)
+	}
+	return
+}
+
+func durationSamples(duration time.Duration) int {
+	return max(int(duration*SampleRate/time.Second), 0)
+}
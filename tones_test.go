@@ -0,0 +1,45 @@
+package krs
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// goertzel returns the power of a frequency in pcm.
+func goertzel(pcm []float32, frequency float64) float64 {
+	coefficient := 2 * math.Cos(2*math.Pi*frequency/SampleRate)
+	var previous, beforePrevious float64
+	for _, sample := range pcm {
+		previous, beforePrevious = float64(sample)+coefficient*previous-beforePrevious, previous
+	}
+	return previous*previous + beforePrevious*beforePrevious - coefficient*previous*beforePrevious
+}
+
+func TestDTMF(t *testing.T) {
+	const tone = 70 * time.Millisecond
+	pcm, err := DTMF("5#", tone, tone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toneSamples := durationSamples(tone)
+	if len(pcm) != 4*toneSamples {
+		t.Fatalf("generated %d samples, expected %d", len(pcm), 4*toneSamples)
+	}
+	for i, frequencies := range [][2]float64{dtmfFrequencies['5'], dtmfFrequencies['#']} {
+		digit := pcm[2*i*toneSamples : (2*i+1)*toneSamples]
+		reference := goertzel(digit, frequencies[0])
+		if goertzel(digit, frequencies[1]) < reference/2 {
+			t.Errorf("digit %d: high frequency %g missing", i, frequencies[1])
+		}
+		for _, other := range []float64{697, 852, 1209, 1633} {
+			if other != frequencies[0] && other != frequencies[1] && goertzel(digit, other) > reference/10 {
+				t.Errorf("digit %d: unexpected frequency %g", i, other)
+			}
+		}
+	}
+	if _, err = DTMF("12x", tone, tone); !errors.Is(err, ErrInvalidDTMF) {
+		t.Errorf("expected ErrInvalidDTMF, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package krs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Unicode bidi isolates, they keep the direction of a text from leaking into its surroundings
+	rightToLeftIsolate    = '\u2067'
+	popDirectionalIsolate = '\u2069'
+	// minimum display time of a subtitle whose words have no end time
+	srtMinimumCue = time.Second
+)
+
+var (
+	// scripts written right to left
+	rtlScripts = []*unicode.RangeTable{unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko}
+	// scripts written without spaces between words
+	continuousScripts = []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai,
+		unicode.Lao, unicode.Khmer, unicode.Myanmar}
+)
+
+// Word is a transcribed word with its position in the audio stream.
+type Word struct {
+	Text  string        `json:"text"`
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	// Confidence is the share of the servers of an ensemble agreeing on the word (see
+	// VoteTranscripts), 0 when unknown
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// Utterance is a group of consecutive words ended by a pause of the speaker.
+type Utterance struct {
+	Words []Word `json:"words"`
+	// Labels are set by a Classifier (intent, sentiment...)
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// Text joins the words of the utterance: with spaces, except between words of scripts written
+// without them (Chinese, Japanese, Thai...).
+func (u Utterance) Text() string {
+	var b strings.Builder
+	for i, word := range u.Words {
+		previous, _ := utf8.DecodeLastRuneInString(u.Words[max(i-1, 0)].Text)
+		next, _ := utf8.DecodeRuneInString(word.Text)
+		if i > 0 && !(continuousRune(previous) && continuousRune(next)) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(word.Text)
+	}
+	return b.String()
+}
+
+func (u Utterance) Start() time.Duration {
+	if len(u.Words) == 0 {
+		return 0
+	}
+	return u.Words[0].Start
+}
+
+func (u Utterance) End() time.Duration {
+	if len(u.Words) == 0 {
+		return 0
+	}
+	last := u.Words[len(u.Words)-1]
+	return max(last.End, last.Start)
+}
+
+// Transcript is the result of a transcription. Its rendering methods handle the languages
+// specificities: words joining (see Utterance.Text()) and right to left scripts (Arabic, Hebrew...)
+// isolated to display correctly next to left to right text.
+type Transcript struct {
+	// Tags are the tags of the connection the transcript comes from (see STTConnection.Tags())
+	Tags       Tags        `json:"tags,omitempty"`
+	Utterances []Utterance `json:"utterances"`
+	// Input is the level analysis of the audio transcribed by STTClient.Transcribe()
+	Input *InputLevels `json:"input,omitempty"`
+	ended bool
+}
+
+// AddWord appends a word to the utterance in progress.
+func (t *Transcript) AddWord(word Word) {
+	if len(t.Utterances) == 0 || t.ended {
+		t.Utterances = append(t.Utterances, Utterance{})
+		t.ended = false
+	}
+	current := &t.Utterances[len(t.Utterances)-1]
+	current.Words = append(current.Words, word)
+}
+
+// SetWordEnd sets the end time of the last word (as reported by the EndWord frames).
+func (t *Transcript) SetWordEnd(end time.Duration) {
+	if len(t.Utterances) == 0 {
+		return
+	}
+	current := &t.Utterances[len(t.Utterances)-1]
+	if len(current.Words) > 0 {
+		current.Words[len(current.Words)-1].End = end
+	}
+}
+
+// EndUtterance ends the utterance in progress: the next word starts a new one.
+func (t *Transcript) EndUtterance() {
+	t.ended = true
+}
+
+// Live renders the last utterance, to be displayed on a single line while transcribing.
+func (t Transcript) Live() string {
+	if len(t.Utterances) == 0 {
+		return ""
+	}
+	return isolate(t.Utterances[len(t.Utterances)-1].Text())
+}
+
+// Text renders the transcript as plain text, one line per utterance.
+func (t Transcript) Text() string {
+	lines := make([]string, len(t.Utterances))
+	for i, utterance := range t.Utterances {
+		lines[i] = isolate(utterance.Text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteSRT renders the transcript as SubRip subtitles, one subtitle per utterance.
+func (t Transcript) WriteSRT(w io.Writer) (err error) {
+	var b strings.Builder
+	for i, utterance := range t.Utterances {
+		start := utterance.Start()
+		end := max(utterance.End(), start+srtMinimumCue)
+		if i+1 < len(t.Utterances) {
+			end = min(end, t.Utterances[i+1].Start())
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTimestamp(start), srtTimestamp(end), isolate(utterance.Text()))
+	}
+	if _, err = io.WriteString(w, b.String()); err != nil {
+		err = fmt.Errorf("failed to write the subtitles: %w", err)
+		return
+	}
+	return
+}
+
+// Classify labels the utterances not labeled yet, each within the timeout.
+func (t *Transcript) Classify(ctx context.Context, classifier Classifier, timeout time.Duration) (err error) {
+	for i := range t.Utterances {
+		if t.Utterances[i].Labels != nil {
+			continue
+		}
+		if err = classifyUtterance(ctx, classifier, timeout, &t.Utterances[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// WriteJSON exports the transcript as JSON, tags included (the times are in nanoseconds). It can be
+// loaded back with json.Unmarshal().
+func (t Transcript) WriteJSON(w io.Writer) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(t); err != nil {
+		err = fmt.Errorf("failed to write the transcript: %w", err)
+		return
+	}
+	return
+}
+
+func srtTimestamp(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+// isolate wraps right to left text in bidi isolates. The direction is given by the first strong
+// character (Unicode bidi rule P2).
+func isolate(text string) string {
+	for _, r := range text {
+		switch {
+		case unicode.In(r, rtlScripts...):
+			return string(rightToLeftIsolate) + text + string(popDirectionalIsolate)
+		case unicode.IsLetter(r):
+			return text
+		}
+	}
+	return text
+}
+
+func continuousRune(r rune) bool {
+	// CJK punctuation and full width forms do not take spaces either
+	return unicode.In(r, continuousScripts...) || (r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
@@ -0,0 +1,256 @@
+package krs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscriptRendering(t *testing.T) {
+	var transcript Transcript
+	for i, text := range []string{"Hello", "world"} {
+		transcript.AddWord(Word{Text: text, Start: time.Duration(i) * time.Second})
+	}
+	transcript.SetWordEnd(1500 * time.Millisecond)
+	transcript.EndUtterance()
+	for i, text := range []string{"東京", "に", "行きます", "Tokyo"} {
+		transcript.AddWord(Word{Text: text, Start: 2*time.Second + time.Duration(i)*100*time.Millisecond})
+	}
+	transcript.EndUtterance()
+	transcript.AddWord(Word{Text: "مرحبا", Start: 3 * time.Second})
+	transcript.AddWord(Word{Text: "بالعالم", Start: 3500 * time.Millisecond})
+
+	expected := "Hello world\n東京に行きます Tokyo\n\u2067مرحبا بالعالم\u2069"
+	if text := transcript.Text(); text != expected {
+		t.Errorf("unexpected text:\n%q\nexpected:\n%q", text, expected)
+	}
+	if live := transcript.Live(); live != "\u2067مرحبا بالعالم\u2069" {
+		t.Errorf("unexpected live line: %q", live)
+	}
+	var srt strings.Builder
+	if err := transcript.WriteSRT(&srt); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(srt.String(), "1\n00:00:00,000 --> 00:00:01,500\nHello world\n\n2\n00:00:02,000 --> 00:00:03,000\n") {
+		t.Errorf("unexpected subtitles:\n%s", srt.String())
+	}
+}
+
+func TestTranscriptMerge(t *testing.T) {
+	var transcript Transcript
+	for i, text := range strings.Fields("the quick brown fax jumps over the lazy lazy dog") {
+		start := time.Duration(i) * time.Second
+		transcript.AddWord(Word{Text: text, Start: start, End: start + 500*time.Millisecond})
+		if i == 4 {
+			transcript.EndUtterance()
+		}
+	}
+	corrected := "The quick brown fox jumps\nover the very lazy dog."
+	edits := transcript.Diff(corrected)
+	var kinds []EditKind
+	for _, edit := range edits {
+		kinds = append(kinds, edit.Kind)
+	}
+	expected := []EditKind{EditSubstitute, EditEqual, EditEqual, EditSubstitute, EditEqual,
+		EditEqual, EditEqual, EditDelete, EditInsert, EditEqual, EditSubstitute}
+	if !slices.Equal(kinds, expected) {
+		// the duplicated "lazy" can be aligned either way
+		expected[7], expected[8] = EditSubstitute, EditDelete
+		if !slices.Equal(kinds, slices.Delete(slices.Clone(expected), 8, 9)) {
+			t.Errorf("unexpected edits: %v", kinds)
+		}
+	}
+	if wer := WordErrorRate(edits); wer <= 0 || wer > 0.3 {
+		t.Errorf("unexpected word error rate: %.2f", wer)
+	}
+
+	merged := transcript.Merge(corrected)
+	if text := merged.Text(); text != corrected {
+		t.Errorf("unexpected merged text:\n%s", text)
+	}
+	// the corrected word keeps its timing, the inserted one is placed before the next word
+	if fox := merged.Utterances[0].Words[3]; fox.Start != 3*time.Second {
+		t.Errorf("unexpected corrected word timing: %+v", fox)
+	}
+	for i, word := range merged.Utterances[1].Words[1:] {
+		if previous := merged.Utterances[1].Words[i]; word.Start < previous.Start {
+			t.Errorf("words out of order: %+v after %+v", word, previous)
+		}
+	}
+}
+
+func TestExtractAudio(t *testing.T) {
+	// a ramp: each sample is its index
+	pcm := make([]float32, 2*SampleRate)
+	for i := range pcm {
+		pcm[i] = float32(i)
+	}
+	var transcript Transcript
+	transcript.AddWord(Word{Text: "hello", Start: STTStreamOffset + time.Second, End: STTStreamOffset + 1500*time.Millisecond})
+	transcript.AddWord(Word{Text: "world", Start: STTStreamOffset + 2*time.Second})
+	clip := transcript.ExtractWords(pcm, transcript.Utterances[0].Words, 500*time.Millisecond)
+	if clip.Text != "hello world" || clip.Start != STTStreamOffset+500*time.Millisecond {
+		t.Errorf("unexpected clip: %q from %s", clip.Text, clip.Start)
+	}
+	// the end is clamped to the audio
+	if len(clip.PCM) != SampleRate*3/2 || clip.PCM[0] != SampleRate/2 || clip.PCM[len(clip.PCM)-1] != float32(len(pcm)-1) {
+		t.Errorf("unexpected clip audio: %d samples from %.0f", len(clip.PCM), clip.PCM[0])
+	}
+	if cut := transcript.ExtractAudio(pcm, 0, STTStreamOffset); cut != nil {
+		t.Errorf("unexpected audio before the stream start: %d samples", len(cut))
+	}
+}
+
+func TestTranscriptExports(t *testing.T) {
+	var transcript Transcript
+	transcript.AddWord(Word{Text: "Hello,", Start: 2 * time.Second, End: 2500 * time.Millisecond})
+	transcript.AddWord(Word{Text: "world", Start: 2600 * time.Millisecond})
+	transcript.EndUtterance()
+	transcript.AddWord(Word{Text: "bye", Start: 4 * time.Second, End: 4300 * time.Millisecond})
+	transcript = transcript.Shift(-STTStreamOffset)
+
+	var whisper bytes.Buffer
+	if err := transcript.WriteWhisperJSON(&whisper); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Text     string `json:"text"`
+		Segments []struct {
+			Start float64 `json:"start"`
+			Words []struct {
+				Word string  `json:"word"`
+				End  float64 `json:"end"`
+			} `json:"words"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(whisper.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Text != " Hello, world bye" || len(decoded.Segments) != 2 || decoded.Segments[1].Start != 3 {
+		t.Errorf("unexpected whisper JSON: %+v", decoded)
+	}
+	// the last word of an utterance without end ends when it starts
+	if word := decoded.Segments[0].Words[1]; word.Word != " world" || word.End != 1.6 {
+		t.Errorf("unexpected whisper word: %+v", word)
+	}
+
+	var csv bytes.Buffer
+	if err := transcript.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	expected := "utterance,start,end,word\n1,1.000,1.500,\"Hello,\"\n1,1.600,1.600,world\n2,3.000,3.300,bye\n"
+	if csv.String() != expected {
+		t.Errorf("unexpected CSV:\n%s", csv.String())
+	}
+
+	var otr bytes.Buffer
+	if err := transcript.WriteOTR(&otr, "call.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(otr.String(), `data-timestamp=\"3.000\">00:03</span> bye`) {
+		t.Errorf("unexpected OTR document: %s", otr.String())
+	}
+
+	var labels bytes.Buffer
+	if err := transcript.WriteAudacityLabels(&labels, false); err != nil {
+		t.Fatal(err)
+	}
+	expected = "1.000000\t1.600000\tHello, world\n3.000000\t3.300000\tbye\n"
+	if labels.String() != expected {
+		t.Errorf("unexpected labels:\n%s", labels.String())
+	}
+
+	var assembly bytes.Buffer
+	if err := transcript.WriteAssemblyAIJSON(&assembly); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{
+  "status": "completed",
+  "text": "Hello, world bye",
+  "words": [
+    {
+      "text": "Hello,",
+      "start": 1000,
+      "end": 1500,
+      "confidence": 1
+    },
+    {
+      "text": "world",
+      "start": 1600,
+      "end": 1600,
+      "confidence": 1
+    },
+    {
+      "text": "bye",
+      "start": 3000,
+      "end": 3300,
+      "confidence": 1
+    }
+  ]
+}
+`
+	if assembly.String() != expected {
+		t.Errorf("unexpected AssemblyAI JSON:\n%s", assembly.String())
+	}
+
+	var edl bytes.Buffer
+	if err := transcript.WriteEDL(&edl, EDLConfig{Clip: "call.wav", TimelineStart: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	expected = `TITLE: Transcript
+FCM: NON-DROP FRAME
+
+001  AX       A     C        00:00:01:00 00:00:01:15 01:00:01:00 01:00:01:15
+* FROM CLIP NAME: call.wav
+* Hello, world
+
+002  AX       A     C        00:00:03:00 00:00:03:08 01:00:03:00 01:00:03:08
+* FROM CLIP NAME: call.wav
+* bye
+`
+	if edl.String() != expected {
+		t.Errorf("unexpected EDL:\n%s", edl.String())
+	}
+	// the event numbers have three digits
+	var long Transcript
+	for i := range 1000 {
+		long.AddWord(Word{Text: "word", Start: time.Duration(i) * time.Second})
+		long.EndUtterance()
+	}
+	if err := long.WriteEDL(io.Discard, EDLConfig{}); err == nil {
+		t.Error("wrote an EDL of 1000 events")
+	}
+	long.Utterances = long.Utterances[:999]
+	if err := long.WriteEDL(io.Discard, EDLConfig{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestImportWhisperJSON(t *testing.T) {
+	var transcript Transcript
+	transcript.AddWord(Word{Text: "Hello,", Start: 2 * time.Second, End: 2500 * time.Millisecond})
+	transcript.AddWord(Word{Text: "world", Start: 2600 * time.Millisecond, End: 3 * time.Second})
+	var exported bytes.Buffer
+	if err := transcript.Shift(-STTStreamOffset).WriteWhisperJSON(&exported); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportWhisperJSON(&exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(imported.Utterances[0].Words, transcript.Utterances[0].Words) {
+		t.Errorf("unexpected words imported back: %+v", imported.Utterances)
+	}
+	// without word timestamps, the words are spread over their segment
+	imported, err = ImportWhisperJSON(strings.NewReader(`{"segments": [{"start": 1, "end": 2, "text": " Good morning"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words := imported.Utterances[0].Words; len(words) != 2 || words[1].Start != 2500*time.Millisecond || words[1].End != 3*time.Second {
+		t.Errorf("unexpected words of a segment: %+v", words)
+	}
+}
@@ -0,0 +1,348 @@
+package krs
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EditKind tells how a word of a machine transcript was corrected.
+type EditKind int
+
+const (
+	// EditEqual is a word left untouched
+	EditEqual EditKind = iota
+	// EditSubstitute is a word replaced (including case and punctuation changes)
+	EditSubstitute
+	// EditInsert is a word missing from the machine transcript
+	EditInsert
+	// EditDelete is a word removed from the machine transcript
+	EditDelete
+)
+
+func (ek EditKind) String() string {
+	switch ek {
+	case EditEqual:
+		return "equal"
+	case EditSubstitute:
+		return "substitute"
+	case EditInsert:
+		return "insert"
+	case EditDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// WordEdit is a step of the alignment of a machine transcript with its corrected version.
+type WordEdit struct {
+	Kind EditKind
+	// Word is the machine word with its timing (zero for an insertion)
+	Word Word
+	// Text is the corrected word (empty for a deletion)
+	Text string
+	// Utterance is the index of the corrected utterance (line) of the word, the one of the previous
+	// corrected word for a deletion
+	Utterance int
+}
+
+// Diff aligns the words of the transcript with a corrected version of its text, one line per
+// utterance as rendered by Text(). Words are matched case and punctuation insensitively, they are
+// split on spaces: a corrected text of a language written without them is compared per utterance.
+func (t Transcript) Diff(corrected string) (edits []WordEdit) {
+	var machine []Word
+	for _, utterance := range t.Utterances {
+		machine = append(machine, utterance.Words...)
+	}
+	// the corrected words and the index of their utterance (the lines with words)
+	var (
+		texts      []string
+		utterances []int
+		utterance  int
+	)
+	for line := range strings.Lines(corrected) {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		for _, word := range words {
+			texts = append(texts, word)
+			utterances = append(utterances, utterance)
+		}
+		utterance++
+	}
+	machineKeys := make([]string, len(machine))
+	for i, word := range machine {
+		machineKeys[i] = matchKey(word.Text)
+	}
+	correctedKeys := make([]string, len(texts))
+	for i, text := range texts {
+		correctedKeys[i] = matchKey(text)
+	}
+	var current int
+	for _, op := range alignWords(machineKeys, correctedKeys, 0, 0, nil) {
+		edit := WordEdit{Kind: op.kind, Utterance: current}
+		if op.machine >= 0 {
+			edit.Word = machine[op.machine]
+		}
+		if op.corrected >= 0 {
+			edit.Text = texts[op.corrected]
+			edit.Utterance = utterances[op.corrected]
+			current = edit.Utterance
+		}
+		if edit.Kind == EditEqual && edit.Word.Text != edit.Text {
+			edit.Kind = EditSubstitute
+		}
+		edits = append(edits, edit)
+	}
+	return
+}
+
+// Merge applies a corrected version of the text (see Diff()) to the transcript: the corrected lines
+// become the utterances, the words kept or replaced keep their timing and the inserted ones are
+// spread between their neighbours.
+func (t Transcript) Merge(corrected string) (merged Transcript) {
+	merged.Tags = t.Tags
+	edits := t.Diff(corrected)
+	for i := 0; i < len(edits); i++ {
+		edit := edits[i]
+		switch edit.Kind {
+		case EditDelete:
+			continue
+		case EditInsert:
+			// spread the run of inserted words between the surrounding timed words
+			run := i
+			for run < len(edits) && edits[run].Kind != EditEqual && edits[run].Kind != EditSubstitute {
+				run++
+			}
+			var from, to time.Duration
+			previous := lastMergedWord(merged)
+			if previous != nil {
+				from = max(previous.End, previous.Start)
+			}
+			switch {
+			case run < len(edits) && previous != nil:
+				to = max(edits[run].Word.Start, from)
+			case run < len(edits):
+				// at the start, the words are stacked on the first timed one
+				from = edits[run].Word.Start
+				to = from
+			default:
+				to = from
+			}
+			var inserted []WordEdit
+			for _, e := range edits[i:run] {
+				if e.Kind == EditInsert {
+					inserted = append(inserted, e)
+				}
+			}
+			step := (to - from) / time.Duration(len(inserted))
+			for k, e := range inserted {
+				merged.appendWord(e.Utterance, Word{
+					Text:  e.Text,
+					Start: from + time.Duration(k)*step,
+					End:   from + time.Duration(k+1)*step,
+				})
+			}
+			i = run - 1
+		default:
+			word := edit.Word
+			word.Text = edit.Text
+			merged.appendWord(edit.Utterance, word)
+		}
+	}
+	return
+}
+
+// appendWord adds a word to an utterance, creating it if needed.
+func (t *Transcript) appendWord(utterance int, word Word) {
+	for len(t.Utterances) <= utterance {
+		t.Utterances = append(t.Utterances, Utterance{})
+	}
+	t.Utterances[utterance].Words = append(t.Utterances[utterance].Words, word)
+}
+
+func lastMergedWord(t Transcript) *Word {
+	for i := len(t.Utterances) - 1; i >= 0; i-- {
+		if words := t.Utterances[i].Words; len(words) > 0 {
+			return &words[len(words)-1]
+		}
+	}
+	return nil
+}
+
+// WordErrorRate returns the word error rate of an alignment: the substitutions, insertions and
+// deletions over the number of corrected words (case and punctuation changes are not errors).
+func WordErrorRate(edits []WordEdit) float64 {
+	var mistakes, reference int
+	for _, edit := range edits {
+		if edit.Kind != EditDelete {
+			reference++
+		}
+		if edit.Kind != EditEqual && !(edit.Kind == EditSubstitute && matchKey(edit.Word.Text) == matchKey(edit.Text)) {
+			mistakes++
+		}
+	}
+	if reference == 0 {
+		return 0
+	}
+	return float64(mistakes) / float64(reference)
+}
+
+// matchKey is the form of a word compared when aligning: lower case letters and digits.
+func matchKey(word string) string {
+	key := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, word)
+	if key == "" {
+		// punctuation only
+		return word
+	}
+	return key
+}
+
+// alignment operation, -1 for the missing side of an insertion or a deletion
+type alignOp struct {
+	kind      EditKind
+	machine   int
+	corrected int
+}
+
+// alignWords aligns two sequences of words (patience diff): the words unique to both sides anchor
+// the alignment and the gaps between them are aligned by edit distance.
+func alignWords(a, b []string, aOffset, bOffset int, ops []alignOp) []alignOp {
+	// common prefix and suffix
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, alignOp{EditEqual, aOffset + prefix, bOffset + prefix})
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	aOffset, bOffset = aOffset+prefix, bOffset+prefix
+	if anchors := uniqueAnchors(middleA, middleB); len(anchors) > 0 {
+		var fromA, fromB int
+		for _, anchor := range anchors {
+			ops = alignWords(middleA[fromA:anchor[0]], middleB[fromB:anchor[1]], aOffset+fromA, bOffset+fromB, ops)
+			ops = append(ops, alignOp{EditEqual, aOffset + anchor[0], bOffset + anchor[1]})
+			fromA, fromB = anchor[0]+1, anchor[1]+1
+		}
+		ops = alignWords(middleA[fromA:], middleB[fromB:], aOffset+fromA, bOffset+fromB, ops)
+	} else {
+		ops = editDistanceAlign(middleA, middleB, aOffset, bOffset, ops)
+	}
+	for i := range suffix {
+		ops = append(ops, alignOp{EditEqual, aOffset + len(middleA) + i, bOffset + len(middleB) + i})
+	}
+	return ops
+}
+
+// uniqueAnchors returns the longest increasing sequence of the pairs of words occurring once in
+// each side.
+func uniqueAnchors(a, b []string) (anchors [][2]int) {
+	count := func(words []string) map[string]int {
+		positions := make(map[string]int, len(words))
+		for i, word := range words {
+			if _, seen := positions[word]; seen {
+				positions[word] = -1
+			} else {
+				positions[word] = i
+			}
+		}
+		return positions
+	}
+	inA, inB := count(a), count(b)
+	var pairs [][2]int
+	for i, word := range a {
+		if inA[word] == i {
+			if j, found := inB[word]; found && j >= 0 {
+				pairs = append(pairs, [2]int{i, j})
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	// longest increasing subsequence on b positions (patience sorting)
+	var (
+		tails    []int // index in pairs of the smallest tail of each length
+		previous = make([]int, len(pairs))
+	)
+	for p, pair := range pairs {
+		length, _ := slices.BinarySearchFunc(tails, pair[1], func(tail, target int) int {
+			return pairs[tail][1] - target
+		})
+		if length > 0 {
+			previous[p] = tails[length-1]
+		} else {
+			previous[p] = -1
+		}
+		if length == len(tails) {
+			tails = append(tails, p)
+		} else {
+			tails[length] = p
+		}
+	}
+	anchors = make([][2]int, len(tails))
+	for p, k := tails[len(tails)-1], len(tails)-1; p >= 0; p, k = previous[p], k-1 {
+		anchors[k] = pairs[p]
+	}
+	return
+}
+
+// editDistanceAlign aligns two (short) sequences of words minimizing the substitutions, insertions
+// and deletions.
+func editDistanceAlign(a, b []string, aOffset, bOffset int, ops []alignOp) []alignOp {
+	costs := make([][]int, len(a)+1)
+	for i := range costs {
+		costs[i] = make([]int, len(b)+1)
+		costs[i][0] = i
+	}
+	for j := range costs[0] {
+		costs[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			substitution := costs[i-1][j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			costs[i][j] = min(substitution, costs[i-1][j]+1, costs[i][j-1]+1)
+		}
+	}
+	// backtrack
+	var path []alignOp
+	for i, j := len(a), len(b); i > 0 || j > 0; {
+		switch {
+		case i > 0 && j > 0 && costs[i][j] == costs[i-1][j-1]+boolCost(a[i-1] != b[j-1]):
+			kind := EditEqual
+			if a[i-1] != b[j-1] {
+				kind = EditSubstitute
+			}
+			i, j = i-1, j-1
+			path = append(path, alignOp{kind, aOffset + i, bOffset + j})
+		case i > 0 && costs[i][j] == costs[i-1][j]+1:
+			i--
+			path = append(path, alignOp{EditDelete, aOffset + i, -1})
+		default:
+			j--
+			path = append(path, alignOp{EditInsert, -1, bOffset + j})
+		}
+	}
+	slices.Reverse(path)
+	return append(ops, path...)
+}
+
+func boolCost(different bool) int {
+	if different {
+		return 1
+	}
+	return 0
+}
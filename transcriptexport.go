@@ -0,0 +1,303 @@
+package krs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shift returns a copy of the transcript with all its timings moved by offset, for example
+// Shift(-STTStreamOffset) for times relative to the start of the transcribed audio file as the
+// tools consuming the exports expect. Negative times are clamped to zero.
+func (t Transcript) Shift(offset time.Duration) (shifted Transcript) {
+	shifted.Tags = t.Tags
+	shifted.Input = t.Input
+	shifted.ended = t.ended
+	shifted.Utterances = make([]Utterance, len(t.Utterances))
+	for i, utterance := range t.Utterances {
+		shifted.Utterances[i].Labels = utterance.Labels
+		shifted.Utterances[i].Words = make([]Word, len(utterance.Words))
+		for j, word := range utterance.Words {
+			word.Start = max(word.Start+offset, 0)
+			if word.End != 0 {
+				word.End = max(word.End+offset, 0)
+			}
+			shifted.Utterances[i].Words[j] = word
+		}
+	}
+	return
+}
+
+// WriteWhisperJSON exports the transcript in the JSON format of OpenAI Whisper (verbose_json with
+// word timestamps), one segment per utterance. The fields Kyutai does not provide (tokens,
+// probabilities) are set to neutral values.
+func (t Transcript) WriteWhisperJSON(w io.Writer) (err error) {
+	type whisperWord struct {
+		Word        string  `json:"word"`
+		Start       float64 `json:"start"`
+		End         float64 `json:"end"`
+		Probability float64 `json:"probability"`
+	}
+	type whisperSegment struct {
+		ID               int           `json:"id"`
+		Seek             int           `json:"seek"`
+		Start            float64       `json:"start"`
+		End              float64       `json:"end"`
+		Text             string        `json:"text"`
+		Tokens           []int         `json:"tokens"`
+		Temperature      float64       `json:"temperature"`
+		AvgLogprob       float64       `json:"avg_logprob"`
+		CompressionRatio float64       `json:"compression_ratio"`
+		NoSpeechProb     float64       `json:"no_speech_prob"`
+		Words            []whisperWord `json:"words"`
+	}
+	var (
+		text     strings.Builder
+		segments = make([]whisperSegment, 0, len(t.Utterances))
+	)
+	for _, utterance := range t.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		// whisper texts start with the space separating them from the previous one
+		segment := whisperSegment{
+			ID:     len(segments),
+			Start:  utterance.Start().Seconds(),
+			End:    utterance.End().Seconds(),
+			Text:   " " + utterance.Text(),
+			Tokens: []int{},
+			Words:  make([]whisperWord, len(utterance.Words)),
+		}
+		for i, word := range utterance.Words {
+			segment.Words[i] = whisperWord{
+				Word:        " " + word.Text,
+				Start:       word.Start.Seconds(),
+				End:         wordEnd(utterance, i).Seconds(),
+				Probability: 1,
+			}
+		}
+		text.WriteString(segment.Text)
+		segments = append(segments, segment)
+	}
+	return writeExportJSON(w, struct {
+		Text     string           `json:"text"`
+		Segments []whisperSegment `json:"segments"`
+		Language string           `json:"language"`
+	}{
+		Text:     text.String(),
+		Segments: segments,
+	})
+}
+
+// WriteAssemblyAIJSON exports the transcript in the JSON format of the AssemblyAI transcripts:
+// the text and the words with their times in milliseconds.
+func (t Transcript) WriteAssemblyAIJSON(w io.Writer) (err error) {
+	type assemblyWord struct {
+		Text       string  `json:"text"`
+		Start      int64   `json:"start"`
+		End        int64   `json:"end"`
+		Confidence float64 `json:"confidence"`
+	}
+	words := make([]assemblyWord, 0)
+	for _, utterance := range t.Utterances {
+		for i, word := range utterance.Words {
+			confidence := word.Confidence
+			if confidence == 0 {
+				confidence = 1
+			}
+			words = append(words, assemblyWord{
+				Text:       word.Text,
+				Start:      word.Start.Milliseconds(),
+				End:        wordEnd(utterance, i).Milliseconds(),
+				Confidence: confidence,
+			})
+		}
+	}
+	var lines []string
+	for _, utterance := range t.Utterances {
+		if len(utterance.Words) > 0 {
+			lines = append(lines, utterance.Text())
+		}
+	}
+	return writeExportJSON(w, struct {
+		Status string         `json:"status"`
+		Text   string         `json:"text"`
+		Words  []assemblyWord `json:"words"`
+	}{
+		Status: "completed",
+		Text:   strings.Join(lines, " "),
+		Words:  words,
+	})
+}
+
+// WriteOTR exports the transcript as an oTranscribe document, one paragraph per utterance starting
+// with a clickable timestamp. media is the name of the audio file it goes with.
+func (t Transcript) WriteOTR(w io.Writer, media string) (err error) {
+	var text strings.Builder
+	for _, utterance := range t.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		start := utterance.Start()
+		fmt.Fprintf(&text, `<p><span class="timestamp" data-timestamp="%s">%02d:%02d</span> %s</p>`,
+			strconv.FormatFloat(start.Seconds(), 'f', 3, 64), int(start.Minutes()), int(start.Seconds())%60,
+			html.EscapeString(isolate(utterance.Text())),
+		)
+	}
+	return writeExportJSON(w, struct {
+		Text      string  `json:"text"`
+		Media     string  `json:"media"`
+		MediaTime float64 `json:"media-time"`
+	}{
+		Text:  text.String(),
+		Media: media,
+	})
+}
+
+// WriteCSV exports the words as CSV, one per line with their utterance number and their times in
+// seconds: utterance,start,end,word.
+func (t Transcript) WriteCSV(w io.Writer) (err error) {
+	writer := csv.NewWriter(w)
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+	}
+	if err = writer.Write([]string{"utterance", "start", "end", "word"}); err != nil {
+		err = fmt.Errorf("failed to write the CSV header: %w", err)
+		return
+	}
+	for u, utterance := range t.Utterances {
+		for i, word := range utterance.Words {
+			if err = writer.Write([]string{
+				strconv.Itoa(u + 1), seconds(word.Start), seconds(wordEnd(utterance, i)), word.Text,
+			}); err != nil {
+				err = fmt.Errorf("failed to write the CSV: %w", err)
+				return
+			}
+		}
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		err = fmt.Errorf("failed to write the CSV: %w", err)
+		return
+	}
+	return
+}
+
+// WriteAudacityLabels exports the transcript as an Audacity label track (File > Import > Labels),
+// one label per utterance spanning it, or one per word with words set. Most audio editors import
+// the same tab separated format to jump to the spoken phrases.
+func (t Transcript) WriteAudacityLabels(w io.Writer, words bool) (err error) {
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+	}
+	for _, utterance := range t.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		if !words {
+			if _, err = fmt.Fprintf(w, "%s\t%s\t%s\n", seconds(utterance.Start()), seconds(utterance.End()), utterance.Text()); err != nil {
+				err = fmt.Errorf("failed to write the labels: %w", err)
+				return
+			}
+			continue
+		}
+		for i, word := range utterance.Words {
+			if _, err = fmt.Fprintf(w, "%s\t%s\t%s\n", seconds(word.Start), seconds(wordEnd(utterance, i)), word.Text); err != nil {
+				err = fmt.Errorf("failed to write the labels: %w", err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// maxEDLEvents is the last event number of a CMX 3600 edit decision list.
+const maxEDLEvents = 999
+
+// EDLConfig is the configuration of Transcript.WriteEDL.
+type EDLConfig struct {
+	// Title of the edit decision list (default "Transcript")
+	Title string
+	// Clip is the name of the audio file the events refer to
+	Clip string
+	// FrameRate is the timecode frame rate, non drop frame (default 25)
+	FrameRate int
+	// TimelineStart is the timecode of the start of the timeline the events are placed on, the
+	// editors commonly start them at one hour
+	TimelineStart time.Duration
+}
+
+// WriteEDL exports the transcript as a CMX 3600 edit decision list: one audio event per utterance,
+// cut from the clip at its times and placed on the timeline at the same times, with the text of
+// the utterance as a comment. The video editors (Premiere, Resolve, Avid...) import it to jump to
+// the spoken phrases. The event numbers have three digits: it fails beyond 999 utterances, to be
+// split in several lists.
+func (t Transcript) WriteEDL(w io.Writer, config EDLConfig) (err error) {
+	if config.Title == "" {
+		config.Title = "Transcript"
+	}
+	if config.FrameRate <= 0 {
+		config.FrameRate = 25
+	}
+	frame := time.Second / time.Duration(config.FrameRate)
+	timecode := func(frames int64) string {
+		fps := int64(config.FrameRate)
+		return fmt.Sprintf("%02d:%02d:%02d:%02d", frames/(3600*fps), frames/(60*fps)%60, frames/fps%60, frames%fps)
+	}
+	flatten := strings.NewReplacer("\r", " ", "\n", " ")
+	var edl strings.Builder
+	fmt.Fprintf(&edl, "TITLE: %s\nFCM: NON-DROP FRAME\n", flatten.Replace(config.Title))
+	var event int
+	for _, utterance := range t.Utterances {
+		if len(utterance.Words) == 0 {
+			continue
+		}
+		if event++; event > maxEDLEvents {
+			err = fmt.Errorf("failed to write the EDL: more than %d utterances, the limit of its event numbers", maxEDLEvents)
+			return
+		}
+		in := int64((utterance.Start() + frame/2) / frame)
+		out := max(int64((utterance.End()+frame/2)/frame), in+1)
+		offset := int64((config.TimelineStart + frame/2) / frame)
+		fmt.Fprintf(&edl, "\n%03d  AX       A     C        %s %s %s %s\n", event,
+			timecode(in), timecode(out), timecode(offset+in), timecode(offset+out))
+		if config.Clip != "" {
+			fmt.Fprintf(&edl, "* FROM CLIP NAME: %s\n", flatten.Replace(config.Clip))
+		}
+		fmt.Fprintf(&edl, "* %s\n", flatten.Replace(utterance.Text()))
+	}
+	if _, err = io.WriteString(w, edl.String()); err != nil {
+		err = fmt.Errorf("failed to write the EDL: %w", err)
+		return
+	}
+	return
+}
+
+// wordEnd returns the end of a word of an utterance: the start of the next word, or its own start
+// for the last one, if the server did not report it.
+func wordEnd(utterance Utterance, word int) time.Duration {
+	if end := utterance.Words[word].End; end > 0 {
+		return end
+	}
+	if word+1 < len(utterance.Words) {
+		return utterance.Words[word+1].Start
+	}
+	return utterance.Words[word].Start
+}
+
+func writeExportJSON(w io.Writer, value any) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	// keep the OTR markup readable
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(value); err != nil {
+		err = fmt.Errorf("failed to write the transcript: %w", err)
+		return
+	}
+	return
+}
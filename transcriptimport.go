@@ -0,0 +1,81 @@
+package krs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportWhisperJSON loads a transcript in the JSON format of OpenAI Whisper (verbose_json, with or
+// without word timestamps), one utterance per segment. The words of the segments without word
+// timestamps are spread over the segment. The times are shifted by STTStreamOffset to be stream
+// times, like those of a transcription (see Shift()).
+func ImportWhisperJSON(r io.Reader) (transcript Transcript, err error) {
+	var whisper struct {
+		Segments []struct {
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+			Text  string  `json:"text"`
+			Words []struct {
+				Word  string  `json:"word"`
+				Start float64 `json:"start"`
+				End   float64 `json:"end"`
+			} `json:"words"`
+		} `json:"segments"`
+	}
+	if err = json.NewDecoder(r).Decode(&whisper); err != nil {
+		err = fmt.Errorf("failed to decode the whisper JSON: %w", err)
+		return
+	}
+	seconds := func(s float64) time.Duration {
+		return time.Duration(s*float64(time.Second)) + STTStreamOffset
+	}
+	for _, segment := range whisper.Segments {
+		var utterance Utterance
+		if len(segment.Words) > 0 {
+			for _, word := range segment.Words {
+				if text := strings.TrimSpace(word.Word); text != "" {
+					utterance.Words = append(utterance.Words, Word{Text: text, Start: seconds(word.Start), End: seconds(word.End)})
+				}
+			}
+		} else {
+			words := strings.Fields(segment.Text)
+			start, end := seconds(segment.Start), seconds(segment.End)
+			for i, text := range words {
+				utterance.Words = append(utterance.Words, Word{
+					Text:  text,
+					Start: start + (end-start)*time.Duration(i)/time.Duration(len(words)),
+					End:   start + (end-start)*time.Duration(i+1)/time.Duration(len(words)),
+				})
+			}
+		}
+		if len(utterance.Words) > 0 {
+			transcript.Utterances = append(transcript.Utterances, utterance)
+		}
+	}
+	return
+}
+
+// ImportText loads a plain text transcript, one utterance per non empty line. The words have no
+// timings: align it against its audio with STTClient.Align().
+func ImportText(r io.Reader) (transcript Transcript, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var utterance Utterance
+		for _, text := range strings.Fields(scanner.Text()) {
+			utterance.Words = append(utterance.Words, Word{Text: text})
+		}
+		if len(utterance.Words) > 0 {
+			transcript.Utterances = append(transcript.Utterances, utterance)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("failed to read the text: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,99 @@
+package krs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Translator translates the text of finished utterances into a language (a code like "fr" or
+// "de"), with a local model or a remote service: plug it in a CaptionOverlay to show live
+// translated captions.
+type Translator interface {
+	Translate(ctx context.Context, text, language string) (string, error)
+}
+
+// TranslatorFunc turns a function into a Translator.
+type TranslatorFunc func(ctx context.Context, text, language string) (string, error)
+
+func (tf TranslatorFunc) Translate(ctx context.Context, text, language string) (string, error) {
+	return tf(ctx, text, language)
+}
+
+// HTTPTranslator queries a translation service with the LibreTranslate API, posting each text as
+// JSON:
+//
+//	{"q": "Good morning everyone", "source": "auto", "target": "fr", "format": "text"}
+//
+// The service answers the translation as {"translatedText": "Bonjour à tous"}.
+type HTTPTranslator struct {
+	// URL of the translation endpoint, for example http://127.0.0.1:5000/translate
+	URL string
+	// Source is the language of the texts (default "auto": detected by the service)
+	Source string
+	// APIKey, if set, is sent in the request as the service expects it
+	APIKey string
+	// Header is added to the requests (authentication)
+	Header http.Header
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Retry is the policy retrying the requests failing on the network or on a server error
+	// (defaults to DefaultRetryPolicy, within the time budget)
+	Retry *RetryPolicy
+}
+
+func (ht HTTPTranslator) Translate(ctx context.Context, text, language string) (translation string, err error) {
+	source := ht.Source
+	if source == "" {
+		source = "auto"
+	}
+	body, err := json.Marshal(struct {
+		Query  string `json:"q"`
+		Source string `json:"source"`
+		Target string `json:"target"`
+		Format string `json:"format"`
+		APIKey string `json:"api_key,omitempty"`
+	}{
+		Query:  text,
+		Source: source,
+		Target: language,
+		Format: "text",
+		APIKey: ht.APIKey,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to encode the text: %w", err)
+		return
+	}
+	policy := DefaultRetryPolicy
+	if ht.Retry != nil {
+		policy = *ht.Retry
+	}
+	var resp *http.Response
+	if err = policy.Do(ctx, func(ctx context.Context) (err error) {
+		resp, err = postJSON(ctx, ht.Client, ht.URL, ht.Header, "translator", body)
+		return
+	}); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		err = fmt.Errorf("failed to decode the translator answer: %w", err)
+		return
+	}
+	return answer.TranslatedText, nil
+}
+
+// translateText translates a text within a time budget.
+func translateText(ctx context.Context, translator Translator, timeout time.Duration, text, language string) (translation string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if translation, err = translator.Translate(ctx, text, language); err != nil {
+		err = fmt.Errorf("failed to translate the caption to %s: %w", language, err)
+	}
+	return
+}
@@ -4,25 +4,132 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/coder/websocket"
-	"golang.org/x/sync/errgroup"
+	"github.com/hekmon/kyutai-rs/textnorm"
 )
 
 type TTSConfig struct {
 	URL    string
 	APIKey string
 	Voice  string
+	// Locale is used to verbalize numbers, dates and units in Synthesize (defaults to English)
+	Locale textnorm.Locale
+	// Sanitizer, if set, cleans up LLM output (Markdown, code, emoji) in Synthesize
+	Sanitizer *textnorm.Sanitizer
+	// VoiceGallery, if set, is used by Connect to check the voice exists before connecting: the
+	// server only fails opaquely on an unknown voice. A gallery unavailable (offline) is ignored.
+	VoiceGallery *VoiceGallery
+	// StyleCapabilities lists the styles and emotions the server supports, WithStyle() and
+	// WithEmotion() fail with ErrUnsupportedStyle outside of them (the Kyutai server does not
+	// support any: its voices are recorded in a style).
+	StyleCapabilities *StyleCapabilities
+	// RealtimeGuard, if set, reports the server producing audio slower than real time
+	RealtimeGuard *RealtimeGuard
+	// Cache, if set, stores the audio of Synthesize and of the Speaker utterances, which are not
+	// synthesized again for the same voice, style and text (see MemoryCache and FileCache)
+	Cache SynthesisCache
+	// TextEcho tells what to do with the Text frames the server sends back for each word synthesized
+	TextEcho TextEchoMode
+	// Format is the wire format of the frames (defaults to WireFormatMessagePack)
+	Format WireFormat
+	// Formats, if set, are negotiated with the server instead of using Format: the connections use
+	// the first of them the server accepts (rejecting the others during the handshake), remembered
+	// by the client for its next connections. WithFormat() skips the negotiation.
+	Formats []WireFormat
+	// Base64Frames wraps the binary frames in base64 text frames, for proxies mangling the binary
+	// websocket traffic. The server is told with the encoding=base64 query parameter.
+	Base64Frames bool
+	// WriteTimeout bounds the write of each frame (defaults to 10s, negative for none)
+	WriteTimeout time.Duration
+	// ReadTimeout is the longest the server can stay silent (none by default: the server does not
+	// send anything while it has no text to synthesize)
+	ReadTimeout time.Duration
+	// MaxSessionDuration, if set, ends the stream of the connections this long after they were
+	// opened, as if the input was closed, to protect the server from a stuck producer. The server
+	// still synthesizes the text sent until then, Done() returns ErrMaxSessionDuration.
+	MaxSessionDuration time.Duration
+	// MaxUtteranceDuration, if set, ends the utterances (see BeginUtterance) held longer than this:
+	// their next writes fail with ErrMaxUtteranceDuration and the next producer goes on.
+	MaxUtteranceDuration time.Duration
+	// SendAhead, if set, paces the text of the connections by the synthesized audio: a word is only
+	// sent while the text sent ahead of the audio received is shorter than this much speech
+	// (estimated with the speaking rate of the voice, a few words are always sent ahead). The
+	// producers are held instead of queuing a long input on the server, which keeps the prosody
+	// natural. 5s to 10s works well.
+	SendAhead time.Duration
+	// DecodeWorkers, if set, reads the frames ahead and decodes the Audio frames on this many
+	// goroutines, delivering them in order: on slow CPUs (Raspberry Pi...) the decoding of large
+	// audio frames no longer delays the reading of the next frames. By default the frames are
+	// decoded one after the other as they are read.
+	DecodeWorkers int
+	// PowerSaver sends the TCP keepalives every few minutes instead of every 15s, for the radio and
+	// battery efficiency of mobile and IoT devices.
+	PowerSaver bool
+	// Network, if set, simulates a degraded network (testing only)
+	Network *NetworkConditions
+	// Tags are attached to all the connections of the client, see WithTags() to tag a connection
+	Tags Tags
+	// Retry is the policy retrying the websocket handshake of the connections when the server can
+	// not be reached or fails (defaults to DefaultRetryPolicy), WithRetry() overrides it
+	Retry *RetryPolicy
 }
 
+// TextEchoMode tells how the Text frames echoed by the TTS server are delivered.
+type TextEchoMode int
+
+const (
+	// TextEchoDeliver delivers the Text frames on the read channel with the audio (default)
+	TextEchoDeliver TextEchoMode = iota
+	// TextEchoSuppress discards the Text frames: the read channel only delivers the Ready and Audio frames
+	TextEchoSuppress
+	// TextEchoSeparate delivers the Text frames on the channel returned by GetTextChan(), which must
+	// be read as well as the read channel
+	TextEchoSeparate
+)
+
 func NewTTSClient(config *TTSConfig) (client *TTSClient, err error) {
 	// Create the client
 	client = &TTSClient{
-		apiKey: config.APIKey,
+		apiKey:        config.APIKey,
+		locale:        config.Locale,
+		sanitizer:     config.Sanitizer,
+		voice:         config.Voice,
+		gallery:       config.VoiceGallery,
+		capabilities:  config.StyleCapabilities,
+		textEcho:      config.TextEcho,
+		realtimeGuard: config.RealtimeGuard,
+		httpClient:    newHTTPClient(config.Network, config.PowerSaver),
+		tags:          maps.Clone(config.Tags),
+		maxSession:    config.MaxSessionDuration,
+		maxUtterance:  config.MaxUtteranceDuration,
+		sendAhead:     config.SendAhead,
+		decodeWorkers: config.DecodeWorkers,
+		cache:         config.Cache,
+		retry:         config.Retry,
+	}
+	if client.locale == "" {
+		client.locale = textnorm.English
+	}
+	if client.codec, err = newCodec(config.Format, config.Base64Frames); err != nil {
+		return
+	}
+	if client.formats, err = newFormatNegotiator(config.Formats, config.Base64Frames); err != nil {
+		return
 	}
+	if client.formats != nil {
+		client.codec = client.formats.codecs[0]
+	}
+	client.timeouts = newFrameTimeouts(config.WriteTimeout, config.ReadTimeout, 0)
 	// Prepare the URL
 	if client.url, err = url.Parse(config.URL); err != nil {
 		err = fmt.Errorf("failed to parse the URL: %w", err)
@@ -33,44 +140,287 @@ func NewTTSClient(config *TTSConfig) (client *TTSClient, err error) {
 	if config.Voice != "" {
 		parameters.Set("voice", config.Voice)
 	}
-	parameters.Set("format", "PcmMessagePack")
+	parameters.Set("format", string(client.codec.format()))
+	if config.Base64Frames {
+		parameters.Set("encoding", "base64")
+	}
 	client.url.RawQuery = parameters.Encode()
 	// Preparations done
 	return
 }
 
 type TTSClient struct {
-	url    *url.URL
-	apiKey string
+	url           *url.URL
+	apiKey        string
+	locale        textnorm.Locale
+	sanitizer     *textnorm.Sanitizer
+	voice         string
+	gallery       *VoiceGallery
+	capabilities  *StyleCapabilities
+	textEcho      TextEchoMode
+	realtimeGuard *RealtimeGuard
+	codec         codec
+	formats       *formatNegotiator
+	timeouts      frameTimeouts
+	httpClient    *http.Client
+	tags          Tags
+	maxSession    time.Duration
+	maxUtterance  time.Duration
+	sendAhead     time.Duration
+	decodeWorkers int
+	cache         SynthesisCache
+	retry         *RetryPolicy
 }
 
-func (client *TTSClient) Connect(ctx context.Context) (ttsc TTSConnection, err error) {
-	// Prepare the websocket client
-	if ttsc.conn, _, err = websocket.Dial(ctx, client.url.String(), &websocket.DialOptions{
-		HTTPHeader: http.Header{
-			"kyutai-api-key": []string{client.apiKey},
-		},
-		// TODO
-	}); err != nil {
-		err = fmt.Errorf("failed to dial websocket: %w", err)
+// Synthesize is a one shot helper: it sanitizes and verbalizes text, opens a connection,
+// streams the text and returns the complete synthesized audio once the server is done.
+// With TTSConfig.MaxSessionDuration, the partial audio is returned along with
+// ErrMaxSessionDuration.
+//
+// Inline style and emotion switches (see textnorm.SplitStyles) are synthesized with a connection
+// per run, they must be supported by the server (see TTSConfig.StyleCapabilities).
+func (client *TTSClient) Synthesize(ctx context.Context, text string) (pcm []float32, err error) {
+	return client.synthesizeStyled(ctx, text, nil)
+}
+
+// synthesizeStyled is Synthesize with another voice than the client one, if voice is set.
+func (client *TTSClient) synthesizeStyled(ctx context.Context, text string, voice *string) (pcm []float32, err error) {
+	runs := textnorm.SplitStyles(text)
+	if len(runs) == 1 && runs[0].Style == "" && runs[0].Emotion == "" {
+		return client.synthesize(ctx, text, connectOptions{voice: voice})
+	}
+	// Validate all the runs before synthesizing anything
+	for _, run := range runs {
+		if err = (connectOptions{style: Style(run.Style), emotion: Emotion(run.Emotion)}).validateStyle(client.capabilities); err != nil {
+			return
+		}
+	}
+	for _, run := range runs {
+		var runPCM []float32
+		runPCM, err = client.synthesize(ctx, run.Text, connectOptions{voice: voice, style: Style(run.Style), emotion: Emotion(run.Emotion)})
+		pcm = append(pcm, runPCM...)
+		if err != nil {
+			if !errors.Is(err, ErrMaxSessionDuration) {
+				pcm = nil
+			}
+			return
+		}
+	}
+	return
+}
+
+// synthesize is Synthesize for a single run of text.
+func (client *TTSClient) synthesize(ctx context.Context, text string, opts connectOptions) (pcm []float32, err error) {
+	text = client.normalize(text)
+	var key string
+	if client.cache != nil {
+		voice := client.voice
+		if opts.voice != nil {
+			voice = *opts.voice
+		}
+		key = client.synthesisKey(voice, opts, text)
+		if cached, ok := client.cache.Get(key); ok {
+			return cached, nil
+		}
+	}
+	// Open a connection
+	ttsc, err := client.connect(ctx, TextEchoSuppress, opts)
+	if err != nil {
+		err = fmt.Errorf("failed to connect: %w", err)
+		return
+	}
+	connCtx := ttsc.GetContext()
+	// Send the normalized text word by word
+	go streamWords(connCtx, ttsc.GetWriteChan(), text)
+	// Collect the audio
+	receiver := ttsc.GetReadChan()
+receive:
+	for {
+		select {
+		case <-connCtx.Done():
+			break receive
+		case msg, open := <-receiver:
+			if !open {
+				break receive
+			}
+			if audio, ok := msg.(MessagePackAudio); ok {
+				pcm = append(pcm, audio.PCM...)
+			}
+		}
+	}
+	if err = ttsc.Done(); err != nil {
+		if !errors.Is(err, ErrMaxSessionDuration) {
+			pcm = nil
+		}
 		return
 	}
+	if client.cache != nil {
+		client.cache.Put(key, pcm)
+	}
+	return
+}
+
+// normalize applies the client text preprocessing (sanitizer and verbalization).
+func (client *TTSClient) normalize(text string) string {
+	if client.sanitizer != nil {
+		text = client.sanitizer.Sanitize(text)
+	}
+	return textnorm.Verbalize(text, client.locale)
+}
+
+// streamWords sends text word by word then closes the sender to end the stream.
+func streamWords(ctx context.Context, sender chan<- string, text string) {
+	defer close(sender)
+	for word := range strings.FieldsSeq(text) {
+		select {
+		case <-ctx.Done():
+			return
+		case sender <- word:
+		}
+	}
+}
+
+// Connect opens a connection, tagged with the client tags and the ones carried by ctx (see
+// WithTags()). The options (WithVoice(), WithFormat(), WithRetry(), WithStyle()...) only
+// apply to this connection.
+func (client *TTSClient) Connect(ctx context.Context, opts ...ConnectOption) (ttsc *TTSConnection, err error) {
+	return client.connect(ctx, client.textEcho, newConnectOptions(opts))
+}
+
+// ConnectWithVoice opens a connection synthesizing another voice than the client one.
+//
+// Deprecated: use Connect(ctx, WithVoice(voice)).
+func (client *TTSClient) ConnectWithVoice(ctx context.Context, voice string, opts ...ConnectOption) (ttsc *TTSConnection, err error) {
+	return client.Connect(ctx, append(opts, WithVoice(voice))...)
+}
+
+// connect opens a connection with a specific text echo mode, the library helpers only need the
+// audio.
+func (client *TTSClient) connect(ctx context.Context, textEcho TextEchoMode, opts connectOptions) (ttsc *TTSConnection, err error) {
+	if opts.retry == nil {
+		opts.retry = client.retry
+	}
+	voice := client.voice
+	if opts.voice != nil {
+		voice = *opts.voice
+	}
+	// Check the style and the voice
+	if err = opts.validateStyle(client.capabilities); err != nil {
+		return
+	}
+	if client.gallery != nil && voice != "" {
+		if err = client.gallery.Validate(ctx, voice); errors.Is(err, ErrUnknownVoice) {
+			return
+		}
+		err = nil
+	}
+	ttsc = &TTSConnection{state: newStateMachine()}
+	// Prepare the websocket client
+	address := func(c codec) string {
+		return client.connectionURL(voice, c, opts)
+	}
+	if ttsc.conn, ttsc.codec, err = dialFormat(ctx, client.formats, client.codec, address,
+		client.apiKey, client.httpClient, opts); err != nil {
+		return nil, err
+	}
 	// Prepare the channels
 	ttsc.writerChan = make(chan string)
+	ttsc.markerChan = make(chan int64)
+	ttsc.writerDone = make(chan struct{})
 	ttsc.readerChan = make(chan MessagePack)
+	ttsc.textEcho = textEcho
+	ttsc.realtime = newRealtimeMonitor(client.realtimeGuard)
+	if ttsc.textEcho == TextEchoSeparate {
+		ttsc.textChan = make(chan MessagePackText)
+	}
+	ttsc.stats = newConnStats(client.tags.merge(TagsFromContext(ctx)))
+	ttsc.flow = newFlowControl()
+	ttsc.ready = new(readyState)
+	ttsc.input = newInputLock()
+	ttsc.utterances = new(utteranceTracker)
+	ttsc.markers = new(markerTracker)
+	ttsc.pacer = newTextPacer(client.sendAhead)
+	ttsc.limit = &sessionLimit{max: client.maxSession}
+	ttsc.maxUtterance = client.maxUtterance
+	ttsc.stereo = opts.stereo
+	ttsc.timeouts = client.timeouts
 	// Start workers
-	ttsc.workers, ttsc.workersCtx = errgroup.WithContext(ctx)
-	ttsc.workers.Go(ttsc.writer)
-	ttsc.workers.Go(ttsc.reader)
+	ttsc.closeCtx, ttsc.cancel = context.WithCancelCause(ctx)
+	ttsc.workers, ttsc.workersCtx = newWorkerGroup(ttsc.closeCtx)
+	ttsc.inputCtx, ttsc.stopInput = context.WithCancel(ttsc.workersCtx)
+	if client.decodeWorkers > 0 {
+		ttsc.decoder = newDecodePool(ttsc.workersCtx, client.decodeWorkers, ttsc.codec,
+			func() (websocket.MessageType, []byte, error) {
+				return ttsc.timeouts.readFrame(ttsc.workersCtx, ttsc.cancel, ttsc.conn)
+			})
+	}
+	ttsc.workers.Go(recovered(ttsc.writer))
+	ttsc.workers.Go(recovered(ttsc.reader))
+	go ttsc.stats.measureRTT(ttsc.workersCtx, ttsc.conn)
+	go ttsc.state.end(ttsc.workersCtx, ttsc.workers.Wait)
 	return
 }
 
+// connectionURL returns the URL of the server for a voice, the codec and the options of a
+// connection.
+func (client *TTSClient) connectionURL(voice string, c codec, opts connectOptions) string {
+	if voice == client.voice && c == client.codec && opts.style == "" && opts.emotion == "" {
+		return client.url.String()
+	}
+	custom := *client.url
+	parameters := custom.Query()
+	if voice != "" {
+		parameters.Set("voice", voice)
+	} else {
+		parameters.Del("voice")
+	}
+	parameters.Set("format", string(c.format()))
+	if opts.style != "" {
+		parameters.Set("style", string(opts.style))
+	}
+	if opts.emotion != "" {
+		parameters.Set("emotion", string(opts.emotion))
+	}
+	custom.RawQuery = parameters.Encode()
+	return custom.String()
+}
+
 type TTSConnection struct {
 	conn       *websocket.Conn
-	workers    *errgroup.Group
+	workers    *workerGroup
 	workersCtx context.Context
+	// closeCtx outlives a clean end, until Close or the end of the parent context
+	closeCtx context.Context
+	cancel   context.CancelCauseFunc
+	// the writer side stops once the server is done
+	inputCtx   context.Context
+	stopInput  context.CancelFunc
 	writerChan chan string
+	markerChan chan int64
+	writerDone chan struct{}
 	readerChan chan MessagePack
+	textEcho   TextEchoMode
+	realtime   *realtimeMonitor
+	codec      codec
+	timeouts   frameTimeouts
+	textChan   chan MessagePackText
+	stats      *connStats
+	flow       *flowControl
+	ready      *readyState
+	state      *stateMachine
+	input      *inputLock
+	utterances *utteranceTracker
+	markers    *markerTracker
+	pacer      *textPacer
+	limit      *sessionLimit
+	// markers are synthesized client side
+	markerIDsGen atomic.Int64
+	// maximum duration of the utterances
+	maxUtterance time.Duration
+	// nil for mono
+	stereo *stereoPan
+	// nil to decode the frames on the reader goroutine
+	decoder *decodePool
 }
 
 func (ttsc *TTSConnection) GetContext() context.Context {
@@ -85,8 +435,70 @@ func (ttsc *TTSConnection) GetReadChan() <-chan MessagePack {
 	return ttsc.readerChan
 }
 
+// GetTextChan returns the channel of the Text frames echoed by the server when the client has been
+// configured with TextEchoSeparate (nil otherwise). It is closed with the read channel.
+func (ttsc *TTSConnection) GetTextChan() <-chan MessagePackText {
+	return ttsc.textChan
+}
+
+// ReadyInfo returns the metadata of the server Ready frame, received is false until the Ready
+// frame has been read (it is delivered on the read channel right after).
+func (ttsc *TTSConnection) ReadyInfo() (info ReadyInfo, received bool) {
+	return ttsc.ready.get()
+}
+
+// Format returns the wire format of the connection, the negotiated one with the Formats of the
+// client configuration.
+func (ttsc *TTSConnection) Format() WireFormat {
+	return ttsc.codec.format()
+}
+
+// Channels returns the channel count of the Audio frames delivered: NumChannels, or
+// StereoChannels for a connection opened WithStereo().
+func (ttsc *TTSConnection) Channels() int {
+	if ttsc.stereo != nil {
+		return StereoChannels
+	}
+	return NumChannels
+}
+
+// FlowControl notifies the flow control states requested by the server (only the latest state
+// is kept if it is not read in time). While paused, the write channel is not read anymore: the
+// producer can use it to stop generating data instead of blocking on the channel.
+func (ttsc *TTSConnection) FlowControl() <-chan FlowState {
+	return ttsc.flow.events
+}
+
+// State returns the current state of the connection.
+func (ttsc *TTSConnection) State() ConnState {
+	return ttsc.state.get()
+}
+
+// Subscribe returns a channel receiving the state transitions of the connection, starting with
+// the ones already done. It is closed after the terminal state (ConnClosed or ConnFailed). The
+// channel is buffered but a subscriber not reading in time loses its oldest events.
+func (ttsc *TTSConnection) Subscribe() <-chan StateEvent {
+	return ttsc.state.subscribe()
+}
+
+// Tags returns a copy of the tags of the connection.
+func (ttsc *TTSConnection) Tags() Tags {
+	return ttsc.stats.tags()
+}
+
+// Stats returns the timing measurements of the connection so far.
+func (ttsc *TTSConnection) Stats() Stats {
+	return ttsc.stats.snapshot()
+}
+
+// WriteTrace exports the per frame timestamps of the connection as a Chrome tracing JSON file.
+func (ttsc *TTSConnection) WriteTrace(w io.Writer) error {
+	return ttsc.stats.writeTrace(w)
+}
+
 func (ttsc *TTSConnection) Done() (err error) {
 	if err = ttsc.workers.Wait(); err != nil {
+		err = timeoutCause(ttsc.workersCtx, err)
 		var code websocket.StatusCode
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			code = websocket.StatusGoingAway
@@ -97,47 +509,89 @@ func (ttsc *TTSConnection) Done() (err error) {
 		return
 	}
 	// else no need to close the websocket as the server will close it as soon as the last audio bit has been received
+	return ttsc.limit.err()
+}
+
+// Close stops the workers and closes the websocket without waiting for the server. A connection
+// must end with either Done() or Close(): Close can be deferred right after Connect as it is a no-op
+// once the connection ended, the error of the workers is only reported by Done().
+func (ttsc *TTSConnection) Close() (err error) {
+	ttsc.cancel(ErrConnectionClosed)
+	_ = ttsc.workers.Wait()
+	if err = ttsc.conn.CloseNow(); errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
 	return
 }
 
 func (ttsc *TTSConnection) writer() (err error) {
 	var (
-		input   string
-		open    bool
-		payload []byte
+		input    string
+		open     bool
+		payload  []byte
+		msgType  MessagePackType
+		queuedAt time.Time
 	)
+	defer close(ttsc.writerDone)
+	limit, stopLimit := ttsc.limit.timer()
+	defer stopLimit()
 	for {
 		select {
+		case markerID := <-ttsc.markerChan:
+			ttsc.markers.mark(markerID)
+			continue
+		case <-limit:
+			// end the stream as if the input was closed
+			ttsc.limit.reached.Store(true)
+			input, open = "", false
 		case input, open = <-ttsc.writerChan:
-			// Prepare the pack message
-			if open {
-				msg := MessagePackText{
-					Type: MessagePackTypeText,
-					Text: input,
-				}
-				if payload, err = msg.MarshalMsg(nil); err != nil {
-					err = fmt.Errorf("failed to marshal message pack: %w", err)
-					return
-				}
-			} else {
-				msg := MessagePackHeader{
-					Type: MessagePackTypeEoS,
-				}
-				if payload, err = msg.MarshalMsg(nil); err != nil {
-					err = fmt.Errorf("failed to marshal message pack: %w", err)
-					return
-				}
+		case <-ttsc.inputCtx.Done():
+			return
+		}
+		queuedAt = time.Now()
+		// Prepare the pack message
+		if open {
+			msgType = MessagePackTypeText
+			msg := MessagePackText{
+				Type: MessagePackTypeText,
+				Text: input,
 			}
-			// Send the msg
-			if err = ttsc.conn.Write(ttsc.workersCtx, websocket.MessageBinary, payload); err != nil {
-				err = fmt.Errorf("failed to write message into the websocket connection: %w", err)
+			if payload, err = ttsc.codec.marshal(msg); err != nil {
 				return
 			}
-			// exit if end of user input
-			if !open {
+		} else {
+			msgType = MessagePackTypeEoS
+			msg := MessagePackHeader{
+				Type: MessagePackTypeEoS,
+			}
+			if payload, err = ttsc.codec.marshal(msg); err != nil {
 				return
 			}
-		case <-ttsc.workersCtx.Done():
+		}
+		// Send the msg
+		if err = ttsc.flow.wait(ttsc.inputCtx); err != nil {
+			return nil // stopped while paused, the error is reported by the failing worker
+		}
+		if open {
+			if err = ttsc.pacer.wait(ttsc.inputCtx, input); err != nil {
+				return nil // stopped while pacing, the error is reported by the failing worker
+			}
+		}
+		wireStart := time.Now()
+		if err = ttsc.timeouts.writeFrame(ttsc.workersCtx, ttsc.cancel, ttsc.conn, ttsc.codec.frameType(), payload); err != nil {
+			err = fmt.Errorf("failed to write message into the websocket connection: %w", err)
+			return
+		}
+		ttsc.stats.sent(msgType, len(payload), queuedAt, wireStart, time.Now())
+		if open {
+			ttsc.markers.written(input)
+			ttsc.stats.ttsText(input, queuedAt, wireStart)
+			ttsc.state.set(ConnStreaming, nil)
+		} else {
+			ttsc.state.set(ConnDraining, nil)
+		}
+		// exit if end of user input
+		if !open {
 			return
 		}
 	}
@@ -148,53 +602,140 @@ func (ttsc *TTSConnection) reader() (err error) {
 		msgType websocket.MessageType
 		payload []byte
 		msgPack MessagePackHeader
+		wire    time.Time
+		samples int // audio received so far
 	)
+	defer ttsc.stats.endUtterance()
+	// once the server is done, the writer side has nothing left to do
+	defer ttsc.stopInput()
+	var frame *pooledFrame
 	for {
-		// Read a message on the websocket connection
-		if msgType, payload, err = ttsc.conn.Read(ttsc.workersCtx); err != nil {
+		// Read a message on the websocket connection (or the next one read ahead)
+		if ttsc.decoder != nil {
+			if frame, err = ttsc.decoder.next(ttsc.workersCtx); frame != nil {
+				msgType, payload = frame.msgType, frame.payload
+			}
+		} else {
+			msgType, payload, err = ttsc.timeouts.readFrame(ttsc.workersCtx, ttsc.cancel, ttsc.conn)
+		}
+		if err != nil {
 			var ce websocket.CloseError
 			if errors.As(err, &ce) && ce.Code == websocket.StatusNoStatusRcvd {
 				// regular close from the server
 				err = nil
-				// close chan when exiting to inform user we are done
+				// the audio of all the words has been delivered
+				if err = ttsc.deliverMarkers(ttsc.markers.flush()); err != nil {
+					return
+				}
+				// close chans when exiting to inform user we are done
 				close(ttsc.readerChan)
+				if ttsc.textChan != nil {
+					close(ttsc.textChan)
+				}
+			} else {
+				err = ttsc.flow.readError(err)
 			}
 			return
 		}
+		wire = time.Now()
+		if frame != nil {
+			wire = frame.wire
+		}
+		// any frame means the server is ready, even without a Ready frame
+		ttsc.state.set(ConnReady, nil)
 		// Act based on message
 		switch msgType {
-		case websocket.MessageText:
-			return fmt.Errorf("received an unexpected text message: %s", string(payload))
-		case websocket.MessageBinary:
+		case ttsc.codec.frameType():
 			// Identify the payload
-			if _, err = msgPack.UnmarshalMsg(payload); err != nil {
-				err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+			if err = ttsc.codec.unmarshal(payload, &msgPack); err != nil {
 				return
 			}
 			// Unmarshal in the correct type and send it
 			switch msgPack.Type {
 			case MessagePackTypeReady:
-				// no extra fields
-				ttsc.readerChan <- msgPack
+				var info ReadyInfo
+				if info, err = parseReady(ttsc.codec, payload); err != nil {
+					return
+				}
+				ttsc.ready.set(info)
+				// delivered as a header, the metadata is available with ReadyInfo()
+				if err = ttsc.deliver(msgPack); err != nil {
+					return
+				}
 			case MessagePackTypeText:
 				var msgPackText MessagePackText
-				if _, err = msgPackText.UnmarshalMsg(payload); err != nil {
-					err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+				if err = ttsc.codec.unmarshal(payload, &msgPackText); err != nil {
 					return
 				}
-				ttsc.readerChan <- msgPackText
+				ttsc.pacer.textEchoed()
+				// the audio of the words before the markers has been delivered
+				if err = ttsc.deliverMarkers(ttsc.markers.reached(msgPackText.Text)); err != nil {
+					return
+				}
+				// the frames following the word belong to its utterance
+				if id, changed := ttsc.utterances.echoed(msgPackText.Text); changed {
+					if err = ttsc.deliver(MessagePackUtterance{Type: MessagePackTypeUtterance, ID: id}); err != nil {
+						return
+					}
+				}
+				switch ttsc.textEcho {
+				case TextEchoSuppress:
+				case TextEchoSeparate:
+					select {
+					case ttsc.textChan <- msgPackText:
+					case <-ttsc.workersCtx.Done():
+						return ttsc.workersCtx.Err()
+					}
+				default:
+					if err = ttsc.deliver(msgPackText); err != nil {
+						return
+					}
+				}
 			case MessagePackTypeAudio:
-				var msgPackAudio MessagePackAudio
-				if _, err = msgPackAudio.UnmarshalMsg(payload); err != nil {
-					err = fmt.Errorf("failed to unmarshal the message pack: %w", err)
+				msgPackAudio, decoded, decodeErr := frame.decodedAudio(ttsc.workersCtx)
+				if !decoded {
+					decodeErr = ttsc.codec.unmarshal(payload, &msgPackAudio)
+				}
+				if err = decodeErr; err != nil {
+					return
+				}
+				samples += len(msgPackAudio.PCM)
+				if ttsc.stereo != nil {
+					msgPackAudio.PCM = ttsc.stereo.render(msgPackAudio.PCM)
+				}
+				if err = ttsc.deliver(msgPackAudio); err != nil {
+					return
+				}
+				ttsc.stats.ttsAudio(wire, time.Now())
+				received := time.Duration(samples) * time.Second / SampleRate
+				ttsc.stats.audioReceived(received, wire)
+				ttsc.pacer.audioReceived(received)
+				if err = ttsc.realtime.update(wire, received, false); err != nil {
 					return
 				}
-				ttsc.readerChan <- msgPackAudio
+			case MessagePackTypePause:
+				ttsc.flow.set(FlowPaused)
+			case MessagePackTypeResume:
+				ttsc.flow.set(FlowResumed)
 			default:
 				return fmt.Errorf("unexpected message pack type identifier: %s", msgPack.Type)
 			}
+			ttsc.stats.received(msgPack.Type, len(payload), wire, time.Now())
+		case websocket.MessageText:
+			// not the wire format: most likely an error message
+			return fmt.Errorf("received an unexpected text message: %s", string(payload))
 		default:
 			return fmt.Errorf("unexpected websocket message type: %d", msgType)
 		}
 	}
 }
+
+// deliver hands over a message to the user without blocking forever if the user stopped reading.
+func (ttsc *TTSConnection) deliver(msg MessagePack) (err error) {
+	select {
+	case ttsc.readerChan <- msg:
+	case <-ttsc.workersCtx.Done():
+		err = ttsc.workersCtx.Err()
+	}
+	return
+}
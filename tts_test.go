@@ -0,0 +1,630 @@
+package krs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTTSTextEchoSeparate(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), TextEcho: TextEchoSeparate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go streamWords(conn.GetContext(), conn.GetWriteChan(), "one two three")
+	texts := make(chan []string)
+	go func() {
+		var received []string
+		for text := range conn.GetTextChan() {
+			received = append(received, text.Text)
+		}
+		texts <- received
+	}()
+	var frames int
+	for msg := range conn.GetReadChan() {
+		switch msg.(type) {
+		case MessagePackText:
+			t.Error("text echo delivered on the read channel")
+		case MessagePackAudio:
+			frames++
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if received := <-texts; len(received) != 3 || frames != 3 {
+		t.Errorf("got %d texts and %d audio frames, expected 3 of each", len(received), frames)
+	}
+}
+
+func TestTTSStreamFrom(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, output := io.Pipe()
+	streamed := make(chan error, 1)
+	go func() {
+		streamed <- conn.StreamFrom(input, ChunkLines)
+	}()
+	// the first line must be sent before the input ends
+	if _, err = io.WriteString(output, "one two\n"); err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for msg := range conn.GetReadChan() {
+		if text, ok := msg.(MessagePackText); ok {
+			texts = append(texts, text.Text)
+			if len(texts) == 1 {
+				_, _ = io.WriteString(output, "\nthree")
+				_ = output.Close()
+			}
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-streamed; err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(texts, []string{"one two", "three"}) {
+		t.Errorf("got texts %q, expected the two non empty lines", texts)
+	}
+}
+
+func TestTTSConcurrentProducers(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const producers = 8
+	var wg sync.WaitGroup
+	for producer := range producers {
+		wg.Go(func() {
+			text := fmt.Sprintf("a%[1]d b%[1]d c%[1]d d%[1]d", producer)
+			if err := conn.Send(context.Background(), text); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		if err := conn.CloseInput(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+	var texts []string
+	for msg := range conn.GetReadChan() {
+		if text, ok := msg.(MessagePackText); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 4*producers {
+		t.Fatalf("got %d texts, expected %d", len(texts), 4*producers)
+	}
+	// the words of each producer must follow each other
+	for i := 0; i < len(texts); i += 4 {
+		producer := texts[i][1:]
+		for j, letter := range []string{"a", "b", "c", "d"} {
+			if texts[i+j] != letter+producer {
+				t.Fatalf("interleaved utterances: %q", texts)
+			}
+		}
+	}
+	if err = conn.Send(context.Background(), "late"); !errors.Is(err, ErrInputClosed) {
+		t.Errorf("expected ErrInputClosed after CloseInput, got %v", err)
+	}
+}
+
+func TestTTSTaggedUtterances(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const producers = 4
+	var wg sync.WaitGroup
+	for producer := range producers {
+		wg.Go(func() {
+			text := fmt.Sprintf("a%[1]d b%[1]d c%[1]d", producer)
+			if err := conn.SendTagged(context.Background(), fmt.Sprintf("request-%d", producer), text); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		if err := conn.Send(context.Background(), "untagged"); err != nil {
+			t.Error(err)
+		}
+		if err := conn.CloseInput(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+	var (
+		current string
+		markers int
+		frames  = make(map[string]int)
+	)
+	for msg := range conn.GetReadChan() {
+		switch typed := msg.(type) {
+		case MessagePackUtterance:
+			current = typed.ID
+			markers++
+		case MessagePackText:
+			if expected := "request-" + typed.Text[1:]; typed.Text != "untagged" && current != expected {
+				t.Errorf("word %q attributed to %q, expected %q", typed.Text, current, expected)
+			}
+		case MessagePackAudio:
+			frames[current]++
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if markers != producers+1 || frames[""] != 1 {
+		t.Errorf("got %d utterance markers and %d untagged frames, expected %d and 1", markers, frames[""], producers+1)
+	}
+	for producer := range producers {
+		if id := fmt.Sprintf("request-%d", producer); frames[id] != 3 {
+			t.Errorf("got %d audio frames for %q, expected 3", frames[id], id)
+		}
+	}
+}
+
+func TestTTSTee(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := conn.Tee(TeeOutput{}, TeeOutput{}, TeeOutput{Buffer: 1, Policy: TeeDropNewest})
+	go streamWords(conn.GetContext(), conn.GetWriteChan(), "one two three")
+	counts := make(chan int, 2)
+	for _, output := range outputs[:2] {
+		go func() {
+			var received int
+			for range output {
+				received++
+			}
+			counts <- received
+		}()
+	}
+	// Ready, then a text and an audio frame per word
+	for range 2 {
+		if received := <-counts; received != 7 {
+			t.Errorf("got %d messages on a blocking output, expected 7", received)
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	var dropped []MessagePack
+	for msg := range outputs[2] {
+		dropped = append(dropped, msg)
+	}
+	if len(dropped) != 1 || dropped[0].MessageType() != MessagePackTypeReady {
+		t.Errorf("got %d messages on the unread output, expected only the Ready frame", len(dropped))
+	}
+}
+
+func TestTTSMaxDurations(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{
+		URL:                  server.URL(),
+		MaxSessionDuration:   300 * time.Millisecond,
+		MaxUtteranceDuration: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a stuck producer holding the input
+	stuck, err := conn.BeginUtterance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stuck.Write(context.Background(), "stuck"); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		// waits for the stuck utterance to expire, the session is never closed
+		if err := conn.Send(context.Background(), "next"); err != nil {
+			t.Error(err)
+		}
+		if err := stuck.Write(context.Background(), "late"); !errors.Is(err, ErrMaxUtteranceDuration) {
+			t.Errorf("expected ErrMaxUtteranceDuration, got %v", err)
+		}
+		stuck.End()
+	}()
+	var texts []string
+	for msg := range conn.GetReadChan() {
+		if text, ok := msg.(MessagePackText); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	if err = conn.Done(); !errors.Is(err, ErrMaxSessionDuration) {
+		t.Fatalf("expected ErrMaxSessionDuration, got %v", err)
+	}
+	if !slices.Equal(texts, []string{"stuck", "next"}) {
+		t.Errorf("got texts %q, expected the ones sent before the limit", texts)
+	}
+}
+
+func TestTTSConnectWithVoice(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), Voice: "first.wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, voice := range []string{"first.wav", "second.wav", ""} {
+		conn, err := client.Connect(context.Background(), WithVoice(voice))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for msg := range conn.GetReadChan() {
+			if msg.MessageType() == MessagePackTypeReady {
+				break
+			}
+		}
+		if info, _ := conn.ReadyInfo(); info.Voice != voice {
+			t.Errorf("connected with voice %q, expected %q", info.Voice, voice)
+		}
+		if err = conn.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTTSSynthesizeDialogue(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), Voice: "narrator.wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialogue, err := client.SynthesizeDialogue(context.Background(), []DialogueLine{
+		{Voice: "alice.wav", Text: "Hello Bob"},
+		{Text: "Hi"},
+	}, DialogueConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mock server sends a frame per word
+	first := DialogueTurn{Voice: "alice.wav", Text: "Hello Bob", Start: 0, End: 2 * FrameDuration}
+	second := DialogueTurn{Voice: "narrator.wav", Text: "Hi", Start: first.End + DefaultDialogueGap, End: first.End + DefaultDialogueGap + FrameDuration}
+	if !slices.Equal(dialogue.Turns, []DialogueTurn{first, second}) {
+		t.Errorf("unexpected turns: %+v", dialogue.Turns)
+	}
+	if len(dialogue.PCM) != durationSamples(second.End) || len(dialogue.Voices) != 2 {
+		t.Errorf("unexpected dialogue: %d samples, voices %+v", len(dialogue.PCM), dialogue.Voices)
+	}
+}
+
+func TestTTSStyles(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const markup = `Hello <style name="whisper">dear</style> friend`
+	if _, err = client.Connect(context.Background(), WithStyle(StyleWhisper)); !errors.Is(err, ErrUnsupportedStyle) {
+		t.Fatalf("connected with an unsupported style: %v", err)
+	}
+	if _, err = client.Synthesize(context.Background(), markup); !errors.Is(err, ErrUnsupportedStyle) {
+		t.Fatalf("synthesized an unsupported style: %v", err)
+	}
+	client.capabilities = &StyleCapabilities{Styles: []Style{StyleWhisper}, Emotions: []Emotion{"excited"}}
+	if url := client.connectionURL("", client.codec, newConnectOptions([]ConnectOption{WithStyle(StyleWhisper), WithEmotion("excited")})); !strings.Contains(url, "style=whisper") || !strings.Contains(url, "emotion=excited") {
+		t.Errorf("style and emotion missing from %s", url)
+	}
+	// one connection per run, one audio frame per word
+	pcm, err := client.Synthesize(context.Background(), markup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 3*FrameSize {
+		t.Errorf("synthesized %d samples, expected %d", len(pcm), 3*FrameSize)
+	}
+}
+
+func TestTTSStereo(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background(), WithStereo(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Channels() != StereoChannels {
+		t.Fatalf("connection has %d channels, expected %d", conn.Channels(), StereoChannels)
+	}
+	go func() {
+		conn.GetWriteChan() <- "hello"
+		close(conn.GetWriteChan())
+	}()
+	var frames int
+	for msg := range conn.GetReadChan() {
+		audio, ok := msg.(MessagePackAudio)
+		if !ok {
+			continue
+		}
+		frames++
+		if len(audio.PCM) != FrameSize*StereoChannels {
+			t.Errorf("received %d samples, expected %d", len(audio.PCM), FrameSize*StereoChannels)
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if frames != 1 {
+		t.Errorf("received %d audio frames, expected 1", frames)
+	}
+	// fully left, centered at constant power
+	if stereo := Pan([]float32{1}, -1); stereo[0] != 1 || stereo[1] > 1e-6 {
+		t.Errorf("Pan(-1) = %v", stereo)
+	}
+	if stereo := Pan([]float32{1}, 0); math.Abs(float64(stereo[0]*stereo[0]+stereo[1]*stereo[1])-1) > 1e-6 {
+		t.Errorf("Pan(0) = %v", stereo)
+	}
+}
+
+// recordSink keeps the samples written to it, failing with err if set.
+type recordSink struct {
+	pcm       []float32
+	discarded int
+	err       error
+}
+
+func (rs *recordSink) WritePCM(pcm []float32) error {
+	if rs.err != nil {
+		return rs.err
+	}
+	rs.pcm = append(rs.pcm, pcm...)
+	return nil
+}
+
+func (rs *recordSink) Discard() {
+	rs.discarded++
+}
+
+func TestPanSink(t *testing.T) {
+	center := float32(math.Sqrt2 / 2)
+	for _, tc := range []struct {
+		pan         float32
+		left, right float32
+	}{
+		{-1, 1, 0},
+		{0, center, center},
+		{1, 0, 1},
+		// out of range positions are clamped
+		{-2, 1, 0},
+	} {
+		stereo := &recordSink{}
+		if err := PanSink(stereo, tc.pan).WritePCM([]float32{1, -0.5}); err != nil {
+			t.Fatal(err)
+		}
+		expected := []float32{tc.left, tc.right, -0.5 * tc.left, -0.5 * tc.right}
+		if !slices.EqualFunc(stereo.pcm, expected, func(a, b float32) bool { return math.Abs(float64(a-b)) < 1e-6 }) {
+			t.Errorf("pan %v: got %v, expected %v", tc.pan, stereo.pcm, expected)
+		}
+	}
+	stereo := &recordSink{err: io.ErrClosedPipe}
+	sink := PanSink(stereo, 0)
+	if err := sink.WritePCM([]float32{1}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("got %v, expected the error of the stereo sink", err)
+	}
+	if sink.Discard(); stereo.discarded != 1 {
+		t.Error("the discard did not reach the stereo sink")
+	}
+}
+
+func TestTTSDecodeWorkers(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL(), DecodeWorkers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const words = 50
+	go func() {
+		for i := range words {
+			conn.GetWriteChan() <- fmt.Sprint(i)
+		}
+		close(conn.GetWriteChan())
+	}()
+	// each word echo is followed by its audio frame
+	var types []MessagePackType
+	for msg := range conn.GetReadChan() {
+		if text, ok := msg.(MessagePackText); ok && text.Text != fmt.Sprint(len(types)/2) {
+			t.Fatalf("received word %q at position %d", text.Text, len(types)/2)
+		}
+		if msg.MessageType() != MessagePackTypeReady {
+			types = append(types, msg.MessageType())
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	expected := slices.Repeat([]MessagePackType{MessagePackTypeText, MessagePackTypeAudio}, words)
+	if !slices.Equal(types, expected) {
+		t.Errorf("received %v, expected alternating text and audio", types)
+	}
+}
+
+func TestTTSSendMarker(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer close(conn.GetWriteChan())
+		for _, text := range []string{"hello world", "again"} {
+			conn.GetWriteChan() <- text
+			if _, err := conn.SendMarker(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	var received []string
+	for msg := range conn.GetReadChan() {
+		switch msg := msg.(type) {
+		case MessagePackText:
+			received = append(received, msg.Text)
+		case MessagePackAudio:
+			received = append(received, "audio")
+		case MessagePackMarker:
+			received = append(received, fmt.Sprintf("marker %d", msg.ID))
+		}
+	}
+	if err = conn.Done(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"hello world", "audio", "marker 1", "again", "audio", "marker 2"}
+	if !slices.Equal(received, expected) {
+		t.Errorf("got %q, expected %q", received, expected)
+	}
+	if _, err = conn.SendMarker(); err == nil {
+		t.Error("marker sent after the end of the stream")
+	}
+}
+
+func TestTextPacer(t *testing.T) {
+	pacer := newTextPacer(2 * time.Second)
+	ctx := context.Background()
+	// The first words are sent whatever the limit
+	for range pacingMinWords {
+		if err := pacer.wait(ctx, "word"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 8 words of speech are more than 2s ahead: the next one waits for their synthesis
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := pacer.wait(waitCtx, "word"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("the word was not held: %v", err)
+	}
+	sent := make(chan error, 1)
+	go func() {
+		sent <- pacer.wait(ctx, "two words")
+	}()
+	for range 4 {
+		pacer.textEchoed()
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	// With the speaking rate of the voice (200ms per word), 2s are 10 words ahead
+	for range 6 {
+		pacer.textEchoed()
+	}
+	pacer.audioReceived(2 * time.Second)
+	for range 11 {
+		if err := pacer.wait(ctx, "word"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitCtx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := pacer.wait(waitCtx, "word"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("the word was not held: %v", err)
+	}
+}
+
+func TestChunkSentences(t *testing.T) {
+	text := "Hello Mr. Smith, the meeting is at 3.30 today. Is J. R. R. Tolkien here? He is (in the garden.)\n" +
+		"A title without period\n\n  Next paragraph 你好。再见！"
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Split(bufio.SplitFunc(ChunkSentences))
+	var sentences []string
+	for scanner.Scan() {
+		sentences = append(sentences, scanner.Text())
+	}
+	expected := []string{
+		"Hello Mr. Smith, the meeting is at 3.30 today.",
+		"Is J. R. R. Tolkien here?",
+		"He is (in the garden.)",
+		"A title without period",
+		"Next paragraph 你好。",
+		"再见！",
+	}
+	if !slices.Equal(sentences, expected) {
+		t.Errorf("got %q, expected %q", sentences, expected)
+	}
+}
+
+func TestSpeakerOnSpeaking(t *testing.T) {
+	server := newMockServer(t)
+	client, err := NewTTSClient(&TTSConfig{URL: server.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	speaker := NewSpeaker(context.Background(), client, discardSink{})
+	states := make(chan bool, 4)
+	speaker.OnSpeaking(func(speaking bool) {
+		states <- speaking
+	})
+	for range 2 {
+		if err = <-speaker.Say("hello there", PriorityNormal); err != nil {
+			t.Fatal(err)
+		}
+		if speaking := <-states; !speaking {
+			t.Fatal("the speaker did not start speaking")
+		}
+		if speaking := <-states; speaking {
+			t.Fatal("the speaker did not stop speaking")
+		}
+	}
+	speaker.Close()
+	select {
+	case speaking := <-states:
+		t.Errorf("unexpected state change after the close: %v", speaking)
+	default:
+	}
+}
@@ -0,0 +1,195 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInputClosed is returned when writing to a TTS connection whose input has been closed, or
+// which stopped.
+var ErrInputClosed = errors.New("the connection input is closed")
+
+// inputLock serializes the producers of a TTS connection: the one holding the token owns the
+// write channel.
+type inputLock struct {
+	token chan struct{}
+	// protected by the token
+	closed bool
+}
+
+func newInputLock() *inputLock {
+	return &inputLock{token: make(chan struct{}, 1)}
+}
+
+// acquireInput waits for the producer holding the input to release it.
+func (ttsc *TTSConnection) acquireInput(ctx context.Context) (err error) {
+	select {
+	case ttsc.input.token <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ttsc.inputCtx.Done():
+		return fmt.Errorf("%w: the connection stopped", ErrInputClosed)
+	}
+	if ttsc.input.closed {
+		ttsc.releaseInput()
+		return ErrInputClosed
+	}
+	return
+}
+
+func (ttsc *TTSConnection) releaseInput() {
+	<-ttsc.input.token
+}
+
+// closeInput ends the stream, the input must be held.
+func (ttsc *TTSConnection) closeInput() {
+	if !ttsc.input.closed {
+		ttsc.input.closed = true
+		close(ttsc.writerChan)
+	}
+}
+
+// send writes a text of the utterance id to the connection, the input must be held.
+func (ttsc *TTSConnection) send(ctx context.Context, id, text string) (err error) {
+	ttsc.utterances.sent(id, text)
+	select {
+	case ttsc.writerChan <- text:
+		return
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-ttsc.inputCtx.Done():
+		err = fmt.Errorf("%w: the connection stopped", ErrInputClosed)
+	}
+	ttsc.utterances.unsent(text)
+	return
+}
+
+// UtteranceWriter holds the input of a TTS connection for one producer: its texts are sent in a
+// row, the other producers wait for it to end. It is meant to be used by a single goroutine.
+type UtteranceWriter struct {
+	conn  *TTSConnection
+	id    string
+	timer *time.Timer
+	// protected by mutex, the utterance can be ended by its timer
+	mutex   sync.Mutex
+	ended   bool
+	expired bool
+}
+
+// BeginUtterance waits for the other producers to end their utterance and reserves the input of
+// the connection. The returned utterance must be ended for the others to go on.
+//
+// The connection can then be fed from several goroutines safely with BeginUtterance, Send,
+// StreamFrom and CloseInput: do not use the write channel directly at the same time. With
+// TTSConfig.MaxUtteranceDuration, the utterance is ended automatically once it is held too long.
+func (ttsc *TTSConnection) BeginUtterance(ctx context.Context) (uw *UtteranceWriter, err error) {
+	if err = ttsc.acquireInput(ctx); err != nil {
+		return
+	}
+	uw = &UtteranceWriter{conn: ttsc}
+	if ttsc.maxUtterance > 0 {
+		uw.timer = time.AfterFunc(ttsc.maxUtterance, uw.expire)
+	}
+	return
+}
+
+// BeginTaggedUtterance is BeginUtterance with an ID correlating the utterance with its audio: a
+// MessagePackUtterance carrying the ID is delivered on the read channel before the frames of its
+// words. This lets an application multiplexing several requests on a connection know which audio
+// answers which request.
+//
+// The correlation is made client side by counting the words echoed by the server: the texts
+// written on the write channel directly are not counted and shift it.
+func (ttsc *TTSConnection) BeginTaggedUtterance(ctx context.Context, id string) (uw *UtteranceWriter, err error) {
+	if uw, err = ttsc.BeginUtterance(ctx); err != nil {
+		return
+	}
+	uw.id = id
+	return
+}
+
+// ID returns the ID of the utterance, empty if it was begun with BeginUtterance.
+func (uw *UtteranceWriter) ID() string {
+	return uw.id
+}
+
+// Write sends a text (usually a word) as part of the utterance. It fails with
+// ErrMaxUtteranceDuration once the utterance has been held too long.
+func (uw *UtteranceWriter) Write(ctx context.Context, text string) (err error) {
+	uw.mutex.Lock()
+	defer uw.mutex.Unlock()
+	if uw.expired {
+		return fmt.Errorf("%w (%s)", ErrMaxUtteranceDuration, uw.conn.maxUtterance)
+	}
+	if uw.ended {
+		return errors.New("the utterance has ended")
+	}
+	return uw.conn.send(ctx, uw.id, text)
+}
+
+// End releases the input for the next producer, it can be called several times.
+func (uw *UtteranceWriter) End() {
+	if uw.timer != nil {
+		uw.timer.Stop()
+	}
+	uw.mutex.Lock()
+	defer uw.mutex.Unlock()
+	uw.release()
+}
+
+// expire ends the utterance once its maximum duration is reached.
+func (uw *UtteranceWriter) expire() {
+	uw.mutex.Lock()
+	defer uw.mutex.Unlock()
+	if !uw.ended {
+		uw.expired = true
+		uw.release()
+	}
+}
+
+// release gives the input back, the mutex must be held.
+func (uw *UtteranceWriter) release() {
+	if !uw.ended {
+		uw.ended = true
+		uw.conn.releaseInput()
+	}
+}
+
+// Send sends the words of text as one utterance, never interleaved with the words of other
+// producers.
+func (ttsc *TTSConnection) Send(ctx context.Context, text string) (err error) {
+	return ttsc.SendTagged(ctx, "", text)
+}
+
+// SendTagged is Send with an ID correlating the utterance with its audio, see BeginTaggedUtterance.
+func (ttsc *TTSConnection) SendTagged(ctx context.Context, id, text string) (err error) {
+	uw, err := ttsc.BeginTaggedUtterance(ctx, id)
+	if err != nil {
+		return
+	}
+	defer uw.End()
+	for word := range strings.FieldsSeq(text) {
+		if err = uw.Write(ctx, word); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// CloseInput ends the stream once the current utterance (if any) is ended: the server finishes
+// the synthesis and the read channel is closed. The next writes fail with ErrInputClosed.
+func (ttsc *TTSConnection) CloseInput(ctx context.Context) (err error) {
+	if err = ttsc.acquireInput(ctx); err != nil {
+		if errors.Is(err, ErrInputClosed) {
+			err = nil
+		}
+		return
+	}
+	defer ttsc.releaseInput()
+	ttsc.closeInput()
+	return
+}
@@ -0,0 +1,91 @@
+package krs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// markerTracker synthesizes the markers of a TTS connection, the server not supporting them: a
+// marker is placed after the words written so far and delivered once the server moved on to the
+// next words (or ended the stream), all the audio of the words before it being delivered by then.
+type markerTracker struct {
+	mutex   sync.Mutex
+	sent    int
+	echoed  int
+	pending []pendingMarker
+}
+
+type pendingMarker struct {
+	id    int64
+	words int // words written before the marker
+}
+
+// written records the words of a text written on the wire by the writer.
+func (mt *markerTracker) written(text string) {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	mt.sent += len(strings.Fields(text))
+}
+
+// mark places a marker after the words written so far.
+func (mt *markerTracker) mark(id int64) {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	mt.pending = append(mt.pending, pendingMarker{id: id, words: mt.sent})
+}
+
+// reached consumes the words of a text echoed by the server and returns the markers placed before
+// them, in order.
+func (mt *markerTracker) reached(text string) (markers []int64) {
+	words := len(strings.Fields(text))
+	if words == 0 {
+		return
+	}
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	for len(mt.pending) > 0 && mt.pending[0].words <= mt.echoed {
+		markers = append(markers, mt.pending[0].id)
+		mt.pending = mt.pending[1:]
+	}
+	mt.echoed += words
+	return
+}
+
+// flush returns the markers left once the stream ended, in order.
+func (mt *markerTracker) flush() (markers []int64) {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	for _, marker := range mt.pending {
+		markers = append(markers, marker.id)
+	}
+	mt.pending = nil
+	return
+}
+
+// SendMarker places a marker after the texts already written on the write channel. The server does
+// not support markers: the marker is delivered on the read channel once all the audio of these
+// texts has been, that is when the server moves on to the next words or ends the stream. The model
+// needs some text ahead to synthesize the last words: an application waiting for the marker to
+// start its next dialogue turn should close the input (see CloseInput()) or keep streaming text.
+func (ttsc *TTSConnection) SendMarker() (markerID int64, err error) {
+	markerID = ttsc.markerIDsGen.Add(1)
+	select {
+	case ttsc.markerChan <- markerID:
+	case <-ttsc.writerDone:
+		err = fmt.Errorf("failed to send marker ID %d: the write channel has been closed", markerID)
+	case <-ttsc.workersCtx.Done():
+		err = fmt.Errorf("failed to send marker ID %d: %w", markerID, ttsc.workersCtx.Err())
+	}
+	return
+}
+
+// deliverMarkers hands over the markers reached to the user.
+func (ttsc *TTSConnection) deliverMarkers(markers []int64) (err error) {
+	for _, id := range markers {
+		if err = ttsc.deliver(MessagePackMarker{Type: MessagePackTypeMarker, ID: id}); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package krs
+
+import (
+	"strings"
+	"sync"
+)
+
+// MessagePackTypeUtterance is not a server frame: the TTS read channels deliver it between the
+// frames of utterances with different IDs (see BeginTaggedUtterance).
+const MessagePackTypeUtterance MessagePackType = "Utterance"
+
+// MessagePackUtterance is delivered on the TTS read channel when the synthesis moves on to the words
+// of an utterance with another ID: the frames read after it belong to that utterance, until the
+// next one. ID is empty for the words sent without ID.
+type MessagePackUtterance struct {
+	Type MessagePackType `json:"type"`
+	ID   string          `json:"id"`
+}
+
+func (mpu MessagePackUtterance) MessageType() MessagePackType {
+	return mpu.Type
+}
+
+// utteranceTracker correlates the words echoed by the server with the ID of the utterance they
+// were sent with: the server echoes the words in the order it received them.
+type utteranceTracker struct {
+	mutex   sync.Mutex
+	pending []taggedWords
+	current string
+}
+
+type taggedWords struct {
+	id    string
+	words int
+}
+
+// sent records the words of a text about to be sent, the input must be held.
+func (ut *utteranceTracker) sent(id, text string) {
+	words := len(strings.Fields(text))
+	if words == 0 {
+		return
+	}
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	if last := len(ut.pending) - 1; last >= 0 && ut.pending[last].id == id {
+		ut.pending[last].words += words
+		return
+	}
+	ut.pending = append(ut.pending, taggedWords{id: id, words: words})
+}
+
+// unsent forgets the last text recorded by sent() as it could not be sent, the input must be held.
+func (ut *utteranceTracker) unsent(text string) {
+	words := len(strings.Fields(text))
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	if last := len(ut.pending) - 1; last >= 0 {
+		if ut.pending[last].words -= words; ut.pending[last].words <= 0 {
+			ut.pending = ut.pending[:last]
+		}
+	}
+}
+
+// echoed consumes the words of a text echoed by the server and returns the ID of the utterance
+// they belong to, changed is true if it is not the one of the previous words.
+func (ut *utteranceTracker) echoed(text string) (id string, changed bool) {
+	words := len(strings.Fields(text))
+	ut.mutex.Lock()
+	defer ut.mutex.Unlock()
+	if words == 0 || len(ut.pending) == 0 {
+		// unknown words (written on the channel directly): keep the current utterance
+		return ut.current, false
+	}
+	id = ut.pending[0].id
+	for words > 0 && len(ut.pending) > 0 {
+		consumed := min(words, ut.pending[0].words)
+		words -= consumed
+		if ut.pending[0].words -= consumed; ut.pending[0].words == 0 {
+			ut.pending = ut.pending[1:]
+		}
+	}
+	changed = id != ut.current
+	ut.current = id
+	return
+}
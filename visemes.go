@@ -0,0 +1,324 @@
+package krs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Viseme is a mouth shape, named after the 15 visemes of the Oculus lip-sync set supported by most
+// avatar tools (Ready Player Me, VRM, MetaHuman...).
+type Viseme string
+
+const (
+	VisemeSilence Viseme = "sil"
+	VisemePP      Viseme = "PP" // p, b, m
+	VisemeFF      Viseme = "FF" // f, v
+	VisemeTH      Viseme = "TH" // th
+	VisemeDD      Viseme = "DD" // t, d
+	VisemeKK      Viseme = "kk" // k, g
+	VisemeCH      Viseme = "CH" // ch, sh, j
+	VisemeSS      Viseme = "SS" // s, z
+	VisemeNN      Viseme = "nn" // n, l
+	VisemeRR      Viseme = "RR" // r
+	VisemeAA      Viseme = "aa" // car
+	VisemeE       Viseme = "E"  // bed
+	VisemeIH      Viseme = "ih" // tip, see
+	VisemeOH      Viseme = "oh" // toe
+	VisemeOU      Viseme = "ou" // book, you
+)
+
+const (
+	// duration of a viseme, a word lasts as long as its visemes unless the next one starts earlier
+	visemeDuration = 80 * time.Millisecond
+	// viseme events waiting for the consumer before their delivery blocks
+	visemeEventsQueue = 64
+)
+
+// visemeDigraphs are the letter pairs read as a single sound.
+var visemeDigraphs = map[string][]Viseme{
+	"th": {VisemeTH},
+	"sh": {VisemeCH},
+	"ch": {VisemeCH},
+	"ph": {VisemeFF},
+	"ck": {VisemeKK},
+	"ng": {VisemeNN},
+	"qu": {VisemeKK, VisemeOU},
+	"oo": {VisemeOU},
+	"ee": {VisemeIH},
+	"ea": {VisemeIH},
+	"ou": {VisemeAA, VisemeOU},
+	"ow": {VisemeAA, VisemeOU},
+}
+
+// visemeLetters maps the single letters, h is not visible.
+var visemeLetters = map[rune][]Viseme{
+	'a': {VisemeAA}, 'à': {VisemeAA}, 'â': {VisemeAA},
+	'e': {VisemeE}, 'é': {VisemeE}, 'è': {VisemeE}, 'ê': {VisemeE},
+	'i': {VisemeIH}, 'î': {VisemeIH}, 'ï': {VisemeIH}, 'y': {VisemeIH},
+	'o': {VisemeOH}, 'ô': {VisemeOH},
+	'u': {VisemeOU}, 'ù': {VisemeOU}, 'û': {VisemeOU}, 'w': {VisemeOU},
+	'b': {VisemePP}, 'm': {VisemePP}, 'p': {VisemePP},
+	'f': {VisemeFF}, 'v': {VisemeFF},
+	't': {VisemeDD}, 'd': {VisemeDD},
+	'k': {VisemeKK}, 'g': {VisemeKK}, 'q': {VisemeKK}, 'c': {VisemeKK},
+	'j': {VisemeCH},
+	's': {VisemeSS}, 'z': {VisemeSS}, 'ç': {VisemeSS},
+	'x': {VisemeKK, VisemeSS},
+	'n': {VisemeNN}, 'l': {VisemeNN},
+	'r': {VisemeRR},
+}
+
+// WordVisemes approximates the visemes of a word with spelling rules (English, and French
+// accents), without a pronunciation dictionary: good enough to animate a mouth, not to read lips.
+func WordVisemes(word string) (visemes []Viseme) {
+	letters := []rune(strings.ToLower(word))
+	// a final silent e (make, time) is not pronounced
+	if n := len(letters); n > 2 && letters[n-1] == 'e' && !strings.ContainsRune("aeiouy", letters[n-2]) {
+		letters = letters[:n-1]
+	}
+	for i := 0; i < len(letters); i++ {
+		var shapes []Viseme
+		if i+1 < len(letters) {
+			shapes = visemeDigraphs[string(letters[i:i+2])]
+		}
+		switch {
+		case shapes != nil:
+			i++
+		case letters[i] == 'c' && i+1 < len(letters) && strings.ContainsRune("eiy", letters[i+1]):
+			// soft c (city, face)
+			shapes = []Viseme{VisemeSS}
+		case unicode.IsLetter(letters[i]):
+			shapes = visemeLetters[letters[i]]
+		}
+		for _, shape := range shapes {
+			// a doubled letter (hello, butter) is a single shape
+			if len(visemes) == 0 || visemes[len(visemes)-1] != shape {
+				visemes = append(visemes, shape)
+			}
+		}
+	}
+	return
+}
+
+// VisemeEvent is a mouth shape to show from a time of the audio (the time of the connection audio
+// stream) until the next event.
+type VisemeEvent struct {
+	Viseme Viseme
+	At     time.Duration
+	// Word being said, empty for the silences
+	Word string
+}
+
+// VisemeStream derives a lip-sync event stream from a TTS connection: the words echoed by the
+// server start when their Text frame is received (the audio before them was delivered), they are
+// split into visemes (see WordVisemes) and each event is delivered on Events() when the playback
+// reaches it. Give it the messages of the read channel with Observe() and play the audio through
+// Sink(): the audio written to the sink is the playback position. It supports mono audio only.
+type VisemeStream struct {
+	ctx     context.Context
+	latency time.Duration
+	events  chan VisemeEvent
+	// protected by mutex
+	mutex sync.Mutex
+	// audio received, in samples
+	received int
+	// audio played, in samples
+	played int
+	// events not reached by the playback yet, in order
+	timeline []VisemeEvent
+	// start of the last word and its estimated end
+	lastStart, lastEnd time.Duration
+	// events reached by the playback, waiting for their wall clock time
+	due     []dueViseme
+	changed chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+type dueViseme struct {
+	event VisemeEvent
+	at    time.Time
+}
+
+// NewVisemeStream starts a viseme stream. latency is the output latency of the audio player: the
+// time between a sample written to its sink and the sample being heard.
+func NewVisemeStream(ctx context.Context, latency time.Duration) (vs *VisemeStream) {
+	vs = &VisemeStream{
+		ctx:     ctx,
+		latency: latency,
+		events:  make(chan VisemeEvent, visemeEventsQueue),
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go vs.run()
+	return
+}
+
+// Events returns the channel of the viseme events, closed once the stream is closed.
+func (vs *VisemeStream) Events() <-chan VisemeEvent {
+	return vs.events
+}
+
+// Observe builds the timeline with a message of the TTS read channel: the Text and Audio frames.
+func (vs *VisemeStream) Observe(msg MessagePack) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	switch typed := msg.(type) {
+	case MessagePackAudio:
+		vs.received += len(typed.PCM)
+	case MessagePackText:
+		vs.addWord(typed.Text, time.Duration(vs.received)*time.Second/SampleRate)
+	}
+}
+
+// addWord adds the visemes of a word to the timeline, the mutex must be held.
+func (vs *VisemeStream) addWord(word string, start time.Duration) {
+	visemes := WordVisemes(word)
+	if len(visemes) == 0 {
+		return
+	}
+	// The previous word did not last as long as estimated: its pending visemes (and its silence)
+	// are squeezed before this one
+	if start < vs.lastEnd {
+		kept := vs.timeline[:0]
+		for _, event := range vs.timeline {
+			if event.Viseme == VisemeSilence && event.At >= start {
+				continue
+			}
+			if event.At > vs.lastStart {
+				event.At = vs.lastStart + (event.At-vs.lastStart)*(start-vs.lastStart)/(vs.lastEnd-vs.lastStart)
+			}
+			kept = append(kept, event)
+		}
+		vs.timeline = kept
+	}
+	for i, viseme := range visemes {
+		vs.timeline = append(vs.timeline, VisemeEvent{
+			Viseme: viseme,
+			At:     start + time.Duration(i)*visemeDuration,
+			Word:   word,
+		})
+	}
+	vs.lastStart = start
+	vs.lastEnd = start + time.Duration(len(visemes))*visemeDuration
+	vs.timeline = append(vs.timeline, VisemeEvent{Viseme: VisemeSilence, At: vs.lastEnd})
+}
+
+// Sink returns an audio sink writing to sink (the audio player) and tracking the playback position:
+// the events of the audio written are delivered when it is heard.
+func (vs *VisemeStream) Sink(sink AudioSink) AudioSink {
+	return visemeSink{stream: vs, sink: sink}
+}
+
+type visemeSink struct {
+	stream *VisemeStream
+	sink   AudioSink
+}
+
+func (vsk visemeSink) WritePCM(pcm []float32) (err error) {
+	if err = vsk.sink.WritePCM(pcm); err != nil {
+		return
+	}
+	vsk.stream.advance(len(pcm))
+	return
+}
+
+// Discard drops the audio not played yet along with its events: the mouth closes.
+func (vsk visemeSink) Discard() {
+	vsk.sink.Discard()
+	vsk.stream.discard()
+}
+
+// advance schedules the events of the audio written to the player.
+func (vs *VisemeStream) advance(samples int) {
+	now := time.Now()
+	vs.mutex.Lock()
+	start := time.Duration(vs.played) * time.Second / SampleRate
+	vs.played += samples
+	end := time.Duration(vs.played) * time.Second / SampleRate
+	var reached int
+	for reached < len(vs.timeline) && vs.timeline[reached].At < end {
+		event := vs.timeline[reached]
+		vs.due = append(vs.due, dueViseme{
+			event: event,
+			at:    now.Add(vs.latency + max(event.At-start, 0)),
+		})
+		reached++
+	}
+	vs.timeline = vs.timeline[reached:]
+	vs.mutex.Unlock()
+	if reached > 0 {
+		notify(vs.changed)
+	}
+}
+
+// discard drops the events of the audio received but not played, the mouth closes.
+func (vs *VisemeStream) discard() {
+	vs.mutex.Lock()
+	vs.timeline = nil
+	vs.due = append(vs.due[:0], dueViseme{event: VisemeEvent{Viseme: VisemeSilence}, at: time.Now()})
+	vs.received, vs.played = 0, 0
+	vs.lastStart, vs.lastEnd = 0, 0
+	vs.mutex.Unlock()
+	notify(vs.changed)
+}
+
+// Reset starts the timeline of a new connection, the events of the previous one not played yet
+// are dropped.
+func (vs *VisemeStream) Reset() {
+	vs.discard()
+}
+
+// Close stops the stream: the events not delivered yet are dropped and Events() is closed.
+func (vs *VisemeStream) Close() {
+	vs.mutex.Lock()
+	if !vs.closed {
+		vs.closed = true
+		close(vs.done)
+	}
+	vs.mutex.Unlock()
+}
+
+// run delivers the events at their wall clock time.
+func (vs *VisemeStream) run() {
+	defer close(vs.events)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		vs.mutex.Lock()
+		var next *dueViseme
+		if len(vs.due) > 0 {
+			next = &vs.due[0]
+		}
+		if next != nil && !next.at.After(time.Now()) {
+			event := next.event
+			vs.due = vs.due[1:]
+			vs.mutex.Unlock()
+			select {
+			case vs.events <- event:
+			case <-vs.done:
+				return
+			case <-vs.ctx.Done():
+				return
+			}
+			continue
+		}
+		wait := time.Hour
+		if next != nil {
+			wait = time.Until(next.at)
+		}
+		vs.mutex.Unlock()
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-vs.changed:
+		case <-vs.done:
+			return
+		case <-vs.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package krs
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVisemes(t *testing.T) {
+	for word, expected := range map[string][]Viseme{
+		"Hello": {VisemeE, VisemeNN, VisemeOH},
+		"think": {VisemeTH, VisemeIH, VisemeNN, VisemeKK},
+		"make":  {VisemePP, VisemeAA, VisemeKK},
+		"city":  {VisemeSS, VisemeIH, VisemeDD, VisemeIH},
+		"42!":   nil,
+	} {
+		if visemes := WordVisemes(word); !slices.Equal(visemes, expected) {
+			t.Errorf("%q: expected %v, got %v", word, expected, visemes)
+		}
+	}
+
+	// The second word starts before the estimated end of the first one
+	stream := NewVisemeStream(context.Background(), 0)
+	defer stream.Close()
+	stream.Observe(MessagePackText{Type: MessagePackTypeText, Text: "think"})
+	stream.Observe(MessagePackAudio{Type: MessagePackTypeAudio, PCM: make([]float32, durationSamples(200*time.Millisecond))})
+	stream.Observe(MessagePackText{Type: MessagePackTypeText, Text: "me"})
+	stream.Observe(MessagePackAudio{Type: MessagePackTypeAudio, PCM: make([]float32, durationSamples(200*time.Millisecond))})
+	sink := stream.Sink(discardSink{})
+	start := time.Now()
+	if err := sink.WritePCM(make([]float32, durationSamples(400*time.Millisecond))); err != nil {
+		t.Fatal(err)
+	}
+	var events []VisemeEvent
+	for event := range stream.Events() {
+		events = append(events, event)
+		if event.Viseme == VisemeSilence {
+			break
+		}
+	}
+	expected := []VisemeEvent{
+		{Viseme: VisemeTH, At: 0, Word: "think"},
+		{Viseme: VisemeIH, At: 50 * time.Millisecond, Word: "think"},
+		{Viseme: VisemeNN, At: 100 * time.Millisecond, Word: "think"},
+		{Viseme: VisemeKK, At: 150 * time.Millisecond, Word: "think"},
+		{Viseme: VisemePP, At: 200 * time.Millisecond, Word: "me"},
+		{Viseme: VisemeE, At: 280 * time.Millisecond, Word: "me"},
+		{Viseme: VisemeSilence, At: 360 * time.Millisecond},
+	}
+	if !slices.Equal(events, expected) {
+		t.Errorf("unexpected events:\n%v\nexpected:\n%v", events, expected)
+	}
+	// The events are delivered along the playback
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("the events were delivered ahead of the playback (%s)", elapsed)
+	}
+}
+
+type discardSink struct{}
+
+func (discardSink) WritePCM([]float32) error { return nil }
+func (discardSink) Discard()                 {}
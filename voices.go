@@ -0,0 +1,249 @@
+package krs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultVoiceRepository is the Hugging Face repository the Kyutai TTS server loads its voices from
+	DefaultVoiceRepository = "kyutai/tts-voices"
+	defaultVoiceIndexTTL   = 24 * time.Hour
+	voiceIndexTimeout      = 30 * time.Second
+)
+
+// ErrUnknownVoice is returned when a voice is not part of the gallery.
+var ErrUnknownVoice = errors.New("unknown voice")
+
+// Voice is a voice of the gallery, its name is the value of TTSConfig.Voice.
+type Voice struct {
+	Name       string `json:"name"`
+	Collection string `json:"collection"`
+	// Description is derived from the name for the known collections (expresso, vctk)
+	Description string `json:"description,omitempty"`
+}
+
+// VoiceGallery lists the voices of a Hugging Face repository. The index is kept in memory and, if
+// CacheDir is set, cached on disk for CacheTTL. Its zero value is ready to use.
+type VoiceGallery struct {
+	// Repository defaults to DefaultVoiceRepository
+	Repository string
+	CacheDir   string
+	// CacheTTL defaults to 24 hours
+	CacheTTL   time.Duration
+	HTTPClient *http.Client
+	// in memory index
+	mutex     sync.Mutex
+	voices    []Voice
+	fetchedAt time.Time
+}
+
+// Voices returns the voices of the gallery sorted by name.
+func (vg *VoiceGallery) Voices(ctx context.Context) (voices []Voice, err error) {
+	vg.mutex.Lock()
+	defer vg.mutex.Unlock()
+	if vg.voices != nil && time.Since(vg.fetchedAt) < vg.ttl() {
+		return vg.voices, nil
+	}
+	if vg.voices, vg.fetchedAt, err = vg.readCache(); err == nil && time.Since(vg.fetchedAt) < vg.ttl() {
+		return vg.voices, nil
+	}
+	if err = vg.fetch(ctx); err != nil {
+		return
+	}
+	return vg.voices, nil
+}
+
+// Refresh downloads the index again, ignoring the cache.
+func (vg *VoiceGallery) Refresh(ctx context.Context) (err error) {
+	vg.mutex.Lock()
+	defer vg.mutex.Unlock()
+	return vg.fetch(ctx)
+}
+
+// Validate returns ErrUnknownVoice if the voice is not part of the gallery, suggesting the closest
+// voice name in the error message.
+func (vg *VoiceGallery) Validate(ctx context.Context, name string) (err error) {
+	voices, err := vg.Voices(ctx)
+	if err != nil {
+		return
+	}
+	if _, found := slices.BinarySearchFunc(voices, name, func(v Voice, name string) int {
+		return strings.Compare(v.Name, name)
+	}); found {
+		return
+	}
+	var (
+		closest  string
+		distance = -1
+	)
+	for _, voice := range voices {
+		if d := levenshtein(voice.Name, name); distance == -1 || d < distance {
+			closest, distance = voice.Name, d
+		}
+	}
+	if closest == "" {
+		return fmt.Errorf("%w %q", ErrUnknownVoice, name)
+	}
+	return fmt.Errorf("%w %q, did you mean %q?", ErrUnknownVoice, name, closest)
+}
+
+func (vg *VoiceGallery) repository() string {
+	if vg.Repository == "" {
+		return DefaultVoiceRepository
+	}
+	return vg.Repository
+}
+
+func (vg *VoiceGallery) ttl() time.Duration {
+	if vg.CacheTTL <= 0 {
+		return defaultVoiceIndexTTL
+	}
+	return vg.CacheTTL
+}
+
+func (vg *VoiceGallery) cacheFile() string {
+	if vg.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(vg.CacheDir, strings.ReplaceAll(vg.repository(), "/", "_")+".json")
+}
+
+// readCache must be called with the mutex held.
+func (vg *VoiceGallery) readCache() (voices []Voice, fetchedAt time.Time, err error) {
+	filename := vg.cacheFile()
+	if filename == "" {
+		err = os.ErrNotExist
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if err = json.NewDecoder(file).Decode(&voices); err != nil {
+		err = fmt.Errorf("failed to decode the voices cache: %w", err)
+		return
+	}
+	fetchedAt = info.ModTime()
+	return
+}
+
+// fetch must be called with the mutex held.
+func (vg *VoiceGallery) fetch(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, voiceIndexTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://huggingface.co/api/models/"+vg.repository()+"/tree/main?recursive=true", nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create the request: %w", err)
+		return
+	}
+	client := vg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to query the Hugging Face API: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected Hugging Face API answer: %s", resp.Status)
+		return
+	}
+	var files []struct {
+		Type string `json:"type"`
+		Path string `json:"path"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		err = fmt.Errorf("failed to decode the Hugging Face API answer: %w", err)
+		return
+	}
+	// Voices are stored as wave files next to their precomputed embeddings
+	// (voice.wav.1e68beda@240.safetensors): both refer to the same voice name
+	var names []string
+	for _, file := range files {
+		if file.Type != "file" {
+			continue
+		}
+		index := strings.Index(file.Path, ".wav")
+		if index == -1 {
+			continue
+		}
+		names = append(names, file.Path[:index+len(".wav")])
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+	vg.voices = make([]Voice, len(names))
+	for i, name := range names {
+		vg.voices[i] = newVoice(name)
+	}
+	vg.fetchedAt = time.Now()
+	// Cache the index, failing to do so only costs a download next time
+	if filename := vg.cacheFile(); filename != "" {
+		if payload, marshalErr := json.Marshal(vg.voices); marshalErr == nil {
+			if os.MkdirAll(vg.CacheDir, 0o755) == nil {
+				_ = os.WriteFile(filename, payload, 0o644)
+			}
+		}
+	}
+	return
+}
+
+func newVoice(name string) (voice Voice) {
+	voice.Name = name
+	collection, file, _ := strings.Cut(name, "/")
+	voice.Collection = collection
+	stem := strings.TrimSuffix(path.Base(file), ".wav")
+	parts := strings.Split(stem, "_")
+	switch collection {
+	case "expresso":
+		// speakers of the conversation, style, take, channel and duration: ex03-ex01_happy_001_channel1_334s
+		if len(parts) >= 4 {
+			voice.Description = fmt.Sprintf("Expresso conversation %s, %s style, %s",
+				parts[0], parts[1], strings.Replace(parts[3], "channel", "channel ", 1))
+		}
+	case "vctk":
+		// speaker and sentence: p225_023
+		voice.Description = "VCTK speaker " + parts[0]
+	}
+	return
+}
+
+// levenshtein returns the edit distance between two strings (by runes).
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := range ra {
+		current[0] = i + 1
+		for j := range rb {
+			cost := 1
+			if ra[i] == rb[j] {
+				cost = 0
+			}
+			current[j+1] = min(previous[j+1]+1, current[j]+1, previous[j]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,56 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestVoiceGallery(t *testing.T) {
+	var requests int
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: io.NopCloser(strings.NewReader(`[
+				{"type": "directory", "path": "expresso"},
+				{"type": "file", "path": "expresso/ex03-ex01_happy_001_channel1_334s.wav"},
+				{"type": "file", "path": "expresso/ex03-ex01_happy_001_channel1_334s.wav.1e68beda@240.safetensors"},
+				{"type": "file", "path": "vctk/p225_023.wav"}
+			]`)),
+		}, nil
+	})}
+	cacheDir := t.TempDir()
+	gallery := &VoiceGallery{CacheDir: cacheDir, HTTPClient: client}
+	voices, err := gallery.Voices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(voices) != 2 || voices[0].Description != "Expresso conversation ex03-ex01, happy style, channel 1" ||
+		voices[1].Description != "VCTK speaker p225" {
+		t.Errorf("unexpected voices: %+v", voices)
+	}
+	if err = gallery.Validate(context.Background(), "vctk/p225_023.wav"); err != nil {
+		t.Error(err)
+	}
+	err = gallery.Validate(context.Background(), "vctk/p225_23.wav")
+	if !errors.Is(err, ErrUnknownVoice) || !strings.Contains(err.Error(), `did you mean "vctk/p225_023.wav"`) {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	// a new gallery uses the disk cache
+	if _, err = (&VoiceGallery{CacheDir: cacheDir, HTTPClient: client}).Voices(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("the index has been downloaded %d times, expected once", requests)
+	}
+}
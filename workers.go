@@ -0,0 +1,64 @@
+package krs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrWorkerPanic is returned by Done() when a worker of the connection panicked (a user callback
+// for example): the connection is stopped instead of the program.
+var ErrWorkerPanic = errors.New("connection worker panicked")
+
+// ErrConnectionClosed is the cause of the connection context cancellation by Close().
+var ErrConnectionClosed = errors.New("connection closed")
+
+// recovered converts a panic of a worker into an error, stopping the other workers of the group.
+func recovered(worker func() error) func() error {
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v\n%s", ErrWorkerPanic, r, debug.Stack())
+			}
+		}()
+		return worker()
+	}
+}
+
+// workerGroup runs the workers of a connection, the first one failing cancels the context of the
+// others: golang.org/x/sync/errgroup, without adding a dependency to the library.
+type workerGroup struct {
+	wait    sync.WaitGroup
+	cancel  context.CancelCauseFunc
+	errOnce sync.Once
+	err     error
+}
+
+// newWorkerGroup returns a group and its context, done once a worker fails or Wait returns.
+func newWorkerGroup(ctx context.Context) (group *workerGroup, groupCtx context.Context) {
+	group = new(workerGroup)
+	groupCtx, group.cancel = context.WithCancelCause(ctx)
+	return
+}
+
+// Go runs a worker on its own goroutine.
+func (wg *workerGroup) Go(worker func() error) {
+	wg.wait.Go(func() {
+		if err := worker(); err != nil {
+			wg.errOnce.Do(func() {
+				wg.err = err
+				wg.cancel(err)
+			})
+		}
+	})
+}
+
+// Wait blocks until all the workers returned and returns the first error, it can be called
+// several times and concurrently.
+func (wg *workerGroup) Wait() error {
+	wg.wait.Wait()
+	wg.cancel(wg.err)
+	return wg.err
+}